@@ -11,7 +11,16 @@ import sys
 
 import uvicorn
 
+from src.config.config_file import ConfigFileError, load_config_file, profile_from_args
+
+# Load CONFIG_FILE before importing modules that read environment variables
+try:
+    load_config_file(profile=profile_from_args(sys.argv[1:]))
+except ConfigFileError as e:
+    sys.exit(str(e))
+
 from src.core.gateway_service import create_app
+from src.core.listener import SocketHandover, listening_socket
 from src.utils.helpers import format_log
 
 logger = logging.getLogger(__name__)
@@ -48,9 +57,11 @@ if __name__ == "__main__":
     
     logger.info(format_log('START', 'API Gateway', f'puerto {port}'))
     
-    # Run the application
+    # Run the application on a socket that can be inherited (LISTEN_FDS, SIGUSR2 handover)
     try:
-        uvicorn.run(app, host="0.0.0.0", port=port, log_level="info")
+        sock = listening_socket("0.0.0.0", port)
+        SocketHandover(sock).install()
+        uvicorn.Server(uvicorn.Config(app, log_level="info")).run(sockets=[sock])
     except KeyboardInterrupt:
         logger.info(format_log('INFO', 'Interrupción recibida', 'cerrando...'))
     except Exception as e:
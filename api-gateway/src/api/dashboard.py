@@ -0,0 +1,48 @@
+"""
+API Gateway - Admin Web Dashboard
+Serves the static dashboard under /ui. The page itself is public: it only holds
+assets, and every action goes through /api/v1 with the operator's credential,
+so RBAC is enforced by the same dependencies as the CLI.
+"""
+
+import os
+
+from fastapi import APIRouter, HTTPException
+from fastapi.responses import FileResponse, RedirectResponse
+
+STATIC_DIR = os.path.join(os.path.dirname(os.path.dirname(__file__)), "static")
+
+# Solo recursos propios: sin scripts inline ni terceros, y sin embeber en iframes
+SECURITY_HEADERS = {
+    "Content-Security-Policy": "default-src 'self'; frame-ancestors 'none'",
+    "X-Frame-Options": "DENY",
+    "X-Content-Type-Options": "nosniff",
+    "Cache-Control": "no-cache",
+}
+
+ASSETS = {
+    "dashboard.js": "application/javascript",
+    "dashboard.css": "text/css",
+}
+
+dashboard_router = APIRouter(include_in_schema=False)
+
+
+@dashboard_router.get("/ui")
+async def dashboard_redirect():
+    """Redirect to the canonical dashboard URL."""
+    return RedirectResponse("/ui/")
+
+
+@dashboard_router.get("/ui/")
+async def dashboard_page():
+    """Dashboard HTML page."""
+    return FileResponse(os.path.join(STATIC_DIR, "dashboard.html"), media_type="text/html", headers=SECURITY_HEADERS)
+
+
+@dashboard_router.get("/ui/{asset}")
+async def dashboard_asset(asset: str):
+    """Dashboard script and stylesheet (fixed allowlist, no arbitrary paths)."""
+    if asset not in ASSETS:
+        raise HTTPException(status_code=404, detail="Recurso no encontrado")
+    return FileResponse(os.path.join(STATIC_DIR, asset), media_type=ASSETS[asset], headers=SECURITY_HEADERS)
@@ -3,34 +3,87 @@ API Gateway - Endpoints Configuration
 Contains all API endpoints for the gateway service.
 """
 
+import json
 import logging
-from typing import Dict, List
+import secrets
+import uuid
+from typing import Dict, List, Optional
+from urllib.parse import parse_qsl
 
-from fastapi import APIRouter, HTTPException
+from fastapi import APIRouter, Depends, Header, HTTPException, Request, Response
 from pydantic import BaseModel
 
-from src.api.models import APIResponse, RunnerRequest
-from src.config.settings import ORCHESTRATOR_URL, DEFAULT_HEADERS
+from src.api.models import (
+    APIResponse, BudgetOverrideRequest, BudgetRequest, BulkOperationRequest, DockerHostDrainRequest,
+    FleetCutoverRequest, FleetCutoverRollbackRequest, ImageBuildRequest, ImageRollbackRequest, ImageRolloutRequest, OutboundWebhookRequest, PoolRestoreRequest, PoolRetireRequest,
+    PoolSnapshotRequest, RunnerRequest, TenantRequest, WebhookSecretRequest,
+)
+from src.config.settings import (
+    ORCHESTRATOR_URL, ORCHESTRATOR_SHARDS, DEFAULT_HEADERS,
+    GITHUB_WEBHOOK_SECRET, GITHUB_WEBHOOK_SECRET_SECONDARY, WEBHOOK_SECRETS_FILE,
+    SLACK_SIGNING_SECRET, SLACK_USER_ROLES, SLACK_DEFAULT_ROLE, TENANT_WEBHOOK_URL, TENANT_DIRECTORY_TTL
+)
+from src.api.pagination import (
+    BULK_OPERATIONS, CUTOVERS, DOCKER_HOSTS, IMAGE_BUILDS, IMAGE_ROLLOUTS, ORPHANED_JOBS, POOL_SNAPSHOTS, POOLS, REGIONS, RESOURCE_CLASSES,
+    RUNNERS, WEBHOOK_DELIVERIES, paginate,
+)
+from src.middleware.auth import (
+    Principal, require_admin, require_operator, require_tenant_operator, require_tenant_viewer, require_viewer
+)
+from src.middleware.versioning import api_versions
 from src.utils.helpers import format_log
+from src.services.abuse import abuse_detector, client_ip
+from src.services.chaos import webhook_chaos
+from src.services.incidents import signature_storm
+from src.services.metrics import metrics
 from src.services.request_router import RequestRouter
+from src.services.sharding import parse_shards
+from src.services.security_events import security_events
+from src.services.slack import SlackCommandHandler, parse_user_roles, verify_slack_signature
+from src.services.tenants import TenantDirectory
+from src.services.usage import filter_tenants, to_csv
+from src.services.webhook_recorder import webhook_recorder
+from src.services.webhook_replay import replay_guard
+from src.services.webhooks import WebhookHandler, WebhookSecretStore
 from version import __version__
 
 logger = logging.getLogger(__name__)
 
 # Initialize router
 router = APIRouter()
-request_router = RequestRouter(ORCHESTRATOR_URL, 30.0, DEFAULT_HEADERS)
+request_router = RequestRouter(ORCHESTRATOR_URL, 30.0, DEFAULT_HEADERS, parse_shards(ORCHESTRATOR_SHARDS))
+webhook_secrets = WebhookSecretStore(GITHUB_WEBHOOK_SECRET, GITHUB_WEBHOOK_SECRET_SECONDARY, WEBHOOK_SECRETS_FILE)
+webhook_handler = WebhookHandler(request_router)
+tenant_directory = TenantDirectory(request_router, TENANT_DIRECTORY_TTL)
+slack_commands = SlackCommandHandler(request_router, parse_user_roles(SLACK_USER_ROLES), SLACK_DEFAULT_ROLE)
+
+
+def runner_tenant(runner: Dict) -> Optional[str]:
+    """Tenant of a runner, from the container label set by the orchestrator."""
+    return (runner.get("labels") or {}).get("tenant")
+
+
+async def check_runner_access(principal: Principal, runner_id: str):
+    """Scoped principals may only see and act on their tenants' runners."""
+    if not principal.scoped:
+        return
+    status = await request_router.get_runner_status(runner_id)
+    if not principal.can_access(runner_tenant(status)):
+        raise HTTPException(status_code=404, detail=f"Runner {runner_id} no encontrado")
 
 
 @router.post("/runners", response_model=APIResponse)
-async def create_runners(request: RunnerRequest):
+async def create_runners(request: RunnerRequest, principal: Principal = Depends(require_tenant_operator)):
     """Create new ephemeral runners."""
     try:
         # Validate request
         request_router.validate_runner_request(request.dict())
 
+        if principal.scoped and not principal.can_access(await tenant_directory.tenant_for(request.scope_name)):
+            raise HTTPException(status_code=403, detail=f"{request.scope_name} no pertenece a tus tenants")
+
         # Create runners
-        runners = await request_router.create_runners(request.dict())
+        runners = await request_router.create_runner(request.dict())
 
         return APIResponse(data=runners, message=f"Creados {len(runners)} runners exitosamente")
 
@@ -42,10 +95,12 @@ async def create_runners(request: RunnerRequest):
 
 
 @router.get("/runners/{runner_id}", response_model=APIResponse)
-async def get_runner_status(runner_id: str):
+async def get_runner_status(runner_id: str, principal: Principal = Depends(require_tenant_viewer)):
     """Get status of a specific runner."""
     try:
         status = await request_router.get_runner_status(runner_id)
+        if not principal.can_access(runner_tenant(status)):
+            raise HTTPException(status_code=404, detail=f"Runner {runner_id} no encontrado")
 
         return APIResponse(data=status, message="Estado obtenido exitosamente")
 
@@ -57,10 +112,11 @@ async def get_runner_status(runner_id: str):
 
 
 @router.delete("/runners/{runner_id}", response_model=APIResponse)
-async def destroy_runner(runner_id: str):
-    """Destroy a specific runner."""
+async def destroy_runner(runner_id: str, dry_run: bool = False, principal: Principal = Depends(require_tenant_operator)):
+    """Destroy a specific runner (dry_run only reports what would happen)."""
     try:
-        result = await request_router.destroy_runner(runner_id)
+        await check_runner_access(principal, runner_id)
+        result = await request_router.destroy_runner(runner_id, dry_run)
 
         return APIResponse(data=result, message=f"Runner {runner_id} destruido exitosamente")
 
@@ -72,12 +128,19 @@ async def destroy_runner(runner_id: str):
 
 
 @router.get("/runners", response_model=APIResponse)
-async def list_runners():
-    """List all active runners."""
+async def list_runners(request: Request, response: Response, principal: Principal = Depends(require_tenant_viewer)):
+    """
+    List active runners (only the caller's tenants' runners for scoped credentials),
+    paginated, filtered by state, health, pool, repo or label and sorted by created, runner_id,
+    status or pool.
+    """
     try:
         runners = await request_router.list_runners()
+        runners = [runner for runner in runners if principal.can_access(runner_tenant(runner))]
+        page = paginate(runners, request, RUNNERS)
+        page.annotate(request, response)
 
-        return APIResponse(data=runners, message=f"Listados {len(runners)} runners activos")
+        return APIResponse(data=page.items, message=f"Listados {len(page.items)} de {page.total} runners activos")
 
     except HTTPException:
         raise
@@ -86,11 +149,11 @@ async def list_runners():
         raise HTTPException(status_code=500, detail="Error interno del servidor")
 
 
-@router.post("/runners/cleanup", response_model=APIResponse)
-async def cleanup_runners():
-    """Clean up inactive runners."""
+@router.post("/runners/cleanup", response_model=APIResponse, dependencies=[Depends(require_operator)])
+async def cleanup_runners(dry_run: bool = False):
+    """Clean up inactive runners (dry_run only reports what would happen)."""
     try:
-        result = await request_router.cleanup_runners()
+        result = await request_router.cleanup_runners(dry_run)
 
         return APIResponse(data=result, message="Limpieza completada exitosamente")
 
@@ -101,6 +164,305 @@ async def cleanup_runners():
         raise HTTPException(status_code=500, detail="Error interno del servidor")
 
 
+@router.get("/pools", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_pools(request: Request, response: Response):
+    """List configured runner pools, paginated and filtered by state, pool or label."""
+    try:
+        result = await request_router.list_pools()
+        page = paginate(result.get("data", result), request, POOLS)
+        page.annotate(request, response)
+        return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} pools")
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error listando pools: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/pools/snapshots", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_pool_snapshots(request: Request, response: Response, pool: Optional[str] = None):
+    """Saved pool definitions, newest first, paginated."""
+    result = await request_router.list_pool_snapshots(pool)
+    page = paginate(result.get("data", result), request, POOL_SNAPSHOTS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} snapshots de pools")
+
+
+@router.post("/pools/snapshots/{snapshot_id}/restore", response_model=APIResponse)
+async def restore_pool_snapshot(snapshot_id: str, request: PoolRestoreRequest, principal: Principal = Depends(require_admin)):
+    """Create a pool from a snapshot, under its original name or cloned under a new one."""
+    result = await request_router.restore_pool_snapshot(snapshot_id, {**request.dict(), "created_by": principal.name})
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Pool restaurado"))
+
+
+@router.post("/pools/{name}/snapshots", response_model=APIResponse)
+async def create_pool_snapshot(name: str, request: PoolSnapshotRequest, principal: Principal = Depends(require_admin)):
+    """Snapshot a pool definition so it can be restored or cloned later."""
+    data = {**request.dict(), "created_by": principal.name, "id": str(uuid.uuid4())}
+    result = await request_router.create_pool_snapshot(name, data)
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Snapshot guardado"))
+
+
+@router.post("/pools/{name}/retire", response_model=APIResponse)
+async def retire_pool(name: str, request: PoolRetireRequest, principal: Principal = Depends(require_admin)):
+    """
+    Soft-delete a pool: it stops accepting runners while its definition, snapshot and
+    usage history are kept. Runners already in the pool finish their jobs.
+    """
+    data = {**request.dict(), "retired_by": principal.name, "snapshot_id": str(uuid.uuid4())}
+    result = await request_router.retire_pool(name, data)
+    logger.warning(format_log('WARNING', 'Pool retirado', f"{name} por {principal.name}: {request.reason or '-'}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Pool {name} retirado"))
+
+
+@router.post("/pools/{name}/restore", response_model=APIResponse)
+async def restore_pool(name: str, principal: Principal = Depends(require_admin)):
+    """Accept runners again in a retired pool."""
+    result = await request_router.restore_pool(name, principal.name)
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Pool {name} restaurado"))
+
+
+@router.post("/bulk", response_model=APIResponse)
+async def submit_bulk_operation(request: BulkOperationRequest, principal: Principal = Depends(require_admin)):
+    """
+    Submit a bulk operation (drain pools, recycle runners older than a given age, retag
+    pools). It runs in the background: poll GET /bulk/{id} for progress and
+    GET /bulk/{id}/items for the result of each item.
+    """
+    data = {**request.dict(), "submitted_by": principal.name, "id": str(uuid.uuid4())}
+    operation = await request_router.submit_bulk_operation(data)
+    logger.info(format_log('INFO', 'Operación masiva enviada', f"{request.kind} {operation['id']} por {principal.name}"))
+    return APIResponse(data=operation, message=f"Operación {operation['id']} enviada")
+
+
+@router.get("/bulk", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_bulk_operations(request: Request, response: Response, status: Optional[str] = None):
+    """Running and recent bulk operations, newest first, paginated and filtered by state or pool."""
+    operations = await request_router.list_bulk_operations(status)
+    page = paginate(operations, request, BULK_OPERATIONS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} operaciones masivas")
+
+
+@router.get("/bulk/{operation_id}", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_bulk_operation(operation_id: str):
+    """Status and progress of a bulk operation."""
+    operation = await request_router.get_bulk_operation(operation_id)
+    return APIResponse(data=operation, message=f"Operación {operation_id}: {operation['status']}")
+
+
+@router.get("/bulk/{operation_id}/items", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_bulk_operation_items(operation_id: str):
+    """Per-item results of a bulk operation."""
+    operation = await request_router.get_bulk_operation(operation_id, items=True)
+    return APIResponse(data=operation, message=f"Operación {operation_id}: {operation['status']}")
+
+
+@router.post("/images/builds", response_model=APIResponse)
+async def submit_image_build(request: ImageBuildRequest, principal: Principal = Depends(require_admin)):
+    """
+    Build a runner image from its IMAGE_BUILDS_FILE manifest (base image and tools) for
+    every platform, push it and, unless rollout is false, roll the pools to its digest
+    in canary steps. Poll GET /images/builds/{id} for digests and the buildx log.
+    """
+    data = {**request.dict(), "requested_by": principal.name, "id": str(uuid.uuid4())}
+    result = await request_router.submit_image_build(data)
+    logger.info(format_log('INFO', 'Construcción de imagen enviada', f"{request.name} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Construcción enviada"))
+
+
+@router.get("/images/builds", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_image_builds(request: Request, response: Response, name: Optional[str] = None):
+    """Running and recent image builds, newest first, paginated and filtered by state or pool."""
+    builds = await request_router.list_image_builds(name)
+    page = paginate(builds, request, IMAGE_BUILDS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} construcciones de imagen")
+
+
+@router.get("/images/builds/{build_id}", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_image_build(build_id: str):
+    """An image build with its per-platform digests, generated Dockerfile and buildx log tail."""
+    result = await request_router.get_image_build(build_id)
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Construcción {build_id}"))
+
+
+@router.get("/images/rollouts", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_image_rollouts(request: Request, response: Response, pool: Optional[str] = None):
+    """Running and recent image rollouts with their canary counters, newest first."""
+    rollouts = await request_router.list_image_rollouts(pool)
+    page = paginate(rollouts, request, IMAGE_ROLLOUTS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} despliegues de imagen")
+
+
+@router.post("/images/rollouts", response_model=APIResponse)
+async def start_image_rollout(request: ImageRolloutRequest, principal: Principal = Depends(require_admin)):
+    """Roll a pool out to the digest of a finished build, replacing any rollout in progress."""
+    result = await request_router.start_image_rollout({**request.dict(), "started_by": principal.name})
+    logger.info(format_log('INFO', 'Despliegue de imagen iniciado', f"{request.pool}: {request.build} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Despliegue iniciado"))
+
+
+@router.post("/images/rollouts/{pool}/rollback", response_model=APIResponse)
+async def rollback_image_rollout(pool: str, request: ImageRollbackRequest, principal: Principal = Depends(require_admin)):
+    """Stop a pool's image rollout, or unpin a completed one, and go back to the previous image."""
+    result = await request_router.rollback_image_rollout(pool, {**request.dict(), "requested_by": principal.name})
+    logger.warning(format_log('WARNING', 'Despliegue de imagen revertido', f"{pool} por {principal.name}: {request.reason or '-'}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Despliegue en {pool} revertido"))
+
+
+@router.get("/cutovers", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_cutovers(request: Request, response: Response, status: Optional[str] = None):
+    """Running and recent blue/green cutovers with their step and failure rates, newest first."""
+    cutovers = await request_router.list_cutovers(status)
+    page = paginate(cutovers, request, CUTOVERS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} cambios blue/green")
+
+
+@router.post("/cutovers", response_model=APIResponse)
+async def start_cutover(request: FleetCutoverRequest, principal: Principal = Depends(require_admin)):
+    """
+    Start a blue/green cutover: clone each pool into a green pool with the given changes,
+    shift its runners over step by step while comparing failure rates, then retire the
+    blue pools. A green failure rate above the blue one plus the margin rolls it back.
+    """
+    result = await request_router.start_cutover({**request.dict(), "started_by": principal.name})
+    logger.info(format_log('INFO', 'Cambio blue/green iniciado', f"{', '.join(request.pools)} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Cambio blue/green iniciado"))
+
+
+@router.get("/cutovers/{cutover_id}", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_cutover(cutover_id: str):
+    """A blue/green cutover with its pools, step, counters and failure rates."""
+    result = await request_router.get_cutover(cutover_id)
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Cambio {cutover_id}"))
+
+
+@router.post("/cutovers/{cutover_id}/rollback", response_model=APIResponse)
+async def rollback_cutover(cutover_id: str, request: FleetCutoverRollbackRequest, principal: Principal = Depends(require_admin)):
+    """Roll a cutover back: retire the green pools and, if it had completed, restore the blue ones."""
+    result = await request_router.rollback_cutover(cutover_id, {**request.dict(), "requested_by": principal.name})
+    logger.warning(format_log('WARNING', 'Cambio blue/green revertido', f"{cutover_id} por {principal.name}: {request.reason or '-'}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Cambio {cutover_id} revertido"))
+
+
+@router.get("/docker-hosts", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_docker_hosts(request: Request, response: Response):
+    """Docker hosts of the docker backend with capacity, runners, health and drain state."""
+    hosts = await request_router.list_docker_hosts()
+    page = paginate(hosts, request, DOCKER_HOSTS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} hosts Docker")
+
+
+@router.post("/docker-hosts/{name}/drain", response_model=APIResponse)
+async def drain_docker_host(name: str, request: DockerHostDrainRequest, principal: Principal = Depends(require_admin)):
+    """Stop placing runners on a Docker host and destroy its idle runners; busy ones finish their job."""
+    result = await request_router.drain_docker_host(name, {**request.dict(), "requested_by": principal.name})
+    logger.warning(format_log('WARNING', 'Host Docker vaciado', f"{name} por {principal.name}: {request.reason or '-'}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Host Docker {name} vaciado"))
+
+
+@router.post("/docker-hosts/{name}/undrain", response_model=APIResponse)
+async def undrain_docker_host(name: str, principal: Principal = Depends(require_admin)):
+    """Put a drained Docker host back into service."""
+    result = await request_router.undrain_docker_host(name, {"requested_by": principal.name})
+    logger.info(format_log('INFO', 'Host Docker de vuelta al servicio', f"{name} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=result.get("message", f"Host Docker {name} en servicio"))
+
+
+@router.get("/resource-classes", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_resource_classes(request: Request, response: Response):
+    """Resource classes a job can pick with a size-* label, with their size on every backend."""
+    classes = await request_router.list_resource_classes()
+    page = paginate(classes, request, RESOURCE_CLASSES)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} clases de recursos")
+
+
+@router.get("/regions", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_regions(request: Request, response: Response):
+    """Regions of multi-region pools with preference, cooldown after capacity errors and runners created."""
+    regions = await request_router.list_regions()
+    page = paginate(regions, request, REGIONS)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} regiones")
+
+
+@router.get("/pools/drift", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_pool_drift():
+    """GitOps reconciliation status and runners that no longer match the declared pools."""
+    try:
+        result = await request_router.get_pool_drift()
+        return APIResponse(data=result.get("data", result), message=result.get("message", "Drift de pools"))
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error obteniendo drift de pools: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/reconcile", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_reconcile_status():
+    """Drift found by the last runner reconciliation, per resource with its reason and action."""
+    try:
+        result = await request_router.get_reconcile_status()
+        return APIResponse(data=result.get("data", result), message=result.get("message", "Estado de la reconciliación"))
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error obteniendo estado de la reconciliación: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.post("/reconcile", response_model=APIResponse, dependencies=[Depends(require_operator)])
+async def run_reconcile(dry_run: Optional[bool] = None):
+    """Run a runner reconciliation now (dry_run only detects drift)."""
+    try:
+        result = await request_router.reconcile(dry_run)
+        return APIResponse(data=result.get("data", result), message=result.get("message", "Reconciliación completada"))
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error reconciliando runners: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/jobs/orphaned", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_orphaned_jobs(request: Request, response: Response):
+    """
+    Jobs queued past the threshold with no runner, with the likely reason. The jobs list
+    is paginated (next_cursor and total next to it) and filtered by state (reason), repo or label.
+    """
+    try:
+        result = await request_router.get_orphaned_jobs()
+        data = result.get("data", result)
+        if isinstance(data.get("jobs"), list):
+            page = paginate(data["jobs"], request, ORPHANED_JOBS)
+            page.annotate(request, response)
+            data = {**data, "jobs": page.items, "total": page.total, "next_cursor": page.next_cursor}
+        return APIResponse(data=data, message=result.get("message", "Jobs huérfanos"))
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error listando jobs huérfanos: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/versions", response_model=APIResponse)
+async def list_api_versions():
+    """Supported API versions with their deprecation and sunset dates."""
+    return APIResponse(data=api_versions.describe(), message="Versiones de la API")
+
+
+@router.get("/auth/whoami", response_model=APIResponse)
+async def whoami(principal: Principal = Depends(require_tenant_viewer)):
+    """Show the authenticated caller and its role."""
+    return APIResponse(data=principal.to_dict(), message="Identidad autenticada")
+
+
 @router.get("/health", response_model=APIResponse)
 async def full_health_check():
     """Full health check including orchestrator."""
@@ -130,3 +492,455 @@ async def full_health_check():
             },
             message="Gateway con problemas en orchestrator",
         )
+
+
+@router.post("/webhooks/github", response_model=APIResponse)
+async def receive_github_webhook(
+    request: Request,
+    x_github_event: str = Header(...),
+    x_github_delivery: str = Header(""),
+    x_hub_signature_256: Optional[str] = Header(None),
+):
+    """Receive a GitHub webhook delivery validated against all active secrets."""
+    if not webhook_secrets.configured:
+        raise HTTPException(status_code=503, detail="Webhooks no configurados (GITHUB_WEBHOOK_SECRET)")
+
+    ip = client_ip(request)
+    abuse_detector.record(ip, "webhook")
+
+    body = await request.body()
+    matched = webhook_secrets.validate(body, x_hub_signature_256)
+    if not matched:
+        metrics.incr("webhooks.signature_failures")
+        abuse_detector.record(ip, "signature_failure")
+        signature_storm.record("github")
+        logger.warning(format_log('WARNING', 'Firma de webhook inválida', f"delivery={x_github_delivery}"))
+        security_events.emit(
+            "webhook.signature_invalid",
+            client_ip=ip,
+            event=x_github_event,
+            delivery_id=x_github_delivery,
+            signature_present=bool(x_hub_signature_256),
+        )
+        raise HTTPException(status_code=401, detail="Firma de webhook inválida")
+
+    metrics.incr("webhooks.received", tags={"event": x_github_event, "secret": matched})
+
+    try:
+        payload = json.loads(body)
+    except ValueError:
+        raise HTTPException(status_code=400, detail="Payload JSON inválido")
+
+    if matched.startswith("tenant:") and x_github_event != "ping":
+        # A tenant's secret only vouches for deliveries about its own orgs
+        owner = (payload.get("organization") or payload.get("repository", {}).get("owner") or {}).get("login", "")
+        if not owner or await tenant_directory.tenant_for(owner) != matched.split(":", 1)[1]:
+            metrics.incr("webhooks.tenant_mismatch")
+            logger.warning(format_log('WARNING', 'Webhook firmado con el secreto de otro tenant', f"{matched} owner={owner} delivery={x_github_delivery}"))
+            security_events.emit(
+                "webhook.tenant_mismatch",
+                client_ip=ip,
+                secret=matched,
+                owner=owner,
+                delivery_id=x_github_delivery,
+            )
+            raise HTTPException(status_code=401, detail="Firma de webhook inválida")
+
+    if webhook_recorder:
+        # Recorded as received, duplicates included, so a replay reproduces the same traffic
+        webhook_recorder.record(x_github_event, x_github_delivery, payload)
+
+    rejected = replay_guard.check(x_github_event, x_github_delivery, payload)
+    if rejected in ("stale", "future"):
+        raise HTTPException(status_code=400, detail=f"Entrega fuera de la ventana de tiempo ({rejected})")
+    if rejected:
+        # Already handled (or superseded): acknowledge so GitHub does not retry it
+        return APIResponse(data={"action": "ignored", "reason": rejected}, message=f"Evento {x_github_event} ignorado")
+
+    if webhook_chaos and webhook_chaos.drop(x_github_event, x_github_delivery):
+        return APIResponse(data={"action": "ignored", "reason": "chaos"}, message=f"Evento {x_github_event} ignorado")
+
+    result = await webhook_handler.handle(x_github_event, x_github_delivery, payload)
+    replay_guard.processed(x_github_event, x_github_delivery, payload)
+    return APIResponse(data=result, message=f"Evento {x_github_event} procesado")
+
+
+@router.post("/integrations/slack/commands")
+async def receive_slack_command(
+    request: Request,
+    x_slack_request_timestamp: str = Header(""),
+    x_slack_signature: Optional[str] = Header(None),
+):
+    """Slack slash command endpoint; the Slack user's mapped role authorizes each subcommand."""
+    if not SLACK_SIGNING_SECRET:
+        raise HTTPException(status_code=503, detail="Slack no configurado (SLACK_SIGNING_SECRET)")
+
+    ip = client_ip(request)
+    body = await request.body()
+    if not verify_slack_signature(SLACK_SIGNING_SECRET, x_slack_request_timestamp, body, x_slack_signature):
+        abuse_detector.record(ip, "signature_failure")
+        signature_storm.record("slack")
+        logger.warning(format_log('WARNING', 'Firma de Slack inválida', ip))
+        security_events.emit("slack.signature_invalid", client_ip=ip, signature_present=bool(x_slack_signature))
+        raise HTTPException(status_code=401, detail="Firma de Slack inválida")
+
+    # Slack expects a plain JSON body, not the APIResponse envelope
+    return await slack_commands.handle(dict(parse_qsl(body.decode("utf-8"))))
+
+
+@router.get("/webhooks/secrets", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def get_webhook_secrets():
+    """Show fingerprints of the active webhook secrets."""
+    return APIResponse(data=webhook_secrets.describe(), message="Secretos de webhook activos")
+
+
+@router.post("/webhooks/secrets", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def add_webhook_secret(request: WebhookSecretRequest):
+    """Stage a new webhook secret; deliveries signed with either secret are accepted."""
+    try:
+        webhook_secrets.add(request.secret)
+    except ValueError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    return APIResponse(data=webhook_secrets.describe(), message="Secreto agregado")
+
+
+@router.post("/webhooks/secrets/promote", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def promote_webhook_secret():
+    """Promote the secondary secret to primary."""
+    try:
+        webhook_secrets.promote()
+    except ValueError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    return APIResponse(data=webhook_secrets.describe(), message="Secreto promovido")
+
+
+@router.delete("/webhooks/secrets/secondary", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def retire_webhook_secret():
+    """Retire the secondary secret."""
+    try:
+        webhook_secrets.retire()
+    except ValueError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    return APIResponse(data=webhook_secrets.describe(), message="Secreto retirado")
+
+
+@router.get("/tenants", response_model=APIResponse)
+async def list_tenants(principal: Principal = Depends(require_tenant_viewer)):
+    """List onboarded tenants with their usage (only the caller's own for scoped credentials)."""
+    tenants = [tenant for tenant in await request_router.list_tenants() if principal.can_access(tenant["name"])]
+    return APIResponse(data=tenants, message=f"Listados {len(tenants)} tenants")
+
+
+@router.get("/tenants/{name}", response_model=APIResponse)
+async def get_tenant(name: str, principal: Principal = Depends(require_tenant_viewer)):
+    """Show a tenant: orgs, App installations, pools, quota and current usage."""
+    if not principal.can_access(name):
+        raise HTTPException(status_code=404, detail=f"Tenant {name} no encontrado")
+    return APIResponse(data=await request_router.get_tenant(name), message="Tenant obtenido")
+
+
+@router.post("/tenants", response_model=APIResponse)
+async def onboard_tenant(request: TenantRequest, principal: Principal = Depends(require_admin)):
+    """
+    Onboard a tenant: resolve the App installation on each org, create its pools and,
+    with TENANT_WEBHOOK_URL, configure a workflow_job webhook signed with a tenant secret.
+    """
+    data = {**request.dict(), "created_by": principal.name}
+    previous = webhook_secrets.tenants.get(request.name)
+    if TENANT_WEBHOOK_URL:
+        secret = secrets.token_hex(32)
+        data["webhook"] = {"url": TENANT_WEBHOOK_URL, "secret": secret}
+        # Stored first: GitHub sends a ping signed with it as soon as the hook exists
+        webhook_secrets.set_tenant(request.name, secret)
+    try:
+        result = await request_router.onboard_tenant(data)
+    except Exception:
+        # An existing tenant with the same name keeps its secret
+        if previous:
+            webhook_secrets.set_tenant(request.name, previous)
+        elif TENANT_WEBHOOK_URL:
+            webhook_secrets.remove_tenant(request.name)
+        raise
+    tenant_directory.invalidate()
+    logger.info(format_log('INFO', 'Tenant dado de alta', f"{request.name} ({', '.join(request.owners)}) por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=f"Tenant {request.name} dado de alta")
+
+
+@router.delete("/tenants/{name}", response_model=APIResponse)
+async def offboard_tenant(name: str, principal: Principal = Depends(require_admin)):
+    """Offboard a tenant without active runners: removes its webhooks, pools and secret."""
+    result = await request_router.offboard_tenant(name)
+    webhook_secrets.remove_tenant(name)
+    tenant_directory.invalidate()
+    logger.info(format_log('INFO', 'Tenant dado de baja', f"{name} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=f"Tenant {name} dado de baja")
+
+
+async def check_budget_access(principal: Principal, kind: str, name: str):
+    """
+    Budget caps are set by platform admins, or by a tenant's own operators on the
+    tenant and its pools.
+    """
+    if not principal.scoped:
+        if not principal.has_role("admin"):
+            raise HTTPException(status_code=403, detail="Fijar topes de gasto requiere rol admin")
+        return
+    if kind == "tenant":
+        owner = name
+    else:
+        owner = next((
+            tenant["name"] for tenant in await request_router.list_tenants()
+            if name in (pool["name"] for pool in tenant.get("pools", []))
+        ), None)
+    if not principal.can_access(owner):
+        raise HTTPException(status_code=404, detail=f"{kind} {name} no encontrado")
+
+
+@router.get("/forecast", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def get_forecast(pool: Optional[str] = None):
+    """Expected demand per pool and hour of the week, with the last pre-warm decision."""
+    result = await request_router.get_forecast(pool)
+    return APIResponse(data=result, message=f"Previsión de {len(result.get('pools', []))} pools")
+
+
+@router.get("/budgets", response_model=APIResponse)
+async def list_budgets(principal: Principal = Depends(require_tenant_viewer)):
+    """Monthly budget caps with month-to-date spend, projection and freeze state."""
+    budgets = [entry for entry in await request_router.list_budgets() if principal.can_access(entry.get("tenant"))]
+    return APIResponse(data=budgets, message=f"Listados {len(budgets)} topes de gasto")
+
+
+@router.post("/budgets/overrides", response_model=APIResponse)
+async def create_budget_override(request: BudgetOverrideRequest, principal: Principal = Depends(require_admin)):
+    """
+    Issue an emergency override for a frozen tenant or pool. Runner requests carrying the
+    token in budget_override scale anyway; blanket overrides lift the freeze for all
+    scaling of the target. The token is only returned here.
+    """
+    data = {
+        **request.dict(), "created_by": principal.name,
+        # Same token and id on every shard
+        "token": secrets.token_urlsafe(24), "id": str(uuid.uuid4()),
+    }
+    result = await request_router.create_budget_override(data)
+    logger.warning(format_log('WARNING', 'Excepción de tope de gasto', f"{request.kind} {request.name} por {principal.name}: {request.reason}"))
+    return APIResponse(data=result.get("data", result), message="Excepción creada; el token no se volverá a mostrar")
+
+
+@router.delete("/budgets/overrides/{override_id}", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def revoke_budget_override(override_id: str):
+    """Revoke an override before it expires."""
+    result = await request_router.revoke_budget_override(override_id)
+    return APIResponse(data=result.get("data", result), message="Excepción revocada")
+
+
+@router.put("/budgets/{kind}/{name}", response_model=APIResponse)
+async def set_budget(kind: str, name: str, request: BudgetRequest, principal: Principal = Depends(require_tenant_operator)):
+    """Set the monthly budget cap of a tenant or pool (kind: tenant or pool)."""
+    await check_budget_access(principal, kind, name)
+    result = await request_router.set_budget(kind, name, {**request.dict(), "updated_by": principal.name})
+    logger.info(format_log('INFO', 'Tope de gasto fijado', f"{kind} {name}: {request.monthly} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=f"Tope de {kind} {name} fijado")
+
+
+@router.delete("/budgets/{kind}/{name}", response_model=APIResponse)
+async def remove_budget(kind: str, name: str, principal: Principal = Depends(require_tenant_operator)):
+    """Remove the budget cap of a tenant or pool."""
+    await check_budget_access(principal, kind, name)
+    result = await request_router.remove_budget(kind, name)
+    logger.info(format_log('INFO', 'Tope de gasto eliminado', f"{kind} {name} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message=f"Tope de {kind} {name} eliminado")
+
+
+@router.get("/usage/report")
+async def usage_report(
+    month: Optional[str] = None, tenant: Optional[str] = None, format: str = "json",
+    principal: Principal = Depends(require_tenant_viewer),
+):
+    """
+    Monthly usage per tenant and pool (month=YYYY-MM, previous month by default) with
+    runner-minutes, job counts and estimated cost, as JSON or CSV for chargeback.
+    """
+    if format not in ("json", "csv"):
+        raise HTTPException(status_code=400, detail=f"Formato no soportado: {format} (json, csv)")
+    if tenant and not principal.can_access(tenant):
+        raise HTTPException(status_code=404, detail=f"Tenant {tenant} no encontrado")
+    report = await request_router.get_usage_report(month, tenant)
+    if principal.scoped:
+        report = filter_tenants(report, principal.tenants)
+    if format == "csv":
+        return Response(
+            to_csv(report), media_type="text/csv",
+            headers={"Content-Disposition": f'attachment; filename="usage-{report["month"]}.csv"'},
+        )
+    return APIResponse(data=report, message=f"Informe de uso de {report['month']}")
+
+
+@router.get("/usage/anomalies", response_model=APIResponse)
+async def list_cost_anomalies(principal: Principal = Depends(require_tenant_viewer)):
+    """
+    Tenants and pools consuming far above their trailing average, with the repositories
+    and workflows behind it. Tenant credentials only see anomalies of their own tenants.
+    """
+    anomalies = await request_router.list_cost_anomalies()
+    visible = {field: [item for item in items if principal.can_access(item.get("tenant"))] for field, items in anomalies.items()}
+    return APIResponse(data=visible, message=f"{len(visible['active'])} anomalías de gasto abiertas")
+
+
+@router.get("/webhooks/outbound", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def list_outbound_webhooks():
+    """List registered outbound webhooks (secrets are never returned)."""
+    result = await request_router.list_outbound_webhooks()
+    return APIResponse(data=result.get("data", result), message="Webhooks salientes obtenidos")
+
+
+@router.post("/webhooks/outbound", response_model=APIResponse)
+async def register_outbound_webhook(request: OutboundWebhookRequest, principal: Principal = Depends(require_admin)):
+    """Register an outbound webhook; the response carries the signing secret, shown only once."""
+    result = await request_router.register_outbound_webhook(request.dict())
+    data = result.get("data", result)
+    logger.info(format_log('INFO', 'Webhook saliente registrado', f"{data.get('id')} {request.url} por {principal.name}"))
+    return APIResponse(data=data, message="Webhook saliente registrado")
+
+
+@router.delete("/webhooks/outbound/{webhook_id}", response_model=APIResponse)
+async def remove_outbound_webhook(webhook_id: str, principal: Principal = Depends(require_admin)):
+    """Remove an outbound webhook; pending retries are dropped."""
+    result = await request_router.remove_outbound_webhook(webhook_id)
+    logger.info(format_log('INFO', 'Webhook saliente eliminado', f"{webhook_id} por {principal.name}"))
+    return APIResponse(data=result.get("data", result), message="Webhook saliente eliminado")
+
+
+@router.get("/webhooks/outbound/{webhook_id}/deliveries", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def get_outbound_webhook_deliveries(webhook_id: str, request: Request, response: Response):
+    """Recent deliveries of an outbound webhook, newest first, paginated and filtered by state."""
+    result = await request_router.get_outbound_webhook_deliveries(webhook_id)
+    page = paginate(result.get("data", result), request, WEBHOOK_DELIVERIES)
+    page.annotate(request, response)
+    return APIResponse(data=page.items, message=f"{len(page.items)} de {page.total} entregas")
+
+
+@router.post("/webhooks/outbound/{webhook_id}/ping", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def ping_outbound_webhook(webhook_id: str):
+    """Queue a webhook.ping event to test the receiver and its signature check."""
+    result = await request_router.ping_outbound_webhook(webhook_id)
+    return APIResponse(data=result.get("data", result), message="Ping encolado")
+
+
+@router.post("/admin/reload", response_model=APIResponse)
+async def reload_configuration(principal: Principal = Depends(require_admin)):
+    """Reload orchestrator pool definitions without a restart."""
+    try:
+        result = await request_router.reload_configuration()
+        logger.info(format_log('INFO', 'Configuración recargada', f"por {principal.name}"))
+        return APIResponse(data=result.get("data", result), message="Configuración recargada")
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error recargando configuración: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/admin/flags", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_feature_flags(scope_name: Optional[str] = None):
+    """List feature flags; with scope_name, show whether each one is active for that owner or repo."""
+    try:
+        result = await request_router.list_feature_flags(scope_name)
+        return APIResponse(data=result.get("data", result), message="Feature flags obtenidas")
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error obteniendo feature flags: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/admin/policies", response_model=APIResponse, dependencies=[Depends(require_viewer)])
+async def list_policies():
+    """List the job rejection policies and how many jobs each one has matched."""
+    try:
+        result = await request_router.list_policies()
+        return APIResponse(data=result.get("data", result), message=result.get("message", "Políticas de jobs obtenidas"))
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Error obteniendo políticas de jobs: {e}")
+        raise HTTPException(status_code=500, detail="Error interno del servidor")
+
+
+@router.get("/admin/queue", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def get_queue_status():
+    """Distributed work queue status: pending, in-flight and dead provisioning tasks."""
+    result = await request_router.get_queue_status()
+    return APIResponse(data=result.get("data", result), message=result.get("message", "Estado de la cola"))
+
+
+@router.get("/admin/doctor", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def run_diagnostics():
+    """Diagnose the deployment: orchestrator checks plus gateway-side webhook configuration."""
+    checks: List[Dict[str, str]] = []
+    try:
+        result = await request_router.run_diagnostics()
+        checks.append({"check": "orchestrator.reachable", "status": "pass", "detail": ORCHESTRATOR_URL})
+        checks.extend(result.get("data", {}).get("checks", []))
+    except HTTPException as e:
+        checks.append({"check": "orchestrator.reachable", "status": "fail", "detail": str(e.detail)})
+
+    if webhook_secrets.configured:
+        checks.append({"check": "webhook.secret", "status": "pass", "detail": "Secreto de webhook configurado"})
+    else:
+        checks.append({
+            "check": "webhook.secret",
+            "status": "warn",
+            "detail": "GITHUB_WEBHOOK_SECRET no configurado; /webhooks/github responde 503",
+        })
+
+    ok = all(check["status"] != "fail" for check in checks)
+    return APIResponse(
+        data={"ok": ok, "checks": checks},
+        message="Diagnóstico sin fallos" if ok else "Diagnóstico con fallos",
+    )
+
+
+@router.get("/admin/state/export", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def export_state():
+    """Export a versioned snapshot of orchestrator and gateway state (no secrets)."""
+    result = await request_router.export_state()
+    snapshot = {
+        **result.get("data", result),
+        "gateway": {"version": __version__, "bans": abuse_detector.list_bans()},
+    }
+    return APIResponse(data=snapshot, message="Estado exportado")
+
+
+@router.post("/admin/state/import", response_model=APIResponse)
+async def import_state(
+    snapshot: Dict,
+    dry_run: bool = False,
+    apply_pools: bool = False,
+    principal: Principal = Depends(require_admin),
+):
+    """Import a snapshot: adopt existing runners, restore bans and optionally replace pools."""
+    gateway_state = snapshot.pop("gateway", None) or {}
+    result = await request_router.import_state(snapshot, dry_run=dry_run, apply_pools=apply_pools)
+    data = result.get("data", result)
+
+    bans = gateway_state.get("bans", [])
+    data["bans_restored"] = 0 if dry_run else abuse_detector.restore(bans)
+    logger.info(format_log('INFO', 'Estado importado', f"por {principal.name}{' (simulación)' if dry_run else ''}"))
+    return APIResponse(data=data, message="Estado importado")
+
+
+@router.get("/admin/bans", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def list_bans():
+    """List clients temporarily banned by abuse detection."""
+    bans = abuse_detector.list_bans()
+    return APIResponse(data=bans, message=f"{len(bans)} clientes bloqueados")
+
+
+@router.delete("/admin/bans/{ip}", response_model=APIResponse, dependencies=[Depends(require_admin)])
+async def lift_ban(ip: str, principal: Principal = Depends(require_admin)):
+    """Lift a temporary ban."""
+    if not abuse_detector.lift(ip):
+        raise HTTPException(status_code=404, detail=f"No hay bloqueo activo para {ip}")
+    logger.info(format_log('INFO', 'Bloqueo levantado', f"{ip} por {principal.name}"))
+    return APIResponse(data={"ip": ip}, message="Bloqueo levantado")
@@ -16,7 +16,11 @@ class RunnerRequest(BaseModel):
     runner_name: Optional[str] = Field(None, description="Nombre único del runner")
     runner_group: Optional[str] = Field(None, description="Grupo del runner")
     labels: Optional[List[str]] = Field(None, description="Labels para el runner")
+    pool: Optional[str] = Field(None, description="Pool del runner (default si se omite)")
     count: int = Field(1, ge=1, le=10, description="Número de runners a crear")
+    dry_run: bool = Field(False, description="Simular: registrar qué se crearía sin crear runners")
+    budget_override: Optional[str] = Field(None, description="Token de excepción para escalar con el tope de gasto congelado")
+    resource_class: Optional[str] = Field(None, description="Clase de recursos (small, medium, large, xl...); sin ella se usa el label size-* o la del pool")
 
 
 class RunnerResponse(BaseModel):
@@ -36,6 +40,107 @@ class RunnerStatus(BaseModel):
     labels: Optional[Dict] = None
 
 
+class WebhookSecretRequest(BaseModel):
+    """Model for staging a new webhook secret."""
+    secret: str = Field(..., min_length=16, description="Nuevo secreto de webhook")
+
+
+class OutboundWebhookRequest(BaseModel):
+    """Model for registering an outbound webhook."""
+    url: str = Field(..., description="URL http(s) que recibe los eventos")
+    events: List[str] = Field(..., min_length=1, description="Tipos de evento o comodines (runner.*, job.completed, *)")
+    description: str = ""
+    secret: Optional[str] = Field(None, min_length=16, description="Secreto de firma; se genera si se omite")
+
+
+class TenantRequest(BaseModel):
+    """Model for onboarding a tenant (a GitHub org, or several orgs of an enterprise)."""
+    name: str = Field(..., description="Slug del tenant: minúsculas, dígitos y guiones")
+    owners: List[str] = Field(..., min_length=1, description="Organizaciones de GitHub del tenant")
+    kind: str = Field("org", description="org o enterprise")
+    enterprise: Optional[str] = Field(None, description="Slug de la enterprise (kind=enterprise)")
+    pools: Optional[List[Dict[str, Any]]] = Field(None, description="Pools del tenant; se prefijan con <tenant>-")
+    max_runners: Optional[int] = Field(None, ge=0, description="Runners simultáneos como máximo (0 = sin límite)")
+
+
+class BudgetRequest(BaseModel):
+    """Model for setting a monthly budget cap on a tenant or pool."""
+    monthly: float = Field(..., gt=0, description="Tope de gasto mensual en USAGE_CURRENCY")
+
+
+class BudgetOverrideRequest(BaseModel):
+    """Model for issuing an emergency budget override token."""
+    kind: str = Field(..., description="tenant o pool")
+    name: str = Field(..., description="Tenant o pool congelado")
+    hours: float = Field(4, gt=0, le=72, description="Validez del token en horas")
+    reason: str = Field(..., min_length=1, description="Motivo de la excepción (queda en el registro)")
+    blanket: bool = Field(False, description="Válida para todo el escalado del objetivo, autoscaler incluido")
+
+
+class PoolRetireRequest(BaseModel):
+    """Model for retiring (soft-deleting) a pool."""
+    reason: str = Field("", description="Motivo de la retirada (queda en el archivo)")
+
+
+class PoolSnapshotRequest(BaseModel):
+    """Model for snapshotting a pool definition."""
+    note: str = Field("", description="Nota del snapshot")
+
+
+class PoolRestoreRequest(BaseModel):
+    """Model for restoring or cloning a pool from a snapshot."""
+    name: Optional[str] = Field(None, description="Nombre del pool nuevo (clon); por defecto el original")
+
+
+class BulkOperationRequest(BaseModel):
+    """Model for submitting a bulk admin operation."""
+    kind: str = Field(..., description="drain_pools, recycle_runners o retag_pools")
+    pools: List[str] = Field(default_factory=list, description="Pools afectados (en recycle_runners, opcional)")
+    older_than: Optional[int] = Field(None, gt=0, description="recycle_runners: edad mínima de los runners en segundos")
+    retire: bool = Field(False, description="drain_pools: retirar además los pools")
+    reason: str = Field("", description="drain_pools: motivo de la retirada")
+    add_labels: List[str] = Field(default_factory=list, description="retag_pools: labels a agregar")
+    remove_labels: List[str] = Field(default_factory=list, description="retag_pools: labels a quitar")
+    dry_run: bool = Field(False, description="Solo simular")
+
+
+class ImageBuildRequest(BaseModel):
+    """Model for building a runner image defined in IMAGE_BUILDS_FILE."""
+    name: str = Field(..., description="Construcción de IMAGE_BUILDS_FILE")
+    rollout: bool = Field(True, description="Desplegar la imagen en los pools al terminar")
+    pools: Optional[List[str]] = Field(None, description="Pools a desplegar en lugar de los de la construcción")
+
+
+class ImageRolloutRequest(BaseModel):
+    """Model for rolling a built image out to a pool."""
+    pool: str = Field(..., description="Pool de destino")
+    build: str = Field(..., description="Id de una construcción terminada")
+
+
+class ImageRollbackRequest(BaseModel):
+    """Model for rolling a pool back to its previous image."""
+    reason: str = Field("", description="Motivo de la reversión")
+
+
+class FleetCutoverRequest(BaseModel):
+    """Model for starting a blue/green cutover of a set of pools."""
+    pools: List[str] = Field(..., min_length=1, description="Pools actuales (azules)")
+    changes: Dict[str, Any] = Field(..., description="Opciones de los pools verdes (image, resource_class, security...)")
+    suffix: str = Field("green", description="Sufijo del nombre de los pools verdes")
+    policy: Optional[Dict[str, Any]] = Field(None, description="steps, step_interval, min_runners y max_failure_margin")
+
+
+class FleetCutoverRollbackRequest(BaseModel):
+    """Model for rolling back a blue/green cutover."""
+    reason: str = Field("", description="Motivo de la reversión")
+
+
+class DockerHostDrainRequest(BaseModel):
+    """Model for draining a Docker host for maintenance."""
+    reason: str = Field("", description="Motivo del vaciado")
+    evict_idle: bool = Field(True, description="Destruir ya los runners libres del host")
+
+
 class APIResponse(BaseModel):
     """Standard API response model."""
     status: str = "success"
@@ -0,0 +1,334 @@
+"""
+API Gateway - List Pagination
+Cursor pagination, field filters and sort orders shared by every list endpoint. The
+gateway pages the merged list (all shards), so clients never receive the whole fleet
+in one response; the page size is capped at LIST_MAX_LIMIT.
+"""
+
+import base64
+import binascii
+import json
+from dataclasses import dataclass, field
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from fastapi import HTTPException, Request, Response
+
+from src.config.settings import LIST_DEFAULT_LIMIT, LIST_MAX_LIMIT
+
+# Filtros de campo comunes; cada listado declara cuáles admite
+FILTERS = ("state", "health", "pool", "repo", "label")
+
+
+@dataclass
+class ListSpec:
+    """How the items of one list endpoint are identified, filtered and sorted."""
+    name: str
+    key: Callable[[Dict[str, Any]], str]
+    sorts: Dict[str, Callable[[Dict[str, Any]], Any]]
+    default_sort: str
+    filters: Dict[str, Callable[[Dict[str, Any]], Any]] = field(default_factory=dict)
+
+
+@dataclass
+class Page:
+    items: List[Dict[str, Any]]
+    total: int
+    next_cursor: Optional[str]
+
+    def annotate(self, request: Request, response: Response):
+        """X-Total-Count, X-Next-Cursor and a rel="next" Link, for clients that keep v1 arrays."""
+        response.headers["X-Total-Count"] = str(self.total)
+        if not self.next_cursor:
+            return
+        response.headers["X-Next-Cursor"] = self.next_cursor
+        url = request.url.include_query_params(cursor=self.next_cursor)
+        response.headers["Link"] = f'<{url.path}?{url.query}>; rel="next"'
+
+
+def _labels(value: Any) -> List[str]:
+    """Labels to match: list items as they are, dict labels as key and key=value."""
+    if isinstance(value, dict):
+        return [str(key) for key in value] + [f"{key}={item}" for key, item in value.items()]
+    return [str(item) for item in value or []]
+
+
+def _values(value: Any) -> List[str]:
+    return [str(item) for item in value] if isinstance(value, (list, tuple)) else [str(value)]
+
+
+def _sort_key(spec: ListSpec, field_name: str, item: Dict[str, Any]) -> Tuple[bool, Any, str]:
+    value = spec.sorts[field_name](item)
+    # Los valores ausentes van al final; el id desempata para que el cursor sea estable
+    return (value is None, value if isinstance(value, (int, float)) else str(value or ""), spec.key(item))
+
+
+def _encode_cursor(sort: str, key: Tuple[bool, Any, str]) -> str:
+    raw = json.dumps({"sort": sort, "after": list(key)}, separators=(",", ":")).encode()
+    return base64.urlsafe_b64encode(raw).decode().rstrip("=")
+
+
+def _decode_cursor(cursor: str, sort: str) -> Tuple[bool, Any, str]:
+    try:
+        decoded = json.loads(base64.urlsafe_b64decode(cursor + "=" * (-len(cursor) % 4)))
+        after = decoded["after"]
+        key = (bool(after[0]), after[1], str(after[2]))
+    except (binascii.Error, ValueError, KeyError, IndexError, TypeError):
+        raise HTTPException(status_code=400, detail="Cursor inválido")
+    if decoded.get("sort") != sort:
+        raise HTTPException(status_code=400, detail=f"El cursor corresponde al orden {decoded.get('sort')}, no a {sort}")
+    return key
+
+
+def _limit(value: Optional[str]) -> int:
+    if value is None:
+        return LIST_DEFAULT_LIMIT
+    try:
+        limit = int(value)
+    except ValueError:
+        raise HTTPException(status_code=400, detail=f"limit inválido: {value}")
+    if limit < 1:
+        raise HTTPException(status_code=400, detail="limit debe ser mayor que 0")
+    return min(limit, LIST_MAX_LIMIT)
+
+
+def paginate(items: List[Dict[str, Any]], request: Request, spec: ListSpec) -> Page:
+    """
+    Filter, sort and page items with the request's query parameters.
+
+    - state, health, pool, repo: comma-separated values, any of them matches (for list fields, any item)
+    - label: repeatable or comma-separated, every label must match (key or key=value on runners)
+    - sort: a field of the list, descending with a leading '-'
+    - limit / cursor: page size (capped at LIST_MAX_LIMIT) and the next_cursor of the previous page
+    """
+    params = request.query_params
+    for name in FILTERS:
+        values = [value for raw in params.getlist(name) for value in raw.split(",") if value]
+        if not values:
+            continue
+        if name not in spec.filters:
+            raise HTTPException(
+                status_code=400,
+                detail=f"Filtro no soportado en {spec.name}: {name} ({', '.join(spec.filters) or 'ninguno'})",
+            )
+        extract = spec.filters[name]
+        if name == "label":
+            items = [item for item in items if set(values) <= set(_labels(extract(item)))]
+        else:
+            items = [item for item in items if set(_values(extract(item))) & set(values)]
+
+    sort = params.get("sort") or spec.default_sort
+    field_name = sort[1:] if sort.startswith("-") else sort
+    if field_name not in spec.sorts:
+        raise HTTPException(
+            status_code=400, detail=f"Orden no soportado en {spec.name}: {sort} ({', '.join(spec.sorts)})",
+        )
+    descending = sort.startswith("-")
+    try:
+        ordered = sorted(items, key=lambda item: _sort_key(spec, field_name, item), reverse=descending)
+    except TypeError:
+        # Campo con tipos mezclados (números y texto): se ordena como texto
+        ordered = sorted(items, key=lambda item: tuple(map(str, _sort_key(spec, field_name, item))), reverse=descending)
+
+    cursor = params.get("cursor")
+    if cursor:
+        after = _decode_cursor(cursor, sort)
+        try:
+            ordered = [
+                item for item in ordered
+                if (_sort_key(spec, field_name, item) < after if descending else _sort_key(spec, field_name, item) > after)
+            ]
+        except TypeError:
+            raise HTTPException(status_code=400, detail="Cursor inválido")
+
+    limit = _limit(params.get("limit"))
+    page = ordered[:limit]
+    next_cursor = _encode_cursor(sort, _sort_key(spec, field_name, page[-1])) if len(ordered) > limit else None
+    return Page(items=page, total=len(items), next_cursor=next_cursor)
+
+
+def _runner_label(runner: Dict[str, Any], name: str, default: Any = None) -> Any:
+    return (runner.get("labels") or {}).get(name, default)
+
+
+RUNNERS = ListSpec(
+    name="runners",
+    key=lambda runner: runner.get("runner_id", ""),
+    sorts={
+        "created": lambda runner: runner.get("created"),
+        "runner_id": lambda runner: runner.get("runner_id"),
+        "status": lambda runner: runner.get("status"),
+        "pool": lambda runner: _runner_label(runner, "runner-pool", "default"),
+    },
+    default_sort="created",
+    filters={
+        "state": lambda runner: runner.get("status"),
+        "health": lambda runner: runner.get("health"),
+        "pool": lambda runner: _runner_label(runner, "runner-pool", "default"),
+        "repo": lambda runner: _runner_label(runner, "repo"),
+        "label": lambda runner: runner.get("labels"),
+    },
+)
+
+POOLS = ListSpec(
+    name="pools",
+    key=lambda pool: pool.get("name", ""),
+    sorts={
+        "name": lambda pool: pool.get("name"),
+        "backend": lambda pool: pool.get("backend"),
+    },
+    default_sort="name",
+    filters={
+        "state": lambda pool: "retired" if pool.get("retired") else "active",
+        "pool": lambda pool: pool.get("name"),
+        "label": lambda pool: pool.get("labels"),
+    },
+)
+
+POOL_SNAPSHOTS = ListSpec(
+    name="snapshots de pools",
+    key=lambda snapshot: snapshot.get("id", ""),
+    sorts={
+        "created_at": lambda snapshot: snapshot.get("created_at"),
+        "pool": lambda snapshot: snapshot.get("pool"),
+    },
+    default_sort="-created_at",
+    filters={"pool": lambda snapshot: snapshot.get("pool")},
+)
+
+BULK_OPERATIONS = ListSpec(
+    name="operaciones masivas",
+    key=lambda operation: operation.get("id", ""),
+    sorts={
+        "submitted_at": lambda operation: operation.get("submitted_at"),
+        "kind": lambda operation: operation.get("kind"),
+        "status": lambda operation: operation.get("status"),
+    },
+    default_sort="-submitted_at",
+    filters={
+        "state": lambda operation: operation.get("status"),
+        "pool": lambda operation: (operation.get("params") or {}).get("pools") or [],
+    },
+)
+
+ORPHANED_JOBS = ListSpec(
+    name="jobs huérfanos",
+    key=lambda job: str(job.get("job_id", "")),
+    sorts={
+        "queued_at": lambda job: job.get("queued_at"),
+        "waiting_seconds": lambda job: job.get("waiting_seconds"),
+        "repo": lambda job: job.get("repo"),
+    },
+    default_sort="queued_at",
+    filters={
+        "state": lambda job: job.get("reason"),
+        "repo": lambda job: job.get("repo"),
+        "label": lambda job: job.get("labels"),
+    },
+)
+
+WEBHOOK_DELIVERIES = ListSpec(
+    name="entregas",
+    key=lambda delivery: delivery.get("id", ""),
+    sorts={
+        "created_at": lambda delivery: delivery.get("created_at"),
+        "event_type": lambda delivery: delivery.get("event_type"),
+        "status": lambda delivery: delivery.get("status"),
+    },
+    default_sort="-created_at",
+    filters={"state": lambda delivery: delivery.get("status")},
+)
+
+IMAGE_BUILDS = ListSpec(
+    name="construcciones de imagen",
+    key=lambda build: build.get("id", ""),
+    sorts={
+        "requested_at": lambda build: build.get("requested_at"),
+        "name": lambda build: build.get("name"),
+        "status": lambda build: build.get("status"),
+    },
+    default_sort="-requested_at",
+    filters={
+        "state": lambda build: build.get("status"),
+        "pool": lambda build: build.get("pools") or [],
+    },
+)
+
+IMAGE_ROLLOUTS = ListSpec(
+    name="despliegues de imagen",
+    key=lambda rollout: rollout.get("id", ""),
+    sorts={
+        "started_at": lambda rollout: rollout.get("started_at"),
+        "pool": lambda rollout: rollout.get("pool"),
+        "status": lambda rollout: rollout.get("status"),
+    },
+    default_sort="-started_at",
+    filters={
+        "state": lambda rollout: rollout.get("status"),
+        "pool": lambda rollout: rollout.get("pool"),
+    },
+)
+
+CUTOVERS = ListSpec(
+    name="cambios blue/green",
+    key=lambda cutover: cutover.get("id", ""),
+    sorts={
+        "started_at": lambda cutover: cutover.get("started_at"),
+        "status": lambda cutover: cutover.get("status"),
+    },
+    default_sort="-started_at",
+    filters={
+        "state": lambda cutover: cutover.get("status"),
+        "pool": lambda cutover: [name for pair in cutover.get("pools") or [] for name in (pair.get("blue"), pair.get("green"))],
+    },
+)
+
+
+def docker_host_state(host: Dict[str, Any]) -> str:
+    """drained, unhealthy, pressure o ready (en ese orden de prioridad)."""
+    if host.get("drained"):
+        return "drained"
+    if not host.get("healthy"):
+        return "unhealthy"
+    return "pressure" if host.get("disk_pressure") else "ready"
+
+
+DOCKER_HOSTS = ListSpec(
+    name="hosts Docker",
+    key=lambda host: host.get("name", ""),
+    sorts={
+        "name": lambda host: host.get("name"),
+        "running": lambda host: host.get("running"),
+        "free": lambda host: (host.get("slots") or 0) - (host.get("running") or 0),
+    },
+    default_sort="name",
+    filters={
+        "state": docker_host_state,
+        "label": lambda host: host.get("labels") or [],
+    },
+)
+
+RESOURCE_CLASSES = ListSpec(
+    name="clases de recursos",
+    key=lambda resource_class: resource_class.get("name", ""),
+    sorts={
+        "name": lambda resource_class: resource_class.get("name"),
+        "cpus": lambda resource_class: resource_class.get("cpus"),
+        "cost_factor": lambda resource_class: resource_class.get("cost_factor"),
+    },
+    default_sort="cpus",
+)
+
+REGIONS = ListSpec(
+    name="regiones",
+    key=lambda region: f"{region.get('pool', '')}/{region.get('region', '')}",
+    sorts={
+        "pool": lambda region: (region.get("pool"), region.get("preference")),
+        "provisioned": lambda region: region.get("provisioned"),
+        "failures": lambda region: region.get("failures"),
+    },
+    default_sort="pool",
+    filters={
+        "state": lambda region: "available" if region.get("available") else "cooldown",
+        "pool": lambda region: region.get("pool"),
+    },
+)
@@ -0,0 +1,313 @@
+"""
+API Gateway - Unified Configuration File
+Loads CONFIG_FILE, validates types and values, and exports every option to its
+environment variable so settings.py reads it as before. Environment variables
+already set take precedence over the file.
+
+This module runs before logging is configured and must not import src.utils.helpers.
+"""
+
+import difflib
+import os
+from typing import Any, Dict, List, Optional, Sequence
+
+import yaml
+
+LOG_LEVELS = ("DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL")
+VERIFICATION_MODES = ("off", "warn", "enforce")
+INCIDENT_BACKENDS = ("pagerduty", "opsgenie")
+DISCOVERY_BACKENDS = ("consul", "etcd")
+ROLES = ("viewer", "operator", "admin")
+
+
+class ConfigFileError(ValueError):
+    """Invalid configuration; the message lists every problem found."""
+
+    def __init__(self, errors: List[str]):
+        self.errors = errors
+        super().__init__("Configuración inválida:\n" + "\n".join(f"  - {error}" for error in errors))
+
+
+class Option:
+    """Typed option exported to an environment variable."""
+
+    def __init__(
+        self,
+        kind: str = "str",
+        choices: Optional[Sequence[str]] = None,
+        minimum: Optional[int] = None,
+        separator: str = ",",
+        env: Optional[str] = None,
+    ):
+        self.kind = kind
+        self.choices = choices
+        self.minimum = minimum
+        self.separator = separator
+        self.env = env
+
+    def normalize(self, value: Any) -> str:
+        """Convert the value to its canonical text form or raise ValueError with the reason."""
+        if self.kind == "bool":
+            text = str(value).strip().lower()
+            if text in ("true", "1", "yes", "on"):
+                return "true"
+            if text in ("false", "0", "no", "off"):
+                return "false"
+            raise ValueError(f"se esperaba true/false, se recibió '{value}'")
+
+        if self.kind == "int":
+            if isinstance(value, bool):
+                raise ValueError(f"se esperaba un entero, se recibió '{value}'")
+            try:
+                number = int(str(value).strip())
+            except ValueError:
+                raise ValueError(f"se esperaba un entero, se recibió '{value}'")
+            if self.minimum is not None and number < self.minimum:
+                raise ValueError(f"debe ser >= {self.minimum}, se recibió {number}")
+            return str(number)
+
+        if self.kind == "list":
+            if isinstance(value, (list, tuple)):
+                return self.separator.join(str(item).strip() for item in value)
+            if isinstance(value, dict):
+                raise ValueError("se esperaba una lista o texto separado por comas")
+            return str(value)
+
+        if isinstance(value, (list, dict)):
+            raise ValueError(f"se esperaba un valor simple, se recibió {type(value).__name__}")
+
+        text = str(value).strip()
+        if self.choices:
+            for choice in self.choices:
+                if text.lower() == choice.lower():
+                    return choice
+            raise ValueError(f"debe ser uno de: {', '.join(self.choices)}; se recibió '{value}'")
+        return text
+
+
+# Options shared by orchestrator and api-gateway ('shared' section)
+SHARED_OPTIONS: Dict[str, Option] = {
+    "log_level": Option(choices=LOG_LEVELS),
+    "log_verbose": Option("bool"),
+    "log_redact_patterns": Option("list", separator=";"),
+    "orchestrator_port": Option("int", minimum=1),
+    "api_gateway_port": Option("int", minimum=1),
+    "statsd_enabled": Option("bool"),
+    "statsd_host": Option(),
+    "statsd_port": Option("int", minimum=1),
+    "statsd_prefix": Option(),
+    "statsd_tags": Option("list"),
+    "statsd_dogstatsd": Option("bool"),
+    "datadog_enabled": Option("bool"),
+    "datadog_agent_host": Option(),
+    "datadog_dogstatsd_port": Option("int", minimum=1),
+    "datadog_trace_port": Option("int", minimum=1),
+    "datadog_env": Option(),
+    "datadog_tags": Option("list"),
+    "datadog_tracing": Option("bool"),
+    "security_events_webhook_url": Option(),
+    "security_events_webhook_token": Option(),
+    "events_backend": Option("list"),
+    "events_nats_url": Option(),
+    "events_nats_subject_prefix": Option(),
+    "events_kafka_rest_url": Option(),
+    "events_kafka_topic": Option(),
+    "incidents_backend": Option(choices=INCIDENT_BACKENDS),
+    "opsgenie_api_url": Option(),
+    "service_discovery_backend": Option(choices=DISCOVERY_BACKENDS),
+    "service_discovery_tags": Option("list"),
+    "service_discovery_ttl": Option("int", minimum=5),
+    "service_discovery_prefix": Option(),
+    "consul_http_addr": Option(),
+    "consul_deregister_after": Option(),
+    "etcd_endpoint": Option(),
+}
+
+# Gateway options ('gateway' section)
+SERVICE_OPTIONS: Dict[str, Option] = {
+    "cors_origins": Option("list"),
+    "orchestrator_max_connections": Option("int", minimum=1),
+    "orchestrator_max_idle_connections": Option("int", minimum=0),
+    "orchestrator_idle_timeout": Option("int", minimum=0),
+    "orchestrator_connect_timeout": Option("int", minimum=1),
+    "orchestrator_shards": Option("list"),
+    "gateway_reuse_port": Option("bool"),
+    "gateway_handover_enabled": Option("bool"),
+    "api_keys_file": Option(),
+    "oidc_issuer": Option(),
+    "oidc_audience": Option(),
+    "oidc_jwks_url": Option(),
+    "oidc_role_claim": Option(),
+    "oidc_role_mapping": Option("list"),
+    "webhook_secrets_file": Option(),
+    "abuse_detection_enabled": Option("bool"),
+    "abuse_window_seconds": Option("int", minimum=1),
+    "abuse_ban_seconds": Option("int", minimum=1),
+    "abuse_max_signature_failures": Option("int", minimum=1),
+    "abuse_max_auth_failures": Option("int", minimum=1),
+    "abuse_max_webhooks": Option("int", minimum=1),
+    "abuse_trust_forwarded": Option("bool"),
+    "abuse_allowlist": Option("list"),
+    "admin_ui_enabled": Option("bool"),
+    "slack_user_roles": Option("list"),
+    "slack_default_role": Option(choices=ROLES),
+    "incident_signature_storm_threshold": Option("int", minimum=1),
+}
+
+# Secrets are never accepted in the file, only in environment variables
+SECRET_KEYS = ("admin_api_key", "api_keys", "github_webhook_secret", "github_webhook_secret_secondary")
+
+SECTION = "gateway"
+SECTIONS = ("shared", "orchestrator", "gateway")
+PROFILES_KEY = "profiles"
+
+def _env_name(key: str, option: Option) -> str:
+    return option.env or key.upper()
+
+
+def _unknown_key_error(section: str, key: str, known: Sequence[str]) -> str:
+    if key in SECRET_KEYS:
+        return f"{section}.{key}: es un secreto y no se admite en el archivo; usar la variable {key.upper()}"
+    suggestion = difflib.get_close_matches(key, known, n=1)
+    hint = f"; ¿quisiste decir '{suggestion[0]}'?" if suggestion else ""
+    return f"{section}.{key}: clave desconocida{hint}"
+
+
+def _read_file(path: str) -> Dict[str, Any]:
+    try:
+        with open(path, "r") as config_file:
+            data = yaml.safe_load(config_file) or {}
+    except OSError as e:
+        raise ConfigFileError([f"No se pudo leer CONFIG_FILE {path}: {e}"])
+    except yaml.YAMLError as e:
+        raise ConfigFileError([f"YAML inválido en {path}: {e}"])
+
+    if not isinstance(data, dict):
+        raise ConfigFileError([f"{path}: se esperaba un mapa con las secciones {', '.join(SECTIONS)}"])
+    return data
+
+
+def _merge(base: Dict[str, Any], override: Dict[str, Any]) -> Dict[str, Any]:
+    """Merge override into base: mappings merge recursively, anything else replaces."""
+    merged = dict(base)
+    for key, value in override.items():
+        if isinstance(value, dict) and isinstance(merged.get(key), dict):
+            merged[key] = _merge(merged[key], value)
+        else:
+            merged[key] = value
+    return merged
+
+
+def _apply_profile(data: Dict[str, Any], profile: str) -> Dict[str, Any]:
+    """
+    Apply the selected profile (and the ones it inherits via 'extends') on top of the base sections.
+
+    Raises:
+        ConfigFileError: If the profile does not exist, inheritance is circular or it has invalid keys
+    """
+    profiles = data.get(PROFILES_KEY) or {}
+    if not isinstance(profiles, dict):
+        raise ConfigFileError([f"{PROFILES_KEY}: se esperaba un mapa nombre: perfil"])
+
+    chain: List[str] = []
+    name: Optional[str] = profile
+    while name:
+        if name in chain:
+            raise ConfigFileError([f"{PROFILES_KEY}: herencia circular: {' -> '.join(chain + [name])}"])
+        if name not in profiles:
+            suggestion = difflib.get_close_matches(name, list(profiles), n=1)
+            hint = f"; ¿quisiste decir '{suggestion[0]}'?" if suggestion else ""
+            raise ConfigFileError([f"Perfil desconocido '{name}'{hint}"])
+        spec = profiles[name] or {}
+        if not isinstance(spec, dict):
+            raise ConfigFileError([f"{PROFILES_KEY}.{name}: se esperaba un mapa con las secciones {', '.join(SECTIONS)}"])
+        errors = [
+            _unknown_key_error(f"{PROFILES_KEY}.{name}", str(key), SECTIONS + ("extends",))
+            for key in spec if key not in SECTIONS + ("extends",)
+        ]
+        if errors:
+            raise ConfigFileError(errors)
+        chain.append(name)
+        name = spec.get("extends")
+
+    merged = {section: data[section] for section in SECTIONS if section in data}
+    for name in reversed(chain):
+        overrides = {section: profiles[name][section] for section in SECTIONS if (profiles[name] or {}).get(section)}
+        merged = _merge(merged, overrides)
+    return merged
+
+
+def profile_from_args(argv: Sequence[str]) -> Optional[str]:
+    """Extract --profile NAME or --profile=NAME from the command line arguments."""
+    for index, arg in enumerate(argv):
+        if arg == "--profile" and index + 1 < len(argv):
+            return argv[index + 1]
+        if arg.startswith("--profile="):
+            return arg.split("=", 1)[1]
+    return None
+
+
+def load_config_file(path: Optional[str] = None, profile: Optional[str] = None) -> Dict[str, str]:
+    """
+    Load and validate the gateway configuration.
+
+    Reads CONFIG_FILE (if set), applies the CONFIG_PROFILE profile over the base
+    sections, merges 'shared' and 'gateway', applies environment variables as
+    overrides and exports the result to os.environ.
+    Environment variables are validated the same way as the file.
+
+    Returns:
+        Effective options as {VARIABLE: value}
+
+    Raises:
+        ConfigFileError: With every problem found
+    """
+    path = path or os.getenv("CONFIG_FILE")
+    profile = profile or os.getenv("CONFIG_PROFILE")
+    data = _read_file(path) if path else {}
+    errors: List[str] = []
+
+    for section in data:
+        if section not in SECTIONS + (PROFILES_KEY,):
+            errors.append(_unknown_key_error("config", str(section), SECTIONS + (PROFILES_KEY,)))
+
+    if profile:
+        if not path:
+            raise ConfigFileError([f"CONFIG_PROFILE={profile} requiere CONFIG_FILE"])
+        data = _apply_profile(data, profile)
+        # Las recargas posteriores usan el mismo perfil
+        os.environ["CONFIG_PROFILE"] = profile
+
+    file_values: Dict[str, Any] = {}
+    for section, options in (("shared", SHARED_OPTIONS), (SECTION, {**SHARED_OPTIONS, **SERVICE_OPTIONS})):
+        values = data.get(section) or {}
+        if not isinstance(values, dict):
+            errors.append(f"{section}: se esperaba un mapa de opciones")
+            continue
+        known = list(options)
+        for key, value in values.items():
+            if key in known:
+                file_values[key] = value
+            else:
+                errors.append(_unknown_key_error(section, str(key), known))
+
+    effective: Dict[str, str] = {}
+    for key, option in {**SHARED_OPTIONS, **SERVICE_OPTIONS}.items():
+        env_name = _env_name(key, option)
+        env_value = os.environ.get(env_name)
+        if env_value not in (None, ""):
+            source, value = f"variable {env_name}", env_value
+        elif file_values.get(key) is not None:
+            source, value = f"{SECTION if key in SERVICE_OPTIONS else 'shared'}.{key}", file_values[key]
+        else:
+            continue
+        try:
+            effective[env_name] = option.normalize(value)
+        except ValueError as e:
+            errors.append(f"{source}: {e}")
+
+    if errors:
+        raise ConfigFileError(errors)
+
+    os.environ.update(effective)
+    return effective
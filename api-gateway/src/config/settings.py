@@ -13,17 +13,50 @@ ORCHESTRATOR_PORT: str = os.getenv("ORCHESTRATOR_PORT", "8000")
 ORCHESTRATOR_URL: str = f"http://orchestrator:{ORCHESTRATOR_PORT}"
 CORS_ORIGINS: str = os.getenv("CORS_ORIGINS", "*")
 
+# Orchestrator Connection Pool (keep-alive connections shared by every forwarded request).
+# The idle timeout must stay below the orchestrator's ORCHESTRATOR_KEEPALIVE_TIMEOUT so the
+# gateway never reuses a connection the server is closing.
+ORCHESTRATOR_MAX_CONNECTIONS: int = int(os.getenv("ORCHESTRATOR_MAX_CONNECTIONS", "100"))
+ORCHESTRATOR_MAX_IDLE_CONNECTIONS: int = int(os.getenv("ORCHESTRATOR_MAX_IDLE_CONNECTIONS", "20"))
+ORCHESTRATOR_IDLE_TIMEOUT: int = int(os.getenv("ORCHESTRATOR_IDLE_TIMEOUT", "60"))
+ORCHESTRATOR_CONNECT_TIMEOUT: int = int(os.getenv("ORCHESTRATOR_CONNECT_TIMEOUT", "5"))
+
+# Org Sharding: name=url per orchestrator; runner creation goes to the shard that owns the owner
+ORCHESTRATOR_SHARDS: str = os.getenv("ORCHESTRATOR_SHARDS", "")
+
+# Zero-downtime upgrades: SO_REUSEPORT on the listening socket (sockets inherited via
+# LISTEN_FDS or a SIGUSR2 handover are used as they are)
+GATEWAY_REUSE_PORT: bool = os.getenv("GATEWAY_REUSE_PORT", "false").lower() == "true"
+GATEWAY_HANDOVER_ENABLED: bool = os.getenv("GATEWAY_HANDOVER_ENABLED", "true").lower() == "true"
+
 # Service Configuration
 USER_AGENT: str = f"GHA-API-Gateway/{__version__}"
 
 # Logging Configuration
 LOG_LEVEL: str = os.getenv("LOG_LEVEL", "INFO")
+LOG_REDACT_PATTERNS: str = os.getenv("LOG_REDACT_PATTERNS", "")
+LOG_SINKS: str = os.getenv("LOG_SINKS", "console")
+LOG_SYSLOG_ADDRESS: str = os.getenv("LOG_SYSLOG_ADDRESS", "/dev/log")
+LOG_SYSLOG_FACILITY: str = os.getenv("LOG_SYSLOG_FACILITY", "daemon")
+LOG_SYSLOG_APP_NAME: str = os.getenv("LOG_SYSLOG_APP_NAME", "gha-api-gateway")
 
 # Application Constants
 APP_TITLE: str = "GitHub Actions Ephemeral Runners API Gateway"
 APP_DESCRIPTION: str = "Gateway para la plataforma de runners efímeros de GitHub Actions"
 APP_VERSION: str = __version__
-API_PREFIX: str = "/api/v1"
+
+# API Versioning: every version is served under /api/<version>; unversioned /api/... paths
+# pick one with the API-Version header. API_DEPRECATIONS lists version:deprecation[:sunset]
+# dates (ISO 8601), e.g. "v1:2026-11-01:2027-05-01"
+API_VERSIONS: tuple = ("v1", "v2")
+API_DEFAULT_VERSION: str = os.getenv("API_DEFAULT_VERSION", "v1")
+API_DEPRECATIONS: str = os.getenv("API_DEPRECATIONS", "")
+API_SUNSET_ENFORCE: bool = os.getenv("API_SUNSET_ENFORCE", "false").lower() == "true"
+
+# List endpoints: page size when the client sends no limit, and the largest page served
+# (larger limits are capped, so no request returns the whole fleet in one response)
+LIST_DEFAULT_LIMIT: int = int(os.getenv("LIST_DEFAULT_LIMIT", "100"))
+LIST_MAX_LIMIT: int = int(os.getenv("LIST_MAX_LIMIT", "1000"))
 
 # Health Check Configuration
 HEALTH_CHECK_INTERVAL: str = "30s"
@@ -39,6 +72,118 @@ DOCKER_HOST: str = "0.0.0.0"
 LOG_LEVEL: str = "INFO"
 LOG_FORMAT: str = "%(asctime)s - %(name)s - %(levelname)s - %(message)s"
 
+# GitHub Webhooks Configuration
+GITHUB_WEBHOOK_SECRET: Optional[str] = os.getenv("GITHUB_WEBHOOK_SECRET")
+GITHUB_WEBHOOK_SECRET_SECONDARY: Optional[str] = os.getenv("GITHUB_WEBHOOK_SECRET_SECONDARY")
+WEBHOOK_SECRETS_FILE: Optional[str] = os.getenv("WEBHOOK_SECRETS_FILE")
+
+# Webhook Replay Protection (GitHub event time and delivery IDs; the skew also applies to Slack)
+WEBHOOK_MAX_AGE: int = int(os.getenv("WEBHOOK_MAX_AGE", "0"))
+WEBHOOK_CLOCK_SKEW: int = int(os.getenv("WEBHOOK_CLOCK_SKEW", "300"))
+WEBHOOK_REPLAY_WINDOW: int = int(os.getenv("WEBHOOK_REPLAY_WINDOW", "86400"))
+
+# Webhook Recording (sanitized deliveries to hourly JSONL files, replayed with cmd/webhook-replay)
+WEBHOOK_RECORD_DIR: Optional[str] = os.getenv("WEBHOOK_RECORD_DIR")
+WEBHOOK_RECORD_EVENTS: list[str] = [item.strip() for item in os.getenv("WEBHOOK_RECORD_EVENTS", "workflow_job").split(",") if item.strip()]
+WEBHOOK_RECORD_PSEUDONYMIZE: bool = os.getenv("WEBHOOK_RECORD_PSEUDONYMIZE", "false").lower() == "true"
+WEBHOOK_RECORD_S3_BUCKET: Optional[str] = os.getenv("WEBHOOK_RECORD_S3_BUCKET")
+WEBHOOK_RECORD_S3_ENDPOINT: str = os.getenv("WEBHOOK_RECORD_S3_ENDPOINT", "")
+WEBHOOK_RECORD_S3_REGION: str = os.getenv("WEBHOOK_RECORD_S3_REGION", os.getenv("AWS_REGION", "us-east-1"))
+WEBHOOK_RECORD_S3_PREFIX: str = os.getenv("WEBHOOK_RECORD_S3_PREFIX", "webhooks")
+WEBHOOK_RECORD_S3_ACCESS_KEY: Optional[str] = os.getenv("AWS_ACCESS_KEY_ID")
+WEBHOOK_RECORD_S3_SECRET_KEY: Optional[str] = os.getenv("AWS_SECRET_ACCESS_KEY")
+WEBHOOK_RECORD_S3_SESSION_TOKEN: Optional[str] = os.getenv("AWS_SESSION_TOKEN")
+
+# Chaos Injection (resilience testing only): drop this fraction of verified webhook deliveries
+CHAOS_ENABLED: bool = os.getenv("CHAOS_ENABLED", "false").lower() == "true"
+CHAOS_WEBHOOK_DROP_RATE: float = float(os.getenv("CHAOS_WEBHOOK_DROP_RATE", "0"))
+CHAOS_SEED: Optional[str] = os.getenv("CHAOS_SEED")
+
+# Access Control Configuration (roles: viewer, operator, admin)
+ADMIN_API_KEY: Optional[str] = os.getenv("ADMIN_API_KEY")
+API_KEYS: str = os.getenv("API_KEYS", "")
+API_KEYS_FILE: Optional[str] = os.getenv("API_KEYS_FILE")
+OIDC_ISSUER: Optional[str] = os.getenv("OIDC_ISSUER")
+OIDC_AUDIENCE: Optional[str] = os.getenv("OIDC_AUDIENCE")
+OIDC_JWKS_URL: Optional[str] = os.getenv("OIDC_JWKS_URL")
+OIDC_ROLE_CLAIM: str = os.getenv("OIDC_ROLE_CLAIM", "groups")
+OIDC_ROLE_MAPPING: str = os.getenv("OIDC_ROLE_MAPPING", "")
+# Claim con los tenants del usuario ("*" = todos); sin definir, los tokens OIDC no están limitados a tenants
+OIDC_TENANT_CLAIM: Optional[str] = os.getenv("OIDC_TENANT_CLAIM")
+
+# Tenant Onboarding: public URL of this gateway's GitHub webhook endpoint, configured on each tenant org
+TENANT_WEBHOOK_URL: Optional[str] = os.getenv("TENANT_WEBHOOK_URL")
+TENANT_DIRECTORY_TTL: int = int(os.getenv("TENANT_DIRECTORY_TTL", "60"))
+
+# Abuse Detection Configuration (temporary client bans)
+ABUSE_DETECTION_ENABLED: bool = os.getenv("ABUSE_DETECTION_ENABLED", "true").lower() == "true"
+ABUSE_WINDOW_SECONDS: int = int(os.getenv("ABUSE_WINDOW_SECONDS", "60"))
+ABUSE_BAN_SECONDS: int = int(os.getenv("ABUSE_BAN_SECONDS", "900"))
+ABUSE_MAX_SIGNATURE_FAILURES: int = int(os.getenv("ABUSE_MAX_SIGNATURE_FAILURES", "10"))
+ABUSE_MAX_AUTH_FAILURES: int = int(os.getenv("ABUSE_MAX_AUTH_FAILURES", "20"))
+ABUSE_MAX_WEBHOOKS: int = int(os.getenv("ABUSE_MAX_WEBHOOKS", "600"))
+ABUSE_TRUST_FORWARDED: bool = os.getenv("ABUSE_TRUST_FORWARDED", "false").lower() == "true"
+ABUSE_ALLOWLIST: list[str] = [ip.strip() for ip in os.getenv("ABUSE_ALLOWLIST", "127.0.0.1").split(",") if ip.strip()]
+
+# Security Events Configuration (SIEM webhook)
+SECURITY_EVENTS_WEBHOOK_URL: Optional[str] = os.getenv("SECURITY_EVENTS_WEBHOOK_URL")
+SECURITY_EVENTS_WEBHOOK_TOKEN: Optional[str] = os.getenv("SECURITY_EVENTS_WEBHOOK_TOKEN")
+
+# Lifecycle Events Configuration (NATS / Kafka REST Proxy)
+EVENTS_BACKEND: list[str] = [item.strip() for item in os.getenv("EVENTS_BACKEND", "").split(",") if item.strip()]
+EVENTS_NATS_URL: str = os.getenv("EVENTS_NATS_URL", "nats://nats:4222")
+EVENTS_NATS_SUBJECT_PREFIX: str = os.getenv("EVENTS_NATS_SUBJECT_PREFIX", "gha.runners")
+EVENTS_KAFKA_REST_URL: Optional[str] = os.getenv("EVENTS_KAFKA_REST_URL")
+EVENTS_KAFKA_TOPIC: str = os.getenv("EVENTS_KAFKA_TOPIC", "gha-runner-events")
+
+# Incident Configuration (PagerDuty Events v2 / Opsgenie)
+INCIDENTS_BACKEND: str = os.getenv("INCIDENTS_BACKEND", "").strip()
+PAGERDUTY_ROUTING_KEY: Optional[str] = os.getenv("PAGERDUTY_ROUTING_KEY")
+OPSGENIE_API_KEY: Optional[str] = os.getenv("OPSGENIE_API_KEY")
+OPSGENIE_API_URL: str = os.getenv("OPSGENIE_API_URL", "https://api.opsgenie.com")
+INCIDENT_SIGNATURE_STORM_THRESHOLD: int = int(os.getenv("INCIDENT_SIGNATURE_STORM_THRESHOLD", "50"))
+
+# Slack Slash Commands Configuration (/runners status|scale|drain)
+SLACK_SIGNING_SECRET: Optional[str] = os.getenv("SLACK_SIGNING_SECRET")
+SLACK_USER_ROLES: str = os.getenv("SLACK_USER_ROLES", "")
+SLACK_DEFAULT_ROLE: Optional[str] = os.getenv("SLACK_DEFAULT_ROLE")
+
+# Metrics Configuration (StatsD/DogStatsD)
+STATSD_ENABLED: bool = os.getenv("STATSD_ENABLED", "false").lower() == "true"
+STATSD_HOST: str = os.getenv("STATSD_HOST", "localhost")
+STATSD_PORT: int = int(os.getenv("STATSD_PORT", "8125"))
+STATSD_PREFIX: str = os.getenv("STATSD_PREFIX", "gha_runners")
+STATSD_TAGS: str = os.getenv("STATSD_TAGS", "")
+STATSD_DOGSTATSD: bool = os.getenv("STATSD_DOGSTATSD", "true").lower() == "true"
+
+# Datadog Configuration (DogStatsD metrics and events, APM traces through the agent)
+DATADOG_ENABLED: bool = os.getenv("DATADOG_ENABLED", "false").lower() == "true"
+DATADOG_AGENT_HOST: str = os.getenv("DATADOG_AGENT_HOST") or os.getenv("DD_AGENT_HOST") or "localhost"
+DATADOG_DOGSTATSD_PORT: int = int(os.getenv("DATADOG_DOGSTATSD_PORT", "8125"))
+DATADOG_TRACE_PORT: int = int(os.getenv("DATADOG_TRACE_PORT", "8126"))
+DATADOG_ENV: Optional[str] = os.getenv("DATADOG_ENV") or os.getenv("DD_ENV")
+DATADOG_TAGS: str = os.getenv("DATADOG_TAGS", "")
+DATADOG_TRACING: bool = os.getenv("DATADOG_TRACING", "true").lower() == "true"
+
+# Service Discovery Configuration (Consul or etcd registration with health-driven TTL)
+SERVICE_DISCOVERY_BACKEND: str = os.getenv("SERVICE_DISCOVERY_BACKEND", "").strip()
+SERVICE_DISCOVERY_ADDRESS: Optional[str] = os.getenv("SERVICE_DISCOVERY_ADDRESS")
+SERVICE_DISCOVERY_TAGS: str = os.getenv("SERVICE_DISCOVERY_TAGS", "")
+SERVICE_DISCOVERY_TTL: int = int(os.getenv("SERVICE_DISCOVERY_TTL", "30"))
+SERVICE_DISCOVERY_PREFIX: str = os.getenv("SERVICE_DISCOVERY_PREFIX", "/gha-runners/services")
+CONSUL_HTTP_ADDR: str = os.getenv("CONSUL_HTTP_ADDR", "http://localhost:8500")
+CONSUL_HTTP_TOKEN: Optional[str] = os.getenv("CONSUL_HTTP_TOKEN")
+CONSUL_DEREGISTER_AFTER: str = os.getenv("CONSUL_DEREGISTER_AFTER", "5m")
+ETCD_ENDPOINT: str = os.getenv("ETCD_ENDPOINT", "http://localhost:2379")
+ETCD_USERNAME: Optional[str] = os.getenv("ETCD_USERNAME")
+ETCD_PASSWORD: Optional[str] = os.getenv("ETCD_PASSWORD")
+
+# systemd Integration (Type=notify units; NOTIFY_SOCKET and WATCHDOG_USEC come from systemd)
+SYSTEMD_HEALTH_INTERVAL: float = float(os.getenv("SYSTEMD_HEALTH_INTERVAL", "10"))
+
+# Admin Web Dashboard Configuration (served at /ui)
+ADMIN_UI_ENABLED: bool = os.getenv("ADMIN_UI_ENABLED", "false").lower() == "true"
+
 # Headers Configuration
 DEFAULT_HEADERS = {
     "Content-Type": "application/json",
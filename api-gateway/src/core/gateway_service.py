@@ -5,6 +5,7 @@ Contains FastAPI app configuration, middleware setup, and service initialization
 
 import logging
 import os
+import time
 from contextlib import asynccontextmanager
 from datetime import datetime
 from typing import Any, Dict
@@ -12,13 +13,23 @@ from typing import Any, Dict
 from fastapi import FastAPI, Request
 from fastapi.middleware.cors import CORSMiddleware
 
+from src.api.dashboard import dashboard_router
 from src.api.endpoints import router
 from src.config.settings import (
-    APP_TITLE, APP_DESCRIPTION, APP_VERSION, API_PREFIX,
+    APP_TITLE, APP_DESCRIPTION, APP_VERSION, API_VERSIONS,
     CORS_ORIGINS, CORS_ALLOW_CREDENTIALS, CORS_ALLOW_METHODS, CORS_ALLOW_HEADERS,
-    ORCHESTRATOR_URL, LOG_LEVEL
+    ORCHESTRATOR_URL, ORCHESTRATOR_SHARDS, LOG_LEVEL, ADMIN_UI_ENABLED
 )
-from src.middleware.error_handlers import setup_exception_handlers
+from src.middleware.error_handlers import create_error_response, setup_exception_handlers
+from src.middleware.versioning import API_ROOT, api_versions
+from src.core.listener import complete_handover
+from src.services.abuse import abuse_detector, client_ip
+from src.services.datadog import Tracer, datadog
+from src.services.discovery import create_service_registration
+from src.services.systemd import create_systemd_notifier
+from src.services.metrics import metrics
+from src.services.request_router import close_orchestrator_client
+from src.services.webhook_recorder import webhook_recorder
 from src.utils.helpers import setup_logging_config, log_request_info, format_log
 from version import __version__
 
@@ -33,9 +44,29 @@ async def lifespan(app: FastAPI):
     # Startup
     logger.info(format_log('START', 'API Gateway Service'))
     logger.info(format_log('CONFIG', 'Orquestador configurado', ORCHESTRATOR_URL))
+    if ORCHESTRATOR_SHARDS:
+        logger.info(format_log('CONFIG', 'Shards de orquestadores', ORCHESTRATOR_SHARDS))
+    registration = create_service_registration()
+    if registration:
+        registration.start()
+    # Readiness and watchdog for systemd Type=notify units (NOTIFY_SOCKET)
+    notifier = create_systemd_notifier()
+    if notifier:
+        notifier.start()
+    if webhook_recorder:
+        webhook_recorder.start()
+    # Started by a SIGUSR2 handover: the previous process can stop now
+    complete_handover()
     yield
     # Shutdown
     logger.info(format_log('INFO', 'Deteniendo API Gateway Service'))
+    if notifier:
+        notifier.stop()
+    if registration:
+        registration.stop()
+    if webhook_recorder:
+        webhook_recorder.stop()
+    await close_orchestrator_client()
 
 
 def create_app() -> FastAPI:
@@ -58,6 +89,35 @@ def create_app() -> FastAPI:
         allow_headers=CORS_ALLOW_HEADERS,
     )
 
+    # API versions: negotiate unversioned paths, announce deprecations and adapt responses
+    @app.middleware("http")
+    async def versioning_middleware(request: Request, call_next):
+        """Middleware de versionado de la API."""
+        version, error = api_versions.negotiate(request)
+        if error:
+            return error
+        if not version:
+            return await call_next(request)
+        sunset = api_versions.sunset_response(version)
+        if sunset:
+            return sunset
+        response = await api_versions.adapt(version, await call_next(request))
+        api_versions.annotate(version, request, response)
+        return response
+
+    # Reject temporarily banned clients before any processing
+    @app.middleware("http")
+    async def abuse_middleware(request: Request, call_next):
+        """Middleware de bloqueo de clientes abusivos."""
+        ban = abuse_detector.ban_for(client_ip(request))
+        if ban:
+            metrics.incr("abuse.rejected_requests")
+            retry_after = max(1, int(ban["expires_at"] - time.time()))
+            response = create_error_response(429, "Cliente bloqueado temporalmente por abuso")
+            response.headers["Retry-After"] = str(retry_after)
+            return response
+        return await call_next(request)
+
     # Add logging middleware
     @app.middleware("http")
     async def logging_middleware(request: Request, call_next):
@@ -86,17 +146,46 @@ def create_app() -> FastAPI:
         # Calculate duration
         process_time = (datetime.utcnow() - start_time).total_seconds()
 
+        # Métricas de latencia (health checks internos incluidos en el conteo)
+        metric_tags = {"method": request.method, "status": str(response.status_code)}
+        metrics.incr("gateway.requests", tags=metric_tags)
+        metrics.timing("gateway.request_duration", process_time * 1000, tags=metric_tags)
+
         # Log response solo si no es health check interno
         if not is_health_check:
             logger.info(format_log('RESPONSE', 'Respuesta enviada', f"Status: {response.status_code} - Duración: {process_time:.3f}s"))
 
         return response
 
+    # APM traces (outermost middleware, so the span covers the whole request)
+    if datadog.tracer.enabled:
+        @app.middleware("http")
+        async def tracing_middleware(request: Request, call_next):
+            """Middleware de trazas APM de Datadog."""
+            with datadog.tracer.span("fastapi.request", span_type="web", parent=Tracer.extract(request.headers)) as span:
+                response = await call_next(request)
+                route = request.scope.get("route")
+                span["resource"] = f"{request.method} {getattr(route, 'path', request.url.path)}"
+                span["meta"].update({
+                    "http.method": request.method,
+                    "http.url": request.url.path,
+                    "http.status_code": str(response.status_code),
+                })
+                if response.status_code >= 500:
+                    span["error"] = 1
+                return response
+
     # Setup exception handlers
     setup_exception_handlers(app)
 
-    # Include API endpoints
-    app.include_router(router, prefix=API_PREFIX)
+    # Include API endpoints once per version (deprecated versions are flagged in the OpenAPI schema)
+    for version in API_VERSIONS:
+        app.include_router(router, prefix=f"{API_ROOT}/{version}", deprecated=version in api_versions.deprecations or None)
+
+    # Admin web dashboard (static assets; data and actions go through the API above)
+    if ADMIN_UI_ENABLED:
+        app.include_router(dashboard_router)
+        logger.info(format_log('CONFIG', 'Dashboard web habilitado', '/ui/'))
     
     # Add health check endpoints at root level (for Docker health checks)
     @app.get("/health", tags=["Health"])
@@ -0,0 +1,104 @@
+"""
+API Gateway - Listening Socket and Handover
+Zero-downtime upgrades on bare-metal hosts. The listening socket can come from systemd
+socket activation (LISTEN_FDS), in which case restarts never close it, or be handed
+over to a new gateway process on SIGUSR2: the new process inherits the same socket,
+tells the old one to stop once it is ready, and the old one drains its in-flight
+requests. Connections that arrive in between wait in the shared accept queue instead
+of being refused, so webhook deliveries are not lost during a deploy.
+"""
+
+import logging
+import os
+import signal
+import socket
+import subprocess
+import sys
+from typing import Optional
+
+from src.config.settings import GATEWAY_HANDOVER_ENABLED, GATEWAY_REUSE_PORT
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+# First file descriptor passed by systemd (sd_listen_fds)
+LISTEN_FDS_START = 3
+
+# Environment of a process started by a handover
+HANDOVER_FD_ENV = "GATEWAY_LISTEN_FD"
+HANDOVER_PARENT_ENV = "GATEWAY_HANDOVER_PID"
+
+
+def inherited_socket() -> Optional[socket.socket]:
+    """Listening socket passed by systemd or by the previous gateway process, if any."""
+    fd = os.environ.pop(HANDOVER_FD_ENV, None)
+    if fd is not None:
+        logger.info(format_log('CONFIG', 'Socket heredado del proceso anterior', f'fd {fd}'))
+        return socket.socket(fileno=int(fd))
+
+    if os.environ.get("LISTEN_PID") == str(os.getpid()) and int(os.environ.get("LISTEN_FDS", "0")) > 0:
+        # Not inherited further: a process started by a handover gets the fd through HANDOVER_FD_ENV
+        for key in ("LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"):
+            os.environ.pop(key, None)
+        logger.info(format_log('CONFIG', 'Socket de systemd (activación por socket)', f'fd {LISTEN_FDS_START}'))
+        return socket.socket(fileno=LISTEN_FDS_START)
+    return None
+
+
+def listening_socket(host: str, port: int) -> socket.socket:
+    """Inherited socket, or a new one bound to host:port (with SO_REUSEPORT if GATEWAY_REUSE_PORT)."""
+    sock = inherited_socket()
+    if sock is not None:
+        return sock
+
+    sock = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+    sock.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEADDR, 1)
+    if GATEWAY_REUSE_PORT:
+        # Another gateway version can bind the same port and start before this one stops
+        sock.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEPORT, 1)
+        logger.info(format_log('CONFIG', 'SO_REUSEPORT activado', f'puerto {port}'))
+    sock.bind((host, port))
+    sock.listen(2048)
+    return sock
+
+
+class SocketHandover:
+    """Starts a new gateway process with the listening socket on SIGUSR2."""
+
+    def __init__(self, sock: socket.socket):
+        self.sock = sock
+        self.child: Optional[subprocess.Popen] = None
+
+    def install(self):
+        if GATEWAY_HANDOVER_ENABLED:
+            signal.signal(signal.SIGUSR2, lambda signum, frame: self.handover())
+
+    def handover(self):
+        """Launch the code currently on disk with the same arguments; it stops this process once ready."""
+        if self.child is not None and self.child.poll() is None:
+            logger.warning(format_log('WARNING', 'Traspaso del socket ya en curso', f'pid {self.child.pid}'))
+            return
+
+        fd = self.sock.fileno()
+        env = {**os.environ, HANDOVER_FD_ENV: str(fd), HANDOVER_PARENT_ENV: str(os.getpid())}
+        try:
+            self.child = subprocess.Popen([sys.executable] + sys.argv, env=env, pass_fds=(fd,))
+        except OSError as e:
+            logger.error(format_log('ERROR', 'No se pudo iniciar el nuevo proceso del gateway', str(e)))
+            return
+        logger.info(format_log('INFO', 'Traspaso del socket iniciado', f'nuevo proceso {self.child.pid}'))
+
+
+def complete_handover():
+    """
+    Called by the new process once the app has started: the previous process stops
+    accepting connections and finishes its in-flight requests (graceful shutdown).
+    """
+    parent = os.environ.pop(HANDOVER_PARENT_ENV, None)
+    if not parent:
+        return
+    try:
+        os.kill(int(parent), signal.SIGTERM)
+        logger.info(format_log('SUCCESS', 'Traspaso del socket completado', f'proceso anterior {parent} detenido'))
+    except ProcessLookupError:
+        logger.warning(format_log('WARNING', 'El proceso anterior ya no existe', parent))
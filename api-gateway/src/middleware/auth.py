@@ -0,0 +1,273 @@
+"""
+API Gateway - Authentication Middleware
+Contains role-based access control (viewer, operator, admin) for API keys and OIDC tokens,
+optionally limited to a set of tenants.
+"""
+
+import hashlib
+import hmac
+import json
+import logging
+import threading
+from typing import Any, Dict, List, Optional
+
+import httpx
+import jwt
+from fastapi import Header, HTTPException, Request
+from starlette.concurrency import run_in_threadpool
+
+from src.config.settings import (
+    ADMIN_API_KEY, API_KEYS, API_KEYS_FILE,
+    OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL, OIDC_ROLE_CLAIM, OIDC_ROLE_MAPPING, OIDC_TENANT_CLAIM
+)
+from src.services.abuse import abuse_detector, client_ip
+from src.services.metrics import metrics
+from src.services.security_events import security_events
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+# Roles en orden creciente de privilegios: cada rol incluye los anteriores
+ROLES = ("viewer", "operator", "admin")
+
+
+def role_level(role: str) -> int:
+    return ROLES.index(role) if role in ROLES else -1
+
+
+class Principal:
+    """Authenticated caller; tenants=None means platform-wide access."""
+
+    def __init__(self, name: str, role: str, method: str, tenants: Optional[List[str]] = None):
+        self.name = name
+        self.role = role
+        self.method = method
+        self.tenants = tenants
+
+    def has_role(self, role: str) -> bool:
+        return role_level(self.role) >= role_level(role)
+
+    @property
+    def scoped(self) -> bool:
+        return self.tenants is not None
+
+    def can_access(self, tenant: Optional[str]) -> bool:
+        """Platform principals see everything; scoped ones only their tenants' resources."""
+        return not self.scoped or tenant in self.tenants
+
+    def to_dict(self) -> Dict[str, Any]:
+        data = {"name": self.name, "role": self.role, "method": self.method}
+        if self.scoped:
+            data["tenants"] = self.tenants
+        return data
+
+
+class APIKeyStore:
+    """API keys with a role each (from API_KEYS, API_KEYS_FILE and ADMIN_API_KEY)."""
+
+    def __init__(self, raw_keys: str = "", keys_file: Optional[str] = None, admin_key: Optional[str] = None):
+        self.keys: List[Dict[str, Any]] = []
+
+        # API_KEYS=role:key,role:key
+        for item in raw_keys.split(","):
+            role, _, key = item.strip().partition(":")
+            if key:
+                self._add(role, key)
+
+        # API_KEYS_FILE=[{"name": "ci", "role": "operator", "key": "...", "tenants": ["acme"]}]
+        if keys_file:
+            with open(keys_file, "r") as file:
+                for entry in json.load(file):
+                    self._add(entry["role"], entry["key"], entry.get("name"), entry.get("tenants"))
+
+        if admin_key:
+            self._add("admin", admin_key, "admin")
+
+    def _add(self, role: str, key: str, name: Optional[str] = None, tenants: Optional[List[str]] = None):
+        if role not in ROLES:
+            raise ValueError(f"Rol de API key inválido: {role} (válidos: {', '.join(ROLES)})")
+        if tenants is not None and not isinstance(tenants, list):
+            raise ValueError(f"'tenants' de la API key {name} debe ser una lista")
+        fingerprint = hashlib.sha256(key.encode("utf-8")).hexdigest()[:8]
+        self.keys.append({"name": name or f"key-{fingerprint}", "role": role, "key": key, "tenants": tenants})
+
+    def authenticate(self, key: str) -> Optional[Principal]:
+        for entry in self.keys:
+            if hmac.compare_digest(entry["key"], key):
+                return Principal(entry["name"], entry["role"], "api_key", entry["tenants"])
+        return None
+
+
+class OIDCValidator:
+    """Validates OIDC bearer tokens and maps a claim to a role."""
+
+    def __init__(
+        self, issuer: str, audience: Optional[str], jwks_url: Optional[str], role_claim: str, role_mapping: str,
+        tenant_claim: Optional[str] = None,
+    ):
+        # Se compara tal cual con el claim iss; la barra final solo se quita para discovery
+        self.issuer = issuer
+        self.audience = audience
+        self.jwks_url = jwks_url
+        self.role_claim = role_claim
+        self.tenant_claim = tenant_claim
+        self.role_mapping: Dict[str, str] = {}
+        for item in role_mapping.split(","):
+            value, _, role = item.strip().partition("=")
+            if value and role in ROLES:
+                self.role_mapping[value] = role
+        self.jwks_client: Optional[jwt.PyJWKClient] = None
+        self.lock = threading.Lock()
+
+    def _get_jwks_client(self) -> jwt.PyJWKClient:
+        """Resolve the JWKS endpoint (discovery if not configured) on first use."""
+        with self.lock:
+            if self.jwks_client is None:
+                jwks_url = self.jwks_url
+                if not jwks_url:
+                    discovery = httpx.get(f"{self.issuer.rstrip('/')}/.well-known/openid-configuration", timeout=10.0)
+                    discovery.raise_for_status()
+                    jwks_url = discovery.json()["jwks_uri"]
+                self.jwks_client = jwt.PyJWKClient(jwks_url, cache_keys=True)
+            return self.jwks_client
+
+    def _resolve_role(self, claims: Dict) -> Optional[str]:
+        values = claims.get(self.role_claim, [])
+        if isinstance(values, str):
+            values = values.split()
+
+        roles = [self.role_mapping.get(value, value) for value in values]
+        roles = [role for role in roles if role in ROLES]
+        return max(roles, key=role_level) if roles else None
+
+    def _resolve_tenants(self, claims: Dict) -> Optional[List[str]]:
+        """Tenants from OIDC_TENANT_CLAIM: "*" grants platform-wide access, a missing claim none."""
+        if not self.tenant_claim:
+            return None
+        values = claims.get(self.tenant_claim, [])
+        if isinstance(values, str):
+            values = values.split()
+        return None if "*" in values else list(values)
+
+    def authenticate(self, token: str) -> Optional[Principal]:
+        try:
+            signing_key = self._get_jwks_client().get_signing_key_from_jwt(token)
+            claims = jwt.decode(
+                token,
+                signing_key.key,
+                algorithms=["RS256", "ES256"],
+                audience=self.audience,
+                issuer=self.issuer,
+                options={"verify_aud": bool(self.audience)},
+            )
+        except (jwt.PyJWTError, httpx.HTTPError, KeyError) as e:
+            logger.warning(format_log('WARNING', 'Token OIDC inválido', str(e)))
+            return None
+
+        role = self._resolve_role(claims)
+        if not role:
+            logger.warning(format_log('WARNING', 'Token OIDC sin rol asignado', claims.get("sub", "unknown")))
+            return None
+        return Principal(claims.get("email") or claims.get("sub", "unknown"), role, "oidc", self._resolve_tenants(claims))
+
+
+api_keys = APIKeyStore(API_KEYS, API_KEYS_FILE, ADMIN_API_KEY)
+oidc = OIDCValidator(
+    OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL, OIDC_ROLE_CLAIM, OIDC_ROLE_MAPPING, OIDC_TENANT_CLAIM
+) if OIDC_ISSUER else None
+
+# Sin API keys ni OIDC la API de runners queda abierta como antes; la de administración, deshabilitada
+AUTH_ENABLED = bool(api_keys.keys or oidc)
+
+
+def authenticate(x_api_key: Optional[str], authorization: Optional[str]) -> Optional[Principal]:
+    """Resolve the caller from X-API-Key or an OIDC bearer token."""
+    if x_api_key:
+        return api_keys.authenticate(x_api_key)
+
+    scheme, _, token = (authorization or "").partition(" ")
+    if scheme.lower() == "bearer" and token and oidc:
+        return oidc.authenticate(token)
+    return None
+
+
+def require_role(role: str, tenant_scoped: bool = False):
+    """
+    Build a dependency that requires at least the given role.
+
+    Principals limited to tenants are only admitted on tenant_scoped routes, which
+    check each resource against principal.can_access().
+    """
+
+    async def dependency(
+        request: Request,
+        x_api_key: Optional[str] = Header(None),
+        authorization: Optional[str] = Header(None),
+    ) -> Principal:
+        if not AUTH_ENABLED:
+            if role == "admin":
+                raise HTTPException(
+                    status_code=403,
+                    detail="API de administración deshabilitada (configurar API_KEYS, ADMIN_API_KEY u OIDC_ISSUER)",
+                )
+            return Principal("anonymous", "operator", "none")
+
+        # La validación OIDC puede descargar JWKS: fuera del event loop
+        principal = await run_in_threadpool(authenticate, x_api_key, authorization)
+        if not principal:
+            metrics.incr("auth.failures", tags={"reason": "invalid_credentials"})
+            abuse_detector.record(client_ip(request), "auth_failure")
+            logger.warning(format_log('WARNING', 'Credenciales inválidas', f"{request.method} {request.url.path}"))
+            security_events.emit(
+                "auth.invalid_credentials",
+                client_ip=client_ip(request),
+                method=request.method,
+                path=request.url.path,
+                credential="api_key" if x_api_key else ("bearer" if authorization else "none"),
+            )
+            raise HTTPException(status_code=401, detail="Credenciales inválidas o ausentes")
+
+        if not principal.has_role(role):
+            metrics.incr("auth.failures", tags={"reason": "forbidden"})
+            logger.warning(format_log(
+                'WARNING', 'Rol insuficiente',
+                f"{principal.name} ({principal.role}) requiere {role} para {request.method} {request.url.path}"
+            ))
+            security_events.emit(
+                "auth.forbidden",
+                principal=principal.name,
+                role=principal.role,
+                required_role=role,
+                method=request.method,
+                path=request.url.path,
+            )
+            raise HTTPException(status_code=403, detail=f"Se requiere rol {role}")
+
+        if principal.scoped and not tenant_scoped:
+            metrics.incr("auth.failures", tags={"reason": "tenant_scope"})
+            logger.warning(format_log(
+                'WARNING', 'Credencial limitada a tenants',
+                f"{principal.name} ({', '.join(principal.tenants) or '-'}) no puede usar {request.method} {request.url.path}"
+            ))
+            security_events.emit(
+                "auth.forbidden",
+                principal=principal.name,
+                role=principal.role,
+                tenants=principal.tenants,
+                method=request.method,
+                path=request.url.path,
+            )
+            raise HTTPException(status_code=403, detail="Operación de plataforma: la credencial está limitada a tenants")
+
+        request.state.principal = principal
+        return principal
+
+    return dependency
+
+
+require_viewer = require_role("viewer")
+require_operator = require_role("operator")
+require_admin = require_role("admin")
+# Runner and tenant routes: scoped principals are admitted and filtered per tenant
+require_tenant_viewer = require_role("viewer", tenant_scoped=True)
+require_tenant_operator = require_role("operator", tenant_scoped=True)
@@ -0,0 +1,204 @@
+"""
+API Gateway - API Versioning Middleware
+Serves every API version under /api/<version>, negotiates unversioned paths with the
+API-Version header, announces deprecated versions (Deprecation, Sunset and successor
+Link headers) and adapts responses between versions so handlers are written once.
+"""
+
+import json
+import logging
+import re
+import threading
+import time
+from datetime import datetime, timezone
+from email.utils import format_datetime
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from fastapi import Request
+from starlette.responses import Response
+
+from src.config.settings import API_DEFAULT_VERSION, API_DEPRECATIONS, API_SUNSET_ENFORCE, API_VERSIONS
+from src.middleware.error_handlers import create_error_response
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+API_ROOT = "/api"
+VERSION_PATTERN = re.compile(r"^v\d+$")
+
+# Clientes (User-Agent) avisados por versión en uso obsoleta; se avisa una vez por cliente
+WARNED_CLIENTS_SIZE = 1000
+
+
+def _list_to_items(payload: Dict[str, Any], response: Response) -> Dict[str, Any]:
+    """
+    v2: list payloads are objects with items and count, so fields can be added without
+    breaking clients. Paginated lists also carry next_cursor and total (sent as the
+    X-Next-Cursor and X-Total-Count headers to v1 clients).
+    """
+    if isinstance(payload.get("data"), list):
+        payload["data"] = {"items": payload["data"], "count": len(payload["data"])}
+        if "x-total-count" in response.headers:
+            payload["data"]["total"] = int(response.headers["x-total-count"])
+            payload["data"]["next_cursor"] = response.headers.get("x-next-cursor")
+    return payload
+
+
+# Adaptadores por versión, aplicados en orden sobre el cuerpo JSON de la respuesta
+ADAPTERS: Dict[str, List[Callable[[Dict[str, Any], Response], Dict[str, Any]]]] = {
+    "v1": [],
+    "v2": [_list_to_items],
+}
+
+
+def _parse_date(value: str, spec: str) -> float:
+    try:
+        parsed = datetime.fromisoformat(value)
+    except ValueError:
+        raise ValueError(f"API_DEPRECATIONS: fecha inválida {value} en {spec}")
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=timezone.utc)
+    return parsed.timestamp()
+
+
+def parse_deprecations(spec: str) -> Dict[str, Dict[str, Optional[float]]]:
+    """Parse "v1:2026-11-01:2027-05-01,..." into {version: {deprecated_at, sunset_at}}."""
+    deprecations: Dict[str, Dict[str, Optional[float]]] = {}
+    for entry in (item.strip() for item in spec.split(",")):
+        if not entry:
+            continue
+        parts = entry.split(":", 1)
+        version = parts[0].strip()
+        if version not in API_VERSIONS or len(parts) < 2:
+            raise ValueError(f"API_DEPRECATIONS: entrada inválida {entry} (version:fecha[:sunset])")
+        # Las fechas con hora también llevan ':': el sunset empieza en el ':' seguido de otra fecha
+        dates = re.split(r":(?=\d{4}-\d{2}-\d{2})", parts[1])
+        deprecations[version] = {
+            "deprecated_at": _parse_date(dates[0], entry),
+            "sunset_at": _parse_date(dates[1], entry) if len(dates) > 1 else None,
+        }
+    return deprecations
+
+
+class APIVersions:
+    """Supported versions, their deprecation schedule and the response adapters."""
+
+    def __init__(self, versions: Tuple[str, ...], default: str, deprecations: Dict[str, Dict[str, Optional[float]]], enforce_sunset: bool = False):
+        if default not in versions:
+            raise ValueError(f"API_DEFAULT_VERSION desconocida: {default} ({', '.join(versions)})")
+        self.versions = versions
+        self.latest = versions[-1]
+        self.default = default
+        self.deprecations = deprecations
+        self.enforce_sunset = enforce_sunset
+        self.warned: Dict[str, set] = {}
+        self.lock = threading.Lock()
+
+    def describe(self) -> List[Dict[str, Any]]:
+        def iso(at: Optional[float]) -> Optional[str]:
+            return datetime.fromtimestamp(at, timezone.utc).isoformat() if at else None
+
+        now = time.time()
+        return [
+            {
+                "version": version,
+                "path": f"{API_ROOT}/{version}",
+                "latest": version == self.latest,
+                "default": version == self.default,
+                "deprecated": self.is_deprecated(version, now),
+                "deprecated_at": iso(self.deprecations.get(version, {}).get("deprecated_at")),
+                "sunset_at": iso(self.deprecations.get(version, {}).get("sunset_at")),
+            }
+            for version in self.versions
+        ]
+
+    def is_deprecated(self, version: str, now: Optional[float] = None) -> bool:
+        schedule = self.deprecations.get(version)
+        return bool(schedule) and (now or time.time()) >= schedule["deprecated_at"]
+
+    def negotiate(self, request: Request) -> Tuple[Optional[str], Optional[Response]]:
+        """
+        Version of an /api request. Unversioned paths are rewritten to the version asked
+        for in API-Version (or the default) before routing.
+        """
+        path = request.scope["path"]
+        if path != API_ROOT and not path.startswith(f"{API_ROOT}/"):
+            return None, None
+        segment = path[len(API_ROOT) + 1:].split("/", 1)[0]
+        if VERSION_PATTERN.match(segment):
+            if segment not in self.versions:
+                return segment, create_error_response(404, f"Versión de API no soportada: {segment} ({', '.join(self.versions)})")
+            return segment, None
+
+        requested = request.headers.get("api-version", "").strip().lower()
+        version = (requested if requested.startswith("v") else f"v{requested}") if requested else self.default
+        if version not in self.versions:
+            return version, create_error_response(400, f"Versión de API no soportada: {requested} ({', '.join(self.versions)})")
+        rewritten = f"{API_ROOT}/{version}{path[len(API_ROOT):]}"
+        request.scope["path"] = rewritten
+        request.scope["raw_path"] = rewritten.encode()
+        return version, None
+
+    def _warn(self, version: str, request: Request):
+        client = request.headers.get("user-agent", "-")
+        with self.lock:
+            warned = self.warned.setdefault(version, set())
+            if client in warned or len(warned) >= WARNED_CLIENTS_SIZE:
+                return
+            warned.add(client)
+        logger.warning(format_log(
+            'WARNING', f'Cliente usando la API {version} obsoleta',
+            f"{client} ({request.method} {request.url.path})",
+        ))
+
+    def sunset_response(self, version: str) -> Optional[Response]:
+        """410 for a version past its sunset date when API_SUNSET_ENFORCE=true."""
+        sunset = self.deprecations.get(version, {}).get("sunset_at")
+        if not self.enforce_sunset or not sunset or time.time() < sunset:
+            return None
+        response = create_error_response(
+            410, f"La API {version} se retiró el {datetime.fromtimestamp(sunset, timezone.utc).date()}; usa {API_ROOT}/{self.latest}",
+        )
+        response.headers["Link"] = f'<{API_ROOT}/{self.latest}/>; rel="successor-version"'
+        return response
+
+    def annotate(self, version: str, request: Request, response: Response):
+        """
+        API-Version header, plus Deprecation, Sunset and the successor Link on versions with
+        a deprecation schedule (a future Deprecation date announces it ahead of time).
+        """
+        response.headers["API-Version"] = version
+        metrics.incr("gateway.api_requests", tags={"version": version})
+        schedule = self.deprecations.get(version)
+        if not schedule:
+            return
+        response.headers["Deprecation"] = f"@{int(schedule['deprecated_at'])}"
+        if schedule["sunset_at"]:
+            response.headers["Sunset"] = format_datetime(datetime.fromtimestamp(schedule["sunset_at"], timezone.utc), usegmt=True)
+        successor = request.scope["path"].replace(f"{API_ROOT}/{version}", f"{API_ROOT}/{self.latest}", 1)
+        link = f'<{successor}>; rel="successor-version"'
+        # Los listados paginados ya traen Link rel="next"
+        response.headers["Link"] = f"{response.headers['Link']}, {link}" if "Link" in response.headers else link
+        metrics.incr("gateway.deprecated_requests", tags={"version": version})
+        self._warn(version, request)
+
+    async def adapt(self, version: str, response: Response) -> Response:
+        """Apply the version's adapters to a JSON response body."""
+        adapters = ADAPTERS.get(version) or []
+        if not adapters or not response.headers.get("content-type", "").startswith("application/json"):
+            return response
+        body = b"".join([chunk async for chunk in response.body_iterator])
+        try:
+            payload = json.loads(body)
+        except ValueError:
+            payload = None
+        if isinstance(payload, dict):
+            for adapter in adapters:
+                payload = adapter(payload, response)
+            body = json.dumps(payload).encode()
+        headers = {key: value for key, value in response.headers.items() if key.lower() != "content-length"}
+        return Response(content=body, status_code=response.status_code, headers=headers, media_type="application/json")
+
+
+api_versions = APIVersions(API_VERSIONS, API_DEFAULT_VERSION, parse_deprecations(API_DEPRECATIONS), API_SUNSET_ENFORCE)
@@ -0,0 +1,131 @@
+"""
+API Gateway - Abuse Detection
+Counts abusive patterns per client IP and applies temporary bans.
+"""
+
+import logging
+import threading
+import time
+from collections import deque
+from typing import Deque, Dict, List, Optional
+
+from fastapi import Request
+
+from src.config.settings import (
+    ABUSE_DETECTION_ENABLED, ABUSE_WINDOW_SECONDS, ABUSE_BAN_SECONDS, ABUSE_TRUST_FORWARDED,
+    ABUSE_ALLOWLIST, ABUSE_MAX_SIGNATURE_FAILURES, ABUSE_MAX_AUTH_FAILURES, ABUSE_MAX_WEBHOOKS
+)
+from src.services.metrics import metrics
+from src.services.security_events import security_events
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+def client_ip(request: Request) -> str:
+    """Client IP, taken from X-Forwarded-For only when the gateway sits behind a trusted proxy."""
+    if ABUSE_TRUST_FORWARDED:
+        forwarded = request.headers.get("x-forwarded-for")
+        if forwarded:
+            return forwarded.split(",")[0].strip()
+    return request.client.host if request.client else "unknown"
+
+
+class AbuseDetector:
+    """
+    Sliding-window counters per client and pattern.
+
+    When a client exceeds the threshold of a pattern within the window it is
+    banned for ban_seconds; bans can be reviewed and lifted through the admin API.
+    """
+
+    def __init__(self, thresholds: Dict[str, int], window: int, ban_seconds: int, allowlist: List[str], enabled: bool = True):
+        self.thresholds = thresholds
+        self.window = window
+        self.ban_seconds = ban_seconds
+        self.allowlist = set(allowlist)
+        self.enabled = enabled
+        self.events: Dict[tuple, Deque[float]] = {}
+        self.bans: Dict[str, Dict] = {}
+        self.lock = threading.Lock()
+
+    def record(self, ip: str, pattern: str):
+        """Record one occurrence of a pattern and ban the client if it crosses the threshold."""
+        if not self.enabled or ip in self.allowlist:
+            return
+
+        threshold = self.thresholds.get(pattern)
+        if not threshold:
+            return
+
+        now = time.time()
+        with self.lock:
+            events = self.events.setdefault((ip, pattern), deque())
+            events.append(now)
+            while events and events[0] < now - self.window:
+                events.popleft()
+            exceeded = len(events) >= threshold
+            if exceeded:
+                events.clear()
+                self.bans[ip] = {
+                    "ip": ip,
+                    "reason": pattern,
+                    "count": threshold,
+                    "banned_at": now,
+                    "expires_at": now + self.ban_seconds,
+                }
+
+        if exceeded:
+            metrics.incr("abuse.bans", tags={"reason": pattern})
+            logger.warning(format_log('WARNING', 'Cliente bloqueado temporalmente', f"{ip} ({pattern}, {self.ban_seconds}s)"))
+            security_events.emit("abuse.client_banned", ip=ip, reason=pattern, threshold=threshold,
+                                 window_seconds=self.window, ban_seconds=self.ban_seconds)
+
+    def ban_for(self, ip: str) -> Optional[Dict]:
+        """Return the active ban of a client, if any."""
+        with self.lock:
+            ban = self.bans.get(ip)
+            if ban and ban["expires_at"] <= time.time():
+                del self.bans[ip]
+                return None
+            return ban
+
+    def list_bans(self) -> List[Dict]:
+        now = time.time()
+        with self.lock:
+            for ip in [ip for ip, ban in self.bans.items() if ban["expires_at"] <= now]:
+                del self.bans[ip]
+            return [dict(ban, remaining_seconds=int(ban["expires_at"] - now)) for ban in self.bans.values()]
+
+    def lift(self, ip: str) -> bool:
+        """Lift a ban and reset the client's counters."""
+        with self.lock:
+            for key in [key for key in self.events if key[0] == ip]:
+                del self.events[key]
+            return self.bans.pop(ip, None) is not None
+
+    def restore(self, bans: List[Dict]) -> int:
+        """Restore bans from a state snapshot; expired or allowlisted entries are skipped."""
+        now = time.time()
+        restored = 0
+        with self.lock:
+            for ban in bans:
+                ip = ban.get("ip")
+                if not ip or ip in self.allowlist or float(ban.get("expires_at", 0)) <= now:
+                    continue
+                self.bans[ip] = {key: ban[key] for key in ("ip", "reason", "count", "banned_at", "expires_at") if key in ban}
+                restored += 1
+        return restored
+
+
+abuse_detector = AbuseDetector(
+    thresholds={
+        "signature_failure": ABUSE_MAX_SIGNATURE_FAILURES,
+        "auth_failure": ABUSE_MAX_AUTH_FAILURES,
+        "webhook": ABUSE_MAX_WEBHOOKS,
+    },
+    window=ABUSE_WINDOW_SECONDS,
+    ban_seconds=ABUSE_BAN_SECONDS,
+    allowlist=ABUSE_ALLOWLIST,
+    enabled=ABUSE_DETECTION_ENABLED,
+)
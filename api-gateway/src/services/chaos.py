@@ -0,0 +1,59 @@
+"""
+API Gateway - Chaos Injection
+With CHAOS_ENABLED=true a fraction of the verified GitHub webhook deliveries is dropped
+on purpose, as if it never reached the gateway: it is acknowledged so GitHub does not
+redeliver it, and never forwarded. Used in staging to prove that the orchestrator's
+autoscaler and orphaned-job detection make up for lost deliveries.
+"""
+
+import logging
+import random
+import threading
+from typing import Any, Dict, Optional
+
+from src.config.settings import CHAOS_ENABLED, CHAOS_SEED, CHAOS_WEBHOOK_DROP_RATE
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+class WebhookChaos:
+    """Decides which webhook deliveries to drop."""
+
+    def __init__(self, drop_rate: float, seed: Optional[int] = None):
+        if not 0 <= drop_rate <= 1:
+            raise ValueError("CHAOS_WEBHOOK_DROP_RATE debe estar entre 0 y 1")
+        self.drop_rate = drop_rate
+        self.random = random.Random(seed)
+        self.dropped = 0
+        self.lock = threading.Lock()
+
+    def drop(self, event: str, delivery_id: str) -> bool:
+        """True when the delivery must be lost."""
+        if self.drop_rate <= 0:
+            return False
+        with self.lock:
+            if self.random.random() >= self.drop_rate:
+                return False
+            self.dropped += 1
+        metrics.incr("chaos.injected", tags={"kind": "webhook_drop", "event": event})
+        logger.warning(format_log('WARNING', 'Caos: webhook descartado', f"{event} delivery={delivery_id}"))
+        return True
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {"webhook_drop_rate": self.drop_rate, "webhooks_dropped": self.dropped}
+
+
+def create_webhook_chaos() -> Optional[WebhookChaos]:
+    """Chaos for the webhook endpoint, or None without CHAOS_ENABLED=true."""
+    if not CHAOS_ENABLED:
+        return None
+    chaos = WebhookChaos(CHAOS_WEBHOOK_DROP_RATE, int(CHAOS_SEED) if CHAOS_SEED else None)
+    logger.warning(format_log('WARNING', 'Inyección de caos activada', str(chaos.status())))
+    return chaos
+
+
+# Shared by the GitHub webhook endpoint
+webhook_chaos = create_webhook_chaos()
@@ -0,0 +1,189 @@
+"""
+API Gateway - Datadog
+Native Datadog integration through the agent: DogStatsD metrics and APM traces with
+unified service tagging. Traces continue into the orchestrator through the
+x-datadog-* propagation headers.
+"""
+
+import json
+import logging
+import random
+import threading
+import time
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Any, Dict, Iterator, List, Optional, Tuple
+
+import httpx
+
+from src.config.settings import (
+    DATADOG_ENABLED, DATADOG_AGENT_HOST, DATADOG_DOGSTATSD_PORT, DATADOG_TRACE_PORT,
+    DATADOG_ENV, DATADOG_TAGS, DATADOG_TRACING, STATSD_PREFIX
+)
+from src.services.metrics import StatsDSink, metrics, parse_tags
+from src.utils.helpers import format_log
+from version import __version__
+
+logger = logging.getLogger(__name__)
+
+SERVICE = "gha-api-gateway"
+
+TRACE_ID_HEADER = "x-datadog-trace-id"
+PARENT_ID_HEADER = "x-datadog-parent-id"
+SAMPLING_PRIORITY_HEADER = "x-datadog-sampling-priority"
+
+_current_span: ContextVar[Optional[Dict[str, Any]]] = ContextVar("datadog_span", default=None)
+
+
+def _new_id() -> int:
+    # 63 bits keeps ids positive and exact in JSON
+    return random.getrandbits(63) or 1
+
+
+class Tracer:
+    """Spans in the agent trace API format (/v0.4/traces, JSON), flushed in batches."""
+
+    def __init__(self, host: str, port: int, service: str, tags: Dict[str, str], enabled: bool = True):
+        self.url = f"http://{host}:{port}/v0.4/traces"
+        self.service = service
+        self.tags = tags
+        self.enabled = enabled
+        self.finished: List[Dict[str, Any]] = []
+        self.lock = threading.Lock()
+
+        if self.enabled:
+            threading.Thread(target=self._flush_loop, daemon=True).start()
+
+    @contextmanager
+    def span(
+        self,
+        name: str,
+        resource: Optional[str] = None,
+        span_type: Optional[str] = None,
+        parent: Optional[Tuple[int, int]] = None,
+    ) -> Iterator[Dict[str, Any]]:
+        """Open a child of the current span, or of parent=(trace_id, span_id) taken from headers."""
+        current = _current_span.get()
+        if parent:
+            trace_id, parent_id = parent
+        elif current:
+            trace_id, parent_id = current["trace_id"], current["span_id"]
+        else:
+            trace_id, parent_id = _new_id(), 0
+
+        span = {
+            "trace_id": trace_id,
+            "span_id": _new_id(),
+            "parent_id": parent_id,
+            "name": name,
+            "resource": resource or name,
+            "service": self.service,
+            "type": span_type or "custom",
+            "start": time.time_ns(),
+            "duration": 0,
+            "error": 0,
+            "meta": dict(self.tags),
+            "metrics": {"_sampling_priority_v1": 1},
+        }
+        if current is None:
+            span["metrics"]["_dd.top_level"] = 1
+
+        token = _current_span.set(span)
+        try:
+            yield span
+        except Exception as e:
+            span["error"] = 1
+            span["meta"]["error.type"] = type(e).__name__
+            span["meta"]["error.message"] = str(e)[:500]
+            raise
+        finally:
+            span["duration"] = time.time_ns() - span["start"]
+            _current_span.reset(token)
+            if self.enabled:
+                with self.lock:
+                    self.finished.append(span)
+
+    def propagation_headers(self) -> Dict[str, str]:
+        """Headers that continue the current trace in the orchestrator."""
+        current = _current_span.get()
+        if not self.enabled or current is None:
+            return {}
+        return {
+            TRACE_ID_HEADER: str(current["trace_id"]),
+            PARENT_ID_HEADER: str(current["span_id"]),
+            SAMPLING_PRIORITY_HEADER: "1",
+        }
+
+    @staticmethod
+    def extract(headers: Any) -> Optional[Tuple[int, int]]:
+        """(trace_id, parent_id) from incoming Datadog headers, if present."""
+        try:
+            return int(headers[TRACE_ID_HEADER]), int(headers[PARENT_ID_HEADER])
+        except (KeyError, TypeError, ValueError):
+            return None
+
+    def _flush_loop(self):
+        while True:
+            time.sleep(1)
+            with self.lock:
+                spans, self.finished = self.finished, []
+            if not spans:
+                continue
+            traces: Dict[int, List[Dict[str, Any]]] = {}
+            for span in spans:
+                traces.setdefault(span["trace_id"], []).append(span)
+            try:
+                response = httpx.put(
+                    self.url, content=json.dumps(list(traces.values())),
+                    headers={"Content-Type": "application/json", "X-Datadog-Trace-Count": str(len(traces))},
+                    timeout=5.0,
+                )
+                response.raise_for_status()
+            except httpx.HTTPError as e:
+                metrics.incr("datadog.traces_dropped", len(spans))
+                logger.debug(f"No se pudieron enviar trazas al agente de Datadog: {e}")
+
+
+class Datadog:
+    """Service tracer; a no-op unless DATADOG_ENABLED. Scale-decision events come from the orchestrator."""
+
+    def __init__(
+        self,
+        enabled: bool = False,
+        host: str = "localhost",
+        trace_port: int = 8126,
+        tags: Optional[Dict[str, str]] = None,
+        tracing: bool = True,
+    ):
+        self.enabled = enabled
+        self.tags = tags or {}
+        self.tracer = Tracer(host, trace_port, SERVICE, self.tags, enabled=enabled and tracing)
+
+
+def create_datadog() -> Datadog:
+    """Build the integration from DATADOG_* settings (DD_AGENT_HOST and DD_ENV as fallbacks)."""
+    if not DATADOG_ENABLED:
+        return Datadog()
+
+    tags = parse_tags(DATADOG_TAGS)
+    tags.update(service=SERVICE, version=__version__)
+    if DATADOG_ENV:
+        tags["env"] = DATADOG_ENV
+
+    metrics.add_sink(StatsDSink(DATADOG_AGENT_HOST, DATADOG_DOGSTATSD_PORT, prefix=STATSD_PREFIX, tags=tags, dogstatsd=True))
+    integration = Datadog(
+        enabled=True,
+        host=DATADOG_AGENT_HOST,
+        trace_port=DATADOG_TRACE_PORT,
+        tags=tags,
+        tracing=DATADOG_TRACING,
+    )
+    logger.info(format_log(
+        'CONFIG', 'Datadog activado',
+        f"agente {DATADOG_AGENT_HOST} (service={SERVICE}, env={DATADOG_ENV or '-'}, trazas {'sí' if integration.tracer.enabled else 'no'})"
+    ))
+    return integration
+
+
+# Shared integration for all gateway modules
+datadog = create_datadog()
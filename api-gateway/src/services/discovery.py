@@ -0,0 +1,212 @@
+"""
+API Gateway - Service Discovery
+Registers the gateway in Consul or etcd so other infrastructure finds it without
+hardcoded hostnames. The registration TTL is renewed by a heartbeat that probes the
+gateway's own /healthz, the same endpoint the image HEALTHCHECK uses: an unhealthy
+gateway turns critical in Consul and its etcd key disappears with the revoked lease.
+"""
+
+import base64
+import json
+import logging
+import socket
+import threading
+from typing import Any, Dict, Optional, Tuple
+
+import httpx
+
+from src.config.settings import (
+    API_GATEWAY_PORT, SERVICE_DISCOVERY_BACKEND, SERVICE_DISCOVERY_ADDRESS, SERVICE_DISCOVERY_TAGS,
+    SERVICE_DISCOVERY_TTL, SERVICE_DISCOVERY_PREFIX, CONSUL_HTTP_ADDR, CONSUL_HTTP_TOKEN,
+    CONSUL_DEREGISTER_AFTER, ETCD_ENDPOINT, ETCD_USERNAME, ETCD_PASSWORD
+)
+from src.utils.helpers import format_log
+from version import __version__
+
+logger = logging.getLogger(__name__)
+
+SERVICE = "gha-api-gateway"
+
+
+def _b64(value: str) -> str:
+    return base64.b64encode(value.encode()).decode()
+
+
+class ConsulRegistry:
+    """Consul agent: service with a TTL check updated on every heartbeat."""
+
+    name = "consul"
+
+    def __init__(self, address: str, token: Optional[str] = None, deregister_after: str = "5m"):
+        self.address = address.rstrip("/")
+        self.headers = {"X-Consul-Token": token} if token else {}
+        self.deregister_after = deregister_after
+
+    def register(self, service: Dict[str, Any], ttl: int):
+        response = httpx.put(f"{self.address}/v1/agent/service/register", headers=self.headers, timeout=5.0, json={
+            "ID": service["id"],
+            "Name": service["name"],
+            "Address": service["address"],
+            "Port": service["port"],
+            "Tags": service["tags"],
+            "Meta": {"version": service["version"]},
+            "Check": {
+                "CheckID": f"service:{service['id']}",
+                "TTL": f"{ttl}s",
+                "DeregisterCriticalServiceAfter": self.deregister_after,
+            },
+        })
+        response.raise_for_status()
+
+    def heartbeat(self, service: Dict[str, Any], ttl: int, healthy: bool, output: str) -> bool:
+        """Update the check; False when the agent no longer knows the service."""
+        response = httpx.put(
+            f"{self.address}/v1/agent/check/update/service:{service['id']}", headers=self.headers, timeout=5.0,
+            json={"Status": "passing" if healthy else "critical", "Output": output},
+        )
+        # Agents answer 404 (500 on older versions) after losing the registration on restart
+        if response.status_code in (404, 500):
+            return False
+        response.raise_for_status()
+        return True
+
+    def deregister(self, service: Dict[str, Any]):
+        httpx.put(f"{self.address}/v1/agent/service/deregister/{service['id']}", headers=self.headers, timeout=5.0)
+
+
+class EtcdRegistry:
+    """etcd v3 JSON gateway: key <prefix>/<service>/<id> bound to a lease with the TTL."""
+
+    name = "etcd"
+
+    def __init__(self, endpoint: str, prefix: str = "/gha-runners/services", username: Optional[str] = None, password: Optional[str] = None):
+        self.endpoint = endpoint.rstrip("/")
+        self.prefix = prefix.rstrip("/")
+        self.username = username
+        self.password = password
+        self.lease: Optional[str] = None
+
+    def _post(self, path: str, body: Dict[str, Any]) -> Dict[str, Any]:
+        headers = {}
+        if self.username:
+            auth = httpx.post(
+                f"{self.endpoint}/v3/auth/authenticate", timeout=5.0,
+                json={"name": self.username, "password": self.password or ""},
+            )
+            auth.raise_for_status()
+            headers["Authorization"] = auth.json()["token"]
+        response = httpx.post(f"{self.endpoint}{path}", json=body, headers=headers, timeout=5.0)
+        response.raise_for_status()
+        return response.json()
+
+    def key(self, service: Dict[str, Any]) -> str:
+        return f"{self.prefix}/{service['name']}/{service['id']}"
+
+    def register(self, service: Dict[str, Any], ttl: int):
+        self.lease = self._post("/v3/lease/grant", {"TTL": ttl})["ID"]
+        self._post("/v3/kv/put", {
+            "key": _b64(self.key(service)),
+            "value": _b64(json.dumps(service)),
+            "lease": self.lease,
+        })
+
+    def heartbeat(self, service: Dict[str, Any], ttl: int, healthy: bool, output: str) -> bool:
+        if self.lease is None:
+            return False
+        if not healthy:
+            # Withdraw the key; it is registered again once healthy
+            self.deregister(service)
+            return True
+        result = self._post("/v3/lease/keepalive", {"ID": self.lease}).get("result", {})
+        # An expired lease answers without TTL and must be registered again
+        return int(result.get("TTL", 0)) > 0
+
+    def deregister(self, service: Dict[str, Any]):
+        if self.lease is not None:
+            lease, self.lease = self.lease, None
+            self._post("/v3/lease/revoke", {"ID": lease})
+
+
+class ServiceRegistration:
+    """Registers on startup, renews the TTL from /healthz and deregisters on shutdown."""
+
+    def __init__(self, registry: Any, service: Dict[str, Any], ttl: int = 30):
+        self.registry = registry
+        self.service = service
+        self.ttl = ttl
+        self.registered = False
+        self.running = False
+        self.stop_event = threading.Event()
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.stop_event.clear()
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'CONFIG', 'Registro en descubrimiento de servicios',
+            f"{self.registry.name}: {self.service['id']} en {self.service['address']}:{self.service['port']} (TTL {self.ttl}s)"
+        ))
+
+    def stop(self):
+        self.running = False
+        self.stop_event.set()
+        if self.thread:
+            self.thread.join(timeout=5)
+        if self.registered:
+            try:
+                self.registry.deregister(self.service)
+                logger.info(format_log('SUCCESS', 'Servicio retirado del descubrimiento', self.service["id"]))
+            except httpx.HTTPError as e:
+                logger.warning(format_log('WARNING', 'No se pudo retirar el servicio del descubrimiento', str(e)))
+
+    def _check_health(self) -> Tuple[bool, str]:
+        """Same criterion as the image HEALTHCHECK: local GET /healthz answering 200."""
+        try:
+            response = httpx.get(f"http://127.0.0.1:{self.service['port']}/healthz", timeout=5.0)
+            return response.status_code == 200, f"/healthz {response.status_code}"
+        except httpx.HTTPError as e:
+            return False, f"/healthz inaccesible: {e}"
+
+    def _loop(self):
+        # Heartbeat at a third of the TTL so one missed beat is tolerated
+        interval = max(self.ttl / 3, 1)
+        while self.running:
+            healthy, output = self._check_health()
+            try:
+                if not self.registered or not self.registry.heartbeat(self.service, self.ttl, healthy, output):
+                    if healthy:
+                        self.registry.register(self.service, self.ttl)
+                        self.registry.heartbeat(self.service, self.ttl, healthy, output)
+                        if not self.registered:
+                            logger.info(format_log('SUCCESS', 'Servicio registrado', f"{self.registry.name} {self.service['id']}"))
+                        self.registered = True
+            except (httpx.HTTPError, KeyError, ValueError) as e:
+                logger.warning(format_log('WARNING', 'Error en el registro de descubrimiento', f"{self.registry.name}: {e}"))
+            self.stop_event.wait(interval)
+
+
+def create_service_registration() -> Optional[ServiceRegistration]:
+    """Registration for SERVICE_DISCOVERY_BACKEND (consul or etcd), or None when disabled."""
+    if not SERVICE_DISCOVERY_BACKEND:
+        return None
+    if SERVICE_DISCOVERY_BACKEND == "consul":
+        registry: Any = ConsulRegistry(CONSUL_HTTP_ADDR, CONSUL_HTTP_TOKEN, CONSUL_DEREGISTER_AFTER)
+    elif SERVICE_DISCOVERY_BACKEND == "etcd":
+        registry = EtcdRegistry(ETCD_ENDPOINT, SERVICE_DISCOVERY_PREFIX, ETCD_USERNAME, ETCD_PASSWORD)
+    else:
+        raise ValueError(f"SERVICE_DISCOVERY_BACKEND desconocido: {SERVICE_DISCOVERY_BACKEND} (consul o etcd)")
+
+    hostname = socket.gethostname()
+    service = {
+        "id": f"{SERVICE}-{hostname}",
+        "name": SERVICE,
+        "address": SERVICE_DISCOVERY_ADDRESS or hostname,
+        "port": API_GATEWAY_PORT,
+        "version": __version__,
+        "tags": [tag.strip() for tag in SERVICE_DISCOVERY_TAGS.split(",") if tag.strip()],
+    }
+    return ServiceRegistration(registry, service, SERVICE_DISCOVERY_TTL)
@@ -0,0 +1,222 @@
+"""
+API Gateway - Incidents
+Opens and resolves PagerDuty (Events API v2) or Opsgenie incidents for critical
+gateway conditions, currently a storm of invalid webhook signatures. Deduplication
+keys match the orchestrator's (gha-runners:<condition>[:<subject>]).
+"""
+
+import logging
+import queue
+import threading
+import time
+from collections import deque
+from typing import Any, Deque, Dict, List, Optional
+from urllib.parse import quote
+
+import httpx
+
+from src.config.settings import (
+    INCIDENTS_BACKEND, PAGERDUTY_ROUTING_KEY, OPSGENIE_API_KEY, OPSGENIE_API_URL,
+    INCIDENT_SIGNATURE_STORM_THRESHOLD, ABUSE_WINDOW_SECONDS
+)
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+DEDUP_PREFIX = "gha-runners"
+
+# PagerDuty severities and their Opsgenie priority
+OPSGENIE_PRIORITIES = {"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}
+
+
+def dedup_key(condition: str, subject: str = "") -> str:
+    return ":".join(part for part in (DEDUP_PREFIX, condition, subject) if part)
+
+
+class PagerDutyBackend:
+    """PagerDuty Events API v2; dedup_key ties trigger and resolve to one incident."""
+
+    name = "pagerduty"
+
+    def __init__(self, routing_key: str, url: str = "https://events.pagerduty.com/v2/enqueue"):
+        self.routing_key = routing_key
+        self.url = url
+
+    def send(self, action: str, incident: Dict[str, Any]):
+        body: Dict[str, Any] = {"routing_key": self.routing_key, "event_action": action, "dedup_key": incident["key"]}
+        if action == "trigger":
+            body["payload"] = {
+                "summary": incident["summary"],
+                "source": incident["source"],
+                "severity": incident["severity"],
+                "component": incident["condition"],
+                "custom_details": incident["details"],
+            }
+        httpx.post(self.url, json=body, timeout=10.0).raise_for_status()
+
+
+class OpsgenieBackend:
+    """Opsgenie Alert API; the alert alias is the deduplication key."""
+
+    name = "opsgenie"
+
+    def __init__(self, api_key: str, url: str = "https://api.opsgenie.com"):
+        self.api_key = api_key
+        self.url = url.rstrip("/")
+
+    def send(self, action: str, incident: Dict[str, Any]):
+        headers = {"Authorization": f"GenieKey {self.api_key}"}
+        if action == "trigger":
+            response = httpx.post(f"{self.url}/v2/alerts", headers=headers, timeout=10.0, json={
+                "message": incident["summary"][:130],
+                "alias": incident["key"],
+                "source": incident["source"],
+                "priority": OPSGENIE_PRIORITIES.get(incident["severity"], "P3"),
+                "tags": ["gha-ephemeral-runners", incident["condition"]],
+                "details": {key: str(value) for key, value in incident["details"].items()},
+            })
+        else:
+            response = httpx.post(
+                f"{self.url}/v2/alerts/{quote(incident['key'], safe='')}/close",
+                params={"identifierType": "alias"}, headers=headers, timeout=10.0,
+                json={"source": incident["source"]},
+            )
+        response.raise_for_status()
+
+
+class IncidentNotifier:
+    """
+    Open incidents with background delivery.
+
+    trigger() and resolve() only notify on state changes and never block the caller.
+    """
+
+    def __init__(self, backend: Optional[Any], source: str = "api-gateway"):
+        self.backend = backend
+        self.source = source
+        self.open: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self.queue: "queue.Queue[tuple]" = queue.Queue(maxsize=1000)
+
+        if self.backend:
+            threading.Thread(target=self._delivery_loop, daemon=True).start()
+            logger.info(format_log('CONFIG', 'Incidentes activados', f"{self.backend.name} ({self.source})"))
+
+    def trigger(self, condition: str, subject: str, summary: str, severity: str = "critical", **details: Any):
+        key = dedup_key(condition, subject)
+        with self.lock:
+            if key in self.open:
+                return
+            incident = {
+                "key": key, "condition": condition, "summary": summary, "severity": severity,
+                "source": self.source, "details": details, "opened_at": time.time(),
+            }
+            self.open[key] = incident
+        logger.error(format_log('ERROR', 'Incidente abierto', f"{key}: {summary}"))
+        metrics.incr("incidents.triggered", tags={"condition": condition})
+        self._enqueue("trigger", incident)
+
+    def resolve(self, condition: str, subject: str = ""):
+        key = dedup_key(condition, subject)
+        with self.lock:
+            incident = self.open.pop(key, None)
+        if incident is None:
+            return
+        logger.info(format_log('SUCCESS', 'Incidente resuelto', key))
+        metrics.incr("incidents.resolved", tags={"condition": condition})
+        self._enqueue("resolve", incident)
+
+    def list_open(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return [dict(incident) for incident in self.open.values()]
+
+    def _enqueue(self, action: str, incident: Dict[str, Any]):
+        if not self.backend:
+            return
+        try:
+            self.queue.put_nowait((action, incident))
+        except queue.Full:
+            metrics.incr("incidents.dropped")
+
+    def _delivery_loop(self):
+        while True:
+            action, incident = self.queue.get()
+            for attempt in range(3):
+                try:
+                    self.backend.send(action, incident)
+                    break
+                except httpx.HTTPError as e:
+                    error = str(e)
+                time.sleep(2 ** attempt)
+            else:
+                metrics.incr("incidents.failed")
+                logger.warning(format_log(
+                    'WARNING', 'No se pudo notificar incidente', f"{action} {incident['key']} en {self.backend.name}: {error}"
+                ))
+
+
+class SignatureStormDetector:
+    """
+    Counts invalid webhook signatures from all clients together.
+
+    Per-IP bans (AbuseDetector) miss distributed attacks and misconfigured secrets;
+    crossing the threshold within the window opens a signature-storm incident, which
+    is resolved once a full window passes below the threshold.
+    """
+
+    def __init__(self, notifier: IncidentNotifier, threshold: int, window: int):
+        self.notifier = notifier
+        self.threshold = threshold
+        self.window = window
+        self.failures: Deque[float] = deque()
+        self.lock = threading.Lock()
+
+        if self.notifier.backend:
+            threading.Thread(target=self._resolve_loop, daemon=True).start()
+
+    def _count(self, now: float) -> int:
+        while self.failures and self.failures[0] < now - self.window:
+            self.failures.popleft()
+        return len(self.failures)
+
+    def record(self, source: str):
+        """Record one invalid signature (source: github or slack)."""
+        now = time.time()
+        with self.lock:
+            self.failures.append(now)
+            count = self._count(now)
+        if count >= self.threshold:
+            self.notifier.trigger(
+                "signature-storm", "",
+                f"{count} firmas de webhook inválidas en {self.window}s",
+                last_source=source, failures=count, window_seconds=self.window,
+            )
+
+    def _resolve_loop(self):
+        while True:
+            time.sleep(self.window)
+            with self.lock:
+                count = self._count(time.time())
+            if count < self.threshold:
+                self.notifier.resolve("signature-storm")
+
+
+def create_incident_backend() -> Optional[Any]:
+    """Backend selected by INCIDENTS_BACKEND (pagerduty or opsgenie), or None when disabled."""
+    if not INCIDENTS_BACKEND:
+        return None
+    if INCIDENTS_BACKEND == "pagerduty":
+        if not PAGERDUTY_ROUTING_KEY:
+            raise ValueError("PAGERDUTY_ROUTING_KEY es obligatorio con INCIDENTS_BACKEND=pagerduty")
+        return PagerDutyBackend(PAGERDUTY_ROUTING_KEY)
+    if INCIDENTS_BACKEND == "opsgenie":
+        if not OPSGENIE_API_KEY:
+            raise ValueError("OPSGENIE_API_KEY es obligatorio con INCIDENTS_BACKEND=opsgenie")
+        return OpsgenieBackend(OPSGENIE_API_KEY, OPSGENIE_API_URL)
+    raise ValueError(f"INCIDENTS_BACKEND desconocido: {INCIDENTS_BACKEND} (pagerduty u opsgenie)")
+
+
+# Shared notifier for all gateway modules
+incidents = IncidentNotifier(create_incident_backend())
+signature_storm = SignatureStormDetector(incidents, INCIDENT_SIGNATURE_STORM_THRESHOLD, ABUSE_WINDOW_SECONDS)
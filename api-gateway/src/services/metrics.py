@@ -0,0 +1,119 @@
+"""
+API Gateway - Metrics
+Contains request latency and error metrics with optional StatsD/DogStatsD emission.
+"""
+
+import logging
+import socket
+import threading
+from typing import Dict, List, Optional
+
+from src.config.settings import (
+    STATSD_ENABLED, STATSD_HOST, STATSD_PORT, STATSD_PREFIX, STATSD_TAGS, STATSD_DOGSTATSD
+)
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+class StatsDSink:
+    """UDP StatsD emitter with DogStatsD tag support (mismo formato que orchestrator)."""
+
+    def __init__(
+        self,
+        host: str,
+        port: int,
+        prefix: str = "",
+        tags: Optional[Dict[str, str]] = None,
+        dogstatsd: bool = True,
+    ):
+        self.address = (host, port)
+        self.prefix = prefix.rstrip(".")
+        self.tags = tags or {}
+        self.dogstatsd = dogstatsd
+        self.socket = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+
+    def send(self, name: str, value: float, metric_type: str, tags: Optional[Dict[str, str]] = None):
+        """Send a metric. Network errors are never propagated."""
+        metric_name = f"{self.prefix}.{name}" if self.prefix else name
+        payload = f"{metric_name}:{value:g}|{metric_type}"
+
+        if self.dogstatsd:
+            all_tags = {**self.tags, **(tags or {})}
+            if all_tags:
+                payload += "|#" + ",".join(f"{k}:{v}" for k, v in sorted(all_tags.items()))
+
+        try:
+            self.socket.sendto(payload.encode("utf-8"), self.address)
+        except OSError as e:
+            logger.debug(f"Error enviando métrica {metric_name} a StatsD: {e}")
+
+
+class MetricsRegistry:
+    """In-memory metrics registry forwarding to configured sinks."""
+
+    def __init__(self):
+        self.sinks: List[StatsDSink] = []
+        self.counters: Dict[str, float] = {}
+        self.gauges: Dict[str, float] = {}
+        self.lock = threading.Lock()
+
+    def add_sink(self, sink: StatsDSink):
+        """Register an additional sink."""
+        self.sinks.append(sink)
+
+    def incr(self, name: str, value: float = 1, tags: Optional[Dict[str, str]] = None):
+        """Increment a counter."""
+        with self.lock:
+            self.counters[name] = self.counters.get(name, 0) + value
+        for sink in self.sinks:
+            sink.send(name, value, "c", tags)
+
+    def gauge(self, name: str, value: float, tags: Optional[Dict[str, str]] = None):
+        """Set a gauge value."""
+        with self.lock:
+            self.gauges[name] = value
+        for sink in self.sinks:
+            sink.send(name, value, "g", tags)
+
+    def timing(self, name: str, milliseconds: float, tags: Optional[Dict[str, str]] = None):
+        """Record a duration in milliseconds."""
+        for sink in self.sinks:
+            sink.send(name, milliseconds, "ms", tags)
+
+
+def parse_tags(raw_tags: str) -> Dict[str, str]:
+    """Parse 'env:prod,team:ci' into a tag dictionary."""
+    tags = {}
+    for item in raw_tags.split(","):
+        item = item.strip()
+        if not item:
+            continue
+        key, _, value = item.partition(":")
+        tags[key.strip()] = value.strip()
+    return tags
+
+
+def create_metrics_registry() -> MetricsRegistry:
+    """Create the metrics registry configured from settings."""
+    registry = MetricsRegistry()
+
+    if STATSD_ENABLED:
+        tags = parse_tags(STATSD_TAGS)
+        tags.setdefault("service", "api-gateway")
+        registry.add_sink(
+            StatsDSink(
+                host=STATSD_HOST,
+                port=STATSD_PORT,
+                prefix=STATSD_PREFIX,
+                tags=tags,
+                dogstatsd=STATSD_DOGSTATSD,
+            )
+        )
+        logger.info(format_log('CONFIG', 'StatsD activado', f'{STATSD_HOST}:{STATSD_PORT}'))
+
+    return registry
+
+
+# Shared registry for the gateway
+metrics = create_metrics_registry()
@@ -1,21 +1,60 @@
 import asyncio
 import logging
-from typing import Any, Dict, List
+import time
+from typing import Any, Dict, List, Optional, Tuple
 
 import httpx
 from fastapi import HTTPException
 
 from version import __version__
+from src.config.settings import (
+    ORCHESTRATOR_MAX_CONNECTIONS, ORCHESTRATOR_MAX_IDLE_CONNECTIONS, ORCHESTRATOR_IDLE_TIMEOUT,
+    ORCHESTRATOR_CONNECT_TIMEOUT
+)
+from src.services.datadog import datadog
+from src.services.metrics import metrics
+from src.services.sharding import HashRing, shard_key
+from src.services.usage import merge_reports
 from src.utils.helpers import format_log
 
 logger = logging.getLogger(__name__)
 
+# Client shared by every RequestRouter: a webhook burst reuses keep-alive connections
+# instead of opening (and leaving in TIME_WAIT) one connection per request
+_client: Optional[httpx.AsyncClient] = None
+
+
+def orchestrator_client() -> httpx.AsyncClient:
+    """Pooled client for the orchestrator, created on first use inside the event loop."""
+    global _client
+    if _client is None or _client.is_closed:
+        _client = httpx.AsyncClient(
+            limits=httpx.Limits(
+                max_connections=ORCHESTRATOR_MAX_CONNECTIONS,
+                max_keepalive_connections=ORCHESTRATOR_MAX_IDLE_CONNECTIONS,
+                keepalive_expiry=ORCHESTRATOR_IDLE_TIMEOUT,
+            ),
+            timeout=httpx.Timeout(30.0, connect=ORCHESTRATOR_CONNECT_TIMEOUT),
+        )
+    return _client
+
+
+async def close_orchestrator_client():
+    """Close the pooled connections on shutdown."""
+    global _client
+    if _client is not None:
+        await _client.aclose()
+        _client = None
+
 
 class RequestRouter:
-    def __init__(self, orchestrator_url: str, timeout: float = 30.0, headers: dict = None):
+    def __init__(self, orchestrator_url: str, timeout: float = 30.0, headers: dict = None, shards: Optional[Dict[str, str]] = None):
         self.orchestrator_url = orchestrator_url.rstrip("/")
         self.timeout = timeout
         self.max_retries = 3  # Hardcodeado
+        # Org sharding: runner creation goes to the orchestrator that owns the scope's owner
+        self.shards = shards or {}
+        self.ring = HashRing(list(self.shards)) if self.shards else None
 
         # Configurar headers base
         self.headers = headers or {
@@ -39,6 +78,7 @@ class RequestRouter:
                     logger.warning(format_log('WARNING', 'Intento fallido', f"{attempt + 1}/{self.max_retries} - reintentando en {backoff_time}s"))
                     await asyncio.sleep(backoff_time)
                 else:
+                    metrics.incr("gateway.orchestrator_unavailable")
                     logger.error(format_log('ERROR', 'Todos los intentos fallaron', f'después de {self.max_retries} reintentos'))
         
         # Si llegamos aquí, todos los intentos fallaron
@@ -62,26 +102,39 @@ class RequestRouter:
         Raises:
             HTTPException: Si hay error en la solicitud
         """
-        url = f"{self.orchestrator_url}{path}"
+        url = f"{kwargs.pop('base_url', None) or self.orchestrator_url}{path}"
 
         try:
-            async with httpx.AsyncClient(timeout=self.timeout) as client:
-                response = await client.request(method, url, headers=self.headers, **kwargs)
+            client = orchestrator_client()
+            start_time = time.monotonic()
+            # Span de cliente: el orchestrator continúa la traza con las cabeceras x-datadog-*
+            with datadog.tracer.span("orchestrator.request", resource=f"{method} {path}", span_type="http") as span:
+                headers = {**self.headers, **datadog.tracer.propagation_headers()}
+                timeout = httpx.Timeout(self.timeout, connect=ORCHESTRATOR_CONNECT_TIMEOUT)
+                response = await client.request(method, url, headers=headers, timeout=timeout, **kwargs)
+                span["meta"]["http.status_code"] = str(response.status_code)
+            metrics.timing(
+                "gateway.orchestrator_duration",
+                (time.monotonic() - start_time) * 1000,
+                tags={"method": method, "status": str(response.status_code)},
+            )
 
-                logger.info(format_log('INFO', 'Solicitud al orquestador', f"{method} {url} - Status: {response.status_code}"))
+            logger.info(format_log('INFO', 'Solicitud al orquestador', f"{method} {url} - Status: {response.status_code}"))
 
-                if response.status_code >= 400:
-                    error_detail = "Error del servidor"
-                    try:
-                        error_data = response.json()
-                        error_detail = error_data.get("detail", error_detail)
-                    except (ValueError, KeyError):
-                        pass
+            if response.status_code >= 400:
+                error_detail = "Error del servidor"
+                try:
+                    error_data = response.json()
+                    error_detail = error_data.get("detail", error_detail)
+                except (ValueError, KeyError):
+                    pass
 
-                    raise HTTPException(status_code=response.status_code, detail=error_detail)
+                raise HTTPException(status_code=response.status_code, detail=error_detail)
 
-                return response.json()
+            return response.json()
 
+        except HTTPException:
+            raise
         except httpx.TimeoutException:
             logger.error("Timeout del orquestador")
             raise HTTPException(status_code=504, detail="Timeout del orquestador")
@@ -92,6 +145,24 @@ class RequestRouter:
             logger.error(f"Error interno del gateway: {e}")
             raise HTTPException(status_code=500, detail="Error interno del gateway")
 
+    def shard_url(self, scope_name: str) -> str:
+        """Orchestrator that owns the scope (the default one without sharding)."""
+        if not self.ring:
+            return self.orchestrator_url
+        return self.shards[self.ring.owner(shard_key(scope_name))]
+
+    async def _first_shard(self, method: str, path: str, **kwargs) -> Dict[str, Any]:
+        """Runner operations by ID: the first shard that knows the runner answers."""
+        if not self.ring:
+            return await self.forward_request_with_retry(method, path, **kwargs)
+        last_error: Optional[HTTPException] = None
+        for name, url in self.shards.items():
+            try:
+                return await self.forward_request_with_retry(method, path, base_url=url, **kwargs)
+            except HTTPException as e:
+                last_error = e
+        raise last_error
+
     def validate_required_fields(self, request_data: Dict[str, Any]) -> None:
         """Valida campos obligatorios."""
         required_fields = ["scope", "scope_name"]
@@ -170,23 +241,366 @@ class RequestRouter:
     async def create_runner(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
         """Crea un runner a través del orchestrator con reintentos."""
         self.validate_runner_request(request_data)
-        return await self.forward_request_with_retry("POST", "/runners/create", json=request_data)
+        base_url = self.shard_url(request_data["scope_name"])
+        return await self.forward_request_with_retry("POST", "/runners/create", base_url=base_url, json=request_data)
+
+    async def complete_job(self, scope_name: str, job_id: str, runner_name: Optional[str] = None) -> Dict[str, Any]:
+        """Notifica un job completado o cancelado al shard que creó su runner."""
+        params = {"runner_name": runner_name} if runner_name else None
+        return await self.forward_request_with_retry(
+            "POST", f"/jobs/{job_id}/complete", base_url=self.shard_url(scope_name), params=params,
+        )
+
+    async def job_started(self, scope_name: str, job_id: str, runner_name: Optional[str] = None) -> Dict[str, Any]:
+        """Notifica que un job encolado pasó a ejecutarse en un runner."""
+        params = {"runner_name": runner_name} if runner_name else None
+        return await self.forward_request_with_retry(
+            "POST", f"/jobs/{job_id}/started", base_url=self.shard_url(scope_name), params=params,
+        )
+
+    async def get_orphaned_jobs(self) -> Dict[str, Any]:
+        """Jobs encolados sin runner más allá del umbral con reintentos."""
+        return await self.forward_request_with_retry("GET", "/jobs/orphaned")
 
     async def get_runner_status(self, runner_id: str) -> Dict[str, Any]:
         """Obtiene el estado de un runner con reintentos."""
-        return await self.forward_request_with_retry("GET", f"/runners/{runner_id}/status")
+        return await self._first_shard("GET", f"/runners/{runner_id}/status")
 
-    async def destroy_runner(self, runner_id: str) -> Dict[str, Any]:
+    async def destroy_runner(self, runner_id: str, dry_run: bool = False) -> Dict[str, Any]:
         """Destruye un runner con reintentos."""
-        return await self.forward_request_with_retry("DELETE", f"/runners/{runner_id}")
+        return await self._first_shard("DELETE", f"/runners/{runner_id}", params={"dry_run": dry_run})
 
     async def list_runners(self) -> Dict[str, Any]:
-        """Lista todos los runners activos con reintentos."""
-        return await self.forward_request_with_retry("GET", "/runners")
-
-    async def cleanup_runners(self) -> Dict[str, Any]:
+        """Lista todos los runners activos con reintentos (de todos los shards)."""
+        if not self.ring:
+            return await self.forward_request_with_retry("GET", "/runners")
+        results = await asyncio.gather(
+            *(self.forward_request_with_retry("GET", "/runners", base_url=url) for url in self.shards.values()),
+            return_exceptions=True,
+        )
+        runners = []
+        for name, result in zip(self.shards, results):
+            if isinstance(result, Exception):
+                # A shard down hides only its own runners
+                logger.warning(format_log('WARNING', f'Shard {name} no disponible al listar runners', str(result)))
+                continue
+            runners.extend(result)
+        if all(isinstance(result, Exception) for result in results):
+            raise results[0]
+        return runners
+
+    async def list_pools(self) -> Dict[str, Any]:
+        """Lista los pools de runners con reintentos."""
+        return await self.forward_request_with_retry("GET", "/pools")
+
+    async def list_pool_snapshots(self, pool: Optional[str] = None) -> Dict[str, Any]:
+        """Snapshots de pools del orchestrator."""
+        return await self.forward_request_with_retry("GET", "/pools/snapshots", params={"pool": pool} if pool else None)
+
+    async def retire_pool(self, name: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Retira un pool (en todos los shards, con el mismo id de snapshot)."""
+        return (await self._each_shard("POST", f"/pools/{name}/retire", json=request_data))[0]
+
+    async def restore_pool(self, name: str, restored_by: str) -> Dict[str, Any]:
+        """Vuelve a aceptar runners en un pool retirado (en todos los shards)."""
+        return (await self._each_shard("POST", f"/pools/{name}/restore", params={"restored_by": restored_by}))[0]
+
+    async def create_pool_snapshot(self, name: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Guarda un snapshot de un pool (el mismo id en todos los shards)."""
+        return (await self._each_shard("POST", f"/pools/{name}/snapshots", json=request_data))[0]
+
+    async def restore_pool_snapshot(self, snapshot_id: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Crea un pool desde un snapshot (en todos los shards)."""
+        return (await self._each_shard("POST", f"/pools/snapshots/{snapshot_id}/restore", json=request_data))[0]
+
+    @staticmethod
+    def _merge_bulk(shards: List[Tuple[Optional[str], Dict[str, Any]]]) -> Dict[str, Any]:
+        """Una operación masiva vista en todos los shards: progreso sumado e ítems de cada shard."""
+        merged = {**shards[0][1], "progress": {}}
+        statuses = set()
+        for shard, operation in shards:
+            statuses.add(operation["status"])
+            for field, value in operation["progress"].items():
+                merged["progress"][field] = merged["progress"].get(field, 0) + value
+            if "items" in operation:
+                merged.setdefault("shard_items", []).extend(
+                    {**item, "shard": shard} if shard else item for item in operation["items"]
+                )
+        if "shard_items" in merged:
+            merged["items"] = merged.pop("shard_items")
+        if statuses & {"pending", "running"}:
+            merged["status"] = "running"
+        else:
+            # Terminada en todos los shards: el mismo estado en todos o, si difiere, parcial
+            merged["status"] = statuses.pop() if len(statuses) == 1 else "partial"
+        merged["finished_at"] = None if merged["status"] in ("running", "pending") else max(
+            operation["finished_at"] or "" for _, operation in shards
+        )
+        return merged
+
+    async def _bulk_shards(self, method: str, path: str, **kwargs) -> List[Tuple[Optional[str], Any]]:
+        results = await self._each_shard(method, path, **kwargs)
+        names = list(self.shards) if self.ring else [None]
+        return [(name, result.get("data")) for name, result in zip(names, results)]
+
+    async def submit_bulk_operation(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Envía una operación masiva a todos los shards (con el mismo id); cada uno actúa sobre sus runners."""
+        return self._merge_bulk(await self._bulk_shards("POST", "/bulk", json=request_data))
+
+    async def list_bulk_operations(self, status: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Operaciones masivas de todos los shards, agrupadas por id."""
+        grouped: Dict[str, List[Tuple[Optional[str], Dict[str, Any]]]] = {}
+        for name, operations in await self._bulk_shards("GET", "/bulk"):
+            for operation in operations or []:
+                grouped.setdefault(operation["id"], []).append((name, operation))
+        operations = [self._merge_bulk(shards) for shards in grouped.values()]
+        if status:
+            operations = [operation for operation in operations if operation["status"] == status]
+        return sorted(operations, key=lambda operation: operation["submitted_at"], reverse=True)
+
+    async def get_bulk_operation(self, operation_id: str, items: bool = False) -> Dict[str, Any]:
+        """Estado de una operación masiva (con items, el resultado de cada ítem en cada shard)."""
+        path = f"/bulk/{operation_id}/items" if items else f"/bulk/{operation_id}"
+        return self._merge_bulk(await self._bulk_shards("GET", path))
+
+    async def submit_image_build(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Lanza una construcción de imagen en el orchestrator por defecto (construye y despliega una sola vez)."""
+        return await self.forward_request("POST", "/images/builds", json=request_data)
+
+    async def list_image_builds(self, name: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Construcciones de imagen con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/images/builds", params={"name": name} if name else None)
+        return result.get("data") or []
+
+    async def get_image_build(self, build_id: str) -> Dict[str, Any]:
+        """Construcción de imagen con su Dockerfile y log, con reintentos."""
+        return await self.forward_request_with_retry("GET", f"/images/builds/{build_id}")
+
+    async def list_image_rollouts(self, pool: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Despliegues de imagen con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/images/rollouts", params={"pool": pool} if pool else None)
+        return result.get("data") or []
+
+    async def start_image_rollout(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Despliega en un pool la imagen de una construcción terminada."""
+        return await self.forward_request("POST", "/images/rollouts", json=request_data)
+
+    async def rollback_image_rollout(self, pool: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Revierte el despliegue de imagen de un pool."""
+        return await self.forward_request("POST", f"/images/rollouts/{pool}/rollback", json=request_data)
+
+    async def list_cutovers(self, status: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Cambios blue/green con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/cutovers", params={"status": status} if status else None)
+        return result.get("data") or []
+
+    async def get_cutover(self, cutover_id: str) -> Dict[str, Any]:
+        """Cambio blue/green con reintentos."""
+        return await self.forward_request_with_retry("GET", f"/cutovers/{cutover_id}")
+
+    async def start_cutover(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Inicia un cambio blue/green de un conjunto de pools."""
+        return await self.forward_request("POST", "/cutovers", json=request_data)
+
+    async def rollback_cutover(self, cutover_id: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Revierte un cambio blue/green."""
+        return await self.forward_request("POST", f"/cutovers/{cutover_id}/rollback", json=request_data)
+
+    async def list_docker_hosts(self) -> List[Dict[str, Any]]:
+        """Hosts Docker del backend docker con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/docker-hosts")
+        return result.get("data") or []
+
+    async def drain_docker_host(self, name: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Vacía un host Docker para mantenimiento."""
+        return await self.forward_request("POST", f"/docker-hosts/{name}/drain", json=request_data)
+
+    async def undrain_docker_host(self, name: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Devuelve un host Docker vaciado al servicio."""
+        return await self.forward_request("POST", f"/docker-hosts/{name}/undrain", json=request_data)
+
+    async def list_resource_classes(self) -> List[Dict[str, Any]]:
+        """Clases de recursos con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/resource-classes")
+        return result.get("data") or []
+
+    async def list_regions(self) -> List[Dict[str, Any]]:
+        """Regiones de los pools multi-región con reintentos."""
+        result = await self.forward_request_with_retry("GET", "/regions")
+        return result.get("data") or []
+
+    async def get_pool_drift(self) -> Dict[str, Any]:
+        """Estado de la reconciliación GitOps de pools con reintentos."""
+        return await self.forward_request_with_retry("GET", "/pools/drift")
+
+    async def get_reconcile_status(self) -> Dict[str, Any]:
+        """Drift de la última reconciliación de runners con reintentos."""
+        return await self.forward_request_with_retry("GET", "/reconcile")
+
+    async def reconcile(self, dry_run: Optional[bool] = None) -> Dict[str, Any]:
+        """Ejecuta una reconciliación de runners en el orchestrator."""
+        params = {"dry_run": dry_run} if dry_run is not None else None
+        return await self.forward_request("POST", "/reconcile", params=params)
+
+    async def get_queue_status(self) -> Dict[str, Any]:
+        """Estado de la cola de trabajo del orchestrator con reintentos."""
+        return await self.forward_request_with_retry("GET", "/queue")
+
+    async def reload_configuration(self) -> Dict[str, Any]:
+        """Recarga pools del orchestrator sin reiniciar."""
+        return await self.forward_request("POST", "/config/reload")
+
+    async def list_feature_flags(self, scope_name: Optional[str] = None) -> Dict[str, Any]:
+        """Feature flags del orchestrator, evaluadas para scope_name si se indica."""
+        params = {"scope_name": scope_name} if scope_name else None
+        return await self.forward_request_with_retry("GET", "/config/flags", params=params)
+
+    async def list_policies(self) -> Dict[str, Any]:
+        """Reglas de rechazo de jobs del orchestrator."""
+        return await self.forward_request_with_retry("GET", "/config/policies")
+
+    async def export_state(self) -> Dict[str, Any]:
+        """Snapshot del estado del orchestrator."""
+        return await self.forward_request("GET", "/state/export")
+
+    async def import_state(self, snapshot: Dict[str, Any], dry_run: bool = False, apply_pools: bool = False) -> Dict[str, Any]:
+        """Importa un snapshot en el orchestrator."""
+        return await self.forward_request(
+            "POST", "/state/import", json=snapshot, params={"dry_run": dry_run, "apply_pools": apply_pools}
+        )
+
+    async def run_diagnostics(self) -> Dict[str, Any]:
+        """Runs the orchestrator diagnostics (credentials, Docker, images, clock)."""
+        return await self.forward_request("GET", "/config/doctor")
+
+    async def _each_shard(self, method: str, path: str, **kwargs) -> List[Dict[str, Any]]:
+        """Tenant, usage and budget operations: every shard keeps the tenant registry, budgets and the usage of its own runners."""
+        if not self.ring:
+            return [await self.forward_request(method, path, **kwargs)]
+        return [await self.forward_request(method, path, base_url=url, **kwargs) for url in self.shards.values()]
+
+    async def list_tenants(self) -> List[Dict[str, Any]]:
+        """Tenants with their active runners added up across shards."""
+        tenants: Dict[str, Dict[str, Any]] = {}
+        for result in await self._each_shard("GET", "/tenants"):
+            for tenant in result.get("data") or []:
+                if tenant["name"] in tenants:
+                    tenants[tenant["name"]]["usage"]["active_runners"] += tenant["usage"]["active_runners"]
+                else:
+                    tenants[tenant["name"]] = tenant
+        return list(tenants.values())
+
+    async def get_tenant(self, name: str) -> Dict[str, Any]:
+        """A tenant with its active runners added up across shards."""
+        tenant = None
+        for result in await self._each_shard("GET", f"/tenants/{name}"):
+            if tenant is None:
+                tenant = result["data"]
+            else:
+                tenant["usage"]["active_runners"] += result["data"]["usage"]["active_runners"]
+        return tenant
+
+    async def onboard_tenant(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Da de alta un tenant en el orchestrator (en todos los shards)."""
+        return (await self._each_shard("POST", "/tenants", json=request_data))[0]
+
+    async def offboard_tenant(self, name: str) -> Dict[str, Any]:
+        """Da de baja un tenant en el orchestrator (en todos los shards)."""
+        return (await self._each_shard("DELETE", f"/tenants/{name}"))[0]
+
+    async def list_budgets(self) -> List[Dict[str, Any]]:
+        """Budget caps with spend and projection added up across shards."""
+        budgets: Dict[str, Dict[str, Any]] = {}
+        for result in await self._each_shard("GET", "/budgets"):
+            for entry in result.get("data") or []:
+                key = f"{entry['kind']}:{entry['name']}"
+                if key not in budgets:
+                    budgets[key] = entry
+                    continue
+                merged = budgets[key]
+                for field in ("spend", "projected"):
+                    merged[field] = round(merged[field] + entry[field], 4)
+                merged["ratio"] = round(merged["projected"] / merged["monthly"], 4)
+                # Congelado en cualquier shard: congelado
+                if entry["state"] == "frozen" or (entry["state"] == "warning" and merged["state"] == "ok"):
+                    merged["state"] = entry["state"]
+        return list(budgets.values())
+
+    async def get_forecast(self, pool: Optional[str] = None) -> Dict[str, Any]:
+        """Demand forecast added up across shards (each shard forecasts from the jobs its runners ran)."""
+        params = {"pool": pool} if pool else None
+        results = [result.get("data") or {} for result in await self._each_shard("GET", "/forecast", params=params)]
+        merged = {**results[0], "pools": []}
+        pools: Dict[str, Dict[str, Any]] = {}
+        for result in results:
+            for entry in result.get("pools", []):
+                target = pools.setdefault(entry["pool"], {**entry, "hours": {}, "last_scale": []})
+                target["weeks"] = max(target["weeks"], entry["weeks"])
+                if entry.get("last_scale"):
+                    target["last_scale"].append(entry["last_scale"])
+                for hour in entry["hours"]:
+                    key = (hour["day"], hour["hour"])
+                    current = target["hours"].setdefault(key, {"day": hour["day"], "hour": hour["hour"], "expected": 0, "peak": 0, "jobs": 0})
+                    for field in ("expected", "peak", "jobs"):
+                        current[field] = round(current[field] + hour[field], 2)
+        days = ("mon", "tue", "wed", "thu", "fri", "sat", "sun")
+        for _, entry in sorted(pools.items()):
+            entry["hours"] = sorted(entry["hours"].values(), key=lambda hour: (days.index(hour["day"]), hour["hour"]))
+            merged["pools"].append(entry)
+        return merged
+
+    async def set_budget(self, kind: str, name: str, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Fija un tope de gasto en el orchestrator (en todos los shards)."""
+        return (await self._each_shard("PUT", f"/budgets/{kind}/{name}", json=request_data))[0]
+
+    async def remove_budget(self, kind: str, name: str) -> Dict[str, Any]:
+        """Elimina un tope de gasto en el orchestrator (en todos los shards)."""
+        return (await self._each_shard("DELETE", f"/budgets/{kind}/{name}"))[0]
+
+    async def create_budget_override(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Crea un token de excepción (el mismo token e id en todos los shards)."""
+        return (await self._each_shard("POST", "/budgets/overrides", json=request_data))[0]
+
+    async def revoke_budget_override(self, override_id: str) -> Dict[str, Any]:
+        """Revoca un token de excepción en el orchestrator (en todos los shards)."""
+        return (await self._each_shard("DELETE", f"/budgets/overrides/{override_id}"))[0]
+
+    async def get_usage_report(self, month: Optional[str] = None, tenant: Optional[str] = None) -> Dict[str, Any]:
+        """Informe de uso mensual sumado entre shards."""
+        params = {key: value for key, value in {"month": month, "tenant": tenant}.items() if value}
+        return merge_reports([result["data"] for result in await self._each_shard("GET", "/usage/report", params=params)])
+
+    async def list_cost_anomalies(self) -> Dict[str, Any]:
+        """Anomalías de gasto de todos los shards (cada uno vigila los runners que aloja)."""
+        anomalies: Dict[str, List[Dict[str, Any]]] = {"active": [], "recent": []}
+        for result in await self._each_shard("GET", "/usage/anomalies"):
+            for field in anomalies:
+                anomalies[field].extend((result.get("data") or {}).get(field, []))
+        return anomalies
+
+    async def list_outbound_webhooks(self) -> Dict[str, Any]:
+        """Webhooks salientes registrados en el orchestrator."""
+        return await self.forward_request_with_retry("GET", "/webhooks/outbound")
+
+    async def register_outbound_webhook(self, request_data: Dict[str, Any]) -> Dict[str, Any]:
+        """Registra un webhook saliente."""
+        return await self.forward_request("POST", "/webhooks/outbound", json=request_data)
+
+    async def remove_outbound_webhook(self, webhook_id: str) -> Dict[str, Any]:
+        """Elimina un webhook saliente."""
+        return await self.forward_request("DELETE", f"/webhooks/outbound/{webhook_id}")
+
+    async def get_outbound_webhook_deliveries(self, webhook_id: str) -> Dict[str, Any]:
+        """Historial de entregas de un webhook saliente."""
+        return await self.forward_request_with_retry("GET", f"/webhooks/outbound/{webhook_id}/deliveries")
+
+    async def ping_outbound_webhook(self, webhook_id: str) -> Dict[str, Any]:
+        """Envía un evento de prueba a un webhook saliente."""
+        return await self.forward_request("POST", f"/webhooks/outbound/{webhook_id}/ping")
+
+    async def cleanup_runners(self, dry_run: bool = False) -> Dict[str, Any]:
         """Limpia runners inactivos con reintentos."""
-        return await self.forward_request_with_retry("POST", "/runners/cleanup")
+        return await self.forward_request_with_retry("POST", "/runners/cleanup", params={"dry_run": dry_run})
 
     async def get_health(self) -> Dict[str, Any]:
         """Verifica salud del servicio con reintentos."""
@@ -0,0 +1,88 @@
+"""
+API Gateway - Security Events
+Sends structured security events (webhook signature failures, authentication failures)
+to a SIEM webhook, separate from operational logs.
+"""
+
+import datetime
+import logging
+import queue
+import threading
+import time
+from typing import Any, Dict, Optional
+
+import httpx
+
+from src.config.settings import SECURITY_EVENTS_WEBHOOK_URL, SECURITY_EVENTS_WEBHOOK_TOKEN
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+class SecurityEventEmitter:
+    """
+    Security event queue with background delivery.
+
+    Delivery never blocks or fails the operation that raised the event; when the
+    queue is full events are dropped and counted in metrics.
+    """
+
+    def __init__(self, url: Optional[str], token: Optional[str] = None, service: str = "api-gateway"):
+        self.url = url
+        self.token = token
+        self.service = service
+        self.queue: "queue.Queue[Dict[str, Any]]" = queue.Queue(maxsize=1000)
+        self.timeout = 10.0
+
+        if self.url:
+            threading.Thread(target=self._delivery_loop, daemon=True).start()
+            logger.info(format_log('CONFIG', 'Webhook de eventos de seguridad activado'))
+
+    def emit(self, event_type: str, severity: str = "warning", **details: Any):
+        """
+        Record a security event.
+
+        Args:
+            event_type: Event type (e.g. webhook.signature_invalid)
+            severity: info, warning or critical
+            details: Event specific fields
+        """
+        metrics.incr("security.events", tags={"type": event_type})
+        if not self.url:
+            return
+
+        event = {
+            "event_type": event_type,
+            "severity": severity,
+            "service": self.service,
+            "timestamp": datetime.datetime.utcnow().isoformat() + "Z",
+            "details": details,
+        }
+        try:
+            self.queue.put_nowait(event)
+        except queue.Full:
+            metrics.incr("security.events_dropped")
+
+    def _delivery_loop(self):
+        headers = {"Content-Type": "application/json"}
+        if self.token:
+            headers["Authorization"] = f"Bearer {self.token}"
+
+        while True:
+            event = self.queue.get()
+            for attempt in range(3):
+                try:
+                    response = httpx.post(self.url, json=event, headers=headers, timeout=self.timeout)
+                    if response.status_code < 300:
+                        break
+                except httpx.HTTPError:
+                    pass
+                time.sleep(2 ** attempt)
+            else:
+                metrics.incr("security.events_failed")
+                logger.warning(format_log('WARNING', 'No se pudo entregar evento de seguridad', event["event_type"]))
+
+
+# Shared emitter for all gateway modules
+security_events = SecurityEventEmitter(SECURITY_EVENTS_WEBHOOK_URL, SECURITY_EVENTS_WEBHOOK_TOKEN)
@@ -0,0 +1,52 @@
+"""
+API Gateway - Org Sharding
+With ORCHESTRATOR_SHARDS, each orchestrator owns a shard of the GitHub owners
+(organizations and users). Owners are placed on a consistent hash ring, so adding
+or removing a shard only moves the owners of that shard. The ring must match the
+orchestrators' SHARDS list: same names, same hash, same virtual nodes.
+"""
+
+import bisect
+import hashlib
+from typing import Dict, List
+
+# Virtual nodes per shard: spreads owners evenly across a handful of shards
+RING_REPLICAS = 128
+
+
+def _hash(value: str) -> int:
+    return int.from_bytes(hashlib.sha256(value.encode("utf-8")).digest()[:8], "big")
+
+
+def shard_key(scope_name: str) -> str:
+    """Owner of a scope ('Org/repo' or 'Org' -> 'org'): every repo of an owner lands on the same shard."""
+    return scope_name.split("/", 1)[0].strip().lower()
+
+
+class HashRing:
+    """Consistent hash ring over shard names."""
+
+    def __init__(self, shards: List[str], replicas: int = RING_REPLICAS):
+        if not shards:
+            raise ValueError("El anillo de shards necesita al menos un shard")
+        self.shards = list(shards)
+        self.ring = sorted((_hash(f"{shard}#{index}"), shard) for shard in shards for index in range(replicas))
+        self.points = [point for point, _ in self.ring]
+
+    def owner(self, key: str) -> str:
+        """Shard that owns the key: first ring point clockwise from its hash."""
+        index = bisect.bisect(self.points, _hash(key)) % len(self.points)
+        return self.ring[index][1]
+
+
+def parse_shards(value: str) -> Dict[str, str]:
+    """ORCHESTRATOR_SHARDS: shard-a=http://orchestrator-a:8000,shard-b=http://orchestrator-b:8000."""
+    shards = {}
+    for item in value.split(","):
+        if not item.strip():
+            continue
+        name, sep, url = item.partition("=")
+        if not sep or not name.strip() or not url.strip():
+            raise ValueError(f"ORCHESTRATOR_SHARDS inválido: '{item.strip()}' (nombre=url)")
+        shards[name.strip()] = url.strip().rstrip("/")
+    return shards
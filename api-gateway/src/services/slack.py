@@ -0,0 +1,162 @@
+"""
+API Gateway - Slack Slash Commands
+Handles `/runners status|scale|drain` from a Slack app. Requests are verified with
+the Slack signing secret and each Slack user is mapped to a gateway role, so the
+same RBAC as the admin API applies.
+"""
+
+import asyncio
+import hashlib
+import hmac
+import logging
+import time
+from typing import Any, Dict, List, Optional
+
+import httpx
+from fastapi import HTTPException
+
+from src.config.settings import WEBHOOK_CLOCK_SKEW
+from src.middleware.auth import ROLES, Principal
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+# Slack rejects replays older than five minutes; so do we (WEBHOOK_CLOCK_SKEW)
+MAX_TIMESTAMP_SKEW = WEBHOOK_CLOCK_SKEW
+
+USAGE = (
+    "Uso:\n"
+    "• `/runners status` - pools y runners activos\n"
+    "• `/runners scale <pool> <n> <owner/repo|org>` - crear n runners (1-10)\n"
+    "• `/runners drain <pool>` - destruir los runners del pool"
+)
+
+
+def verify_slack_signature(secret: str, timestamp: str, body: bytes, signature: Optional[str], now: Optional[float] = None) -> bool:
+    """Check X-Slack-Signature (v0=HMAC-SHA256 of 'v0:<timestamp>:<body>') and the timestamp window."""
+    if not signature or not timestamp:
+        return False
+    try:
+        skew = (now or time.time()) - int(timestamp)
+    except ValueError:
+        return False
+    metrics.gauge("webhooks.clock_skew", abs(skew), tags={"source": "slack"})
+    if abs(skew) > MAX_TIMESTAMP_SKEW:
+        return False
+    base = b"v0:" + timestamp.encode() + b":" + body
+    expected = "v0=" + hmac.new(secret.encode("utf-8"), base, hashlib.sha256).hexdigest()
+    return hmac.compare_digest(expected, signature)
+
+
+def parse_user_roles(raw: str) -> Dict[str, str]:
+    """SLACK_USER_ROLES=U012AB=admin,U034CD=operator -> {user_id: role}."""
+    roles = {}
+    for item in raw.split(","):
+        user, _, role = item.strip().partition("=")
+        if user and role:
+            if role not in ROLES:
+                raise ValueError(f"Rol de Slack inválido para {user}: {role} (válidos: {', '.join(ROLES)})")
+            roles[user] = role
+    return roles
+
+
+def runner_pool(runner: Dict[str, Any]) -> str:
+    return (runner.get("labels") or {}).get("runner-pool", "default")
+
+
+class SlackCommandHandler:
+    """Runs slash commands against the orchestrator with the role mapped to the Slack user."""
+
+    def __init__(self, request_router, user_roles: Dict[str, str], default_role: Optional[str] = None):
+        self.request_router = request_router
+        self.user_roles = user_roles
+        self.default_role = default_role if default_role in ROLES else None
+
+    def principal(self, user_id: str, user_name: str) -> Optional[Principal]:
+        role = self.user_roles.get(user_id, self.default_role)
+        return Principal(f"slack:{user_name or user_id}", role, "slack") if role else None
+
+    async def handle(self, form: Dict[str, str]) -> Dict[str, Any]:
+        """Return the immediate Slack response; slow commands finish through response_url."""
+        principal = self.principal(form.get("user_id", ""), form.get("user_name", ""))
+        if principal is None:
+            return self._reply("No tienes un rol asignado para operar runners (SLACK_USER_ROLES).")
+
+        args = form.get("text", "").split()
+        command = args[0].lower() if args else "help"
+        logger.info(format_log('INFO', 'Comando de Slack', f"{form.get('command', '/runners')} {' '.join(args)} por {principal.name}"))
+
+        if command == "status":
+            if not principal.has_role("viewer"):
+                return self._reply("Se requiere rol viewer.")
+            return self._reply(await self._status(), public=True)
+
+        if command in ("scale", "drain"):
+            if not principal.has_role("operator"):
+                return self._reply(f"`{command}` requiere rol operator.")
+            if command == "scale" and len(args) != 4 or command == "drain" and len(args) != 2:
+                return self._reply(USAGE)
+            work = self._scale(args[1], args[2], args[3]) if command == "scale" else self._drain(args[1])
+            asyncio.create_task(self._finish(form.get("response_url"), work, principal))
+            return self._reply(f"`{' '.join(args)}` en curso...")
+
+        return self._reply(USAGE)
+
+    @staticmethod
+    def _reply(text: str, public: bool = False) -> Dict[str, Any]:
+        return {"response_type": "in_channel" if public else "ephemeral", "text": text}
+
+    async def _finish(self, response_url: Optional[str], work, principal: Principal):
+        """Await a slow command and post its result to the command's response_url."""
+        try:
+            text = await work
+        except HTTPException as e:
+            text = f"Error: {e.detail}"
+        except Exception as e:
+            logger.error(f"Error en comando de Slack: {e}")
+            text = "Error interno del gateway"
+        logger.info(format_log('INFO', 'Comando de Slack completado', f"{principal.name}: {text.splitlines()[0]}"))
+        if not response_url:
+            return
+        try:
+            async with httpx.AsyncClient(timeout=10.0) as client:
+                await client.post(response_url, json={"response_type": "in_channel", "text": text})
+        except httpx.HTTPError as e:
+            logger.warning(format_log('WARNING', 'No se pudo responder a Slack', str(e)))
+
+    async def _status(self) -> str:
+        pools = (await self.request_router.list_pools()).get("data", [])
+        runners: List[Dict[str, Any]] = await self.request_router.list_runners()
+        lines = [f"*{len(runners)} runners activos*"]
+        for pool in pools:
+            members = [runner for runner in runners if runner_pool(runner) == pool["name"]]
+            running = sum(1 for runner in members if runner.get("status") == "running")
+            lines.append(f"• `{pool['name']}`: {running} corriendo, {len(members) - running} detenidos")
+        return "\n".join(lines)
+
+    async def _scale(self, pool: str, count: str, scope_name: str) -> str:
+        try:
+            request = {
+                "scope": "repo" if "/" in scope_name else "org",
+                "scope_name": scope_name,
+                "count": int(count),
+                "pool": pool,
+            }
+        except ValueError:
+            return f"Número de runners inválido: {count}"
+        runners = await self.request_router.create_runner(request)
+        return f"{len(runners)} runners solicitados en `{pool}` para {scope_name}: " + ", ".join(
+            f"{runner['runner_id']} ({runner['status']})" for runner in runners
+        )
+
+    async def _drain(self, pool: str) -> str:
+        runners = [runner for runner in await self.request_router.list_runners() if runner_pool(runner) == pool]
+        failed = []
+        for runner in runners:
+            try:
+                await self.request_router.destroy_runner(runner["runner_id"])
+            except HTTPException as e:
+                failed.append(f"{runner['runner_id']}: {e.detail}")
+        text = f"Pool `{pool}` drenado: {len(runners) - len(failed)}/{len(runners)} runners destruidos"
+        return text + ("\n" + "\n".join(failed) if failed else "")
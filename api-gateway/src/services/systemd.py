@@ -0,0 +1,107 @@
+"""
+API Gateway - systemd Integration
+Readiness and watchdog for Type=notify units on bare-metal hosts. systemd sets
+NOTIFY_SOCKET and, with WatchdogSec= in the unit, WATCHDOG_USEC. The gateway sends
+READY=1 the first time its local /healthz answers 200, the same criterion as the image
+HEALTHCHECK and the service discovery heartbeat, then WATCHDOG=1 at half the watchdog
+interval while /healthz stays healthy: when it stops being healthy, or the process hangs,
+systemd restarts it according to Restart=. STATUS= shows the last result in
+systemctl status, and STOPPING=1 is sent on shutdown.
+"""
+
+import logging
+import os
+import socket
+import threading
+from typing import Optional, Tuple
+
+import httpx
+
+from src.config.settings import API_GATEWAY_PORT, SYSTEMD_HEALTH_INTERVAL
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+class SystemdNotifier:
+    """sd_notify readiness, watchdog and status notifications driven by /healthz."""
+
+    def __init__(self, address: str, port: int, watchdog_usec: int = 0, interval: float = 10):
+        # A name starting with @ is a Linux abstract namespace socket
+        self.address = "\0" + address[1:] if address.startswith("@") else address
+        self.port = port
+        self.watchdog = watchdog_usec / 1_000_000
+        # Half the watchdog interval, as sd_watchdog_enabled(3) recommends
+        self.interval = self.watchdog / 2 if self.watchdog else interval
+        self.ready = False
+        self.healthy: Optional[bool] = None
+        self.running = False
+        self.stop_event = threading.Event()
+        self.thread: Optional[threading.Thread] = None
+
+    def notify(self, *fields: str) -> bool:
+        try:
+            with socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM | socket.SOCK_CLOEXEC) as sock:
+                sock.sendto("\n".join(fields).encode(), self.address)
+            return True
+        except OSError as e:
+            logger.warning(format_log('WARNING', 'No se pudo notificar a systemd', str(e)))
+            return False
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.stop_event.clear()
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        watchdog = f"watchdog {self.watchdog:g}s" if self.watchdog else "sin watchdog"
+        logger.info(format_log('CONFIG', 'Notificaciones a systemd', f"READY al pasar /healthz, {watchdog}"))
+
+    def stop(self):
+        self.running = False
+        self.stop_event.set()
+        if self.thread:
+            self.thread.join(timeout=5)
+        self.notify("STOPPING=1", "STATUS=Deteniendo")
+
+    def _check_health(self) -> Tuple[bool, str]:
+        """Same criterion as the image HEALTHCHECK: local GET /healthz answering 200."""
+        try:
+            response = httpx.get(f"http://127.0.0.1:{self.port}/healthz", timeout=min(5.0, self.interval))
+            return response.status_code == 200, f"/healthz {response.status_code}"
+        except httpx.HTTPError as e:
+            return False, f"/healthz inaccesible: {e}"
+
+    def _loop(self):
+        while self.running:
+            healthy, output = self._check_health()
+            fields = [f"STATUS={'Sano' if healthy else 'No sano'}: {output}"[:200]]
+            if healthy and not self.ready:
+                fields.append("READY=1")
+            # Without a ping, systemd restarts the service once WatchdogSec runs out
+            if healthy and self.watchdog:
+                fields.append("WATCHDOG=1")
+            if self.notify(*fields) and healthy and not self.ready:
+                self.ready = True
+                logger.info(format_log('SUCCESS', 'Servicio listo notificado a systemd'))
+            if self.ready and healthy != self.healthy:
+                if not healthy:
+                    logger.warning(format_log('WARNING', 'Servicio no sano, sin latido al watchdog de systemd', output))
+                elif self.healthy is False:
+                    logger.info(format_log('SUCCESS', 'Servicio sano de nuevo', "latido al watchdog de systemd reanudado"))
+            self.healthy = healthy
+            self.stop_event.wait(self.interval)
+
+
+def create_systemd_notifier() -> Optional[SystemdNotifier]:
+    """Notifier when running in a Type=notify unit (NOTIFY_SOCKET), or None."""
+    address = os.getenv("NOTIFY_SOCKET", "")
+    if not address:
+        return None
+    watchdog_usec = int(os.getenv("WATCHDOG_USEC", "0") or 0)
+    # WATCHDOG_PID names the process the watchdog is meant for (not its children)
+    watchdog_pid = os.getenv("WATCHDOG_PID")
+    if watchdog_pid and watchdog_pid != str(os.getpid()):
+        watchdog_usec = 0
+    return SystemdNotifier(address, API_GATEWAY_PORT, watchdog_usec, SYSTEMD_HEALTH_INTERVAL)
@@ -0,0 +1,58 @@
+"""
+API Gateway - Tenant Directory
+Maps GitHub owners to the tenant that onboarded them, so the gateway can scope
+API credentials and tenant webhook secrets without asking the orchestrator on
+every request.
+"""
+
+import asyncio
+import logging
+import time
+from typing import Dict, Optional
+
+from fastapi import HTTPException
+
+from src.services.sharding import shard_key
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+class TenantDirectory:
+    """Owner -> tenant map read from the orchestrator and cached for ttl seconds."""
+
+    def __init__(self, request_router, ttl: int = 60):
+        self.request_router = request_router
+        self.ttl = ttl
+        self.owners: Optional[Dict[str, str]] = None
+        self.loaded_at = 0.0
+        self.lock = asyncio.Lock()
+
+    def invalidate(self):
+        """Forget the cached map (after onboarding or offboarding a tenant)."""
+        self.loaded_at = 0.0
+
+    async def _load(self) -> Dict[str, str]:
+        async with self.lock:
+            if self.owners is not None and time.monotonic() - self.loaded_at < self.ttl:
+                return self.owners
+            try:
+                tenants = await self.request_router.list_tenants()
+            except HTTPException as e:
+                if e.status_code == 400:
+                    # Tenants disabled in the orchestrator (no TENANTS_FILE)
+                    tenants = []
+                elif self.owners is not None:
+                    logger.warning(format_log('WARNING', 'Directorio de tenants no actualizado, se usa el anterior', str(e.detail)))
+                    return self.owners
+                else:
+                    raise HTTPException(status_code=503, detail="Directorio de tenants no disponible")
+            self.owners = {
+                owner.lower(): tenant["name"] for tenant in tenants for owner in tenant.get("owners", [])
+            }
+            self.loaded_at = time.monotonic()
+            return self.owners
+
+    async def tenant_for(self, scope_name: str) -> Optional[str]:
+        """Tenant that owns a scope ('Org/repo' or 'Org'), None for non-tenant owners."""
+        return (await self._load()).get(shard_key(scope_name))
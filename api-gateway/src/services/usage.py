@@ -0,0 +1,60 @@
+"""
+API Gateway - Usage Reports
+Merges the monthly usage reports of every orchestrator shard and renders them as CSV
+for chargeback, keeping only the tenants the caller can see.
+"""
+
+import csv
+import io
+from typing import Any, Dict, Iterable, List
+
+FIELDS = ("runners", "runner_minutes", "jobs", "jobs_failed", "cost")
+
+CSV_COLUMNS = ["month", "tenant", "pool", "resource_class", "runners", "runner_minutes", "jobs", "jobs_failed", "cost", "currency"]
+
+
+def _add(target: Dict[str, Any], source: Dict[str, Any]):
+    for field in FIELDS:
+        target[field] = round(target.get(field, 0) + source.get(field, 0), 4)
+
+
+def merge_reports(reports: List[Dict[str, Any]]) -> Dict[str, Any]:
+    """Add up tenants and pools across shards (each shard only sees the runners it hosts)."""
+    merged = {**reports[0], "tenants": []}
+    tenants: Dict[str, Dict[str, Any]] = {}
+    for report in reports:
+        merged["partial"] = merged.get("partial") or report.get("partial", False)
+        for summary in report.get("tenants", []):
+            target = tenants.setdefault(summary["tenant"], {"tenant": summary["tenant"], "pools": {}})
+            _add(target, summary)
+            for entry in summary.get("pools", []):
+                key = (entry["pool"], entry.get("resource_class") or "")
+                _add(target["pools"].setdefault(key, {"pool": entry["pool"], "resource_class": entry.get("resource_class")}), entry)
+    merged["tenants"] = [
+        {**summary, "pools": list(summary["pools"].values())} for _, summary in sorted(tenants.items())
+    ]
+    return filter_tenants(merged, tenants.keys())
+
+
+def filter_tenants(report: Dict[str, Any], visible: Iterable[str]) -> Dict[str, Any]:
+    """Keep only the visible tenants and recompute the totals."""
+    visible = set(visible)
+    summaries = [summary for summary in report["tenants"] if summary["tenant"] in visible]
+    totals: Dict[str, Any] = {}
+    for summary in summaries:
+        _add(totals, summary)
+    return {**report, "tenants": summaries, "totals": {field: totals.get(field, 0) for field in FIELDS}}
+
+
+def to_csv(report: Dict[str, Any]) -> str:
+    """One row per tenant, pool and resource class, same columns as the orchestrator export."""
+    buffer = io.StringIO()
+    writer = csv.DictWriter(buffer, fieldnames=CSV_COLUMNS, lineterminator="\n")
+    writer.writeheader()
+    for summary in report["tenants"]:
+        for entry in summary["pools"]:
+            writer.writerow({
+                "month": report["month"], "tenant": summary["tenant"], "currency": report["currency"],
+                **{column: entry[column] for column in CSV_COLUMNS if column in entry},
+            })
+    return buffer.getvalue()
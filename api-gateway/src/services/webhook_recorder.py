@@ -0,0 +1,245 @@
+"""
+API Gateway - Webhook Recording
+Captures every verified GitHub webhook delivery, sanitized, to hourly JSONL files in
+WEBHOOK_RECORD_DIR so a pile-up can be replayed later against staging with
+cmd/webhook-replay. Only the fields the gateway and orchestrator act on are kept
+(no sender, commits, URLs or emails); WEBHOOK_RECORD_PSEUDONYMIZE also hashes owner,
+repository and runner names. Closed files are uploaded to an S3-compatible bucket
+(AWS S3, MinIO, GCS with HMAC keys) when WEBHOOK_RECORD_S3_BUCKET is set.
+"""
+
+import datetime
+import hashlib
+import hmac
+import json
+import logging
+import os
+import threading
+import time
+from typing import Any, Dict, List, Optional
+from urllib.parse import quote, urlparse
+
+import httpx
+
+from src.config.settings import (
+    WEBHOOK_RECORD_DIR, WEBHOOK_RECORD_EVENTS, WEBHOOK_RECORD_PSEUDONYMIZE,
+    WEBHOOK_RECORD_S3_BUCKET, WEBHOOK_RECORD_S3_ENDPOINT, WEBHOOK_RECORD_S3_REGION, WEBHOOK_RECORD_S3_PREFIX,
+    WEBHOOK_RECORD_S3_ACCESS_KEY, WEBHOOK_RECORD_S3_SECRET_KEY, WEBHOOK_RECORD_S3_SESSION_TOKEN,
+)
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+# Fields kept from a workflow_job payload; everything else is dropped
+JOB_FIELDS = (
+    "id", "run_id", "run_attempt", "name", "workflow_name", "labels", "status", "conclusion",
+    "created_at", "started_at", "completed_at", "runner_id", "runner_name", "runner_group_name",
+)
+
+
+def _pseudonym(value: Any) -> Any:
+    """Stable short hash, so the same repository keeps the same name across a recording."""
+    if not isinstance(value, str) or not value:
+        return value
+    return "x" + hashlib.sha256(value.encode("utf-8")).hexdigest()[:12]
+
+
+def sanitize(payload: Dict, pseudonymize: bool = False) -> Dict:
+    """Allowlisted copy of a delivery: action, job fields, repository, organization and installation."""
+    name = _pseudonym if pseudonymize else (lambda value: value)
+    clean: Dict[str, Any] = {"action": payload.get("action")}
+
+    job = payload.get("workflow_job")
+    if isinstance(job, dict):
+        clean["workflow_job"] = {field: job.get(field) for field in JOB_FIELDS if field in job}
+        if pseudonymize and clean["workflow_job"].get("runner_name"):
+            clean["workflow_job"]["runner_name"] = name(job["runner_name"])
+
+    repository = payload.get("repository")
+    if isinstance(repository, dict):
+        owner, _, repo = str(repository.get("full_name") or "").partition("/")
+        owner = name(owner or (repository.get("owner") or {}).get("login"))
+        repo = name(repo or repository.get("name"))
+        clean["repository"] = {"full_name": f"{owner}/{repo}", "name": repo, "owner": {"login": owner}}
+    organization = payload.get("organization")
+    if isinstance(organization, dict):
+        clean["organization"] = {"login": name(organization.get("login"))}
+    installation = payload.get("installation")
+    if isinstance(installation, dict):
+        clean["installation"] = {"id": installation.get("id")}
+    return clean
+
+
+class S3Uploader:
+    """PUT of whole objects to an S3-compatible bucket with SigV4 and path-style addressing."""
+
+    def __init__(self, bucket: str, endpoint: str, region: str, prefix: str,
+                 access_key: Optional[str], secret_key: Optional[str], session_token: Optional[str] = None):
+        if not access_key or not secret_key:
+            raise ValueError("WEBHOOK_RECORD_S3_BUCKET requiere AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY")
+        self.bucket = bucket
+        self.endpoint = (endpoint or f"https://s3.{region}.amazonaws.com").rstrip("/")
+        self.region = region
+        self.prefix = prefix.strip("/")
+        self.access_key = access_key
+        self.secret_key = secret_key
+        self.session_token = session_token
+
+    def key_for(self, filename: str) -> str:
+        return f"{self.prefix}/{filename}" if self.prefix else filename
+
+    def upload(self, filename: str, body: bytes):
+        key = self.key_for(filename)
+        url = f"{self.endpoint}/{self.bucket}/{quote(key)}"
+        headers = self._sign("PUT", url, body)
+        response = httpx.put(url, content=body, headers={**headers, "Content-Type": "application/x-ndjson"}, timeout=60.0)
+        if response.status_code >= 300:
+            raise RuntimeError(f"HTTP {response.status_code} subiendo {key}: {response.text[:200]}")
+
+    def _sign(self, method: str, url: str, body: bytes) -> Dict[str, str]:
+        now = datetime.datetime.now(datetime.timezone.utc)
+        amz_date = now.strftime("%Y%m%dT%H%M%SZ")
+        date = now.strftime("%Y%m%d")
+        parsed = urlparse(url)
+        payload_hash = hashlib.sha256(body).hexdigest()
+        headers = {"host": parsed.netloc, "x-amz-content-sha256": payload_hash, "x-amz-date": amz_date}
+        if self.session_token:
+            headers["x-amz-security-token"] = self.session_token
+        signed = ";".join(sorted(headers))
+        canonical = "\n".join([
+            method, parsed.path, "",
+            "".join(f"{name}:{headers[name]}\n" for name in sorted(headers)),
+            signed, payload_hash,
+        ])
+        scope = f"{date}/{self.region}/s3/aws4_request"
+        to_sign = "\n".join(["AWS4-HMAC-SHA256", amz_date, scope, hashlib.sha256(canonical.encode()).hexdigest()])
+        key = f"AWS4{self.secret_key}".encode()
+        for part in (date, self.region, "s3", "aws4_request"):
+            key = hmac.new(key, part.encode(), hashlib.sha256).digest()
+        signature = hmac.new(key, to_sign.encode(), hashlib.sha256).hexdigest()
+        headers["Authorization"] = (
+            f"AWS4-HMAC-SHA256 Credential={self.access_key}/{scope}, SignedHeaders={signed}, Signature={signature}"
+        )
+        del headers["host"]
+        return headers
+
+
+class WebhookRecorder:
+    """Appends sanitized deliveries to webhooks-YYYYMMDD-HH.jsonl and ships closed hours to the bucket."""
+
+    def __init__(self, directory: str, events: List[str], pseudonymize: bool = False,
+                 uploader: Optional[S3Uploader] = None, upload_interval: int = 60):
+        self.directory = directory
+        self.events = events
+        self.pseudonymize = pseudonymize
+        self.uploader = uploader
+        self.upload_interval = upload_interval
+        self.lock = threading.Lock()
+        self.recorded = 0
+        self.uploaded = 0
+        self.upload_failures = 0
+        os.makedirs(directory, exist_ok=True)
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    @staticmethod
+    def filename(moment: Optional[float] = None) -> str:
+        hour = datetime.datetime.fromtimestamp(moment or time.time(), datetime.timezone.utc)
+        return hour.strftime("webhooks-%Y%m%d-%H.jsonl")
+
+    def record(self, event: str, delivery_id: str, payload: Dict):
+        """Append one verified delivery; recording never fails the webhook."""
+        if "*" not in self.events and event not in self.events:
+            return
+        now = time.time()
+        line = json.dumps({
+            "received_at": datetime.datetime.fromtimestamp(now, datetime.timezone.utc).isoformat(timespec="milliseconds"),
+            "event": event,
+            "delivery_id": delivery_id,
+            "payload": sanitize(payload, self.pseudonymize),
+        }, separators=(",", ":"))
+        try:
+            with self.lock:
+                with open(os.path.join(self.directory, self.filename(now)), "a", encoding="utf-8") as handle:
+                    handle.write(line + "\n")
+                self.recorded += 1
+            metrics.incr("webhooks.recorded", tags={"event": event})
+        except OSError as e:
+            metrics.incr("webhooks.record_failures")
+            logger.error(format_log('ERROR', 'No se pudo grabar el webhook', f"delivery={delivery_id}: {e}"))
+
+    def start(self):
+        if not self.uploader or self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.upload_interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            self.upload_closed()
+
+    def upload_closed(self) -> int:
+        """Upload the files of past hours and delete them locally; the current hour stays open."""
+        current = self.filename()
+        uploaded = 0
+        for filename in sorted(os.listdir(self.directory)):
+            if not (filename.startswith("webhooks-") and filename.endswith(".jsonl")) or filename >= current:
+                continue
+            path = os.path.join(self.directory, filename)
+            try:
+                with open(path, "rb") as handle:
+                    self.uploader.upload(filename, handle.read())
+                os.remove(path)
+            except Exception as e:
+                self.upload_failures += 1
+                metrics.incr("webhooks.record_upload_failures")
+                logger.warning(format_log('WARNING', 'Subida de grabación fallida', f"{filename}: {e}"))
+                continue
+            uploaded += 1
+            self.uploaded += 1
+            logger.info(format_log('SUCCESS', 'Grabación de webhooks subida', self.uploader.key_for(filename)))
+        return uploaded
+
+    def status(self) -> Dict[str, Any]:
+        return {
+            "directory": self.directory,
+            "events": self.events,
+            "pseudonymize": self.pseudonymize,
+            "bucket": self.uploader.bucket if self.uploader else None,
+            "recorded": self.recorded,
+            "uploaded": self.uploaded,
+            "upload_failures": self.upload_failures,
+        }
+
+
+def create_webhook_recorder() -> Optional[WebhookRecorder]:
+    """Recorder configured from settings, or None without WEBHOOK_RECORD_DIR."""
+    if not WEBHOOK_RECORD_DIR:
+        return None
+    uploader = None
+    if WEBHOOK_RECORD_S3_BUCKET:
+        uploader = S3Uploader(
+            WEBHOOK_RECORD_S3_BUCKET, WEBHOOK_RECORD_S3_ENDPOINT, WEBHOOK_RECORD_S3_REGION, WEBHOOK_RECORD_S3_PREFIX,
+            WEBHOOK_RECORD_S3_ACCESS_KEY, WEBHOOK_RECORD_S3_SECRET_KEY, WEBHOOK_RECORD_S3_SESSION_TOKEN,
+        )
+    recorder = WebhookRecorder(WEBHOOK_RECORD_DIR, WEBHOOK_RECORD_EVENTS, WEBHOOK_RECORD_PSEUDONYMIZE, uploader)
+    logger.info(format_log(
+        'CONFIG', 'Grabación de webhooks activada',
+        f"{WEBHOOK_RECORD_DIR}{f' -> s3://{WEBHOOK_RECORD_S3_BUCKET}' if uploader else ''}"
+    ))
+    return recorder
+
+
+# Shared by the GitHub webhook endpoint
+webhook_recorder = create_webhook_recorder()
@@ -0,0 +1,119 @@
+"""
+API Gateway - Webhook Replay Protection
+GitHub does not sign a delivery timestamp, so replays are detected from the event
+time inside the payload (the latest of created_at/started_at/completed_at) and from
+the order of each job's actions. Every window is widened by WEBHOOK_CLOCK_SKEW so
+GitHub's clock and ours may drift apart without rejecting legitimate deliveries.
+Repeated X-GitHub-Delivery IDs are not tracked here: the orchestrator's delivery log
+deduplicates them, shared by every replica through Redis (WORK_QUEUE_URL).
+"""
+
+import logging
+import threading
+import time
+from datetime import datetime
+from typing import Any, Dict, Optional, Tuple
+
+from src.config.settings import WEBHOOK_CLOCK_SKEW, WEBHOOK_MAX_AGE, WEBHOOK_REPLAY_WINDOW
+from src.services.metrics import metrics
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+# Order of workflow_job actions: a delivery never moves a job backwards
+ACTION_SEQUENCE = {"queued": 0, "waiting": 0, "in_progress": 1, "completed": 2}
+
+
+def parse_timestamp(value: Any) -> Optional[float]:
+    """Epoch seconds of an ISO 8601 timestamp from a GitHub payload (None if absent or invalid)."""
+    if not isinstance(value, str) or not value:
+        return None
+    try:
+        return datetime.fromisoformat(value.replace("Z", "+00:00")).timestamp()
+    except ValueError:
+        return None
+
+
+def event_time(payload: Dict) -> Optional[float]:
+    """Time the delivered event happened, according to GitHub."""
+    job = payload.get("workflow_job") or {}
+    times = [parse_timestamp(job.get(field)) for field in ("completed_at", "started_at", "created_at")]
+    times = [value for value in times if value is not None]
+    return max(times) if times else None
+
+
+class ReplayGuard:
+    """
+    Rejects stale and out-of-order webhook deliveries.
+
+    - An event older than `max_age` seconds (0 disables the check) or more than `skew`
+      seconds in the future is outside the accepted window; `skew` widens both edges.
+    - A workflow_job delivery whose action comes before one already processed for the
+      same job (queued after completed) is out of order; each job's last action is
+      remembered for `replay_window` seconds on the monotonic clock.
+    """
+
+    def __init__(self, max_age: int = 0, skew: int = 300, replay_window: int = 86400):
+        self.max_age = max_age
+        self.skew = skew
+        self.replay_window = replay_window
+        # job ID -> (action sequence, monotonic time)
+        self.jobs: Dict[str, Tuple[int, float]] = {}
+        self.lock = threading.Lock()
+
+    def _prune(self, now: float):
+        if len(self.jobs) < 10000:
+            return
+        cutoff = now - self.replay_window
+        self.jobs = {key: entry for key, entry in self.jobs.items() if entry[1] >= cutoff}
+
+    def check(self, event: str, delivery_id: str, payload: Dict, now: Optional[float] = None) -> Optional[str]:
+        """
+        Check a delivery with a valid signature before it is processed.
+
+        Returns:
+            None if the delivery is accepted; otherwise "stale", "future" or "out_of_order"
+        """
+        now = now or time.time()
+        happened = event_time(payload)
+        if happened is not None:
+            offset = now - happened
+            metrics.timing("webhooks.delivery_age", max(offset, 0) * 1000, tags={"event": event})
+            if offset < 0:
+                # An event from the future can only come from a clock ahead of ours
+                metrics.gauge("webhooks.clock_skew", -offset, tags={"source": "github"})
+                if -offset > self.skew:
+                    return self._reject("future", event, delivery_id, f"{int(-offset)}s por delante")
+            elif self.max_age and offset > self.max_age + self.skew:
+                return self._reject("stale", event, delivery_id, f"{int(offset)}s de antigüedad")
+
+        job_id = str((payload.get("workflow_job") or {}).get("id") or "")
+        sequence = ACTION_SEQUENCE.get(payload.get("action"))
+        if event == "workflow_job" and job_id and sequence is not None:
+            with self.lock:
+                last = self.jobs.get(job_id)
+            if last is not None and sequence < last[0] and time.monotonic() - last[1] < self.replay_window:
+                return self._reject("out_of_order", event, delivery_id, f"job {job_id} {payload.get('action')}")
+        return None
+
+    def processed(self, event: str, delivery_id: str, payload: Dict):
+        """Remember a delivery handled successfully; failed ones may be redelivered by GitHub."""
+        now = time.monotonic()
+        job_id = str((payload.get("workflow_job") or {}).get("id") or "")
+        sequence = ACTION_SEQUENCE.get(payload.get("action"))
+        with self.lock:
+            self._prune(now)
+            if event == "workflow_job" and job_id and sequence is not None:
+                last = self.jobs.get(job_id)
+                self.jobs[job_id] = (max(sequence, last[0] if last else 0), now)
+
+    def _reject(self, reason: str, event: str, delivery_id: str, detail: str = "") -> str:
+        metrics.incr("webhooks.rejected", tags={"reason": reason, "event": event})
+        logger.warning(format_log(
+            'WARNING', 'Entrega de webhook rechazada', f"{reason} delivery={delivery_id}{f' ({detail})' if detail else ''}"
+        ))
+        return reason
+
+
+# Shared by the GitHub webhook endpoint
+replay_guard = ReplayGuard(WEBHOOK_MAX_AGE, WEBHOOK_CLOCK_SKEW, WEBHOOK_REPLAY_WINDOW)
@@ -0,0 +1,248 @@
+"""
+API Gateway - GitHub Webhooks
+Contains webhook signature validation with support for two active secrets during rotation
+and one secret per onboarded tenant.
+"""
+
+import hashlib
+import hmac
+import json
+import logging
+import os
+import threading
+from typing import Any, Dict, Optional
+
+from fastapi import HTTPException
+
+from src.services.lifecycle_events import lifecycle_events
+from src.utils.helpers import format_log
+
+logger = logging.getLogger(__name__)
+
+
+def secret_fingerprint(secret: str) -> str:
+    """Return a short, non-reversible identifier for a secret."""
+    return hashlib.sha256(secret.encode("utf-8")).hexdigest()[:12]
+
+
+def compute_signature(secret: str, body: bytes) -> str:
+    """Compute the X-Hub-Signature-256 value for a payload."""
+    digest = hmac.new(secret.encode("utf-8"), body, hashlib.sha256).hexdigest()
+    return f"sha256={digest}"
+
+
+class WebhookSecretStore:
+    """
+    Active webhook secrets.
+
+    Holds a primary secret and an optional secondary one. Deliveries are accepted
+    if they match either, so the secret can be changed on GitHub without a window
+    of rejected deliveries:
+
+    1. add()     - stage the new secret as secondary (both accepted); fails while
+                   another secret is staged, which must be promoted or retired first
+    2. promote() - make the staged secret primary; the old one stays as secondary
+    3. retire()  - drop the secondary once GitHub only signs with the new secret
+
+    Tenants get their own secret (set_tenant), configured on the webhooks of their orgs:
+    a delivery signed with it only counts for that tenant's owners.
+    """
+
+    def __init__(self, primary: Optional[str] = None, secondary: Optional[str] = None, state_file: Optional[str] = None):
+        self.primary = primary
+        self.secondary = secondary
+        self.tenants: Dict[str, str] = {}
+        self.state_file = state_file
+        self.lock = threading.Lock()
+        self._load_state()
+
+    def _load_state(self):
+        """Load secrets persisted by a previous rotation (takes precedence over env)."""
+        if not self.state_file or not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                data = json.load(state)
+            self.primary = data.get("primary") or self.primary
+            self.secondary = data.get("secondary")
+            self.tenants = data.get("tenants", {})
+            logger.info(format_log('CONFIG', 'Secretos de webhook cargados', self.state_file))
+        except (OSError, ValueError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de secretos de webhook', str(e)))
+
+    def _save_state(self):
+        """Persist current secrets so rotations survive restarts."""
+        if not self.state_file:
+            return
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({"primary": self.primary, "secondary": self.secondary, "tenants": self.tenants}, state)
+        os.chmod(tmp_file, 0o600)
+        os.replace(tmp_file, self.state_file)
+
+    @property
+    def configured(self) -> bool:
+        return bool(self.primary or self.secondary or self.tenants)
+
+    def validate(self, body: bytes, signature: Optional[str]) -> Optional[str]:
+        """
+        Validate a delivery signature against all active secrets.
+
+        Returns:
+            "primary", "secondary" or "tenant:<name>" for the matching secret, None if none matches
+        """
+        if not signature:
+            return None
+
+        with self.lock:
+            candidates = [("primary", self.primary), ("secondary", self.secondary)]
+            candidates += [(f"tenant:{name}", secret) for name, secret in self.tenants.items()]
+
+        for slot, secret in candidates:
+            if secret and hmac.compare_digest(compute_signature(secret, body), signature):
+                return slot
+        return None
+
+    def add(self, secret: str):
+        """Stage a new secret as secondary."""
+        with self.lock:
+            if not self.primary:
+                self.primary = secret
+            elif self.secondary:
+                # Sobrescribirlo dejaría de aceptar entregas firmadas con un secreto ya configurado en GitHub
+                raise ValueError("Ya hay un secreto secundario; promuévelo o retíralo antes de agregar otro")
+            else:
+                self.secondary = secret
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Secreto de webhook agregado', secret_fingerprint(secret)))
+
+    def promote(self):
+        """Swap secrets: the secondary becomes primary and the old primary is kept as secondary."""
+        with self.lock:
+            if not self.secondary:
+                raise ValueError("No hay secreto secundario para promover")
+            self.primary, self.secondary = self.secondary, self.primary
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Secreto de webhook promovido', secret_fingerprint(self.primary)))
+
+    def retire(self):
+        """Drop the secondary secret."""
+        with self.lock:
+            if not self.secondary:
+                raise ValueError("No hay secreto secundario para retirar")
+            retired = self.secondary
+            self.secondary = None
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Secreto de webhook retirado', secret_fingerprint(retired)))
+
+    def set_tenant(self, tenant: str, secret: str):
+        """Store the webhook secret of a tenant (replacing any previous one)."""
+        with self.lock:
+            self.tenants[tenant] = secret
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Secreto de webhook del tenant guardado', f"{tenant} {secret_fingerprint(secret)}"))
+
+    def remove_tenant(self, tenant: str):
+        with self.lock:
+            if self.tenants.pop(tenant, None) is None:
+                return
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Secreto de webhook del tenant eliminado', tenant))
+
+    def describe(self) -> Dict[str, Any]:
+        """Return secret fingerprints (never the values)."""
+        with self.lock:
+            return {
+                "primary": secret_fingerprint(self.primary) if self.primary else None,
+                "secondary": secret_fingerprint(self.secondary) if self.secondary else None,
+                "tenants": {name: secret_fingerprint(secret) for name, secret in self.tenants.items()},
+            }
+
+
+class WebhookHandler:
+    """Translates validated GitHub deliveries into orchestrator requests."""
+
+    def __init__(self, request_router):
+        self.request_router = request_router
+
+    async def handle(self, event: str, delivery_id: str, payload: Dict) -> Dict:
+        """Process a delivery and return a summary of the action taken."""
+        if event == "ping":
+            return {"action": "pong"}
+
+        if event != "workflow_job":
+            return {"action": "ignored", "reason": f"evento {event} no soportado"}
+
+        job = payload.get("workflow_job", {})
+        labels = job.get("labels", [])
+        if "self-hosted" in labels:
+            self._emit_job_event(payload, delivery_id)
+        action = payload.get("action")
+        if action not in ("queued", "in_progress", "completed") or "self-hosted" not in labels:
+            return {"action": "ignored", "reason": "job no encolado para self-hosted"}
+
+        repo = payload.get("repository", {}).get("full_name")
+        if not repo:
+            return {"action": "ignored", "reason": "payload sin repositorio"}
+
+        if action == "completed":
+            # Completed or cancelled: the orchestrator tears down the runner created for this job
+            if not job.get("id"):
+                return {"action": "ignored", "reason": "job sin id"}
+            result = await self.request_router.complete_job(repo, str(job["id"]), job.get("runner_name"))
+            return {"action": "job_completed", "repo": repo, "job_id": job.get("id"), **(result.get("data") or {})}
+
+        if action == "in_progress":
+            # Picked up by a runner: the job is no longer waiting in the queue
+            if not job.get("id"):
+                return {"action": "ignored", "reason": "job sin id"}
+            await self.request_router.job_started(repo, str(job["id"]), job.get("runner_name"))
+            return {"action": "job_started", "repo": repo, "job_id": job.get("id"), "runner_name": job.get("runner_name")}
+
+        logger.info(format_log('INFO', 'Job encolado recibido', f"{repo} job={job.get('id')} delivery={delivery_id}"))
+        # The orchestrator records the delivery ID: a redelivery does not create a second runner
+        request = {"scope": "repo", "scope_name": repo, "count": 1}
+        if delivery_id:
+            request["delivery_id"] = delivery_id
+        # One runner per job: redeliveries and retries find the runner already created for it
+        if job.get("id"):
+            request["job_id"] = str(job["id"])
+            # Kept with the queued job to diagnose why no runner picked it up
+            request["job_labels"] = labels
+        # Run, workflow and branch let the orchestrator apply its job policies
+        for field, value in (("run_id", job.get("run_id")), ("workflow", job.get("workflow_name")), ("head_branch", job.get("head_branch"))):
+            if value:
+                request[field] = str(value)
+        try:
+            runners = await self.request_router.create_runner(request)
+        except HTTPException as e:
+            if e.status_code != 403:
+                raise
+            # Refused by a job policy: answered as handled so GitHub does not redeliver it
+            logger.warning(format_log('WARNING', 'Job rechazado por política', f"{repo} job={job.get('id')}: {e.detail}"))
+            return {"action": "rejected", "repo": repo, "job_id": job.get("id"), "reason": e.detail}
+        if runners and all(runner.get("status") == "duplicate" for runner in runners):
+            logger.info(format_log('INFO', 'Entrega duplicada ignorada', f"{repo} job={job.get('id')} delivery={delivery_id}"))
+            return {"action": "duplicate", "repo": repo, "job_id": job.get("id")}
+        return {"action": "runner_requested", "repo": repo, "job_id": job.get("id"), "runners": runners}
+
+    @staticmethod
+    def _emit_job_event(payload: Dict, delivery_id: str):
+        """Publish job.queued, job.in_progress, job.completed... for self-hosted jobs."""
+        job = payload.get("workflow_job", {})
+        repo = payload.get("repository", {}).get("full_name", "")
+        lifecycle_events.emit(
+            f"job.{payload.get('action', 'unknown')}", key=repo,
+            repository=repo,
+            job_id=job.get("id"),
+            run_id=job.get("run_id"),
+            run_attempt=job.get("run_attempt"),
+            workflow=job.get("workflow_name"),
+            job_name=job.get("name"),
+            labels=job.get("labels", []),
+            runner_name=job.get("runner_name"),
+            conclusion=job.get("conclusion"),
+            started_at=job.get("started_at"),
+            completed_at=job.get("completed_at"),
+            delivery_id=delivery_id,
+        )
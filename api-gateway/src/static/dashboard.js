@@ -0,0 +1,215 @@
+// Dashboard de administración: consume la misma API /api/v1 que runnersctl, con la
+// credencial del operador. El RBAC lo aplica el gateway en cada endpoint; ocultar los
+// botones según el rol solo evita ofrecer acciones que serían rechazadas.
+"use strict";
+
+const API = "/api/v1";
+const REFRESH_MS = 5000;
+const MAX_EVENTS = 50;
+const PAGE_SIZE = 1000;
+
+let known = null;
+let events = [];
+let timer = null;
+
+function credentialHeaders() {
+  const credential = sessionStorage.getItem("credential");
+  if (!credential) return {};
+  // Un JWT tiene tres segmentos separados por puntos; cualquier otra cosa es una API key
+  return credential.split(".").length === 3
+    ? { Authorization: `Bearer ${credential}` }
+    : { "X-API-Key": credential };
+}
+
+async function request(method, path, body) {
+  const headers = credentialHeaders();
+  if (body !== undefined) headers["Content-Type"] = "application/json";
+  const response = await fetch(API + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const payload = await response.json().catch(() => ({}));
+  if (!response.ok) throw new Error(payload.message || `HTTP ${response.status}`);
+  return { data: payload.data, next: response.headers.get("X-Next-Cursor") };
+}
+
+async function api(method, path, body) {
+  return (await request(method, path, body)).data;
+}
+
+// Los listados están paginados: se siguen las páginas con el cursor de X-Next-Cursor
+async function apiList(path) {
+  const items = [];
+  let cursor = null;
+  do {
+    const query = `limit=${PAGE_SIZE}` + (cursor ? `&cursor=${encodeURIComponent(cursor)}` : "");
+    const page = await request("GET", `${path}?${query}`);
+    items.push(...page.data);
+    cursor = page.next;
+  } while (cursor);
+  return items;
+}
+
+function element(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function row(cells) {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    const td = document.createElement("td");
+    if (cell instanceof Node) td.appendChild(cell); else td.textContent = cell ?? "-";
+    tr.appendChild(td);
+  }
+  return tr;
+}
+
+function poolOf(runner) {
+  return (runner.labels && runner.labels["runner-pool"]) || "default";
+}
+
+function showError(message) {
+  const node = document.getElementById("error");
+  node.textContent = message || "";
+  node.hidden = !message;
+}
+
+function recordEvents(runners) {
+  const current = new Map(runners.map((runner) => [runner.runner_id, runner]));
+  const now = new Date().toLocaleTimeString();
+  if (known) {
+    for (const [id, runner] of current) {
+      const previous = known.get(id);
+      if (!previous) events.unshift({ now, event: "created", runner });
+      else if (previous.status !== runner.status) events.unshift({ now, event: "status", runner });
+    }
+    for (const [id, runner] of known) {
+      if (!current.has(id)) events.unshift({ now, event: "removed", runner: { ...runner, status: "removed" } });
+    }
+  }
+  events = events.slice(0, MAX_EVENTS);
+  known = current;
+}
+
+function renderPools(pools, runners) {
+  const tbody = document.getElementById("pools");
+  const select = document.getElementById("scale-pool");
+  const selected = select.value;
+  tbody.replaceChildren();
+  select.replaceChildren();
+
+  for (const pool of pools) {
+    const members = runners.filter((runner) => poolOf(runner) === pool.name);
+    const running = members.filter((runner) => runner.status === "running").length;
+    const drain = element("button", "Drenar", "danger");
+    drain.addEventListener("click", () => drainPool(pool.name, members));
+    tbody.appendChild(row([pool.name, pool.image, String(running), String(members.length - running), drain]));
+    tbody.lastChild.lastChild.className = "operator";
+
+    const option = element("option", pool.name);
+    option.value = pool.name;
+    select.appendChild(option);
+  }
+  if (selected) select.value = selected;
+}
+
+function renderRunners(runners) {
+  const tbody = document.getElementById("runners");
+  tbody.replaceChildren();
+  for (const runner of runners) {
+    const status = element("span", runner.status, `status-${runner.status}`);
+    tbody.appendChild(row([runner.runner_id, poolOf(runner), status, runner.image, runner.created]));
+  }
+}
+
+function renderEvents() {
+  const list = document.getElementById("events");
+  list.replaceChildren();
+  if (!events.length) list.appendChild(element("li", "(sin eventos desde que se abrió la página)"));
+  for (const { now, event, runner } of events) {
+    list.appendChild(element("li", `${now}  ${event.padEnd(8)} ${runner.runner_id} (pool ${poolOf(runner)}, ${runner.status})`));
+  }
+}
+
+async function refresh() {
+  try {
+    const [runners, pools] = await Promise.all([apiList("/runners"), apiList("/pools")]);
+    recordEvents(runners);
+    renderPools(pools, runners);
+    renderRunners(runners);
+    renderEvents();
+    document.getElementById("summary").textContent =
+      `${pools.length} pools, ${runners.length} runners - actualizado ${new Date().toLocaleTimeString()}`;
+    showError("");
+  } catch (error) {
+    showError(`Error actualizando: ${error.message}`);
+  }
+}
+
+async function drainPool(pool, members) {
+  if (!confirm(`¿Destruir los ${members.length} runners del pool ${pool}?`)) return;
+  const failures = [];
+  for (const runner of members) {
+    try {
+      await api("DELETE", `/runners/${encodeURIComponent(runner.runner_id)}`);
+    } catch (error) {
+      failures.push(`${runner.runner_id}: ${error.message}`);
+    }
+  }
+  showError(failures.length ? `No se pudieron destruir: ${failures.join("; ")}` : "");
+  refresh();
+}
+
+async function scale(event) {
+  event.preventDefault();
+  try {
+    await api("POST", "/runners", {
+      scope: document.getElementById("scale-scope").value,
+      scope_name: document.getElementById("scale-scope-name").value,
+      pool: document.getElementById("scale-pool").value || null,
+      count: Number(document.getElementById("scale-count").value),
+    });
+    refresh();
+  } catch (error) {
+    showError(`Error creando runners: ${error.message}`);
+  }
+}
+
+async function connect() {
+  try {
+    const identity = await api("GET", "/auth/whoami");
+    const canOperate = identity.role === "operator" || identity.role === "admin";
+    document.body.classList.toggle("can-operate", canOperate);
+    document.getElementById("identity").textContent = `${identity.name} (${identity.role})`;
+    document.getElementById("login").hidden = true;
+    document.getElementById("logout").hidden = false;
+    document.getElementById("dashboard").hidden = false;
+    showError("");
+    await refresh();
+    clearInterval(timer);
+    timer = setInterval(refresh, REFRESH_MS);
+  } catch (error) {
+    if (sessionStorage.getItem("credential")) showError(`No autorizado: ${error.message}`);
+  }
+}
+
+document.getElementById("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  sessionStorage.setItem("credential", document.getElementById("credential").value.trim());
+  document.getElementById("credential").value = "";
+  connect();
+});
+
+document.getElementById("logout").addEventListener("click", () => {
+  sessionStorage.removeItem("credential");
+  location.reload();
+});
+
+document.getElementById("scale").addEventListener("submit", scale);
+
+// Sin autenticación configurada whoami responde sin credencial
+connect();
@@ -4,11 +4,20 @@ Contains shared utility functions for logging and common operations.
 """
 
 import logging
-from typing import Any, Dict, Optional
+from typing import Any, Dict
 
 from fastapi import Request
 
-from src.config.settings import LOG_LEVEL
+from src.config.settings import (
+    LOG_LEVEL,
+    LOG_REDACT_PATTERNS,
+    LOG_SINKS,
+    LOG_SYSLOG_ADDRESS,
+    LOG_SYSLOG_APP_NAME,
+    LOG_SYSLOG_FACILITY,
+)
+from src.utils.log_sinks import create_log_sinks
+from src.utils.redaction import SecretRedactor, install_log_redaction
 
 # Constantes de formato para logging estandarizado (mismo sistema que orchestrator)
 LOG_CATEGORIES = {
@@ -32,12 +41,26 @@ def format_log(category: str, action: str, detail: str = "") -> str:
         return f"{prefix} {action}: {detail}"
     return f"{prefix} {action}"
 
+
+# Redactor compartido por los logs del gateway
+redactor = SecretRedactor(LOG_REDACT_PATTERNS)
+
+
 def setup_logging_config() -> None:
     """Configure basic logging for the application."""
-    logging.basicConfig(
-        level=LOG_LEVEL,
-        format="%(asctime)s - %(name)s - %(levelname)s - %(message)s"
+    install_log_redaction(redactor)
+    console = logging.StreamHandler()
+    console.setFormatter(logging.Formatter("%(asctime)s - %(name)s - %(levelname)s - %(message)s"))
+    # Consola por defecto; syslog y journald para hosts que agregan con rsyslog o el journal
+    handlers = create_log_sinks(
+        LOG_SINKS,
+        console,
+        LOG_SYSLOG_APP_NAME,
+        LOG_CATEGORIES,
+        syslog_address=LOG_SYSLOG_ADDRESS,
+        facility=LOG_SYSLOG_FACILITY,
     )
+    logging.basicConfig(level=LOG_LEVEL, handlers=handlers)
     
     # Log de configuración
     logger = logging.getLogger(__name__)
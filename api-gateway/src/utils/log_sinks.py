@@ -0,0 +1,280 @@
+"""
+API Gateway - Log Sinks
+Syslog (RFC 5424) and journald outputs for environments that aggregate logs with rsyslog
+or the host journal instead of container stdout. LOG_SINKS selects the outputs (console,
+syslog, journald, comma separated). Every record keeps its severity (DEBUG → debug,
+WARNING → warning...) and its fields (logger, format_log category, file, line, function
+and thread) as structured data in syslog and as journal fields, so they can be filtered
+without parsing the text.
+"""
+
+import datetime
+import errno
+import logging
+import logging.handlers
+import os
+import socket
+import struct
+import sys
+import threading
+import time
+from typing import Dict, List, Optional, Tuple
+
+# Número de empresa de los SD-ID propios (32473 es el reservado para documentación, RFC 5612)
+SD_ID = "gha@32473"
+
+SYSLOG_PORT = 514
+JOURNALD_SOCKET = "/run/systemd/journal/socket"
+
+
+def syslog_severity(levelno: int) -> int:
+    """Syslog severity (0-7) for a logging level, including in-between levels."""
+    if levelno >= logging.CRITICAL:
+        return 2
+    if levelno >= logging.ERROR:
+        return 3
+    if levelno >= logging.WARNING:
+        return 4
+    if levelno >= logging.INFO:
+        return 6
+    return 7
+
+
+def log_category(message: str, categories: Dict[str, str]) -> Optional[str]:
+    """format_log category (START, ERROR...) from the message prefix."""
+    for category, prefix in categories.items():
+        if message.startswith(prefix):
+            return category
+    return None
+
+
+def record_message(record: logging.LogRecord) -> str:
+    """Already redacted message, with the exception traceback if any."""
+    message = record.getMessage()
+    if record.exc_info and not record.exc_text:
+        record.exc_text = logging.Formatter().formatException(record.exc_info)
+    if record.exc_text:
+        message = f"{message}\n{record.exc_text}"
+    return message
+
+
+def record_fields(record: logging.LogRecord, categories: Dict[str, str]) -> Dict[str, str]:
+    """Structured fields shared by syslog and journald."""
+    fields = {
+        "logger": record.name,
+        "level": record.levelname,
+        "file": record.pathname,
+        "line": str(record.lineno),
+        "func": record.funcName,
+        "thread": record.threadName,
+    }
+    category = log_category(record.getMessage(), categories)
+    if category:
+        fields["category"] = category
+    return fields
+
+
+class SinkHandler(logging.Handler):
+    """External output: a missing receiver is reported on stderr once a minute, without tracebacks."""
+
+    def __init__(self, name: str):
+        super().__init__()
+        self.sink_name = name
+        self.last_error = 0.0
+
+    def handleError(self, record: logging.LogRecord):
+        now = time.monotonic()
+        if now - self.last_error >= 60:
+            self.last_error = now
+            error = sys.exc_info()[1]
+            print(f"⚠️ No se pudo enviar el log a {self.sink_name}: {error}", file=sys.stderr)
+
+
+class SyslogHandler(SinkHandler):
+    """
+    Sends RFC 5424 records to a Unix socket (/dev/log), over UDP or over TCP.
+
+    Over TCP every message is framed with octet counting (RFC 6587), which rsyslog and
+    syslog-ng understand regardless of line breaks in the message.
+    """
+
+    def __init__(self, address: str, facility: int, app_name: str, categories: Dict[str, str]):
+        super().__init__("syslog")
+        self.facility = facility
+        self.app_name = app_name[:48] or "-"
+        self.hostname = socket.gethostname()[:255] or "-"
+        self.categories = categories
+        self.target, self.family, self.kind = self._parse_address(address)
+        if self.family == socket.AF_UNIX and not os.path.exists(address):
+            raise OSError(f"{address} no existe (¿está montado en el contenedor?)")
+        self.sock: Optional[socket.socket] = None
+        self.sock_lock = threading.Lock()
+
+    @staticmethod
+    def _parse_address(address: str) -> Tuple[object, int, int]:
+        """/dev/log, udp://host:514 or tcp://host:514 (host:port without a scheme is UDP)."""
+        if address.startswith("/"):
+            return address, socket.AF_UNIX, socket.SOCK_DGRAM
+        scheme, _, rest = address.rpartition("://")
+        host, _, port = rest.rpartition(":") if ":" in rest else (rest, "", "")
+        kind = socket.SOCK_STREAM if scheme.lower() == "tcp" else socket.SOCK_DGRAM
+        return (host.strip("[]"), int(port or SYSLOG_PORT)), socket.AF_UNSPEC, kind
+
+    def _connect(self) -> socket.socket:
+        if self.family == socket.AF_UNIX:
+            # /dev/log de rsyslog y de journald es de datagramas
+            sock = socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM)
+            sock.connect(self.target)
+            return sock
+        host, port = self.target
+        family, kind, proto, _, sockaddr = socket.getaddrinfo(host, port, 0, self.kind)[0]
+        sock = socket.socket(family, kind, proto)
+        sock.settimeout(5)
+        sock.connect(sockaddr)
+        return sock
+
+    def format_rfc5424(self, record: logging.LogRecord) -> bytes:
+        priority = self.facility * 8 + syslog_severity(record.levelno)
+        timestamp = datetime.datetime.fromtimestamp(record.created, datetime.timezone.utc)
+        fields = record_fields(record, self.categories)
+        params = " ".join(f'{key}="{sd_escape(value)}"' for key, value in fields.items())
+        msgid = fields.get("category", "-")
+        header = (
+            f"<{priority}>1 {timestamp.strftime('%Y-%m-%dT%H:%M:%S.%fZ')} {self.hostname} "
+            f"{self.app_name} {record.process or '-'} {msgid} [{SD_ID} {params}]"
+        )
+        return f"{header} {record_message(record)}".encode("utf-8", "replace")
+
+    def emit(self, record: logging.LogRecord):
+        try:
+            message = self.format_rfc5424(record)
+            if self.kind == socket.SOCK_STREAM:
+                message = f"{len(message)} ".encode() + message
+            with self.sock_lock:
+                # Un reinicio de rsyslog cierra la conexión: se reconecta una vez
+                for attempt in range(2):
+                    try:
+                        if self.sock is None:
+                            self.sock = self._connect()
+                        if self.kind == socket.SOCK_STREAM:
+                            self.sock.sendall(message)
+                        else:
+                            self.sock.send(message)
+                        break
+                    except OSError:
+                        self._close_socket()
+                        if attempt:
+                            raise
+        except Exception:
+            self.handleError(record)
+
+    def _close_socket(self):
+        if self.sock is not None:
+            try:
+                self.sock.close()
+            except OSError:
+                pass
+            self.sock = None
+
+    def close(self):
+        with self.sock_lock:
+            self._close_socket()
+        super().close()
+
+
+def sd_escape(value: str) -> str:
+    """Escapes a structured data PARAM-VALUE (RFC 5424, section 6.3.3)."""
+    return value.replace("\\", "\\\\").replace('"', '\\"').replace("]", "\\]")
+
+
+class JournaldHandler(SinkHandler):
+    """
+    Sends records to the journal over its native protocol (the systemd-journald socket).
+
+    PRIORITY carries the severity and the other fields (LOGGER, CATEGORY, CODE_FILE...) can be
+    filtered with journalctl, e.g. journalctl SYSLOG_IDENTIFIER=gha-api-gateway CATEGORY=ERROR.
+    """
+
+    def __init__(self, path: str, facility: int, app_name: str, categories: Dict[str, str]):
+        super().__init__("journald")
+        self.path = path
+        self.facility = facility
+        self.app_name = app_name
+        self.categories = categories
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM | socket.SOCK_CLOEXEC)
+
+    @staticmethod
+    def encode_field(name: str, value: str) -> bytes:
+        data = value.encode("utf-8", "replace")
+        # Los valores con saltos de línea van con su longitud binaria en lugar de NAME=valor
+        if b"\n" in data:
+            return name.encode() + b"\n" + struct.pack("<Q", len(data)) + data + b"\n"
+        return name.encode() + b"=" + data + b"\n"
+
+    def build(self, record: logging.LogRecord, message: str) -> bytes:
+        fields = record_fields(record, self.categories)
+        entries: List[Tuple[str, str]] = [
+            ("MESSAGE", message),
+            ("PRIORITY", str(syslog_severity(record.levelno))),
+            ("SYSLOG_IDENTIFIER", self.app_name),
+            ("SYSLOG_FACILITY", str(self.facility)),
+            ("SYSLOG_PID", str(record.process or os.getpid())),
+            ("CODE_FILE", fields.pop("file")),
+            ("CODE_LINE", fields.pop("line")),
+            ("CODE_FUNC", fields.pop("func")),
+            ("THREAD_NAME", fields.pop("thread")),
+        ]
+        entries.extend((key.upper(), value) for key, value in fields.items())
+        return b"".join(self.encode_field(name, value) for name, value in entries)
+
+    def emit(self, record: logging.LogRecord):
+        try:
+            message = record_message(record)
+            try:
+                self.sock.sendto(self.build(record, message), self.path)
+            except OSError as e:
+                if e.errno != errno.EMSGSIZE:
+                    raise
+                # Mayor que un datagrama: se envía recortado en lugar de perderlo
+                self.sock.sendto(self.build(record, message[:32 * 1024] + " [recortado]"), self.path)
+        except Exception:
+            self.handleError(record)
+
+    def close(self):
+        self.sock.close()
+        super().close()
+
+
+def create_log_sinks(
+    sinks: str,
+    console: logging.Handler,
+    app_name: str,
+    categories: Dict[str, str],
+    syslog_address: str = "/dev/log",
+    facility: str = "daemon",
+) -> List[logging.Handler]:
+    """
+    Handlers for LOG_SINKS. An output that cannot be opened is skipped with a warning on
+    stderr and, if none is left, the console is used so logs are not lost.
+    """
+    facility_code = logging.handlers.SysLogHandler.facility_names.get(facility.lower())
+    if facility_code is None:
+        print(f"⚠️ LOG_SYSLOG_FACILITY inválido: {facility}; se usa daemon")
+        facility_code = logging.handlers.SysLogHandler.LOG_DAEMON
+
+    handlers: List[logging.Handler] = []
+    for sink in [s.strip().lower() for s in sinks.split(",") if s.strip()]:
+        try:
+            if sink == "console":
+                handlers.append(console)
+            elif sink == "syslog":
+                handlers.append(SyslogHandler(syslog_address, facility_code, app_name, categories))
+            elif sink == "journald":
+                if not os.path.exists(JOURNALD_SOCKET):
+                    raise OSError(f"{JOURNALD_SOCKET} no existe (¿está montado en el contenedor?)")
+                handlers.append(JournaldHandler(JOURNALD_SOCKET, facility_code, app_name, categories))
+            else:
+                print(f"⚠️ Salida de logging desconocida en LOG_SINKS: {sink}")
+        except (OSError, ValueError) as e:
+            print(f"⚠️ No se pudo abrir la salida de logging {sink}: {e}")
+    return handlers or [console]
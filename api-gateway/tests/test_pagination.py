@@ -0,0 +1,62 @@
+"""Filters, sort orders and cursors of the list endpoints."""
+
+import unittest
+from types import SimpleNamespace
+
+from fastapi import HTTPException
+from starlette.datastructures import QueryParams
+
+from src.api.pagination import POOLS, RUNNERS, paginate
+
+
+def _request(query: str) -> SimpleNamespace:
+    return SimpleNamespace(query_params=QueryParams(query))
+
+
+RUNNERS_LIST = [
+    {"runner_id": "r1", "status": "running", "health": "healthy", "created": "2026-01-01T00:00:01", "labels": {"runner-pool": "linux", "repo": "acme/api"}},
+    {"runner_id": "r2", "status": "running", "health": "unhealthy", "created": "2026-01-01T00:00:02", "labels": {"runner-pool": "gpu", "repo": "acme/web"}},
+    {"runner_id": "r3", "status": "exited", "created": "2026-01-01T00:00:03", "labels": {"repo": "acme/api"}},
+    {"runner_id": "r4", "status": "running", "health": "starting", "created": "2026-01-01T00:00:04", "labels": {"runner-pool": "linux", "repo": "acme/api"}},
+]
+
+
+def _ids(query: str):
+    return [runner["runner_id"] for runner in paginate(RUNNERS_LIST, _request(query), RUNNERS).items]
+
+
+class RunnerFiltersTest(unittest.TestCase):
+    def test_health(self):
+        self.assertEqual(_ids("health=unhealthy"), ["r2"])
+        self.assertEqual(_ids("health=healthy,starting"), ["r1", "r4"])
+        # Los runners sin HEALTHCHECK no coinciden con ningún estado
+        self.assertEqual(_ids("health=none"), [])
+
+    def test_health_combined_with_other_filters(self):
+        self.assertEqual(_ids("health=healthy,unhealthy&pool=linux"), ["r1"])
+        self.assertEqual(_ids("state=running&health=starting&repo=acme/api"), ["r4"])
+
+    def test_state_pool_repo_and_label(self):
+        self.assertEqual(_ids("state=exited"), ["r3"])
+        self.assertEqual(_ids("pool=default"), ["r3"])
+        self.assertEqual(_ids("repo=acme/web"), ["r2"])
+        self.assertEqual(_ids("label=runner-pool=linux&label=repo"), ["r1", "r4"])
+
+    def test_unsupported_filter(self):
+        with self.assertRaises(HTTPException) as raised:
+            paginate([{"name": "linux"}], _request("health=unhealthy"), POOLS)
+        self.assertEqual(raised.exception.status_code, 400)
+
+
+class RunnerPagesTest(unittest.TestCase):
+    def test_cursor_walks_filtered_runners(self):
+        first = paginate(RUNNERS_LIST, _request("state=running&sort=-created&limit=2"), RUNNERS)
+        self.assertEqual([runner["runner_id"] for runner in first.items], ["r4", "r2"])
+        self.assertEqual(first.total, 3)
+        second = paginate(RUNNERS_LIST, _request(f"state=running&sort=-created&limit=2&cursor={first.next_cursor}"), RUNNERS)
+        self.assertEqual([runner["runner_id"] for runner in second.items], ["r1"])
+        self.assertIsNone(second.next_cursor)
+
+
+if __name__ == "__main__":
+    unittest.main()
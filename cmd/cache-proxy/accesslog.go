@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusRecorder guarda el código y los bytes de la respuesta para el log de acceso.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// accessLog escribe una línea JSON por petición (CACHE_PROXY_ACCESS_LOG): repositorio,
+// operación y resultado. El token del namespace no se escribe, para que el log no sirva
+// para suplantar a un repositorio. /healthz (el HEALTHCHECK) no se registra.
+func accessLog(next http.Handler, out io.Writer, signed bool) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		namespace, route := r.URL.Path, ""
+		if index := strings.Index(r.URL.Path, apiPrefix); index >= 0 {
+			namespace, route = strings.Trim(r.URL.Path[:index], "/"), strings.TrimPrefix(r.URL.Path[index:], apiPrefix)
+			if signed {
+				_, namespace, _ = strings.Cut(namespace, "/")
+			}
+		}
+		line, _ := json.Marshal(map[string]any{
+			"time":        start.UTC().Format(time.RFC3339Nano),
+			"remote":      r.RemoteAddr,
+			"method":      r.Method,
+			"namespace":   namespace,
+			"route":       route,
+			"query":       r.URL.RawQuery,
+			"status":      recorder.status,
+			"bytes_in":    r.ContentLength,
+			"bytes_out":   recorder.bytes,
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = out.Write(append(line, '\n'))
+	})
+}
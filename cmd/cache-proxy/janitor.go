@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retentionPolicy son los límites que aplica el janitor; un límite a cero no se comprueba.
+type retentionPolicy struct {
+	// maxAge borra las entradas sin usar (sin hits) durante más de esto
+	maxAge time.Duration
+	// maxRepoSize es el tamaño máximo por namespace (repositorio u organización)
+	maxRepoSize int64
+	// maxTotalSize es el tamaño máximo de toda la caché
+	maxTotalSize int64
+}
+
+// Motivos de desalojo, como tag reason de las métricas.
+const (
+	evictAge       = "age"
+	evictRepoQuota = "repo_quota"
+	evictTotalSize = "total_size"
+)
+
+// storedEntry es una entrada listada por el janitor con su namespace y su objeto de metadatos.
+type storedEntry struct {
+	object    string
+	namespace string
+	entry     *cacheEntry
+}
+
+// janitorRun resume una pasada para las métricas y el log.
+type janitorRun struct {
+	entries   int
+	bytes     int64
+	evicted   map[string]int
+	reclaimed map[string]int64
+}
+
+// janitor aplica la política de retención en segundo plano: primero la antigüedad, luego
+// la cuota de cada namespace y por último el tamaño total, desalojando siempre las
+// entradas usadas hace más tiempo (LRU).
+type janitor struct {
+	srv    *server
+	policy retentionPolicy
+	stats  *statsd
+}
+
+func newJanitor(srv *server, policy retentionPolicy, stats *statsd) *janitor {
+	return &janitor{srv: srv, policy: policy, stats: stats}
+}
+
+// run hace una pasada al arrancar (para aplicar enseguida una política nueva) y otra cada interval.
+func (j *janitor) run(interval time.Duration) {
+	j.pass(time.Now())
+	for now := range time.Tick(interval) {
+		j.pass(now)
+	}
+}
+
+func (j *janitor) pass(now time.Time) {
+	j.srv.sweep(now)
+	result := j.enforce(now)
+	if result == nil {
+		return
+	}
+
+	evicted, reclaimed := 0, int64(0)
+	for _, reason := range []string{evictAge, evictRepoQuota, evictTotalSize} {
+		if result.evicted[reason] > 0 {
+			j.stats.count("cache_proxy.evicted_entries", float64(result.evicted[reason]), "reason:"+reason)
+			j.stats.count("cache_proxy.reclaimed_bytes", float64(result.reclaimed[reason]), "reason:"+reason)
+		}
+		evicted += result.evicted[reason]
+		reclaimed += result.reclaimed[reason]
+	}
+	j.stats.gauge("cache_proxy.cache_entries", float64(result.entries))
+	j.stats.gauge("cache_proxy.cache_bytes", float64(result.bytes))
+	j.stats.gauge("cache_proxy.janitor_duration_ms", float64(time.Since(now).Milliseconds()))
+
+	if evicted > 0 {
+		log.Printf("🧹 Eliminadas %d entradas de caché (%d bytes): %d por antigüedad, %d por cuota de namespace, %d por tamaño total; quedan %d (%d bytes)",
+			evicted, reclaimed, result.evicted[evictAge], result.evicted[evictRepoQuota], result.evicted[evictTotalSize], result.entries, result.bytes)
+	}
+}
+
+// enforce lista la caché, guarda los últimos usos pendientes y desaloja según la política.
+// Devuelve nil si no se pudo listar la caché.
+func (j *janitor) enforce(now time.Time) *janitorRun {
+	result := &janitorRun{evicted: map[string]int{}, reclaimed: map[string]int64{}}
+	accessed := j.srv.takeAccesses()
+	objects, err := j.srv.store.List("entries/")
+	if err != nil {
+		log.Printf("⚠️ No se pudo listar la caché para la limpieza: %v", err)
+		j.stats.incr("cache_proxy.janitor_errors")
+		// Los usos no guardados se conservan para la siguiente pasada
+		j.srv.restoreAccesses(accessed)
+		return nil
+	}
+	sort.Strings(objects)
+
+	var entries []storedEntry
+	for _, object := range objects {
+		if !strings.HasSuffix(object, ".json") {
+			continue
+		}
+		entry, err := j.srv.readEntry(object)
+		if err != nil || entry == nil {
+			continue
+		}
+		// "entries/<namespace>/<version>/<key>.json": el namespace puede tener una '/'
+		parts := strings.Split(strings.TrimPrefix(object, "entries/"), "/")
+		if len(parts) < 3 {
+			continue
+		}
+		item := storedEntry{object: object, namespace: strings.Join(parts[:len(parts)-2], "/"), entry: entry}
+		if used, ok := accessed[object]; ok && used.After(entry.lastUsed()) {
+			entry.Accessed = used
+			j.srv.writeEntry(object, entry)
+		}
+		entries = append(entries, item)
+	}
+
+	// LRU: las usadas hace más tiempo primero
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].entry.lastUsed().Before(entries[b].entry.lastUsed())
+	})
+
+	kept := entries[:0]
+	for _, item := range entries {
+		if j.policy.maxAge > 0 && now.Sub(item.entry.lastUsed()) > j.policy.maxAge && j.evict(item, evictAge, result) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	entries = kept
+
+	if j.policy.maxRepoSize > 0 {
+		used := map[string]int64{}
+		for _, item := range entries {
+			used[item.namespace] += item.entry.Size
+		}
+		kept = entries[:0]
+		for _, item := range entries {
+			if used[item.namespace] > j.policy.maxRepoSize && j.evict(item, evictRepoQuota, result) {
+				used[item.namespace] -= item.entry.Size
+				continue
+			}
+			kept = append(kept, item)
+		}
+		entries = kept
+	}
+
+	var total int64
+	for _, item := range entries {
+		total += item.entry.Size
+	}
+	if j.policy.maxTotalSize > 0 {
+		kept = entries[:0]
+		for _, item := range entries {
+			if total > j.policy.maxTotalSize && j.evict(item, evictTotalSize, result) {
+				total -= item.entry.Size
+				continue
+			}
+			kept = append(kept, item)
+		}
+		entries = kept
+	}
+
+	result.entries = len(entries)
+	result.bytes = total
+	return result
+}
+
+// evict borra el archivo y después los metadatos; si falla, la entrada se conserva.
+func (j *janitor) evict(item storedEntry, reason string, result *janitorRun) bool {
+	if err := j.srv.store.Delete(archiveKey(item.namespace, item.entry.Archive)); err != nil {
+		log.Printf("⚠️ Error borrando %s: %v", item.object, err)
+		return false
+	}
+	if err := j.srv.store.Delete(item.object); err != nil {
+		log.Printf("⚠️ Error borrando %s: %v", item.object, err)
+		return false
+	}
+	result.evicted[reason]++
+	result.reclaimed[reason] += item.entry.Size
+	return true
+}
+
+// lastUsed es el último hit de la entrada o, si nunca lo tuvo, su creación.
+func (e *cacheEntry) lastUsed() time.Time {
+	if e.Accessed.After(e.Created) {
+		return e.Accessed
+	}
+	return e.Created
+}
+
+// touch anota un hit en memoria; el janitor lo guarda en los metadatos en su siguiente
+// pasada, así un hit no cuesta una escritura en el backend.
+func (s *server) touch(object string) {
+	s.accessMu.Lock()
+	s.accessed[object] = time.Now().UTC()
+	s.accessMu.Unlock()
+}
+
+func (s *server) takeAccesses() map[string]time.Time {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	accessed := s.accessed
+	s.accessed = map[string]time.Time{}
+	return accessed
+}
+
+func (s *server) restoreAccesses(accessed map[string]time.Time) {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	for object, used := range accessed {
+		if used.After(s.accessed[object]) {
+			s.accessed[object] = used
+		}
+	}
+}
+
+func (s *server) writeEntry(object string, entry *cacheEntry) {
+	data, _ := json.Marshal(entry)
+	if err := s.store.Put(object, strings.NewReader(string(data)), int64(len(data))); err != nil {
+		log.Printf("⚠️ No se pudo guardar el último uso de %s: %v", object, err)
+	}
+}
+
+// describe resume la política para el log de arranque.
+func (p retentionPolicy) describe() string {
+	limit := func(value int64, unit string) string {
+		if value <= 0 {
+			return "sin límite"
+		}
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+	age := "sin límite"
+	if p.maxAge > 0 {
+		age = p.maxAge.String()
+	}
+	return fmt.Sprintf("antigüedad %s, namespace %s, total %s", age, limit(p.maxRepoSize, "bytes"), limit(p.maxTotalSize, "bytes"))
+}
@@ -0,0 +1,205 @@
+// cache-proxy implementa la API de caché de GitHub Actions (ACTIONS_CACHE_URL) sobre
+// S3, GCS o MinIO, para que los actions/cache de los runners efímeros se sirvan
+// dentro de la región en lugar de descargarse desde GitHub.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/logfile"
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func newStore() (Store, error) {
+	switch backend := envOr("CACHE_BACKEND", "filesystem"); backend {
+	case "filesystem":
+		return newFSStore(envOr("CACHE_DIR", "/data"))
+	case "s3":
+		return newS3Store(
+			os.Getenv("CACHE_S3_ENDPOINT"),
+			os.Getenv("CACHE_S3_BUCKET"),
+			envOr("CACHE_S3_REGION", "us-east-1"),
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			os.Getenv("AWS_SESSION_TOKEN"),
+		)
+	default:
+		return nil, fmt.Errorf("CACHE_BACKEND inválido: %q (filesystem o s3)", backend)
+	}
+}
+
+// healthcheck consulta /healthz del propio servicio (HEALTHCHECK de la imagen sin shell).
+func healthcheck(port string) int {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("http://localhost:" + port + "/healthz")
+	if err != nil {
+		log.Printf("Health check failed: %v", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Health check failed: status %d", resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// openLog abre un log en archivo con la rotación y retención de LOG_* (pkg/logfile).
+func openLog(path string) *logfile.File {
+	opts, err := logfile.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	file, err := logfile.Open(path, opts)
+	if err != nil {
+		log.Fatalf("❌ No se pudo abrir %s: %v", path, err)
+	}
+	return file
+}
+
+// rotateOnHangup rota los logs en archivo con cada SIGHUP, para un logrotate externo
+// (postrotate: docker kill -s HUP gha-cache-proxy) además de la rotación propia.
+func rotateOnHangup(files ...*logfile.File) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		for _, file := range files {
+			if file == nil {
+				continue
+			}
+			if err := file.Rotate(); err != nil {
+				log.Printf("⚠️ No se pudo rotar el log: %v", err)
+			}
+		}
+		log.Printf("🔄 Logs rotados (SIGHUP)")
+	}
+}
+
+func main() {
+	port := envOr("CACHE_PROXY_PORT", "8090")
+	check := flag.Bool("healthcheck", false, "Comprobar la salud del servicio y salir")
+	flag.Parse()
+	if *check {
+		os.Exit(healthcheck(port))
+	}
+
+	// Además de stderr (docker logs), en un archivo con rotación propia
+	var logFile, accessFile *logfile.File
+	if path := os.Getenv("CACHE_PROXY_LOG_FILE"); path != "" {
+		logFile = openLog(path)
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
+
+	store, err := newStore()
+	if err != nil {
+		log.Fatalf("❌ Error de configuración: %v", err)
+	}
+
+	maxSize, err := strconv.ParseInt(envOr("CACHE_MAX_ENTRY_SIZE", "10737418240"), 10, 64)
+	if err != nil {
+		log.Fatalf("❌ CACHE_MAX_ENTRY_SIZE inválido: %v", err)
+	}
+	retentionDays, err := strconv.Atoi(envOr("CACHE_RETENTION_DAYS", "7"))
+	if err != nil {
+		log.Fatalf("❌ CACHE_RETENTION_DAYS inválido: %v", err)
+	}
+	policy := retentionPolicy{maxAge: time.Duration(retentionDays) * 24 * time.Hour}
+	if policy.maxRepoSize, err = strconv.ParseInt(envOr("CACHE_MAX_REPO_SIZE", "0"), 10, 64); err != nil {
+		log.Fatalf("❌ CACHE_MAX_REPO_SIZE inválido: %v", err)
+	}
+	if policy.maxTotalSize, err = strconv.ParseInt(envOr("CACHE_MAX_TOTAL_SIZE", "0"), 10, 64); err != nil {
+		log.Fatalf("❌ CACHE_MAX_TOTAL_SIZE inválido: %v", err)
+	}
+	janitorInterval, err := time.ParseDuration(envOr("CACHE_JANITOR_INTERVAL", "1h"))
+	if err != nil || janitorInterval <= 0 {
+		log.Fatalf("❌ CACHE_JANITOR_INTERVAL inválido: %q", os.Getenv("CACHE_JANITOR_INTERVAL"))
+	}
+
+	// Las partes de cada subida se reúnen en disco antes de enviarlas al backend
+	uploadsDir := envOr("CACHE_UPLOADS_DIR", filepath.Join(os.TempDir(), "cache-proxy-uploads"))
+	if err := os.MkdirAll(uploadsDir, 0o750); err != nil {
+		log.Fatalf("❌ No se pudo crear %s: %v", uploadsDir, err)
+	}
+
+	secret := os.Getenv("CACHE_PROXY_SECRET")
+	if secret == "" {
+		log.Printf("⚠️ CACHE_PROXY_SECRET no configurado: cualquier runner puede acceder a la caché de cualquier repositorio")
+	}
+
+	stats := newStatsD()
+	srv := newServer(store, secret, maxSize, uploadsDir)
+	log.Printf("🧹 Retención de la caché cada %s: %s", janitorInterval, policy.describe())
+	go newJanitor(srv, policy, stats).run(janitorInterval)
+
+	// Reinicio controlado: se dejan de aceptar conexiones, se terminan las peticiones en
+	// curso y el proceso sale con error para que Docker lo reinicie (restart: unless-stopped)
+	httpServer := &http.Server{Addr: ":" + port}
+	restart := make(chan string, 1)
+	limits, err := watchdog.LimitsFromEnv("CACHE_PROXY", watchdog.DefaultLimits)
+	if err != nil {
+		log.Fatalf("❌ Error de configuración: %v", err)
+	}
+	wd := watchdog.New("cache_proxy", limits, stats, func(reason string) {
+		select {
+		case restart <- reason:
+		default:
+		}
+	})
+	httpServer.Handler = shedLoad(wd, srv)
+	if path := os.Getenv("CACHE_PROXY_ACCESS_LOG"); path != "" {
+		// Fuera del watchdog, para registrar también las peticiones rechazadas por sobrecarga
+		accessFile = openLog(path)
+		httpServer.Handler = accessLog(httpServer.Handler, accessFile, secret != "")
+	}
+	go wd.Run(context.Background())
+	if logFile != nil || accessFile != nil {
+		go rotateOnHangup(logFile, accessFile)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		reason := <-restart
+		log.Printf("🔄 Reinicio controlado del cache-proxy: %s", reason)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("⚠️ Peticiones interrumpidas en el reinicio: %v", err)
+		}
+		close(stopped)
+	}()
+
+	log.Printf("🚀 cache-proxy escuchando en :%s (backend %s)", port, envOr("CACHE_BACKEND", "filesystem"))
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
+	// os.Exit no ejecuta los defer: se cierran los logs para no cortar una compresión en
+	// curso ni perder las últimas líneas de acceso
+	if accessFile != nil {
+		accessFile.Close()
+	}
+	if logFile != nil {
+		log.SetOutput(os.Stderr)
+		logFile.Close()
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Store habla la API de S3 con firma SigV4 y direccionamiento path-style, lo que
+// cubre AWS S3, MinIO y GCS (API XML con claves HMAC de interoperabilidad).
+type s3Store struct {
+	endpoint     *url.URL
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// Los cuerpos se envían en streaming sin calcular su hash (requiere HTTPS en AWS)
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func newS3Store(endpoint, bucket, region, accessKey, secretKey, sessionToken string) (*s3Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("CACHE_S3_BUCKET es obligatorio con CACHE_BACKEND=s3")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY son obligatorios con CACHE_BACKEND=s3")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	parsed, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("CACHE_S3_ENDPOINT inválido: %q", endpoint)
+	}
+	return &s3Store{
+		endpoint:     parsed,
+		bucket:       bucket,
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		// Sin timeout global: los archivos de caché pueden tardar minutos en transferirse
+		client: &http.Client{},
+	}, nil
+}
+
+func (s *s3Store) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket + "/" + key
+	u.RawPath = "/" + s.bucket + "/" + s3Escape(key, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (s *s3Store) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+func (s *s3Store) Put(key string, body io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, key, nil, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(resp)
+}
+
+func (s *s3Store) Get(key string) (io.ReadCloser, int64, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, errNotFound
+	}
+	if err := s3Error(resp); err != nil {
+		resp.Body.Close()
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (s *s3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s3Error(resp)
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Store) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err := s3Error(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Contents {
+			keys = append(keys, item.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s %s: HTTP %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// sign añade la firma AWS Signature Version 4 a la petición.
+func (s *s3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(req.Header.Get(name)))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Escape codifica según SigV4: todo salvo A-Z a-z 0-9 - _ . ~ (y '/' en rutas).
+func s3Escape(value string, encodeSlash bool) string {
+	var out strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
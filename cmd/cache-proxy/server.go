@@ -0,0 +1,439 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefijo de la API de caché de Actions (v1) que el runner añade a ACTIONS_CACHE_URL.
+const apiPrefix = "/_apis/artifactcache/"
+
+// Namespaces válidos: "owner/repo" u "org" en minúsculas.
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*(/[a-z0-9._-]+)?$`)
+
+// Formato de Content-Range de las subidas por partes: "bytes 0-1023/*".
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-(\d+)/`)
+
+// cacheEntry son los metadatos de una entrada confirmada.
+type cacheEntry struct {
+	Key     string    `json:"key"`
+	Version string    `json:"version"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Archive string    `json:"archive"`
+	// Accessed es el último hit guardado por el janitor (LRU); las entradas antiguas no lo tienen
+	Accessed time.Time `json:"accessed"`
+}
+
+// upload es una reserva en curso: las partes se escriben en un archivo temporal y
+// se sube el archivo completo al backend al confirmar.
+type upload struct {
+	namespace string
+	key       string
+	version   string
+	file      *os.File
+	created   time.Time
+}
+
+type server struct {
+	store      Store
+	secret     string
+	maxSize    int64
+	uploadsDir string
+
+	mu      sync.Mutex
+	uploads map[int64]*upload
+
+	// Últimos hits aún no guardados en los metadatos, por objeto de metadatos
+	accessMu sync.Mutex
+	accessed map[string]time.Time
+}
+
+func newServer(store Store, secret string, maxSize int64, uploadsDir string) *server {
+	return &server{
+		store:      store,
+		secret:     secret,
+		maxSize:    maxSize,
+		uploadsDir: uploadsDir,
+		uploads:    map[int64]*upload{},
+		accessed:   map[string]time.Time{},
+	}
+}
+
+// namespaceToken es la firma que el orquestador incluye en ACTIONS_CACHE_URL para que un
+// job no pueda leer ni escribir la caché de otro repositorio cambiando la URL.
+func namespaceToken(secret, namespace string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(namespace))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// entryPrefix usa claves escapadas: el escapado es carácter a carácter, así que el
+// prefijo de una clave escapada es el escapado del prefijo (búsqueda por restore-keys).
+func entryPrefix(namespace, version, key string) string {
+	return "entries/" + namespace + "/" + url.PathEscape(version) + "/" + url.PathEscape(key)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+		return
+	}
+	index := strings.Index(r.URL.Path, apiPrefix)
+	if index < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, err := s.namespace(r.URL.Path[:index])
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	route := strings.TrimPrefix(r.URL.Path[index:], apiPrefix)
+
+	switch {
+	case route == "cache" && r.Method == http.MethodGet:
+		s.lookup(w, r, namespace)
+	case route == "caches" && r.Method == http.MethodPost:
+		s.reserve(w, r, namespace)
+	case strings.HasPrefix(route, "caches/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(route, "caches/"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			s.uploadChunk(w, r, namespace, id)
+		case http.MethodPost:
+			s.commit(w, r, namespace, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case strings.HasPrefix(route, "archives/") && r.Method == http.MethodGet:
+		s.download(w, r, namespace, strings.TrimPrefix(route, "archives/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// namespace valida el prefijo de la URL: "/<owner>/<repo>" o, con CACHE_PROXY_SECRET,
+// "/<token>/<owner>/<repo>".
+func (s *server) namespace(prefix string) (string, error) {
+	namespace := strings.Trim(prefix, "/")
+	if s.secret != "" {
+		token, rest, _ := strings.Cut(namespace, "/")
+		if !hmac.Equal([]byte(token), []byte(namespaceToken(s.secret, rest))) {
+			return "", errors.New("token de namespace inválido")
+		}
+		namespace = rest
+	}
+	if !namespacePattern.MatchString(namespace) {
+		return "", fmt.Errorf("namespace inválido: %q", namespace)
+	}
+	return namespace, nil
+}
+
+// lookup busca la primera clave de keys con una entrada exacta o, si no hay, por prefijo
+// (la más reciente), igual que la API de GitHub con restore-keys.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request, namespace string) {
+	version := r.URL.Query().Get("version")
+	keys := strings.Split(r.URL.Query().Get("keys"), ",")
+	for i, key := range keys {
+		if key == "" {
+			continue
+		}
+		var entry *cacheEntry
+		var err error
+		if i == 0 {
+			entry, err = s.readEntry(entryPrefix(namespace, version, key) + ".json")
+		}
+		if entry == nil && err == nil {
+			entry, err = s.newestWithPrefix(namespace, version, key)
+		}
+		if err != nil {
+			log.Printf("❌ Error buscando %q en %s: %v", key, namespace, err)
+			writeError(w, http.StatusInternalServerError, "error consultando el almacenamiento")
+			return
+		}
+		if entry == nil {
+			continue
+		}
+		log.Printf("✅ Hit %s %q (%d bytes)", namespace, entry.Key, entry.Size)
+		s.touch(entryPrefix(namespace, entry.Version, entry.Key) + ".json")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"cacheKey":        entry.Key,
+			"scope":           namespace,
+			"creationTime":    entry.Created.Format(time.RFC3339),
+			"archiveLocation": archiveURL(r, entry.Archive),
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) readEntry(objectKey string) (*cacheEntry, error) {
+	body, _, err := s.store.Get(objectKey)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var entry cacheEntry
+	if err := json.NewDecoder(body).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *server) newestWithPrefix(namespace, version, key string) (*cacheEntry, error) {
+	objects, err := s.store.List(entryPrefix(namespace, version, key))
+	if err != nil {
+		return nil, err
+	}
+	var newest *cacheEntry
+	for _, object := range objects {
+		if !strings.HasSuffix(object, ".json") {
+			continue
+		}
+		entry, err := s.readEntry(object)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil && (newest == nil || entry.Created.After(newest.Created)) {
+			newest = entry
+		}
+	}
+	return newest, nil
+}
+
+// archiveURL es la URL de descarga relativa a la URL con la que llegó la consulta,
+// de modo que incluye el mismo namespace (y token).
+func archiveURL(r *http.Request, archive string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	base := r.URL.Path[:strings.Index(r.URL.Path, apiPrefix)]
+	return fmt.Sprintf("%s://%s%s%sarchives/%s", scheme, r.Host, base, apiPrefix, url.PathEscape(archive))
+}
+
+func (s *server) reserve(w http.ResponseWriter, r *http.Request, namespace string) {
+	var request struct {
+		Key       string `json:"key"`
+		Version   string `json:"version"`
+		CacheSize int64  `json:"cacheSize"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Key == "" || request.Version == "" {
+		writeError(w, http.StatusBadRequest, "se requieren key y version")
+		return
+	}
+	if s.maxSize > 0 && request.CacheSize > s.maxSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("la entrada supera CACHE_MAX_ENTRY_SIZE (%d bytes)", s.maxSize))
+		return
+	}
+
+	existing, err := s.readEntry(entryPrefix(namespace, request.Version, request.Key) + ".json")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "error consultando el almacenamiento")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Como en GitHub, las entradas son inmutables: 409 si ya existe o se está subiendo
+	conflict := existing != nil
+	for _, pending := range s.uploads {
+		if pending.namespace == namespace && pending.key == request.Key && pending.version == request.Version {
+			conflict = true
+		}
+	}
+	if conflict {
+		writeError(w, http.StatusConflict, fmt.Sprintf("la entrada %q ya existe", request.Key))
+		return
+	}
+
+	file, err := os.CreateTemp(s.uploadsDir, "upload-*")
+	if err != nil {
+		log.Printf("❌ Error creando archivo temporal: %v", err)
+		writeError(w, http.StatusInternalServerError, "error reservando la entrada")
+		return
+	}
+	id := newCacheID()
+	s.uploads[id] = &upload{namespace: namespace, key: request.Key, version: request.Version, file: file, created: time.Now()}
+	writeJSON(w, http.StatusCreated, map[string]int64{"cacheId": id})
+}
+
+func (s *server) pending(namespace string, id int64) *upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.uploads[id]
+	if pending == nil || pending.namespace != namespace {
+		return nil
+	}
+	return pending
+}
+
+func (s *server) uploadChunk(w http.ResponseWriter, r *http.Request, namespace string, id int64) {
+	pending := s.pending(namespace, id)
+	if pending == nil {
+		writeError(w, http.StatusNotFound, "reserva no encontrada")
+		return
+	}
+	match := contentRangePattern.FindStringSubmatch(r.Header.Get("Content-Range"))
+	if match == nil {
+		writeError(w, http.StatusBadRequest, "Content-Range inválido")
+		return
+	}
+	start, _ := strconv.ParseInt(match[1], 10, 64)
+	end, _ := strconv.ParseInt(match[2], 10, 64)
+	if end < start || (s.maxSize > 0 && end >= s.maxSize) {
+		writeError(w, http.StatusBadRequest, "Content-Range fuera de rango")
+		return
+	}
+	// Las partes llegan en paralelo: cada una se escribe en su posición
+	written, err := io.Copy(io.NewOffsetWriter(pending.file, start), io.LimitReader(r.Body, end-start+1))
+	if err != nil || written != end-start+1 {
+		writeError(w, http.StatusBadRequest, "parte incompleta")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) commit(w http.ResponseWriter, r *http.Request, namespace string, id int64) {
+	var request struct {
+		Size int64 `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "se requiere size")
+		return
+	}
+	pending := s.pending(namespace, id)
+	if pending == nil {
+		writeError(w, http.StatusNotFound, "reserva no encontrada")
+		return
+	}
+	defer s.discard(id)
+
+	info, err := pending.file.Stat()
+	if err != nil || info.Size() != request.Size {
+		writeError(w, http.StatusBadRequest, "el tamaño no coincide con las partes recibidas")
+		return
+	}
+	if _, err := pending.file.Seek(0, io.SeekStart); err != nil {
+		writeError(w, http.StatusInternalServerError, "error leyendo la subida")
+		return
+	}
+
+	now := time.Now().UTC()
+	entry := cacheEntry{
+		Key:      pending.key,
+		Version:  pending.version,
+		Size:     request.Size,
+		Created:  now,
+		Archive:  strconv.FormatInt(id, 10),
+		Accessed: now,
+	}
+	if err := s.store.Put(archiveKey(namespace, entry.Archive), pending.file, request.Size); err != nil {
+		log.Printf("❌ Error subiendo %q de %s: %v", entry.Key, namespace, err)
+		writeError(w, http.StatusBadGateway, "error escribiendo en el almacenamiento")
+		return
+	}
+	data, _ := json.Marshal(entry)
+	if err := s.store.Put(entryPrefix(namespace, entry.Version, entry.Key)+".json", strings.NewReader(string(data)), int64(len(data))); err != nil {
+		log.Printf("❌ Error guardando metadatos de %q en %s: %v", entry.Key, namespace, err)
+		writeError(w, http.StatusBadGateway, "error escribiendo en el almacenamiento")
+		return
+	}
+	log.Printf("💾 Guardado %s %q (%d bytes)", namespace, entry.Key, entry.Size)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func archiveKey(namespace, archive string) string {
+	return "archives/" + namespace + "/" + archive
+}
+
+func (s *server) download(w http.ResponseWriter, r *http.Request, namespace, archive string) {
+	if _, err := strconv.ParseInt(archive, 10, 64); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, size, err := s.store.Get(archiveKey(namespace, archive))
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error descargando %s/%s: %v", namespace, archive, err)
+		writeError(w, http.StatusBadGateway, "error leyendo el almacenamiento")
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+func (s *server) discard(id int64) {
+	s.mu.Lock()
+	pending := s.uploads[id]
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	if pending != nil {
+		pending.file.Close()
+		os.Remove(pending.file.Name())
+	}
+}
+
+// sweep descarta las reservas abandonadas; la retención de las entradas es cosa del janitor.
+func (s *server) sweep(now time.Time) {
+	s.mu.Lock()
+	var abandoned []int64
+	for id, pending := range s.uploads {
+		if now.Sub(pending.created) > 6*time.Hour {
+			abandoned = append(abandoned, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range abandoned {
+		s.discard(id)
+	}
+}
+
+func newCacheID() int64 {
+	var buf [8]byte
+	rand.Read(buf[:])
+	// El cliente de Actions espera un entero positivo que quepa en un double
+	return int64(binary.BigEndian.Uint64(buf[:]) >> 12)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// statsd emite métricas por UDP con la misma configuración que el orchestrator
+// (STATSD_ENABLED, STATSD_HOST, STATSD_PORT, STATSD_PREFIX, STATSD_TAGS).
+type statsd struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// newStatsD devuelve nil si STATSD_ENABLED no está activo; un statsd nil no emite nada.
+func newStatsD() *statsd {
+	if strings.ToLower(os.Getenv("STATSD_ENABLED")) != "true" {
+		return nil
+	}
+	address := net.JoinHostPort(envOr("STATSD_HOST", "localhost"), envOr("STATSD_PORT", "8125"))
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		log.Printf("⚠️ StatsD no disponible en %s: %v", address, err)
+		return nil
+	}
+
+	tags := map[string]string{"service": "cache-proxy"}
+	for _, item := range strings.Split(os.Getenv("STATSD_TAGS"), ",") {
+		if key, value, _ := strings.Cut(strings.TrimSpace(item), ":"); key != "" {
+			tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	var pairs []string
+	for key, value := range tags {
+		pairs = append(pairs, key+":"+value)
+	}
+	sort.Strings(pairs)
+
+	s := &statsd{conn: conn, prefix: strings.TrimSuffix(envOr("STATSD_PREFIX", "gha_runners"), ".")}
+	// StatsD clásico no soporta tags, solo DogStatsD
+	if strings.ToLower(envOr("STATSD_DOGSTATSD", "true")) == "true" {
+		s.tags = "|#" + strings.Join(pairs, ",")
+	}
+	log.Printf("📊 StatsD activado: %s", address)
+	return s
+}
+
+func (s *statsd) send(name string, value float64, kind string, tags ...string) {
+	if s == nil {
+		return
+	}
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+	allTags := s.tags
+	if allTags != "" && len(tags) > 0 {
+		allTags += "," + strings.Join(tags, ",")
+	}
+	// Los errores de red nunca interrumpen el servicio
+	fmt.Fprintf(s.conn, "%s:%g|%s%s", name, value, kind, allTags)
+}
+
+func (s *statsd) gauge(name string, value float64) { s.send(name, value, "g") }
+
+func (s *statsd) incr(name string) { s.send(name, 1, "c") }
+
+// count suma value a un contador, con tags propios además de los globales (solo DogStatsD).
+func (s *statsd) count(name string, value float64, tags ...string) { s.send(name, value, "c", tags...) }
+
+// Gauge e Incr son la interfaz watchdog.Metrics.
+func (s *statsd) Gauge(name string, value float64) { s.gauge(name, value) }
+
+func (s *statsd) Incr(name string) { s.incr(name) }
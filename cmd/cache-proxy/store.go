@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNotFound indica que el objeto no existe en el backend.
+var errNotFound = errors.New("objeto no encontrado")
+
+// Store es el almacenamiento de objetos de la caché: S3 (o compatible) o disco local.
+// Las claves usan '/' como separador en todos los backends.
+type Store interface {
+	Put(key string, body io.Reader, size int64) error
+	Get(key string) (io.ReadCloser, int64, error)
+	Delete(key string) error
+	// List devuelve las claves que empiezan por prefix.
+	List(prefix string) ([]string, error)
+}
+
+// fsStore guarda los objetos como archivos bajo un directorio.
+type fsStore struct {
+	root string
+}
+
+func newFSStore(root string) (*fsStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &fsStore{root: root}, nil
+}
+
+func (s *fsStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *fsStore) Put(key string, body io.Reader, _ int64) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	// Escritura atómica: un lector nunca ve un archivo a medias
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fsStore) Get(key string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, errNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func (s *fsStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *fsStore) List(prefix string) ([]string, error) {
+	// Se recorre el directorio que contiene el prefijo y se filtra por nombre
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = s.path(prefix[:i])
+	}
+	var keys []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+// shedLoad rechaza con 503 las peticiones a la caché mientras el watchdog tenga umbrales
+// superados. El cliente de actions/cache trata el error como un fallo de caché y el job
+// continúa.
+func shedLoad(wd *watchdog.Watchdog, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			writeJSON(rw, http.StatusOK, map[string]any{"status": "healthy", "watchdog": wd.Status()})
+			return
+		}
+		if !wd.Admit() {
+			rw.Header().Set("Retry-After", "30")
+			writeError(rw, http.StatusServiceUnavailable, "cache-proxy sobrecargado, reintentar más tarde")
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
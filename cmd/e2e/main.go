@@ -0,0 +1,149 @@
+// e2e levanta el stack completo en local (API de GitHub simulada, orchestrator con el
+// autoscaler activado, API Gateway y runners en el Docker local) y recorre el ciclo de
+// vida de un job: webhook en cola -> aparece el runner -> el job termina -> el runner
+// desaparece, comprobando los invariantes en cada paso. Pensado para que cualquier
+// colaborador valide un cambio antes de abrir el PR, sin credenciales de GitHub.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const usage = `e2e - prueba de extremo a extremo del stack contra el Docker local
+
+Uso:
+  e2e [opciones]
+
+Arranca una API de GitHub simulada (pkg/githubmock), el orchestrator y el API Gateway
+como procesos Python del repositorio y recorre el escenario:
+
+  1. Webhooks workflow_job "queued" (más una entrega repetida) -> un runner por job
+  2. El runner se registra y toma el job ("in_progress")
+  3. Webhook "completed" -> el orchestrator destruye el runner
+  4. Ejecución en cola sin webhook -> el autoscaler crea el runner
+  5. El runner efímero termina -> la limpieza lo elimina
+  6. Invariantes finales: sin contenedores ni runners en GitHub, servicios sanos
+
+Los runners usan -runner-image con -runner-command (no se registran de verdad). Los
+servicios necesitan sus dependencias instaladas (pip install -r requirements.txt) y el
+Docker de DOCKER_HOST no debe tener otros contenedores gha-ephemeral.
+
+Opciones:
+`
+
+// config son las opciones de la prueba.
+type config struct {
+	repoRoot       string
+	python         string
+	docker         string
+	image          string
+	command        string
+	jobs           int
+	checkInterval  int
+	stepTimeout    time.Duration
+	startupTimeout time.Duration
+	logDir         string
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("e2e", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var cfg config
+	fs.StringVar(&cfg.repoRoot, "repo", envOr("E2E_REPO_ROOT", "."), "Raíz del repositorio, con orchestrator/ y api-gateway/ (E2E_REPO_ROOT)")
+	fs.StringVar(&cfg.python, "python", envOr("E2E_PYTHON", "python3"), "Intérprete con las dependencias de los servicios (E2E_PYTHON)")
+	fs.StringVar(&cfg.docker, "docker", envOr("E2E_DOCKER", "docker"), "CLI de Docker; respeta DOCKER_HOST (E2E_DOCKER)")
+	fs.StringVar(&cfg.image, "runner-image", envOr("E2E_RUNNER_IMAGE", "alpine:3.20"), "Imagen de los runners de prueba (E2E_RUNNER_IMAGE)")
+	fs.StringVar(&cfg.command, "runner-command", "sleep 600", "Comando de los runners de prueba (RUNNER_COMMAND)")
+	fs.IntVar(&cfg.jobs, "jobs", 2, "Jobs simultáneos encolados por webhook")
+	fs.IntVar(&cfg.checkInterval, "check-interval", 10, "Ciclo del autoscaler en segundos (RUNNER_CHECK_INTERVAL)")
+	fs.DurationVar(&cfg.stepTimeout, "step-timeout", 2*time.Minute, "Espera máxima de cada paso")
+	fs.DurationVar(&cfg.startupTimeout, "startup-timeout", 90*time.Second, "Espera máxima a que los servicios respondan")
+	fs.StringVar(&cfg.logDir, "logs", os.Getenv("E2E_LOG_DIR"), "Directorio de logs de los servicios (E2E_LOG_DIR; vacío: uno temporal)")
+	output := fs.String("o", "table", "Formato del informe: table o json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("formato de salida no soportado: %s (table, json)", *output)
+	}
+	if cfg.jobs < 1 || cfg.jobs > 10 {
+		return errors.New("-jobs debe estar entre 1 y 10")
+	}
+	if cfg.checkInterval < 1 {
+		return errors.New("-check-interval debe ser positivo")
+	}
+	root, err := filepath.Abs(cfg.repoRoot)
+	if err != nil {
+		return err
+	}
+	cfg.repoRoot = root
+	for _, service := range []string{"orchestrator", "api-gateway"} {
+		if _, err := os.Stat(filepath.Join(root, service, "main.py")); err != nil {
+			return fmt.Errorf("%s no parece la raíz del repositorio (falta %s/main.py); usa -repo", root, service)
+		}
+	}
+	if cfg.logDir == "" {
+		if cfg.logDir, err = os.MkdirTemp("", "gha-e2e-"); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(cfg.logDir, 0o755); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	st, err := startStack(ctx, cfg)
+	if st != nil {
+		// Se para también si el arranque falló a medias: el orchestrator purga sus runners
+		defer st.stop()
+	}
+	if err != nil {
+		log.Printf("📄 Logs de los servicios en %s", cfg.logDir)
+		return err
+	}
+
+	results := newScenario(st).run(ctx)
+	log.Printf("📄 Logs de los servicios en %s", cfg.logDir)
+	if err := printReport(stdout, *output, results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if !result.OK {
+			return fmt.Errorf("paso fallido: %s", result.Step)
+		}
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/githubmock"
+)
+
+const (
+	e2eRepo = "e2e-org/app"
+	// Lo que lee el autoscaler para saber que el repositorio usa runners self-hosted
+	e2eWorkflow = "on: push\njobs:\n  build:\n    runs-on: [self-hosted, linux]\n    steps:\n      - run: make\n"
+)
+
+var jobLabels = []string{"self-hosted", "linux"}
+
+// result es el resultado de un paso del escenario.
+type result struct {
+	Step     string        `json:"step"`
+	OK       bool          `json:"ok"`
+	Duration time.Duration `json:"duration"`
+	Detail   string        `json:"detail"`
+}
+
+// job es un workflow_job del escenario con su ejecución en GitHub simulado.
+type job struct {
+	ID       int64
+	Run      int64
+	Delivery string
+	Runner   string
+}
+
+// scenario recorre el ciclo de vida de los jobs contra el stack.
+type scenario struct {
+	st     *stack
+	scope  string
+	jobs   []*job
+	scaled *job
+}
+
+func newScenario(st *stack) *scenario {
+	st.gh.AddRepo(e2eRepo)
+	st.gh.AddWorkflow(e2eRepo, "ci.yml", e2eWorkflow)
+	return &scenario{st: st, scope: "repos/" + e2eRepo}
+}
+
+// run ejecuta los pasos en orden y se detiene en el primero que falla: los siguientes
+// dependen de su estado.
+func (sc *scenario) run(ctx context.Context) []result {
+	steps := []struct {
+		name string
+		fn   func(context.Context) (string, error)
+	}{
+		{"Webhooks queued: un runner por job", sc.queueJobs},
+		{"Jobs en ejecución en su runner", sc.startJobs},
+		{"Webhooks completed: runners destruidos", sc.completeJobs},
+		{"Autoscaler: runner para una ejecución en cola", sc.autoscale},
+		{"Runner efímero terminado: limpieza", sc.finishScaled},
+		{"Invariantes finales", sc.invariants},
+	}
+
+	var results []result
+	for _, step := range steps {
+		log.Printf("▶️ %s", step.name)
+		start := time.Now()
+		detail, err := step.fn(ctx)
+		res := result{Step: step.name, OK: err == nil, Duration: time.Since(start).Round(time.Millisecond), Detail: detail}
+		if err != nil {
+			res.Detail = err.Error()
+			log.Printf("❌ %s: %v", step.name, err)
+		}
+		results = append(results, res)
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+// queueJobs encola los jobs como lo hace GitHub (la ejecución queda en cola y llega el
+// webhook) y comprueba que cada uno obtiene exactamente un runner, también con una
+// entrega repetida y con el autoscaler viendo las mismas ejecuciones en cola.
+func (sc *scenario) queueJobs(ctx context.Context) (string, error) {
+	base := time.Now().UnixMilli()
+	for i := 0; i < sc.st.cfg.jobs; i++ {
+		j := &job{ID: base + int64(i), Delivery: randomHex(16)}
+		j.Run = sc.st.gh.QueueRun(e2eRepo, "queued")
+		sc.jobs = append(sc.jobs, j)
+	}
+
+	// El orchestrator responde al webhook cuando el contenedor ya está creado
+	errs := make([]error, len(sc.jobs))
+	var wg sync.WaitGroup
+	for i, j := range sc.jobs {
+		wg.Add(1)
+		go func(i int, j *job) {
+			defer wg.Done()
+			data, err := sc.webhook(ctx, j, "queued", j.Delivery)
+			if err == nil {
+				j.Runner, err = createdRunner(data)
+			}
+			errs[i] = err
+		}(i, j)
+	}
+
+	// Mientras tanto el runner arranca, se registra y toma su job: sin ejecuciones en
+	// curso la limpieza del orchestrator lo daría por ocioso
+	err := sc.waitFor(ctx, "contenedores de runner en marcha", func() (bool, error) {
+		running, err := sc.running(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range running {
+			sc.register(c.Runner)
+		}
+		return len(running) >= len(sc.jobs), nil
+	})
+	for _, j := range sc.jobs {
+		sc.st.gh.SetRunStatus(e2eRepo, j.Run, "in_progress")
+	}
+	wg.Wait()
+	if err != nil {
+		return "", err
+	}
+	for i, err := range errs {
+		if err != nil {
+			return "", fmt.Errorf("webhook queued del job %d: %w", sc.jobs[i].ID, err)
+		}
+	}
+
+	// GitHub repite entregas: la misma no debe crear un segundo runner
+	data, err := sc.webhook(ctx, sc.jobs[0], "queued", sc.jobs[0].Delivery)
+	if err != nil {
+		return "", fmt.Errorf("entrega repetida: %w", err)
+	}
+	if data["action"] != "duplicate" {
+		return "", fmt.Errorf("entrega repetida no reconocida como duplicada: %v", data["action"])
+	}
+
+	// Unos ciclos del autoscaler con las ejecuciones visibles en GitHub
+	if err := sc.settle(ctx); err != nil {
+		return "", err
+	}
+	running, err := sc.running(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(running) != len(sc.jobs) {
+		return "", fmt.Errorf("%d contenedores para %d jobs: %s", len(running), len(sc.jobs), runnerNames(running))
+	}
+	for _, j := range sc.jobs {
+		if !hasRunner(running, j.Runner) {
+			return "", fmt.Errorf("el runner %s del job %d no tiene contenedor (%s)", j.Runner, j.ID, runnerNames(running))
+		}
+	}
+	tokens := sc.st.gh.Count(http.MethodPost, "/"+sc.scope+"/actions/runners/registration-token") +
+		sc.st.gh.Count(http.MethodPost, "/"+sc.scope+"/actions/runners/generate-jitconfig")
+	if tokens < len(sc.jobs) {
+		return "", fmt.Errorf("%d tokens de registro pedidos a GitHub para %d runners", tokens, len(sc.jobs))
+	}
+	return fmt.Sprintf("%d jobs, %d contenedores, %d tokens de registro, entrega repetida ignorada", len(sc.jobs), len(running), tokens), nil
+}
+
+// startJobs envía los webhooks in_progress con el runner que tomó cada job.
+func (sc *scenario) startJobs(ctx context.Context) (string, error) {
+	for _, j := range sc.jobs {
+		sc.st.gh.SetRunnerStatus(sc.scope, j.Runner, "online", true)
+		data, err := sc.webhook(ctx, j, "in_progress", randomHex(16))
+		if err != nil {
+			return "", fmt.Errorf("webhook in_progress del job %d: %w", j.ID, err)
+		}
+		if data["action"] != "job_started" {
+			return "", fmt.Errorf("webhook in_progress del job %d: acción %v", j.ID, data["action"])
+		}
+	}
+	running, err := sc.running(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(running) != len(sc.jobs) {
+		return "", fmt.Errorf("%d contenedores en marcha con %d jobs en ejecución", len(running), len(sc.jobs))
+	}
+	return fmt.Sprintf("%d runners ocupados", len(running)), nil
+}
+
+// completeJobs termina los jobs: el runner efímero se da de baja en GitHub y el webhook
+// completed hace que el orchestrator destruya su contenedor.
+func (sc *scenario) completeJobs(ctx context.Context) (string, error) {
+	actions := map[string]int{}
+	for _, j := range sc.jobs {
+		sc.st.gh.RemoveRunner(sc.scope, j.Runner)
+		data, err := sc.webhook(ctx, j, "completed", randomHex(16))
+		if err != nil {
+			return "", fmt.Errorf("webhook completed del job %d: %w", j.ID, err)
+		}
+		// La respuesta lleva la acción del orchestrator: torn_down, o gone si la limpieza se adelantó
+		action := fmt.Sprint(data["action"])
+		if action != "torn_down" && action != "gone" {
+			return "", fmt.Errorf("webhook completed del job %d: acción %s en vez de destruir %s", j.ID, action, j.Runner)
+		}
+		if runnerID, ok := data["runner_id"].(string); ok && runnerID != j.Runner {
+			return "", fmt.Errorf("el job %d retiró %s en vez de su runner %s", j.ID, runnerID, j.Runner)
+		}
+		actions[action]++
+		sc.st.gh.SetRunStatus(e2eRepo, j.Run, "completed")
+	}
+
+	err := sc.waitFor(ctx, "contenedores de los jobs eliminados", func() (bool, error) {
+		all, err := sc.st.containers(ctx, sc.st.runnerPrefix())
+		if err != nil {
+			return false, err
+		}
+		for _, j := range sc.jobs {
+			if hasRunner(all, j.Runner) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d runners destruidos por webhook, %d ya retirados por la limpieza", actions["torn_down"], actions["gone"]), nil
+}
+
+// autoscale deja una ejecución en cola sin webhook: el autoscaler la descubre por el API
+// y crea un único runner para ella.
+func (sc *scenario) autoscale(ctx context.Context) (string, error) {
+	sc.scaled = &job{Run: sc.st.gh.QueueRun(e2eRepo, "queued")}
+
+	err := sc.waitFor(ctx, "runner del autoscaler en marcha", func() (bool, error) {
+		running, err := sc.running(ctx)
+		if err != nil || len(running) == 0 {
+			return false, err
+		}
+		sc.scaled.Runner = running[0].Runner
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sc.register(sc.scaled.Runner)
+	sc.st.gh.SetRunnerStatus(sc.scope, sc.scaled.Runner, "online", true)
+	sc.st.gh.SetRunStatus(e2eRepo, sc.scaled.Run, "in_progress")
+
+	if err := sc.settle(ctx); err != nil {
+		return "", err
+	}
+	running, err := sc.running(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(running) != 1 {
+		return "", fmt.Errorf("%d contenedores para una ejecución en cola: %s", len(running), runnerNames(running))
+	}
+	return fmt.Sprintf("runner %s creado por el autoscaler", sc.scaled.Runner), nil
+}
+
+// finishScaled simula el final de un runner efímero: se da de baja en GitHub y su
+// proceso termina, sin webhook; la limpieza periódica debe retirar el contenedor.
+func (sc *scenario) finishScaled(ctx context.Context) (string, error) {
+	sc.st.gh.SetRunStatus(e2eRepo, sc.scaled.Run, "completed")
+	sc.st.gh.RemoveRunner(sc.scope, sc.scaled.Runner)
+	all, err := sc.st.containers(ctx, sc.scaled.Runner)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range all {
+		if _, err := sc.st.dockerCmd(ctx, "kill", c.ID); err != nil {
+			return "", err
+		}
+	}
+
+	err = sc.waitFor(ctx, "contenedor del runner terminado eliminado", func() (bool, error) {
+		all, err := sc.st.containers(ctx, sc.scaled.Runner)
+		return len(all) == 0, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("runner %s retirado", sc.scaled.Runner), nil
+}
+
+// invariants comprueba que no queda nada: ni contenedores, ni runners en GitHub, ni
+// runners activos en el orchestrator, y que los dos servicios siguen sanos.
+func (sc *scenario) invariants(ctx context.Context) (string, error) {
+	all, err := sc.st.containers(ctx, sc.st.runnerPrefix())
+	if err != nil {
+		return "", err
+	}
+	if len(all) > 0 {
+		return "", fmt.Errorf("contenedores sin eliminar: %s", runnerNames(all))
+	}
+	if runners := sc.st.gh.Runners(sc.scope); len(runners) > 0 {
+		names := make([]string, 0, len(runners))
+		for _, runner := range runners {
+			names = append(names, runner.Name)
+		}
+		return "", fmt.Errorf("runners registrados en GitHub: %s", strings.Join(names, ", "))
+	}
+
+	var health struct {
+		Data struct {
+			ActiveRunners int `json:"active_runners"`
+		} `json:"data"`
+	}
+	if err := sc.getJSON(ctx, sc.st.orchestratorURL+"/health", &health); err != nil {
+		return "", fmt.Errorf("health del orchestrator: %w", err)
+	}
+	if health.Data.ActiveRunners != 0 {
+		return "", fmt.Errorf("el orchestrator sigue con %d runners activos", health.Data.ActiveRunners)
+	}
+	if err := sc.getJSON(ctx, sc.st.gatewayURL+"/api/v1/health", nil); err != nil {
+		return "", fmt.Errorf("health del gateway: %w", err)
+	}
+	for _, svc := range sc.st.services {
+		select {
+		case err := <-svc.done:
+			svc.done <- err
+			return "", fmt.Errorf("%s terminó durante la prueba: %v", svc.name, err)
+		default:
+		}
+	}
+	return fmt.Sprintf("%d llamadas al API de GitHub, sin restos", len(sc.st.gh.Requests())), nil
+}
+
+// register simula que el runner termina config.sh: con JIT config ya existe offline.
+func (sc *scenario) register(name string) {
+	if !sc.st.gh.SetRunnerStatus(sc.scope, name, "online", false) {
+		sc.st.gh.RegisterRunner(sc.scope, name, jobLabels...)
+	}
+}
+
+// settle deja pasar dos ciclos del autoscaler y de la limpieza.
+func (sc *scenario) settle(ctx context.Context) error {
+	select {
+	case <-time.After(2 * time.Duration(sc.st.cfg.checkInterval) * time.Second):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (sc *scenario) running(ctx context.Context) ([]container, error) {
+	all, err := sc.st.containers(ctx, sc.st.runnerPrefix())
+	if err != nil {
+		return nil, err
+	}
+	running := all[:0]
+	for _, c := range all {
+		if c.running() {
+			running = append(running, c)
+		}
+	}
+	return running, nil
+}
+
+// waitFor comprueba check cada medio segundo hasta -step-timeout.
+func (sc *scenario) waitFor(ctx context.Context, what string, check func() (bool, error)) error {
+	deadline := time.Now().Add(sc.st.cfg.stepTimeout)
+	for {
+		ok, err := check()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s: no se cumplió en %s", what, sc.st.cfg.stepTimeout)
+		}
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// webhook envía un workflow_job firmado al gateway desde GitHub simulado y devuelve el
+// campo data de la respuesta.
+func (sc *scenario) webhook(ctx context.Context, j *job, action, delivery string) (map[string]any, error) {
+	status, raw, err := sc.st.gh.SendWorkflowJob(ctx, githubmock.WorkflowJob{
+		ID:         j.ID,
+		RunID:      j.Run,
+		Repo:       e2eRepo,
+		Name:       "build",
+		Labels:     jobLabels,
+		RunnerName: j.Runner,
+	}, action, delivery)
+	if err != nil {
+		return nil, err
+	}
+	if status >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(raw)))
+	}
+	var decoded struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("respuesta del gateway: %w", err)
+	}
+	if decoded.Data == nil {
+		decoded.Data = map[string]any{}
+	}
+	return decoded.Data, nil
+}
+
+func (sc *scenario) getJSON(ctx context.Context, url string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sc.st.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if into == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// createdRunner extrae el runner creado de la respuesta del gateway a un webhook queued.
+func createdRunner(data map[string]any) (string, error) {
+	runners, _ := data["runners"].([]any)
+	for _, item := range runners {
+		runner, _ := item.(map[string]any)
+		if runner["status"] == "created" {
+			if id, ok := runner["runner_id"].(string); ok && id != "" {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("el gateway no informó de un runner creado (acción %v, runners %v)", data["action"], data["runners"])
+}
+
+func hasRunner(containers []container, name string) bool {
+	for _, c := range containers {
+		if c.Runner == name {
+			return true
+		}
+	}
+	return false
+}
+
+func runnerNames(containers []container) string {
+	names := make([]string, 0, len(containers))
+	for _, c := range containers {
+		names = append(names, c.Runner)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func printReport(out io.Writer, format string, results []result) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "PASO\tRESULTADO\tDURACIÓN\tDETALLE")
+	for _, res := range results {
+		status := "✅ ok"
+		if !res.OK {
+			status = "❌ fallo"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", res.Step, status, res.Duration, res.Detail)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/githubmock"
+)
+
+const (
+	githubToken = "ghp_e2e"
+	// GHES con JIT config y runners efímeros: cualquier GITHUB_API_URL que no sea
+	// api.github.com se trata como GHES y se consulta /meta
+	githubVersion = "3.14.0"
+)
+
+// service es un proceso Python del stack con su log.
+type service struct {
+	name string
+	cmd  *exec.Cmd
+	log  *os.File
+	done chan error
+}
+
+// stack es el sistema bajo prueba: GitHub simulado en este proceso, orchestrator y
+// gateway como procesos hijos y los runners en el Docker local.
+type stack struct {
+	cfg    config
+	runID  string
+	secret string
+	gh     *githubmock.Server
+	http   *http.Client
+
+	orchestratorURL string
+	gatewayURL      string
+	services        []*service
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// freePort reserva un puerto local libre para un servicio.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// startStack comprueba Docker, arranca GitHub simulado y los dos servicios y espera a
+// que respondan. Devuelve el stack aunque falle para poder pararlo.
+func startStack(ctx context.Context, cfg config) (*stack, error) {
+	st := &stack{
+		cfg:    cfg,
+		runID:  randomHex(3),
+		secret: randomHex(16),
+		http:   &http.Client{Timeout: 2 * time.Minute},
+	}
+
+	if _, err := st.dockerCmd(ctx, "info", "--format", "{{.ServerVersion}}"); err != nil {
+		return nil, fmt.Errorf("Docker no disponible: %w", err)
+	}
+	// El orchestrator adopta, purga o recicla cualquier contenedor gha-ephemeral del daemon
+	existing, err := st.containers(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("hay %d contenedores gha-ephemeral en este Docker; la prueba los tocaría: usa un daemon de pruebas (DOCKER_HOST)", len(existing))
+	}
+	log.Printf("🐳 Descargando %s", cfg.image)
+	if _, err := st.dockerCmd(ctx, "pull", cfg.image); err != nil {
+		return nil, err
+	}
+
+	st.gh = githubmock.NewServer(githubmock.WithToken(githubToken), githubmock.WithEnterpriseVersion(githubVersion))
+	log.Printf("🐙 GitHub simulado en %s", st.gh.URL)
+
+	orchestratorPort, err := freePort()
+	if err != nil {
+		return st, err
+	}
+	gatewayPort, err := freePort()
+	if err != nil {
+		return st, err
+	}
+	st.orchestratorURL = fmt.Sprintf("http://127.0.0.1:%d", orchestratorPort)
+	st.gatewayURL = fmt.Sprintf("http://127.0.0.1:%d", gatewayPort)
+	st.gh.SetWebhook(st.gatewayURL+"/api/v1/webhooks/github", st.secret)
+
+	interval := strconv.Itoa(cfg.checkInterval)
+	if err := st.startService("orchestrator", map[string]string{
+		"ORCHESTRATOR_PORT":            strconv.Itoa(orchestratorPort),
+		"GITHUB_API_URL":               st.gh.URL,
+		"GITHUB_RUNNER_TOKEN":          githubToken,
+		"GITHUB_SKIP_PERMISSION_CHECK": "true",
+		"GITHUB_GRAPHQL_ENABLED":       "false",
+		"RUNNER_IMAGE":                 cfg.image,
+		"RUNNER_COMMAND":               cfg.command,
+		"RUNNER_NAME_TEMPLATE":         st.runnerPrefix() + "{{.ShortID}}",
+		"AUTO_CREATE_RUNNERS":          "true",
+		"RUNNER_CHECK_INTERVAL":        interval,
+		"RUNNER_PURGE_INTERVAL":        interval,
+	}); err != nil {
+		return st, err
+	}
+	if err := st.waitHealthy(ctx, "orchestrator", st.orchestratorURL+"/health"); err != nil {
+		return st, err
+	}
+
+	if err := st.startService("api-gateway", map[string]string{
+		"API_GATEWAY_PORT":      strconv.Itoa(gatewayPort),
+		"ORCHESTRATOR_SHARDS":   "e2e=" + st.orchestratorURL,
+		"GITHUB_WEBHOOK_SECRET": st.secret,
+	}); err != nil {
+		return st, err
+	}
+	if err := st.waitHealthy(ctx, "api-gateway", st.gatewayURL+"/api/v1/health"); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// runnerPrefix distingue los runners de esta ejecución (RUNNER_NAME_TEMPLATE).
+func (st *stack) runnerPrefix() string {
+	return "e2e-" + st.runID + "-"
+}
+
+func (st *stack) startService(name string, env map[string]string) error {
+	logFile, err := os.Create(filepath.Join(st.cfg.logDir, name+".log"))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(st.cfg.python, "main.py")
+	cmd.Dir = filepath.Join(st.cfg.repoRoot, name)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("arrancando %s: %w", name, err)
+	}
+
+	svc := &service{name: name, cmd: cmd, log: logFile, done: make(chan error, 1)}
+	go func() { svc.done <- cmd.Wait() }()
+	st.services = append(st.services, svc)
+	log.Printf("🚀 %s arrancado (pid %d)", name, cmd.Process.Pid)
+	return nil
+}
+
+// waitHealthy espera a que el servicio responda 200, o falla en cuanto el proceso muere.
+func (st *stack) waitHealthy(ctx context.Context, name, url string) error {
+	svc := st.services[len(st.services)-1]
+	deadline := time.Now().Add(st.cfg.startupTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-svc.done:
+			svc.done <- err
+			return fmt.Errorf("%s terminó al arrancar (%v); ver %s", name, err, svc.log.Name())
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		resp, err := st.http.Get(url)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			log.Printf("✅ %s listo", name)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s no respondió en %s; ver %s", name, st.cfg.startupTimeout, svc.log.Name())
+}
+
+// stop para los servicios en orden inverso (el orchestrator purga sus runners al recibir
+// SIGTERM) y elimina los contenedores de la prueba que queden.
+func (st *stack) stop() {
+	for i := len(st.services) - 1; i >= 0; i-- {
+		svc := st.services[i]
+		svc.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-svc.done:
+		case <-time.After(30 * time.Second):
+			log.Printf("⚠️ %s no terminó en 30s, se mata", svc.name)
+			svc.cmd.Process.Kill()
+			<-svc.done
+		}
+		svc.log.Close()
+	}
+	st.services = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if leftover, err := st.containers(ctx, st.runnerPrefix()); err == nil && len(leftover) > 0 {
+		log.Printf("🧹 Eliminando %d contenedores de la prueba", len(leftover))
+		for _, c := range leftover {
+			st.dockerCmd(ctx, "rm", "-f", c.ID)
+		}
+	}
+	if st.gh != nil {
+		st.gh.Close()
+	}
+}
+
+// container es un contenedor de runner en el Docker local.
+type container struct {
+	ID     string
+	State  string
+	Runner string
+}
+
+func (c container) running() bool {
+	return c.State == "running"
+}
+
+// containers lista los contenedores gha-ephemeral (incluidos los parados) cuyo runner
+// empieza por prefix.
+func (st *stack) containers(ctx context.Context, prefix string) ([]container, error) {
+	out, err := st.dockerCmd(ctx, "ps", "-a", "--filter", "label=gha-ephemeral=true",
+		"--format", "{{.ID}}\t{{.State}}\t{{.Label \"runner-name\"}}")
+	if err != nil {
+		return nil, err
+	}
+	var found []container
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], prefix) {
+			continue
+		}
+		found = append(found, container{ID: fields[0], State: fields[1], Runner: fields[2]})
+	}
+	return found, nil
+}
+
+func (st *stack) dockerCmd(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, st.cfg.docker, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return "", fmt.Errorf("%s %s: %s", st.cfg.docker, args[0], detail)
+		}
+		return "", fmt.Errorf("%s %s: %w", st.cfg.docker, args[0], err)
+	}
+	return stdout.String(), nil
+}
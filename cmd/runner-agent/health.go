@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+// Líneas de la salida del Runner.Listener, sin el prefijo de fecha ("2024-05-01 10:00:00Z: ")
+var (
+	runningJob   = regexp.MustCompile(`Running job: (.+)$`)
+	completedJob = regexp.MustCompile(`Job (.+) completed with result: (\w+)`)
+	connectError = regexp.MustCompile(`Runner connect error: (.+?)\.? Retrying until reconnected`)
+)
+
+// Job es el job que ejecuta el runner.
+type Job struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Health es la respuesta de /healthz.
+type Health struct {
+	Status  string `json:"status"`
+	Process struct {
+		Alive    bool `json:"alive"`
+		PID      int  `json:"pid,omitempty"`
+		ExitCode *int `json:"exit_code,omitempty"`
+	} `json:"process"`
+	Listener struct {
+		Connected bool       `json:"connected"`
+		Since     *time.Time `json:"since,omitempty"`
+		LastError string     `json:"last_error,omitempty"`
+	} `json:"listener"`
+	Job           *Job           `json:"job"`
+	LastResult    string         `json:"last_result,omitempty"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Watchdog      map[string]any `json:"watchdog,omitempty"`
+}
+
+// runnerState sigue la salida del runner: proceso, conexión del listener y job en curso.
+type runnerState struct {
+	mu sync.Mutex
+	// Tiempo desconectado que se tolera antes de declarar el runner no sano (el listener reintenta solo)
+	disconnectGrace time.Duration
+	started         time.Time
+	pid             int
+	exitCode        *int
+	connected       bool
+	everConnected   bool
+	since           time.Time
+	lastError       string
+	job             *Job
+	lastResult      string
+	// Umbrales del watchdog superados durante RUNNER_AGENT_RESTART_AFTER
+	overloaded string
+	watchdog   *watchdog.Watchdog
+}
+
+func newRunnerState(disconnectGrace time.Duration) *runnerState {
+	return &runnerState{disconnectGrace: disconnectGrace, started: time.Now()}
+}
+
+func (s *runnerState) setProcess(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pid = pid
+}
+
+func (s *runnerState) setExited(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exitCode = &code
+	s.connected = false
+}
+
+// setOverloaded marca el agente como no sano: el HEALTHCHECK falla y el contenedor se
+// reemplaza como cualquier runner no sano, en lugar de esperar al OOM killer.
+func (s *runnerState) setOverloaded(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overloaded = reason
+}
+
+func (s *runnerState) setConnected(connected bool, now time.Time) {
+	if s.connected != connected {
+		s.since = now
+	}
+	s.connected = connected
+	if connected {
+		s.everConnected = true
+		s.lastError = ""
+	}
+}
+
+// observe actualiza el estado con una línea de la salida del runner.
+func (s *runnerState) observe(line string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case strings.Contains(line, "Connected to GitHub"), strings.Contains(line, "Listening for Jobs"), strings.Contains(line, "Runner reconnected"):
+		s.setConnected(true, now)
+	case connectError.MatchString(line):
+		s.setConnected(false, now)
+		s.lastError = connectError.FindStringSubmatch(line)[1]
+	case runningJob.MatchString(line):
+		// Un job solo llega por una sesión abierta con GitHub
+		s.setConnected(true, now)
+		s.job = &Job{Name: strings.TrimSpace(runningJob.FindStringSubmatch(line)[1]), StartedAt: now}
+	case completedJob.MatchString(line):
+		s.job = nil
+		s.lastResult = completedJob.FindStringSubmatch(line)[2]
+	}
+}
+
+// health evalúa el estado: unhealthy si el proceso terminó, el listener lleva más de
+// disconnectGrace desconectado o el watchdog pidió el reinicio, starting hasta la
+// primera conexión.
+func (s *runnerState) health(now time.Time) Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var h Health
+	h.Process.Alive = s.pid != 0 && s.exitCode == nil
+	h.Process.PID = s.pid
+	h.Process.ExitCode = s.exitCode
+	h.Listener.Connected = s.connected
+	if !s.since.IsZero() {
+		since := s.since
+		h.Listener.Since = &since
+	}
+	h.Listener.LastError = s.lastError
+	h.Job = s.job
+	h.LastResult = s.lastResult
+	h.UptimeSeconds = now.Sub(s.started).Round(time.Second).Seconds()
+	if s.watchdog != nil {
+		h.Watchdog = s.watchdog.Status()
+	}
+
+	switch {
+	case !h.Process.Alive, s.overloaded != "":
+		h.Status = "unhealthy"
+	case !s.everConnected:
+		h.Status = "starting"
+	case !s.connected && now.Sub(s.since) > s.disconnectGrace:
+		h.Status = "unhealthy"
+	default:
+		h.Status = "healthy"
+	}
+	return h
+}
+
+// handleHealth responde 200 solo con el runner sano; starting y unhealthy responden 503.
+func (s *runnerState) handleHealth(w http.ResponseWriter, r *http.Request) {
+	h := s.health(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if h.Status != "healthy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(h)
+}
@@ -0,0 +1,159 @@
+// runner-agent envuelve el proceso del runner de Actions dentro de su contenedor: lo
+// lanza, le reenvía las señales y sigue su salida para exponer en un endpoint local
+// (RUNNER_HEALTH_ADDR) si el proceso vive, si el listener está conectado a GitHub, qué
+// job ejecuta y las medidas del watchdog del propio agente. Con -healthcheck consulta
+// ese endpoint: es el HEALTHCHECK de la imagen, así Docker y el orquestador ven la misma
+// salud del runner.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// healthcheck consulta /healthz del agente (HEALTHCHECK de la imagen sin shell).
+func healthcheck(addr string) int {
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/healthz")
+	if err != nil {
+		log.Printf("Health check failed: %v", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		log.Printf("Health check failed: status %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return 1
+	}
+	return 0
+}
+
+// follow copia la salida del runner a la del contenedor y la pasa línea a línea al estado.
+func follow(state *runnerState, src io.Reader, dst io.Writer, done *sync.WaitGroup) {
+	defer done.Done()
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, _ = io.WriteString(dst, line+"\n")
+		state.observe(line, time.Now())
+	}
+}
+
+func main() {
+	addr := envOr("RUNNER_HEALTH_ADDR", "127.0.0.1:8095")
+	check := flag.Bool("healthcheck", false, "Comprobar la salud del runner y salir")
+	flag.Parse()
+	if *check {
+		os.Exit(healthcheck(addr))
+	}
+	if flag.NArg() == 0 {
+		log.Fatalf("❌ uso: runner-agent [--] <comando del runner> [argumentos...]")
+	}
+	grace, err := time.ParseDuration(envOr("RUNNER_HEALTH_DISCONNECT_GRACE", "2m"))
+	if err != nil {
+		log.Fatalf("❌ RUNNER_HEALTH_DISCONNECT_GRACE inválido: %v", err)
+	}
+
+	// Umbrales del propio agente, por debajo de los de los servicios: solo sigue la salida del runner
+	limits, err := watchdog.LimitsFromEnv("RUNNER_AGENT", watchdog.Limits{
+		Goroutines:   1000,
+		HeapBytes:    256 << 20,
+		Lag:          time.Second,
+		RestartAfter: 2 * time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	state := newRunnerState(grace)
+	state.watchdog = watchdog.New("runner_agent", limits, nil, func(reason string) {
+		log.Printf("🔄 Watchdog: el agente se declara no sano para que se reemplace el contenedor: %s", reason)
+		state.setOverloaded(reason)
+	})
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	go state.watchdog.Run(watchdogCtx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", state.handleHealth)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		// El runner sigue aunque no se pueda abrir el endpoint: el HEALTHCHECK fallará y se verá
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("⚠️ Endpoint de salud no disponible en %s: %v", addr, err)
+		}
+	}()
+
+	cmd := exec.Command(flag.Arg(0), flag.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("❌ No se pudo lanzar el runner: %v", err)
+	}
+	state.setProcess(cmd.Process.Pid)
+
+	// El runner recibe las señales del contenedor (docker stop, cancelación del job)
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	var output sync.WaitGroup
+	output.Add(2)
+	go follow(state, stdout, os.Stdout, &output)
+	go follow(state, stderr, os.Stderr, &output)
+	output.Wait()
+
+	code := 0
+	if err := cmd.Wait(); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) {
+			log.Fatalf("❌ %v", err)
+		}
+		code = exit.ExitCode()
+		if code < 0 {
+			// Terminado por una señal
+			code = 128 + int(exit.Sys().(syscall.WaitStatus).Signal())
+		}
+	}
+	state.setExited(code)
+	stopWatchdog()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+	os.Exit(code)
+}
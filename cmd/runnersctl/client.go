@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/client"
+)
+
+// Client habla con el API Gateway usando API key o token OIDC; el transporte
+// (autenticación, reintentos y errores) es el del SDK pkg/client.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	api *client.Client
+	// deprecationWarned evita repetir el aviso de versión obsoleta en cada solicitud.
+	deprecationWarned bool
+}
+
+func newClient(baseURL, apiKey, token string) *Client {
+	c := &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 60 * time.Second},
+	}
+	c.api = client.New(c.BaseURL,
+		client.WithAPIKey(apiKey),
+		client.WithToken(token),
+		client.WithHTTPClient(c.HTTP),
+		client.WithUserAgent("runnersctl"),
+		client.WithPageSize(1000),
+		client.WithDeprecationHandler(c.warnDeprecation),
+	)
+	return c
+}
+
+// APIError es una respuesta de error del gateway.
+type APIError = client.APIError
+
+// do envía la solicitud y decodifica el campo data de la respuesta en out (si no es nil).
+func (c *Client) do(method, path string, body any, headers map[string]string, out any) error {
+	options := make([]client.RequestOption, 0, len(headers))
+	for key, value := range headers {
+		options = append(options, client.WithHeader(key, value))
+	}
+	return c.api.Do(context.Background(), method, path, body, out, options...)
+}
+
+// warnDeprecation avisa por stderr, una vez, si el gateway anuncia que la versión de la API
+// que usa runnersctl está obsoleta (cabeceras Deprecation y Sunset).
+func (c *Client) warnDeprecation(deprecation client.Deprecation) {
+	if c.deprecationWarned {
+		return
+	}
+	c.deprecationWarned = true
+	warning := fmt.Sprintf("aviso: la API %s del gateway está obsoleta", deprecation.Version)
+	if deprecation.Sunset != "" {
+		warning += " y se retira el " + deprecation.Sunset
+	}
+	fmt.Fprintln(os.Stderr, warning+"; actualiza runnersctl")
+}
+
+func (c *Client) get(path string, out any) error {
+	return c.do(http.MethodGet, path, nil, nil, out)
+}
+
+func (c *Client) post(path string, body, out any) error {
+	return c.do(http.MethodPost, path, body, nil, out)
+}
+
+func (c *Client) delete(path string, out any) error {
+	return c.do(http.MethodDelete, path, nil, nil, out)
+}
+
+// Runner es el estado de un runner tal como lo reporta el orchestrator.
+type Runner = client.Runner
+
+// RunnerRequest es el cuerpo de POST /api/v1/runners.
+type RunnerRequest = client.RunnerRequest
+
+// ListRunners recorre todas las páginas; los listados se piden en v2, que lleva el
+// cursor de la página siguiente en el cuerpo.
+func (c *Client) ListRunners() ([]Runner, error) {
+	return client.List[Runner](context.Background(), c.api, "/api/v2/runners", nil).All()
+}
+
+func (c *Client) GetRunner(id string) (Runner, error) {
+	var runner Runner
+	err := c.get("/api/v1/runners/"+url.PathEscape(id), &runner)
+	return runner, err
+}
+
+func (c *Client) DestroyRunner(id string) error {
+	return c.delete("/api/v1/runners/"+url.PathEscape(id), nil)
+}
+
+// DestroyRunnerDryRun pide al orchestrator que solo registre la destrucción.
+func (c *Client) DestroyRunnerDryRun(id string) error {
+	return c.delete("/api/v1/runners/"+url.PathEscape(id)+"?dry_run=true", nil)
+}
+
+func (c *Client) CreateRunners(request RunnerRequest) ([]map[string]any, error) {
+	var created []map[string]any
+	err := c.post("/api/v1/runners", request, &created)
+	return created, err
+}
+
+func (c *Client) ListPools() ([]map[string]any, error) {
+	return client.List[map[string]any](context.Background(), c.api, "/api/v2/pools", nil).All()
+}
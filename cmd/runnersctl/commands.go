@@ -0,0 +1,563 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/logfile"
+)
+
+// maxRunnersPerRequest es el límite de count de POST /api/v1/runners.
+const maxRunnersPerRequest = 10
+
+// parseInterspersed permite flags antes y después de los argumentos posicionales.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func requireArgs(positional []string, count int, usage string) error {
+	if len(positional) != count {
+		return fmt.Errorf("uso: runnersctl %s", usage)
+	}
+	return nil
+}
+
+func runnerRows(runners []Runner) [][]string {
+	rows := make([][]string, 0, len(runners))
+	for _, runner := range runners {
+		status := runner.Status
+		if runner.Health != "" {
+			status += " (" + runner.Health + ")"
+		}
+		rows = append(rows, []string{runner.RunnerID, runner.Pool(), status, runner.Image, runner.Created})
+	}
+	return rows
+}
+
+var runnerHeaders = []string{"RUNNER", "POOL", "ESTADO", "IMAGEN", "CREADO"}
+
+func filterByPool(runners []Runner, pool string) []Runner {
+	if pool == "" {
+		return runners
+	}
+	filtered := runners[:0]
+	for _, runner := range runners {
+		if runner.Pool() == pool {
+			filtered = append(filtered, runner)
+		}
+	}
+	return filtered
+}
+
+func cmdPools(c *Client, p *printer, args []string) error {
+	if len(args) > 0 && args[0] == "drift" {
+		return cmdPoolDrift(c, p)
+	}
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("uso: runnersctl pools list|drift")
+	}
+	pools, err := c.ListPools()
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(pools))
+	for _, pool := range pools {
+		rows = append(rows, []string{
+			stringValue(pool["name"]), stringValue(pool["image"]), stringValue(pool["labels"]),
+			stringValue(pool["enable_dind"]), stringValue(pool["egress_proxy"]),
+		})
+	}
+	return p.print(pools, []string{"POOL", "IMAGEN", "LABELS", "DIND", "EGRESS"}, rows)
+}
+
+func cmdPoolDrift(c *Client, p *printer) error {
+	var status map[string]any
+	if err := c.get("/api/v1/pools/drift", &status); err != nil {
+		return err
+	}
+	if status["enabled"] != true {
+		return p.message("Reconciliación GitOps desactivada (POOLS_SPEC_DIR o POOLS_GIT_REPO)")
+	}
+	if p.structured() {
+		return p.print(status, nil, nil)
+	}
+
+	fmt.Fprintf(p.out, "Fuente: %s  Revisión: %s  Última sincronización: %s\n",
+		stringValue(status["source"]), stringValue(status["revision"]), stringValue(status["last_sync"]))
+	if lastError := stringValue(status["last_error"]); lastError != "-" {
+		fmt.Fprintf(p.out, "Error: %s\n", lastError)
+	}
+	drift, _ := status["drift"].([]any)
+	rows := make([][]string, 0, len(drift))
+	for _, item := range drift {
+		entry, _ := item.(map[string]any)
+		rows = append(rows, []string{stringValue(entry["runner"]), stringValue(entry["pool"]), stringValue(entry["reason"])})
+	}
+	return p.print(status, []string{"RUNNER", "POOL", "DRIFT"}, rows)
+}
+
+func cmdReconcile(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	run := fs.Bool("run", false, "Reconciliar ahora en lugar de mostrar la última pasada")
+	dryRun := fs.Bool("dry-run", false, "Con --run, solo detectar el drift")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+
+	var status map[string]any
+	var err error
+	switch {
+	case *run && *dryRun:
+		err = c.post("/api/v1/reconcile?dry_run=true", nil, &status)
+	case *run:
+		err = c.post("/api/v1/reconcile", nil, &status)
+	default:
+		err = c.get("/api/v1/reconcile", &status)
+	}
+	if err != nil {
+		return err
+	}
+	if status["enabled"] != true {
+		return p.message("Reconciliación de runners desactivada (RECONCILE_ENABLED)")
+	}
+	if p.structured() {
+		return p.print(status, nil, nil)
+	}
+
+	fmt.Fprintf(p.out, "Última pasada: %s  Intervalo: %ss  Simulación: %s\n",
+		stringValue(status["last_run"]), stringValue(status["interval"]), stringValue(status["dry_run"]))
+	if lastError := stringValue(status["last_error"]); lastError != "-" {
+		fmt.Fprintf(p.out, "Error: %s\n", lastError)
+	}
+	drift, _ := status["drift"].([]any)
+	rows := make([][]string, 0, len(drift))
+	for _, item := range drift {
+		entry, _ := item.(map[string]any)
+		rows = append(rows, []string{
+			stringValue(entry["resource"]), stringValue(entry["name"]), stringValue(entry["reason"]),
+			stringValue(entry["action"]), stringValue(entry["result"]), stringValue(entry["detail"]),
+		})
+	}
+	return p.print(status, []string{"RECURSO", "NOMBRE", "MOTIVO", "ACCIÓN", "RESULTADO", "DETALLE"}, rows)
+}
+
+func cmdRunners(c *Client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("uso: runnersctl runners list|inspect|delete|cleanup")
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("runners list", flag.ContinueOnError)
+		pool := fs.String("pool", "", "Mostrar solo runners de este pool")
+		if _, err := parseInterspersed(fs, args[1:]); err != nil {
+			return err
+		}
+		runners, err := c.ListRunners()
+		if err != nil {
+			return err
+		}
+		runners = filterByPool(runners, *pool)
+		return p.print(runners, runnerHeaders, runnerRows(runners))
+
+	case "inspect":
+		if err := requireArgs(args[1:], 1, "runners inspect <runner>"); err != nil {
+			return err
+		}
+		runner, err := c.GetRunner(args[1])
+		if err != nil {
+			return err
+		}
+		if runner.Error != "" {
+			return errors.New(runner.Error)
+		}
+		labels := make([]string, 0, len(runner.Labels))
+		for key, value := range runner.Labels {
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+		rows := [][]string{
+			{"Runner", runner.RunnerID},
+			{"Pool", runner.Pool()},
+			{"Estado", runner.Status},
+			{"Contenedor", runner.ContainerID},
+			{"Imagen", runner.Image},
+			{"Creado", runner.Created},
+			{"Labels", strings.Join(labels, ", ")},
+		}
+		return p.print(runner, []string{"CAMPO", "VALOR"}, rows)
+
+	case "delete":
+		fs := flag.NewFlagSet("runners delete", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "Solo registrar la destrucción en el orchestrator")
+		positional, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if err := requireArgs(positional, 1, "runners delete <runner> [--dry-run]"); err != nil {
+			return err
+		}
+		if *dryRun {
+			if err := c.DestroyRunnerDryRun(positional[0]); err != nil {
+				return err
+			}
+			return p.message("Simulación: el runner %s se destruiría", positional[0])
+		}
+		if err := c.DestroyRunner(positional[0]); err != nil {
+			return err
+		}
+		return p.message("Runner %s destruido", positional[0])
+
+	case "cleanup":
+		fs := flag.NewFlagSet("runners cleanup", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "Solo calcular qué runners se limpiarían")
+		if _, err := parseInterspersed(fs, args[1:]); err != nil {
+			return err
+		}
+		path := "/api/v1/runners/cleanup"
+		if *dryRun {
+			path += "?dry_run=true"
+		}
+		var result map[string]any
+		if err := c.post(path, nil, &result); err != nil {
+			return err
+		}
+		return p.print(result, []string{"RESULTADO"}, [][]string{{stringValue(result["message"])}})
+	}
+	return fmt.Errorf("subcomando desconocido: runners %s", args[0])
+}
+
+func cmdScale(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("scale", flag.ContinueOnError)
+	scope := fs.String("scope", "repo", "Tipo de scope: repo u org")
+	scopeName := fs.String("scope-name", "", "Repositorio (owner/repo) u organización")
+	count := fs.Int("count", 1, "Número de runners a crear")
+	labels := fs.String("labels", "", "Labels adicionales separadas por comas")
+	group := fs.String("group", "", "Grupo del runner")
+	size := fs.String("size", "", "Clase de recursos (small, medium, large, xl...)")
+	dryRun := fs.Bool("dry-run", false, "Solo registrar qué se crearía")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(positional, 1, "scale <pool> --scope-name <owner/repo|org> [--count N] [--size CLASE]"); err != nil {
+		return err
+	}
+	if *scopeName == "" {
+		return errors.New("--scope-name es obligatorio")
+	}
+	if *count < 1 {
+		return errors.New("--count debe ser >= 1")
+	}
+
+	request := RunnerRequest{
+		Scope: *scope, ScopeName: *scopeName, RunnerGroup: *group, Pool: positional[0],
+		ResourceClass: *size, DryRun: *dryRun,
+	}
+	if *labels != "" {
+		request.Labels = strings.Split(*labels, ",")
+	}
+
+	var created []map[string]any
+	for remaining := *count; remaining > 0; remaining -= maxRunnersPerRequest {
+		request.Count = min(remaining, maxRunnersPerRequest)
+		batch, err := c.CreateRunners(request)
+		created = append(created, batch...)
+		if err != nil {
+			return fmt.Errorf("creados %d de %d runners: %w", len(created), *count, err)
+		}
+	}
+
+	rows := make([][]string, 0, len(created))
+	for _, runner := range created {
+		rows = append(rows, []string{stringValue(runner["runner_id"]), stringValue(runner["status"])})
+	}
+	return p.print(created, []string{"RUNNER", "ESTADO"}, rows)
+}
+
+func cmdDrain(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("drain", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Solo mostrar los runners que se destruirían")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(positional, 1, "drain <pool> [--dry-run]"); err != nil {
+		return err
+	}
+
+	runners, err := c.ListRunners()
+	if err != nil {
+		return err
+	}
+	runners = filterByPool(runners, positional[0])
+	if *dryRun {
+		return p.print(runners, runnerHeaders, runnerRows(runners))
+	}
+
+	var failed int
+	results := make([]map[string]string, 0, len(runners))
+	rows := make([][]string, 0, len(runners))
+	for _, runner := range runners {
+		result := "destruido"
+		if err := c.DestroyRunner(runner.RunnerID); err != nil {
+			result = err.Error()
+			failed++
+		}
+		results = append(results, map[string]string{"runner_id": runner.RunnerID, "result": result})
+		rows = append(rows, []string{runner.RunnerID, result})
+	}
+	if err := p.print(results, []string{"RUNNER", "RESULTADO"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d runners no se pudieron destruir", failed)
+	}
+	return nil
+}
+
+func cmdWebhook(c *Client, p *printer, args []string) error {
+	if len(args) == 0 || args[0] != "replay" {
+		return errors.New("uso: runnersctl webhook replay <payload.json> --event <evento>")
+	}
+	fs := flag.NewFlagSet("webhook replay", flag.ContinueOnError)
+	event := fs.String("event", "workflow_job", "Evento de GitHub (header X-GitHub-Event)")
+	delivery := fs.String("delivery", "", "ID de entrega (por defecto uno aleatorio)")
+	secret := fs.String("secret", os.Getenv("RUNNERSCTL_WEBHOOK_SECRET"), "Secreto para firmar el payload (RUNNERSCTL_WEBHOOK_SECRET)")
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(positional, 1, "webhook replay <payload.json> --event <evento>"); err != nil {
+		return err
+	}
+	if *secret == "" {
+		return errors.New("se requiere --secret o RUNNERSCTL_WEBHOOK_SECRET para firmar el payload")
+	}
+
+	payload, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	if *delivery == "" {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		*delivery = "replay-" + hex.EncodeToString(random)
+	}
+
+	mac := hmac.New(sha256.New, []byte(*secret))
+	mac.Write(payload)
+	headers := map[string]string{
+		"X-GitHub-Event":      *event,
+		"X-GitHub-Delivery":   *delivery,
+		"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+	}
+
+	var result any
+	if err := c.do(http.MethodPost, "/api/v1/webhooks/github", payload, headers, &result); err != nil {
+		return err
+	}
+	if p.structured() {
+		return p.print(result, nil, nil)
+	}
+	return p.message("Webhook %s reenviado (delivery %s)", *event, *delivery)
+}
+
+// cmdEvents muestra altas, bajas y cambios de estado de runners consultando el gateway periódicamente.
+func cmdEvents(c *Client, p *printer, args []string) error {
+	if len(args) == 0 || args[0] != "tail" {
+		return errors.New("uso: runnersctl events tail [--interval 5s] [--pool <pool>] [--log-file <archivo>]")
+	}
+	fs := flag.NewFlagSet("events tail", flag.ContinueOnError)
+	interval := fs.Duration("interval", 5*time.Second, "Intervalo entre consultas")
+	pool := fs.String("pool", "", "Mostrar solo eventos de este pool")
+	logPath := fs.String("log-file", "", "Guardar también cada evento como línea JSON en este archivo, rotado según LOG_MAX_SIZE, LOG_ROTATE_INTERVAL, LOG_MAX_BACKUPS, LOG_MAX_AGE y LOG_COMPRESS")
+	if _, err := parseInterspersed(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var eventLog *logfile.File
+	if *logPath != "" {
+		opts, err := logfile.OptionsFromEnv()
+		if err != nil {
+			return err
+		}
+		if eventLog, err = logfile.Open(*logPath, opts); err != nil {
+			return err
+		}
+		defer eventLog.Close()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	emit := func(event string, runner Runner) error {
+		record := map[string]string{
+			"time":   time.Now().Format(time.RFC3339),
+			"event":  event,
+			"runner": runner.RunnerID,
+			"pool":   runner.Pool(),
+			"status": runner.Status,
+		}
+		if eventLog != nil {
+			line, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := eventLog.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		if p.structured() {
+			return p.print(record, nil, nil)
+		}
+		_, err := fmt.Fprintf(p.out, "%s  %-8s %s (pool %s, %s)\n", record["time"], event, runner.RunnerID, runner.Pool(), runner.Status)
+		return err
+	}
+
+	known := map[string]Runner{}
+	first := true
+	for {
+		runners, err := c.ListRunners()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error consultando runners: %v\n", err)
+		} else {
+			current := map[string]Runner{}
+			for _, runner := range filterByPool(runners, *pool) {
+				current[runner.RunnerID] = runner
+				previous, seen := known[runner.RunnerID]
+				switch {
+				case !seen && first:
+					err = emit("existing", runner)
+				case !seen:
+					err = emit("created", runner)
+				case previous.Status != runner.Status:
+					err = emit("status", runner)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			for id, runner := range known {
+				if _, ok := current[id]; !ok {
+					runner.Status = "removed"
+					if err := emit("removed", runner); err != nil {
+						return err
+					}
+				}
+			}
+			known = current
+			first = false
+		}
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func cmdReload(c *Client, p *printer, _ []string) error {
+	var changes map[string][]string
+	if err := c.post("/api/v1/admin/reload", nil, &changes); err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(changes))
+	for _, kind := range []string{"added", "removed", "changed", "flags"} {
+		rows = append(rows, []string{kind, strings.Join(changes[kind], ",")})
+	}
+	return p.print(changes, []string{"CAMBIO", "POOLS"}, rows)
+}
+
+func cmdFlags(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("flags", flag.ContinueOnError)
+	scope := fs.String("scope", "", "Evaluar las flags para un owner u owner/repo")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	path := "/api/v1/admin/flags"
+	if *scope != "" {
+		path += "?scope_name=" + url.QueryEscape(*scope)
+	}
+	var result struct {
+		Environment string           `json:"environment"`
+		Flags       []map[string]any `json:"flags"`
+	}
+	if err := c.get(path, &result); err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(result.Flags))
+	for _, item := range result.Flags {
+		rows = append(rows, []string{
+			stringValue(item["name"]), stringValue(item["active"]), stringValue(item["enabled"]),
+			stringValue(item["percentage"]), stringValue(item["scopes"]), stringValue(item["environments"]),
+			stringValue(item["override"]),
+		})
+	}
+	return p.print(result, []string{"FLAG", "ACTIVA", "ENABLED", "PORCENTAJE", "SCOPES", "ENTORNOS", "OVERRIDE"}, rows)
+}
+
+func cmdWhoami(c *Client, p *printer, _ []string) error {
+	var identity map[string]any
+	if err := c.get("/api/v1/auth/whoami", &identity); err != nil {
+		return err
+	}
+	row := []string{stringValue(identity["name"]), stringValue(identity["role"]), stringValue(identity["method"])}
+	return p.print(identity, []string{"NOMBRE", "ROL", "MÉTODO"}, [][]string{row})
+}
+
+func cmdBans(c *Client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("uso: runnersctl bans list|lift <ip>")
+	}
+	switch args[0] {
+	case "list":
+		var bans []map[string]any
+		if err := c.get("/api/v1/admin/bans", &bans); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(bans))
+		for _, ban := range bans {
+			rows = append(rows, []string{stringValue(ban["ip"]), stringValue(ban["reason"]), stringValue(ban["remaining_seconds"])})
+		}
+		return p.print(bans, []string{"IP", "MOTIVO", "RESTANTE (s)"}, rows)
+	case "lift":
+		if err := requireArgs(args[1:], 1, "bans lift <ip>"); err != nil {
+			return err
+		}
+		if err := c.delete("/api/v1/admin/bans/"+url.PathEscape(args[1]), nil); err != nil {
+			return err
+		}
+		return p.message("Bloqueo de %s levantado", args[1])
+	}
+	return fmt.Errorf("subcomando desconocido: bans %s", args[0])
+}
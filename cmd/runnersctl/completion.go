@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// subcommands lista los subcomandos de cada comando para el autocompletado.
+var subcommands = map[string][]string{
+	"pools":      {"list", "drift"},
+	"runners":    {"list", "inspect", "delete", "cleanup"},
+	"webhook":    {"replay"},
+	"events":     {"tail"},
+	"bans":       {"list", "lift"},
+	"cutover":    {"start", "list", "status", "watch", "rollback"},
+	"state":      {"export", "import"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+// globalFlags son las opciones de runnersctl que reciben un valor ("o" primero: se completa aparte).
+var globalFlags = []string{"o", "url", "api-key", "token"}
+
+// completion se registra en init: cmdCompletion recorre el mapa commands.
+func init() {
+	commands["completion"] = cmdCompletion
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cmdCompletion(_ *Client, p *printer, args []string) error {
+	if err := requireArgs(args, 1, "completion bash|zsh|fish"); err != nil {
+		return err
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion()
+	case "zsh":
+		// zsh reutiliza el script de bash a través de bashcompinit
+		script = "autoload -U +X compinit && compinit\nautoload -U +X bashcompinit && bashcompinit\n" + bashCompletion()
+	case "fish":
+		script = fishCompletion()
+	default:
+		return errors.New("uso: runnersctl completion bash|zsh|fish")
+	}
+	_, err := fmt.Fprint(p.out, script)
+	return err
+}
+
+func bashCompletion() string {
+	var cases strings.Builder
+	for _, name := range commandNames() {
+		if subs, ok := subcommands[name]; ok {
+			fmt.Fprintf(&cases, "        %s) subs=%q ;;\n", name, strings.Join(subs, " "))
+		}
+	}
+	flags := make([]string, 0, len(globalFlags)*2)
+	valueFlags := make([]string, 0, len(globalFlags)*2)
+	for _, name := range globalFlags {
+		flags = append(flags, "-"+name)
+		valueFlags = append(valueFlags, "-"+name, "--"+name)
+	}
+
+	return fmt.Sprintf(`# runnersctl completion bash
+_runnersctl() {
+    local cur prev cmd="" sub="" subs="" i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+        -o|--o) COMPREPLY=($(compgen -W %q -- "$cur")); return ;;
+        %s) return ;;
+    esac
+
+    for ((i=1; i<COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            %s) ((i++)) ;;
+            -*) ;;
+            *) if [[ -z "$cmd" ]]; then cmd="${COMP_WORDS[i]}"; elif [[ -z "$sub" ]]; then sub="${COMP_WORDS[i]}"; fi ;;
+        esac
+    done
+
+    if [[ -z "$cmd" ]]; then
+        if [[ "$cur" == -* ]]; then
+            COMPREPLY=($(compgen -W %q -- "$cur"))
+        else
+            COMPREPLY=($(compgen -W %q -- "$cur"))
+        fi
+        return
+    fi
+
+    case "$cmd" in
+%s    esac
+    if [[ -n "$subs" && -z "$sub" ]]; then
+        COMPREPLY=($(compgen -W "$subs" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -F _runnersctl runnersctl
+`,
+		strings.Join(outputFormats, " "),
+		strings.Join(valueFlags[2:], "|"),
+		strings.Join(valueFlags, "|"),
+		strings.Join(flags, " "),
+		strings.Join(commandNames(), " "),
+		cases.String(),
+	)
+}
+
+func fishCompletion() string {
+	var out strings.Builder
+	out.WriteString("# runnersctl completion fish\ncomplete -c runnersctl -f\n")
+	fmt.Fprintf(&out, "complete -c runnersctl -o o -x -a %q -d 'Formato de salida'\n", strings.Join(outputFormats, " "))
+	fmt.Fprintln(&out, "complete -c runnersctl -o url -x -d 'URL del API Gateway'")
+	fmt.Fprintln(&out, "complete -c runnersctl -o api-key -x -d 'API key'")
+	fmt.Fprintln(&out, "complete -c runnersctl -o token -x -d 'Token OIDC Bearer'")
+
+	names := commandNames()
+	fmt.Fprintf(&out, "complete -c runnersctl -n 'not __fish_seen_subcommand_from %s' -a %q\n",
+		strings.Join(names, " "), strings.Join(names, " "))
+	for _, name := range names {
+		subs, ok := subcommands[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "complete -c runnersctl -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a %q\n",
+			name, strings.Join(subs, " "), strings.Join(subs, " "))
+	}
+	// Archivos para webhook replay y state import
+	out.WriteString("complete -c runnersctl -n '__fish_seen_subcommand_from replay import' -F\n")
+	return out.String()
+}
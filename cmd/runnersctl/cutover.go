@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/client"
+)
+
+const cutoverUsage = "cutover start <pool>[,<pool>...] --image I [--set k=v] [--watch] | list | status <id> | watch <id> | rollback <id> [--reason R]"
+
+// setFlags acumula --set clave=valor; el valor se interpreta como JSON si lo es (números, objetos...).
+type setFlags map[string]any
+
+func (s setFlags) String() string {
+	return fmt.Sprint(map[string]any(s))
+}
+
+func (s setFlags) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("se esperaba clave=valor: %s", value)
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+	s[key] = parsed
+	return nil
+}
+
+func cmdCutover(c *Client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("uso: runnersctl " + cutoverUsage)
+	}
+	switch args[0] {
+	case "start":
+		return cutoverStart(c, p, args[1:])
+	case "list":
+		return cutoverList(c, p, args[1:])
+	case "status":
+		if err := requireArgs(args[1:], 1, "cutover status <id>"); err != nil {
+			return err
+		}
+		var cutover client.Cutover
+		if err := c.get("/api/v1/cutovers/"+url.PathEscape(args[1]), &cutover); err != nil {
+			return err
+		}
+		return p.print(cutover, cutoverHeaders, [][]string{cutoverRow(cutover)})
+	case "watch":
+		fs := flag.NewFlagSet("cutover watch", flag.ContinueOnError)
+		interval := fs.Duration("interval", 30*time.Second, "Intervalo entre consultas")
+		positional, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if err := requireArgs(positional, 1, "cutover watch <id> [--interval 30s]"); err != nil {
+			return err
+		}
+		return cutoverWatch(c, p, positional[0], *interval)
+	case "rollback":
+		fs := flag.NewFlagSet("cutover rollback", flag.ContinueOnError)
+		reason := fs.String("reason", "", "Motivo de la reversión")
+		positional, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if err := requireArgs(positional, 1, "cutover rollback <id> [--reason R]"); err != nil {
+			return err
+		}
+		var cutover client.Cutover
+		if err := c.post("/api/v1/cutovers/"+url.PathEscape(positional[0])+"/rollback", map[string]string{"reason": *reason}, &cutover); err != nil {
+			return err
+		}
+		return p.print(cutover, cutoverHeaders, [][]string{cutoverRow(cutover)})
+	}
+	return fmt.Errorf("subcomando desconocido: cutover %s", args[0])
+}
+
+var cutoverHeaders = []string{"CAMBIO", "POOLS", "ESTADO", "PESO", "FALLOS AZUL", "FALLOS VERDE", "INICIADO"}
+
+func cutoverRow(cutover client.Cutover) []string {
+	pairs := make([]string, 0, len(cutover.Pools))
+	for _, pair := range cutover.Pools {
+		pairs = append(pairs, pair.Blue+"->"+pair.Green)
+	}
+	rate := func(side string) string {
+		counters := cutover.Runners[side]
+		return fmt.Sprintf("%.0f%% (%d/%d)", cutover.FailureRates[side]*100, counters.Failed, counters.Runners)
+	}
+	return []string{
+		cutover.ID, strings.Join(pairs, ","), cutover.Status, fmt.Sprintf("%d%%", cutover.Weight),
+		rate("blue"), rate("green"), cutover.StartedAt,
+	}
+}
+
+func cutoverStart(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("cutover start", flag.ContinueOnError)
+	image := fs.String("image", "", "Imagen de los pools verdes")
+	changes := setFlags{}
+	fs.Var(changes, "set", "Otra opción de los pools verdes como clave=valor (repetible; el valor puede ser JSON)")
+	suffix := fs.String("suffix", "green", "Sufijo del nombre de los pools verdes")
+	steps := fs.String("steps", "", "Porcentajes de runners a los verdes por paso, terminando en 100 (por defecto FLEET_CUTOVER_STEPS)")
+	stepInterval := fs.Duration("step-interval", 0, "Duración mínima de cada paso (por defecto FLEET_CUTOVER_STEP_INTERVAL)")
+	minRunners := fs.Int("min-runners", 0, "Runners verdes necesarios por paso (por defecto FLEET_CUTOVER_MIN_RUNNERS)")
+	margin := fs.Float64("max-failure-margin", -1, "Fallos verdes tolerados sobre los azules (por defecto FLEET_CUTOVER_MAX_FAILURE_MARGIN)")
+	watch := fs.Bool("watch", false, "Seguir el cambio hasta que se complete o se revierta")
+	interval := fs.Duration("interval", 30*time.Second, "Con --watch, intervalo entre consultas")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(positional, 1, "cutover start <pool>[,<pool>...] --image I [--set clave=valor]"); err != nil {
+		return err
+	}
+	if *image != "" {
+		changes["image"] = *image
+	}
+	if len(changes) == 0 {
+		return errors.New("indica --image o al menos un --set con los cambios de los pools verdes")
+	}
+
+	policy := map[string]any{}
+	if *steps != "" {
+		policy["steps"] = *steps
+	}
+	if *stepInterval > 0 {
+		policy["step_interval"] = int(stepInterval.Seconds())
+	}
+	if *minRunners > 0 {
+		policy["min_runners"] = *minRunners
+	}
+	if *margin >= 0 {
+		policy["max_failure_margin"] = *margin
+	}
+	request := client.CutoverRequest{
+		Pools: strings.Split(positional[0], ","), Changes: changes, Suffix: *suffix, Policy: policy,
+	}
+	var cutover client.Cutover
+	if err := c.post("/api/v1/cutovers", request, &cutover); err != nil {
+		return err
+	}
+	if !*watch {
+		return p.print(cutover, cutoverHeaders, [][]string{cutoverRow(cutover)})
+	}
+	return cutoverWatch(c, p, cutover.ID, *interval)
+}
+
+func cutoverList(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("cutover list", flag.ContinueOnError)
+	status := fs.String("status", "", "Solo los cambios en este estado (running, completed, rolled_back)")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	path := "/api/v1/cutovers"
+	if *status != "" {
+		path += "?status=" + url.QueryEscape(*status)
+	}
+	var cutovers []client.Cutover
+	if err := c.get(path, &cutovers); err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(cutovers))
+	for _, cutover := range cutovers {
+		rows = append(rows, cutoverRow(cutover))
+	}
+	return p.print(cutovers, cutoverHeaders, rows)
+}
+
+// cutoverWatch muestra cada cambio de paso o estado hasta que el cambio termina; un cambio
+// revertido devuelve error para que los scripts lo detecten.
+func cutoverWatch(c *Client, p *printer, id string, interval time.Duration) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		var cutover client.Cutover
+		if err := c.get("/api/v1/cutovers/"+url.PathEscape(id), &cutover); err != nil {
+			fmt.Fprintf(os.Stderr, "error consultando el cambio: %v\n", err)
+		} else {
+			if state := fmt.Sprintf("%s/%d", cutover.Status, cutover.Weight); state != last {
+				last = state
+				if err := p.print(cutover, cutoverHeaders, [][]string{cutoverRow(cutover)}); err != nil {
+					return err
+				}
+			}
+			switch cutover.Status {
+			case "completed":
+				return nil
+			case "rolled_back":
+				return fmt.Errorf("cambio %s revertido: %s", id, cutover.Reason)
+			}
+		}
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
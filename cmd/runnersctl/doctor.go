@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// Check es el resultado de una verificación de runnersctl doctor.
+type Check struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// DoctorReport es el reporte completo; OK es false si alguna verificación falló.
+type DoctorReport struct {
+	OK     bool    `json:"ok"`
+	Checks []Check `json:"checks"`
+}
+
+// Diagnostics ejecuta el diagnóstico del lado servidor (requiere rol admin).
+func (c *Client) Diagnostics() (DoctorReport, error) {
+	var report DoctorReport
+	err := c.get("/api/v1/admin/doctor", &report)
+	return report, err
+}
+
+// probe hace un GET sin credenciales y devuelve el status y el header Date.
+func (c *Client) probe(target string) (int, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	req.Header.Set("User-Agent", "runnersctl")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp.Body.Close()
+	date, _ := http.ParseTime(resp.Header.Get("Date"))
+	return resp.StatusCode, date, nil
+}
+
+func cmdDoctor(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	webhookURL := fs.String("webhook-url", "", "URL pública del webhook (por defecto, la del gateway)")
+	maxSkew := fs.Duration("max-skew", 30*time.Second, "Desfase de reloj máximo contra el gateway")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if *webhookURL == "" {
+		*webhookURL = c.BaseURL + "/api/v1/webhooks/github"
+	}
+
+	var checks []Check
+	add := func(name, status, format string, args ...any) {
+		checks = append(checks, Check{Check: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	before := time.Now()
+	status, date, err := c.probe(c.BaseURL + "/api/v1/health")
+	switch {
+	case err != nil:
+		add("gateway.reachable", checkFail, "%v", err)
+	case status >= 500:
+		add("gateway.reachable", checkFail, "health respondió %d", status)
+	default:
+		add("gateway.reachable", checkPass, "%s (%d)", c.BaseURL, status)
+	}
+
+	if err == nil {
+		if date.IsZero() {
+			add("clock.local", checkWarn, "el gateway no devolvió header Date")
+		} else {
+			// Date tiene resolución de 1s; comparar contra el punto medio de la solicitud
+			local := before.Add(time.Since(before) / 2)
+			skew := local.Sub(date).Round(time.Second)
+			status := checkPass
+			if skew > *maxSkew+time.Second || skew < -*maxSkew-time.Second {
+				status = checkFail
+			}
+			add("clock.local", status, "%+v respecto del gateway (máximo %v)", skew, *maxSkew)
+		}
+	}
+
+	var identity map[string]any
+	if err := c.get("/api/v1/auth/whoami", &identity); err != nil {
+		add("gateway.auth", checkFail, "%v", err)
+	} else {
+		add("gateway.auth", checkPass, "%s (rol %s)", stringValue(identity["name"]), stringValue(identity["role"]))
+	}
+
+	// El endpoint solo acepta POST: 405 confirma que la ruta es alcanzable sin generar
+	// un intento de firma inválida
+	status, _, err = c.probe(*webhookURL)
+	switch {
+	case err != nil:
+		add("webhook.reachable", checkFail, "%v", err)
+	case status == http.StatusMethodNotAllowed:
+		add("webhook.reachable", checkPass, "%s", *webhookURL)
+	default:
+		add("webhook.reachable", checkFail, "%s respondió %d (se esperaba 405)", *webhookURL, status)
+	}
+
+	report, err := c.Diagnostics()
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+		add("server.diagnostics", checkWarn, "requiere rol admin; verificaciones del servidor omitidas")
+	case err != nil:
+		add("server.diagnostics", checkFail, "%v", err)
+	default:
+		checks = append(checks, report.Checks...)
+	}
+
+	result := DoctorReport{OK: true, Checks: checks}
+	rows := make([][]string, 0, len(checks))
+	for _, check := range checks {
+		if check.Status == checkFail {
+			result.OK = false
+		}
+		rows = append(rows, []string{check.Check, check.Status, check.Detail})
+	}
+	if err := p.print(result, []string{"VERIFICACIÓN", "ESTADO", "DETALLE"}, rows); err != nil {
+		return err
+	}
+	if !result.OK {
+		return errors.New("el diagnóstico encontró fallos")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// runnersctl es la CLI de operación de la flota de runners efímeros.
+// Habla con el API Gateway usando una API key (X-API-Key) o un token OIDC.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `runnersctl - operación de runners efímeros de GitHub Actions
+
+Uso:
+  runnersctl [opciones] <comando> [argumentos]
+
+Comandos:
+  pools list                                   Listar pools configurados
+  pools drift                                  Estado GitOps y runners fuera de la spec
+  reconcile [--run] [--dry-run]                Drift de runners, registros y jobs (--run reconcilia ahora)
+  runners list [--pool P]                      Listar runners activos
+  runners inspect <runner>                     Detalle de un runner
+  runners delete <runner> [--dry-run]          Destruir un runner
+  runners cleanup [--dry-run]                  Limpiar runners inactivos
+  scale <pool> --scope-name S [--count N]      Crear N runners en un pool (--size CLASE, --dry-run para simular)
+  drain <pool> [--dry-run]                     Destruir todos los runners de un pool
+  cutover start <pools> --image I [--watch]    Cambio blue/green: pools verdes, desvío por pasos y retirada de los azules
+  cutover list | status <id> | watch <id>      Cambios blue/green con su paso y fallos por lado
+  cutover rollback <id> [--reason R]           Revertir un cambio blue/green (en curso o completado)
+  webhook replay <payload.json> --event E      Reenviar un webhook de GitHub firmado
+  events tail [--interval 5s] [--pool P]       Seguir altas, bajas y cambios de estado
+  events tail --log-file F                     Guardar además los eventos en un archivo rotado (LOG_*)
+  top [--interval 2s]                          Vista en vivo de pools, runners y eventos
+  reload                                       Recargar pools y feature flags sin reiniciar
+  flags [--scope owner/repo]                   Feature flags y su evaluación
+  whoami                                       Identidad y rol de las credenciales
+  bans list | bans lift <ip>                   Revisar y levantar bloqueos por abuso
+  state export [--file F]                      Exportar snapshot de estado (pools, runners, bloqueos)
+  state import <snapshot.json> [--dry-run]     Importar snapshot (--apply-pools reemplaza los pools)
+  doctor [--webhook-url U] [--max-skew 30s]    Diagnóstico de la instalación (pass/fail)
+  completion bash|zsh|fish                     Script de autocompletado para la shell
+
+Opciones:
+`
+
+type command func(*Client, *printer, []string) error
+
+var commands = map[string]command{
+	"pools":     cmdPools,
+	"reconcile": cmdReconcile,
+	"runners":   cmdRunners,
+	"scale":     cmdScale,
+	"drain":     cmdDrain,
+	"cutover":   cmdCutover,
+	"webhook":   cmdWebhook,
+	"events":    cmdEvents,
+	"reload":    cmdReload,
+	"flags":     cmdFlags,
+	"whoami":    cmdWhoami,
+	"bans":      cmdBans,
+	"doctor":    cmdDoctor,
+	"top":       cmdTop,
+	"state":     cmdState,
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("runnersctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	gatewayURL := fs.String("url", envOr("RUNNERSCTL_URL", "http://localhost:8080"), "URL del API Gateway (RUNNERSCTL_URL)")
+	apiKey := fs.String("api-key", os.Getenv("RUNNERSCTL_API_KEY"), "API key (RUNNERSCTL_API_KEY)")
+	token := fs.String("token", os.Getenv("RUNNERSCTL_TOKEN"), "Token OIDC Bearer (RUNNERSCTL_TOKEN)")
+	output := fs.String("o", "table", "Formato de salida: table, json o yaml")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !contains(outputFormats, *output) {
+		return fmt.Errorf("formato de salida no soportado: %s (%s)", *output, strings.Join(outputFormats, ", "))
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("comando desconocido: %s", name)
+	}
+
+	client := newClient(*gatewayURL, *apiKey, *token)
+	return cmd(client, &printer{out: stdout, format: *output}, fs.Args()[1:])
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formatos de salida soportados por -o.
+var outputFormats = []string{"table", "json", "yaml"}
+
+// printer escribe resultados como tabla (por defecto), JSON o YAML.
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+// structured indica si la salida es para scripts (JSON o YAML) en lugar de tabla.
+func (p *printer) structured() bool {
+	return p.format == "json" || p.format == "yaml"
+}
+
+// print muestra value en JSON o YAML o, en formato tabla, las filas indicadas.
+func (p *printer) print(value any, headers []string, rows [][]string) error {
+	switch p.format {
+	case "json":
+		encoder := json.NewEncoder(p.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		// Los documentos se separan con "---" para que events tail -o yaml sea un stream válido
+		data, err := toYAML(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.out, "---\n%s", data)
+		return err
+	}
+
+	writer := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// message muestra un mensaje de una línea (o {"message": ...} en JSON).
+func (p *printer) message(format string, args ...any) error {
+	text := fmt.Sprintf(format, args...)
+	if p.structured() {
+		return p.print(map[string]string{"message": text}, nil, nil)
+	}
+	_, err := fmt.Fprintln(p.out, text)
+	return err
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, stringValue(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+func cmdState(c *Client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("uso: runnersctl state export [--file F] | state import <snapshot.json> [--dry-run] [--apply-pools]")
+	}
+	switch args[0] {
+	case "export":
+		return stateExport(c, p, args[1:])
+	case "import":
+		return stateImport(c, p, args[1:])
+	}
+	return fmt.Errorf("subcomando desconocido: state %s", args[0])
+}
+
+// stateExport escribe el snapshot tal cual (JSON) para poder importarlo después.
+func stateExport(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("state export", flag.ContinueOnError)
+	file := fs.String("file", "", "Archivo de salida (por defecto, la salida estándar)")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+
+	var snapshot json.RawMessage
+	if err := c.get("/api/v1/admin/state/export", &snapshot); err != nil {
+		return err
+	}
+	if *file == "" {
+		return (&printer{out: p.out, format: "json"}).print(snapshot, nil, nil)
+	}
+	if err := os.WriteFile(*file, append(snapshot, '\n'), 0o600); err != nil {
+		return err
+	}
+	return p.message("Snapshot guardado en %s", *file)
+}
+
+func stateImport(c *Client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("state import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Mostrar qué se importaría sin aplicarlo")
+	applyPools := fs.Bool("apply-pools", false, "Reemplazar los pools en memoria por los del snapshot")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(positional, 1, "state import <snapshot.json> [--dry-run] [--apply-pools]"); err != nil {
+		return err
+	}
+
+	snapshot, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	if !json.Valid(snapshot) {
+		return fmt.Errorf("%s no es JSON válido", positional[0])
+	}
+
+	query := url.Values{}
+	query.Set("dry_run", fmt.Sprint(*dryRun))
+	query.Set("apply_pools", fmt.Sprint(*applyPools))
+	var result map[string]any
+	if err := c.post("/api/v1/admin/state/import?"+query.Encode(), snapshot, &result); err != nil {
+		return err
+	}
+
+	pools, _ := result["pools"].(map[string]any)
+	rows := [][]string{
+		{"runners adoptados", joinValues(result["adopted"])},
+		{"runners ya en seguimiento", joinValues(result["already_tracked"])},
+		{"runners no encontrados", joinValues(result["missing"])},
+		{"pools agregados", joinValues(pools["added"])},
+		{"pools eliminados", joinValues(pools["removed"])},
+		{"pools modificados", joinValues(pools["changed"])},
+		{"pools aplicados", stringValue(result["pools_applied"])},
+		{"bloqueos restaurados", stringValue(result["bans_restored"])},
+	}
+	return p.print(result, []string{"RESULTADO", "DETALLE"}, rows)
+}
+
+// joinValues muestra una lista como texto separado por comas, o "-" si está vacía.
+func joinValues(value any) string {
+	if text := stringValue(value); text != "" {
+		return text
+	}
+	return "-"
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Secuencias ANSI: limpiar pantalla, ocultar y mostrar el cursor.
+const (
+	ansiClear      = "\033[H\033[2J"
+	ansiHideCursor = "\033[?25l"
+	ansiShowCursor = "\033[?25h"
+)
+
+// topEvent es un cambio detectado entre dos consultas.
+type topEvent struct {
+	Time   time.Time
+	Event  string
+	Runner Runner
+}
+
+// topState acumula lo necesario para redibujar la pantalla.
+type topState struct {
+	runners map[string]Runner
+	pools   []map[string]any
+	events  []topEvent
+	err     error
+	updated time.Time
+}
+
+// update incorpora una nueva consulta y registra altas, bajas y cambios de estado.
+func (s *topState) update(runners []Runner, maxEvents int, first bool) {
+	now := time.Now()
+	current := make(map[string]Runner, len(runners))
+	for _, runner := range runners {
+		current[runner.RunnerID] = runner
+		previous, seen := s.runners[runner.RunnerID]
+		switch {
+		case !seen && !first:
+			s.events = append(s.events, topEvent{now, "created", runner})
+		case seen && previous.Status != runner.Status:
+			s.events = append(s.events, topEvent{now, "status", runner})
+		}
+	}
+	for id, runner := range s.runners {
+		if _, ok := current[id]; !ok {
+			runner.Status = "removed"
+			s.events = append(s.events, topEvent{now, "removed", runner})
+		}
+	}
+	if len(s.events) > maxEvents {
+		s.events = s.events[len(s.events)-maxEvents:]
+	}
+	s.runners = current
+	s.updated = now
+}
+
+func (s *topState) render(baseURL string, maxRunners int) []byte {
+	var out bytes.Buffer
+	out.WriteString(ansiClear)
+	fmt.Fprintf(&out, "runnersctl top - %s - %s (Ctrl+C para salir)\n", baseURL, s.updated.Format("15:04:05"))
+	if s.err != nil {
+		fmt.Fprintf(&out, "ERROR: %v\n", s.err)
+	}
+
+	// Estados por pool, incluidos los pools sin runners
+	counts := map[string]map[string]int{}
+	for _, pool := range s.pools {
+		counts[stringValue(pool["name"])] = map[string]int{}
+	}
+	for _, runner := range s.runners {
+		if counts[runner.Pool()] == nil {
+			counts[runner.Pool()] = map[string]int{}
+		}
+		counts[runner.Pool()][runner.Status]++
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&out, "\nPOOLS (%d)  RUNNERS (%d)  JOBS EN COLA: n/d (el gateway no registra jobs)\n\n", len(names), len(s.runners))
+	table := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "POOL\tRUNNING\tSTOPPED\tERROR\tTOTAL")
+	for _, name := range names {
+		c := counts[name]
+		total := 0
+		for _, n := range c {
+			total += n
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\n", name, c["running"], c["stopped"], c["error"], total)
+	}
+	table.Flush()
+
+	runners := make([]Runner, 0, len(s.runners))
+	for _, runner := range s.runners {
+		runners = append(runners, runner)
+	}
+	sort.Slice(runners, func(i, j int) bool { return runners[i].Created > runners[j].Created })
+	if len(runners) > maxRunners {
+		runners = runners[:maxRunners]
+	}
+	fmt.Fprintln(&out)
+	table = tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RUNNER\tPOOL\tESTADO\tCREADO")
+	for _, runner := range runners {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", runner.RunnerID, runner.Pool(), runner.Status, runner.Created)
+	}
+	table.Flush()
+
+	fmt.Fprintln(&out, "\nEVENTOS RECIENTES")
+	if len(s.events) == 0 {
+		fmt.Fprintln(&out, "  (sin eventos desde el inicio)")
+	}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		fmt.Fprintf(&out, "  %s  %-8s %s (pool %s, %s)\n",
+			event.Time.Format("15:04:05"), event.Event, event.Runner.RunnerID, event.Runner.Pool(), event.Runner.Status)
+	}
+	return out.Bytes()
+}
+
+func cmdTop(c *Client, p *printer, args []string) error {
+	if p.structured() {
+		return fmt.Errorf("top no admite -o %s; usar 'events tail -o %s'", p.format, p.format)
+	}
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	interval := fs.Duration("interval", 2*time.Second, "Intervalo de actualización")
+	maxRunners := fs.Int("runners", 20, "Máximo de runners listados")
+	maxEvents := fs.Int("events", 10, "Eventos recientes mostrados")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	fmt.Fprint(p.out, ansiHideCursor)
+	defer fmt.Fprint(p.out, ansiShowCursor)
+
+	state := &topState{runners: map[string]Runner{}}
+	first := true
+	for {
+		runners, err := c.ListRunners()
+		if err == nil {
+			state.update(runners, *maxEvents, first)
+			first = false
+			// Los pools cambian poco; un error aquí no invalida la vista de runners
+			if pools, poolErr := c.ListPools(); poolErr == nil {
+				state.pools = pools
+			}
+		}
+		state.err = err
+		if _, err := p.out.Write(state.render(c.BaseURL, *maxRunners)); err != nil {
+			return err
+		}
+
+		select {
+		case <-interrupt:
+			fmt.Fprintln(p.out)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// La CLI no tiene dependencias externas: el YAML se genera a partir del JSON del
+// valor, recorriendo sus tokens para respetar el orden de los campos y los tags json.
+
+// yamlNode es un valor JSON decodificado conservando el orden de las claves.
+type yamlNode struct {
+	scalar string
+	keys   []string
+	values []*yamlNode
+	isMap  bool
+	isList bool
+}
+
+func toYAML(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := decodeYAMLNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if node.isMap || node.isList {
+		writeYAML(&out, node, 0)
+	} else {
+		out.WriteString(node.scalar + "\n")
+	}
+	return out.Bytes(), nil
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (*yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yamlNode{isMap: value == '{', isList: value == '['}
+		for decoder.More() {
+			if node.isMap {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			child, err := decodeYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, child)
+		}
+		// Delimitador de cierre
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	case bool:
+		return &yamlNode{scalar: strconv.FormatBool(value)}, nil
+	case json.Number:
+		return &yamlNode{scalar: value.String()}, nil
+	case string:
+		return &yamlNode{scalar: yamlString(value)}, nil
+	}
+	return nil, fmt.Errorf("token JSON inesperado: %v", token)
+}
+
+// inline devuelve la representación en la misma línea de escalares y colecciones vacías.
+func (n *yamlNode) inline() (string, bool) {
+	switch {
+	case n.isMap && len(n.values) == 0:
+		return "{}", true
+	case n.isList && len(n.values) == 0:
+		return "[]", true
+	case !n.isMap && !n.isList:
+		return n.scalar, true
+	}
+	return "", false
+}
+
+func writeYAML(out *bytes.Buffer, node *yamlNode, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i, child := range node.values {
+		prefix := pad + "- "
+		if node.isMap {
+			prefix = pad + yamlString(node.keys[i]) + ":"
+		}
+		if text, ok := child.inline(); ok {
+			if node.isMap {
+				prefix += " "
+			}
+			out.WriteString(prefix + text + "\n")
+			continue
+		}
+		if node.isList && child.isMap {
+			// Primer campo del mapa en la línea del guion: "- name: x"
+			var nested bytes.Buffer
+			writeYAML(&nested, child, indent+2)
+			out.WriteString(prefix + strings.TrimPrefix(nested.String(), pad+"  "))
+			continue
+		}
+		out.WriteString(strings.TrimRight(prefix, " ") + "\n")
+		writeYAML(out, child, indent+2)
+	}
+}
+
+// yamlString cita los strings que YAML interpretaría como otro tipo o como sintaxis.
+func yamlString(value string) string {
+	if value == "" || value != strings.TrimSpace(value) || strings.ContainsAny(value, "\n\t\"\\") {
+		return strconv.Quote(value)
+	}
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return strconv.Quote(value)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.Quote(value)
+	}
+	if strings.ContainsRune("-?:,[]{}#&*!|>'%@`", rune(value[0])) ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":") {
+		return strconv.Quote(value)
+	}
+	return value
+}
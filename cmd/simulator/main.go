@@ -0,0 +1,167 @@
+// simulator genera tráfico sintético de webhooks workflow_job (ráfagas, matrices y
+// cancelaciones) contra el API Gateway y hace de orchestrator con un aprovisionador
+// falso, para medir la latencia de cola de extremo a extremo antes de un día de
+// migración sin crear runners reales.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+const usage = `simulator - carga sintética de workflow_job contra el API Gateway
+
+Uso:
+  simulator [opciones]
+
+Escenarios (-scenario):
+  steady   Llegadas de Poisson a -rate jobs/s
+  burst    steady más ráfagas de -burst-size jobs cada -burst-every
+  matrix   Cada llegada es un workflow con -matrix jobs encolados a la vez
+  cancel   steady con -cancel-ratio de jobs cancelados (antes o durante la ejecución)
+  mixed    Todo lo anterior
+
+Con -gateway los webhooks se firman con -secret y se envían al gateway, que debe tener
+al simulador como orchestrator (ORCHESTRATOR_SHARDS=sim=http://<host>:8099). Sin
+-gateway las entregas van directas al aprovisionador falso (política sin red).
+
+Opciones:
+`
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("simulator", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var cfg config
+	fs.StringVar(&cfg.gatewayURL, "gateway", os.Getenv("SIM_GATEWAY_URL"), "URL del API Gateway (SIM_GATEWAY_URL); vacío envía directo al aprovisionador")
+	fs.StringVar(&cfg.secret, "secret", os.Getenv("GITHUB_WEBHOOK_SECRET"), "Secreto para firmar los webhooks (GITHUB_WEBHOOK_SECRET)")
+	fs.StringVar(&cfg.listen, "listen", envOr("SIM_LISTEN", ":8099"), "Dirección del orchestrator falso (SIM_LISTEN)")
+	fs.StringVar(&cfg.scenario, "scenario", "steady", "Escenario: "+strings.Join(scenarios, ", "))
+	fs.DurationVar(&cfg.duration, "duration", 10*time.Minute, "Duración simulada de la generación de tráfico")
+	fs.Float64Var(&cfg.rate, "rate", 1, "Jobs (o workflows en matrix) por segundo simulado")
+	fs.IntVar(&cfg.repos, "repos", 20, "Repositorios entre los que se reparten los jobs")
+	fs.StringVar(&cfg.owner, "owner", "sim-org", "Owner de los repositorios sintéticos")
+	fs.StringVar(&cfg.labels, "labels", "self-hosted,linux", "Labels de los jobs, separados por comas")
+	fs.IntVar(&cfg.burstSize, "burst-size", 100, "Jobs por ráfaga (burst, mixed)")
+	fs.DurationVar(&cfg.burstEvery, "burst-every", 5*time.Minute, "Intervalo entre ráfagas (burst, mixed)")
+	fs.IntVar(&cfg.matrix, "matrix", 8, "Jobs por workflow (matrix, mixed)")
+	fs.Float64Var(&cfg.cancelRatio, "cancel-ratio", 0.2, "Proporción de jobs cancelados (cancel, mixed)")
+	fs.DurationVar(&cfg.jobDuration, "job-duration", 3*time.Minute, "Duración media de un job")
+	fs.IntVar(&cfg.capacity, "capacity", 50, "Runners simultáneos que admite el aprovisionador falso")
+	fs.DurationVar(&cfg.provisionLatency, "provision-latency", 20*time.Second, "Tiempo hasta que un runner queda online")
+	fs.DurationVar(&cfg.provisionJitter, "provision-jitter", 10*time.Second, "Variación aleatoria sumada a -provision-latency")
+	fs.Float64Var(&cfg.failureRatio, "failure-ratio", 0, "Proporción de runners que nunca quedan online")
+	fs.Float64Var(&cfg.speedup, "speedup", 1, "Factor de aceleración del reloj (10 simula 10 minutos en 1)")
+	fs.DurationVar(&cfg.drainTimeout, "drain-timeout", 30*time.Minute, "Espera simulada máxima a que terminen los jobs tras la generación")
+	fs.IntVar(&cfg.concurrency, "concurrency", 50, "Webhooks en vuelo como máximo")
+	fs.Int64Var(&cfg.seed, "seed", 0, "Semilla del generador (0: aleatoria)")
+	output := fs.String("o", "table", "Formato del informe: table o json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !contains(scenarios, cfg.scenario) {
+		return fmt.Errorf("escenario desconocido: %s (%s)", cfg.scenario, strings.Join(scenarios, ", "))
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("formato de salida no soportado: %s (table, json)", *output)
+	}
+	if cfg.rate <= 0 || cfg.speedup <= 0 || cfg.capacity <= 0 || cfg.repos <= 0 {
+		return errors.New("-rate, -speedup, -capacity y -repos deben ser positivos")
+	}
+	if cfg.matrix < 1 || cfg.matrix > 256 {
+		return errors.New("-matrix debe estar entre 1 y 256 (límite de GitHub)")
+	}
+	if cfg.gatewayURL != "" && cfg.secret == "" {
+		return errors.New("-secret (GITHUB_WEBHOOK_SECRET) es obligatorio con -gateway")
+	}
+	if cfg.seed == 0 {
+		cfg.seed = time.Now().UnixNano()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A ritmos altos el propio simulador puede quedarse sin memoria: con los umbrales
+	// superados durante SIM_RESTART_AFTER se detiene con el informe parcial
+	limits, err := watchdog.LimitsFromEnv("SIM", watchdog.DefaultLimits)
+	if err != nil {
+		return err
+	}
+	var aborted atomic.Value
+	wd := watchdog.New("simulator", limits, nil, func(reason string) {
+		log.Printf("🛑 Watchdog: se interrumpe la simulación: %s", reason)
+		aborted.Store(reason)
+		stop()
+	})
+	go wd.Run(ctx)
+
+	sim := newSimulation(cfg)
+	if cfg.gatewayURL != "" {
+		server := &http.Server{Addr: cfg.listen, Handler: sim.provisioner}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("❌ Orchestrator falso: %v", err)
+				stop()
+			}
+		}()
+		defer server.Close()
+		log.Printf("🚀 Orchestrator falso escuchando en %s; webhooks a %s", cfg.listen, cfg.gatewayURL)
+	}
+
+	log.Printf("📈 Escenario %s durante %s (x%s, semilla %d)", cfg.scenario, cfg.duration, strconv.FormatFloat(cfg.speedup, 'g', -1, 64), cfg.seed)
+	report := sim.run(ctx)
+	if reason, ok := aborted.Load().(string); ok {
+		report.Aborted = reason
+	}
+	if err := printReport(stdout, *output, report); err != nil {
+		return err
+	}
+	if report.Aborted != "" {
+		return errors.New("simulación interrumpida por el watchdog")
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runner es un runner del aprovisionador falso.
+type runner struct {
+	name     string
+	jobID    int64
+	queuedAt time.Time
+	online   bool
+	released bool
+}
+
+// provisioner hace de orchestrator: crea runners falsos con la latencia y la capacidad
+// configuradas y, cuando quedan online, le pasan su job a la simulación.
+type provisioner struct {
+	sim *simulation
+
+	mu      sync.Mutex
+	runners map[int64]*runner
+	pending []*runner
+	active  int
+	next    int
+
+	maxActive    int
+	maxPending   int
+	failed       int
+	capacityWait []time.Duration
+}
+
+func newProvisioner(sim *simulation) *provisioner {
+	return &provisioner{sim: sim, runners: map[int64]*runner{}}
+}
+
+type createRequest struct {
+	ScopeName string `json:"scope_name"`
+	Count     int    `json:"count"`
+	JobID     string `json:"job_id"`
+}
+
+type runnerResponse struct {
+	RunnerID string `json:"runner_id"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+}
+
+// ServeHTTP atiende las rutas del orchestrator que usa el gateway para los webhooks.
+func (p *provisioner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodPost && path == "runners/create":
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		jobID, _ := strconv.ParseInt(req.JobID, 10, 64)
+		count := req.Count
+		if count < 1 || jobID != 0 {
+			count = 1
+		}
+		responses := make([]runnerResponse, 0, count)
+		for i := 0; i < count; i++ {
+			responses = append(responses, p.create(jobID))
+		}
+		writeJSON(w, http.StatusOK, responses)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "jobs" && parts[2] == "complete":
+		jobID, _ := strconv.ParseInt(parts[1], 10, 64)
+		p.release(jobID)
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Job completado", "data": nil})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "jobs" && parts[2] == "started":
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Job iniciado", "data": nil})
+	case r.Method == http.MethodGet && (path == "health" || path == "healthz"):
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Servicio saludable", "data": map[string]any{"service": "simulator"}})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "No disponible en el simulador"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// direct aplica una entrega sin pasar por el gateway (lo que haría su WebhookHandler).
+func (p *provisioner) direct(payload map[string]any) {
+	jobID := payload["workflow_job"].(map[string]any)["id"].(int64)
+	switch payload["action"] {
+	case "queued":
+		p.create(jobID)
+	case "completed":
+		p.release(jobID)
+	}
+}
+
+// create crea el runner de un job, o lo deja en espera si se alcanzó -capacity.
+func (p *provisioner) create(jobID int64) runnerResponse {
+	p.sim.requested(jobID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.runners[jobID]; ok && jobID != 0 {
+		return runnerResponse{RunnerID: existing.name, Status: "duplicate", Message: "Runner ya creado para el job"}
+	}
+	p.next++
+	r := &runner{name: fmt.Sprintf("sim-runner-%d", p.next), jobID: jobID, queuedAt: time.Now()}
+	if jobID != 0 {
+		p.runners[jobID] = r
+	}
+	if p.active >= p.sim.cfg.capacity {
+		p.pending = append(p.pending, r)
+		p.maxPending = max(p.maxPending, len(p.pending))
+		return runnerResponse{RunnerID: r.name, Status: "queued", Message: "Capacidad agotada: runner en espera"}
+	}
+	p.start(r)
+	return runnerResponse{RunnerID: r.name, Status: "created", Message: "Runner creado"}
+}
+
+// start ocupa un hueco de capacidad y aprovisiona el runner (con p.mu tomado).
+func (p *provisioner) start(r *runner) {
+	p.active++
+	p.maxActive = max(p.maxActive, p.active)
+	p.capacityWait = append(p.capacityWait, p.sim.simulated(time.Since(r.queuedAt)))
+	latency := p.sim.cfg.provisionLatency + time.Duration(p.sim.random()*float64(p.sim.cfg.provisionJitter))
+	fails := p.sim.random() < p.sim.cfg.failureRatio
+	go func() {
+		p.sim.sleep(context.Background(), latency)
+		p.mu.Lock()
+		if r.released || fails {
+			if fails && !r.released {
+				p.failed++
+			}
+			// Un runner que nunca queda online se pierde; su job sigue en cola
+			delete(p.runners, r.jobID)
+			p.free()
+			p.mu.Unlock()
+			return
+		}
+		r.online = true
+		p.mu.Unlock()
+		if !p.sim.runnerOnline(r.jobID, r.name) {
+			p.release(r.jobID)
+		}
+	}()
+}
+
+// release destruye el runner del job (completado o cancelado) y libera su hueco.
+func (p *provisioner) release(jobID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.runners[jobID]
+	if !ok {
+		return
+	}
+	delete(p.runners, jobID)
+	for i, waiting := range p.pending {
+		if waiting == r {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return
+		}
+	}
+	if r.online {
+		p.free()
+		return
+	}
+	// En aprovisionamiento: el hueco se libera cuando termina
+	r.released = true
+}
+
+// free libera un hueco y arranca el siguiente runner en espera (con p.mu tomado).
+func (p *provisioner) free() {
+	p.active--
+	if len(p.pending) > 0 {
+		next := p.pending[0]
+		p.pending = p.pending[1:]
+		p.start(next)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// distribution resume una serie de latencias (en tiempo simulado).
+type distribution struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+func newDistribution(values []time.Duration) distribution {
+	if len(values) == 0 {
+		return distribution{}
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		index := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(index, 0)]
+	}
+	return distribution{
+		Count: len(sorted),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P95:   percentile(0.95),
+		P99:   percentile(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+type report struct {
+	Scenario  string        `json:"scenario"`
+	Seed      int64         `json:"seed"`
+	Simulated time.Duration `json:"simulated"`
+	Jobs      struct {
+		Queued    int `json:"queued"`
+		Started   int `json:"started"`
+		Cancelled int `json:"cancelled"`
+		Waiting   int `json:"waiting"`
+	} `json:"jobs"`
+	Runners struct {
+		Capacity   int `json:"capacity"`
+		MaxActive  int `json:"max_active"`
+		MaxPending int `json:"max_pending"`
+		Failed     int `json:"failed"`
+	} `json:"runners"`
+	// Encolado en GitHub -> runner online con el job (lo que espera un desarrollador)
+	QueueLatency distribution `json:"queue_latency"`
+	// Encolado -> petición de runner recibida por el orchestrator (gateway y red, en tiempo real)
+	DispatchLatency distribution `json:"dispatch_latency"`
+	// Espera por capacidad antes de empezar a aprovisionar
+	CapacityWait distribution   `json:"capacity_wait"`
+	Webhooks     map[string]int `json:"webhooks"`
+	Failures     map[string]int `json:"webhook_failures"`
+	// Motivo si el watchdog interrumpió la simulación: las latencias de un simulador
+	// sobrecargado miden al simulador, no al gateway
+	Aborted string `json:"aborted,omitempty"`
+}
+
+func (s *simulation) report(simulated time.Duration) *report {
+	r := &report{Scenario: s.cfg.scenario, Seed: s.cfg.seed, Simulated: simulated.Round(time.Second)}
+
+	var queue, dispatch []time.Duration
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		r.Jobs.Queued++
+		if !j.requestedAt.IsZero() {
+			dispatch = append(dispatch, j.requestedAt.Sub(j.queuedAt))
+		}
+		switch {
+		case !j.startedAt.IsZero():
+			r.Jobs.Started++
+			queue = append(queue, s.simulated(j.startedAt.Sub(j.queuedAt)))
+		case j.cancelled:
+			r.Jobs.Cancelled++
+		default:
+			r.Jobs.Waiting++
+		}
+		if j.cancelled && !j.startedAt.IsZero() {
+			r.Jobs.Cancelled++
+		}
+	}
+	s.mu.Unlock()
+
+	p := s.provisioner
+	p.mu.Lock()
+	r.Runners.Capacity = s.cfg.capacity
+	r.Runners.MaxActive = p.maxActive
+	r.Runners.MaxPending = p.maxPending
+	r.Runners.Failed = p.failed
+	r.CapacityWait = newDistribution(p.capacityWait)
+	p.mu.Unlock()
+
+	r.QueueLatency = newDistribution(queue)
+	r.DispatchLatency = newDistribution(dispatch)
+	r.Webhooks, r.Failures = s.sender.counts()
+	return r
+}
+
+func printReport(out io.Writer, format string, r *report) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	fmt.Fprintf(out, "Escenario %s (semilla %d), %s simulados\n\n", r.Scenario, r.Seed, r.Simulated)
+	if r.Aborted != "" {
+		fmt.Fprintf(out, "Interrumpida por el watchdog: %s\n\n", r.Aborted)
+	}
+	fmt.Fprintf(out, "Jobs: %d encolados, %d iniciados, %d cancelados, %d sin iniciar\n", r.Jobs.Queued, r.Jobs.Started, r.Jobs.Cancelled, r.Jobs.Waiting)
+	fmt.Fprintf(out, "Runners: capacidad %d, máximo activos %d, máximo en espera %d, fallidos %d\n\n", r.Runners.Capacity, r.Runners.MaxActive, r.Runners.MaxPending, r.Runners.Failed)
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "LATENCIA\tN\tP50\tP90\tP95\tP99\tMAX")
+	for _, row := range []struct {
+		name string
+		dist distribution
+	}{
+		{"cola (encolado -> online)", r.QueueLatency},
+		{"despacho (gateway, real)", r.DispatchLatency},
+		{"espera por capacidad", r.CapacityWait},
+	} {
+		d := row.dist
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", row.name, d.Count, short(d.P50), short(d.P90), short(d.P95), short(d.P99), short(d.Max))
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	actions := make([]string, 0, len(r.Webhooks))
+	for action, count := range r.Webhooks {
+		actions = append(actions, fmt.Sprintf("%s=%d (%d fallidos)", action, count, r.Failures[action]))
+	}
+	sort.Strings(actions)
+	_, err := fmt.Fprintf(out, "\nWebhooks: %s\n", strings.Join(actions, ", "))
+	return err
+}
+
+func short(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(100 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond).String()
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Escenarios soportados por -scenario.
+var scenarios = []string{"steady", "burst", "matrix", "cancel", "mixed"}
+
+type config struct {
+	gatewayURL       string
+	secret           string
+	listen           string
+	scenario         string
+	duration         time.Duration
+	rate             float64
+	repos            int
+	owner            string
+	labels           string
+	burstSize        int
+	burstEvery       time.Duration
+	matrix           int
+	cancelRatio      float64
+	jobDuration      time.Duration
+	capacity         int
+	provisionLatency time.Duration
+	provisionJitter  time.Duration
+	failureRatio     float64
+	speedup          float64
+	drainTimeout     time.Duration
+	concurrency      int
+	seed             int64
+}
+
+// job es un workflow_job sintético y los instantes (reales) de cada etapa.
+type job struct {
+	ID       int64
+	RunID    int64
+	Name     string
+	Repo     string
+	Labels   []string
+	Duration time.Duration
+	// Momento simulado de la cancelación desde que se encola (0: no se cancela)
+	CancelAfter time.Duration
+
+	queuedAt    time.Time
+	requestedAt time.Time
+	startedAt   time.Time
+	runnerName  string
+	cancelled   bool
+	done        bool
+}
+
+// simulation reúne el generador de tráfico, el emisor de webhooks y el aprovisionador falso.
+type simulation struct {
+	cfg         config
+	rng         *rand.Rand
+	rngMu       sync.Mutex
+	labels      []string
+	provisioner *provisioner
+	sender      *sender
+
+	mu   sync.Mutex
+	jobs map[int64]*job
+	// Siguiente run_id; arranca en el reloj para no chocar con simulaciones anteriores
+	nextRun int64
+	wg      sync.WaitGroup
+}
+
+func newSimulation(cfg config) *simulation {
+	s := &simulation{
+		cfg:     cfg,
+		rng:     rand.New(rand.NewSource(cfg.seed)),
+		jobs:    map[int64]*job{},
+		nextRun: time.Now().Unix() * 1000,
+	}
+	for _, label := range strings.Split(cfg.labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			s.labels = append(s.labels, label)
+		}
+	}
+	s.provisioner = newProvisioner(s)
+	s.sender = newSender(s)
+	return s
+}
+
+// real convierte una duración simulada en tiempo de reloj según -speedup.
+func (s *simulation) real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / s.cfg.speedup)
+}
+
+// simulated convierte tiempo de reloj en tiempo simulado.
+func (s *simulation) simulated(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * s.cfg.speedup)
+}
+
+func (s *simulation) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(s.real(d))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *simulation) random() float64 {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	return s.rng.Float64()
+}
+
+func (s *simulation) exponential(mean time.Duration) time.Duration {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	return time.Duration(s.rng.ExpFloat64() * float64(mean))
+}
+
+func (s *simulation) enabled(feature string) bool {
+	return s.cfg.scenario == feature || s.cfg.scenario == "mixed"
+}
+
+// run genera tráfico durante -duration, espera a que terminen los jobs y devuelve el informe.
+func (s *simulation) run(ctx context.Context) *report {
+	started := time.Now()
+	genCtx, cancel := context.WithTimeout(ctx, s.real(s.cfg.duration))
+	defer cancel()
+
+	var generators sync.WaitGroup
+	generators.Add(1)
+	go func() {
+		defer generators.Done()
+		s.arrivals(genCtx)
+	}()
+	if s.enabled("burst") {
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			s.bursts(genCtx)
+		}()
+	}
+	generators.Wait()
+	log.Printf("⏳ Generación terminada (%d jobs); esperando a que terminen", s.count())
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		log.Printf("⚠️ Simulación interrumpida; el informe incluye los jobs sin terminar")
+	case <-time.After(s.real(s.cfg.drainTimeout)):
+		log.Printf("⚠️ -drain-timeout vencido; el informe incluye los jobs sin terminar")
+	}
+	return s.report(s.simulated(time.Since(started)))
+}
+
+func (s *simulation) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+// arrivals encola jobs (o workflows de -matrix jobs) con llegadas de Poisson a -rate por segundo.
+func (s *simulation) arrivals(ctx context.Context) {
+	mean := time.Duration(float64(time.Second) / s.cfg.rate)
+	for s.sleep(ctx, s.exponential(mean)) {
+		size := 1
+		if s.enabled("matrix") {
+			size = s.cfg.matrix
+		}
+		s.workflow(ctx, size)
+	}
+}
+
+// bursts encola -burst-size jobs repartidos en un segundo cada -burst-every.
+func (s *simulation) bursts(ctx context.Context) {
+	for s.sleep(ctx, s.cfg.burstEvery) {
+		log.Printf("💥 Ráfaga de %d jobs", s.cfg.burstSize)
+		for i := 0; i < s.cfg.burstSize && ctx.Err() == nil; i++ {
+			s.workflow(ctx, 1)
+			s.sleep(ctx, time.Second/time.Duration(s.cfg.burstSize))
+		}
+	}
+}
+
+// workflow encola a la vez los jobs de una ejecución (uno solo fuera de matrix).
+func (s *simulation) workflow(ctx context.Context, size int) {
+	s.rngMu.Lock()
+	repo := fmt.Sprintf("%s/repo-%03d", s.cfg.owner, s.rng.Intn(s.cfg.repos))
+	s.rngMu.Unlock()
+
+	s.mu.Lock()
+	runID := s.nextRun
+	s.nextRun++
+	jobs := make([]*job, 0, size)
+	for i := 0; i < size; i++ {
+		j := &job{
+			ID:       runID*1000 + int64(i),
+			RunID:    runID,
+			Name:     "build",
+			Repo:     repo,
+			Labels:   s.labels,
+			Duration: s.cfg.jobDuration/2 + s.exponential(s.cfg.jobDuration/2),
+			queuedAt: time.Now(),
+		}
+		if size > 1 {
+			j.Name = fmt.Sprintf("build (%d)", i)
+		}
+		if s.enabled("cancel") && s.random() < s.cfg.cancelRatio {
+			// Antes de tener runner o en mitad de la ejecución
+			j.CancelAfter = time.Duration(s.random() * float64(s.cfg.provisionLatency+j.Duration))
+		}
+		s.jobs[j.ID] = j
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		s.wg.Add(1)
+		go s.deliver(j, "queued")
+		if j.CancelAfter > 0 {
+			go func(j *job) {
+				if s.sleep(ctx, j.CancelAfter) {
+					s.cancel(j)
+				}
+			}(j)
+		}
+	}
+}
+
+// deliver envía el webhook de la acción indicada con el estado actual del job.
+func (s *simulation) deliver(j *job, action string) {
+	s.mu.Lock()
+	payload := webhookPayload(j, action)
+	s.mu.Unlock()
+	s.sender.send(payload)
+}
+
+// runnerOnline se llama cuando el runner creado para el job aparece online.
+func (s *simulation) runnerOnline(jobID int64, runnerName string) bool {
+	s.mu.Lock()
+	j := s.jobs[jobID]
+	if j == nil || j.done || j.cancelled {
+		s.mu.Unlock()
+		return false
+	}
+	j.startedAt = time.Now()
+	j.runnerName = runnerName
+	s.mu.Unlock()
+
+	s.deliver(j, "in_progress")
+	go func() {
+		s.sleep(context.Background(), j.Duration)
+		s.finish(j, false)
+	}()
+	return true
+}
+
+// cancel cancela el job: GitHub envía completed con conclusion=cancelled.
+func (s *simulation) cancel(j *job) {
+	s.mu.Lock()
+	if j.done {
+		s.mu.Unlock()
+		return
+	}
+	j.cancelled = true
+	s.mu.Unlock()
+	s.finish(j, true)
+}
+
+func (s *simulation) finish(j *job, cancelled bool) {
+	s.mu.Lock()
+	if j.done || (j.cancelled && !cancelled) {
+		s.mu.Unlock()
+		return
+	}
+	j.done = true
+	s.mu.Unlock()
+	s.deliver(j, "completed")
+	s.wg.Done()
+}
+
+// requested anota cuándo llegó al orchestrator la petición de runner del job.
+func (s *simulation) requested(jobID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j := s.jobs[jobID]; j != nil && j.requestedAt.IsZero() {
+		j.requestedAt = time.Now()
+	}
+}
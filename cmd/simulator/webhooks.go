@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookPayload arma un evento workflow_job como los que envía GitHub.
+func webhookPayload(j *job, action string) map[string]any {
+	timestamp := func(t time.Time) any {
+		if t.IsZero() {
+			return nil
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	status, conclusion := action, any(nil)
+	var completedAt any
+	if action == "completed" {
+		conclusion = "success"
+		if j.cancelled {
+			conclusion = "cancelled"
+		}
+		completedAt = timestamp(time.Now())
+	}
+	var runnerName any
+	if j.runnerName != "" {
+		runnerName = j.runnerName
+	}
+	return map[string]any{
+		"action": action,
+		"workflow_job": map[string]any{
+			"id":            j.ID,
+			"run_id":        j.RunID,
+			"run_attempt":   1,
+			"name":          j.Name,
+			"workflow_name": "simulator",
+			"labels":        j.Labels,
+			"status":        status,
+			"conclusion":    conclusion,
+			"created_at":    timestamp(j.queuedAt),
+			"started_at":    timestamp(j.startedAt),
+			"completed_at":  completedAt,
+			"runner_name":   runnerName,
+		},
+		"repository": map[string]any{"full_name": j.Repo},
+	}
+}
+
+func deliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// sender entrega los webhooks al gateway firmados o, sin gateway, directo al aprovisionador.
+type sender struct {
+	sim    *simulation
+	url    string
+	secret string
+	http   *http.Client
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	sent     map[string]int
+	failures map[string]int
+}
+
+func newSender(sim *simulation) *sender {
+	concurrency := sim.cfg.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &sender{
+		sim:      sim,
+		url:      strings.TrimRight(sim.cfg.gatewayURL, "/") + "/api/v1/webhooks/github",
+		secret:   sim.cfg.secret,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		slots:    make(chan struct{}, concurrency),
+		sent:     map[string]int{},
+		failures: map[string]int{},
+	}
+}
+
+func (s *sender) send(payload map[string]any) {
+	action := payload["action"].(string)
+	var err error
+	if s.sim.cfg.gatewayURL == "" {
+		s.sim.provisioner.direct(payload)
+	} else {
+		s.slots <- struct{}{}
+		err = s.post(payload)
+		<-s.slots
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[action]++
+	if err != nil {
+		s.failures[action]++
+		// Un error por acción y cada cien, para no inundar el log en una caída
+		if s.failures[action]%100 == 1 {
+			log.Printf("⚠️ Webhook %s fallido (%d): %v", action, s.failures[action], err)
+		}
+	}
+}
+
+func (s *sender) post(payload map[string]any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/simulator")
+	req.Header.Set("X-GitHub-Event", "workflow_job")
+	req.Header.Set("X-GitHub-Delivery", deliveryID())
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *sender) counts() (map[string]int, map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent, failures := map[string]int{}, map[string]int{}
+	for action, count := range s.sent {
+		sent[action] = count
+	}
+	for action, count := range s.failures {
+		failures[action] = count
+	}
+	return sent, failures
+}
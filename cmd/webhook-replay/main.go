@@ -0,0 +1,156 @@
+// webhook-replay reenvía una grabación de webhooks del gateway (WEBHOOK_RECORD_DIR) a un
+// stack de staging, firmada con su secreto y al ritmo original o acelerado, para
+// reproducir un pico de tráfico real.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+const usage = `webhook-replay - reproduce webhooks grabados por el gateway contra staging
+
+Uso:
+  webhook-replay [opciones] grabacion.jsonl [grabacion.jsonl.gz ...]
+
+Las grabaciones son los ficheros webhooks-AAAAMMDD-HH.jsonl de WEBHOOK_RECORD_DIR (o
+del bucket de WEBHOOK_RECORD_S3_BUCKET); "-" lee la entrada estándar. Cada entrega se
+firma con -secret y se envía con un X-GitHub-Delivery nuevo.
+
+Opciones:
+`
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s debe ser RFC 3339 (2026-03-10T14:00:00Z): %w", name, err)
+	}
+	return t, nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("webhook-replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	gateway := fs.String("gateway", os.Getenv("REPLAY_GATEWAY_URL"), "URL del API Gateway de staging (REPLAY_GATEWAY_URL)")
+	secret := fs.String("secret", os.Getenv("GITHUB_WEBHOOK_SECRET"), "Secreto de webhooks del gateway de staging (GITHUB_WEBHOOK_SECRET)")
+	speedup := fs.Float64("speedup", 1, "Factor de aceleración del ritmo grabado (1: original; 0: tan rápido como -concurrency permita)")
+	fromFlag := fs.String("from", "", "Reproducir solo desde esta hora de recepción (RFC 3339)")
+	toFlag := fs.String("to", "", "Reproducir solo hasta esta hora de recepción (RFC 3339, excluida)")
+	ownerMap := fs.String("owner-map", envOr("REPLAY_OWNER_MAP", ""), "Owners a reescribir, origen=destino separados por comas (REPLAY_OWNER_MAP)")
+	idOffset := fs.Int64("id-offset", 0, "Suma a los IDs de job y run, para repetir una grabación sin que staging la deduplique")
+	shiftTimes := fs.Bool("shift-times", true, "Desplazar las horas de los jobs al momento de la reproducción (WEBHOOK_MAX_AGE)")
+	concurrency := fs.Int("concurrency", 20, "Entregas en vuelo como máximo")
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout de cada entrega")
+	dryRun := fs.Bool("dry-run", false, "Solo resumir la grabación, sin enviar nada")
+	output := fs.String("o", "table", "Formato del informe: table o json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("falta al menos una grabación")
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("formato de salida no soportado: %s (table, json)", *output)
+	}
+	if *speedup < 0 || *concurrency < 1 {
+		return errors.New("-speedup no puede ser negativo y -concurrency debe ser positivo")
+	}
+	from, err := parseTime("-from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("-to", *toFlag)
+	if err != nil {
+		return err
+	}
+	owners, err := parseOwnerMap(*ownerMap)
+	if err != nil {
+		return err
+	}
+
+	records, err := loadRecords(fs.Args(), stdin, from, to)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("ninguna entrega en la grabación (o en la ventana -from/-to)")
+	}
+	if *dryRun {
+		return printReport(stdout, *output, summary(records))
+	}
+	if *gateway == "" || *secret == "" {
+		return errors.New("-gateway y -secret son obligatorios (salvo con -dry-run)")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r := &replayer{
+		url:         strings.TrimRight(*gateway, "/") + "/api/v1/webhooks/github",
+		secret:      *secret,
+		speedup:     *speedup,
+		concurrency: *concurrency,
+		rewrite:     rewrite{owners: owners, idOffset: *idOffset, retime: *shiftTimes},
+		http:        &http.Client{Timeout: *timeout},
+	}
+	// Sin el watchdog, una grabación grande con mucha concurrencia acaba en el OOM killer
+	// sin informe; con él se pausa y, si no se recupera, se interrumpe con el informe parcial
+	limits, err := watchdog.LimitsFromEnv("REPLAY", watchdog.DefaultLimits)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.watchdog = watchdog.New("webhook_replay", limits, nil, func(reason string) { r.abort(reason, cancel) })
+	go r.watchdog.Run(ctx)
+
+	span := records[len(records)-1].ReceivedAt.Sub(records[0].ReceivedAt)
+	log.Printf("▶️ Reproduciendo %d entregas (%s grabados, x%s) contra %s", len(records), span.Round(time.Second), strconv.FormatFloat(*speedup, 'g', -1, 64), *gateway)
+	rep := r.run(ctx, records)
+	if err := printReport(stdout, *output, rep); err != nil {
+		return err
+	}
+	if rep.Aborted != "" {
+		return errors.New("reproducción interrumpida por el watchdog")
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
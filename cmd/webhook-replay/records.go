@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// record es una línea de la grabación del gateway (WEBHOOK_RECORD_DIR).
+type record struct {
+	ReceivedAt time.Time      `json:"received_at"`
+	Event      string         `json:"event"`
+	DeliveryID string         `json:"delivery_id"`
+	Payload    map[string]any `json:"payload"`
+}
+
+// loadRecords lee grabaciones JSONL (o .jsonl.gz; "-" es la entrada estándar), filtra por
+// la ventana [from, to) y las ordena por hora de recepción.
+func loadRecords(paths []string, stdin io.Reader, from, to time.Time) ([]record, error) {
+	var records []record
+	for _, path := range paths {
+		var reader io.Reader = stdin
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			reader = file
+			if strings.HasSuffix(path, ".gz") {
+				gz, err := gzip.NewReader(file)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", path, err)
+				}
+				defer gz.Close()
+				reader = gz
+			}
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			decoder := json.NewDecoder(strings.NewReader(text))
+			// Los IDs de GitHub no caben en un float64 sin perder precisión
+			decoder.UseNumber()
+			var r record
+			if err := decoder.Decode(&r); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			if r.Event == "" || r.Payload == nil {
+				return nil, fmt.Errorf("%s:%d: registro sin event o payload", path, line)
+			}
+			if (!from.IsZero() && r.ReceivedAt.Before(from)) || (!to.IsZero() && !r.ReceivedAt.Before(to)) {
+				continue
+			}
+			records = append(records, r)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].ReceivedAt.Before(records[j].ReceivedAt) })
+	return records, nil
+}
+
+// rewrite adapta un payload grabado al entorno de staging.
+type rewrite struct {
+	owners   map[string]string
+	idOffset int64
+	// Con retime, las horas del job se llevan al reloj de la reproducción: origin (la
+	// primera entrega grabada) pasa a ser start, con la separación dividida por speedup,
+	// para que el gateway no las rechace por viejas (WEBHOOK_MAX_AGE) ni por futuras
+	retime  bool
+	origin  time.Time
+	start   time.Time
+	speedup float64
+}
+
+// at traslada un instante grabado al reloj de la reproducción.
+func (rw rewrite) at(t time.Time) time.Time {
+	if rw.speedup <= 0 {
+		return rw.start
+	}
+	return rw.start.Add(time.Duration(float64(t.Sub(rw.origin)) / rw.speedup))
+}
+
+func (rw rewrite) apply(payload map[string]any) {
+	if repository, ok := payload["repository"].(map[string]any); ok {
+		owner, name, _ := strings.Cut(fmt.Sprint(repository["full_name"]), "/")
+		if mapped, ok := rw.owners[owner]; ok {
+			repository["full_name"] = mapped + "/" + name
+			if login, ok := repository["owner"].(map[string]any); ok {
+				login["login"] = mapped
+			}
+		}
+	}
+	if organization, ok := payload["organization"].(map[string]any); ok {
+		if mapped, ok := rw.owners[fmt.Sprint(organization["login"])]; ok {
+			organization["login"] = mapped
+		}
+	}
+
+	job, ok := payload["workflow_job"].(map[string]any)
+	if !ok {
+		return
+	}
+	if rw.idOffset != 0 {
+		for _, field := range []string{"id", "run_id"} {
+			if number, ok := job[field].(json.Number); ok {
+				if id, err := number.Int64(); err == nil {
+					job[field] = json.Number(strconv.FormatInt(id+rw.idOffset, 10))
+				}
+			}
+		}
+	}
+	if rw.retime {
+		for _, field := range []string{"created_at", "started_at", "completed_at"} {
+			if value, ok := job[field].(string); ok {
+				if t, err := time.Parse(time.RFC3339, value); err == nil {
+					job[field] = rw.at(t).UTC().Format(time.RFC3339)
+				}
+			}
+		}
+	}
+}
+
+// parseOwnerMap lee -owner-map: prod-org=staging-org,otra=staging-otra.
+func parseOwnerMap(value string) (map[string]string, error) {
+	owners := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(item, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("-owner-map inválido: %q (origen=destino)", item)
+		}
+		owners[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return owners, nil
+}
+
+// label describe el tipo de entrega para el informe: workflow_job/queued, ping...
+func label(r record) string {
+	if action, ok := r.Payload["action"].(string); ok && action != "" {
+		return r.Event + "/" + action
+	}
+	return r.Event
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/watchdog"
+)
+
+// replayer reenvía una grabación al gateway respetando (o acelerando) su ritmo original.
+type replayer struct {
+	url         string
+	secret      string
+	speedup     float64
+	concurrency int
+	rewrite     rewrite
+	http        *http.Client
+	// Con umbrales superados no se lanzan entregas nuevas hasta que se recupere
+	watchdog *watchdog.Watchdog
+
+	mu       sync.Mutex
+	sent     map[string]int
+	failures map[string]int
+	statuses map[int]int
+	lags     []time.Duration
+	paused   time.Duration
+	aborted  string
+}
+
+type report struct {
+	Deliveries int            `json:"deliveries"`
+	Recorded   time.Duration  `json:"recorded_span"`
+	Elapsed    time.Duration  `json:"elapsed"`
+	Sent       map[string]int `json:"sent"`
+	Failures   map[string]int `json:"failures"`
+	Statuses   map[int]int    `json:"statuses"`
+	// Retraso de cada envío respecto a su instante programado
+	LagP50 time.Duration `json:"lag_p50"`
+	LagP99 time.Duration `json:"lag_p99"`
+	LagMax time.Duration `json:"lag_max"`
+	// Tiempo sin lanzar entregas por el watchdog, y el motivo si interrumpió la reproducción
+	Paused  time.Duration `json:"paused,omitempty"`
+	Aborted string        `json:"aborted,omitempty"`
+}
+
+// run programa cada entrega en start + (recibida - primera) / speedup; con -speedup 0
+// se envían tan rápido como permite -concurrency.
+func (r *replayer) run(ctx context.Context, records []record) *report {
+	r.sent, r.failures, r.statuses = map[string]int{}, map[string]int{}, map[int]int{}
+	slots := make(chan struct{}, max(r.concurrency, 1))
+	var wg sync.WaitGroup
+	start := time.Now()
+	first := records[0].ReceivedAt
+	r.rewrite.origin, r.rewrite.start, r.rewrite.speedup = first, start, r.speedup
+
+	for _, rec := range records {
+		scheduled := r.rewrite.at(rec.ReceivedAt)
+		if wait := time.Until(scheduled); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			log.Printf("⚠️ Reproducción interrumpida")
+			break
+		}
+		r.throttle(ctx)
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		wg.Add(1)
+		go func(rec record, scheduled time.Time) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.send(rec, scheduled)
+		}(rec, scheduled)
+	}
+	wg.Wait()
+
+	rep := &report{
+		Deliveries: len(records),
+		Recorded:   records[len(records)-1].ReceivedAt.Sub(first),
+		Elapsed:    time.Since(start).Round(time.Millisecond),
+		Sent:       r.sent,
+		Failures:   r.failures,
+		Statuses:   r.statuses,
+	}
+	rep.LagP50, rep.LagP99, rep.LagMax = percentile(r.lags, 0.50), percentile(r.lags, 0.99), percentile(r.lags, 1)
+	r.mu.Lock()
+	rep.Paused, rep.Aborted = r.paused.Round(time.Second), r.aborted
+	r.mu.Unlock()
+	return rep
+}
+
+// throttle espera mientras el watchdog tenga umbrales superados; el retraso acumulado
+// se ve en el informe.
+func (r *replayer) throttle(ctx context.Context) {
+	if r.watchdog == nil || !r.watchdog.Shedding() {
+		return
+	}
+	start := time.Now()
+	for r.watchdog.Shedding() && ctx.Err() == nil {
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+		}
+	}
+	r.mu.Lock()
+	r.paused += time.Since(start)
+	r.mu.Unlock()
+}
+
+// abort interrumpe la reproducción cuando el watchdog pide el reinicio.
+func (r *replayer) abort(reason string, cancel context.CancelFunc) {
+	log.Printf("🛑 Watchdog: se interrumpe la reproducción: %s", reason)
+	r.mu.Lock()
+	r.aborted = reason
+	r.mu.Unlock()
+	cancel()
+}
+
+func (r *replayer) send(rec record, scheduled time.Time) {
+	r.rewrite.apply(rec.Payload)
+	lag := time.Since(scheduled)
+	status, err := r.post(rec)
+
+	kind := label(rec)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent[kind]++
+	r.lags = append(r.lags, lag)
+	if status != 0 {
+		r.statuses[status]++
+	}
+	if err != nil {
+		r.failures[kind]++
+		// Un error por tipo y cada cien, para no inundar el log en una caída
+		if r.failures[kind]%100 == 1 {
+			log.Printf("⚠️ Entrega %s (grabada como %s) fallida: %v", kind, rec.DeliveryID, err)
+		}
+	}
+}
+
+// post firma el payload con -secret y lo envía con un X-GitHub-Delivery nuevo: el
+// original ya lo recordaría la protección contra repeticiones del gateway.
+func (r *replayer) post(rec record) (int, error) {
+	body, err := json.Marshal(rec.Payload)
+	if err != nil {
+		return 0, err
+	}
+	mac := hmac.New(sha256.New, []byte(r.secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/webhook-replay")
+	req.Header.Set("X-GitHub-Event", rec.Event)
+	req.Header.Set("X-GitHub-Delivery", deliveryID())
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func deliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func percentile(values []time.Duration, p float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(index, 0)]
+}
+
+// summary resume la grabación sin enviar nada (-dry-run).
+func summary(records []record) *report {
+	rep := &report{
+		Deliveries: len(records),
+		Recorded:   records[len(records)-1].ReceivedAt.Sub(records[0].ReceivedAt),
+		Sent:       map[string]int{},
+		Failures:   map[string]int{},
+		Statuses:   map[int]int{},
+	}
+	for _, rec := range records {
+		rep.Sent[label(rec)]++
+	}
+	return rep
+}
+
+func printReport(out io.Writer, format string, rep *report) error {
+	if format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rep)
+	}
+
+	fmt.Fprintf(out, "%d entregas grabadas en %s", rep.Deliveries, rep.Recorded.Round(time.Second))
+	if rep.Elapsed > 0 {
+		fmt.Fprintf(out, ", reproducidas en %s\n", rep.Elapsed)
+		fmt.Fprintf(out, "Retraso sobre el programa: p50 %s, p99 %s, máx %s", rep.LagP50.Round(time.Millisecond), rep.LagP99.Round(time.Millisecond), rep.LagMax.Round(time.Millisecond))
+	}
+	if rep.Paused > 0 {
+		fmt.Fprintf(out, "\nEn pausa por el watchdog: %s", rep.Paused)
+	}
+	if rep.Aborted != "" {
+		fmt.Fprintf(out, "\nInterrumpida por el watchdog: %s", rep.Aborted)
+	}
+	fmt.Fprint(out, "\n\n")
+
+	kinds := make([]string, 0, len(rep.Sent))
+	for kind := range rep.Sent {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ENTREGA\tENVIADAS\tFALLIDAS")
+	for _, kind := range kinds {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", kind, rep.Sent[kind], rep.Failures[kind])
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if len(rep.Statuses) > 0 {
+		codes := make([]string, 0, len(rep.Statuses))
+		for code, count := range rep.Statuses {
+			codes = append(codes, fmt.Sprintf("%d=%d", code, count))
+		}
+		sort.Strings(codes)
+		fmt.Fprintf(out, "\nRespuestas HTTP: %s\n", strings.Join(codes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/eliaspizarro/gha-ephemeral-runners
+
+go 1.22
@@ -4,16 +4,21 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 func main() {
 	// Configuración
 	port := os.Getenv("ORCHESTRATOR_PORT")
+	if port == "" {
+		port = portFromConfigFile("orchestrator_port", "orchestrator")
+	}
 	if port == "" {
 		port = "8000"
 	}
@@ -41,3 +46,82 @@ func main() {
 	log.Printf("Health Check OK [Res Code: %d]\n", resp.StatusCode)
 	os.Exit(0)
 }
+
+// portFromConfigFile busca la clave en CONFIG_FILE (YAML) sin dependencias externas.
+// Respeta el perfil CONFIG_PROFILE y su cadena de 'extends'; la sección del servicio
+// tiene prioridad sobre 'shared', igual que en config_file.py.
+func portFromConfigFile(key, section string) string {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return ""
+	}
+	values := scalarsFromConfigFile(path)
+
+	var layers []string
+	seen := map[string]bool{}
+	for profile := os.Getenv("CONFIG_PROFILE"); profile != "" && !seen[profile]; profile = values["profiles."+profile+".extends"] {
+		seen[profile] = true
+		layers = append(layers, "profiles."+profile+".")
+	}
+	layers = append(layers, "")
+
+	for _, name := range []string{section, "shared"} {
+		for _, layer := range layers {
+			if value, ok := values[layer+name+"."+key]; ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// scalarsFromConfigFile aplana los valores escalares "clave: valor" del YAML a rutas
+// "a.b.c" según la indentación. Las listas se ignoran: no contienen puertos.
+func scalarsFromConfigFile(path string) map[string]string {
+	values := map[string]string{}
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		key := strings.Trim(strings.TrimSpace(line[:colon]), `"'`)
+		value := line[colon+1:]
+		if comment := strings.Index(value, "#"); comment >= 0 {
+			value = value[:comment]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if value == "" {
+			stack = append(stack, level{indent, key})
+			continue
+		}
+
+		parts := make([]string, 0, len(stack)+1)
+		for _, parent := range stack {
+			parts = append(parts, parent.key)
+		}
+		values[strings.Join(append(parts, key), ".")] = value
+	}
+	return values
+}
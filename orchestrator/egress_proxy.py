@@ -0,0 +1,34 @@
+"""
+Proxy de salida de runners - Punto de entrada.
+Se ejecuta desde la imagen del orchestrator como servicio independiente.
+"""
+
+import asyncio
+import os
+import sys
+
+from src.utils.config_file import ConfigFileError, load_config_file, profile_from_args
+
+# Cargar CONFIG_FILE ANTES de importar módulos que leen variables de entorno
+try:
+    load_config_file(profile=profile_from_args(sys.argv[1:]))
+except ConfigFileError as e:
+    sys.exit(str(e))
+
+from src.services.egress_proxy import create_egress_proxy
+from src.utils.helpers import format_log, setup_logger, setup_logging_config
+
+# Configurar logging ANTES de inicializar el proxy
+setup_logging_config("gha-egress-proxy")
+
+logger = setup_logger(__name__)
+
+
+if __name__ == "__main__":
+    logger.info(format_log('START', 'Egress Proxy'))
+    proxy = create_egress_proxy()
+    port = int(os.getenv("EGRESS_PROXY_PORT", 3128))
+    try:
+        asyncio.run(proxy.serve("0.0.0.0", port))
+    except KeyboardInterrupt:
+        logger.info(format_log('INFO', 'Deteniendo proxy de salida'))
@@ -3,15 +3,31 @@ API FastAPI del Orchestrator - Punto de entrada y routing.
 Contiene solo la definición de endpoints y delega lógica a src.core.orchestrator.
 """
 
+import asyncio
 import logging
 import os
+import signal
+import sys
 from contextlib import asynccontextmanager
 
-from fastapi import FastAPI, HTTPException
+from src.utils.config_file import ConfigFileError, load_config_file, profile_from_args
 
+# Cargar CONFIG_FILE ANTES de importar módulos que leen variables de entorno
+try:
+    load_config_file(profile=profile_from_args(sys.argv[1:]))
+except ConfigFileError as e:
+    sys.exit(str(e))
+
+from fastapi import FastAPI, HTTPException, Request, Response
+
+from src.api.grpc_admin import create_grpc_admin
 from src.api.models import *
 from src.core.orchestrator import OrchestratorService
-from src.utils.helpers import ErrorHandler, format_log, setup_logger, setup_logging_config
+from src.services.datadog import Tracer, datadog
+from src.services.discovery import create_service_registration
+from src.services.systemd import create_systemd_notifier
+from src.services.usage import UsageLedger
+from src.utils.helpers import ErrorHandler, ValidationError, format_log, setup_logger, setup_logging_config
 from version import __version__
 
 # Configurar logging ANTES de inicializar el servicio
@@ -25,16 +41,50 @@ logger.info(format_log('START', 'Orchestrator Service'))
 orchestrator_service = OrchestratorService()
 logger.info(format_log('SUCCESS', 'Servicio inicializado correctamente'))
 
+# Registro en Consul/etcd (SERVICE_DISCOVERY_BACKEND)
+service_registration = create_service_registration("gha-orchestrator", int(os.getenv("ORCHESTRATOR_PORT", 8000)))
+
+# Disponibilidad y watchdog en unidades systemd Type=notify (NOTIFY_SOCKET)
+systemd_notifier = create_systemd_notifier(int(os.getenv("ORCHESTRATOR_PORT", 8000)))
+
+# API gRPC de administración (GRPC_ADMIN_PORT), en el mismo event loop que FastAPI
+grpc_admin = create_grpc_admin(orchestrator_service)
+
+
+def reload_on_sighup():
+    """Recarga la configuración al recibir SIGHUP; los errores ya quedan registrados."""
+    logger.info(format_log('INFO', 'SIGHUP recibido', 'recargando configuración'))
+    try:
+        orchestrator_service.reload_configuration()
+    except Exception:
+        pass
+
 
 # Lifecycle events
 @asynccontextmanager
 async def lifespan(app: FastAPI):
     """Maneja el ciclo de vida de la aplicación FastAPI."""
     logger.info(format_log('START', 'Servicio FastAPI'))
+
+    # SIGHUP recarga pools sin reiniciar (docker kill -s HUP gha-orchestrator)
+    asyncio.get_running_loop().add_signal_handler(signal.SIGHUP, reload_on_sighup)
+
+    if service_registration:
+        service_registration.start()
+    if systemd_notifier:
+        systemd_notifier.start()
+    if grpc_admin:
+        await grpc_admin.start()
     
     yield
     
     logger.info(format_log('INFO', 'Deteniendo servicio de orquestador'))
+    if systemd_notifier:
+        systemd_notifier.stop()
+    if grpc_admin:
+        await grpc_admin.stop()
+    if service_registration:
+        service_registration.stop()
     orchestrator_service.stop_monitoring()
     
     # Purge completo de todos los runners al shutdown
@@ -57,6 +107,24 @@ app = FastAPI(
 )
 
 
+if datadog.tracer.enabled:
+    @app.middleware("http")
+    async def tracing_middleware(request: Request, call_next):
+        """Traza APM de cada solicitud; continúa la traza del gateway si llega en las cabeceras."""
+        with datadog.tracer.span("fastapi.request", span_type="web", parent=Tracer.extract(request.headers)) as span:
+            response = await call_next(request)
+            route = request.scope.get("route")
+            span["resource"] = f"{request.method} {getattr(route, 'path', request.url.path)}"
+            span["meta"].update({
+                "http.method": request.method,
+                "http.url": request.url.path,
+                "http.status_code": str(response.status_code),
+            })
+            if response.status_code >= 500:
+                span["error"] = 1
+            return response
+
+
 # ===== ENDPOINTS DE RUNNERS =====
 
 @app.post("/runners/create", response_model=List[RunnerResponse])
@@ -80,40 +148,333 @@ async def get_runner_status(runner_id: str):
 
 
 @app.delete("/runners/{runner_id}")
-async def destroy_runner(runner_id: str):
+async def destroy_runner(runner_id: str, dry_run: bool = False):
     """Destruye un runner específico."""
     try:
-        return await orchestrator_service.destroy_runner(runner_id)
+        return await orchestrator_service.destroy_runner(runner_id, dry_run)
     except ValueError as e:
         raise HTTPException(status_code=404, detail=str(e))
     except Exception as e:
         raise ErrorHandler.handle_error(e, "destruyendo runner", logger)
 
 
+@app.post("/jobs/{job_id}/complete")
+async def complete_job(job_id: str, runner_name: Optional[str] = None):
+    """Job completado o cancelado: destruye el runner creado para él."""
+    try:
+        return await orchestrator_service.complete_job(job_id, runner_name)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "completando job", logger)
+
+
+@app.post("/jobs/{job_id}/started")
+async def job_started(job_id: str, runner_name: Optional[str] = None):
+    """GitHub asignó el job a un runner: deja de estar en cola."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.job_started, job_id, runner_name)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "registrando inicio de job", logger)
+
+
+@app.get("/jobs/orphaned")
+async def get_orphaned_jobs():
+    """Jobs encolados más allá de ORPHANED_JOB_THRESHOLD sin runner, con su diagnóstico."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.orphaned_jobs)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando jobs huérfanos", logger)
+
+
 @app.get("/runners", response_model=List[RunnerStatus])
-async def list_runners():
-    """Lista todos los runners activos."""
+async def list_runners(tenant: Optional[str] = None):
+    """Lista todos los runners activos (o solo los de un tenant)."""
     try:
-        return await orchestrator_service.list_runners()
+        return await orchestrator_service.list_runners(tenant)
     except Exception as e:
         raise ErrorHandler.handle_error(e, "listando runners", logger)
 
 
 @app.post("/runners/cleanup")
-async def cleanup_runners():
+async def cleanup_runners(dry_run: bool = False):
     """Limpia runners inactivos."""
     try:
-        return await orchestrator_service.cleanup_runners()
+        return await orchestrator_service.cleanup_runners(dry_run)
     except Exception as e:
         raise ErrorHandler.handle_error(e, "limpieza de runners", logger)
 
 
+@app.get("/pools")
+async def list_pools():
+    """Lista los pools de runners configurados."""
+    try:
+        return await orchestrator_service.list_pools()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando pools", logger)
+
+
+@app.get("/pools/drift")
+async def get_pool_drift():
+    """Estado de la reconciliación GitOps de pools y runners fuera de la spec."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.pool_drift)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo drift de pools", logger)
+
+
+@app.get("/pools/snapshots")
+async def list_pool_snapshots(pool: Optional[str] = None):
+    """Snapshots de pools (POOL_ARCHIVE_FILE), los más recientes primero."""
+    try:
+        return orchestrator_service.list_pool_snapshots(pool)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando snapshots de pools", logger)
+
+
+@app.post("/pools/snapshots/{snapshot_id}/restore")
+async def restore_pool_snapshot(snapshot_id: str, request: PoolRestoreRequest):
+    """Crea un pool desde un snapshot: con su nombre original o clonado con name."""
+    try:
+        return orchestrator_service.restore_pool_snapshot(snapshot_id, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "restaurando snapshot de pool", logger)
+
+
+@app.post("/pools/{name}/snapshots")
+async def create_pool_snapshot(name: str, request: PoolSnapshotRequest):
+    """Guarda un snapshot de la definición de un pool."""
+    try:
+        return orchestrator_service.create_pool_snapshot(name, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "guardando snapshot de pool", logger)
+
+
+@app.post("/pools/{name}/retire")
+async def retire_pool(name: str, request: PoolRetireRequest):
+    """Retira un pool: no acepta runners nuevos y conserva su definición e historial."""
+    try:
+        return orchestrator_service.retire_pool(name, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "retirando pool", logger)
+
+
+@app.post("/pools/{name}/restore")
+async def restore_pool(name: str, restored_by: str = ""):
+    """Vuelve a aceptar runners en un pool retirado."""
+    try:
+        return orchestrator_service.restore_pool(name, restored_by)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "restaurando pool", logger)
+
+
+# ===== OPERACIONES MASIVAS =====
+
+@app.post("/bulk")
+async def submit_bulk_operation(request: BulkOperationRequest):
+    """Envía una operación masiva; se ejecuta en segundo plano."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.submit_bulk_operation, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "enviando operación masiva", logger)
+
+
+@app.get("/bulk")
+async def list_bulk_operations(status: Optional[str] = None):
+    """Operaciones masivas en curso y recientes, las más nuevas primero."""
+    try:
+        return orchestrator_service.list_bulk_operations(status)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando operaciones masivas", logger)
+
+
+@app.get("/bulk/{operation_id}")
+async def get_bulk_operation(operation_id: str):
+    """Estado y progreso de una operación masiva."""
+    try:
+        return orchestrator_service.get_bulk_operation(operation_id)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo operación masiva", logger)
+
+
+@app.get("/bulk/{operation_id}/items")
+async def get_bulk_operation_items(operation_id: str):
+    """Resultado de cada ítem de una operación masiva."""
+    try:
+        return orchestrator_service.get_bulk_operation(operation_id, items=True)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo ítems de operación masiva", logger)
+
+
+# ===== IMÁGENES DE RUNNERS =====
+
+@app.post("/images/builds")
+async def submit_image_build(request: ImageBuildRequest):
+    """Lanza una construcción de IMAGE_BUILDS_FILE; se ejecuta en segundo plano."""
+    try:
+        return orchestrator_service.submit_image_build(request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "enviando construcción de imagen", logger)
+
+
+@app.get("/images/builds")
+async def list_image_builds(name: Optional[str] = None):
+    """Construcciones de imagen en curso y recientes, las más nuevas primero."""
+    try:
+        return orchestrator_service.list_image_builds(name)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando construcciones de imagen", logger)
+
+
+@app.get("/images/builds/{build_id}")
+async def get_image_build(build_id: str):
+    """Estado, digests, Dockerfile y log de una construcción de imagen."""
+    try:
+        return orchestrator_service.get_image_build(build_id)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo construcción de imagen", logger)
+
+
+@app.get("/images/rollouts")
+async def list_image_rollouts(pool: Optional[str] = None):
+    """Despliegues de imagen en curso y recientes, con sus canarios."""
+    try:
+        return orchestrator_service.list_image_rollouts(pool)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando despliegues de imagen", logger)
+
+
+@app.post("/images/rollouts")
+async def start_image_rollout(request: ImageRolloutRequest):
+    """Despliega por pasos en un pool la imagen de una construcción terminada."""
+    try:
+        return orchestrator_service.start_image_rollout(request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "iniciando despliegue de imagen", logger)
+
+
+@app.post("/images/rollouts/{pool}/rollback")
+async def rollback_image_rollout(pool: str, request: ImageRollbackRequest):
+    """Revierte el despliegue de imagen de un pool a la imagen anterior."""
+    try:
+        return orchestrator_service.rollback_image_rollout(pool, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "revirtiendo despliegue de imagen", logger)
+
+
+@app.get("/cutovers")
+async def list_cutovers(status: Optional[str] = None):
+    """Cambios blue/green en curso y recientes, los más nuevos primero."""
+    try:
+        return orchestrator_service.list_cutovers(status)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando cambios blue/green", logger)
+
+
+@app.post("/cutovers")
+async def start_cutover(request: FleetCutoverRequest):
+    """Crea los pools verdes de un conjunto de pools y desplaza hacia ellos los runners por pasos."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.start_cutover, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "iniciando cambio blue/green", logger)
+
+
+@app.get("/cutovers/{cutover_id}")
+async def get_cutover(cutover_id: str):
+    """Estado, paso y tasas de fallo de un cambio blue/green."""
+    try:
+        return orchestrator_service.get_cutover(cutover_id)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo cambio blue/green", logger)
+
+
+@app.post("/cutovers/{cutover_id}/rollback")
+async def rollback_cutover(cutover_id: str, request: FleetCutoverRollbackRequest):
+    """Revierte un cambio blue/green en curso o completado."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.rollback_cutover, cutover_id, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "revirtiendo cambio blue/green", logger)
+
+
+@app.get("/docker-hosts")
+async def list_docker_hosts():
+    """Hosts de DOCKER_HOSTS_FILE con su capacidad, runners, salud y vaciado."""
+    try:
+        return orchestrator_service.list_docker_hosts()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando hosts Docker", logger)
+
+
+@app.post("/docker-hosts/{name}/drain")
+async def drain_docker_host(name: str, request: DockerHostDrainRequest):
+    """Vacía un host Docker: sin runners nuevos y sus runners libres destruidos."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.drain_docker_host, name, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "vaciando host Docker", logger)
+
+
+@app.post("/docker-hosts/{name}/undrain")
+async def undrain_docker_host(name: str, request: DockerHostDrainRequest):
+    """Devuelve un host Docker vaciado al servicio."""
+    try:
+        return orchestrator_service.undrain_docker_host(name, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "devolviendo host Docker al servicio", logger)
+
+
+@app.get("/resource-classes")
+async def list_resource_classes():
+    """Clases de recursos seleccionables con labels size-* y su tamaño en cada backend."""
+    try:
+        return orchestrator_service.list_resource_classes()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando clases de recursos", logger)
+
+
+@app.get("/regions")
+async def list_regions():
+    """Regiones de los pools multi-región con su disponibilidad y failovers."""
+    try:
+        return orchestrator_service.list_regions()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando regiones", logger)
+
+
+@app.get("/reconcile")
+async def get_reconcile_status():
+    """Drift de la última reconciliación de runners, por recurso y motivo."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.reconcile_status)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo estado de la reconciliación", logger)
+
+
+@app.post("/reconcile")
+async def run_reconcile(dry_run: Optional[bool] = None):
+    """Ejecuta una reconciliación de runners ahora (dry_run solo detecta el drift)."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.reconcile, dry_run)
+    except ValueError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "reconciliando runners", logger)
+
+
+@app.get("/queue")
+async def get_queue_status():
+    """Estado de la cola de trabajo distribuida (tareas pendientes, en vuelo y muertas)."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.queue_status)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo estado de la cola", logger)
+
+
 @app.get("/runners/{runner_name}/debug")
 async def debug_runner_environment(runner_name: str):
     """Debug de variables de entorno de un runner."""
     try:
-        env_vars = orchestrator_service.debug_runner_environment(runner_name)
-        return create_response(True, "Environment variables obtenidas", env_vars)
+        return await orchestrator_service.debug_runner_environment(runner_name)
     except Exception as e:
         raise ErrorHandler.handle_error(e, "debugging runner", logger)
 
@@ -121,8 +482,7 @@ async def debug_runner_environment(runner_name: str):
 async def get_runner_detailed_info(runner_name: str):
     """Obtiene información detallada de un runner."""
     try:
-        info = orchestrator_service.get_runner_detailed_info(runner_name)
-        return create_response(True, "Información detallada obtenida", info)
+        return await orchestrator_service.get_runner_detailed_info(runner_name)
     except Exception as e:
         raise ErrorHandler.handle_error(e, "obteniendo información del runner", logger)
 
@@ -157,6 +517,71 @@ async def validate_configuration():
         raise ErrorHandler.handle_error(e, "validando configuración", logger)
 
 
+@app.post("/config/reload")
+async def reload_configuration():
+    """Recarga pools sin reiniciar (la configuración anterior se conserva si la nueva es inválida)."""
+    try:
+        return orchestrator_service.reload_configuration()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "recargando configuración", logger)
+
+
+@app.get("/state/export")
+async def export_state():
+    """Snapshot versionado del estado (pools y runners en seguimiento)."""
+    try:
+        return orchestrator_service.export_state()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "exportando estado", logger)
+
+
+@app.post("/state/import")
+async def import_state(snapshot: Dict, dry_run: bool = False, apply_pools: bool = False):
+    """Importa un snapshot: adopta runners existentes y, con apply_pools, reemplaza los pools."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.import_state, snapshot, dry_run, apply_pools)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "importando estado", logger)
+
+
+@app.get("/config/flags")
+async def list_feature_flags(scope_name: Optional[str] = None):
+    """Feature flags; con scope_name muestra su evaluación para ese owner/repositorio."""
+    try:
+        return orchestrator_service.list_feature_flags(scope_name)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo feature flags", logger)
+
+
+@app.get("/forecast")
+async def get_forecast(pool: Optional[str] = None):
+    """Demanda prevista por pool y hora de la semana (FORECAST_ENABLED)."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.get_forecast, pool)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo previsión de capacidad", logger)
+
+
+@app.get("/config/policies")
+async def list_policies():
+    """Reglas de rechazo de jobs (JOB_POLICIES_FILE) y sus coincidencias."""
+    try:
+        return orchestrator_service.list_policies()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo políticas de jobs", logger)
+
+
+@app.get("/config/doctor")
+async def run_diagnostics():
+    """Diagnóstico de credenciales, Docker, imágenes y reloj (usado por runnersctl doctor)."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.run_diagnostics)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "ejecutando diagnóstico", logger)
+
+
 @app.get("/config/placeholders")
 async def get_available_placeholders():
     """Obtiene placeholders disponibles."""
@@ -166,6 +591,199 @@ async def get_available_placeholders():
         raise ErrorHandler.handle_error(e, "obteniendo placeholders", logger)
 
 
+# ===== TENANTS =====
+
+@app.get("/tenants")
+async def list_tenants():
+    """Lista los tenants con su uso frente a la cuota."""
+    try:
+        return orchestrator_service.list_tenants()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando tenants", logger)
+
+
+@app.post("/tenants")
+async def onboard_tenant(request: TenantRequest):
+    """Da de alta un tenant: instalación de la App, pools, cuota y webhook de cada organización."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.onboard_tenant, request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "dando de alta tenant", logger)
+
+
+@app.get("/tenants/{name}")
+async def get_tenant(name: str):
+    """Obtiene un tenant con su uso frente a la cuota."""
+    try:
+        return orchestrator_service.get_tenant(name)
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo tenant", logger)
+
+
+@app.delete("/tenants/{name}")
+async def offboard_tenant(name: str):
+    """Da de baja un tenant sin runners activos."""
+    try:
+        return await asyncio.to_thread(orchestrator_service.offboard_tenant, name)
+    except ValidationError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "dando de baja tenant", logger)
+
+
+# ===== TOPES DE GASTO =====
+
+@app.get("/budgets")
+async def list_budgets():
+    """Lista los topes de gasto con el gasto y la proyección del mes en curso."""
+    try:
+        return orchestrator_service.list_budgets()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando topes de gasto", logger)
+
+
+@app.post("/budgets/overrides")
+async def create_budget_override(request: BudgetOverrideRequest):
+    """Crea un token de excepción temporal para un tenant o pool congelado."""
+    try:
+        return orchestrator_service.create_budget_override(request)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "creando excepción de tope de gasto", logger)
+
+
+@app.delete("/budgets/overrides/{override_id}")
+async def revoke_budget_override(override_id: str):
+    """Revoca un token de excepción."""
+    try:
+        return orchestrator_service.revoke_budget_override(override_id)
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "revocando excepción de tope de gasto", logger)
+
+
+@app.put("/budgets/{kind}/{name}")
+async def set_budget(kind: str, name: str, request: BudgetRequest):
+    """Fija el tope mensual de un tenant o pool (kind: tenant o pool)."""
+    try:
+        return orchestrator_service.set_budget(kind, name, request)
+    except ValidationError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "fijando tope de gasto", logger)
+
+
+@app.delete("/budgets/{kind}/{name}")
+async def remove_budget(kind: str, name: str):
+    """Elimina el tope de un tenant o pool (descongela su escalado)."""
+    try:
+        return orchestrator_service.remove_budget(kind, name)
+    except ValidationError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "eliminando tope de gasto", logger)
+
+
+# ===== USO =====
+
+@app.get("/usage/report")
+async def usage_report(month: Optional[str] = None, tenant: Optional[str] = None, format: str = "json"):
+    """Informe de uso mensual por tenant y pool (month=YYYY-MM, por defecto el mes anterior) en JSON o CSV."""
+    if format not in ("json", "csv"):
+        raise HTTPException(status_code=400, detail=f"Formato no soportado: {format} (json, csv)")
+    try:
+        result = orchestrator_service.usage_report(month, tenant)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "generando informe de uso", logger)
+    if format == "csv":
+        return Response(
+            UsageLedger.to_csv(result["data"]), media_type="text/csv",
+            headers={"Content-Disposition": f'attachment; filename="usage-{result["data"]["month"]}.csv"'},
+        )
+    return result
+
+
+@app.get("/usage/anomalies")
+async def list_cost_anomalies():
+    """Anomalías de gasto por tenant y pool con los repositorios y workflows que las causan."""
+    try:
+        return orchestrator_service.list_cost_anomalies()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo anomalías de gasto", logger)
+
+
+# ===== WEBHOOKS SALIENTES =====
+
+@app.get("/webhooks/outbound")
+async def list_outbound_webhooks():
+    """Lista los webhooks salientes registrados."""
+    try:
+        return orchestrator_service.list_outbound_webhooks()
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "listando webhooks salientes", logger)
+
+
+@app.post("/webhooks/outbound")
+async def register_outbound_webhook(request: OutboundWebhookRequest):
+    """Registra un webhook saliente para los eventos indicados (admite comodines: runner.*)."""
+    try:
+        return orchestrator_service.register_outbound_webhook(
+            request.url, request.events, request.description, request.secret
+        )
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "registrando webhook saliente", logger)
+
+
+@app.delete("/webhooks/outbound/{webhook_id}")
+async def remove_outbound_webhook(webhook_id: str):
+    """Elimina un webhook saliente."""
+    try:
+        return orchestrator_service.remove_outbound_webhook(webhook_id)
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "eliminando webhook saliente", logger)
+
+
+@app.get("/webhooks/outbound/{webhook_id}/deliveries")
+async def get_outbound_webhook_deliveries(webhook_id: str):
+    """Historial de entregas (estado, intentos, respuesta) de un webhook saliente."""
+    try:
+        return orchestrator_service.outbound_webhook_deliveries(webhook_id)
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "obteniendo entregas de webhook saliente", logger)
+
+
+@app.post("/webhooks/outbound/{webhook_id}/ping")
+async def ping_outbound_webhook(webhook_id: str):
+    """Envía un evento webhook.ping para probar el receptor."""
+    try:
+        return orchestrator_service.ping_outbound_webhook(webhook_id)
+    except ValueError as e:
+        raise HTTPException(status_code=404, detail=str(e))
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "enviando ping a webhook saliente", logger)
+
+
+@app.post("/events")
+async def relay_event(event: Dict):
+    """Eventos de jobs publicados por el API Gateway, para los webhooks salientes."""
+    try:
+        return orchestrator_service.relay_event(event)
+    except Exception as e:
+        raise ErrorHandler.handle_error(e, "recibiendo evento", logger)
+
+
 # ===== HEALTH CHECKS =====
 
 @app.get("/health")
@@ -194,4 +812,6 @@ if __name__ == "__main__":
     import uvicorn
     
     port = int(os.getenv("ORCHESTRATOR_PORT", 8000))
-    uvicorn.run(app, host="0.0.0.0", port=port)
+    # Mayor que ORCHESTRATOR_IDLE_TIMEOUT del gateway: es el gateway quien cierra las conexiones inactivas
+    keepalive = int(os.getenv("ORCHESTRATOR_KEEPALIVE_TIMEOUT", 75))
+    uvicorn.run(app, host="0.0.0.0", port=port, timeout_keep_alive=keepalive)
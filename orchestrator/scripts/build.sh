@@ -42,6 +42,7 @@ echo "🚀 Running docker build..."
 cd "$ORCHESTRATOR_DIR"
 docker build \
     -f docker/Dockerfile \
+    --build-context shared=../shared \
     --build-arg REGISTRY="$REGISTRY" \
     --build-arg IMAGE_VERSION="$IMAGE_VERSION" \
     -t "$IMAGE_NAME:$IMAGE_TAG" \
@@ -0,0 +1,391 @@
+"""
+API gRPC de administración del orchestrator (proto/admin.proto).
+Expone las operaciones de control de la API REST con contratos tipados y agrega
+listados y watch en streaming: WatchRunners difunde los cambios de runners y
+WatchEvents los eventos del ciclo de vida. Corre en el mismo event loop que FastAPI.
+"""
+
+import asyncio
+import json
+import os
+import threading
+from typing import Any, Dict, List, Optional, Set, Tuple
+
+import grpc
+from google.protobuf import json_format, struct_pb2
+
+from src.api.models import RunnerRequest
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import (
+    GitHubError, ImageVerificationError, PolicyRejectedError, QuotaExceededError,
+    ValidationError, format_log, setup_logger,
+)
+
+logger = setup_logger(__name__)
+
+# Ruta relativa al directorio del orchestrator (sys.path), como la resuelve grpc
+PROTO_FILE = "proto/admin.proto"
+SERVICE_NAME = "gha.runners.admin.v1.RunnerAdmin"
+
+# Eventos pendientes por cliente de WatchEvents; uno que no consume se desconecta
+WATCH_QUEUE_SIZE = 1000
+
+protos, services = grpc.protos_and_services(PROTO_FILE)
+
+
+def _struct(data: Any) -> struct_pb2.Struct:
+    """Dict (con fechas u otros valores no JSON) a google.protobuf.Struct."""
+    message = struct_pb2.Struct()
+    if isinstance(data, dict):
+        json_format.ParseDict(json.loads(json.dumps(data, default=str)), message)
+    elif data is not None:
+        json_format.ParseDict({"items": json.loads(json.dumps(data, default=str))}, message)
+    return message
+
+
+def _runner(status: Dict[str, Any]) -> Any:
+    return protos.Runner(
+        runner_id=status.get("runner_id") or "",
+        status=status.get("status") or "",
+        container_id=status.get("container_id") or "",
+        image=status.get("image") or "",
+        created=str(status.get("created") or ""),
+        labels={str(k): str(v) for k, v in (status.get("labels") or {}).items()},
+        error=status.get("error") or "",
+    )
+
+
+def _result(response: Dict[str, Any]) -> Any:
+    return protos.OperationResult(
+        success=bool(response.get("success", True)),
+        message=response.get("message") or "",
+        data=_struct(response.get("data")),
+    )
+
+
+def _pool_of(status: Dict[str, Any]) -> str:
+    return (status.get("labels") or {}).get("runner-pool", "default")
+
+
+def status_code(error: Exception) -> grpc.StatusCode:
+    """Código gRPC equivalente al código HTTP de ErrorHandler."""
+    if isinstance(error, (ImageVerificationError, PolicyRejectedError)):
+        return grpc.StatusCode.PERMISSION_DENIED
+    if isinstance(error, QuotaExceededError):
+        return grpc.StatusCode.RESOURCE_EXHAUSTED
+    if isinstance(error, (GitHubError, ConnectionError)):
+        return grpc.StatusCode.UNAVAILABLE
+    if isinstance(error, (ValidationError, ValueError, KeyError)):
+        return grpc.StatusCode.INVALID_ARGUMENT
+    return grpc.StatusCode.INTERNAL
+
+
+class EventBroadcaster:
+    """
+    Backend de eventos que reparte cada evento a los clientes de WatchEvents conectados.
+    publish() llega desde el hilo de entrega de lifecycle_events; cada cliente tiene su
+    cola en el event loop del servidor.
+    """
+
+    name = "grpc"
+    description = "grpc watch"
+
+    def __init__(self):
+        self.subscribers: Set[Tuple[asyncio.AbstractEventLoop, "asyncio.Queue[Optional[Dict[str, Any]]]"]] = set()
+        self.lock = threading.Lock()
+
+    def subscribe(self) -> Tuple[asyncio.AbstractEventLoop, "asyncio.Queue[Optional[Dict[str, Any]]]"]:
+        subscriber = (asyncio.get_running_loop(), asyncio.Queue(maxsize=WATCH_QUEUE_SIZE))
+        with self.lock:
+            self.subscribers.add(subscriber)
+        return subscriber
+
+    def unsubscribe(self, subscriber):
+        with self.lock:
+            self.subscribers.discard(subscriber)
+
+    @staticmethod
+    def _offer(queue: "asyncio.Queue[Optional[Dict[str, Any]]]", event: Dict[str, Any]):
+        try:
+            queue.put_nowait(event)
+        except asyncio.QueueFull:
+            # None marca al cliente como desbordado; el stream termina con RESOURCE_EXHAUSTED
+            while not queue.empty():
+                queue.get_nowait()
+            queue.put_nowait(None)
+
+    def publish(self, event: Dict[str, Any]):
+        with self.lock:
+            subscribers = list(self.subscribers)
+        for loop, queue in subscribers:
+            try:
+                loop.call_soon_threadsafe(self._offer, queue, event)
+            except RuntimeError:
+                # Event loop cerrado (apagado)
+                self.unsubscribe((loop, queue))
+
+    def close(self):
+        pass
+
+
+class RunnerWatch:
+    """
+    Sondea los runners activos cada `interval` segundos mientras haya clientes de
+    WatchRunners y les reparte las diferencias (un solo sondeo para todos los clientes).
+    """
+
+    def __init__(self, orchestrator_service: Any, interval: float):
+        self.orchestrator_service = orchestrator_service
+        self.interval = interval
+        self.subscribers: Set["asyncio.Queue[Tuple[int, Dict[str, Any]]]"] = set()
+        self.last: Optional[Dict[str, Dict[str, Any]]] = None
+        self.task: Optional[asyncio.Task] = None
+
+    async def snapshot(self) -> Dict[str, Dict[str, Any]]:
+        runners = await asyncio.to_thread(self.orchestrator_service.lifecycle_manager.list_active_runners)
+        return {runner["runner_id"]: runner for runner in runners}
+
+    async def subscribe(self) -> Tuple["asyncio.Queue[Tuple[int, Dict[str, Any]]]", Dict[str, Dict[str, Any]]]:
+        """Cola de cambios del cliente y el estado actual del que parten los cambios."""
+        if self.last is None:
+            self.last = await self.snapshot()
+        queue: "asyncio.Queue[Tuple[int, Dict[str, Any]]]" = asyncio.Queue()
+        self.subscribers.add(queue)
+        if not self.task or self.task.done():
+            self.task = asyncio.create_task(self._loop())
+        return queue, dict(self.last)
+
+    def unsubscribe(self, queue):
+        self.subscribers.discard(queue)
+
+    async def _loop(self):
+        while self.subscribers:
+            await asyncio.sleep(self.interval)
+            try:
+                current = await self.snapshot()
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo sondear los runners para WatchRunners', str(e)))
+                continue
+            previous, self.last = self.last or {}, current
+            changes: List[Tuple[int, Dict[str, Any]]] = []
+            for runner_id, status in current.items():
+                if runner_id not in previous:
+                    changes.append((protos.RunnerEvent.ADDED, status))
+                elif status.get("status") != previous[runner_id].get("status"):
+                    changes.append((protos.RunnerEvent.MODIFIED, status))
+            changes.extend(
+                (protos.RunnerEvent.DELETED, status) for runner_id, status in previous.items() if runner_id not in current
+            )
+            for queue in list(self.subscribers):
+                for change in changes:
+                    queue.put_nowait(change)
+        # Sin clientes el estado queda desactualizado: el próximo cliente vuelve a leerlo
+        self.last = None
+
+    def stop(self):
+        if self.task:
+            self.task.cancel()
+
+
+class RunnerAdminServicer(services.RunnerAdminServicer):
+    """Implementación de gha.runners.admin.v1.RunnerAdmin sobre OrchestratorService."""
+
+    def __init__(self, orchestrator_service: Any, token: Optional[str], broadcaster: EventBroadcaster, runner_watch: RunnerWatch):
+        self.orchestrator_service = orchestrator_service
+        self.token = token
+        self.broadcaster = broadcaster
+        self.runner_watch = runner_watch
+
+    async def _authorize(self, context, method: str):
+        metrics.incr("grpc.requests", tags={"method": method})
+        if not self.token:
+            return
+        metadata = dict(context.invocation_metadata() or ())
+        if metadata.get("authorization", "") != f"Bearer {self.token}":
+            metrics.incr("grpc.unauthenticated")
+            await context.abort(grpc.StatusCode.UNAUTHENTICATED, "Token inválido o ausente")
+
+    async def _fail(self, context, error: Exception, operation: str):
+        code = status_code(error)
+        if code == grpc.StatusCode.INTERNAL:
+            logger.error(format_log('ERROR', f'Error en gRPC {operation}', f"{type(error).__name__} - {error}"))
+        await context.abort(code, str(error))
+
+    async def ListRunners(self, request, context):
+        await self._authorize(context, "ListRunners")
+        try:
+            runners = await self.orchestrator_service.list_runners(request.tenant or None)
+        except Exception as e:
+            await self._fail(context, e, "listando runners")
+        for runner in runners:
+            status = runner.dict()
+            if request.pool and _pool_of(status) != request.pool:
+                continue
+            if request.status and status.get("status") != request.status:
+                continue
+            yield _runner(status)
+
+    async def GetRunner(self, request, context):
+        await self._authorize(context, "GetRunner")
+        lifecycle_manager = self.orchestrator_service.lifecycle_manager
+        if request.runner_id not in lifecycle_manager.active_runners:
+            await context.abort(grpc.StatusCode.NOT_FOUND, f"Runner no encontrado: {request.runner_id}")
+        return _runner(lifecycle_manager.get_runner_status(request.runner_id))
+
+    async def CreateRunners(self, request, context):
+        await self._authorize(context, "CreateRunners")
+        try:
+            created = await self.orchestrator_service.create_runners(RunnerRequest(
+                scope=request.scope,
+                scope_name=request.scope_name,
+                runner_name=request.runner_name or None,
+                runner_group=request.runner_group or None,
+                labels=list(request.labels) or None,
+                pool=request.pool or None,
+                count=request.count or 1,
+                dry_run=request.dry_run,
+            ))
+        except Exception as e:
+            await self._fail(context, e, "creando runners")
+        return protos.CreateRunnersResponse(runners=[
+            protos.CreatedRunner(runner_id=runner.runner_id, status=runner.status, message=runner.message)
+            for runner in created
+        ])
+
+    async def DestroyRunner(self, request, context):
+        await self._authorize(context, "DestroyRunner")
+        try:
+            return _result(await self.orchestrator_service.destroy_runner(request.runner_id, request.dry_run))
+        except ValueError as e:
+            await context.abort(grpc.StatusCode.NOT_FOUND, str(e))
+        except Exception as e:
+            await self._fail(context, e, "destruyendo runner")
+
+    async def ListPools(self, request, context):
+        await self._authorize(context, "ListPools")
+        response = await self.orchestrator_service.list_pools()
+        for spec in response.get("data") or []:
+            yield protos.Pool(name=spec.get("name", ""), spec=_struct(spec))
+
+    async def ReloadConfiguration(self, request, context):
+        await self._authorize(context, "ReloadConfiguration")
+        try:
+            return _result(await asyncio.to_thread(self.orchestrator_service.reload_configuration))
+        except Exception as e:
+            await self._fail(context, e, "recargando configuración")
+
+    async def Reconcile(self, request, context):
+        await self._authorize(context, "Reconcile")
+        dry_run = request.dry_run if request.HasField("dry_run") else None
+        try:
+            return _result(await asyncio.to_thread(self.orchestrator_service.reconcile, dry_run))
+        except ValueError as e:
+            await context.abort(grpc.StatusCode.FAILED_PRECONDITION, str(e))
+        except Exception as e:
+            await self._fail(context, e, "reconciliando runners")
+
+    async def WatchRunners(self, request, context):
+        await self._authorize(context, "WatchRunners")
+        queue, current = await self.runner_watch.subscribe()
+        metrics.gauge("grpc.watchers", len(self.runner_watch.subscribers), tags={"stream": "runners"})
+        try:
+            if request.initial:
+                for status in current.values():
+                    if not request.pool or _pool_of(status) == request.pool:
+                        yield protos.RunnerEvent(type=protos.RunnerEvent.ADDED, runner=_runner(status))
+            while True:
+                event_type, status = await queue.get()
+                if not request.pool or _pool_of(status) == request.pool:
+                    yield protos.RunnerEvent(type=event_type, runner=_runner(status))
+        finally:
+            self.runner_watch.unsubscribe(queue)
+            metrics.gauge("grpc.watchers", len(self.runner_watch.subscribers), tags={"stream": "runners"})
+
+    async def WatchEvents(self, request, context):
+        await self._authorize(context, "WatchEvents")
+        subscriber = self.broadcaster.subscribe()
+        metrics.gauge("grpc.watchers", len(self.broadcaster.subscribers), tags={"stream": "events"})
+        prefixes = tuple(request.types)
+        try:
+            while True:
+                event = await subscriber[1].get()
+                if event is None:
+                    await context.abort(
+                        grpc.StatusCode.RESOURCE_EXHAUSTED,
+                        f"El cliente no consume los eventos a tiempo (más de {WATCH_QUEUE_SIZE} pendientes)",
+                    )
+                if prefixes and not event["type"].startswith(prefixes):
+                    continue
+                if request.key and event.get("key") != request.key:
+                    continue
+                yield protos.Event(
+                    id=event["id"],
+                    type=event["type"],
+                    source=event["source"],
+                    time=event["time"],
+                    key=event.get("key") or "",
+                    schema_version=event["schema_version"],
+                    data=_struct(event.get("data")),
+                )
+        finally:
+            self.broadcaster.unsubscribe(subscriber)
+            metrics.gauge("grpc.watchers", len(self.broadcaster.subscribers), tags={"stream": "events"})
+
+
+class GrpcAdminServer:
+    """Servidor grpc.aio de RunnerAdmin; se arranca y detiene con el ciclo de vida de FastAPI."""
+
+    def __init__(self, orchestrator_service: Any, port: int, token: Optional[str] = None,
+                 tls_cert: Optional[str] = None, tls_key: Optional[str] = None, watch_interval: float = 2.0):
+        self.port = port
+        self.tls = bool(tls_cert and tls_key)
+        self.credentials = None
+        if self.tls:
+            with open(tls_key, "rb") as key, open(tls_cert, "rb") as cert:
+                self.credentials = grpc.ssl_server_credentials([(key.read(), cert.read())])
+        self.broadcaster = EventBroadcaster()
+        self.runner_watch = RunnerWatch(orchestrator_service, watch_interval)
+        self.servicer = RunnerAdminServicer(orchestrator_service, token, self.broadcaster, self.runner_watch)
+        self.server: Optional[grpc.aio.Server] = None
+        lifecycle_events.add_publisher(self.broadcaster)
+
+    async def start(self):
+        self.server = grpc.aio.server()
+        services.add_RunnerAdminServicer_to_server(self.servicer, self.server)
+        address = f"[::]:{self.port}"
+        if self.credentials:
+            self.server.add_secure_port(address, self.credentials)
+        else:
+            self.server.add_insecure_port(address)
+        await self.server.start()
+        logger.info(format_log(
+            'START', 'API gRPC de administración', f"{SERVICE_NAME} en :{self.port} ({'TLS' if self.tls else 'sin TLS'})"
+        ))
+
+    async def stop(self, grace: float = 5.0):
+        self.runner_watch.stop()
+        if self.server:
+            # Los watch no terminan solos: el grace period acota el cierre
+            await self.server.stop(grace)
+            logger.info(format_log('INFO', 'API gRPC de administración detenida'))
+
+
+def create_grpc_admin(orchestrator_service: Any) -> Optional[GrpcAdminServer]:
+    """Servidor gRPC en GRPC_ADMIN_PORT; None si no está definido."""
+    port = os.getenv("GRPC_ADMIN_PORT", "").strip()
+    if not port:
+        return None
+    token = os.getenv("GRPC_ADMIN_TOKEN") or None
+    if not token:
+        logger.warning(format_log(
+            'WARNING', 'API gRPC sin autenticación', 'definir GRPC_ADMIN_TOKEN si el puerto es accesible fuera de la red interna'
+        ))
+    return GrpcAdminServer(
+        orchestrator_service,
+        int(port),
+        token=token,
+        tls_cert=os.getenv("GRPC_ADMIN_TLS_CERT") or None,
+        tls_key=os.getenv("GRPC_ADMIN_TLS_KEY") or None,
+        watch_interval=max(0.5, float(os.getenv("GRPC_WATCH_INTERVAL", "2"))),
+    )
@@ -3,7 +3,7 @@ Modelos de datos para la API del Orchestrator.
 Define las estructuras de datos para requests y respuestas.
 """
 
-from typing import Dict, List, Optional
+from typing import Any, Dict, List, Optional
 from pydantic import BaseModel
 
 
@@ -15,7 +15,23 @@ class RunnerRequest(BaseModel):
     runner_group: Optional[str] = None
     labels: Optional[List[str]] = None
     enable_dind: bool = False
+    pool: Optional[str] = None
     count: int = 1
+    dry_run: bool = False
+    # X-GitHub-Delivery del webhook que originó la petición (deduplicación)
+    delivery_id: Optional[str] = None
+    # workflow_job.id para el que se crea el runner (un runner por job)
+    job_id: Optional[str] = None
+    # runs-on del job (diagnóstico de jobs encolados sin runner)
+    job_labels: Optional[List[str]] = None
+    # Token de excepción para crear runners con el tope de gasto congelado
+    budget_override: Optional[str] = None
+    # Run, workflow y rama del job (políticas de JOB_POLICIES_FILE)
+    run_id: Optional[str] = None
+    workflow: Optional[str] = None
+    head_branch: Optional[str] = None
+    # Clase de recursos (small, medium, large, xl...); sin ella se usa el label size-* o la del pool
+    resource_class: Optional[str] = None
 
 
 class RunnerResponse(BaseModel):
@@ -51,3 +67,129 @@ class ValidationResult(BaseModel):
     errors: List[str]
     warnings: List[str]
     recommendations: List[str]
+
+
+class OutboundWebhookRequest(BaseModel):
+    """Modelo para registro de webhook saliente."""
+    url: str
+    events: List[str]
+    description: str = ""
+    secret: Optional[str] = None
+
+
+class TenantRequest(BaseModel):
+    """Modelo para alta de tenant."""
+    name: str
+    owners: List[str]
+    kind: str = "org"
+    enterprise: Optional[str] = None
+    # Pools del tenant (se prefijan con <tenant>-); sin pools, uno desde TENANT_DEFAULT_POOL
+    pools: Optional[List[Dict]] = None
+    max_runners: Optional[int] = None
+    # {url, secret} del webhook workflow_job a configurar en cada organización
+    webhook: Optional[Dict[str, str]] = None
+    created_by: str = ""
+
+
+class BudgetRequest(BaseModel):
+    """Modelo para fijar un tope de gasto mensual."""
+    monthly: float
+    updated_by: str = ""
+
+
+class BudgetOverrideRequest(BaseModel):
+    """Modelo para crear un token de excepción de tope de gasto."""
+    kind: str
+    name: str
+    hours: float = 4
+    reason: str
+    # Sin token del cliente, válida para todo el escalado del objetivo (autoscaler incluido)
+    blanket: bool = False
+    created_by: str = ""
+    # Token e id fijados por el gateway para que sean los mismos en todos los shards
+    token: Optional[str] = None
+    id: Optional[str] = None
+
+
+class PoolRetireRequest(BaseModel):
+    """Modelo para retirar un pool (deja de aceptar runners, conserva su definición)."""
+    reason: str = ""
+    retired_by: str = ""
+    # Id del snapshot automático, fijado por el gateway para que sea el mismo en todos los shards
+    snapshot_id: Optional[str] = None
+
+
+class PoolSnapshotRequest(BaseModel):
+    """Modelo para guardar un snapshot de un pool."""
+    note: str = ""
+    created_by: str = ""
+    id: Optional[str] = None
+
+
+class PoolRestoreRequest(BaseModel):
+    """Modelo para restaurar un snapshot (con name, como un pool nuevo)."""
+    name: Optional[str] = None
+    created_by: str = ""
+
+
+class BulkOperationRequest(BaseModel):
+    """Modelo para enviar una operación masiva (drain_pools, recycle_runners o retag_pools)."""
+    kind: str
+    pools: List[str] = []
+    # recycle_runners: edad mínima en segundos de los runners a reciclar
+    older_than: Optional[int] = None
+    # drain_pools: retirar además los pools (requiere POOL_ARCHIVE_FILE)
+    retire: bool = False
+    reason: str = ""
+    add_labels: List[str] = []
+    remove_labels: List[str] = []
+    dry_run: bool = False
+    submitted_by: str = ""
+    id: Optional[str] = None
+
+
+class ImageBuildRequest(BaseModel):
+    """Modelo para lanzar una construcción de IMAGE_BUILDS_FILE."""
+    name: str
+    # Desplegar la imagen en los pools al terminar
+    rollout: bool = True
+    # Pools a desplegar en lugar de los de la construcción
+    pools: Optional[List[str]] = None
+    requested_by: str = ""
+    id: Optional[str] = None
+
+
+class ImageRolloutRequest(BaseModel):
+    """Modelo para desplegar en un pool la imagen de una construcción terminada."""
+    pool: str
+    build: str
+    started_by: str = ""
+
+
+class ImageRollbackRequest(BaseModel):
+    """Modelo para revertir el despliegue de imagen de un pool."""
+    reason: str = ""
+    requested_by: str = ""
+
+
+class FleetCutoverRequest(BaseModel):
+    """Modelo para iniciar un cambio blue/green de un conjunto de pools."""
+    pools: List[str]
+    changes: Dict[str, Any]
+    suffix: str = "green"
+    policy: Optional[Dict[str, Any]] = None
+    started_by: str = ""
+
+
+class FleetCutoverRollbackRequest(BaseModel):
+    """Modelo para revertir un cambio blue/green."""
+    reason: str = ""
+    requested_by: str = ""
+
+
+class DockerHostDrainRequest(BaseModel):
+    """Modelo para vaciar un host Docker (o devolverlo al servicio)."""
+    reason: str = ""
+    requested_by: str = ""
+    # Destruir ya los runners libres del host; los ocupados terminan su job
+    evict_idle: bool = True
@@ -5,18 +5,63 @@ import uuid
 from typing import Any, Dict, List, Optional
 
 import docker
+import requests
+from src.services.azure import create_azure_backend
+from src.services.cache_proxy import cache_proxy_hostname, runner_cache_url
+from src.services.capabilities import capabilities
 from src.services.docker import DockerError, DockerUtils
+from src.services.docker_hosts import create_docker_hosts
+from src.services.ecs import create_ecs_backend
 from src.services.environment import EnvironmentManager
-from src.utils.helpers import ErrorHandler, setup_logger, validate_runner_name
+from src.services.gce import create_gce_backend
+from src.services.naming import create_runner_naming
+from src.services.pools import RunnerPool
+from src.services.provisioning import provisioner
+from src.services.registry_mirror import create_registry_mirror
+from src.services.retries import retry_budgets
+from src.services.runner_networks import NETWORK_PREFIX, create_runner_networks
+from src.services.security_events import security_events
+from src.services.sidecars import RunnerSidecars
+from src.services.signatures import create_image_verifier
+from src.services.ssh_hosts import create_ssh_backend
+from src.services.tool_cache import create_tool_cache
+from src.services.vulnerabilities import create_image_scanner
+from src.services.workspaces import VOLUME_PREFIX, quota_for, volume_name
+from src.utils.helpers import ErrorHandler, redactor, setup_logger, validate_runner_name
 
 logger = setup_logger(__name__)
 
 
+def docker_transient(error: Exception) -> bool:
+    """Daemon de Docker sin respuesta o con error interno: se reintenta."""
+    if isinstance(error, docker.errors.APIError):
+        return error.is_server_error()
+    return isinstance(error, requests.exceptions.ConnectionError)
+
+
 class ContainerManager:
     def __init__(self, runner_image: str):
-        self.client = docker.from_env()
+        # Una conexión por hilo de aprovisionamiento para que las creaciones en paralelo no se esperen
+        self.client = docker.from_env(max_pool_size=max(10, provisioner.concurrency))
         self.runner_image = runner_image
         self.environment_manager = EnvironmentManager(runner_image)
+        self.image_verifier = create_image_verifier()
+        self.image_scanner = create_image_scanner()
+        self.naming = create_runner_naming()
+        self.registry_mirror = create_registry_mirror()
+        self.tool_cache = create_tool_cache(self.client)
+        self.networks = create_runner_networks(self.client)
+        # Contenedores de servicio de los pools con "sidecars", en la red de cada runner
+        self.sidecars = RunnerSidecars(self.registry_mirror, int(os.getenv("SIDECAR_READY_TIMEOUT", "60")))
+        self.sidecars.prune(self.client)
+        # Hosts Docker remotos (DOCKER_HOSTS_FILE): los runners del backend docker se reparten entre ellos
+        self.docker_hosts = create_docker_hosts(max_pool_size=max(10, provisioner.concurrency))
+        # Backends distintos del Docker local, por nombre de backend del pool
+        self.backends: Dict[str, Any] = {
+            name: backend
+            for name, backend in (("ssh", create_ssh_backend()), ("ecs", create_ecs_backend()), ("azure", create_azure_backend()), ("gce", create_gce_backend()))
+            if backend
+        }
 
     def create_runner_container(
         self,
@@ -27,18 +72,44 @@ class ContainerManager:
         runner_group: Optional[str] = None,
         labels: Optional[List[str]] = None,
         enable_dind: bool = False,
+        pool: Optional[RunnerPool] = None,
+        tenant: Optional[str] = None,
     ) -> Any:
         """Crea un contenedor Docker para un runner efímero."""
+        pool = pool or RunnerPool("default")
+        image = pool.image or self.runner_image
+        runner_group = runner_group or pool.runner_group
+        enable_dind = enable_dind or pool.enable_dind
+
+        # Plantillas de nombre y labels (RUNNER_NAME_TEMPLATE, RUNNER_LABEL_TEMPLATES o las del pool)
+        template_context = self.naming.context(self.client, pool, scope, scope_name, image)
+        labels = list(dict.fromkeys((labels or []) + pool.labels + self.naming.labels(pool, template_context)))
+
         if not runner_name:
-            runner_name = f"ephemeral-runner-{uuid.uuid4().hex[:8]}"
+            runner_name = self.naming.name(pool, template_context) or f"ephemeral-runner-{uuid.uuid4().hex[:8]}"
         runner_name = validate_runner_name(runner_name)
 
+        # Pools en hosts estáticos: el runner es un proceso en un host SSH, no un contenedor
+        if pool.backend == "ssh":
+            return self._backend(pool).create_runner(
+                registration_token, scope, scope_name, runner_name, runner_group, labels, pool,
+            )
+
         environment = self.environment_manager.process_environment_variables(
             scope_name=scope_name,
             runner_name=runner_name,
             registration_token=registration_token,
         )
         
+        network = None
+        if pool.egress_proxy:
+            network = self._apply_egress_proxy(environment, runner_name)
+
+        # Caché de Actions en la región (cmd/cache-proxy); runnerenv_ACTIONS_CACHE_URL tiene prioridad
+        cache_url = runner_cache_url(scope_name, internal=pool.egress_proxy)
+        if cache_url:
+            environment.setdefault("ACTIONS_CACHE_URL", cache_url)
+
         if runner_group:
             environment["RUNNER_GROUP"] = runner_group
         if labels:
@@ -48,40 +119,127 @@ class ContainerManager:
         validated_name = DockerUtils.validate_container_name(runner_name)
         container_name = DockerUtils.format_container_name("gha-runner", validated_name)
         container_labels = DockerUtils.create_container_labels(
-            runner_name=runner_name, scope=scope, scope_name=scope_name
+            runner_name=runner_name, scope=scope, scope_name=scope_name,
+            additional_labels={
+                "runner-pool": pool.name,
+                **({"tenant": tenant} if tenant else {}),
+                **({"resource-class": pool.resources.name} if pool.resources else {}),
+                **({"runner-region": pool.region} if pool.region else {}),
+            },
         )
 
-        # Configurar Docker-in-Docker si es necesario
-        volumes = {}
-        security_opt = []
-        
-        if enable_dind:
-            volumes['/var/run/docker.sock'] = {'bind': '/var/run/docker.sock', 'mode': 'rw'}
-            security_opt.append('label:disable')
-            logger.info(f"🐳 Habilitando Docker-in-Docker para {runner_name}")
-
-        # Configurar comando inyectado si está especificado
-        injected_command = os.getenv("RUNNER_COMMAND")
-        if injected_command:
-            command = injected_command
-            logger.info(f"🔍 Aplicando comando: {injected_command}")
-        else:
-            command = None
+        # Pools en Fargate: mismo entorno que el contenedor, lanzado como tarea de ECS
+        if pool.backend == "ecs":
+            if enable_dind:
+                logger.warning(f"⚠️ Fargate no admite Docker-in-Docker, {runner_name} se crea sin él")
+            return self._backend(pool).create_runner(
+                runner_name, image, os.getenv("RUNNER_COMMAND"), environment, container_labels, pool,
+            )
 
-        logger.info(f"🐳 Creando contenedor {container_name} con imagen {self.runner_image}")
-        
-        container = self.client.containers.run(
-            self.runner_image,
-            command=command,
-            name=container_name,
-            environment=environment,
-            detach=True,
-            labels=container_labels,
-            volumes=volumes if volumes else None,
-            security_opt=security_opt if security_opt else None,
-        )
+        # Pools en Azure o Compute Engine: el runner se registra dentro de una VM
+        if pool.backend in ("azure", "gce"):
+            return self._backend(pool).create_runner(
+                registration_token, scope_name, runner_name, runner_group, labels, container_labels, pool,
+            )
+
+        # Con DOCKER_HOSTS_FILE el contenedor va al host del pool con más capacidad libre
+        host = self.docker_hosts.acquire(pool) if self.docker_hosts else None
+        client = self.docker_hosts.client(host) if host else self.client
+        if host:
+            container_labels["docker-host"] = host.name
+        created = False
+        try:
+            # Configurar Docker-in-Docker si es necesario
+            volumes = {}
+            security = pool.security.docker_options()
+            security_opt = security["security_opt"]
+
+            if enable_dind:
+                volumes['/var/run/docker.sock'] = {'bind': '/var/run/docker.sock', 'mode': 'rw'}
+                security_opt.append('label:disable')
+                logger.info(f"🐳 Habilitando Docker-in-Docker para {runner_name}")
+
+            # Tool cache compartido en solo lectura (TOOL_CACHE_MANIFEST); sus volúmenes solo existen en el Docker local
+            if pool.tool_cache and self.tool_cache and (not host or host.local):
+                if not self.tool_cache.mount(volumes, environment):
+                    logger.warning(f"⚠️ Tool cache aún no disponible, {runner_name} descargará sus herramientas")
+
+            # Cuota de disco del workspace (workspace del pool o WORKSPACE_QUOTA)
+            quota = quota_for(pool)
+            workspace = quota.docker_options(client, runner_name, environment, volumes) if quota else {}
+            # CPU y memoria de la clase de recursos del runner
+            limits = pool.resources.docker_options if pool.resources else {}
+            # Red propia del runner (RUNNER_NETWORK_ISOLATION o network del pool) en lugar de la compartida
+            runner_network = self.networks.create(runner_name, pool, environment, client)
+            network = runner_network or network
+            # Sidecars del pool, listos antes de que el runner acepte un job
+            if pool.sidecars:
+                try:
+                    self.sidecars.start(client, runner_name, pool, runner_network, environment)
+                except Exception:
+                    self.networks.remove(runner_network, client)
+                    raise
+
+            # Configurar comando inyectado si está especificado
+            injected_command = os.getenv("RUNNER_COMMAND")
+            if injected_command:
+                command = injected_command
+                logger.info(f"🔍 Aplicando comando: {injected_command}")
+            else:
+                command = None
+
+            # Imágenes de Docker Hub a través del mirror pull-through (REGISTRY_MIRROR)
+            run_image = self.registry_mirror.resolve(client, image) if pool.registry_mirror else image
+            # Labels de capacidades del host y la imagen (RUNNER_CAPABILITY_LABELS o capability_labels del pool)
+            if capabilities.applies(pool):
+                labels = list(dict.fromkeys(labels + capabilities.docker_labels(client, run_image, pool, enable_dind)))
+                environment["RUNNER_LABELS"] = ",".join(labels)
+
+            logger.info(f"🐳 Creando contenedor {container_name} con imagen {run_image} (pool {pool.name}{f', host {host.name}' if host else ''})")
+
+            try:
+                container = client.containers.run(
+                    run_image,
+                    command=command,
+                    name=container_name,
+                    environment=environment,
+                    detach=True,
+                    labels=container_labels,
+                    volumes=volumes if volumes else None,
+                    security_opt=security_opt if security_opt else None,
+                    cap_add=security["cap_add"],
+                    cap_drop=security["cap_drop"],
+                    privileged=security["privileged"],
+                    network=network,
+                    **workspace,
+                    **limits,
+                )
+            except Exception:
+                # El volumen del workspace, los sidecars y la red no deben sobrevivir a un contenedor que no llegó a crearse
+                if quota and quota.mode == "volume":
+                    self.remove_workspace_volume(runner_name, client)
+                if pool.sidecars:
+                    self.sidecars.remove(client, runner_name)
+                if runner_network:
+                    self.networks.remove(runner_network, client)
+                raise
+            created = True
+        finally:
+            if host:
+                self.docker_hosts.release(host, created)
 
         logger.info(f"✅ Contenedor creado: {DockerUtils.format_container_id(container.id)}")
+
+        if pool.security.elevated or enable_dind:
+            security_events.emit(
+                "pool.privilege_escalation",
+                severity="critical" if pool.security.privileged else "warning",
+                pool=pool.name,
+                runner=runner_name,
+                scope_name=scope_name,
+                privileged=pool.security.privileged,
+                docker_socket=enable_dind,
+            )
         
         # Esperar a que el contenedor esté completamente iniciado
         if DockerUtils.wait_for_container(container, timeout=30):
@@ -93,23 +251,101 @@ class ContainerManager:
         
         return container
 
+    def remove_workspace_volume(self, runner_name: str, client: Any = None) -> None:
+        """Elimina el volumen del workspace de un runner (cuotas en modo volume), si existe."""
+        try:
+            (client or self.client).volumes.get(volume_name(runner_name)).remove(force=True)
+        except docker.errors.NotFound:
+            pass
+        except Exception as e:
+            # La verificación posterior del workspace vuelve a intentarlo
+            logger.warning(f"⚠️ No se pudo eliminar el volumen del workspace de {runner_name}: {e}")
+
+    def _backend(self, pool: RunnerPool) -> Any:
+        backend = self.backends.get(pool.backend)
+        if not backend:
+            setting = {"ssh": "SSH_HOSTS_FILE", "ecs": "ECS_CLUSTER", "azure": "AZURE_SUBSCRIPTION_ID", "gce": "GCE_PROJECT"}[pool.backend]
+            raise ValueError(f"Pool {pool.name} usa el backend {pool.backend} pero {setting} no está configurado")
+        return backend
+
+    def _apply_egress_proxy(self, environment: Dict[str, str], runner_name: str) -> str:
+        """
+        Fuerza la salida del runner por el proxy de egress.
+
+        El contenedor se conecta solo a una red interna sin ruta a internet: la suya
+        (con los proxies conectados, ver runner_networks.py) o, sin aislamiento, la
+        compartida EGRESS_NETWORK. El nombre del runner viaja como usuario del proxy
+        para que los destinos denegados queden asociados al job.
+
+        Returns:
+            Nombre de la red compartida, si el runner no tiene red propia
+        """
+        proxy_url = os.getenv("EGRESS_PROXY_URL", "http://egress-proxy:3128")
+        scheme, _, authority = proxy_url.partition("://")
+        runner_proxy = f"{scheme}://{runner_name}@{authority}"
+
+        for key in ("HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"):
+            environment[key] = runner_proxy
+        no_proxy = ["localhost", "127.0.0.1"]
+        # El proxy de caché está en la red interna: se alcanza sin pasar por el egress
+        cache_host = cache_proxy_hostname()
+        if cache_host:
+            no_proxy.append(cache_host)
+        environment["NO_PROXY"] = environment["no_proxy"] = ",".join(no_proxy)
+
+        return os.getenv("EGRESS_NETWORK", "gha-runner-egress")
+
+    def verify_pool_image(self, pool: RunnerPool) -> None:
+        """Verifica firma y vulnerabilidades de la imagen del pool (falla si el modo es enforce)."""
+        # En hosts SSH y VMs no hay imagen de contenedor; las tareas de ECS sí usan la del pool
+        if pool.backend in ("ssh", "azure", "gce"):
+            return
+        image = pool.image or self.runner_image
+        self.image_verifier.verify(image, required=pool.verify_signature)
+        report = self.image_scanner.scan(image, required=pool.scan_vulnerabilities)
+        if report:
+            pool.image_scan = {key: value for key, value in report.items() if key != "scanned_epoch"}
+
     def get_runner_container(self, runner_name: str) -> Any:
         """Obtiene un contenedor específico por nombre de runner."""
         try:
-            containers = self.client.containers.list(
-                all=False, filters={"label": f"runner-name={runner_name}"}
+            containers = retry_budgets.get("docker").call(
+                lambda: self.client.containers.list(all=False, filters={"label": f"runner-name={runner_name}"}),
+                retry_error=docker_transient,
             )
-            return containers[0] if containers else None
+            if not containers:
+                return self._backend_runner(runner_name)
+            return containers[0]
         except Exception as e:
             logger.error(f"Error obteniendo contenedor {runner_name}: {e}")
             return None
 
+    def _backend_runner(self, runner_name: str) -> Any:
+        """Runner de un host Docker remoto o de un backend SSH, ECS o de VMs por nombre, si alguno lo tiene."""
+        if self.docker_hosts:
+            container = self.docker_hosts.find({"label": f"runner-name={runner_name}"})
+            if container:
+                return container
+        for backend in self.backends.values():
+            runner = backend.get(runner_name)
+            if runner:
+                return runner
+        return None
+
     def get_runner_containers(self) -> List[Any]:
         """Obtiene todos los contenedores de runners efímeros activos."""
         try:
-            containers = self.client.containers.list(
-                all=False, filters={"label": "gha-ephemeral=true"}
+            containers = retry_budgets.get("docker").call(
+                lambda: self.client.containers.list(all=False, filters={"label": "gha-ephemeral=true"}),
+                retry_error=docker_transient,
             )
+            if self.docker_hosts:
+                containers += self.docker_hosts.list_runners()
+            for name, backend in self.backends.items():
+                try:
+                    containers += backend.list_runners()
+                except Exception as e:
+                    logger.error(f"Error obteniendo runners del backend {name}: {e}")
             return containers
         except Exception as e:
             logger.error(f"Error obteniendo contenedores: {e}")
@@ -118,21 +354,35 @@ class ContainerManager:
     def stop_container(self, container: Any, timeout: int = 30) -> bool:
         """Detiene y elimina un contenedor."""
         try:
-            container.stop(timeout=timeout)
-            container.remove(force=True)
+            docker_retry = retry_budgets.get("docker")
+            docker_retry.call(lambda: container.stop(timeout=timeout), retry_error=docker_transient)
+            docker_retry.call(lambda: container.remove(force=True), retry_error=docker_transient)
+            # Contenedores de un host Docker remoto: su volumen y su red están en ese host
+            client = getattr(container, "client", None) or self.client
+            # Volumen del workspace con cuota (modo volume): no se borra con el contenedor
+            for mount in (getattr(container, "attrs", None) or {}).get("Mounts") or []:
+                if str(mount.get("Name", "")).startswith(f"{VOLUME_PREFIX}-"):
+                    self.remove_workspace_volume(mount["Name"][len(VOLUME_PREFIX) + 1:], client)
+            # Sidecars del pool, con sus volúmenes anónimos
+            runner_name = (getattr(container, "labels", None) or {}).get("runner-name")
+            if runner_name:
+                self.sidecars.remove(client, runner_name)
+            # Red propia del runner, con los contenedores de servicio que sigan conectados
+            for name in ((getattr(container, "attrs", None) or {}).get("NetworkSettings") or {}).get("Networks") or {}:
+                if name.startswith(f"{NETWORK_PREFIX}-"):
+                    self.networks.remove(name, client)
             return True
         except Exception as e:
             logger.error(f"Error deteniendo contenedor: {e}")
             return False
 
     def get_container_logs(self, container: Any, tail: int = 50) -> str:
-        """Obtiene logs de un contenedor directamente."""
+        """Obtiene logs de un contenedor directamente (con secretos ocultos)."""
         try:
             logs = container.logs(tail=tail)
             if isinstance(logs, bytes):
-                return logs.decode("utf-8", errors="replace")
-            else:
-                return str(logs)
+                logs = logs.decode("utf-8", errors="replace")
+            return redactor.redact(str(logs))
         except Exception as e:
             logger.error(f"Error obteniendo logs del contenedor: {e}")
             return f"Error obteniendo logs: {str(e)}"
@@ -158,9 +408,16 @@ class ContainerManager:
     def get_container_by_name(self, name: str) -> Any:
         """Obtiene un contenedor por su nombre."""
         try:
-            containers = self.client.containers.list(
-                all=True, filters={"name": name}
+            containers = retry_budgets.get("docker").call(
+                lambda: self.client.containers.list(all=True, filters={"name": name}),
+                retry_error=docker_transient,
             )
-            return containers[0] if containers else None
+            if not containers and self.docker_hosts:
+                container = self.docker_hosts.find({"name": name}, all=True)
+                if container:
+                    return container
+            if not containers:
+                return self._backend_runner(name)
+            return containers[0]
         except:
             return None
@@ -1,6 +1,6 @@
 import logging
-import requests
-from typing import List, Dict
+from typing import Dict, List, Optional
+from src.services.github_auth import GitHubCredentials
 from src.services.tokens import TokenGenerator
 from src.utils.helpers import format_log, setup_logger
 
@@ -10,11 +10,16 @@ logger = setup_logger(__name__)
 class GitHubRunnerCleanup:
     """Maneja la limpieza de runners offline en GitHub API."""
     
-    def __init__(self, github_runner_token: str):
-        self.token_generator = TokenGenerator(github_runner_token)
+    def __init__(self, credentials: GitHubCredentials):
+        self.token_generator = TokenGenerator(credentials)
+        self.client = self.token_generator.client
     
     def get_all_runners_from_github(self, scope: str, scope_name: str) -> List[Dict]:
         """Obtiene todos los runners (online y offline) desde GitHub API."""
+        return self.list_runners(scope, scope_name) or []
+
+    def list_runners(self, scope: str, scope_name: str) -> Optional[List[Dict]]:
+        """Runners registrados en el ámbito, o None si GitHub no respondió (no es lo mismo que ninguno)."""
         try:
             if scope == "repo":
                 url = f"{self.token_generator.api_base}/repos/{scope_name}/actions/runners"
@@ -23,18 +28,21 @@ class GitHubRunnerCleanup:
             else:
                 url = f"{self.token_generator.api_base}/user/actions/runners"
             
-            response = requests.get(url, headers=self.token_generator.headers, timeout=30.0)
+            response = self.client.get(url, params={"per_page": 100}, conditional=True)
+            if response is None:
+                logger.info("Listado de runners de GitHub diferido por rate limit")
+                return None
             
             if response.status_code == 200:
                 data = response.json()
                 return data.get("runners", [])
             else:
                 logger.error(f"Error obteniendo runners de GitHub: {response.status_code}")
-                return []
+                return None
                 
         except Exception as e:
             logger.error(f"Error consultando GitHub API: {e}")
-            return []
+            return None
     
     def get_offline_runners(self, scope: str, scope_name: str) -> List[Dict]:
         """Filtra runners offline."""
@@ -54,7 +62,10 @@ class GitHubRunnerCleanup:
             else:
                 url = f"{self.token_generator.api_base}/user/actions/runners/{runner_id}"
             
-            response = requests.delete(url, headers=self.token_generator.headers, timeout=30.0)
+            response = self.client.delete(url)
+            if response is None:
+                logger.info(f"Eliminación del runner {runner_id} diferida por rate limit")
+                return False
             
             if response.status_code == 204:
                 logger.info(f"Runner {runner_id} eliminado de GitHub")
@@ -8,8 +8,32 @@ from functools import wraps
 import requests
 from src.core.container import ContainerManager
 from src.core.github_cleanup import GitHubRunnerCleanup
+from src.services.chaos import chaos
+from src.services.datadog import datadog
+from src.services.disk_pressure import create_disk_pressure_monitor
+from src.services.fleet_cutovers import fleet_cutovers
 from src.services.docker import DockerUtils
+from src.services.github_auth import GitHubAppCredentials, GitHubCredentials
+from src.services.github_graphql import create_queued_runs_query
+from src.services.github_outage import github_outage
+from src.services.image_builder import canary_pool, image_rollouts
+from src.services.job_runners import job_runners
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.policies import job_policies
+from src.services.pool_archive import pool_archive
+from src.services.pools import diff_pools, load_pools, reload_pools
+from src.services.provisioning import provisioner
+from src.services.regions import region_failover
+from src.services.registration import create_registration_pacer, create_registration_verifier
+from src.services.resource_classes import resource_classes
+from src.services.sharding import sharding
+from src.services.stuck_runners import create_stuck_runner_reaper
+from src.services.budgets import budgets
+from src.services.tenants import tenants
+from src.services.usage import usage_ledger
 from src.services.tokens import TokenGenerator
+from src.services.workspaces import create_workspace_monitor
 from src.utils.helpers import format_log, setup_logger
 
 logger = setup_logger(__name__)
@@ -28,20 +52,84 @@ def handle_lifecycle_errors(func):
 
 
 class LifecycleManager:
-    def __init__(self, github_runner_token: str, runner_image: str):
-        self.token_generator = TokenGenerator(github_runner_token)
+    def __init__(self, credentials: GitHubCredentials, runner_image: str):
+        self.credentials = credentials
+        self.token_generator = TokenGenerator(credentials)
+        self.github = self.token_generator.client
+        # Runs en cola de todos los repositorios en pocas peticiones GraphQL (con vuelta a REST)
+        self.queued_runs = create_queued_runs_query(self.github)
         self.container_manager = ContainerManager(runner_image)
-        self.github_cleanup = GitHubRunnerCleanup(github_runner_token)
+        self.github_cleanup = GitHubRunnerCleanup(credentials)
+        self.pools = self._with_managed_pools(load_pools())
+        # Modo simulación global: se calcula y registra lo que se haría sin tocar Docker ni GitHub
+        self.dry_run = os.getenv("DRY_RUN", "false").lower() == "true"
         self.active_runners: Dict[str, Any] = {}
+        # Aviso de interrupción spot/preemption: el host no acepta runners nuevos
+        self.interrupted = False
         self.runner_lock = threading.Lock()  # ← Bloqueo atómico para race conditions
+        # Registros espaciados por ámbito y comprobación de que cada runner aparece online
+        self.registration_pacer = create_registration_pacer()
+        self.registration_verifier = create_registration_verifier(self)
+        # Cómputo que no termina de desaparecer: eliminación escalada
+        self.stuck_reaper = create_stuck_runner_reaper(self)
+        # Uso de disco de los workspaces y verificación de que se eliminan con el runner
+        self.workspace_monitor = create_workspace_monitor(self)
+        # Disco e inodos de los hosts: colocación, limpieza y desalojo de runners libres
+        self.disk_pressure = create_disk_pressure_monitor(self)
         self.monitoring = False
         self.monitor_thread: Optional[threading.Thread] = None
 
+    def reload_pools(self) -> Dict[str, List[str]]:
+        """
+        Recarga los pools sin reiniciar; si la nueva definición es inválida se conserva la actual.
+
+        Los runners existentes no se tocan: los cambios aplican a los runners que se creen después.
+        """
+        with self.runner_lock:
+            try:
+                registry = self._with_managed_pools(reload_pools())
+            except Exception as e:
+                metrics.incr("config.reloads", tags={"result": "failed"})
+                logger.error(format_log('ERROR', 'Recarga de pools rechazada, se mantiene la configuración anterior', str(e)))
+                raise
+
+            changes = diff_pools(self.pools, registry)
+            self.pools = registry
+
+        metrics.incr("config.reloads", tags={"result": "success"})
+        logger.info(format_log(
+            'CONFIG', 'Pools recargados',
+            ", ".join(f"{kind}: {', '.join(names)}" for kind, names in changes.items() if names) or "sin cambios"
+        ))
+        return changes
+
+    @staticmethod
+    def _with_managed_pools(registry):
+        """
+        Los pools de los tenants y los restaurados desde snapshots no están en la
+        configuración: se agregan a cada carga, y los retirados se apartan. Los pools
+        con un despliegue de imagen completado quedan fijados a su digest.
+        """
+        if tenants:
+            registry = tenants.merge_pools(registry)
+        if pool_archive:
+            registry = pool_archive.apply(registry)
+        return image_rollouts.apply(registry) if image_rollouts else registry
+
+    def tenant_runner_count(self, tenant: str) -> int:
+        """Runners activos con el label tenant indicado."""
+        count = 0
+        for container in list(self.active_runners.values()):
+            labels = DockerUtils.get_container_labels(container)
+            if isinstance(labels, dict) and labels.get("tenant") == tenant:
+                count += 1
+        return count
+
     def _github_api_call(self, endpoint: str, params: Dict = None) -> Dict:
         """Método genérico para llamadas a GitHub API."""
-        url = f"{self.token_generator.api_base}/{endpoint}"
-        response = requests.get(url, headers=self.token_generator.headers, 
-                              params=params, timeout=30.0)
+        response = self.github.get(endpoint, params=params, conditional=True)
+        if response is None:
+            return {}
         return response.json() if response.status_code == 200 else {}
 
     
@@ -54,25 +142,128 @@ class LifecycleManager:
         runner_group: Optional[str] = None,
         labels: Optional[List[str]] = None,
         enable_dind: bool = False,
+        pool: Optional[str] = None,
+        dry_run: bool = False,
+        budget_override: Optional[str] = None,
+        resource_class: Optional[str] = None,
     ) -> str:
-        """Crea un runner efímero."""
-        logger.info(f"🚀 Creando runner para {scope}/{scope_name}")
-        
-        registration_token = self.token_generator.generate_registration_token(scope, scope_name)
-        container = self.container_manager.create_runner_container(
-            registration_token=registration_token,
-            scope=scope,
-            scope_name=scope_name,
-            runner_name=runner_name,
-            runner_group=runner_group,
-            labels=labels,
-            enable_dind=enable_dind,
-        )
+        """Crea un runner efímero (o solo registra qué se crearía en modo simulación)."""
+        tenant = tenants.for_scope(scope, scope_name) if tenants else None
+        runner_pool = tenants.resolve_pool(tenant, self.pools, pool) if tenants else self.pools.get(pool)
+        # Clase de recursos pedida, la del label size-* o la por defecto del pool
+        resource_class = resource_classes.select(runner_pool, labels, resource_class)
+        metric_tags = {"scope": scope, "pool": runner_pool.name}
+        if tenant:
+            metric_tags["tenant"] = tenant["name"]
+        if resource_class:
+            metric_tags["resource_class"] = resource_class
+
+        if dry_run or self.dry_run:
+            runner_id = runner_name or f"dry-run-{int(time.time() * 1000)}"
+            metrics.incr("runners.dry_run", tags={**metric_tags, "action": "create"})
+            logger.info(format_log(
+                'DRY_RUN', 'Se crearía runner',
+                f"{runner_id} para {scope}/{scope_name} (pool {runner_pool.name}, "
+                f"imagen {runner_pool.image or self.container_manager.runner_image}, "
+                f"labels {', '.join((labels or []) + runner_pool.labels) or '-'}, "
+                f"clase {resource_class or '-'}, dind {enable_dind or runner_pool.enable_dind})"
+            ))
+            return runner_id
+
+        if self.interrupted:
+            raise ValueError("Host en interrupción (spot/preemption): no se crean runners nuevos")
+        # Con DOCKER_HOSTS_FILE el Docker local no recibe runners: la presión de cada host se mira al colocar
+        local_docker = runner_pool.backend == "docker" and not self.container_manager.docker_hosts
+        if self.disk_pressure and local_docker and not self.disk_pressure.allows():
+            raise ValueError("Host Docker con presión de disco: no se crean runners nuevos")
+
+        if budgets:
+            budgets.check(tenant["name"] if tenant else None, runner_pool, budget_override)
+        if tenant:
+            tenants.reserve(tenant, self.tenant_runner_count(tenant["name"]))
+
+        # Cambio blue/green en curso: una parte de los runners de los pools azules va a su verde
+        cutover = fleet_cutovers.route(runner_pool.name) if fleet_cutovers else None
+        if cutover and cutover["pool"] != runner_pool.name:
+            runner_pool = self.pools.get(cutover["pool"])
+            metric_tags["pool"] = runner_pool.name
+        # Despliegue de imagen en curso: una parte de los runners nuevos usa la imagen canario
+        canary = canary_pool(runner_pool)
+        if canary:
+            runner_pool = canary["pool"]
+        runner_pool = resource_classes.apply(runner_pool, resource_class)
+
+        logger.info(f"🚀 Creando runner para {scope}/{scope_name} (pool {runner_pool.name})")
+        try:
+            # En escalados masivos los runners de un ámbito se registran de uno en uno
+            self.registration_pacer.wait(scope_name)
+            with metrics.timer("runners.create_duration", metric_tags), \
+                    datadog.tracer.span("runner.create", resource=runner_pool.name) as span:
+                span["meta"].update({"runner.scope": scope, "runner.scope_name": scope_name})
+                if chaos:
+                    chaos.provision(runner_pool.name, runner_name)
+                # Verificar procedencia y vulnerabilidades antes de pedir un token de registro
+                self.container_manager.verify_pool_image(runner_pool)
+                registration_token = self.token_generator.generate_registration_token(scope, scope_name)
+
+                def provision(candidate):
+                    # Una región con imagen propia también se verifica
+                    if candidate.image != runner_pool.image:
+                        self.container_manager.verify_pool_image(candidate)
+                    return self.container_manager.create_runner_container(
+                        registration_token=registration_token,
+                        scope=scope,
+                        scope_name=scope_name,
+                        runner_name=runner_name,
+                        runner_group=runner_group,
+                        labels=labels,
+                        enable_dind=enable_dind,
+                        pool=candidate,
+                        tenant=tenant["name"] if tenant else None,
+                    )
+
+                # Pools multi-región: la primera región con capacidad, por orden de preferencia
+                container = region_failover.create(runner_pool, provision) if runner_pool.regions else provision(runner_pool)
+        except Exception as e:
+            if tenant:
+                tenants.release(tenant)
+            metrics.incr("runners.create_failed", tags=metric_tags)
+            if canary:
+                image_rollouts.record(canary["rollout"], failed=True)
+            if cutover:
+                fleet_cutovers.record(cutover["cutover"], cutover["side"], failed=True)
+            lifecycle_events.emit(
+                "runner.provision_failed", key=scope_name,
+                scope=scope, scope_name=scope_name, pool=runner_pool.name, error=str(e),
+            )
+            raise
 
-        labels = DockerUtils.get_container_labels(container)
-        runner_id = labels.get("runner-name", container.id[:12]) if labels else container.id[:12]
+        container_labels = DockerUtils.get_container_labels(container)
+        runner_id = container_labels.get("runner-name", container.id[:12]) if container_labels else container.id[:12]
         self.active_runners[runner_id] = container
+        if tenant:
+            # Ya cuenta como activo
+            tenants.release(tenant)
+        if canary:
+            image_rollouts.record(canary["rollout"], runner_id=runner_id)
+        if cutover:
+            fleet_cutovers.record(cutover["cutover"], cutover["side"], runner_id=runner_id)
+        metrics.incr("runners.created", tags=metric_tags)
+        metrics.gauge("runners.active", len(self.active_runners))
         container_id = DockerUtils.format_container_id(container.id)
+        lifecycle_events.emit(
+            "runner.provisioned", key=runner_id,
+            runner_id=runner_id, container_id=container_id, scope=scope, scope_name=scope_name,
+            pool=runner_pool.name, image=runner_pool.image or self.container_manager.runner_image,
+            tenant=tenant["name"] if tenant else None,
+            resource_class=resource_class, cost_factor=resource_classes.cost_factor(resource_class),
+            region=(container_labels or {}).get("runner-region"),
+        )
+        if self.registration_verifier:
+            self.registration_verifier.track(runner_id, {
+                "scope": scope, "scope_name": scope_name, "runner_name": runner_name, "runner_group": runner_group,
+                "labels": labels, "enable_dind": enable_dind, "pool": pool, "resource_class": resource_class,
+            })
         logger.info(f"✅ Runner creado: {runner_id} (container: {container_id})")
         return runner_id
 
@@ -92,13 +283,14 @@ class LifecycleManager:
                 "image": info["image"],
                 "created": info["created"],
                 "labels": info["labels"],
+                "health": DockerUtils.container_health(container),
             }
         except Exception as e:
             return {"status": "error", "runner_id": runner_id, "error": str(e)}
 
     @handle_lifecycle_errors
-    def destroy_runner(self, runner_id: str) -> bool:
-        """Destruye un runner efímero."""
+    def destroy_runner(self, runner_id: str, dry_run: bool = False) -> bool:
+        """Destruye un runner efímero (o solo registra que se destruiría en modo simulación)."""
         logger.info(f"🗑️  Destruyendo runner: {runner_id}")
         
         container = self.active_runners.get(runner_id)
@@ -109,6 +301,11 @@ class LifecycleManager:
             logger.warning(f"⚠️  Runner no encontrado: {runner_id}")
             return False
 
+        if dry_run or self.dry_run:
+            metrics.incr("runners.dry_run", tags={"action": "destroy"})
+            logger.info(format_log('DRY_RUN', 'Se destruiría runner', runner_id))
+            return True
+
         try:
             container.reload()
             status = container.status
@@ -118,12 +315,23 @@ class LifecycleManager:
             logger.warning(f"⚠️ No se pudo obtener información final: {e}")
 
         logger.info(f"🛑 Destruyendo runner: {runner_id}")
-        success = self.container_manager.stop_container(container)
+        with datadog.tracer.span("runner.destroy", resource=runner_id):
+            success = self.container_manager.stop_container(container)
+        if self.stuck_reaper:
+            # Se comprueba que el cómputo desaparezca de verdad
+            self.stuck_reaper.watch(runner_id, container, destroyed=True)
         
         if success:
             self.active_runners.pop(runner_id, None)
+            if self.workspace_monitor:
+                self.workspace_monitor.released(runner_id, container)
+            metrics.incr("runners.destroyed")
+            metrics.gauge("runners.active", len(self.active_runners))
+            lifecycle_events.emit("runner.destroyed", key=runner_id, runner_id=runner_id)
             logger.info(f"✅ Runner destruido: {runner_id}")
         else:
+            metrics.incr("runners.destroy_failed")
+            lifecycle_events.emit("runner.destroy_failed", key=runner_id, runner_id=runner_id)
             logger.error(f"❌ No se pudo destruir el runner {runner_id}")
             
         return success
@@ -143,12 +351,17 @@ class LifecycleManager:
         return runner_statuses
 
     @handle_lifecycle_errors
-    def cleanup_inactive_runners(self) -> int:
+    def cleanup_inactive_runners(self, dry_run: bool = False) -> int:
         """Purga runners efímeros: destruye todos menos los que tienen workflows activos."""
+        dry_run = dry_run or self.dry_run
         logger.info(format_log('CONFIG', 'Limpieza de runners inactivos'))
         
         cleaned_count = 0
         runners_to_remove = []
+        # Sin GitHub no se sabe qué runners tienen trabajo: solo se purgan los muertos
+        degraded = github_outage.degraded
+        if degraded:
+            logger.warning(format_log('WARNING', 'Modo degradado: se conservan los runners en ejecución'))
 
         for runner_id, container in self.active_runners.items():
             try:
@@ -158,36 +371,55 @@ class LifecycleManager:
                     logger.info(f"💀 Runner {runner_id} está muerto, se eliminará")
                     runners_to_remove.append(runner_id)
                     continue
+
+                # HEALTHCHECK de la imagen (runner-agent): el listener perdió GitHub o el runner no arrancó.
+                # En modo degradado todos los listeners están desconectados, así que no se tiene en cuenta
+                if not degraded and DockerUtils.container_health(container) == "unhealthy":
+                    self._unhealthy_runner(runner_id, container)
+                    runners_to_remove.append(runner_id)
+                    continue
                 
                 labels = DockerUtils.get_container_labels(container)
                 if isinstance(labels, dict):
                     repo = labels.get("repo")
-                    if repo and self.get_active_workflows_for_repo(repo) == 0:
+                    if repo and not degraded and self.get_active_workflows_for_repo(repo) == 0:
                         runners_to_remove.append(runner_id)
                         
             except Exception as e:
                 logger.error(f"❌ Error analizando runner {runner_id}: {e}")
-                runners_to_remove.append(runner_id)
+                if not degraded:
+                    runners_to_remove.append(runner_id)
 
         logger.info(format_log('INFO', f'Análisis: {len(self.active_runners) - len(runners_to_remove)} activos, {len(runners_to_remove)} para eliminar'))
 
         for runner_id in runners_to_remove:
             try:
-                if self.destroy_runner(runner_id):
+                if self.destroy_runner(runner_id, dry_run=dry_run):
                     cleaned_count += 1
             except Exception as e:
                 logger.error(f"❌ Error eliminando runner {runner_id}: {e}")
 
-        if cleaned_count > 0:
+        if dry_run:
+            logger.info(format_log('DRY_RUN', f'{cleaned_count} runners se purgarían'))
+        elif cleaned_count > 0:
             logger.info(format_log('SUCCESS', f'{cleaned_count} runners purgados'))
         else:
             logger.info(format_log('SUCCESS', 'No hay runners para purgar'))
         
         # Después de limpiar runners locales, limpiar runners offline de GitHub
-        self.cleanup_github_offline_runners()
+        self.cleanup_github_offline_runners(dry_run=dry_run)
         
         return cleaned_count
 
+    @staticmethod
+    def _unhealthy_runner(runner_id: str, container: Any):
+        log = ((container.attrs.get("State") or {}).get("Health") or {}).get("Log") or []
+        output = str(log[-1].get("Output") or "").strip()[:500] if log else ""
+        pool = (DockerUtils.get_container_labels(container) or {}).get("runner-pool", "default")
+        logger.warning(format_log('WARNING', f'Runner {runner_id} no sano según su HEALTHCHECK, se eliminará', output))
+        metrics.incr("runners.unhealthy", tags={"pool": pool})
+        lifecycle_events.emit("runner.unhealthy", key=runner_id, runner_id=runner_id, pool=pool, output=output)
+
     def cleanup_github_offline_runners(self, dry_run: bool = False) -> Dict[str, int]:
         """Limpia runners offline de GitHub API."""
         try:
@@ -196,6 +428,9 @@ class LifecycleManager:
             if not github_cleanup_enabled:
                 logger.debug("GitHub cleanup desactivado (GITHUB_CLEANUP_ENABLED=false)")
                 return {"total": 0, "cleaned": 0, "failed": 0}
+
+            if github_outage.degraded:
+                return {"total": 0, "cleaned": 0, "failed": 0}
             
             logger.info(format_log('CONFIG', 'Limpiando runners offline de GitHub'))
             
@@ -275,11 +510,16 @@ class LifecycleManager:
         
         while self.monitoring:
             try:
-                with self.runner_lock:
+                with self.runner_lock, metrics.timer("monitor.cycle_duration"):
                     self.cleanup_inactive_runners()
                     self.check_and_create_runners_for_jobs()
                 
                 active_count = len(self.active_runners)
+                metrics.gauge("runners.active", active_count)
+                for tenant in tenants.list() if tenants else []:
+                    metrics.gauge("tenants.runners_active", self.tenant_runner_count(tenant["name"]), tags={"tenant": tenant["name"]})
+                if usage_ledger:
+                    usage_ledger.close_missing(list(self.active_runners))
                 logger.info(format_log('INFO', f'Estado: {active_count} runners activos'))
                 
                 sleep_time = min(purge_interval, cleanup_interval)
@@ -287,12 +527,20 @@ class LifecycleManager:
                 time.sleep(sleep_time)
                 
             except Exception as e:
+                metrics.incr("monitor.cycle_errors")
                 logger.error(format_log('ERROR', f'Error en ciclo de monitoreo', str(e)))
                 logger.info(format_log('INFO', 'Esperando 60s antes de reintentar'))
                 time.sleep(60)
 
     def check_and_create_runners_for_jobs(self):
         """Descubre automáticamente repos que necesitan runners y los crea."""
+        if self.interrupted:
+            return
+        if github_outage.degraded:
+            # Sin listados de GitHub todos los repos parecerían sin jobs; los webhooks se guardan como intenciones
+            logger.info(format_log('INFO', 'Modo degradado: descubrimiento de jobs pausado'))
+            return
+
         repos = self.get_user_repositories()
 
         if not repos:
@@ -300,6 +548,7 @@ class LifecycleManager:
             return
 
         logger.info(f"🔍 Analizando {len(repos)} repositorios...")
+        queued_by_repo = self.queued_runs.counts(repos) if self.queued_runs else {}
         
         repos_with_runners = 0
         repos_with_jobs = 0
@@ -318,7 +567,10 @@ class LifecycleManager:
                     else:
                         logger.info(f"🏃 {repo}: Runner estándar")
                     
-                    queued_jobs = self.get_queued_jobs_for_repo(repo)
+                    if repo in queued_by_repo:
+                        queued_jobs = queued_by_repo[repo]
+                    else:
+                        queued_jobs = self.get_queued_jobs_for_repo(repo)
 
                     if queued_jobs > 0:
                         repos_with_jobs += 1
@@ -326,22 +578,44 @@ class LifecycleManager:
 
                         active_runners = sum(1 for runner_id, container in self.active_runners.items()
                                           if self._runner_belongs_to_repo(container, repo))
+                        # Runners que un webhook está creando para jobs de este repo todavía no figuran como activos
+                        active_runners += job_runners.pending_for(repo)
 
                         logger.info(f"📊 {repo}: {active_runners} runners vs {queued_jobs} jobs")
 
+                        metrics.gauge("jobs.queued", queued_jobs, tags={"repo": repo})
+
                         if active_runners < queued_jobs:
                             needed = queued_jobs - active_runners
+                            # El autoscaler solo conoce el repo: aplican las reglas por repositorio y pool
+                            if job_policies and not self.dry_run and job_policies.evaluate({"repo": repo, "pool": self.pools.get()}, self.github):
+                                continue
                             logger.info(f"🚀 {repo}: Creando {needed} runners")
-
-                            for i in range(needed):
-                                runner_name = f"auto-runner-{int(time.time())}-{i}"
-                                try:
-                                    runner_id = self.create_runner(
-                                        scope="repo", scope_name=repo, runner_name=runner_name, enable_dind=needs_dind
-                                    )
+                            datadog.event(
+                                f"Escalado de {repo}: +{needed} runners",
+                                f"{queued_jobs} jobs en cola y {active_runners} runners activos",
+                                aggregation_key=f"scale:{repo}",
+                                tags={"repo": repo, "decision": "scale_up", "trigger": "auto"},
+                            )
+
+                            # Con plantilla de nombre configurada, el modo automático también la usa
+                            default_pool = self.pools.get()
+                            use_template = self.container_manager.naming.name_template_for(default_pool) is not None
+                            # Creación en paralelo (PROVISION_CONCURRENCY); se espera a todos antes del siguiente repo
+                            results = provisioner.run(default_pool.name, default_pool.backend, [
+                                {
+                                    "scope": "repo",
+                                    "scope_name": repo,
+                                    "runner_name": None if use_template else f"auto-runner-{int(time.time())}-{i}",
+                                    "enable_dind": needs_dind,
+                                }
+                                for i in range(needed)
+                            ], self.create_runner)
+                            for result in results:
+                                if isinstance(result, Exception):
+                                    logger.error(f"❌ Error creando runner para {repo}: {result}")
+                                else:
                                     runners_created += 1
-                                except Exception as e:
-                                    logger.error(f"❌ Error creando runner para {repo}: {e}")
 
             except Exception as e:
                 logger.error(f"❌ Error procesando repo {repo}: {e}")
@@ -391,32 +665,34 @@ class LifecycleManager:
             return {}
 
     def get_user_repositories(self) -> List[str]:
-        """Obtiene todos los repositorios accesibles del usuario."""
+        """Obtiene los repositorios accesibles del usuario que pertenecen a este shard."""
         discovery_mode = os.getenv("DISCOVERY_MODE", "all")
 
         if discovery_mode == "organization":
             org_repos = self.get_organization_repositories()
             user_repos = self._get_user_repositories()
-            return list(set(org_repos + user_repos))
+            return sharding.filter(list(set(org_repos + user_repos)))
         else:
-            return self._get_user_repositories()
+            return sharding.filter(self._get_user_repositories())
 
     def _get_user_repositories(self) -> List[str]:
         """Obtiene todos los repositorios personales del usuario."""
+        # Una GitHub App no tiene usuario: se usan los repos de sus instalaciones
+        if isinstance(self.credentials, GitHubAppCredentials):
+            return self.credentials.list_installation_repositories()
+
         repos = []
         page = 1
         per_page = 100
 
         while True:
-            url = f"{self.token_generator.api_base}/user/repos"
-            response = requests.get(
-                url,
-                headers=self.token_generator.headers,
+            response = self.github.get(
+                "user/repos",
                 params={"type": "owner", "page": page, "per_page": per_page},
-                timeout=30.0,
+                conditional=True,
             )
 
-            if response.status_code != 200:
+            if response is None or response.status_code != 200:
                 break
 
             page_repos = response.json()
@@ -441,15 +717,13 @@ class LifecycleManager:
             per_page = 100
             
             while True:
-                url = f"{self.token_generator.api_base}/orgs/{org_name}/repos"
-                response = requests.get(
-                    url,
-                    headers=self.token_generator.headers,
+                response = self.github.get(
+                    f"orgs/{org_name}/repos",
                     params={"type": "all", "page": page, "per_page": per_page},
-                    timeout=30.0
+                    conditional=True,
                 )
                 
-                if response.status_code != 200:
+                if response is None or response.status_code != 200:
                     break
                 
                 data = response.json()
@@ -469,10 +743,9 @@ class LifecycleManager:
         """Verifica si un repositorio usa self-hosted runners."""
         try:
             owner, name = repo.split("/")
-            url = f"{self.token_generator.api_base}/repos/{owner}/{name}/contents/.github/workflows"
-            response = requests.get(url, headers=self.token_generator.headers, timeout=30.0)
+            response = self.github.get(f"repos/{owner}/{name}/contents/.github/workflows")
 
-            if response.status_code != 200:
+            if response is None or response.status_code != 200:
                 return False
 
             workflows = response.json()
@@ -481,7 +754,7 @@ class LifecycleManager:
                     workflow_url = workflow.get("download_url")
                     if workflow_url:
                         workflow_response = requests.get(
-                            workflow_url, headers=self.token_generator.headers, timeout=30.0
+                            workflow_url, headers=self.github.auth_headers(owner), timeout=30.0
                         )
 
                         if workflow_response.status_code == 200:
@@ -504,10 +777,9 @@ class LifecycleManager:
         """Verifica si un repositorio necesita Docker-in-Docker."""
         try:
             owner, name = repo.split("/")
-            url = f"{self.token_generator.api_base}/repos/{owner}/{name}/contents/.github/workflows"
-            response = requests.get(url, headers=self.token_generator.headers, timeout=30.0)
+            response = self.github.get(f"repos/{owner}/{name}/contents/.github/workflows")
             
-            if response.status_code != 200:
+            if response is None or response.status_code != 200:
                 return False
                 
             workflows = response.json()
@@ -516,7 +788,7 @@ class LifecycleManager:
                     workflow_url = workflow.get("download_url")
                     if workflow_url:
                         workflow_response = requests.get(
-                            workflow_url, headers=self.token_generator.headers, timeout=30.0
+                            workflow_url, headers=self.github.auth_headers(owner), timeout=30.0
                         )
                         
                         if workflow_response.status_code == 200:
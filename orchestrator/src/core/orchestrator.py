@@ -3,27 +3,87 @@ Lógica principal del servicio Orchestrator.
 Contiene toda la lógica de negocio separada de la API FastAPI.
 """
 
+import asyncio
 import logging
 import os
-from typing import Dict, List
+import uuid
+from typing import Dict, List, Optional
 
 from src.api.models import (
+    BudgetOverrideRequest,
+    BudgetRequest,
+    BulkOperationRequest,
     ConfigurationInfo, 
+    DockerHostDrainRequest,
+    FleetCutoverRequest,
+    FleetCutoverRollbackRequest,
+    ImageBuildRequest,
+    ImageRollbackRequest,
+    ImageRolloutRequest,
+    PoolRestoreRequest,
+    PoolRetireRequest,
+    PoolSnapshotRequest,
     RunnerRequest, 
     RunnerResponse, 
     RunnerStatus, 
+    TenantRequest,
     ValidationResult
 )
 from src.core.lifecycle import LifecycleManager
 from src.services.config import ConfigValidator
+from src.services.anomalies import cost_anomalies
+from src.services.budgets import BudgetMonitor, budgets
+from src.services.bulk import create_bulk_operations
+from src.services.chaos import chaos
+from src.services.datadog import datadog
+from src.services.deliveries import deliveries
+from src.services.job_runners import PENDING, job_runners
+from src.services.lifecycle_events import lifecycle_events
+from src.services.diagnostics import Diagnostics
+from src.services.feature_flags import feature_flags
+from src.services.forecast import PrewarmScaler, demand_forecast
+from src.services.state import export_state, import_state
+from src.services import pools
+from src.services.gitops import PoolReconciler
+from src.services.fleet_cutovers import create_cutover_monitor, fleet_cutovers
+from src.services.image_builder import create_image_builder
+from src.services.image_prepull import create_image_prepuller
+from src.services.github_auth import (
+    GitHubAppCredentials,
+    create_github_credentials,
+    validate_credentials_permissions
+)
+from src.services.github_client import conditional_cache, rate_limits
+from src.services.github_outage import OutageProbe, github_outage
+from src.services.incidents import IncidentMonitor, incidents
+from src.services.github_server import validate_github_server
+from src.services.metrics import metrics
+from src.services.outbound_webhooks import outbound_webhooks
+from src.services.policies import job_policies
+from src.services.pool_archive import pool_archive
+from src.services.preemption import PreemptionWatcher, create_preemption_sources
+from src.services.provisioning import provisioner
+from src.services.queued_jobs import OrphanedJobDetector, custom_labels, queued_jobs
+from src.services.reconcile import create_drift_reconciler
+from src.services.regions import region_failover
+from src.services.resource_classes import resource_classes
+from src.services.retries import retry_budgets
+from src.services.sharding import sharding
+from src.services.tenants import tenants
+from src.services.usage import create_usage_delivery, previous_month, usage_ledger
+from src.services.warm_pools import create_warm_pool_refresher
+from src.services.work_queue import WorkQueueWorker, create_work_queue, work_queue_worker_id
 from src.utils.helpers import (
     ConfigurationError, 
+    GitHubError,
+    ValidationError,
     PlaceholderResolver,
     create_response, 
     setup_logger,
     get_env_var,
     format_log
 )
+from version import __version__
 
 # Configuración de logging centralizada
 logger = setup_logger(__name__)
@@ -47,8 +107,12 @@ class OrchestratorService:
             # Contar variables configuradas
             config_vars = []
             
-            self.github_runner_token = get_env_var("GITHUB_RUNNER_TOKEN", required=True)
-            config_vars.append("GITHUB_RUNNER_TOKEN: ***CONFIGURADO***")
+            # GitHub App tiene prioridad sobre el token personal
+            self.github_credentials = create_github_credentials()
+            if isinstance(self.github_credentials, GitHubAppCredentials):
+                config_vars.append(f"GITHUB_APP_ID: {self.github_credentials.app_id}")
+            else:
+                config_vars.append("GITHUB_RUNNER_TOKEN: ***CONFIGURADO***")
             
             self.runner_image = get_env_var("RUNNER_IMAGE", required=True)
             config_vars.append(f"RUNNER_IMAGE: {self.runner_image}")
@@ -61,8 +125,8 @@ class OrchestratorService:
             
             # Agregar otras variables relevantes
             for key, value in os.environ.items():
-                if key.startswith(('GITHUB_', 'RUNNER_', 'AUTO_')) and key not in ['GITHUB_RUNNER_TOKEN', 'RUNNER_IMAGE', 'AUTO_CREATE_RUNNERS', 'RUNNER_CHECK_INTERVAL']:
-                    if 'TOKEN' in key:
+                if key.startswith(('GITHUB_', 'RUNNER_', 'AUTO_')) and key not in ['GITHUB_RUNNER_TOKEN', 'GITHUB_APP_ID', 'RUNNER_IMAGE', 'AUTO_CREATE_RUNNERS', 'RUNNER_CHECK_INTERVAL']:
+                    if 'TOKEN' in key or 'PRIVATE_KEY' in key:
                         config_vars.append(f"{key}: ***CONFIGURADO***")
                     else:
                         config_vars.append(f"{key}: {value}")
@@ -80,8 +144,11 @@ class OrchestratorService:
             logger.info(format_log('CONFIG', 'Inicializando componentes'))
             
             # Inicializar Lifecycle Manager
-            self.lifecycle_manager = LifecycleManager(self.github_runner_token, self.runner_image)
+            self.lifecycle_manager = LifecycleManager(self.github_credentials, self.runner_image)
             logger.info(format_log('SUCCESS', 'Lifecycle Manager inicializado'))
+
+            # Operaciones masivas (vaciar pools, reciclar runners, cambiar labels)
+            self.bulk_operations = create_bulk_operations(self.lifecycle_manager)
             
             # Inicializar Config Validator
             self.config_validator = ConfigValidator()
@@ -91,6 +158,15 @@ class OrchestratorService:
             self.placeholder_resolver = PlaceholderResolver()
             logger.info(format_log('SUCCESS', 'Placeholder Resolver inicializado'))
             
+            # Cola de trabajo distribuida (WORK_QUEUE_URL): None ejecuta las tareas en el request
+            self.work_queue = create_work_queue()
+            self.worker_id = work_queue_worker_id()
+            if self.work_queue:
+                logger.info(format_log('SUCCESS', 'Cola de trabajo configurada', self.work_queue.client.description))
+            
+            # Métricas (sinks configurados desde variables de entorno)
+            logger.info(format_log('SUCCESS', 'Métricas inicializadas', f'{len(metrics.sinks)} sinks activos'))
+            
             logger.info(format_log('SUCCESS', 'Todos los componentes inicializados'))
             
         except Exception as e:
@@ -110,6 +186,10 @@ class OrchestratorService:
             for warning in validation_result["warnings"]:
                 logger.warning(format_log('WARNING', 'Advertencia', warning))
             
+            # Fallar al iniciar y no en el primer escalado si faltan permisos
+            validate_credentials_permissions(self.github_credentials)
+            validate_github_server(self.github_credentials)
+            
             logger.info(format_log('SUCCESS', 'Configuración validada'))
             
         except Exception as e:
@@ -126,6 +206,162 @@ class OrchestratorService:
                 self.lifecycle_manager.start_monitoring(self.runner_check_interval)
             else:
                 logger.info(format_log('INFO', 'Automatización desactivada - modo manual'))
+            
+            # Pools declarativos: reconciliar contra POOLS_SPEC_DIR o POOLS_GIT_REPO
+            self.pool_reconciler = None
+            if pools.spec_source:
+                self.pool_reconciler = PoolReconciler(
+                    self.lifecycle_manager,
+                    pools.spec_source,
+                    int(os.getenv("POOLS_RECONCILE_INTERVAL", "60")),
+                )
+                self.pool_reconciler.start()
+
+            # Runners que no aparecen online en GitHub a tiempo se recrean
+            registration_verifier = self.lifecycle_manager.registration_verifier
+            if registration_verifier:
+                registration_verifier.start()
+
+            # Contenedores y VMs atascados en estados terminales: eliminación escalada
+            if self.lifecycle_manager.stuck_reaper:
+                self.lifecycle_manager.stuck_reaper.start()
+
+            # Uso de disco de los workspaces y verificación de su limpieza tras destruir runners
+            if self.lifecycle_manager.workspace_monitor:
+                self.lifecycle_manager.workspace_monitor.start()
+
+            # Disco e inodos de los hosts: sin runners nuevos con presión, limpieza y desalojo
+            if self.lifecycle_manager.disk_pressure:
+                self.lifecycle_manager.disk_pressure.start()
+
+            # Hosts Docker remotos: comprobación continua de su salud y de sus runners
+            docker_hosts = self.lifecycle_manager.container_manager.docker_hosts
+            if docker_hosts:
+                docker_hosts.start()
+
+            # Tool cache compartido: se puebla y refresca en segundo plano
+            tool_cache = self.lifecycle_manager.container_manager.tool_cache
+            if tool_cache:
+                tool_cache.start()
+
+            # Pre-descarga de las imágenes de los pools en Docker, hosts SSH y nodos de Kubernetes
+            self.image_prepuller = create_image_prepuller(self.lifecycle_manager)
+            if self.image_prepuller:
+                self.image_prepuller.start()
+
+            # Construcción de imágenes de runners y despliegue por canario en los pools
+            self.image_builder = create_image_builder(self.lifecycle_manager)
+            if self.image_builder:
+                self.image_builder.start()
+
+            # Cambios blue/green: avanzar pasos, comparar fallos y retirar el conjunto antiguo
+            self.cutover_monitor = create_cutover_monitor(self.lifecycle_manager)
+            if self.cutover_monitor:
+                self.cutover_monitor.start()
+
+            # Pools de VMs precalentadas: reponer, suspender y reciclar instancias
+            self.warm_pool_refresher = create_warm_pool_refresher(self.lifecycle_manager)
+            if self.warm_pool_refresher:
+                self.warm_pool_refresher.start()
+
+            # Worker de la cola: cada réplica consume tareas de aprovisionamiento y destrucción
+            self.queue_worker = None
+            if self.work_queue:
+                self.queue_worker = WorkQueueWorker(
+                    self.work_queue,
+                    self.lifecycle_manager,
+                    self.worker_id,
+                    concurrency=int(os.getenv("WORK_QUEUE_CONCURRENCY", "2")),
+                    retry_base=int(os.getenv("WORK_QUEUE_RETRY_BASE", "10")),
+                )
+                self.queue_worker.start()
+
+            # Modo degradado: comprobar la vuelta de GitHub y crear entonces los runners pendientes
+            self.outage_probe = None
+            if github_outage.enabled:
+                github_outage.on_recovery(self._replay_intents)
+                self.outage_probe = OutageProbe(
+                    github_outage,
+                    self.lifecycle_manager.github,
+                    interval=int(os.getenv("GITHUB_DEGRADED_PROBE_INTERVAL", "30")),
+                )
+                self.outage_probe.start()
+
+            # Reconciliación continua: inventario, registros en GitHub y jobs contra lo declarado
+            self.drift_reconciler = create_drift_reconciler(self.lifecycle_manager, self.work_queue, self.worker_id)
+            if self.drift_reconciler:
+                self.drift_reconciler.start()
+
+            # Jobs encolados sin runner pasado el umbral: diagnóstico, incidente y remediación opcional
+            self.orphaned_job_detector = None
+            orphaned_threshold = int(os.getenv("ORPHANED_JOB_THRESHOLD", "600"))
+            if orphaned_threshold > 0:
+                self.orphaned_job_detector = OrphanedJobDetector(
+                    queued_jobs,
+                    self.lifecycle_manager,
+                    self._runner_alive,
+                    remediate=self._remediate_orphaned if os.getenv("ORPHANED_JOB_REMEDIATE", "false").lower() == "true" else None,
+                    threshold=orphaned_threshold,
+                    interval=int(os.getenv("ORPHANED_JOB_CHECK_INTERVAL", "60")),
+                )
+                self.orphaned_job_detector.start()
+
+            # Interrupciones spot/preemption: evacuar el host al recibir el aviso
+            self.preemption_watcher = None
+            preemption_sources = create_preemption_sources()
+            if preemption_sources:
+                self.preemption_watcher = PreemptionWatcher(
+                    preemption_sources,
+                    self.lifecycle_manager,
+                    interval=int(os.getenv("PREEMPTION_CHECK_INTERVAL", "5")),
+                    on_pause=self.queue_worker.stop if self.queue_worker else None,
+                    on_resume=self.queue_worker.start if self.queue_worker else None,
+                    requeue=self._requeue_interrupted if self.work_queue else None,
+                )
+                self.preemption_watcher.start()
+
+            # Inyección de caos (solo pruebas de resiliencia): muertes de runners al azar
+            if chaos:
+                chaos.start(self.lifecycle_manager)
+
+            # Incidentes en PagerDuty/Opsgenie para Docker inaccesible o labels sin runners
+            self.incident_monitor = None
+            if incidents.backend:
+                self.incident_monitor = IncidentMonitor(
+                    incidents,
+                    self.lifecycle_manager,
+                    required_labels=[label.strip() for label in os.getenv("INCIDENT_REQUIRED_LABELS", "").split(",") if label.strip()],
+                    interval=int(os.getenv("INCIDENT_CHECK_INTERVAL", "30")),
+                    grace=int(os.getenv("INCIDENT_NO_RUNNERS_GRACE", "300")),
+                    backend_failures=int(os.getenv("INCIDENT_BACKEND_FAILURES", "3")),
+                )
+                self.incident_monitor.start()
+
+            # Topes de gasto: proyección del mes, avisos y congelación del escalado
+            self.budget_monitor = None
+            if budgets:
+                self.budget_monitor = BudgetMonitor(budgets, int(os.getenv("BUDGET_CHECK_INTERVAL", "300")))
+                self.budget_monitor.start()
+
+            # Consumo muy por encima de la media reciente por tenant y pool
+            if cost_anomalies:
+                cost_anomalies.start(int(os.getenv("COST_ANOMALY_CHECK_INTERVAL", "900")))
+
+            # Previsión de demanda por hora de la semana y precalentado de los pools con "prewarm"
+            self.prewarm_scaler = None
+            if demand_forecast:
+                self.prewarm_scaler = PrewarmScaler(
+                    self.lifecycle_manager,
+                    demand_forecast,
+                    interval=int(os.getenv("FORECAST_CHECK_INTERVAL", "300")),
+                    lead=int(os.getenv("FORECAST_LEAD_MINUTES", "30")) * 60,
+                )
+                self.prewarm_scaler.start()
+
+            # Informe de uso del mes cerrado: entrega automática a S3 o por correo
+            self.usage_delivery = create_usage_delivery(usage_ledger)
+            if self.usage_delivery:
+                self.usage_delivery.start()
                 
         except Exception as e:
             logger.error(format_log('ERROR', 'Error configurando monitoreo', str(e)))
@@ -135,38 +371,155 @@ class OrchestratorService:
     
     async def create_runners(self, request: RunnerRequest) -> List[RunnerResponse]:
         """Crea múltiples runners efímeros."""
+        claimed = False
+        reserved = False
         try:
             runners = []
-            for i in range(request.count):
-                runner_name = request.runner_name
-                if request.count > 1:
-                    runner_name = f"{request.runner_name}-{i+1}" if request.runner_name else None
-                
-                runner_id = self.lifecycle_manager.create_runner(
-                    scope=request.scope,
-                    scope_name=request.scope_name,
-                    runner_name=runner_name,
-                    runner_group=request.runner_group,
-                    labels=request.labels,
-                    enable_dind=request.enable_dind,
-                )
-                
-                runners.append(
-                    RunnerResponse(
-                        runner_id=runner_id, 
-                        status="created", 
-                        message="Runner creado exitosamente"
+            names = [request.runner_name] * request.count
+            if request.count > 1:
+                names = [f"{request.runner_name}-{i+1}" if request.runner_name else None for i in range(request.count)]
+            # El pool se valida aquí para rechazar el request antes de encolar o crear nada
+            tenant = tenants.for_scope(request.scope, request.scope_name) if tenants else None
+            if tenants:
+                runner_pool = tenants.resolve_pool(tenant, self.lifecycle_manager.pools, request.pool)
+            else:
+                runner_pool = self.lifecycle_manager.pools.get(request.pool)
+            # La clase de recursos se resuelve con los labels del job (runs-on) antes de encolar
+            resource_class = resource_classes.select(runner_pool, request.job_labels or request.labels, request.resource_class)
+            sharding.check_request(request.scope_name)
+            dry_run = request.dry_run or self.lifecycle_manager.dry_run
+            if job_policies and not dry_run:
+                job_policies.check({
+                    "repo": request.scope_name if request.scope == "repo" else None,
+                    "pool": runner_pool,
+                    "labels": request.job_labels or request.labels,
+                    "workflow": request.workflow,
+                    "branch": request.head_branch,
+                    "run_id": request.run_id,
+                    "job_id": request.job_id,
+                }, self.lifecycle_manager.github)
+            # Tope de gasto congelado: se rechaza antes de encolar (create_runner vuelve a comprobarlo)
+            if budgets and not dry_run:
+                budgets.check(tenant["name"] if tenant else None, runner_pool, request.budget_override)
+            if request.job_id and not dry_run:
+                queued_jobs.record(request.job_id, request.scope_name, request.job_labels or [])
+
+            # Entrega de webhook repetida por GitHub (o reintento del gateway): su runner ya se pidió
+            if request.delivery_id and not dry_run:
+                if not deliveries.claim(request.delivery_id):
+                    logger.info(format_log('INFO', 'Entrega de webhook duplicada, no se crea runner', request.delivery_id))
+                    return [RunnerResponse(runner_id="", status="duplicate", message=f"Entrega {request.delivery_id} ya procesada")]
+                claimed = True
+
+            # Un runner por workflow_job: si el job ya tiene uno vivo (o en creación) no se crea otro
+            if request.job_id and not dry_run:
+                if request.count != 1:
+                    raise ValueError("job_id requiere count=1")
+                existing = job_runners.reserve(request.job_id, request.scope_name)
+                if existing is not None and existing != PENDING and not self._runner_alive(existing):
+                    # Su runner terminó sin llegar a atenderlo: se reserva para uno nuevo
+                    job_runners.release(request.job_id)
+                    existing = job_runners.reserve(request.job_id, request.scope_name)
+                if existing is not None:
+                    logger.info(format_log('INFO', 'Job con runner asignado, no se crea otro', f"job {request.job_id}: {existing}"))
+                    return [RunnerResponse(runner_id="" if existing == PENDING else existing, status="duplicate", message=f"Job {request.job_id} ya tiene runner")]
+                reserved = True
+
+            # Modo degradado sin cola de trabajo: la petición se guarda y se crea al volver GitHub
+            if github_outage.degraded and not self.work_queue and not dry_run:
+                key = request.job_id or request.delivery_id or str(uuid.uuid4())
+                if not github_outage.queue_intent(key, request):
+                    raise GitHubError("GitHub API no disponible y sin espacio para más peticiones pendientes")
+                # La reserva y la entrega se vuelven a tomar al crear el runner
+                if claimed:
+                    deliveries.release(request.delivery_id)
+                if reserved:
+                    job_runners.release(request.job_id)
+                logger.warning(format_log('WARNING', 'Modo degradado: petición pendiente', f"{request.scope_name} x{request.count}"))
+                return [
+                    RunnerResponse(runner_id="", status="queued", message="GitHub API no disponible: se creará al recuperarse")
+                    for _ in names
+                ]
+
+            if self.work_queue and not dry_run:
+                for runner_name in names:
+                    task_id = self.work_queue.enqueue("provision", {
+                        "scope": request.scope,
+                        "scope_name": request.scope_name,
+                        "runner_name": runner_name,
+                        "runner_group": request.runner_group,
+                        "labels": request.labels,
+                        "enable_dind": request.enable_dind,
+                        "pool": request.pool,
+                        "budget_override": request.budget_override,
+                        "resource_class": resource_class,
+                        # El worker asocia el runner creado con el job
+                        "job_id": request.job_id,
+                    })
+                    runners.append(RunnerResponse(runner_id=task_id, status="queued", message="Aprovisionamiento encolado"))
+            else:
+                # Creación en paralelo acotada por PROVISION_CONCURRENCY y el límite del backend del pool
+                futures = [
+                    provisioner.submit(
+                        runner_pool.name, runner_pool.backend, self.lifecycle_manager.create_runner,
+                        scope=request.scope,
+                        scope_name=request.scope_name,
+                        runner_name=runner_name,
+                        runner_group=request.runner_group,
+                        labels=request.labels,
+                        enable_dind=request.enable_dind,
+                        pool=request.pool,
+                        dry_run=request.dry_run,
+                        budget_override=request.budget_override,
+                        resource_class=resource_class,
                     )
-                )
+                    for runner_name in names
+                ]
+                results = await asyncio.gather(*(asyncio.wrap_future(future) for future in futures), return_exceptions=True)
+                errors = [result for result in results if isinstance(result, Exception)]
+                # Si no se creó ninguno, el error se propaga como antes; si fallan algunos, se informan por runner
+                if errors and len(errors) == len(results):
+                    raise errors[0]
+
+                if reserved and not errors:
+                    job_runners.assign(request.job_id, results[0])
+                for result in results:
+                    if isinstance(result, Exception):
+                        runners.append(RunnerResponse(runner_id="", status="failed", message=str(result)))
+                    elif dry_run:
+                        runners.append(RunnerResponse(runner_id=result, status="dry_run", message="Simulación: runner no creado"))
+                    else:
+                        runners.append(RunnerResponse(runner_id=result, status="created", message="Runner creado exitosamente"))
             
-            logger.info(f"Creados {len(runners)} runners para {request.scope}/{request.scope_name}")
+            created = sum(1 for runner in runners if runner.status != "failed")
+            logger.info(f"Creados {created} runners para {request.scope}/{request.scope_name}")
+            if not dry_run:
+                datadog.event(
+                    f"Escalado de {request.scope_name}: +{created} runners",
+                    f"Solicitados por la API en el pool {request.pool or 'default'}",
+                    aggregation_key=f"scale:{request.scope_name}",
+                    tags={"repo": request.scope_name, "pool": request.pool or "default", "decision": "scale_up", "trigger": "api"},
+                )
             return runners
             
         except ValueError as e:
+            if claimed:
+                deliveries.release(request.delivery_id)
+            if reserved:
+                job_runners.release(request.job_id)
+            self._note_job_error(request, e)
             raise
         except Exception as e:
+            if claimed:
+                deliveries.release(request.delivery_id)
+            if reserved:
+                job_runners.release(request.job_id)
+            self._note_job_error(request, e)
             logger.error(f"Error creando runners: {e}")
             raise
+        finally:
+            if reserved:
+                job_runners.settle(request.scope_name)
     
     async def get_runner_status(self, runner_id: str) -> RunnerStatus:
         """Obtiene el estado de un runner específico."""
@@ -178,10 +531,15 @@ class OrchestratorService:
             logger.error(f"Error obteniendo estado del runner {runner_id}: {e}")
             raise
     
-    async def destroy_runner(self, runner_id: str) -> Dict:
+    async def destroy_runner(self, runner_id: str, dry_run: bool = False) -> Dict:
         """Destruye un runner específico."""
         try:
-            success = self.lifecycle_manager.destroy_runner(runner_id)
+            owner = self._remote_owner(runner_id)
+            if owner and not dry_run:
+                self.work_queue.enqueue("destroy", {"runner_id": runner_id}, worker_id=owner)
+                return create_response(True, f"Destrucción de {runner_id} encolada en {owner}")
+
+            success = self.lifecycle_manager.destroy_runner(runner_id, dry_run=dry_run)
             
             if not success:
                 raise ValueError("Runner no encontrado o no se pudo destruir")
@@ -194,26 +552,587 @@ class OrchestratorService:
             logger.error(f"Error destruyendo runner {runner_id}: {e}")
             raise
     
-    async def list_runners(self) -> List[RunnerStatus]:
-        """Lista todos los runners activos."""
+    async def complete_job(self, job_id: str, runner_name: Optional[str] = None) -> Dict:
+        """
+        Job completado o cancelado: destruye el runner creado para él.
+
+        Si GitHub lo ejecutó en otro runner (cualquier runner libre con los mismos labels
+        puede tomarlo), el runner del job quedó libre y pasa a atender el job de aquel.
+        """
+        queued_jobs.finished(job_id)
+        runner_id = job_runners.complete(job_id)
+        if not runner_id:
+            return create_response(True, f"Job {job_id} sin runner asociado", {"action": "untracked"})
+
+        if runner_name and runner_name != runner_id:
+            other_job = job_runners.reassign(runner_name, runner_id)
+            if other_job:
+                logger.info(format_log('INFO', 'Runner reasignado', f"{runner_id} atiende ahora el job {other_job}"))
+                return create_response(True, f"Runner {runner_id} reasignado al job {other_job}", {
+                    "action": "reassigned", "runner_id": runner_id, "job_id": other_job,
+                })
+
+        if not self._runner_alive(runner_id):
+            return create_response(True, f"Runner {runner_id} ya terminado", {"action": "gone", "runner_id": runner_id})
+        try:
+            await self.destroy_runner(runner_id)
+        except ValueError:
+            # Runner efímero que terminó mientras tanto
+            return create_response(True, f"Runner {runner_id} ya terminado", {"action": "gone", "runner_id": runner_id})
+        job_runners.torn_down()
+        logger.info(format_log('INFO', 'Runner del job destruido', f"job {job_id}: {runner_id}"))
+        return create_response(True, f"Runner {runner_id} del job {job_id} destruido", {"action": "torn_down", "runner_id": runner_id})
+
+    def job_started(self, job_id: str, runner_name: Optional[str] = None) -> Dict:
+        """GitHub asignó el job a un runner: deja de estar en cola."""
+        queued_jobs.finished(job_id)
+        return create_response(True, f"Job {job_id} en ejecución", {"job_id": job_id, "runner_name": runner_name})
+
+    def orphaned_jobs(self) -> Dict:
+        """Jobs en cola más allá del umbral sin runner que los atienda, con su diagnóstico."""
+        detector = getattr(self, 'orphaned_job_detector', None)
+        if not detector:
+            return create_response(True, "Detector de jobs huérfanos desactivado", {"enabled": False})
+        jobs = detector.orphaned()
+        return create_response(True, f"{len(jobs)} jobs huérfanos", {
+            "enabled": True, **detector.status(), "queued": len(queued_jobs.queued()), "jobs": jobs,
+        })
+
+    def _remediate_orphaned(self, job_id: str, job: Dict, pool) -> None:
+        """Runner de mejor esfuerzo para un job huérfano: el pool que cubre sus labels o el default con ellos."""
+        # El runner anterior (perdido u ocioso) deja de contar como el del job
+        job_runners.complete(job_id)
+        request = RunnerRequest(
+            scope="repo",
+            scope_name=job["repo"],
+            labels=custom_labels(job["labels"]) or None,
+            pool=pool.name if pool else None,
+            job_id=job_id,
+            job_labels=job["labels"],
+        )
+        try:
+            asyncio.run(self.create_runners(request))
+            logger.info(format_log('INFO', 'Runner de mejor esfuerzo para job huérfano', f"job {job_id} ({job['reason']})"))
+        except Exception as e:
+            logger.error(format_log('ERROR', 'No se pudo crear runner para job huérfano', f"job {job_id}: {e}"))
+
+    def _note_job_error(self, request: RunnerRequest, error: Exception):
+        """Guarda el error de creación como diagnóstico del job, si la petición venía de uno."""
+        if not request.job_id or request.dry_run:
+            return
+        try:
+            queued_jobs.note_error(request.job_id, str(error))
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudo registrar el error del job', str(e)))
+
+    def _replay_intents(self):
+        """Crea los runners pedidos durante el modo degradado."""
+        intents = github_outage.take_intents()
+        for request in intents:
+            try:
+                asyncio.run(self.create_runners(request))
+            except Exception as e:
+                logger.error(format_log('ERROR', 'No se pudo crear un runner pendiente', f"{request.scope_name}: {e}"))
+        if intents:
+            logger.info(format_log('SUCCESS', 'Peticiones pendientes procesadas', str(len(intents))))
+
+    def _runner_alive(self, runner_id: str) -> bool:
+        """El runner sigue en esta réplica o, con cola de trabajo, en otra."""
+        manager = self.lifecycle_manager
+        if runner_id in manager.active_runners or manager.container_manager.get_container_by_name(runner_id):
+            return True
+        try:
+            return bool(self.work_queue and self.work_queue.owner(runner_id))
+        except Exception:
+            # Sin Redis no se puede comprobar: se da por vivo para no duplicar runners
+            return True
+
+    def _remote_owner(self, runner_id: str) -> Optional[str]:
+        """Réplica que creó el runner si no es esta (solo con cola de trabajo)."""
+        if not self.work_queue:
+            return None
+        manager = self.lifecycle_manager
+        if runner_id in manager.active_runners or manager.container_manager.get_container_by_name(runner_id):
+            return None
+        owner = self.work_queue.owner(runner_id)
+        return owner if owner and owner != self.worker_id else None
+
+    def _requeue_interrupted(self, labels: Dict[str, str]) -> bool:
+        """Encola en la cola compartida un runner que reemplaza a uno interrumpido."""
+        if not labels.get("scope") or not labels.get("scope_name"):
+            return False
+        self.work_queue.enqueue("provision", {
+            "scope": labels["scope"],
+            "scope_name": labels["scope_name"],
+            "pool": labels.get("runner-pool"),
+            "resource_class": labels.get("resource-class"),
+        })
+        return True
+
+    def queue_status(self) -> Dict:
+        """Estado de la cola de trabajo distribuida."""
+        if not self.work_queue:
+            return create_response(True, "Cola de trabajo desactivada", {"enabled": False})
+        return create_response(True, "Estado de la cola", {"enabled": True, "worker_id": self.worker_id, **self.work_queue.stats()})
+
+    async def list_runners(self, tenant: Optional[str] = None) -> List[RunnerStatus]:
+        """Lista todos los runners activos (o solo los de un tenant)."""
         try:
             runners = self.lifecycle_manager.list_active_runners()
+            if tenant:
+                runners = [runner for runner in runners if (runner.get("labels") or {}).get("tenant") == tenant]
             return [RunnerStatus(**runner) for runner in runners]
             
         except Exception as e:
             logger.error(f"Error listando runners: {e}")
             raise
     
-    async def cleanup_runners(self) -> Dict:
+    async def cleanup_runners(self, dry_run: bool = False) -> Dict:
         """Limpia runners inactivos."""
         try:
-            cleaned = self.lifecycle_manager.cleanup_inactive_runners()
+            cleaned = self.lifecycle_manager.cleanup_inactive_runners(dry_run=dry_run)
+            if dry_run or self.lifecycle_manager.dry_run:
+                return create_response(True, f"Simulación: se limpiarían {cleaned} runners", {"cleaned_count": cleaned, "dry_run": True})
             return create_response(True, f"Limpiados {cleaned} runners", {"cleaned_count": cleaned})
             
         except Exception as e:
             logger.error(f"Error en limpieza: {e}")
             raise
     
+    async def list_pools(self) -> Dict:
+        """Lista los pools de runners configurados."""
+        return create_response(True, "Pools obtenidos", self.lifecycle_manager.pools.list())
+
+    @staticmethod
+    def _require_pool_archive():
+        if not pool_archive:
+            raise ValueError("Archivo de pools desactivado (definir POOL_ARCHIVE_FILE)")
+        return pool_archive
+
+    def _pool_runner_count(self, name: str) -> int:
+        return sum(
+            1 for container in list(self.lifecycle_manager.active_runners.values())
+            if (getattr(container, "labels", None) or {}).get("runner-pool", pools.DEFAULT_POOL) == name
+        )
+
+    def retire_pool(self, name: str, request: PoolRetireRequest) -> Dict:
+        """Retira un pool: deja de aceptar runners y conserva su definición e historial."""
+        archive = self._require_pool_archive()
+        manager = self.lifecycle_manager
+        with manager.runner_lock:
+            pool = manager.pools.get(name)
+            entry = archive.retire(pool, request.reason, request.retired_by, request.snapshot_id)
+            manager.pools.retired[name] = manager.pools.pools.pop(name)
+        # Los runners que ya corren en el pool terminan sus jobs
+        return create_response(True, f"Pool {name} retirado", {**entry, "active_runners": self._pool_runner_count(name)})
+
+    def restore_pool(self, name: str, restored_by: str = "") -> Dict:
+        """Vuelve a aceptar runners en un pool retirado."""
+        archive = self._require_pool_archive()
+        registry = self.lifecycle_manager.pools
+        with self.lifecycle_manager.runner_lock:
+            if name not in registry.retired:
+                raise ValueError(f"El pool {name} no está retirado")
+            entry = archive.unretire(name, restored_by, retained=name in registry.retained)
+            registry.pools[name] = registry.retired.pop(name)
+            registry.retained.discard(name)
+        return create_response(True, f"Pool {name} restaurado", entry)
+
+    def list_pool_snapshots(self, pool: Optional[str] = None) -> Dict:
+        snapshots = self._require_pool_archive().list_snapshots(pool)
+        return create_response(True, f"{len(snapshots)} snapshots de pools", snapshots)
+
+    def create_pool_snapshot(self, name: str, request: PoolSnapshotRequest) -> Dict:
+        """Guarda la definición actual de un pool (activo o retirado)."""
+        archive = self._require_pool_archive()
+        registry = self.lifecycle_manager.pools
+        pool = registry.pools.get(name) or registry.retired.get(name)
+        if not pool:
+            raise ValueError(f"Pool no encontrado: {name}")
+        snapshot = archive.snapshot(pool, request.note, request.created_by, request.id)
+        return create_response(True, f"Snapshot de {name} guardado", snapshot)
+
+    def restore_pool_snapshot(self, snapshot_id: str, request: PoolRestoreRequest) -> Dict:
+        """Crea un pool desde un snapshot, con su nombre original o clonado con otro."""
+        archive = self._require_pool_archive()
+        with self.lifecycle_manager.runner_lock:
+            pool = archive.restore(snapshot_id, self.lifecycle_manager.pools, request.name, request.created_by)
+        return create_response(True, f"Pool {pool.name} creado desde el snapshot {snapshot_id}", pool.to_dict())
+
+    def submit_bulk_operation(self, request: BulkOperationRequest) -> Dict:
+        """Lanza una operación masiva en segundo plano y devuelve su id para consultarla."""
+        params = {"pools": request.pools, "dry_run": request.dry_run}
+        if request.kind == "drain_pools":
+            params.update({"retire": request.retire, "reason": request.reason})
+        elif request.kind == "recycle_runners":
+            params["older_than"] = request.older_than
+        elif request.kind == "retag_pools":
+            params.update({"add_labels": request.add_labels, "remove_labels": request.remove_labels})
+        operation = self.bulk_operations.submit(request.kind, params, request.submitted_by, request.id)
+        return create_response(True, f"Operación {operation['id']} enviada: {operation['progress']['total']} ítems", operation)
+
+    def list_bulk_operations(self, status: Optional[str] = None) -> Dict:
+        operations = self.bulk_operations.list(status)
+        return create_response(True, f"{len(operations)} operaciones masivas", operations)
+
+    def get_bulk_operation(self, operation_id: str, items: bool = False) -> Dict:
+        """Estado y progreso de una operación masiva (con items, el resultado de cada ítem)."""
+        operation = self.bulk_operations.get(operation_id, items=items)
+        return create_response(True, f"Operación {operation_id}: {operation['status']}", operation)
+
+    def _require_image_builder(self):
+        if not getattr(self, 'image_builder', None):
+            raise ValueError("Construcción de imágenes desactivada (definir IMAGE_BUILDER_STATE_FILE)")
+        return self.image_builder
+
+    def submit_image_build(self, request: ImageBuildRequest) -> Dict:
+        """Lanza una construcción de imagen en segundo plano y devuelve su id para consultarla."""
+        build = self._require_image_builder().submit(
+            request.name, request.requested_by, rollout=request.rollout, pools=request.pools, build_id=request.id,
+        )
+        return create_response(True, f"Construcción {build['id']} enviada", build)
+
+    def list_image_builds(self, name: Optional[str] = None) -> Dict:
+        builds = self._require_image_builder().rollouts.list_builds(name)
+        return create_response(True, f"{len(builds)} construcciones de imagen", builds)
+
+    def get_image_build(self, build_id: str) -> Dict:
+        """Construcción con su Dockerfile, digests y el final del log de buildx."""
+        build = self._require_image_builder().rollouts.get_build(build_id)
+        return create_response(True, f"Construcción {build_id}: {build['status']}", build)
+
+    def list_image_rollouts(self, pool: Optional[str] = None) -> Dict:
+        rollouts = self._require_image_builder().rollouts.list_rollouts(pool)
+        return create_response(True, f"{len(rollouts)} despliegues de imagen", rollouts)
+
+    def start_image_rollout(self, request: ImageRolloutRequest) -> Dict:
+        """Despliega por pasos en un pool la imagen de una construcción terminada."""
+        rollout = self._require_image_builder().start_rollout(request.pool, request.build, request.started_by)
+        return create_response(True, f"Despliegue en {request.pool} iniciado al {rollout['weight']}%", rollout)
+
+    def rollback_image_rollout(self, pool: str, request: ImageRollbackRequest) -> Dict:
+        """Revierte el despliegue de imagen de un pool (en curso o completado)."""
+        rollout = self._require_image_builder().rollouts.rollback(
+            pool, self.lifecycle_manager.pools, request.reason, request.requested_by,
+        )
+        return create_response(True, f"Despliegue en {pool} revertido a {rollout['previous']}", rollout)
+
+    @staticmethod
+    def _require_fleet_cutovers():
+        if not fleet_cutovers:
+            raise ValueError("Cambios blue/green desactivados (definir FLEET_CUTOVER_STATE_FILE y POOL_ARCHIVE_FILE)")
+        return fleet_cutovers
+
+    def list_cutovers(self, status: Optional[str] = None) -> Dict:
+        cutovers = self._require_fleet_cutovers().list(status)
+        return create_response(True, f"{len(cutovers)} cambios blue/green", cutovers)
+
+    def get_cutover(self, cutover_id: str) -> Dict:
+        cutover = self._require_fleet_cutovers().get(cutover_id)
+        return create_response(True, f"Cambio {cutover_id}: {cutover['status']}", cutover)
+
+    def start_cutover(self, request: FleetCutoverRequest) -> Dict:
+        """Crea los pools verdes de un conjunto de pools y empieza a enviarles runners."""
+        cutover = self._require_fleet_cutovers().start(
+            self.lifecycle_manager, request.pools, request.changes, request.suffix, request.policy, request.started_by,
+        )
+        greens = ", ".join(pair["green"] for pair in cutover["pools"])
+        return create_response(True, f"Cambio blue/green iniciado al {cutover['weight']}%: {greens}", cutover)
+
+    def rollback_cutover(self, cutover_id: str, request: FleetCutoverRollbackRequest) -> Dict:
+        """Revierte un cambio blue/green: los pools azules vuelven a recibir todos los runners."""
+        cutover = self._require_fleet_cutovers().rollback(cutover_id, self.lifecycle_manager, request.reason, request.requested_by)
+        return create_response(True, f"Cambio {cutover_id} revertido", cutover)
+
+    def list_resource_classes(self) -> Dict:
+        """Clases de recursos con su tamaño en cada backend y el label que las selecciona."""
+        classes = resource_classes.list()
+        return create_response(True, f"{len(classes)} clases de recursos", classes)
+
+    def list_regions(self) -> Dict:
+        """Regiones de los pools multi-región con su preferencia, enfriamiento y runners creados."""
+        regions = region_failover.status(list(self.lifecycle_manager.pools.pools.values()))
+        return create_response(True, f"{len(regions)} regiones", regions)
+
+    def _require_docker_hosts(self):
+        docker_hosts = self.lifecycle_manager.container_manager.docker_hosts
+        if not docker_hosts:
+            raise ValueError("Varios hosts Docker desactivado (definir DOCKER_HOSTS_FILE)")
+        return docker_hosts
+
+    def list_docker_hosts(self) -> Dict:
+        """Hosts Docker con su capacidad, runners, salud, vaciado y presión de disco."""
+        hosts = self._require_docker_hosts().status()
+        return create_response(True, f"{len(hosts)} hosts Docker", hosts)
+
+    def drain_docker_host(self, name: str, request: DockerHostDrainRequest) -> Dict:
+        """Deja un host sin runners nuevos para mantenimiento y destruye sus runners libres."""
+        docker_hosts = self._require_docker_hosts()
+        host = docker_hosts.drain(name, request.reason, request.requested_by)
+        manager = self.lifecycle_manager
+        runners = [runner_id for runner_id, container in list(manager.active_runners.items()) if docker_hosts.host_of(container) is host]
+        destroyed = []
+        if request.evict_idle:
+            busy = self.bulk_operations.busy(runners)
+            destroyed = [runner_id for runner_id in runners if not busy.get(runner_id, True) and manager.destroy_runner(runner_id)]
+        remaining = [runner_id for runner_id in runners if runner_id not in destroyed]
+        return create_response(
+            True,
+            f"Host Docker {name} vaciado: {len(destroyed)} runners libres destruidos, {len(remaining)} siguen en él",
+            {**docker_hosts.to_dict(host), "destroyed": destroyed, "remaining": remaining},
+        )
+
+    def undrain_docker_host(self, name: str, request: DockerHostDrainRequest) -> Dict:
+        docker_hosts = self._require_docker_hosts()
+        host = docker_hosts.undrain(name, request.requested_by)
+        return create_response(True, f"Host Docker {name} vuelve a recibir runners", docker_hosts.to_dict(host))
+
+    def reload_configuration(self) -> Dict:
+        """Recarga la definición de pools en caliente."""
+        changes = self.lifecycle_manager.reload_pools()
+        try:
+            changes["flags"] = feature_flags.reload()
+        except Exception as e:
+            logger.error(format_log('ERROR', 'Recarga de feature flags rechazada, se mantienen las anteriores', str(e)))
+            raise
+        if job_policies:
+            try:
+                changes["policies"] = job_policies.reload()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Recarga de políticas de jobs rechazada, se mantienen las anteriores', str(e)))
+                raise
+        return create_response(True, "Configuración recargada", changes)
+
+    def list_feature_flags(self, scope_name: Optional[str] = None) -> Dict:
+        """Feature flags con su definición y evaluación (global o para scope_name)."""
+        return create_response(
+            True, "Feature flags obtenidas",
+            {"environment": feature_flags.environment, "flags": feature_flags.describe(scope_name)},
+        )
+
+    def get_forecast(self, pool: Optional[str] = None) -> Dict:
+        """Demanda prevista por pool y hora de la semana, con la última decisión de precalentado."""
+        if not demand_forecast:
+            raise ValueError("Previsión de capacidad desactivada (FORECAST_ENABLED=false)")
+        if pool and pool not in self.lifecycle_manager.pools.pools:
+            raise ValueError(f"Pool desconocido: {pool}")
+        demand_forecast.refresh_if_stale()
+        prewarm = self.prewarm_scaler.status() if getattr(self, 'prewarm_scaler', None) else {}
+        pools_forecast = demand_forecast.describe(pool)
+        for entry in pools_forecast:
+            runner_pool = self.lifecycle_manager.pools.pools.get(entry["pool"])
+            entry["prewarm"] = runner_pool.prewarm if runner_pool else None
+            entry["last_scale"] = prewarm.get(entry["pool"])
+        return create_response(True, f"Previsión de {len(pools_forecast)} pools", {
+            "timezone": demand_forecast.timezone,
+            "weeks": demand_forecast.weeks,
+            "headroom": demand_forecast.headroom,
+            "computed_at": demand_forecast.computed_at,
+            "pools": pools_forecast,
+        })
+
+    def list_policies(self) -> Dict:
+        """Reglas de rechazo de jobs con las coincidencias desde el arranque."""
+        if not job_policies:
+            return create_response(True, "Políticas de jobs desactivadas", {"enabled": False, "rules": []})
+        return create_response(
+            True, "Políticas de jobs obtenidas",
+            {"enabled": True, "fail_closed": job_policies.fail_closed, "rules": job_policies.describe()},
+        )
+
+    def pool_drift(self) -> Dict:
+        """Estado de la reconciliación GitOps y runners fuera de la spec."""
+        if not self.pool_reconciler:
+            return create_response(True, "Reconciliación GitOps desactivada", {"enabled": False})
+        status = {"enabled": True, **self.pool_reconciler.status()}
+        message = "Pools sincronizados" if status["in_sync"] else "Pools con drift"
+        return create_response(True, message, status)
+
+    def reconcile_status(self) -> Dict:
+        """Drift de la última reconciliación por recurso, con motivo, acción y resultado."""
+        if not self.drift_reconciler:
+            return create_response(True, "Reconciliación de runners desactivada", {"enabled": False})
+        status = {"enabled": True, **self.drift_reconciler.status()}
+        return create_response(True, "Runners sincronizados" if status["in_sync"] else "Runners con drift", status)
+
+    def reconcile(self, dry_run: Optional[bool] = None) -> Dict:
+        """Ejecuta una reconciliación ahora (dry_run solo detecta el drift)."""
+        if not self.drift_reconciler:
+            raise ValueError("Reconciliación de runners desactivada (RECONCILE_ENABLED=false)")
+        status = {"enabled": True, **self.drift_reconciler.reconcile(dry_run=dry_run)}
+        return create_response(True, "Runners sincronizados" if status["in_sync"] else "Runners con drift", status)
+
+    def export_state(self) -> Dict:
+        """Snapshot versionado de pools y runners en seguimiento."""
+        return create_response(True, "Estado exportado", export_state(self.lifecycle_manager, __version__))
+
+    def import_state(self, snapshot: Dict, dry_run: bool = False, apply_pools: bool = False) -> Dict:
+        """Adopta los runners del snapshot que existen en este host y, opcionalmente, sus pools."""
+        result = import_state(self.lifecycle_manager, snapshot, dry_run=dry_run, apply_pools=apply_pools)
+        return create_response(True, "Estado importado", result)
+
+    @staticmethod
+    def _require_tenants():
+        if not tenants:
+            raise ValueError("Tenants desactivados (definir TENANTS_FILE)")
+        return tenants
+
+    def _tenant_view(self, tenant: Dict) -> Dict:
+        """Tenant con su uso actual frente a la cuota."""
+        return {
+            **tenant,
+            "usage": {
+                "active_runners": self.lifecycle_manager.tenant_runner_count(tenant["name"]),
+                "max_runners": tenant["quotas"].get("max_runners", 0),
+            },
+        }
+
+    def list_tenants(self) -> Dict:
+        registry = self._require_tenants()
+        return create_response(True, "Tenants obtenidos", [self._tenant_view(tenant) for tenant in registry.list()])
+
+    def get_tenant(self, name: str) -> Dict:
+        tenant = self._require_tenants().get(name)
+        if not tenant:
+            raise ValueError(f"Tenant {name} no encontrado")
+        return create_response(True, "Tenant obtenido", self._tenant_view(tenant))
+
+    def onboard_tenant(self, request: TenantRequest) -> Dict:
+        """Alta de un tenant; sus pools quedan disponibles sin recargar la configuración."""
+        manager = self.lifecycle_manager
+        tenant = self._require_tenants().onboard(
+            request.name, request.owners, manager.credentials, manager.github,
+            kind=request.kind, enterprise=request.enterprise, pools=request.pools,
+            max_runners=request.max_runners, webhook=request.webhook, created_by=request.created_by,
+        )
+        with manager.runner_lock:
+            tenants.merge_pools(manager.pools)
+        return create_response(True, f"Tenant {request.name} dado de alta", self._tenant_view(tenant))
+
+    def offboard_tenant(self, name: str) -> Dict:
+        """Baja de un tenant sin runners activos: elimina sus webhooks y pools."""
+        manager = self.lifecycle_manager
+        registry = self._require_tenants()
+        active = manager.tenant_runner_count(name)
+        if active:
+            raise ValidationError(f"El tenant {name} tiene {active} runners activos; destrúyelos antes de la baja")
+        result = registry.offboard(name, manager.github)
+        with manager.runner_lock:
+            for pool in result["pools_removed"]:
+                manager.pools.pools.pop(pool, None)
+        return create_response(True, f"Tenant {name} dado de baja", result)
+
+    @staticmethod
+    def _require_budgets():
+        if not budgets:
+            raise ValueError("Topes de gasto desactivados (definir BUDGETS_FILE y USAGE_DB_PATH)")
+        return budgets
+
+    def list_budgets(self) -> Dict:
+        """Topes con gasto y proyección del mes; los de pools llevan el tenant dueño del pool."""
+        pools = self.lifecycle_manager.pools.pools
+        entries = self._require_budgets().status()
+        for entry in entries:
+            pool = pools.get(entry["name"]) if entry["kind"] == "pool" else None
+            entry["tenant"] = entry["name"] if entry["kind"] == "tenant" else (pool.tenant if pool else None)
+            entry["priority"] = bool(pool and pool.priority)
+        return create_response(True, "Topes de gasto obtenidos", entries)
+
+    def set_budget(self, kind: str, name: str, request: BudgetRequest) -> Dict:
+        registry = self._require_budgets()
+        if kind == "pool" and name not in self.lifecycle_manager.pools.pools:
+            raise ValueError(f"Pool {name} no encontrado")
+        if kind == "tenant" and not (tenants and tenants.get(name)):
+            raise ValueError(f"Tenant {name} no encontrado")
+        budget = registry.set(kind, name, request.monthly, request.updated_by)
+        return create_response(True, f"Tope de {kind} {name} fijado", budget)
+
+    def remove_budget(self, kind: str, name: str) -> Dict:
+        if not self._require_budgets().remove(kind, name):
+            raise ValueError(f"Sin tope para {kind} {name}")
+        return create_response(True, f"Tope de {kind} {name} eliminado", {"kind": kind, "name": name})
+
+    def create_budget_override(self, request: BudgetOverrideRequest) -> Dict:
+        """Token de excepción; solo se devuelve en esta respuesta."""
+        override = self._require_budgets().create_override(
+            request.kind, request.name, request.hours, request.reason, request.created_by,
+            blanket=request.blanket, token=request.token, override_id=request.id,
+        )
+        return create_response(True, "Excepción de tope de gasto creada", override)
+
+    def revoke_budget_override(self, override_id: str) -> Dict:
+        if not self._require_budgets().revoke_override(override_id):
+            raise ValueError(f"Excepción {override_id} no encontrada")
+        return create_response(True, "Excepción revocada", {"id": override_id})
+
+    def usage_report(self, month: Optional[str] = None, tenant: Optional[str] = None) -> Dict:
+        """Informe de uso del mes (por defecto el anterior) por tenant y pool con su coste estimado."""
+        if not usage_ledger:
+            raise ValueError("Registro de uso desactivado (definir USAGE_DB_PATH)")
+        report = usage_ledger.report(month or previous_month(), tenant)
+        return create_response(True, f"Informe de uso de {report['month']}", report)
+
+    def list_cost_anomalies(self) -> Dict:
+        """Anomalías de gasto abiertas y las últimas cerradas."""
+        if not cost_anomalies:
+            raise ValueError("Detección de anomalías de gasto desactivada (COST_ANOMALY_ENABLED=false)")
+        status = cost_anomalies.status()
+        return create_response(True, f"{len(status['active'])} anomalías de gasto abiertas", status)
+
+    def list_outbound_webhooks(self) -> Dict:
+        """Webhooks salientes registrados (sin sus secretos)."""
+        return create_response(True, "Webhooks salientes obtenidos", outbound_webhooks.list_webhooks())
+
+    def register_outbound_webhook(self, url: str, events: List[str], description: str = "", secret: Optional[str] = None) -> Dict:
+        """Registra un webhook saliente; la respuesta incluye el secreto de firma."""
+        webhook = outbound_webhooks.register(url, events, description, secret)
+        return create_response(True, "Webhook saliente registrado", webhook)
+
+    def remove_outbound_webhook(self, webhook_id: str) -> Dict:
+        if not outbound_webhooks.remove(webhook_id):
+            raise ValueError(f"Webhook saliente {webhook_id} no encontrado")
+        return create_response(True, "Webhook saliente eliminado", {"id": webhook_id})
+
+    def outbound_webhook_deliveries(self, webhook_id: str) -> Dict:
+        """Historial de entregas de un webhook saliente."""
+        deliveries = outbound_webhooks.delivery_log(webhook_id)
+        if deliveries is None:
+            raise ValueError(f"Webhook saliente {webhook_id} no encontrado")
+        return create_response(True, "Entregas obtenidas", deliveries)
+
+    def ping_outbound_webhook(self, webhook_id: str) -> Dict:
+        delivery = outbound_webhooks.ping(webhook_id)
+        if delivery is None:
+            raise ValueError(f"Webhook saliente {webhook_id} no encontrado")
+        return create_response(True, "Ping encolado", delivery)
+
+    def relay_event(self, event: Dict) -> Dict:
+        """Entrega a los webhooks salientes (y al registro de uso) un evento publicado por el API Gateway (job.*)."""
+        if not isinstance(event.get("type"), str) or not event.get("id"):
+            raise ValidationError("El evento requiere 'id' y 'type'")
+        outbound_webhooks.publish(event)
+        if usage_ledger:
+            try:
+                usage_ledger.publish(event)
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo registrar el uso del evento', f"{event['type']}: {e}"))
+        return create_response(True, "Evento recibido", {"id": event["id"]})
+
+    def run_diagnostics(self) -> Dict:
+        """Verifica credenciales de GitHub, reloj y los backends de los pools (Docker e imágenes, SSH, ECS, Azure, GCE)."""
+        manager = self.lifecycle_manager
+        report = Diagnostics(
+            credentials=self.github_credentials,
+            docker_client=manager.container_manager.client,
+            pools=manager.pools,
+            default_image=self.runner_image,
+            api_base=manager.github.api_base,
+            max_clock_skew=int(os.getenv("DOCTOR_MAX_CLOCK_SKEW", "30")),
+            backends=manager.container_manager.backends,
+        ).run()
+        message = "Diagnóstico sin fallos" if report["ok"] else "Diagnóstico con fallos"
+        return create_response(True, message, report)
+
     async def debug_runner_environment(self, runner_name: str) -> Dict:
         """Debug de variables de entorno de un runner."""
         env_vars = self.lifecycle_manager.debug_runner_environment(runner_name)
@@ -292,6 +1211,7 @@ class OrchestratorService:
     
     async def health_check(self) -> Dict:
         """Health check básico del servicio."""
+        backends = self.lifecycle_manager.container_manager.backends
         return create_response(
             True,
             "Servicio saludable",
@@ -299,6 +1219,37 @@ class OrchestratorService:
                 "service": "orchestrator",
                 "active_runners": len(self.lifecycle_manager.active_runners),
                 "monitoring": self.lifecycle_manager.monitoring,
+                "github_rate_limit": rate_limits.summary(),
+                "github_etag_cache": conditional_cache.summary(),
+                "github_graphql": self.lifecycle_manager.queued_runs.status() if self.lifecycle_manager.queued_runs else None,
+                "provisioning": provisioner.status(),
+                "shard": sharding.status(),
+                "webhook_deliveries": deliveries.status(),
+                "job_runners": job_runners.status(),
+                "github_outage": github_outage.status(),
+                "retries": retry_budgets.status(),
+                "events": lifecycle_events.status(),
+                "chaos": chaos.status() if chaos else None,
+                "reconcile": {
+                    "in_sync": self.drift_reconciler.status()["in_sync"],
+                    "drift": len(self.drift_reconciler.drift),
+                } if getattr(self, 'drift_reconciler', None) else None,
+                "registration": {
+                    **self.lifecycle_manager.registration_pacer.status(),
+                    "verify": self.lifecycle_manager.registration_verifier.status() if self.lifecycle_manager.registration_verifier else None,
+                },
+                "stuck_runners": self.lifecycle_manager.stuck_reaper.status() if self.lifecycle_manager.stuck_reaper else None,
+                "workspaces": self.lifecycle_manager.workspace_monitor.status() if self.lifecycle_manager.workspace_monitor else None,
+                "disk_pressure": self.lifecycle_manager.disk_pressure.status() if self.lifecycle_manager.disk_pressure else None,
+                "orphaned_jobs": self.orphaned_job_detector.status() if getattr(self, 'orphaned_job_detector', None) else None,
+                "image_prepull": self.image_prepuller.status() if getattr(self, 'image_prepuller', None) else None,
+                "image_builder": self.image_builder.status() if getattr(self, 'image_builder', None) else None,
+                "cutovers": fleet_cutovers.status() if fleet_cutovers else None,
+                "warm_pools": self.warm_pool_refresher.status() if getattr(self, 'warm_pool_refresher', None) else None,
+                "preemption": self.preemption_watcher.status() if getattr(self, 'preemption_watcher', None) else None,
+                "incidents": [incident["key"] for incident in incidents.list_open()],
+                "docker_hosts": self.lifecycle_manager.container_manager.docker_hosts.status() if self.lifecycle_manager.container_manager.docker_hosts else None,
+                "backends": {name: backend.status() for name, backend in backends.items()},
             },
         )
     
@@ -330,6 +1281,53 @@ class OrchestratorService:
     
     def stop_monitoring(self):
         """Detiene el monitoreo automático."""
+        if getattr(self, 'pool_reconciler', None):
+            self.pool_reconciler.stop()
+        if getattr(self, 'drift_reconciler', None):
+            self.drift_reconciler.stop()
+        if getattr(self, 'outage_probe', None):
+            self.outage_probe.stop()
+        if getattr(self, 'orphaned_job_detector', None):
+            self.orphaned_job_detector.stop()
+        if getattr(self, 'preemption_watcher', None):
+            self.preemption_watcher.stop()
+        if getattr(self, 'incident_monitor', None):
+            self.incident_monitor.stop()
+        if getattr(self, 'usage_delivery', None):
+            self.usage_delivery.stop()
+        if getattr(self, 'budget_monitor', None):
+            self.budget_monitor.stop()
+        if getattr(self, 'prewarm_scaler', None):
+            self.prewarm_scaler.stop()
+        if getattr(self, 'bulk_operations', None):
+            self.bulk_operations.stop()
+        if cost_anomalies:
+            cost_anomalies.stop()
+        if chaos:
+            chaos.stop()
+        if getattr(self, 'queue_worker', None):
+            self.queue_worker.stop()
+        if getattr(self, 'image_prepuller', None):
+            self.image_prepuller.stop()
+        if getattr(self, 'image_builder', None):
+            self.image_builder.stop()
+        if getattr(self, 'cutover_monitor', None):
+            self.cutover_monitor.stop()
+        if getattr(self, 'warm_pool_refresher', None):
+            self.warm_pool_refresher.stop()
+        if getattr(self.lifecycle_manager, 'stuck_reaper', None):
+            self.lifecycle_manager.stuck_reaper.stop()
+        if getattr(self.lifecycle_manager, 'workspace_monitor', None):
+            self.lifecycle_manager.workspace_monitor.stop()
+        if getattr(self.lifecycle_manager, 'disk_pressure', None):
+            self.lifecycle_manager.disk_pressure.stop()
+        if getattr(self.lifecycle_manager, 'container_manager', None) and self.lifecycle_manager.container_manager.docker_hosts:
+            self.lifecycle_manager.container_manager.docker_hosts.stop()
+        if getattr(self.lifecycle_manager, 'registration_verifier', None):
+            self.lifecycle_manager.registration_verifier.stop()
+        tool_cache = getattr(getattr(self.lifecycle_manager, 'container_manager', None), 'tool_cache', None)
+        if tool_cache:
+            tool_cache.stop()
         if hasattr(self.lifecycle_manager, 'stop_monitoring'):
             self.lifecycle_manager.stop_monitoring()
             logger.info("Monitoreo detenido")
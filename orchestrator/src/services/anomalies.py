@@ -0,0 +1,213 @@
+"""
+Anomalías de gasto.
+Cada COST_ANOMALY_CHECK_INTERVAL compara los minutos de runner y el coste de la última
+ventana (COST_ANOMALY_WINDOW) de cada tenant y pool con su media en ventanas iguales de
+los últimos COST_ANOMALY_BASELINE_DAYS días. Un consumo de COST_ANOMALY_FACTOR veces la
+media (p. ej. un bucle de reintentos) abre una anomalía con los repositorios y workflows
+que más aportan: evento cost.anomaly, incidente y métrica costs.anomalies. Se cierra
+cuando el consumo vuelve por debajo del umbral.
+"""
+
+import collections
+import os
+import threading
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+from src.services.incidents import incidents
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.usage import NO_TENANT, usage_ledger
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Repositorios y workflows que se adjuntan a cada anomalía
+TOP_CONTRIBUTORS = 5
+
+# Anomalías cerradas que se conservan para la API
+HISTORY_SIZE = 50
+
+FAILED_CONCLUSIONS = ("failure", "cancelled", "timed_out", "startup_failure")
+
+
+class CostAnomalyDetector:
+    """Detecta consumos de runner-minutos o coste muy por encima de la media reciente."""
+
+    def __init__(
+        self,
+        ledger: Any,
+        factor: float = 3.0,
+        window: int = 3600,
+        baseline_days: float = 7,
+        min_minutes: float = 60,
+    ):
+        if factor <= 1:
+            raise ConfigurationError("COST_ANOMALY_FACTOR debe ser mayor que 1")
+        self.ledger = ledger
+        self.factor = factor
+        self.window = window
+        self.baseline_days = baseline_days
+        # Por debajo de estos minutos en la ventana no hay anomalía aunque la media sea casi cero
+        self.min_minutes = min_minutes
+        self.active: Dict[str, Dict[str, Any]] = {}
+        self.history: "collections.deque[Dict[str, Any]]" = collections.deque(maxlen=HISTORY_SIZE)
+        self.lock = threading.Lock()
+        self.stop_event = threading.Event()
+
+    def start(self, interval: int):
+        threading.Thread(target=self._loop, args=(interval,), daemon=True).start()
+        logger.info(format_log(
+            'CONFIG', 'Detección de anomalías de gasto activada',
+            f"{self.factor}x la media de {self.baseline_days} días, ventana {self.window}s, cada {interval}s",
+        ))
+
+    def stop(self):
+        self.stop_event.set()
+
+    def _loop(self, interval: int):
+        while not self.stop_event.is_set():
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error detectando anomalías de gasto', str(e)))
+            self.stop_event.wait(interval)
+
+    def _totals(self, rows: List[Tuple[str, str, str, float, float]]) -> Dict[Tuple[str, str], Dict[str, float]]:
+        totals: Dict[Tuple[str, str], Dict[str, float]] = {}
+        for tenant, pool, _, seconds, cost_factor in rows:
+            cost = seconds / 60 * self.ledger.rate(pool) * cost_factor
+            for key in (("tenant", tenant), ("pool", pool)):
+                if key[1] == NO_TENANT:
+                    continue
+                entry = totals.setdefault(key, {"minutes": 0.0, "cost": 0.0})
+                entry["minutes"] += seconds / 60
+                entry["cost"] += cost
+        return totals
+
+    def check(self, now: Optional[float] = None):
+        """Compara la última ventana con la media y abre o cierra anomalías."""
+        now = now or time.time()
+        start = now - self.window
+        first = self.ledger.first_seen()
+        baseline_start = max(start - self.baseline_days * 86400, first or start)
+        # Sin al menos una ventana completa de historial no hay media con la que comparar
+        if start - baseline_start < self.window:
+            return
+        windows = (start - baseline_start) / self.window
+        rows = self.ledger.runner_seconds(start, now)
+        current = self._totals(rows)
+        baseline = self._totals(self.ledger.runner_seconds(baseline_start, start))
+
+        anomalous = set()
+        for key, entry in current.items():
+            average = {field: value / windows for field, value in baseline.get(key, {}).items()}
+            ratios = {
+                field: entry[field] / average[field]
+                for field in ("minutes", "cost") if average.get(field)
+            }
+            # Sin consumo previo no hay media: un tenant o pool nuevo no es una anomalía
+            if not ratios or entry["minutes"] < self.min_minutes:
+                continue
+            metric, ratio = max(ratios.items(), key=lambda item: item[1])
+            if ratio < self.factor:
+                continue
+            anomalous.add(f"{key[0]}:{key[1]}")
+            self._open(key, entry, average, metric, ratio, rows, start, now)
+
+        with self.lock:
+            resolved = [self.active.pop(key) for key in list(self.active) if key not in anomalous]
+        for anomaly in resolved:
+            anomaly["resolved_at"] = now
+            with self.lock:
+                self.history.appendleft(anomaly)
+            incidents.resolve("cost-anomaly", anomaly["id"])
+            logger.info(format_log('SUCCESS', 'Consumo de vuelta a lo normal', anomaly["id"]))
+
+    def _contributors(self, key: Tuple[str, str], rows: List[Tuple[str, str, str, float, float]], start: float, end: float) -> Dict[str, Any]:
+        index = 0 if key[0] == "tenant" else 1
+        repos: Dict[str, float] = {}
+        tenants = set()
+        for row in rows:
+            if row[index] == key[1]:
+                repos[row[2]] = repos.get(row[2], 0.0) + row[3] / 60
+                tenants.add(row[0])
+        workflows: Dict[Tuple[str, str], Dict[str, Any]] = {}
+        for row_tenant, pool, repository, workflow, conclusion, duration in self.ledger.jobs_between(start, end):
+            if (row_tenant, pool)[index] != key[1]:
+                continue
+            entry = workflows.setdefault((repository, workflow), {
+                "repository": repository, "workflow": workflow or None, "jobs": 0, "failed": 0, "minutes": 0.0,
+            })
+            entry["jobs"] += 1
+            entry["failed"] += 1 if conclusion in FAILED_CONCLUSIONS else 0
+            entry["minutes"] = round(entry["minutes"] + duration / 60, 2)
+        return {
+            "repositories": [
+                {"repository": repo, "minutes": round(minutes, 2)}
+                for repo, minutes in sorted(repos.items(), key=lambda item: -item[1])[:TOP_CONTRIBUTORS]
+            ],
+            "workflows": sorted(workflows.values(), key=lambda item: -item["jobs"])[:TOP_CONTRIBUTORS],
+            # Un pool compartido solo se atribuye a un tenant si todo su consumo es suyo
+            "tenant": key[1] if key[0] == "tenant" else (tenants.pop() if len(tenants) == 1 else None),
+        }
+
+    def _open(self, key, entry, average, metric, ratio, rows, start, now):
+        anomaly_id = f"{key[0]}:{key[1]}"
+        contributors = self._contributors(key, rows, start, now)
+        anomaly = {
+            "id": anomaly_id,
+            "kind": key[0],
+            "name": key[1],
+            "tenant": contributors.pop("tenant"),
+            "metric": metric,
+            "ratio": round(ratio, 2),
+            "minutes": round(entry["minutes"], 2),
+            "cost": round(entry["cost"], 4),
+            "average_minutes": round(average.get("minutes", 0.0), 2),
+            "average_cost": round(average.get("cost", 0.0), 4),
+            "currency": self.ledger.currency,
+            "window": self.window,
+            **contributors,
+        }
+        with self.lock:
+            existing = self.active.get(anomaly_id)
+            anomaly["opened_at"] = existing["opened_at"] if existing else now
+            anomaly["checked_at"] = now
+            self.active[anomaly_id] = anomaly
+        if existing:
+            return
+        top = ", ".join(item["repository"] for item in anomaly["repositories"][:3]) or "-"
+        summary = (
+            f"Consumo anómalo en {key[0]} {key[1]}: {anomaly['minutes']} min en {self.window // 60} min, "
+            f"{anomaly['ratio']}x la media ({top})"
+        )
+        logger.warning(format_log('WARNING', 'Anomalía de gasto', summary))
+        metrics.incr("costs.anomalies", tags={"kind": key[0], "name": key[1]})
+        lifecycle_events.emit("cost.anomaly", key=anomaly_id, **anomaly)
+        incidents.trigger(
+            "cost-anomaly", anomaly_id, summary, severity="warning",
+            ratio=anomaly["ratio"], repositories=anomaly["repositories"], workflows=anomaly["workflows"],
+        )
+
+    def status(self) -> Dict[str, List[Dict[str, Any]]]:
+        with self.lock:
+            return {"active": [dict(item) for item in self.active.values()], "recent": [dict(item) for item in self.history]}
+
+
+def create_cost_anomaly_detector() -> Optional[CostAnomalyDetector]:
+    """Detector si COST_ANOMALY_ENABLED=true (requiere USAGE_DB_PATH)."""
+    if os.getenv("COST_ANOMALY_ENABLED", "false").lower() != "true":
+        return None
+    if not usage_ledger:
+        raise ConfigurationError("COST_ANOMALY_ENABLED requiere USAGE_DB_PATH (el consumo sale del registro de uso)")
+    return CostAnomalyDetector(
+        usage_ledger,
+        factor=float(os.getenv("COST_ANOMALY_FACTOR", "3")),
+        window=int(os.getenv("COST_ANOMALY_WINDOW", "3600")),
+        baseline_days=float(os.getenv("COST_ANOMALY_BASELINE_DAYS", "7")),
+        min_minutes=float(os.getenv("COST_ANOMALY_MIN_MINUTES", "60")),
+    )
+
+
+cost_anomalies = create_cost_anomaly_detector()
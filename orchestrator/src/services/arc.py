@@ -0,0 +1,191 @@
+"""
+Compatibilidad con manifiestos de actions-runner-controller (ARC).
+Convierte RunnerDeployment/RunnerSet (actions.summerwind.dev) y AutoscalingRunnerSet
+(actions.github.com, los runner scale sets) al modelo de pools, para que los equipos
+que migran desde ARC mantengan sus manifiestos en el repositorio GitOps de pools.
+Los contenedores de servicio del pod (sidecarContainers, o los del scale set distintos
+de runner y dind) pasan a ser los sidecars del pool.
+"""
+
+from typing import Any, Dict, List, Optional
+
+import yaml
+
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+LEGACY_GROUP = "actions.summerwind.dev"
+SCALE_SET_GROUP = "actions.github.com"
+
+RUNNER_KINDS = ("RunnerDeployment", "RunnerSet")
+SCALE_SET_KINDS = ("AutoscalingRunnerSet",)
+# Recursos de ARC sin equivalente: el escalado lo decide el orchestrator por jobs en cola
+IGNORED_KINDS = ("HorizontalRunnerAutoscaler", "EphemeralRunnerSet", "EphemeralRunner", "AutoscalingListener", "Runner")
+
+# Anotación con opciones de pool (YAML) que se aplican sobre lo convertido
+POOL_ANNOTATION = "gha-runners/pool"
+
+
+def is_kubernetes_manifest(document: Any) -> bool:
+    return isinstance(document, dict) and "apiVersion" in document and "kind" in document
+
+
+def _group(document: Dict[str, Any]) -> str:
+    return str(document.get("apiVersion", "")).split("/")[0]
+
+
+def _runner_container(pod_spec: Dict[str, Any]) -> Dict[str, Any]:
+    for container in pod_spec.get("containers") or []:
+        if container.get("name") == "runner":
+            return container
+    return {}
+
+
+def _cpus(value: Any) -> float:
+    text = str(value)
+    return int(text[:-1]) / 1000 if text.endswith("m") else float(text)
+
+
+def _convert_sidecars(containers: List[Dict[str, Any]], notes: List[str]) -> List[Dict[str, Any]]:
+    """Contenedores adicionales del pod (bases de datos, cachés...) como sidecars del pool."""
+    sidecars = []
+    for container in containers:
+        name = container.get("name")
+        sidecar: Dict[str, Any] = {"name": name, "image": container.get("image")}
+        env = {}
+        for item in container.get("env") or []:
+            if "value" in item:
+                env[item["name"]] = item["value"]
+            else:
+                notes.append(f"sidecar {name}: env {item.get('name')} con valueFrom no se convierte")
+        if env:
+            sidecar["env"] = env
+        ports = [port["containerPort"] for port in container.get("ports") or [] if port.get("containerPort")]
+        if ports:
+            sidecar["ports"] = ports
+        # command de Kubernetes reemplaza el entrypoint; args, el comando
+        if container.get("command"):
+            sidecar["entrypoint"] = container["command"]
+        if container.get("args"):
+            sidecar["command"] = container["args"]
+        limits = (container.get("resources") or {}).get("limits") or {}
+        if limits.get("cpu"):
+            sidecar["cpus"] = _cpus(limits["cpu"])
+        if limits.get("memory"):
+            sidecar["memory"] = str(limits["memory"])
+        probe = container.get("readinessProbe") or {}
+        if (probe.get("exec") or {}).get("command"):
+            sidecar["ready"] = {"cmd": probe["exec"]["command"]}
+        elif probe:
+            notes.append(f"sidecar {name}: solo se convierten readinessProbe de tipo exec")
+        if container.get("volumeMounts"):
+            notes.append(f"sidecar {name}: volumeMounts no se convierten")
+        sidecars.append(sidecar)
+    return sidecars
+
+
+def _convert_runner_deployment(spec: Dict[str, Any], notes: List[str]) -> Dict[str, Any]:
+    runner = (spec.get("template") or {}).get("spec") or {}
+    pool: Dict[str, Any] = {
+        "labels": runner.get("labels") or [],
+        # ARC lanza un sidecar de Docker salvo dockerEnabled: false
+        "enable_dind": runner.get("dockerEnabled", True) is not False,
+    }
+    if runner.get("group"):
+        pool["runner_group"] = runner["group"]
+    if runner.get("sidecarContainers"):
+        pool["sidecars"] = _convert_sidecars(runner["sidecarContainers"], notes)
+    if runner.get("dockerdWithinRunnerContainer"):
+        notes.append("dockerdWithinRunnerContainer: se usa el socket de Docker del host")
+    if spec.get("replicas") is not None:
+        notes.append(f"replicas={spec['replicas']}: los runners se crean por jobs en cola")
+    if runner.get("image"):
+        notes.append(f"imagen {runner['image']} no usada (el entrypoint de ARC difiere); definir image en {POOL_ANNOTATION}")
+    return pool
+
+
+def _convert_scale_set(name: str, spec: Dict[str, Any], notes: List[str]) -> Dict[str, Any]:
+    pod_spec = (spec.get("template") or {}).get("spec") or {}
+    # containerMode dind del chart se renderiza como un contenedor (o init sidecar) "dind"
+    sidecars = [container.get("name") for container in (pod_spec.get("containers") or []) + (pod_spec.get("initContainers") or [])]
+    runner = _runner_container(pod_spec)
+    # Los workflows apuntan al scale set por su nombre (runs-on: <runnerScaleSetName>)
+    pool: Dict[str, Any] = {
+        "labels": [spec.get("runnerScaleSetName") or name],
+        "enable_dind": "dind" in sidecars,
+    }
+    if spec.get("runnerGroup"):
+        pool["runner_group"] = spec["runnerGroup"]
+    services = [container for container in pod_spec.get("containers") or [] if container.get("name") not in ("runner", "dind")]
+    if services:
+        pool["sidecars"] = _convert_sidecars(services, notes)
+    if spec.get("minRunners") or spec.get("maxRunners"):
+        notes.append(f"minRunners/maxRunners ({spec.get('minRunners', 0)}/{spec.get('maxRunners', '-')}) no aplican")
+    if any(env.get("name") == "ACTIONS_RUNNER_CONTAINER_HOOKS" for env in runner.get("env") or []):
+        notes.append("containerMode kubernetes: los jobs con container corren en Docker")
+    image = runner.get("image")
+    if image:
+        notes.append(f"imagen {image} no usada (el entrypoint de ARC difiere); definir image en {POOL_ANNOTATION}")
+    return pool
+
+
+def arc_to_pool(document: Dict[str, Any], filename: str = "") -> Optional[Dict[str, Any]]:
+    """
+    Convierte un manifiesto de ARC en una spec de pool.
+
+    Returns:
+        Spec de pool, o None si el documento no define runners (HPA, Secret, ConfigMap...)
+
+    Raises:
+        ConfigurationError: Si el manifiesto o su anotación de pool son inválidos
+    """
+    kind = document.get("kind")
+    metadata = document.get("metadata") or {}
+    name = metadata.get("name")
+    source = f"{filename}: {kind}/{name}" if filename else f"{kind}/{name}"
+
+    group = _group(document)
+    if (group, kind) not in [(LEGACY_GROUP, k) for k in RUNNER_KINDS] + [(SCALE_SET_GROUP, k) for k in SCALE_SET_KINDS]:
+        if group in (LEGACY_GROUP, SCALE_SET_GROUP) and kind not in IGNORED_KINDS:
+            logger.warning(format_log('WARNING', 'Recurso de ARC no soportado, se ignora', source))
+        else:
+            logger.debug(f"Manifiesto ignorado en specs de pools: {source}")
+        return None
+
+    if not name:
+        raise ConfigurationError(f"{source}: metadata.name es obligatorio")
+
+    notes: List[str] = []
+    spec = document.get("spec") or {}
+    if kind in RUNNER_KINDS:
+        pool = _convert_runner_deployment(spec, notes)
+    else:
+        pool = _convert_scale_set(name, spec, notes)
+    pool = {"name": name, **pool}
+
+    overrides = (metadata.get("annotations") or {}).get(POOL_ANNOTATION)
+    if overrides:
+        try:
+            values = yaml.safe_load(overrides)
+        except yaml.YAMLError as e:
+            raise ConfigurationError(f"{source}: anotación {POOL_ANNOTATION} inválida: {e}")
+        if not isinstance(values, dict):
+            raise ConfigurationError(f"{source}: {POOL_ANNOTATION} debe ser un mapa de opciones del pool")
+        pool.update({key: value for key, value in values.items() if key != "name"})
+
+    logger.info(format_log('CONFIG', 'Pool convertido desde ARC', f"{source}{' (' + '; '.join(notes) + ')' if notes else ''}"))
+    return pool
+
+
+def convert_documents(documents: List[Any], filename: str = "") -> List[Any]:
+    """Reemplaza los manifiestos de Kubernetes por sus pools; descarta los que no definen runners."""
+    result: List[Any] = []
+    for document in documents:
+        if not is_kubernetes_manifest(document):
+            result.append(document)
+            continue
+        pool = arc_to_pool(document, filename)
+        if pool is not None:
+            result.append(pool)
+    return result
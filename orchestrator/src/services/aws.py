@@ -0,0 +1,251 @@
+"""
+Cliente mínimo de las APIs de AWS sin boto3.
+Resuelve credenciales (variables de entorno, rol de la tarea de ECS o perfil de la
+instancia por IMDSv2), firma con Signature Version 4 y llama a las APIs con
+protocolo JSON (ECS, CloudWatch Logs) o Query (EC2).
+"""
+
+import hashlib
+import hmac
+import json
+import os
+import threading
+import xml.etree.ElementTree as ElementTree
+from datetime import datetime, timedelta, timezone
+from typing import Any, Dict, Optional, Tuple
+from urllib.parse import urlencode, urlsplit
+
+import requests
+from src.services.retries import http_retry_after, retry_budgets
+from src.utils.helpers import ConfigurationError, setup_logger
+
+logger = setup_logger(__name__)
+
+IMDS_ENDPOINT = "http://169.254.169.254"
+CONTAINER_CREDENTIALS_ENDPOINT = "http://169.254.170.2"
+
+# Limitación de la API: se reintenta con backoff
+THROTTLING_ERRORS = ("ThrottlingException", "TooManyRequestsException", "RequestLimitExceeded")
+
+
+class AWSError(Exception):
+    """Error devuelto por una API de AWS (tipo y mensaje del cuerpo JSON)."""
+
+    def __init__(self, code: str, message: str, status: int = 0):
+        super().__init__(f"{code}: {message}")
+        self.code = code
+        self.status = status
+
+
+class AWSCredentials:
+    """
+    Credenciales con renovación automática.
+
+    Orden: AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY, rol de la tarea de ECS
+    (AWS_CONTAINER_CREDENTIALS_*) y rol de la instancia EC2 por IMDSv2.
+    """
+
+    def __init__(self):
+        self.access_key: Optional[str] = None
+        self.secret_key: Optional[str] = None
+        self.token: Optional[str] = None
+        self.expires: Optional[datetime] = None
+        self.lock = threading.Lock()
+
+    def get(self) -> Dict[str, Optional[str]]:
+        with self.lock:
+            if not self.access_key or (self.expires and self.expires - datetime.now(timezone.utc) < timedelta(minutes=5)):
+                self._refresh()
+            return {"access_key": self.access_key, "secret_key": self.secret_key, "token": self.token}
+
+    def _refresh(self):
+        if os.getenv("AWS_ACCESS_KEY_ID") and os.getenv("AWS_SECRET_ACCESS_KEY"):
+            self.access_key = os.getenv("AWS_ACCESS_KEY_ID")
+            self.secret_key = os.getenv("AWS_SECRET_ACCESS_KEY")
+            self.token = os.getenv("AWS_SESSION_TOKEN")
+            self.expires = None
+            return
+
+        try:
+            data = self._container_credentials() or self._instance_credentials()
+        except requests.RequestException as e:
+            raise ConfigurationError(f"No se pudieron obtener credenciales de AWS: {e}")
+        if not data:
+            raise ConfigurationError("Sin credenciales de AWS (variables de entorno, rol de tarea ECS o perfil de instancia)")
+
+        self.access_key = data["AccessKeyId"]
+        self.secret_key = data["SecretAccessKey"]
+        self.token = data.get("Token")
+        self.expires = datetime.fromisoformat(data["Expiration"].replace("Z", "+00:00")) if data.get("Expiration") else None
+
+    @staticmethod
+    def _container_credentials() -> Optional[Dict[str, Any]]:
+        relative = os.getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+        full = os.getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+        if not relative and not full:
+            return None
+        headers = {}
+        if os.getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"):
+            headers["Authorization"] = os.getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+        response = requests.get(full or f"{CONTAINER_CREDENTIALS_ENDPOINT}{relative}", headers=headers, timeout=5)
+        response.raise_for_status()
+        return response.json()
+
+    @staticmethod
+    def _instance_credentials() -> Optional[Dict[str, Any]]:
+        token = requests.put(
+            f"{IMDS_ENDPOINT}/latest/api/token",
+            headers={"X-aws-ec2-metadata-token-ttl-seconds": "300"}, timeout=2,
+        )
+        token.raise_for_status()
+        headers = {"X-aws-ec2-metadata-token": token.text}
+        role = requests.get(f"{IMDS_ENDPOINT}/latest/meta-data/iam/security-credentials/", headers=headers, timeout=2)
+        if role.status_code == 404:
+            return None
+        role.raise_for_status()
+        response = requests.get(
+            f"{IMDS_ENDPOINT}/latest/meta-data/iam/security-credentials/{role.text.strip()}", headers=headers, timeout=2,
+        )
+        response.raise_for_status()
+        return response.json()
+
+
+def _hmac(key: bytes, value: str) -> bytes:
+    return hmac.new(key, value.encode("utf-8"), hashlib.sha256).digest()
+
+
+def sign_request(
+    method: str, url: str, region: str, service: str, headers: Dict[str, str], body: bytes, credentials: Dict[str, Optional[str]],
+) -> Dict[str, str]:
+    """Cabeceras firmadas con SigV4 (URL sin query string, como las APIs JSON)."""
+    now = datetime.now(timezone.utc)
+    amz_date = now.strftime("%Y%m%dT%H%M%SZ")
+    date = now.strftime("%Y%m%d")
+    parts = urlsplit(url)
+
+    signed = {key.lower(): value.strip() for key, value in headers.items()}
+    signed["host"] = parts.netloc
+    signed["x-amz-date"] = amz_date
+    if credentials.get("token"):
+        signed["x-amz-security-token"] = credentials["token"]
+    names = sorted(signed)
+
+    canonical = "\n".join([
+        method,
+        parts.path or "/",
+        "",
+        "".join(f"{name}:{signed[name]}\n" for name in names),
+        ";".join(names),
+        hashlib.sha256(body).hexdigest(),
+    ])
+    scope = f"{date}/{region}/{service}/aws4_request"
+    string_to_sign = "\n".join(["AWS4-HMAC-SHA256", amz_date, scope, hashlib.sha256(canonical.encode()).hexdigest()])
+
+    key = _hmac(f"AWS4{credentials['secret_key']}".encode(), date)
+    for part in (region, service, "aws4_request"):
+        key = _hmac(key, part)
+    signature = hmac.new(key, string_to_sign.encode(), hashlib.sha256).hexdigest()
+
+    signed["authorization"] = (
+        f"AWS4-HMAC-SHA256 Credential={credentials['access_key']}/{scope}, "
+        f"SignedHeaders={';'.join(names)}, Signature={signature}"
+    )
+    return signed
+
+
+class AWSJsonClient:
+    """Llamadas a una API de AWS con protocolo JSON 1.1 (X-Amz-Target)."""
+
+    def __init__(self, service: str, target_prefix: str, region: str, credentials: AWSCredentials, endpoint: Optional[str] = None):
+        self.service = service
+        self.target_prefix = target_prefix
+        self.region = region
+        self.credentials = credentials
+        self.endpoint = (endpoint or f"https://{service}.{region}.amazonaws.com").rstrip("/") + "/"
+
+    def call(self, action: str, payload: Dict[str, Any]) -> Dict[str, Any]:
+        body = json.dumps(payload).encode("utf-8")
+        headers = sign_request("POST", self.endpoint, self.region, self.service, {
+            "Content-Type": "application/x-amz-json-1.1",
+            "X-Amz-Target": f"{self.target_prefix}.{action}",
+        }, body, self.credentials.get())
+
+        # Limitación de la API (400 ThrottlingException) y fallos del servicio se reintentan
+        response = retry_budgets.get("aws").call(
+            lambda: requests.post(self.endpoint, data=body, headers=headers, timeout=30),
+            retry_error=lambda e: isinstance(e, requests.RequestException),
+            retry_result=lambda response: response.status_code >= 500 or _error_code(response) in THROTTLING_ERRORS,
+            retry_after=http_retry_after,
+        )
+        if response.status_code < 400:
+            return response.json() if response.content else {}
+        try:
+            error = response.json()
+        except ValueError:
+            error = {}
+        raise AWSError(_error_code(response), error.get("message") or error.get("Message") or response.text[:200], response.status_code)
+
+
+def _error_code(response: requests.Response) -> str:
+    if response.status_code < 400:
+        return ""
+    try:
+        error = response.json()
+    except ValueError:
+        error = {}
+    return str(error.get("__type", f"HTTP{response.status_code}")).split("#")[-1]
+
+
+class AWSQueryClient:
+    """Llamadas a una API de AWS con protocolo Query (parámetros de formulario y respuesta XML)."""
+
+    def __init__(self, service: str, version: str, region: str, credentials: AWSCredentials, endpoint: Optional[str] = None):
+        self.service = service
+        self.version = version
+        self.region = region
+        self.credentials = credentials
+        self.endpoint = (endpoint or f"https://{service}.{region}.amazonaws.com").rstrip("/") + "/"
+
+    def call(self, action: str, params: Dict[str, Any]) -> ElementTree.Element:
+        """
+        Respuesta XML sin espacios de nombres. Las listas y estructuras van aplanadas como
+        en la API (Filter.1.Name, IpPermissions.1.IpRanges.1.CidrIp...).
+        """
+        body = urlencode({"Action": action, "Version": self.version, **{key: str(value) for key, value in params.items()}}).encode("utf-8")
+        headers = sign_request("POST", self.endpoint, self.region, self.service, {
+            "Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+        }, body, self.credentials.get())
+
+        response = retry_budgets.get("aws").call(
+            lambda: requests.post(self.endpoint, data=body, headers=headers, timeout=30),
+            retry_error=lambda e: isinstance(e, requests.RequestException),
+            retry_result=lambda response: response.status_code >= 500 or _query_error(response)[0] in THROTTLING_ERRORS,
+            retry_after=http_retry_after,
+        )
+        if response.status_code >= 400:
+            code, message = _query_error(response)
+            raise AWSError(code, message, response.status_code)
+        return _strip_namespaces(ElementTree.fromstring(response.content))
+
+
+def _strip_namespaces(root: ElementTree.Element) -> ElementTree.Element:
+    for element in root.iter():
+        element.tag = element.tag.rsplit("}", 1)[-1]
+    return root
+
+
+def _query_error(response: requests.Response) -> Tuple[str, str]:
+    """Código y mensaje de <Errors><Error> (EC2) o <ErrorResponse><Error> (resto de APIs Query)."""
+    if response.status_code < 400:
+        return "", ""
+    try:
+        error = _strip_namespaces(ElementTree.fromstring(response.content)).find(".//Error")
+    except ElementTree.ParseError:
+        error = None
+    if error is None:
+        return f"HTTP{response.status_code}", response.text[:200]
+    return error.findtext("Code") or f"HTTP{response.status_code}", error.findtext("Message") or ""
+
+
+def aws_region() -> Optional[str]:
+    return os.getenv("AWS_REGION") or os.getenv("AWS_DEFAULT_REGION")
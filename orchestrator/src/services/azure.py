@@ -0,0 +1,864 @@
+"""
+Backend de Azure: VMs individuales (spot opcional) o instancias de un VM scale set.
+Autentica con managed identity (IMDS) o con un service principal y usa la API REST
+de Azure Resource Manager. El runner se configura con --ephemeral mediante Run
+Command (shell en Linux, PowerShell en Windows) y apaga el sistema al terminar su
+job; el orchestrator detecta la VM detenida y la elimina (VM individual) o la
+desasigna para reutilizarla en el siguiente job (scale set). Con egress_cidrs las
+VMs del pool se crean con un NSG propio que solo deja salir a esos CIDRs y a GitHub
+(ver network_rules.py).
+
+Con "warm" en un pool de VMs individuales se mantienen VMs ya arrancadas e
+hibernadas: el runner se configura en una VM reanudada (segundos) en lugar de
+crear una nueva (minutos). El refresco de pools precalentados las repone y
+recicla las que superan warm_max_age.
+
+Con "selection" el vm_size se elige por precio entre candidatos (ver instance_types.py),
+probando el siguiente si la región no tiene capacidad para uno.
+"""
+
+import hashlib
+import os
+import secrets
+import shlex
+import threading
+import time
+import uuid
+from datetime import datetime, timezone
+from types import SimpleNamespace
+from typing import Any, Dict, List, Optional
+
+import requests
+from src.services.capabilities import capabilities, labels_script
+from src.services.github_server import github_web_url
+from src.services.instance_types import InstanceCatalog, MachineSpec, create_instance_selector, validate_selection
+from src.services.network_rules import GitHubRanges, PoolEgressRules, github_ranges
+from src.services.retries import http_retry_after, http_transient, retry_budgets
+from src.services.vm_scripts import startup_templates
+from src.services.workspaces import WorkspaceQuota, quota_for
+from src.utils.helpers import ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+ARM_ENDPOINT = "https://management.azure.com"
+COMPUTE_API_VERSION = "2024-03-01"
+NETWORK_API_VERSION = "2023-09-01"
+API_VERSIONS = {"Microsoft.Compute": COMPUTE_API_VERSION, "Microsoft.Network": NETWORK_API_VERSION}
+SKUS_API_VERSION = "2021-07-01"
+RETAIL_PRICES_ENDPOINT = "https://prices.azure.com/api/retail/prices"
+MANAGED_BY = "gha-ephemeral-runners"
+
+# Opciones del pool bajo "azure"
+POOL_KEYS = (
+    "vmss", "image", "vm_size", "spot", "max_price", "os", "max_instances", "runner_dir", "runner_user", "disk_type", "warm", "warm_max_age",
+    "location", "subnet_id", "startup_template", "harden", "block_metadata", "selection",
+)
+
+RUNNING_STATES = ("PowerState/running", "PowerState/starting")
+
+# Run Command devuelve éxito aunque el script falle: el script lo imprime al terminar bien
+CONFIGURED_MARKER = "gha-runner-configured"
+
+# Tag de las VMs precalentadas aún sin reclamar (valor: nombre del pool)
+WARM_TAG = "gha-warm"
+
+# Sin capacidad o cuota para un tamaño en la región: con selection se prueba el siguiente
+SIZE_FALLBACK_ERRORS = (
+    "AllocationFailed",
+    "ZonalAllocationFailed",
+    "OverconstrainedAllocationRequest",
+    "SkuNotAvailable",
+    "OperationNotAllowed",
+    "QuotaExceeded",
+)
+
+
+class AzureError(Exception):
+    """Error de la API de Azure Resource Manager."""
+
+
+class AzureCredentials:
+    """
+    Token de ARM con renovación automática.
+
+    Con AZURE_CLIENT_SECRET usa el service principal (AZURE_TENANT_ID, AZURE_CLIENT_ID);
+    si no, la managed identity de la VM o el contenedor (AZURE_CLIENT_ID elige una
+    identidad asignada por el usuario).
+    """
+
+    def __init__(self, tenant_id: Optional[str], client_id: Optional[str], client_secret: Optional[str]):
+        if client_secret and not (tenant_id and client_id):
+            raise ConfigurationError("AZURE_CLIENT_SECRET requiere AZURE_TENANT_ID y AZURE_CLIENT_ID")
+        self.tenant_id = tenant_id
+        self.client_id = client_id
+        self.client_secret = client_secret
+        self.token: Optional[str] = None
+        self.expires_at = 0.0
+        self.lock = threading.Lock()
+
+    @property
+    def method(self) -> str:
+        return "service principal" if self.client_secret else "managed identity"
+
+    def get(self) -> str:
+        with self.lock:
+            if not self.token or self.expires_at - time.time() < 300:
+                self._refresh()
+            return self.token
+
+    def _refresh(self):
+        try:
+            if self.client_secret:
+                response = requests.post(
+                    f"https://login.microsoftonline.com/{self.tenant_id}/oauth2/v2.0/token", timeout=10,
+                    data={
+                        "grant_type": "client_credentials",
+                        "client_id": self.client_id,
+                        "client_secret": self.client_secret,
+                        "scope": f"{ARM_ENDPOINT}/.default",
+                    },
+                )
+            else:
+                params = {"api-version": "2018-02-01", "resource": f"{ARM_ENDPOINT}/"}
+                if self.client_id:
+                    params["client_id"] = self.client_id
+                response = requests.get(
+                    "http://169.254.169.254/metadata/identity/oauth2/token",
+                    params=params, headers={"Metadata": "true"}, timeout=5,
+                )
+            response.raise_for_status()
+        except requests.RequestException as e:
+            raise AzureError(f"No se pudo obtener token de Azure ({self.method}): {e}")
+        data = response.json()
+        self.token = data["access_token"]
+        self.expires_at = float(data.get("expires_on") or time.time() + int(data.get("expires_in", 3600)))
+
+
+class AzureClient:
+    """Llamadas a ARM con espera de operaciones asíncronas."""
+
+    def __init__(self, credentials: AzureCredentials, subscription_id: str, resource_group: str):
+        self.credentials = credentials
+        self.subscription = f"{ARM_ENDPOINT}/subscriptions/{subscription_id}"
+        self.group = f"{self.subscription}/resourceGroups/{resource_group}"
+        self.base = f"{self.group}/providers/Microsoft.Compute"
+
+    def request(
+        self, method: str, path: str, body: Optional[Dict[str, Any]] = None, wait: bool = False, timeout: int = 600,
+        params: Optional[Dict[str, str]] = None, provider: str = "Microsoft.Compute",
+    ) -> Dict[str, Any]:
+        response = retry_budgets.get("azure").call(
+            lambda: requests.request(
+                method, f"{self.group}/providers/{provider}{path}", params={"api-version": API_VERSIONS[provider], **(params or {})}, json=body,
+                headers={"Authorization": f"Bearer {self.credentials.get()}"}, timeout=30,
+            ),
+            retry_error=lambda e: isinstance(e, requests.RequestException),
+            retry_result=http_transient,
+            retry_after=http_retry_after,
+        )
+        if response.status_code == 404 and method == "DELETE":
+            return {}
+        if response.status_code >= 400:
+            try:
+                error = response.json().get("error", {})
+            except ValueError:
+                error = {}
+            raise AzureError(f"{error.get('code', response.status_code)}: {error.get('message', response.text[:200])}")
+
+        operation = response.headers.get("Azure-AsyncOperation") or response.headers.get("Location")
+        if wait and response.status_code in (201, 202) and operation:
+            return self._wait(operation, timeout)
+        return response.json() if response.content else {}
+
+    def resource_skus(self, location: str) -> List[Dict[str, Any]]:
+        """Tamaños de VM de la región (Resource SKUs de la suscripción)."""
+        skus = []
+        url: Optional[str] = f"{self.subscription}/providers/Microsoft.Compute/skus"
+        params: Optional[Dict[str, str]] = {"api-version": SKUS_API_VERSION, "$filter": f"location eq '{location}'"}
+        while url:
+            response = requests.get(url, params=params, headers={"Authorization": f"Bearer {self.credentials.get()}"}, timeout=60)
+            if response.status_code >= 400:
+                raise AzureError(f"{response.status_code}: {response.text[:200]}")
+            data = response.json()
+            skus += [sku for sku in data.get("value", []) if sku.get("resourceType") == "virtualMachines"]
+            # nextLink ya lleva la query
+            url, params = data.get("nextLink"), None
+        return skus
+
+    def _wait(self, url: str, timeout: int) -> Dict[str, Any]:
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            response = requests.get(url, headers={"Authorization": f"Bearer {self.credentials.get()}"}, timeout=30)
+            if response.status_code == 202 or (response.content and response.json().get("status") in ("InProgress", "Accepted")):
+                time.sleep(int(response.headers.get("Retry-After", "5")))
+                continue
+            if response.status_code >= 400:
+                raise AzureError(f"Operación fallida: {response.text[:300]}")
+            data = response.json() if response.content else {}
+            if data.get("status") in ("Failed", "Canceled"):
+                # Con el código del error, como en request(): AllocationFailed, SkuNotAvailable...
+                error = data.get("error") or {}
+                raise AzureError(f"{error.get('code') or 'Operación ' + data['status']}: {error.get('message', '')}")
+            return data
+        raise AzureError(f"Timeout esperando la operación de Azure ({timeout}s)")
+
+
+class AzureEgressRules(PoolEgressRules):
+    """NSG gha-egress-<pool> que se asocia a la NIC de cada VM del pool."""
+
+    IN_USE_ERRORS = ("InUseNetworkSecurityGroupCannotBeDeleted",)
+
+    def __init__(self, client: AzureClient, location: str, github: GitHubRanges):
+        super().__init__("azure", github)
+        self.client = client
+        self.location = location
+
+    @staticmethod
+    def path(pool_name: str) -> str:
+        return f"/networkSecurityGroups/gha-egress-{pool_name}"[:100]
+
+    def _apply(self, pool: Any, ipv4: List[str], ipv6: List[str]) -> str:
+        spec = AzurePoolSpec(pool.name, pool.azure)
+
+        def rule(name: str, priority: int, access: str, destinations: List[str]) -> Dict[str, Any]:
+            properties = {
+                "direction": "Outbound", "access": access, "priority": priority, "protocol": "*",
+                "sourceAddressPrefix": "*", "sourcePortRange": "*", "destinationPortRange": "*",
+            }
+            # Una regla no mezcla IPv4 e IPv6; "*" es cualquier destino
+            if destinations == ["*"]:
+                properties["destinationAddressPrefix"] = "*"
+            else:
+                properties["destinationAddressPrefixes"] = destinations
+            return {"name": name, "properties": properties}
+
+        # El PUT reemplaza todas las reglas: también corrige cambios manuales
+        rules = [rule("allow-ipv4", 100, "Allow", ipv4)] if ipv4 else []
+        if ipv6:
+            rules.append(rule("allow-ipv6", 110, "Allow", ipv6))
+        rules.append(rule("deny-all", 4096, "Deny", ["*"]))
+        body = {
+            "location": spec.location or self.location,
+            "tags": {"managed-by": MANAGED_BY, "runner-pool": pool.name},
+            "properties": {"securityRules": rules},
+        }
+        self.client.request("PUT", self.path(pool.name), body, wait=True, provider="Microsoft.Network")
+        return self.client.request("GET", self.path(pool.name), provider="Microsoft.Network")["id"]
+
+    def _delete(self, pool_name: str) -> bool:
+        try:
+            self.client.request("GET", self.path(pool_name), provider="Microsoft.Network")
+        except AzureError as e:
+            if "NotFound" in str(e):
+                return False
+            raise
+        self.client.request("DELETE", self.path(pool_name), wait=True, provider="Microsoft.Network")
+        return True
+
+    def _in_use(self, pool_name: str) -> bool:
+        try:
+            nsg = self.client.request("GET", self.path(pool_name), provider="Microsoft.Network")
+        except AzureError as e:
+            if "NotFound" in str(e):
+                return False
+            raise
+        return bool(nsg.get("properties", {}).get("networkInterfaces"))
+
+
+class AzureCatalog(InstanceCatalog):
+    """Tamaños de VM de la región (Resource SKUs) y precios de Azure Retail Prices."""
+
+    def __init__(self, client: AzureClient):
+        self.client = client
+
+    def specs(self, location: str, names: List[str]) -> Dict[str, MachineSpec]:
+        found = {}
+        for sku in self.client.resource_skus(location):
+            # Los restringidos para la suscripción en la región no se pueden crear
+            if sku.get("name") not in names or any(item.get("type") == "Location" for item in sku.get("restrictions") or []):
+                continue
+            capabilities = {item["name"]: item["value"] for item in sku.get("capabilities", [])}
+            found[sku["name"]] = MachineSpec(
+                int(capabilities.get("vCPUs", 0)),
+                float(capabilities.get("MemoryGB", 0)),
+                "arm64" if capabilities.get("CpuArchitectureType") == "Arm64" else "x86_64",
+            )
+        return found
+
+    def prices(self, location: str, specs: Dict[str, MachineSpec], spot: bool, os_name: str) -> Dict[str, float]:
+        """Precio por hora de pago por uso (o spot) del sistema operativo del pool."""
+        names = " or ".join(f"armSkuName eq '{name}'" for name in sorted(specs))
+        url: Optional[str] = RETAIL_PRICES_ENDPOINT
+        params: Optional[Dict[str, str]] = {
+            "$filter": f"serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '{location}' and ({names})",
+        }
+        prices: Dict[str, float] = {}
+        while url:
+            response = requests.get(url, params=params, timeout=30)
+            response.raise_for_status()
+            data = response.json()
+            for item in data.get("Items", []):
+                sku_name = item.get("skuName", "")
+                if sku_name.endswith(" Low Priority") or sku_name.endswith(" Spot") != spot:
+                    continue
+                if ("Windows" in item.get("productName", "")) != (os_name == "windows"):
+                    continue
+                name = item["armSkuName"]
+                prices[name] = min(prices.get(name, item["retailPrice"]), item["retailPrice"])
+            url, params = data.get("NextPageLink"), None
+        return prices
+
+
+class AzurePoolSpec:
+    """Opciones "azure" de un pool (VM individual con image o instancias de vmss)."""
+
+    def __init__(self, pool_name: str, spec: Dict[str, Any]):
+        self.pool_name = pool_name
+        self.vmss: Optional[str] = spec.get("vmss")
+        self.image: Optional[str] = spec.get("image")
+        self.vm_size: str = spec.get("vm_size", "Standard_D2s_v5")
+        self.spot: bool = bool(spec.get("spot", False))
+        self.max_price: float = float(spec.get("max_price", -1))
+        self.os: str = spec.get("os", "linux")
+        self.max_instances: int = int(spec.get("max_instances", 10))
+        self.disk_type: str = spec.get("disk_type", "StandardSSD_LRS")
+        windows = self.os == "windows"
+        self.runner_dir: str = spec.get("runner_dir", "C:\\actions-runner" if windows else "/opt/actions-runner")
+        self.runner_user: str = spec.get("runner_user", "runner")
+        self.warm: int = int(spec.get("warm", 0))
+        self.warm_max_age: int = int(spec.get("warm_max_age", 86400))
+        # Región y subred propias del pool (pools multi-región); sin ellas, AZURE_LOCATION y AZURE_SUBNET_ID
+        self.location: Optional[str] = spec.get("location")
+        self.subnet_id: Optional[str] = spec.get("subnet_id")
+        # Script de Run Command: plantilla propia (vm_scripts) y endurecimiento del host
+        self.startup_template: Optional[str] = spec.get("startup_template")
+        self.harden: bool = bool(spec.get("harden", True))
+        self.block_metadata: bool = bool(spec.get("block_metadata", False))
+        # Candidatos de vm_size por precio (ver instance_types.py); excluye vm_size
+        self.selection: Optional[Dict[str, Any]] = spec.get("selection")
+
+
+def _powershell_quote(value: str) -> str:
+    return "'" + value.replace("'", "''") + "'"
+
+
+def runner_script(
+    spec: AzurePoolSpec,
+    config_args: List[str],
+    quota: Optional[WorkspaceQuota] = None,
+    labels: Optional[List[str]] = None,
+) -> Dict[str, Any]:
+    """
+    Script de Run Command (plantilla del pool, ver vm_scripts) que registra el runner, lo
+    ejecuta en segundo plano y apaga la VM al terminar. En Linux, con quota, el workspace
+    queda limitado por una cuota de proyecto XFS, y con labels el runner se registra con
+    ellos más los de capacidades de la VM.
+    """
+    if spec.os == "windows":
+        runner_dir = _powershell_quote(spec.runner_dir)
+        args = " ".join(_powershell_quote(arg) for arg in config_args)
+        return {"commandId": "RunPowerShellScript", "script": startup_templates.render(spec.pool_name, "azure", spec, prelude=[
+            "$ErrorActionPreference = 'Stop'",
+        ], configure=[
+            f"Set-Location {runner_dir}",
+            f"& .\\config.cmd {args}",
+            "if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }",
+        ], run=[
+            "$run = \"& '\" + (Join-Path (Get-Location) 'run.cmd') + \"' *> runner.log; Stop-Computer -Force\"",
+            "Start-Process powershell -WindowStyle Hidden -ArgumentList '-NoProfile', '-Command', $run",
+            f"Write-Output '{CONFIGURED_MARKER}'",
+        ]).splitlines()}
+
+    runner_dir = shlex.quote(spec.runner_dir)
+    user = shlex.quote(spec.runner_user)
+    args = " ".join(shlex.quote(arg) for arg in config_args)
+    workspace = shlex.quote(f"{spec.runner_dir}/_work")
+    quota_lines = [*quota.xfs_script(f"{spec.runner_dir}/_work", ""), f"chown {user} {workspace}"] if quota else []
+    if labels is None:
+        config = f"su -s /bin/sh {user} -c {shlex.quote('./config.sh ' + args)}"
+    else:
+        config = f"su -s /bin/sh {user} -c \"./config.sh {args} --labels '$labels'\""
+    return {"commandId": "RunShellScript", "script": startup_templates.render(spec.pool_name, "azure", spec, prelude=[
+        "set -e",
+    ], configure=[
+        f"cd {runner_dir}",
+        *quota_lines,
+        *(labels_script(labels) if labels is not None else []),
+        config,
+    ], run=[
+        # Al salir el runner efímero se borra el workspace (las instancias de scale set se
+        # reutilizan) y se apaga la VM; el orchestrator la elimina o desasigna
+        f"setsid nohup sh -c \"su -s /bin/sh {user} -c ./run.sh; rm -rf {workspace}; shutdown -h now\" > runner.log 2>&1 < /dev/null &",
+        f"echo {CONFIGURED_MARKER}",
+    ]).splitlines()}
+
+
+class AzureRunner:
+    """VM o instancia de scale set con la interfaz de contenedor que usa el ciclo de vida."""
+
+    def __init__(self, backend: "AzureBackend", path: str, labels: Dict[str, str], spec: AzurePoolSpec, created: str = ""):
+        self.backend = backend
+        self.path = path
+        self.spec = spec
+        self.id = path.rsplit("/", 1)[-1]
+        self.labels = labels
+        self.name = f"gha-runner-{labels.get('runner-name', self.id)}"
+        self.image = SimpleNamespace(tags=[spec.image or f"vmss:{spec.vmss}"])
+        self.ports: Dict[str, Any] = {}
+        self.attrs: Dict[str, Any] = {"Created": created, "Config": {"Image": spec.image}, "State": {}}
+        self.status = "running"
+
+    def reload(self):
+        self.status = self.backend.runner_status(self)
+
+    def stop(self, timeout: int = 30):
+        self.backend.release(self)
+
+    def remove(self, force: bool = False):
+        pass
+
+    def logs(self, tail: int = 50) -> bytes:
+        return self.backend.runner_logs(self, tail).encode("utf-8")
+
+
+class AzureBackend:
+    """Lanza runners en VMs de Azure según las opciones "azure" de cada pool."""
+
+    def __init__(
+        self,
+        client: AzureClient,
+        location: str,
+        subnet_id: Optional[str] = None,
+        provision_timeout: int = 900,
+    ):
+        self.client = client
+        self.location = location
+        self.subnet_id = subnet_id
+        self.provision_timeout = provision_timeout
+        self.runners: Dict[str, AzureRunner] = {}
+        # VMs precalentadas que se están reclamando (el refresco no las toca)
+        self.claiming: set = set()
+        self.warm_status: Dict[str, Dict[str, int]] = {}
+        self.warm_claims = 0
+        self.warm_misses = 0
+        self.egress = AzureEgressRules(client, location, github_ranges)
+        self.selector = create_instance_selector("azure", AzureCatalog(client))
+        self.lock = threading.Lock()
+
+    def create_runner(
+        self,
+        registration_token: str,
+        scope_name: str,
+        runner_name: str,
+        runner_group: Optional[str],
+        labels: List[str],
+        container_labels: Dict[str, str],
+        pool: Any,
+    ) -> AzureRunner:
+        spec = AzurePoolSpec(pool.name, pool.azure)
+        container_labels = {**container_labels, "runner-backend": "azure", "managed-by": MANAGED_BY}
+        config_args = [
+            "--unattended", "--ephemeral", "--replace", "--disableupdate",
+            "--url", f"{github_web_url()}/{scope_name}",
+            "--token", registration_token,
+            "--name", runner_name,
+            "--work", "_work",
+        ]
+        # Labels de capacidades: los calcula el script en la VM (solo Linux)
+        introspect = capabilities.applies(pool) and spec.os != "windows"
+        if labels and not introspect:
+            config_args += ["--labels", ",".join(labels)]
+        if runner_group:
+            config_args += ["--runnergroup", runner_group]
+
+        if spec.vmss:
+            path = self._acquire_instance(spec, pool.name)
+        else:
+            path = self._claim_warm(spec, pool.name, container_labels) if spec.warm else None
+            if not path:
+                with self.egress.creation(pool) as nsg:
+                    path = self._create_vm(spec, runner_name, container_labels, nsg=nsg)
+        runner = AzureRunner(self, path, container_labels, spec, time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()))
+
+        try:
+            logger.info(f"☁️ Configurando runner {runner_name} en {runner.id} (pool {pool.name})")
+            script = runner_script(spec, config_args, quota_for(pool), labels if introspect else None)
+            result = self.client.request("POST", f"{path}/runCommand", script, wait=True, timeout=self.provision_timeout)
+            messages = self._check_run_command(result)
+        except AzureError:
+            self.release(runner)
+            raise
+
+        with self.lock:
+            self.runners[runner_name] = runner
+        if introspect:
+            capabilities.record_output(pool.name, messages)
+        logger.info(f"✅ Runner {runner_name} en ejecución en {runner.id}")
+        return runner
+
+    @staticmethod
+    def _check_run_command(result: Dict[str, Any]) -> str:
+        messages = "\n".join(
+            status.get("message", "") for status in (result.get("properties", {}).get("output") or result).get("value", [])
+        )
+        if CONFIGURED_MARKER not in messages:
+            raise AzureError(f"Falló la configuración del runner: {redactor.redact(messages.strip())[-500:]}")
+        return messages
+
+    def _create_vm(
+        self, spec: AzurePoolSpec, runner_name: str, labels: Dict[str, str], hibernation: bool = False, nsg: Optional[str] = None,
+    ) -> str:
+        if not spec.image:
+            raise ConfigurationError("azure.image es obligatorio sin azure.vmss")
+        subnet_id = spec.subnet_id or self.subnet_id
+        if not subnet_id:
+            raise ConfigurationError("AZURE_SUBNET_ID o azure.subnet_id es obligatorio para VMs individuales")
+
+        name = f"gha-{runner_name}"[:64]
+        # Nombre de equipo: 15 caracteres como máximo en Windows
+        computer_name = "gha" + hashlib.sha256(runner_name.encode()).hexdigest()[:12]
+        if spec.image.startswith("/"):
+            image_reference = {"id": spec.image}
+        else:
+            publisher, offer, sku, version = spec.image.split(":")
+            image_reference = {"publisher": publisher, "offer": offer, "sku": sku, "version": version}
+
+        # Nadie inicia sesión en las VMs: contraseña aleatoria que no se guarda
+        os_profile: Dict[str, Any] = {
+            "computerName": computer_name,
+            "adminUsername": "ghaadmin",
+            "adminPassword": secrets.token_urlsafe(24) + "aA1!",
+        }
+        properties: Dict[str, Any] = {
+            "hardwareProfile": {"vmSize": spec.vm_size},
+            "storageProfile": {
+                "imageReference": image_reference,
+                "osDisk": {"createOption": "FromImage", "deleteOption": "Delete", "managedDisk": {"storageAccountType": spec.disk_type}},
+            },
+            "osProfile": os_profile,
+            "networkProfile": {
+                "networkApiVersion": "2020-11-01",
+                "networkInterfaceConfigurations": [{
+                    "name": f"{name}-nic",
+                    "properties": {
+                        "primary": True,
+                        "deleteOption": "Delete",
+                        "ipConfigurations": [{"name": "ipconfig1", "properties": {"subnet": {"id": subnet_id}}}],
+                    },
+                }],
+            },
+        }
+        if nsg:
+            properties["networkProfile"]["networkInterfaceConfigurations"][0]["properties"]["networkSecurityGroup"] = {"id": nsg}
+        if spec.spot:
+            properties.update(priority="Spot", evictionPolicy="Delete", billingProfile={"maxPrice": spec.max_price})
+        if hibernation:
+            properties["additionalCapabilities"] = {"hibernationEnabled": True}
+
+        path = f"/virtualMachines/{name}"
+        tags = {key: str(value)[:256] for key, value in labels.items()}
+        tags["azure-os"] = spec.os
+        location = spec.location or self.location
+        # Con selection, los candidatos de la región del más barato al más caro
+        sizes = self.selector.rank(spec.selection, location, spot=spec.spot, os_name=spec.os) if spec.selection else [spec.vm_size]
+        if not sizes:
+            raise ConfigurationError(f"Pool {spec.pool_name}: ningún candidato de azure.selection cumple los requisitos en {location}")
+        for index, size in enumerate(sizes):
+            properties["hardwareProfile"] = {"vmSize": size}
+            logger.info(f"☁️ Creando VM {name} ({size}{', spot' if spec.spot else ''}) en {location}")
+            try:
+                self.client.request("PUT", path, {"location": location, "tags": tags, "properties": properties}, wait=True, timeout=self.provision_timeout)
+            except AzureError as e:
+                if str(e).split(":")[0].strip() not in SIZE_FALLBACK_ERRORS or index == len(sizes) - 1:
+                    raise
+                logger.warning(f"⚠️ Sin capacidad para {size} en {location} ({e}), probando el siguiente tamaño")
+                # La VM fallida queda creada en estado Failed: se elimina antes de reintentar
+                try:
+                    self.client.request("DELETE", path, wait=True, timeout=self.provision_timeout)
+                except AzureError:
+                    pass
+                continue
+            if spec.selection:
+                self.selector.record(spec.pool_name, location, size)
+            break
+        return path
+
+    def _acquire_instance(self, spec: AzurePoolSpec, pool_name: str) -> str:
+        """Instancia desasignada del scale set (se arranca) o una nueva ampliando la capacidad."""
+        base = f"/virtualMachineScaleSets/{spec.vmss}"
+        with self.lock:
+            in_use = {runner.path for runner in self.runners.values()}
+            instances = self.client.request("GET", f"{base}/virtualMachines?$expand=instanceView").get("value", [])
+            for instance in instances:
+                path = f"{base}/virtualMachines/{instance['instanceId']}"
+                states = [s.get("code") for s in instance.get("properties", {}).get("instanceView", {}).get("statuses", [])]
+                if path not in in_use and ("PowerState/deallocated" in states or "PowerState/stopped" in states):
+                    # Se marca ocupada antes de arrancarla para que otra creación no la elija
+                    self.runners[f"pending-{uuid.uuid4().hex}"] = AzureRunner(self, path, {}, spec)
+                    break
+            else:
+                path = None
+                if len(instances) >= spec.max_instances:
+                    raise ValueError(f"Pool {pool_name}: scale set {spec.vmss} en su máximo ({spec.max_instances})")
+
+        if path:
+            logger.info(f"☁️ Arrancando instancia desasignada {spec.vmss}/{path.rsplit('/', 1)[-1]}")
+            try:
+                self.client.request("POST", f"{path}/start", wait=True, timeout=self.provision_timeout)
+            finally:
+                self._drop_pending(path)
+            return path
+
+        known = {instance["instanceId"] for instance in instances}
+        scale_set = self.client.request("GET", base)
+        capacity = int(scale_set["sku"]["capacity"]) + 1
+        logger.info(f"☁️ Ampliando scale set {spec.vmss} a {capacity} instancias")
+        self.client.request("PATCH", base, {"sku": {**scale_set["sku"], "capacity": capacity}}, wait=True, timeout=self.provision_timeout)
+        for instance in self.client.request("GET", f"{base}/virtualMachines").get("value", []):
+            if instance["instanceId"] not in known:
+                return f"{base}/virtualMachines/{instance['instanceId']}"
+        raise AzureError(f"El scale set {spec.vmss} no creó una instancia nueva")
+
+    def _claim_warm(self, spec: AzurePoolSpec, pool_name: str, labels: Dict[str, str]) -> Optional[str]:
+        """
+        Reanuda una VM hibernada del pool y le pone los tags del runner.
+
+        Retorna None si no hay ninguna lista o si falla al reclamarla; en ese caso el
+        runner se crea en una VM nueva.
+        """
+        candidates = sorted(
+            (vm for vm in self.client.request("GET", "/virtualMachines").get("value", [])
+             if (vm.get("tags") or {}).get(WARM_TAG) == pool_name),
+            key=lambda vm: vm.get("properties", {}).get("timeCreated", ""),
+        )
+        with self.lock:
+            candidates = [vm for vm in candidates if vm["name"] not in self.claiming]
+        for vm in candidates:
+            path = f"/virtualMachines/{vm['name']}"
+            states = [status.get("code") for status in self.client.request("GET", f"{path}/instanceView").get("statuses", [])]
+            if "PowerState/deallocated" not in states:
+                continue
+            with self.lock:
+                if vm["name"] in self.claiming:
+                    continue
+                self.claiming.add(vm["name"])
+            try:
+                logger.info(f"⚡ Reanudando VM precalentada {vm['name']} (pool {pool_name})")
+                # Sin el tag de precalentada deja de contar para el refresco y pasa a ser un runner más
+                tags = {key: str(value)[:256] for key, value in labels.items()}
+                tags["azure-os"] = spec.os
+                self.client.request("PATCH", path, {"tags": tags}, wait=True, timeout=self.provision_timeout)
+                self.client.request("POST", f"{path}/start", wait=True, timeout=self.provision_timeout)
+                with self.lock:
+                    self.warm_claims += 1
+                return path
+            except AzureError as e:
+                logger.warning(f"⚠️ No se pudo reclamar la VM {vm['name']} ({e}), creando una VM nueva")
+                try:
+                    self.client.request("DELETE", path)
+                except AzureError:
+                    pass
+                return None
+            finally:
+                with self.lock:
+                    self.claiming.discard(vm["name"])
+        with self.lock:
+            self.warm_misses += 1
+        logger.info(f"🧊 Sin VMs precalentadas en el pool {pool_name}, creando una nueva")
+        return None
+
+    def refresh_warm(self, pools: Dict[str, Dict[str, Any]]) -> Dict[str, Dict[str, int]]:
+        """
+        Mantiene las VMs precalentadas de los pools con "warm".
+
+        Hiberna las que terminaron de arrancar, crea las que faltan y elimina las que
+        superan warm_max_age (así las nuevas toman la imagen actual), las que quedaron
+        en otro estado y las de pools que ya no tienen "warm".
+        """
+        by_pool: Dict[str, List[Dict[str, Any]]] = {}
+        for vm in self.client.request("GET", "/virtualMachines").get("value", []):
+            pool_name = (vm.get("tags") or {}).get(WARM_TAG)
+            if pool_name:
+                by_pool.setdefault(pool_name, []).append(vm)
+        with self.lock:
+            claiming = set(self.claiming)
+        now = datetime.now(timezone.utc)
+
+        summary = {}
+        for pool_name, vms in by_pool.items():
+            if pool_name not in pools:
+                for vm in vms:
+                    if vm["name"] not in claiming:
+                        self.client.request("DELETE", f"/virtualMachines/{vm['name']}")
+        for pool_name, pool_spec in pools.items():
+            spec = AzurePoolSpec(pool_name, pool_spec)
+            ready = 0
+            for vm in by_pool.get(pool_name, []):
+                if vm["name"] in claiming:
+                    continue
+                path = f"/virtualMachines/{vm['name']}"
+                created = vm.get("properties", {}).get("timeCreated", "")
+                # timeCreated viene en UTC con fracciones de hasta 7 dígitos
+                age = (now - datetime.strptime(created[:19], "%Y-%m-%dT%H:%M:%S").replace(tzinfo=timezone.utc)).total_seconds() if created else 0
+                states = [status.get("code") for status in self.client.request("GET", f"{path}/instanceView").get("statuses", [])]
+                if age > spec.warm_max_age or not any(state in states for state in RUNNING_STATES + ("PowerState/deallocating", "PowerState/deallocated")):
+                    logger.info(f"♻️ Reciclando VM precalentada {vm['name']} ({', '.join(code for code in states if code)}, {int(age)}s)")
+                    self.client.request("DELETE", path)
+                    continue
+                if "PowerState/running" in states:
+                    logger.info(f"💤 Hibernando VM precalentada {vm['name']}")
+                    self.client.request("POST", f"{path}/deallocate?hibernate=true")
+                ready += 1
+            for _ in range(spec.warm - ready):
+                name = f"warm-{pool_name}-{uuid.uuid4().hex[:8]}"
+                try:
+                    path = self._create_vm(spec, name, {"managed-by": MANAGED_BY, WARM_TAG: pool_name, "runner-pool": pool_name}, hibernation=True)
+                    # La creación espera al aprovisionamiento del sistema: ya se puede hibernar
+                    self.client.request("POST", f"{path}/deallocate?hibernate=true")
+                    ready += 1
+                except AzureError as e:
+                    logger.warning(f"⚠️ No se pudo crear VM precalentada para {pool_name}: {e}")
+                    break
+            summary[pool_name] = {"ready": ready, "target": spec.warm}
+        with self.lock:
+            self.warm_status = summary
+        return summary
+
+    def _drop_pending(self, path: str):
+        with self.lock:
+            for key in [key for key, runner in self.runners.items() if key.startswith("pending-") and runner.path == path]:
+                self.runners.pop(key)
+
+    def runner_status(self, runner: AzureRunner) -> str:
+        try:
+            view = self.client.request("GET", f"{runner.path}/instanceView")
+        except AzureError as e:
+            # VM eliminada (desalojo spot) o sin acceso: se considera terminada salvo error transitorio
+            if "NotFound" in str(e):
+                runner.attrs["State"] = {"Status": "NotFound"}
+                return "exited"
+            return runner.status
+        states = [status.get("code") for status in view.get("statuses", [])]
+        runner.attrs["State"] = {"Status": ", ".join(code for code in states if code)}
+        return "running" if any(code in RUNNING_STATES for code in states) else "exited"
+
+    def release(self, runner: AzureRunner):
+        """Elimina la VM individual (con disco y NIC) o desasigna la instancia del scale set."""
+        if runner.spec.vmss:
+            logger.info(f"💤 Desasignando instancia {runner.spec.vmss}/{runner.id}")
+            self.client.request("POST", f"{runner.path}/deallocate", wait=True, timeout=self.provision_timeout)
+        else:
+            logger.info(f"🗑️ Eliminando VM {runner.id}")
+            self.client.request("DELETE", runner.path, wait=True, timeout=self.provision_timeout)
+        with self.lock:
+            self.runners.pop(runner.labels.get("runner-name", ""), None)
+        runner.status = "exited"
+        if not runner.spec.vmss:
+            self.egress.release(runner.labels.get("runner-pool"))
+
+    def force_delete(self, runner: AzureRunner):
+        """Elimina con forceDeletion la VM o la instancia del scale set atascada deteniéndose."""
+        logger.info(f"🗑️ Eliminación forzada de {runner.id}")
+        self.client.request("DELETE", runner.path, params={"forceDeletion": "true"}, wait=True, timeout=self.provision_timeout)
+        with self.lock:
+            self.runners.pop(runner.labels.get("runner-name", ""), None)
+        runner.status = "exited"
+        if not runner.spec.vmss:
+            self.egress.release(runner.labels.get("runner-pool"))
+
+    def runner_logs(self, runner: AzureRunner, tail: int = 50) -> str:
+        if runner.spec.os == "windows":
+            command = {"commandId": "RunPowerShellScript", "script": [
+                f"Get-Content -Tail {int(tail)} (Join-Path {_powershell_quote(runner.spec.runner_dir)} 'runner.log')",
+            ]}
+        else:
+            command = {"commandId": "RunShellScript", "script": [f"tail -n {int(tail)} {shlex.quote(runner.spec.runner_dir)}/runner.log"]}
+        result = self.client.request("POST", f"{runner.path}/runCommand", command, wait=True, timeout=120)
+        messages = [status.get("message", "") for status in (result.get("properties", {}).get("output") or result).get("value", [])]
+        return redactor.redact("\n".join(messages))
+
+    def get(self, runner_name: str) -> Optional[AzureRunner]:
+        with self.lock:
+            return self.runners.get(runner_name)
+
+    def list_runners(self) -> List[AzureRunner]:
+        """Runners en ejecución: VMs etiquetadas por el orchestrator e instancias de scale set en uso."""
+        result = []
+        with self.lock:
+            tracked = {name: runner for name, runner in self.runners.items() if not name.startswith("pending-")}
+        for vm in self.client.request("GET", "/virtualMachines").get("value", []):
+            tags = vm.get("tags") or {}
+            # Las precalentadas las gestiona refresh_warm
+            if tags.get("managed-by") != MANAGED_BY or tags.get(WARM_TAG) or tags.get("runner-name") in tracked:
+                continue
+            runner = AzureRunner(self, f"/virtualMachines/{vm['name']}", tags, AzurePoolSpec("", {"image": "-", "os": tags.get("azure-os", "linux")}))
+            runner.reload()
+            if runner.status == "running":
+                result.append(runner)
+        for runner in tracked.values():
+            if runner.status == "running":
+                result.append(runner)
+        # NSGs que seguían asociados a NICs de VMs ya eliminadas
+        self.egress.sweep()
+        return result
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            runners = [runner for name, runner in self.runners.items() if not name.startswith("pending-")]
+        return {
+            "location": self.location,
+            "auth": self.client.credentials.method,
+            "runners": len(runners),
+            "scale_sets": sorted({runner.spec.vmss for runner in runners if runner.spec.vmss}),
+            "warm": dict(self.warm_status),
+            "warm_claims": self.warm_claims,
+            "warm_misses": self.warm_misses,
+            "egress": self.egress.status(),
+            "instance_selection": self.selector.status(),
+        }
+
+
+def validate_pool_spec(pool_name: str, spec: Dict[str, Any]):
+    """Valida las opciones "azure" de un pool al cargarlo."""
+    unknown = set(spec) - set(POOL_KEYS)
+    if unknown:
+        raise ConfigurationError(f"Pool {pool_name}: opciones azure desconocidas: {', '.join(sorted(unknown))}")
+    if not spec.get("vmss") and not spec.get("image"):
+        raise ConfigurationError(f"Pool {pool_name}: azure requiere vmss (scale set) o image (VM individual)")
+    if spec.get("os", "linux") not in ("linux", "windows"):
+        raise ConfigurationError(f"Pool {pool_name}: azure.os debe ser linux o windows")
+    if spec.get("warm"):
+        # Los scale sets ya reutilizan instancias desasignadas; Azure no hiberna VMs spot
+        if spec.get("vmss") or spec.get("spot"):
+            raise ConfigurationError(f"Pool {pool_name}: azure.warm solo admite VMs individuales que no sean spot")
+        if int(spec["warm"]) < 0:
+            raise ConfigurationError(f"Pool {pool_name}: azure.warm no puede ser negativo")
+    if spec.get("selection") is not None:
+        validate_selection(pool_name, "azure", spec["selection"])
+        if spec.get("vmss") or spec.get("vm_size"):
+            raise ConfigurationError(f"Pool {pool_name}: azure.selection no se combina con vm_size ni con vmss")
+    image = spec.get("image")
+    if image and not image.startswith("/") and len(image.split(":")) != 4:
+        raise ConfigurationError(f"Pool {pool_name}: azure.image debe ser un ID de galería o publisher:offer:sku:version")
+    startup_templates.validate(pool_name, spec)
+
+
+def create_azure_backend() -> Optional[AzureBackend]:
+    """Backend desde AZURE_SUBSCRIPTION_ID y AZURE_*, o None si no está configurado."""
+    subscription_id = os.getenv("AZURE_SUBSCRIPTION_ID")
+    if not subscription_id:
+        return None
+    resource_group = os.getenv("AZURE_RESOURCE_GROUP")
+    location = os.getenv("AZURE_LOCATION")
+    if not resource_group or not location:
+        raise ConfigurationError("AZURE_RESOURCE_GROUP y AZURE_LOCATION son obligatorios con AZURE_SUBSCRIPTION_ID")
+
+    credentials = AzureCredentials(os.getenv("AZURE_TENANT_ID"), os.getenv("AZURE_CLIENT_ID"), os.getenv("AZURE_CLIENT_SECRET"))
+    backend = AzureBackend(
+        AzureClient(credentials, subscription_id, resource_group),
+        location=location,
+        subnet_id=os.getenv("AZURE_SUBNET_ID"),
+        provision_timeout=int(os.getenv("AZURE_PROVISION_TIMEOUT", "900")),
+    )
+    logger.info(format_log('CONFIG', 'Backend Azure', f"{resource_group} en {location} ({credentials.method})"))
+    return backend
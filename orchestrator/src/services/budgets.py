@@ -0,0 +1,379 @@
+"""
+Topes de gasto mensual por tenant y por pool.
+El gasto sale del registro de uso (usage.py): cada BUDGET_CHECK_INTERVAL se calcula el
+gasto del mes en curso y su proyección a fin de mes. Al cruzar cada umbral de
+BUDGET_WARN_THRESHOLDS se emite budget.threshold_crossed (una vez por mes) y al llegar a
+BUDGET_FREEZE_THRESHOLD se congela el escalado de los pools no prioritarios del tenant o
+pool hasta que la proyección baje, empiece otro mes o se suba el tope. Un token de
+excepción permite seguir creando runners durante una emergencia.
+"""
+
+import calendar
+import datetime
+import hashlib
+import json
+import os
+import secrets
+import threading
+import time
+import uuid
+from typing import Any, Dict, List, Optional, Tuple
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.usage import usage_ledger
+from src.utils.helpers import BudgetExceededError, ConfigurationError, ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+KINDS = ("tenant", "pool")
+
+# Horas máximas de un token de excepción
+MAX_OVERRIDE_HOURS = 72
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+def _hash(token: str) -> str:
+    return hashlib.sha256(token.encode()).hexdigest()
+
+
+def parse_thresholds(spec: str) -> List[float]:
+    try:
+        return sorted(float(item) for item in spec.split(",") if item.strip())
+    except ValueError:
+        raise ConfigurationError(f"BUDGET_WARN_THRESHOLDS inválido: {spec} (fracciones separadas por coma)")
+
+
+class BudgetRegistry:
+    """
+    Topes mensuales, estado de congelación y tokens de excepción, persistidos en BUDGETS_FILE.
+
+    La proyección es gasto / días transcurridos * días del mes, con al menos `min_days`
+    días transcurridos para que un pico el día 1 no congele todo el mes.
+    """
+
+    def __init__(self, state_file: str, ledger: Any, warn_thresholds: List[float],
+                 freeze_threshold: float = 1.0, min_days: float = 3):
+        self.state_file = state_file
+        self.ledger = ledger
+        self.warn_thresholds = warn_thresholds
+        self.freeze_threshold = freeze_threshold
+        self.min_days = min_days
+        self.budgets: Dict[str, Dict[str, Any]] = {}
+        self.overrides: Dict[str, Dict[str, Any]] = {}
+        # Umbrales ya avisados: {mes: {kind:name: [umbral, ...]}}
+        self.notified: Dict[str, Dict[str, List[float]]] = {}
+        self.frozen: Dict[str, Dict[str, Any]] = {}
+        self.evaluated: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self._load_state()
+
+    @staticmethod
+    def key(kind: str, name: str) -> str:
+        return f"{kind}:{name}"
+
+    def _load_state(self):
+        if not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                data = json.load(state)
+            self.budgets = data.get("budgets", {})
+            self.overrides = {item["id"]: item for item in data.get("overrides", [])}
+            self.notified = data.get("notified", {})
+            logger.info(format_log('CONFIG', 'Topes de gasto cargados', f"{len(self.budgets)} en {self.state_file}"))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de los topes de gasto', str(e)))
+
+    def _save_state(self):
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({
+                "budgets": self.budgets,
+                "overrides": list(self.overrides.values()),
+                "notified": self.notified,
+            }, state)
+        os.replace(tmp_file, self.state_file)
+
+    # ===== Topes =====
+
+    def set(self, kind: str, name: str, monthly: float, updated_by: str = "") -> Dict[str, Any]:
+        """Fija el tope mensual de un tenant o pool (en la moneda de USAGE_CURRENCY)."""
+        if kind not in KINDS:
+            raise ValidationError(f"Tipo de tope desconocido: {kind} ({', '.join(KINDS)})")
+        if monthly <= 0:
+            raise ValidationError("El tope mensual debe ser positivo")
+        budget = {"kind": kind, "name": name, "monthly": monthly, "updated_by": updated_by, "updated_at": _now()}
+        with self.lock:
+            self.budgets[self.key(kind, name)] = budget
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Tope de gasto fijado', f"{kind} {name}: {monthly} {self.ledger.currency}/mes"))
+        self.evaluate()
+        return budget
+
+    def remove(self, kind: str, name: str) -> bool:
+        with self.lock:
+            if self.budgets.pop(self.key(kind, name), None) is None:
+                return False
+            self._save_state()
+        self.evaluate()
+        return True
+
+    # ===== Evaluación =====
+
+    def _spend(self, month: str) -> Dict[str, float]:
+        """Gasto del mes por tenant y por pool (un pool puede sumar filas de varios tenants)."""
+        report = self.ledger.report(month)
+        spend: Dict[str, float] = {}
+        for summary in report["tenants"]:
+            spend[self.key("tenant", summary["tenant"])] = summary["cost"]
+            for entry in summary["pools"]:
+                pool_key = self.key("pool", entry["pool"])
+                spend[pool_key] = round(spend.get(pool_key, 0.0) + entry["cost"], 4)
+        return spend
+
+    def _projection(self, now: float) -> Tuple[str, float]:
+        """Mes en curso y factor de proyección a fin de mes."""
+        today = datetime.datetime.fromtimestamp(now, tz=datetime.timezone.utc)
+        days = calendar.monthrange(today.year, today.month)[1]
+        start = today.replace(day=1, hour=0, minute=0, second=0, microsecond=0)
+        elapsed = (today - start).total_seconds() / 86400
+        return today.strftime("%Y-%m"), days / min(days, max(elapsed, self.min_days))
+
+    def evaluate(self) -> Dict[str, Dict[str, Any]]:
+        """Recalcula gasto y proyección de cada tope, avisa de los umbrales y congela o descongela."""
+        month, factor = self._projection(time.time())
+        spend = self._spend(month)
+        with self.lock:
+            budgets = list(self.budgets.values())
+        evaluated = {}
+        for budget in budgets:
+            key = self.key(budget["kind"], budget["name"])
+            current = spend.get(key, 0.0)
+            projected = round(current * factor, 4)
+            ratio = round(projected / budget["monthly"], 4)
+            evaluated[key] = {
+                **budget, "month": month, "spend": current, "projected": projected, "ratio": ratio,
+                "currency": self.ledger.currency,
+            }
+            tags = {"kind": budget["kind"], "name": budget["name"]}
+            metrics.gauge("budgets.spend", current, tags=tags)
+            metrics.gauge("budgets.projected_ratio", ratio, tags=tags)
+            self._warn(month, evaluated[key])
+            self._update_freeze(key, evaluated[key])
+        with self.lock:
+            for key in list(self.frozen):
+                if key not in evaluated:
+                    # Tope eliminado
+                    self._unfreeze(key, self.frozen[key])
+            self.evaluated = evaluated
+        return evaluated
+
+    def _warn(self, month: str, entry: Dict[str, Any]):
+        key = self.key(entry["kind"], entry["name"])
+        with self.lock:
+            notified = self.notified.setdefault(month, {}).setdefault(key, [])
+            crossed = [threshold for threshold in self.warn_thresholds
+                       if entry["ratio"] >= threshold and threshold not in notified]
+            if not crossed:
+                return
+            notified.extend(crossed)
+            # Solo se guardan los avisos del mes en curso
+            self.notified = {month: self.notified[month]}
+            self._save_state()
+        threshold = crossed[-1]
+        metrics.incr("budgets.threshold_crossed", tags={"kind": entry["kind"], "name": entry["name"]})
+        logger.warning(format_log(
+            'WARNING', 'Proyección de gasto sobre el umbral',
+            f"{entry['kind']} {entry['name']}: {entry['projected']} de {entry['monthly']} {entry['currency']} "
+            f"({int(threshold * 100)}%)"
+        ))
+        lifecycle_events.emit(
+            "budget.threshold_crossed", key=key,
+            kind=entry["kind"], name=entry["name"], month=month, threshold=threshold,
+            spend=entry["spend"], projected=entry["projected"], monthly=entry["monthly"], currency=entry["currency"],
+        )
+
+    def _update_freeze(self, key: str, entry: Dict[str, Any]):
+        with self.lock:
+            frozen = key in self.frozen
+            if entry["ratio"] >= self.freeze_threshold and not frozen:
+                self.frozen[key] = {"since": _now(), **entry}
+                logger.warning(format_log(
+                    'WARNING', 'Escalado congelado por tope de gasto',
+                    f"{entry['kind']} {entry['name']}: proyección {entry['projected']} de {entry['monthly']} {entry['currency']}"
+                ))
+                lifecycle_events.emit(
+                    "budget.frozen", key=key,
+                    kind=entry["kind"], name=entry["name"], month=entry["month"],
+                    spend=entry["spend"], projected=entry["projected"], monthly=entry["monthly"],
+                )
+            elif entry["ratio"] < self.freeze_threshold and frozen:
+                self._unfreeze(key, entry)
+
+    def _unfreeze(self, key: str, entry: Dict[str, Any]):
+        """Se llama con el lock tomado."""
+        self.frozen.pop(key, None)
+        logger.info(format_log('SUCCESS', 'Escalado descongelado', f"{entry['kind']} {entry['name']}"))
+        lifecycle_events.emit("budget.unfrozen", key=key, kind=entry["kind"], name=entry["name"])
+
+    def status(self) -> List[Dict[str, Any]]:
+        """Topes con gasto, proyección, estado (ok, warning, frozen) y excepciones activas."""
+        evaluated = self.evaluate()
+        now = time.time()
+        lowest_warning = self.warn_thresholds[0] if self.warn_thresholds else self.freeze_threshold
+        with self.lock:
+            overrides = [item for item in self.overrides.values() if item["expires_at"] > now]
+            frozen = set(self.frozen)
+        result = []
+        for key, entry in sorted(evaluated.items()):
+            state = "frozen" if key in frozen else ("warning" if entry["ratio"] >= lowest_warning else "ok")
+            result.append({
+                **entry, "state": state,
+                "overrides": [self._public(item) for item in overrides if self.key(item["kind"], item["name"]) == key],
+            })
+        return result
+
+    # ===== Excepciones =====
+
+    @staticmethod
+    def _public(override: Dict[str, Any]) -> Dict[str, Any]:
+        return {field: value for field, value in override.items() if field != "token_sha256"}
+
+    def create_override(self, kind: str, name: str, hours: float, reason: str, created_by: str = "",
+                        blanket: bool = False, token: Optional[str] = None,
+                        override_id: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Token de excepción para un tenant o pool congelado.
+
+        Las peticiones que lo envían en budget_override crean runners pese a la congelación;
+        con blanket=True la excepción vale para todo el escalado del objetivo (autoscaler y
+        webhooks incluidos). El token solo se devuelve aquí.
+        """
+        if kind not in KINDS:
+            raise ValidationError(f"Tipo de tope desconocido: {kind} ({', '.join(KINDS)})")
+        if not 0 < hours <= MAX_OVERRIDE_HOURS:
+            raise ValidationError(f"La excepción debe durar entre 0 y {MAX_OVERRIDE_HOURS} horas")
+        if not reason:
+            raise ValidationError("La excepción requiere un motivo ('reason')")
+        token = token or secrets.token_urlsafe(24)
+        override = {
+            "id": override_id or str(uuid.uuid4()),
+            "kind": kind,
+            "name": name,
+            "blanket": blanket,
+            "reason": reason,
+            "created_by": created_by,
+            "created_at": _now(),
+            "expires_at": time.time() + hours * 3600,
+            "token_sha256": _hash(token),
+        }
+        now = time.time()
+        with self.lock:
+            # Las caducadas se purgan al crear otras
+            self.overrides = {key: item for key, item in self.overrides.items() if item["expires_at"] > now}
+            self.overrides[override["id"]] = override
+            self._save_state()
+        metrics.incr("budgets.overrides_created", tags={"kind": kind, "name": name})
+        logger.warning(format_log(
+            'WARNING', 'Excepción de tope de gasto creada',
+            f"{kind} {name} durante {hours}h por {created_by or '-'}{' (todo el escalado)' if blanket else ''}: {reason}"
+        ))
+        lifecycle_events.emit(
+            "budget.override_created", key=self.key(kind, name),
+            id=override["id"], kind=kind, name=name, blanket=blanket, reason=reason,
+            created_by=created_by, expires_at=override["expires_at"],
+        )
+        return {**self._public(override), "token": token}
+
+    def revoke_override(self, override_id: str) -> bool:
+        with self.lock:
+            if self.overrides.pop(override_id, None) is None:
+                return False
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Excepción de tope de gasto revocada', override_id))
+        return True
+
+    def _overridden(self, key: str, token: Optional[str]) -> bool:
+        now = time.time()
+        token_hash = _hash(token) if token else None
+        for item in self.overrides.values():
+            if item["expires_at"] <= now or self.key(item["kind"], item["name"]) != key:
+                continue
+            if item["blanket"] or item["token_sha256"] == token_hash:
+                return True
+        return False
+
+    # ===== Aplicación =====
+
+    def check(self, tenant: Optional[str], pool: Any, override: Optional[str] = None):
+        """
+        Rechaza el escalado de un pool no prioritario cuyo tenant o pool está congelado.
+
+        Raises:
+            BudgetExceededError: Si el objetivo está congelado y no hay una excepción válida
+        """
+        if getattr(pool, "priority", False):
+            return
+        targets = [self.key("pool", pool.name)]
+        if tenant:
+            targets.append(self.key("tenant", tenant))
+        with self.lock:
+            for key in targets:
+                entry = self.frozen.get(key)
+                if not entry:
+                    continue
+                if self._overridden(key, override):
+                    metrics.incr("budgets.override_used", tags={"kind": entry["kind"], "name": entry["name"]})
+                    continue
+                metrics.incr("budgets.rejected", tags={"kind": entry["kind"], "name": entry["name"]})
+                raise BudgetExceededError(
+                    f"Escalado congelado: la proyección de gasto de {entry['kind']} {entry['name']} "
+                    f"({entry['projected']} {entry['currency']}) supera el tope mensual de {entry['monthly']}"
+                )
+
+
+class BudgetMonitor:
+    """Hilo que reevalúa los topes cada `interval` segundos."""
+
+    def __init__(self, registry: BudgetRegistry, interval: int = 300):
+        self.registry = registry
+        self.interval = interval
+        self.stop_event = threading.Event()
+
+    def start(self):
+        threading.Thread(target=self._loop, daemon=True).start()
+        logger.info(format_log('CONFIG', 'Topes de gasto activados', f"evaluación cada {self.interval}s"))
+
+    def stop(self):
+        self.stop_event.set()
+
+    def _loop(self):
+        while not self.stop_event.is_set():
+            try:
+                self.registry.evaluate()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error evaluando los topes de gasto', str(e)))
+            self.stop_event.wait(self.interval)
+
+
+def create_budget_registry() -> Optional[BudgetRegistry]:
+    """Topes de gasto si BUDGETS_FILE está definido (requiere USAGE_DB_PATH)."""
+    state_file = os.getenv("BUDGETS_FILE")
+    if not state_file:
+        return None
+    if not usage_ledger:
+        raise ConfigurationError("BUDGETS_FILE requiere USAGE_DB_PATH (el gasto sale del registro de uso)")
+    return BudgetRegistry(
+        state_file,
+        usage_ledger,
+        parse_thresholds(os.getenv("BUDGET_WARN_THRESHOLDS", "0.75,0.9")),
+        freeze_threshold=float(os.getenv("BUDGET_FREEZE_THRESHOLD", "1.0")),
+        min_days=float(os.getenv("BUDGET_PROJECTION_MIN_DAYS", "3")),
+    )
+
+
+budgets = create_budget_registry()
@@ -0,0 +1,292 @@
+"""
+Operaciones masivas de administración.
+Vaciar varios pools, reciclar los runners más antiguos que una edad o cambiar las
+labels de varios pools se envía como una operación asíncrona: la API devuelve su id
+al momento y la operación avanza en segundo plano, ítem por ítem, con progreso y
+resultado por ítem consultables mientras corre. Las operaciones se conservan en
+memoria (las últimas BULK_HISTORY_SIZE) y actúan sobre los runners de esta réplica.
+"""
+
+import collections
+import datetime
+import os
+import threading
+import time
+import uuid
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.pool_archive import pool_archive
+from src.services.pools import DEFAULT_POOL
+from src.services.usage import parse_time
+from src.utils.helpers import ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+KINDS = ("drain_pools", "recycle_runners", "retag_pools")
+
+# Estado de la operación al terminar según el resultado de sus ítems
+FINISHED = ("completed", "partial", "failed", "cancelled")
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+class BulkOperations:
+    """Operaciones masivas en curso y recientes, cada una ejecutada en su propio hilo."""
+
+    def __init__(self, lifecycle_manager: Any, history: int = 100):
+        self.lifecycle_manager = lifecycle_manager
+        self.history = history
+        self.operations: "collections.OrderedDict[str, Dict[str, Any]]" = collections.OrderedDict()
+        self.lock = threading.Lock()
+        self.stop_event = threading.Event()
+
+    def stop(self):
+        # Las operaciones en curso se detienen antes del siguiente ítem
+        self.stop_event.set()
+
+    # ===== Envío y consulta =====
+
+    def submit(self, kind: str, params: Dict[str, Any], submitted_by: str = "", operation_id: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Valida la operación, calcula sus ítems y la lanza en segundo plano.
+
+        Raises:
+            ValidationError: Si el tipo o los parámetros no son válidos
+        """
+        if kind not in KINDS:
+            raise ValidationError(f"Operación desconocida: {kind} ({', '.join(KINDS)})")
+        items, action = getattr(self, f"_plan_{kind}")(params, submitted_by)
+        operation = {
+            "id": operation_id or str(uuid.uuid4()),
+            "kind": kind,
+            "params": params,
+            "status": "pending",
+            "submitted_by": submitted_by,
+            "submitted_at": _now(),
+            "started_at": None,
+            "finished_at": None,
+            "progress": {"total": len(items), "done": 0, "succeeded": 0, "failed": 0, "skipped": 0},
+            "items": [{"item": item, "status": "pending", "detail": None} for item in items],
+        }
+        with self.lock:
+            if operation["id"] in self.operations:
+                raise ValidationError(f"La operación {operation['id']} ya existe")
+            self.operations[operation["id"]] = operation
+            while len(self.operations) > self.history:
+                oldest = next(
+                    (key for key, entry in self.operations.items() if entry["status"] in FINISHED),
+                    None,
+                )
+                if oldest is None:
+                    break
+                self.operations.pop(oldest)
+        logger.info(format_log(
+            'INFO', 'Operación masiva enviada',
+            f"{kind} {operation['id']} por {submitted_by or '-'}: {len(items)} ítems",
+        ))
+        threading.Thread(target=self._run, args=(operation, action), daemon=True).start()
+        return self.summary(operation)
+
+    @staticmethod
+    def summary(operation: Dict[str, Any]) -> Dict[str, Any]:
+        return {key: value for key, value in operation.items() if key != "items"}
+
+    def get(self, operation_id: str, items: bool = False) -> Dict[str, Any]:
+        with self.lock:
+            operation = self.operations.get(operation_id)
+            if not operation:
+                raise ValueError(f"Operación masiva no encontrada: {operation_id}")
+            if items:
+                return {**operation, "progress": dict(operation["progress"]), "items": [dict(item) for item in operation["items"]]}
+            return {**self.summary(operation), "progress": dict(operation["progress"])}
+
+    def list(self, status: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            operations = [
+                {**self.summary(operation), "progress": dict(operation["progress"])}
+                for operation in self.operations.values()
+                if status is None or operation["status"] == status
+            ]
+        return list(reversed(operations))
+
+    # ===== Ejecución =====
+
+    def _run(self, operation: Dict[str, Any], action: Callable[[str], Tuple[str, Any]]):
+        with self.lock:
+            operation["status"] = "running"
+            operation["started_at"] = _now()
+        for entry in operation["items"]:
+            if self.stop_event.is_set():
+                break
+            try:
+                status, detail = action(entry["item"])
+            except Exception as e:
+                logger.error(format_log('ERROR', f"Error en la operación masiva {operation['id']}", f"{entry['item']}: {e}"))
+                status, detail = "failed", str(e)
+            with self.lock:
+                entry["status"], entry["detail"] = status, detail
+                progress = operation["progress"]
+                progress["done"] += 1
+                progress[status if status in ("failed", "skipped") else "succeeded"] += 1
+
+        with self.lock:
+            progress = operation["progress"]
+            if progress["done"] < progress["total"]:
+                operation["status"] = "cancelled"
+            elif progress["failed"] == 0:
+                operation["status"] = "completed"
+            elif progress["failed"] < progress["total"]:
+                operation["status"] = "partial"
+            else:
+                operation["status"] = "failed"
+            operation["finished_at"] = _now()
+            result = self.summary(operation)
+        message = f"{operation['kind']} {operation['id']}: {progress['succeeded']} ok, {progress['failed']} fallidos, {progress['skipped']} omitidos"
+        if result["status"] == "completed":
+            logger.info(format_log('SUCCESS', 'Operación masiva terminada', message))
+        else:
+            logger.warning(format_log('WARNING', f"Operación masiva terminada ({result['status']})", message))
+        metrics.incr("bulk.operations", tags={"kind": operation["kind"], "status": result["status"]})
+        lifecycle_events.emit("bulk.finished", key=operation["id"], **result)
+
+    # ===== Runners =====
+
+    def _pool_of(self, container: Any) -> str:
+        return (getattr(container, "labels", None) or {}).get("runner-pool", DEFAULT_POOL)
+
+    def busy(self, names: List[str]) -> Dict[str, bool]:
+        """
+        Runners con un job en curso según su registro en GitHub. Si GitHub no responde
+        para un ámbito, sus runners se dan por ocupados para no cortar ningún job.
+        """
+        manager = self.lifecycle_manager
+        scopes: Dict[Tuple[str, str], List[str]] = {}
+        busy: Dict[str, bool] = {}
+        for name in names:
+            labels = getattr(manager.active_runners.get(name), "labels", None) or {}
+            if labels.get("scope") and labels.get("scope_name"):
+                scopes.setdefault((labels["scope"], labels["scope_name"]), []).append(name)
+            else:
+                busy[name] = True
+        for scope, scope_names in scopes.items():
+            registrations = manager.github_cleanup.list_runners(*scope)
+            by_name = {runner["name"]: runner for runner in registrations or []}
+            for name in scope_names:
+                registration = by_name.get(name)
+                busy[name] = registrations is None or bool(registration and registration.get("busy", False))
+        return busy
+
+    def _destroy(self, runner_id: str, dry_run: bool) -> Tuple[str, Any]:
+        if runner_id not in self.lifecycle_manager.active_runners:
+            return "skipped", "el runner ya no existe"
+        if self.busy([runner_id]).get(runner_id, True):
+            # Los runners son efímeros: se destruyen solos al terminar su job
+            return "skipped", "ocupado con un job; se destruye al terminarlo"
+        if not self.lifecycle_manager.destroy_runner(runner_id, dry_run=dry_run):
+            return "failed", "runner no encontrado o no se pudo destruir"
+        return "succeeded", "simulado" if dry_run or self.lifecycle_manager.dry_run else "destruido"
+
+    # ===== Planes =====
+
+    def _pools(self, params: Dict[str, Any]) -> List[str]:
+        names = params.get("pools") or []
+        if not names:
+            raise ValidationError("La operación requiere al menos un pool en 'pools'")
+        registry = self.lifecycle_manager.pools
+        unknown = [name for name in names if name not in registry.pools and name not in registry.retired]
+        if unknown:
+            raise ValidationError(f"Pools desconocidos: {', '.join(unknown)}")
+        return list(dict.fromkeys(names))
+
+    def _plan_drain_pools(self, params: Dict[str, Any], submitted_by: str):
+        """Por pool: opcionalmente lo retira y destruye sus runners libres."""
+        names = self._pools(params)
+        retire = params.get("retire", False)
+        dry_run = params.get("dry_run", False)
+        if retire and not pool_archive:
+            raise ValidationError("Retirar los pools requiere el archivo de pools (POOL_ARCHIVE_FILE)")
+        if retire and DEFAULT_POOL in names:
+            raise ValidationError("El pool default no se puede retirar")
+
+        def drain(name: str) -> Tuple[str, Any]:
+            manager = self.lifecycle_manager
+            retired = False
+            if retire and not dry_run and name in manager.pools.pools:
+                with manager.runner_lock:
+                    pool_archive.retire(manager.pools.get(name), params.get("reason") or "Vaciado masivo", submitted_by)
+                    manager.pools.retired[name] = manager.pools.pools.pop(name)
+                retired = True
+            runners = [runner_id for runner_id, container in list(manager.active_runners.items()) if self._pool_of(container) == name]
+            busy = self.busy(runners)
+            destroyed, failed = [], []
+            for runner_id in runners:
+                if busy.get(runner_id, True):
+                    continue
+                (destroyed if manager.destroy_runner(runner_id, dry_run=dry_run) else failed).append(runner_id)
+            detail = {
+                "retired": retired,
+                "destroyed": destroyed,
+                "busy": [runner_id for runner_id in runners if busy.get(runner_id, True)],
+                "failed": failed,
+                "dry_run": dry_run or manager.dry_run,
+            }
+            return ("failed" if failed else "succeeded"), detail
+
+        return names, drain
+
+    def _plan_recycle_runners(self, params: Dict[str, Any], submitted_by: str):
+        """Un ítem por runner creado hace más de older_than segundos (opcionalmente de ciertos pools)."""
+        older_than = params.get("older_than")
+        if not older_than or older_than <= 0:
+            raise ValidationError("recycle_runners requiere 'older_than' (segundos) mayor que 0")
+        selected = set(self._pools(params)) if params.get("pools") else None
+        dry_run = params.get("dry_run", False)
+        cutoff = time.time() - older_than
+        runners = []
+        for runner_id, container in list(self.lifecycle_manager.active_runners.items()):
+            if selected is not None and self._pool_of(container) not in selected:
+                continue
+            created = parse_time((getattr(container, "attrs", None) or {}).get("Created"))
+            if created is not None and created < cutoff:
+                runners.append(runner_id)
+        # Los reemplazos los crea el escalado normal (webhooks, autoscaler o precalentado)
+        return sorted(runners), lambda runner_id: self._destroy(runner_id, dry_run)
+
+    def _plan_retag_pools(self, params: Dict[str, Any], submitted_by: str):
+        """Agrega o quita labels de cada pool; los runners en curso conservan las suyas."""
+        names = self._pools(params)
+        add = params.get("add_labels") or []
+        remove = params.get("remove_labels") or []
+        if not add and not remove:
+            raise ValidationError("retag_pools requiere 'add_labels' o 'remove_labels'")
+        dry_run = params.get("dry_run", False)
+
+        def retag(name: str) -> Tuple[str, Any]:
+            manager = self.lifecycle_manager
+            with manager.runner_lock:
+                pool = manager.pools.pools.get(name) or manager.pools.retired.get(name)
+                if pool is None:
+                    return "failed", "el pool ya no existe"
+                labels = [label for label in pool.labels if label not in remove]
+                labels += [label for label in add if label not in labels]
+                before = list(pool.labels)
+                if labels == before:
+                    return "skipped", {"labels": before}
+                if not dry_run:
+                    pool.labels = labels
+                    if pool_archive:
+                        pool_archive.set_labels(name, labels)
+            if not dry_run:
+                logger.info(format_log('SUCCESS', 'Labels de pool cambiadas', f"{name}: {', '.join(labels) or '-'}"))
+                lifecycle_events.emit("pool.retagged", key=name, pool=name, labels=labels, previous=before)
+            return "succeeded", {"labels": labels, "previous": before, "persisted": bool(pool_archive), "dry_run": dry_run}
+
+        return names, retag
+
+
+def create_bulk_operations(lifecycle_manager: Any) -> BulkOperations:
+    return BulkOperations(lifecycle_manager, history=int(os.getenv("BULK_HISTORY_SIZE", "100")))
@@ -0,0 +1,45 @@
+"""
+Proxy de caché de GitHub Actions (cmd/cache-proxy).
+Con CACHE_PROXY_URL configurado se inyecta ACTIONS_CACHE_URL en los runners, con el
+repositorio como namespace y, si hay CACHE_PROXY_SECRET, una firma HMAC para que un
+job no pueda usar la caché de otro repositorio cambiando la URL. Los pools con
+egress_proxy solo ven la red interna, donde el proxy es CACHE_PROXY_INTERNAL_URL.
+"""
+
+import hashlib
+import hmac
+import os
+from typing import Optional
+from urllib.parse import urlsplit
+
+
+def namespace_token(secret: str, namespace: str) -> str:
+    """Firma del namespace; debe coincidir con namespaceToken de cmd/cache-proxy."""
+    return hmac.new(secret.encode(), namespace.encode(), hashlib.sha256).hexdigest()[:32]
+
+
+def cache_proxy_base(internal: bool = False) -> Optional[str]:
+    """URL del proxy (la interna para runners en la red de egress), o None si no está configurado."""
+    if not os.getenv("CACHE_PROXY_URL"):
+        return None
+    if internal:
+        return os.getenv("CACHE_PROXY_INTERNAL_URL", "http://cache-proxy:8090").rstrip("/")
+    return os.getenv("CACHE_PROXY_URL").rstrip("/")
+
+
+def runner_cache_url(scope_name: str, internal: bool = False) -> Optional[str]:
+    """ACTIONS_CACHE_URL para un runner de scope_name, o None si el proxy no está configurado."""
+    base = cache_proxy_base(internal)
+    if not base:
+        return None
+    namespace = scope_name.strip("/").lower()
+    secret = os.getenv("CACHE_PROXY_SECRET")
+    if secret:
+        return f"{base}/{namespace_token(secret, namespace)}/{namespace}/"
+    return f"{base}/{namespace}/"
+
+
+def cache_proxy_hostname() -> Optional[str]:
+    """Host interno del proxy, para excluirlo del proxy de egress (NO_PROXY)."""
+    base = cache_proxy_base(internal=True)
+    return urlsplit(base).hostname if base else None
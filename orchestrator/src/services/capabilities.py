@@ -0,0 +1,196 @@
+"""
+Labels de capacidades del runner.
+Con RUNNER_CAPABILITY_LABELS (activado por defecto) cada runner se registra, además de con
+los labels de su pool, con los que describen la máquina donde corre, para que las listas
+de labels de los pools no se desvíen de la realidad:
+
+- arch-<x64|arm64|arm>, os-<distribución>-<versión>, cpu-<n>, mem-<n>g
+- gpu y gpu-<modelo> con GPUs NVIDIA (nvidia-smi), docker si el job tiene Docker
+
+En hosts SSH y VMs Linux los calcula el propio script que registra el agente
+(CAPABILITY_SCRIPT). En contenedores Docker salen de docker info del host, del
+/etc/os-release de la imagen (una vez por imagen) y de la clase de recursos del runner.
+Un pool puede cambiarlo con "capability_labels". Los labels observados por pool se usan
+al buscar el pool de un job (ver queued_jobs.py).
+"""
+
+import os
+import re
+import shlex
+import threading
+import time
+from typing import Any, Dict, List, Optional
+
+import docker
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+ARCHITECTURES = {"x86_64": "x64", "amd64": "x64", "aarch64": "arm64", "arm64": "arm64", "armv7l": "arm"}
+CAPABILITY_PREFIXES = ("arch-", "os-", "cpu-", "mem-", "gpu-")
+CAPABILITY_LABELS = ("gpu", "docker")
+INFO_TTL = 300
+
+# Deja en $caps los labels de capacidades de la máquina (POSIX sh, Linux)
+CAPABILITY_SCRIPT = [
+    "caps_arch=$(uname -m)",
+    'case "$caps_arch" in x86_64|amd64) caps_arch=x64;; aarch64|arm64) caps_arch=arm64;; armv7*) caps_arch=arm;; esac',
+    'caps="arch-$caps_arch"',
+    "if [ -r /etc/os-release ]; then",
+    '  caps="$caps,$(. /etc/os-release; echo "os-$ID-$VERSION_ID" | tr \'A-Z\' \'a-z\' | sed \'s/[^a-z0-9.]\\{1,\\}/-/g; s/-$//\')"',
+    "fi",
+    'caps="$caps,cpu-$(nproc),mem-$(awk \'/^MemTotal:/ {printf "%d", $2 / 1048576 + 0.5}\' /proc/meminfo)g"',
+    "if command -v nvidia-smi > /dev/null 2>&1 && gpus=$(nvidia-smi --query-gpu=name --format=csv,noheader 2> /dev/null); then",
+    '  for gpu in $(echo "$gpus" | tr \'A-Z\' \'a-z\' | sed \'s/[^a-z0-9.]\\{1,\\}/-/g; s/^-//; s/-$//\' | sort -u); do caps="$caps,gpu-$gpu"; done',
+    '  caps="$caps,gpu"',
+    "fi",
+    'if docker info > /dev/null 2>&1; then caps="$caps,docker"; fi',
+]
+
+
+def slug(value: Any) -> str:
+    return re.sub(r"[^a-z0-9.]+", "-", str(value).lower()).strip("-")
+
+
+def is_capability_label(label: str) -> bool:
+    label = label.lower()
+    return label in CAPABILITY_LABELS or label.startswith(CAPABILITY_PREFIXES)
+
+
+def capability_labels(
+    arch: Optional[str] = None,
+    os_id: Optional[str] = None,
+    os_version: Optional[str] = None,
+    cpus: Optional[float] = None,
+    memory: Optional[int] = None,
+    gpus: Optional[List[str]] = None,
+    docker: bool = False,
+) -> List[str]:
+    """Labels de capacidades a partir de lo observado (memoria en bytes, redondeada a GiB)."""
+    labels = []
+    if arch:
+        labels.append(f"arch-{ARCHITECTURES.get(arch.lower(), slug(arch))}")
+    if os_id:
+        labels.append(f"os-{slug(os_id)}{'-' + slug(os_version) if os_version else ''}")
+    if cpus:
+        labels.append(f"cpu-{int(cpus) if float(cpus).is_integer() else cpus}")
+    if memory:
+        labels.append(f"mem-{round(memory / 1024 ** 3)}g")
+    for gpu in sorted({slug(gpu) for gpu in gpus or []}):
+        labels.append(f"gpu-{gpu}")
+    if gpus:
+        labels.append("gpu")
+    if docker:
+        labels.append("docker")
+    return labels
+
+
+def labels_script(labels: List[str]) -> List[str]:
+    """Líneas de shell que dejan en $labels los labels del runner más los de capacidades."""
+    return [
+        *CAPABILITY_SCRIPT,
+        f"labels={shlex.quote(','.join(labels))}",
+        'labels="${labels:+$labels,}$caps"',
+        'echo "capabilities: $caps"',
+    ]
+
+
+def parse_os_release(text: str) -> Dict[str, str]:
+    values = {}
+    for line in text.splitlines():
+        key, _, value = line.partition("=")
+        if value:
+            values[key.strip()] = value.strip().strip('"')
+    return values
+
+
+class CapabilityRegistry:
+    """Introspección de hosts Docker e imágenes, y labels de capacidades observados por pool."""
+
+    def __init__(self, enabled: bool = True):
+        self.enabled = enabled
+        self.observed: Dict[str, List[str]] = {}
+        self.info: Dict[str, Any] = {}
+        self.images: Dict[str, Dict[str, str]] = {}
+        self.lock = threading.Lock()
+
+    def applies(self, pool: Any) -> bool:
+        return pool.capability_labels if pool.capability_labels is not None else self.enabled
+
+    def record(self, pool_name: str, labels: List[str]):
+        with self.lock:
+            self.observed[pool_name] = list(labels)
+
+    def get(self, pool_name: str) -> List[str]:
+        with self.lock:
+            return list(self.observed.get(pool_name, []))
+
+    def record_output(self, pool_name: str, output: str) -> List[str]:
+        """Labels que imprimió labels_script en la máquina del runner."""
+        for line in output.splitlines():
+            if line.startswith("capabilities: "):
+                labels = [label for label in line[len("capabilities: "):].strip().split(",") if label]
+                self.record(pool_name, labels)
+                return labels
+        return []
+
+    def _host_info(self, client: Any) -> Dict[str, Any]:
+        key = str(getattr(getattr(client, "api", None), "base_url", id(client)))
+        with self.lock:
+            cached = self.info.get(key)
+        if cached and time.time() - cached[0] < INFO_TTL:
+            return cached[1]
+        info = client.info()
+        with self.lock:
+            self.info[key] = (time.time(), info)
+        return info
+
+    def _image_os(self, client: Any, image: str) -> Dict[str, str]:
+        """ID y VERSION_ID de /etc/os-release de la imagen, con un contenedor efímero la primera vez."""
+        try:
+            image_id = client.images.get(image).id
+        except docker.errors.ImageNotFound:
+            # containers.run la descargaría igualmente al crear el runner
+            image_id = client.images.pull(image).id
+        with self.lock:
+            if image_id in self.images:
+                return self.images[image_id]
+        try:
+            output = client.containers.run(image_id, "/etc/os-release", entrypoint="cat", remove=True, network_disabled=True)
+            values = parse_os_release(output.decode("utf-8", errors="replace"))
+        except Exception as e:
+            # Imágenes sin cat ni os-release: el runner se registra sin label de sistema
+            logger.debug(f"Sin /etc/os-release en {image}: {e}")
+            values = {}
+        with self.lock:
+            self.images[image_id] = values
+        return values
+
+    def docker_labels(self, client: Any, image: str, pool: Any, enable_dind: bool) -> List[str]:
+        """Labels de un contenedor de runner: la clase de recursos manda sobre la CPU y memoria del host."""
+        try:
+            info = self._host_info(client)
+            image_os = self._image_os(client, image)
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron calcular los labels de capacidades', f"{pool.name}: {e}"))
+            return []
+        labels = capability_labels(
+            arch=info.get("Architecture"),
+            os_id=image_os.get("ID"),
+            os_version=image_os.get("VERSION_ID"),
+            cpus=pool.resources.cpus if pool.resources else info.get("NCPU"),
+            memory=pool.resources.memory if pool.resources else info.get("MemTotal"),
+            docker=enable_dind,
+        )
+        self.record(pool.name, labels)
+        return labels
+
+
+def create_capability_registry() -> CapabilityRegistry:
+    enabled = os.getenv("RUNNER_CAPABILITY_LABELS", "true").lower() == "true"
+    if enabled:
+        logger.info(format_log('CONFIG', 'Labels de capacidades del runner', "activados"))
+    return CapabilityRegistry(enabled)
+
+
+capabilities = create_capability_registry()
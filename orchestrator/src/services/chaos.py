@@ -0,0 +1,182 @@
+"""
+Inyección de fallos para pruebas de resiliencia.
+Con CHAOS_ENABLED=true se provocan a propósito, con las probabilidades configuradas,
+fallos de aprovisionamiento, respuestas lentas de GitHub (con timeout si superan el del
+cliente) y muertes de runners en ejecución sin avisar al orchestrator. Sirve para
+comprobar en staging que la reconciliación, la verificación de registro, los reintentos
+y el modo degradado hacen su trabajo. Nunca debe activarse en producción.
+"""
+
+import os
+import random
+import threading
+import time
+from typing import Any, Dict, List, Optional
+
+import requests
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class ChaosError(Exception):
+    """Fallo provocado por la inyección de caos."""
+
+
+class ChaosInjector:
+    """Decide qué fallos inyectar y mata runners al azar en segundo plano."""
+
+    def __init__(
+        self,
+        provision_failure_rate: float = 0.0,
+        github_latency_rate: float = 0.0,
+        github_latency: float = 5.0,
+        runner_kill_rate: float = 0.0,
+        runner_kill_interval: int = 60,
+        pools: Optional[List[str]] = None,
+        seed: Optional[int] = None,
+    ):
+        self.provision_failure_rate = provision_failure_rate
+        self.github_latency_rate = github_latency_rate
+        self.github_latency = github_latency
+        self.runner_kill_rate = runner_kill_rate
+        self.runner_kill_interval = runner_kill_interval
+        # Pools afectados por fallos de aprovisionamiento y muertes; vacío: todos
+        self.pools = pools or []
+        self.random = random.Random(seed)
+        self.lock = threading.Lock()
+        self.counters = {"provision_failures": 0, "github_delays": 0, "github_timeouts": 0, "runner_kills": 0}
+        self.lifecycle_manager: Any = None
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def _roll(self, rate: float) -> bool:
+        if rate <= 0:
+            return False
+        with self.lock:
+            return self.random.random() < rate
+
+    def _affects(self, pool: Optional[str]) -> bool:
+        return not self.pools or pool in self.pools
+
+    def _record(self, kind: str, counter: str, detail: str):
+        with self.lock:
+            self.counters[counter] += 1
+        metrics.incr("chaos.injected", tags={"kind": kind})
+        logger.warning(format_log('WARNING', f'Caos: {kind}', detail))
+
+    def provision(self, pool: str, runner_name: Optional[str] = None):
+        """Hace fallar la creación de un runner del pool con CHAOS_PROVISION_FAILURE_RATE."""
+        if self._affects(pool) and self._roll(self.provision_failure_rate):
+            self._record("provision_failure", "provision_failures", f"pool {pool}, runner {runner_name or '-'}")
+            raise ChaosError(f"Fallo de aprovisionamiento inyectado (pool {pool})")
+
+    def github_call(self, method: str, url: str, timeout: float):
+        """Retrasa una llamada a GitHub; si el retraso alcanza el timeout del cliente, la corta."""
+        if not self._roll(self.github_latency_rate):
+            return
+        if self.github_latency >= timeout:
+            self._record("github_timeout", "github_timeouts", f"{method} {url} ({timeout:g}s)")
+            time.sleep(timeout)
+            raise requests.Timeout(f"Timeout inyectado por caos en {method} {url}")
+        self._record("github_delay", "github_delays", f"{method} {url} (+{self.github_latency:g}s)")
+        time.sleep(self.github_latency)
+
+    def start(self, lifecycle_manager: Any):
+        """Arranca las muertes de runners si CHAOS_RUNNER_KILL_RATE > 0."""
+        self.lifecycle_manager = lifecycle_manager
+        if self.runner_kill_rate <= 0 or self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.warning(format_log(
+            'WARNING', 'Caos: muertes de runners activadas',
+            f'probabilidad {self.runner_kill_rate:g} por runner cada {self.runner_kill_interval}s'
+        ))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.runner_kill_interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.kill_runners()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error inyectando muertes de runners', str(e)))
+
+    def kill_runners(self) -> List[str]:
+        """
+        Mata cada runner activo con CHAOS_RUNNER_KILL_RATE de probabilidad.
+
+        El cómputo muere como en un OOM o un host caído: no se quita del seguimiento ni de
+        GitHub, para que lo detecten la reconciliación y la limpieza.
+        """
+        killed = []
+        for runner_id, container in list(self.lifecycle_manager.active_runners.items()):
+            labels = getattr(container, "labels", None) or {}
+            if not self._affects(labels.get("runner-pool")) or not self._roll(self.runner_kill_rate):
+                continue
+            try:
+                if hasattr(container, "kill"):
+                    container.kill()
+                else:
+                    container.stop(timeout=0)
+            except Exception as e:
+                logger.warning(format_log('WARNING', f'Caos: no se pudo matar el runner {runner_id}', str(e)))
+                continue
+            self._record("runner_kill", "runner_kills", runner_id)
+            killed.append(runner_id)
+        return killed
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            counters = dict(self.counters)
+        return {
+            "provision_failure_rate": self.provision_failure_rate,
+            "github_latency_rate": self.github_latency_rate,
+            "github_latency": self.github_latency,
+            "runner_kill_rate": self.runner_kill_rate,
+            "pools": self.pools,
+            **counters,
+        }
+
+
+def _rate(name: str) -> float:
+    """Probabilidad entre 0 y 1 de una variable CHAOS_*_RATE."""
+    try:
+        value = float(os.getenv(name, "0"))
+    except ValueError:
+        raise ConfigurationError(f"{name} inválido: debe ser un número entre 0 y 1")
+    if not 0 <= value <= 1:
+        raise ConfigurationError(f"{name} debe estar entre 0 y 1")
+    return value
+
+
+def create_chaos_injector() -> Optional[ChaosInjector]:
+    """Inyector configurado desde variables de entorno, o None sin CHAOS_ENABLED=true."""
+    if os.getenv("CHAOS_ENABLED", "false").lower() != "true":
+        return None
+    seed = os.getenv("CHAOS_SEED")
+    injector = ChaosInjector(
+        provision_failure_rate=_rate("CHAOS_PROVISION_FAILURE_RATE"),
+        github_latency_rate=_rate("CHAOS_GITHUB_LATENCY_RATE"),
+        github_latency=float(os.getenv("CHAOS_GITHUB_LATENCY", "5")),
+        runner_kill_rate=_rate("CHAOS_RUNNER_KILL_RATE"),
+        runner_kill_interval=max(1, int(os.getenv("CHAOS_RUNNER_KILL_INTERVAL", "60"))),
+        pools=[pool.strip() for pool in os.getenv("CHAOS_POOLS", "").split(",") if pool.strip()],
+        seed=int(seed) if seed else None,
+    )
+    logger.warning(format_log('WARNING', 'Inyección de caos activada', str(injector.status())))
+    return injector
+
+
+# Compartido por el cliente de GitHub, el ciclo de vida y el servicio
+chaos = create_chaos_injector()
@@ -42,7 +42,7 @@ class ConfigValidator:
         }
 
         # Validar variables obligatorias
-        for var in self.required_env_vars:
+        for var in self._get_required_env_vars():
             value = os.getenv(var)
             if not value:
                 results["missing_required"].append(var)
@@ -109,6 +109,18 @@ class ConfigValidator:
 
         return results
 
+    def _get_required_env_vars(self) -> List[str]:
+        """
+        Retorna variables obligatorias según el modo de autenticación.
+
+        Con GitHub App (GITHUB_APP_ID) o secretos en Vault el token personal
+        deja de ser obligatorio como variable de entorno.
+        """
+        # Con un proveedor externo (Vault) los secretos no están en el entorno
+        if os.getenv("GITHUB_APP_ID") or os.getenv("SECRETS_PROVIDER", "env").lower() != "env":
+            return [var for var in self.required_env_vars if var != "GITHUB_RUNNER_TOKEN"]
+        return self.required_env_vars
+
     def _validate_github_token(self, token: str) -> bool:
         """
         Valida formato de token de GitHub.
@@ -234,7 +246,7 @@ class ConfigValidator:
             "overall_valid": env_validation["valid"],
             "total_errors": len(env_validation["errors"]),
             "total_warnings": len(env_validation["warnings"]),
-            "required_vars_found": len(self.required_env_vars)
+            "required_vars_found": len(self._get_required_env_vars())
             - len(env_validation["missing_required"]),
             "runner_env_vars_found": env_validation["runner_env_vars"]["variables_found"],
             "validation_details": env_validation,
@@ -250,10 +262,16 @@ class ConfigValidator:
         recommendations = []
 
         # Verificar variables obligatorias
-        for var in self.required_env_vars:
+        for var in self._get_required_env_vars():
             if not os.getenv(var):
                 recommendations.append(f"Configurar variable obligatoria: {var}")
 
+        # Recomendar GitHub App sobre tokens personales
+        if not os.getenv("GITHUB_APP_ID"):
+            recommendations.append(
+                "Considerar GitHub App (GITHUB_APP_ID) en lugar de un token personal que expira con su usuario"
+            )
+
         # Verificar variables de runners
         runner_vars_count = len([k for k in os.environ.keys() if k.startswith("runnerenv_")])
         if runner_vars_count == 0:
@@ -0,0 +1,221 @@
+"""
+Integración nativa con Datadog a través del agente: métricas de flota por DogStatsD,
+eventos de las decisiones de escalado y trazas APM, todo con el etiquetado unificado
+de servicio (service, env, version). Se configura con DATADOG_* (sección shared del
+archivo de configuración) y no requiere ddtrace ni Prometheus.
+"""
+
+import json
+import os
+import random
+import socket
+import threading
+import time
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Any, Dict, Iterator, List, Optional, Tuple
+
+import requests
+from src.services.metrics import StatsDSink, metrics, parse_tags
+from src.utils.helpers import format_log, setup_logger
+from version import __version__
+
+logger = setup_logger(__name__)
+
+SERVICE = "gha-orchestrator"
+
+# Cabeceras de propagación de Datadog entre gateway y orchestrator
+TRACE_ID_HEADER = "x-datadog-trace-id"
+PARENT_ID_HEADER = "x-datadog-parent-id"
+SAMPLING_PRIORITY_HEADER = "x-datadog-sampling-priority"
+
+_current_span: ContextVar[Optional[Dict[str, Any]]] = ContextVar("datadog_span", default=None)
+
+
+def _new_id() -> int:
+    # El agente espera enteros de 64 bits sin signo; 63 bits evita problemas con JSON
+    return random.getrandbits(63) or 1
+
+
+class Tracer:
+    """Spans compatibles con la API de trazas del agente (/v0.4/traces, JSON) enviados por lotes."""
+
+    def __init__(self, host: str, port: int, service: str, tags: Dict[str, str], enabled: bool = True):
+        self.url = f"http://{host}:{port}/v0.4/traces"
+        self.service = service
+        self.tags = tags
+        self.enabled = enabled
+        self.finished: List[Dict[str, Any]] = []
+        self.lock = threading.Lock()
+
+        if self.enabled:
+            threading.Thread(target=self._flush_loop, daemon=True).start()
+
+    @contextmanager
+    def span(
+        self,
+        name: str,
+        resource: Optional[str] = None,
+        span_type: Optional[str] = None,
+        parent: Optional[Tuple[int, int]] = None,
+    ) -> Iterator[Dict[str, Any]]:
+        """
+        Abre un span hijo del span actual (o de parent=(trace_id, span_id) recibido por cabeceras).
+
+        Las excepciones marcan el span como error y se propagan.
+        """
+        current = _current_span.get()
+        if parent:
+            trace_id, parent_id = parent
+        elif current:
+            trace_id, parent_id = current["trace_id"], current["span_id"]
+        else:
+            trace_id, parent_id = _new_id(), 0
+
+        span = {
+            "trace_id": trace_id,
+            "span_id": _new_id(),
+            "parent_id": parent_id,
+            "name": name,
+            "resource": resource or name,
+            "service": self.service,
+            "type": span_type or "custom",
+            "start": time.time_ns(),
+            "duration": 0,
+            "error": 0,
+            "meta": dict(self.tags),
+            "metrics": {"_sampling_priority_v1": 1},
+        }
+        # Primer span del servicio en la traza (raíz o continuación de otro servicio)
+        if current is None:
+            span["metrics"]["_dd.top_level"] = 1
+
+        token = _current_span.set(span)
+        try:
+            yield span
+        except Exception as e:
+            span["error"] = 1
+            span["meta"]["error.type"] = type(e).__name__
+            span["meta"]["error.message"] = str(e)[:500]
+            raise
+        finally:
+            span["duration"] = time.time_ns() - span["start"]
+            _current_span.reset(token)
+            if self.enabled:
+                with self.lock:
+                    self.finished.append(span)
+
+    def propagation_headers(self) -> Dict[str, str]:
+        """Cabeceras para continuar la traza actual en otro servicio."""
+        current = _current_span.get()
+        if not self.enabled or current is None:
+            return {}
+        return {
+            TRACE_ID_HEADER: str(current["trace_id"]),
+            PARENT_ID_HEADER: str(current["span_id"]),
+            SAMPLING_PRIORITY_HEADER: "1",
+        }
+
+    @staticmethod
+    def extract(headers: Any) -> Optional[Tuple[int, int]]:
+        """(trace_id, parent_id) de las cabeceras de Datadog entrantes, si las hay."""
+        try:
+            return int(headers[TRACE_ID_HEADER]), int(headers[PARENT_ID_HEADER])
+        except (KeyError, TypeError, ValueError):
+            return None
+
+    def _flush_loop(self):
+        while True:
+            time.sleep(1)
+            with self.lock:
+                spans, self.finished = self.finished, []
+            if not spans:
+                continue
+            traces: Dict[int, List[Dict[str, Any]]] = {}
+            for span in spans:
+                traces.setdefault(span["trace_id"], []).append(span)
+            try:
+                response = requests.put(
+                    self.url, data=json.dumps(list(traces.values())),
+                    headers={"Content-Type": "application/json", "X-Datadog-Trace-Count": str(len(traces))},
+                    timeout=5,
+                )
+                response.raise_for_status()
+            except requests.RequestException as e:
+                metrics.incr("datadog.traces_dropped", len(spans))
+                logger.debug(f"No se pudieron enviar trazas al agente de Datadog: {e}")
+
+
+class Datadog:
+    """Eventos DogStatsD y trazador del servicio; sin DATADOG_ENABLED todo es no-op."""
+
+    def __init__(
+        self,
+        enabled: bool = False,
+        host: str = "localhost",
+        dogstatsd_port: int = 8125,
+        trace_port: int = 8126,
+        tags: Optional[Dict[str, str]] = None,
+        tracing: bool = True,
+    ):
+        self.enabled = enabled
+        self.address = (host, dogstatsd_port)
+        self.tags = tags or {}
+        self.socket = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+        self.tracer = Tracer(host, trace_port, SERVICE, self.tags, enabled=enabled and tracing)
+
+    def event(
+        self,
+        title: str,
+        text: str,
+        alert_type: str = "info",
+        aggregation_key: Optional[str] = None,
+        tags: Optional[Dict[str, str]] = None,
+    ):
+        """Envía un evento DogStatsD (alert_type: info, success, warning o error)."""
+        if not self.enabled:
+            return
+        text = text.replace("\n", "\\n")
+        payload = f"_e{{{len(title.encode())},{len(text.encode())}}}:{title}|{text}|t:{alert_type}|s:gha-ephemeral-runners"
+        if aggregation_key:
+            payload += f"|k:{aggregation_key}"
+        all_tags = {**self.tags, **(tags or {})}
+        payload += "|#" + ",".join(f"{k}:{v}" for k, v in sorted(all_tags.items()))
+        try:
+            self.socket.sendto(payload.encode("utf-8"), self.address)
+        except OSError as e:
+            logger.debug(f"Error enviando evento a Datadog: {e}")
+
+
+def create_datadog() -> Datadog:
+    """Crea la integración desde DATADOG_* (con DD_AGENT_HOST y DD_ENV como alternativas)."""
+    if os.getenv("DATADOG_ENABLED", "false").lower() != "true":
+        return Datadog()
+
+    host = os.getenv("DATADOG_AGENT_HOST") or os.getenv("DD_AGENT_HOST") or "localhost"
+    port = int(os.getenv("DATADOG_DOGSTATSD_PORT", "8125"))
+    tags = parse_tags(os.getenv("DATADOG_TAGS", ""))
+    tags.update(service=SERVICE, version=__version__)
+    env = os.getenv("DATADOG_ENV") or os.getenv("DD_ENV") or os.getenv("DEPLOY_ENVIRONMENT")
+    if env:
+        tags["env"] = env
+
+    # Métricas de flota por DogStatsD con las mismas etiquetas que eventos y trazas
+    metrics.add_sink(StatsDSink(host, port, prefix=os.getenv("STATSD_PREFIX", "gha_runners"), tags=tags, dogstatsd=True))
+    integration = Datadog(
+        enabled=True,
+        host=host,
+        dogstatsd_port=port,
+        trace_port=int(os.getenv("DATADOG_TRACE_PORT", "8126")),
+        tags=tags,
+        tracing=os.getenv("DATADOG_TRACING", "true").lower() == "true",
+    )
+    logger.info(format_log(
+        'CONFIG', 'Datadog activado',
+        f"agente {host} (service={SERVICE}, env={env or '-'}, trazas {'sí' if integration.tracer.enabled else 'no'})"
+    ))
+    return integration
+
+
+# Integración compartida por todos los módulos del orchestrator
+datadog = create_datadog()
@@ -0,0 +1,87 @@
+"""
+Deduplicación de entregas de webhooks.
+GitHub vuelve a entregar un webhook cuando no recibe respuesta a tiempo, con el mismo
+X-GitHub-Delivery. El gateway envía ese ID al crear el runner de un job encolado y aquí
+se registra: una entrega ya vista no crea un segundo runner. Con WORK_QUEUE_URL el
+registro está en Redis y lo comparten todas las réplicas; sin él, en memoria.
+"""
+
+import os
+import threading
+import time
+from collections import OrderedDict
+from typing import Any, Dict, Optional
+
+from src.services.metrics import metrics
+from src.services.work_queue import RedisClient
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class DeliveryLog:
+    """Entregas procesadas durante `ttl` segundos, en Redis (SET NX EX) o en memoria."""
+
+    def __init__(self, ttl: int = 86400, client: Optional[RedisClient] = None, prefix: str = "gha:deliveries", max_entries: int = 100000):
+        self.ttl = ttl
+        self.client = client
+        self.prefix = prefix
+        self.max_entries = max_entries
+        self.seen: "OrderedDict[str, float]" = OrderedDict()
+        self.lock = threading.Lock()
+        self.duplicates = 0
+
+    def claim(self, delivery_id: str) -> bool:
+        """Registra la entrega; False si ya se había procesado (duplicada)."""
+        if self.client:
+            try:
+                first = self.client.execute("SET", f"{self.prefix}:{delivery_id}", int(time.time()), "NX", "EX", self.ttl) is not None
+            except Exception as e:
+                # Sin Redis no se puede saber: mejor un runner de más que un job sin runner
+                logger.warning(format_log('WARNING', 'No se pudo registrar la entrega del webhook', f'{delivery_id}: {e}'))
+                return True
+        else:
+            now = time.time()
+            with self.lock:
+                while self.seen and (len(self.seen) >= self.max_entries or next(iter(self.seen.values())) < now - self.ttl):
+                    self.seen.popitem(last=False)
+                first = delivery_id not in self.seen
+                if first:
+                    self.seen[delivery_id] = now
+
+        if not first:
+            self.duplicates += 1
+            metrics.incr("webhooks.duplicate_deliveries")
+        return first
+
+    def release(self, delivery_id: str):
+        """Olvida una entrega cuyo procesamiento falló, para que una nueva entrega lo reintente."""
+        if self.client:
+            try:
+                self.client.execute("DEL", f"{self.prefix}:{delivery_id}")
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo liberar la entrega del webhook', f'{delivery_id}: {e}'))
+            return
+        with self.lock:
+            self.seen.pop(delivery_id, None)
+
+    def status(self) -> Dict[str, Any]:
+        return {
+            "backend": self.client.description if self.client else "memory",
+            "ttl": self.ttl,
+            "duplicates": self.duplicates,
+        }
+
+
+def create_delivery_log() -> DeliveryLog:
+    """Registro en el Redis de WORK_QUEUE_URL si está configurado; si no, en memoria."""
+    url = os.getenv("WORK_QUEUE_URL")
+    return DeliveryLog(
+        ttl=int(os.getenv("WEBHOOK_DEDUP_TTL", "86400")),
+        client=RedisClient(url) if url else None,
+        prefix=f"{os.getenv('WORK_QUEUE_NAME', 'gha:work')}:deliveries",
+    )
+
+
+# Compartido por todas las peticiones de creación
+deliveries = create_delivery_log()
@@ -0,0 +1,247 @@
+"""
+Diagnóstico del entorno del orchestrator.
+Verifica el servidor de GitHub (GitHub.com o la versión de GHES), credenciales y el desfase de reloj
+contra GitHub, y después cada backend que usan los pools: para los pools docker, la conexión con
+Docker y que sus imágenes se puedan descargar; para ssh, ecs, azure y gce, las credenciales y la
+conectividad con los hosts o la API del proveedor. Lo usa `runnersctl doctor`.
+"""
+
+import os
+from datetime import datetime, timezone
+from email.utils import parsedate_to_datetime
+from typing import Any, Dict, List, Optional
+
+import requests
+
+from src.services.github_auth import GitHubCredentials
+from src.services.github_server import MIN_GHES_VERSION, github_api_url, server_info
+from src.services.pools import BACKENDS, PoolRegistry
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+PASS = "pass"
+WARN = "warn"
+FAIL = "fail"
+
+# Los JWT de GitHub App se rechazan con más de 60s de desfase; avisar antes
+DEFAULT_MAX_CLOCK_SKEW = 30
+
+
+def check(name: str, status: str, detail: str) -> Dict[str, str]:
+    """Resultado de una verificación."""
+    return {"check": name, "status": status, "detail": detail}
+
+
+class Diagnostics:
+    """Ejecuta las verificaciones de diagnóstico y arma el reporte."""
+
+    def __init__(
+        self,
+        credentials: GitHubCredentials,
+        docker_client: Any,
+        pools: PoolRegistry,
+        default_image: str,
+        api_base: Optional[str] = None,
+        max_clock_skew: int = DEFAULT_MAX_CLOCK_SKEW,
+        backends: Optional[Dict[str, Any]] = None,
+    ):
+        self.credentials = credentials
+        self.docker_client = docker_client
+        self.pools = pools
+        self.backends = backends or {}
+        self.default_image = default_image
+        self.api_base = (api_base or github_api_url()).rstrip("/")
+        self.max_clock_skew = max_clock_skew
+
+    def run(self) -> Dict[str, Any]:
+        """
+        Ejecuta todas las verificaciones.
+
+        Returns:
+            {"ok": bool, "checks": [{"check", "status", "detail"}]}
+        """
+        checks: List[Dict[str, str]] = [
+            self.check_github_server(),
+            self.check_github_credentials(),
+            self.check_clock_skew(),
+        ]
+        for backend, pool_names in self._pools_by_backend().items():
+            checks.extend(self.check_backend(backend, pool_names))
+
+        ok = all(item["status"] != FAIL for item in checks)
+        failed = [item["check"] for item in checks if item["status"] == FAIL]
+        if ok:
+            logger.info(format_log('SUCCESS', 'Diagnóstico completado', f'{len(checks)} verificaciones'))
+        else:
+            logger.warning(format_log('WARNING', 'Diagnóstico con fallos', ', '.join(failed)))
+        return {"ok": ok, "checks": checks}
+
+    def check_github_server(self) -> Dict[str, str]:
+        """GitHub.com o un GHES accesible con versión soportada."""
+        name = "github.server"
+        try:
+            info = server_info(self.api_base, self.credentials)
+        except requests.RequestException as e:
+            return check(name, FAIL, f"{self.api_base} no accesible: {e}")
+        if not info["enterprise"]:
+            return check(name, PASS, "GitHub.com")
+        if not info["version"]:
+            return check(name, WARN, f"GitHub Enterprise Server en {info['url']} sin versión en /meta")
+        if not info["supported"]:
+            return check(name, FAIL, f"GitHub Enterprise Server {info['version']}: se requiere {MIN_GHES_VERSION} o superior")
+
+        unavailable = [capability for capability, available in info["capabilities"].items() if not available]
+        detail = f"GitHub Enterprise Server {info['version']} en {info['url']}"
+        if unavailable:
+            return check(name, WARN, f"{detail}; no disponible: {', '.join(unavailable)}")
+        return check(name, PASS, detail)
+
+    def check_github_credentials(self) -> Dict[str, str]:
+        """Credenciales válidas y con los permisos/scopes requeridos."""
+        name = "github.credentials"
+        organization = os.getenv("DISCOVERY_MODE", "all") == "organization"
+        try:
+            missing = self.credentials.missing_permissions(organization=organization)
+        except requests.RequestException as e:
+            return check(name, FAIL, f"GitHub no accesible: {e}")
+        except Exception as e:
+            return check(name, FAIL, str(e))
+
+        if missing:
+            return check(name, FAIL, "Permisos faltantes: " + "; ".join(missing))
+        return check(name, PASS, "Credenciales válidas con los permisos requeridos")
+
+    def check_clock_skew(self) -> Dict[str, str]:
+        """Desfase entre el reloj local y el header Date de GitHub."""
+        name = "clock.skew"
+        try:
+            # /rate_limit no consume cuota
+            response = requests.get(f"{self.api_base}/rate_limit", timeout=10.0)
+        except requests.RequestException as e:
+            return check(name, FAIL, f"GitHub no accesible: {e}")
+
+        skew = self._skew_seconds(response.headers.get("Date"))
+        if skew is None:
+            return check(name, WARN, "GitHub no devolvió header Date")
+        detail = f"{skew:+.1f}s respecto de GitHub (máximo {self.max_clock_skew}s)"
+        return check(name, FAIL if abs(skew) > self.max_clock_skew else PASS, detail)
+
+    @staticmethod
+    def _skew_seconds(date_header: Optional[str]) -> Optional[float]:
+        if not date_header:
+            return None
+        try:
+            remote = parsedate_to_datetime(date_header)
+        except (TypeError, ValueError):
+            return None
+        return (datetime.now(timezone.utc) - remote).total_seconds()
+
+    def _pools_by_backend(self) -> Dict[str, List[str]]:
+        """Pools agrupados por backend; sin pools se verifica Docker (el pool por defecto)."""
+        by_backend: Dict[str, List[str]] = {}
+        for pool in self.pools.pools.values():
+            by_backend.setdefault(pool.backend, []).append(pool.name)
+        if not by_backend:
+            by_backend["docker"] = []
+        return {backend: by_backend[backend] for backend in BACKENDS if backend in by_backend}
+
+    def check_backend(self, backend: str, pool_names: List[str]) -> List[Dict[str, str]]:
+        """Verificaciones del backend que usan pool_names."""
+        if backend == "docker":
+            return [self.check_docker(), *self.check_images()]
+        instance = self.backends.get(backend)
+        if instance is None:
+            return [check(f"{backend}.backend", FAIL, f"Backend {backend} sin configurar (pools: {', '.join(pool_names)})")]
+        return getattr(self, f"check_{backend}")(instance)
+
+    def check_docker(self) -> Dict[str, str]:
+        """Conectividad con el socket de Docker."""
+        name = "docker.engine"
+        try:
+            self.docker_client.ping()
+            version = self.docker_client.version().get("Version", "desconocida")
+        except Exception as e:
+            return check(name, FAIL, f"Docker no accesible: {e}")
+        return check(name, PASS, f"Docker Engine {version}")
+
+    def check_images(self) -> List[Dict[str, str]]:
+        """Cada imagen de pool docker se puede descargar (o al menos existe localmente)."""
+        images: Dict[str, List[str]] = {}
+        for pool in self.pools.pools.values():
+            if pool.backend != "docker":
+                continue
+            images.setdefault(pool.image or self.default_image, []).append(pool.name)
+
+        results = []
+        for image, pool_names in images.items():
+            name = f"image.pull:{image}"
+            pools = ", ".join(pool_names)
+            try:
+                # Consulta el manifiesto en el registry sin descargar capas
+                self.docker_client.images.get_registry_data(image)
+                results.append(check(name, PASS, f"Accesible en el registry (pools: {pools})"))
+                continue
+            except Exception as e:
+                error = str(e)
+
+            try:
+                self.docker_client.images.get(image)
+                results.append(check(name, WARN, f"Solo disponible localmente (pools: {pools}): {error}"))
+            except Exception:
+                results.append(check(name, FAIL, f"No se puede descargar (pools: {pools}): {error}"))
+        return results
+
+    def check_ssh(self, backend: Any) -> List[Dict[str, str]]:
+        """Cada host del inventario SSH acepta la conexión con la clave configurada."""
+        results = []
+        for host in backend.hosts.values():
+            name = f"ssh.host:{host.name}"
+            try:
+                backend._run(host, "true", timeout=backend.connect_timeout + 10)
+            except Exception as e:
+                results.append(check(name, FAIL, str(e)))
+                continue
+            results.append(check(name, PASS, f"{host.user}@{host.address}:{host.port} accesible"))
+        return results
+
+    def check_ecs(self, backend: Any) -> List[Dict[str, str]]:
+        """Credenciales de AWS válidas y cluster ECS activo."""
+        name = "ecs.cluster"
+        try:
+            response = backend.ecs.call("DescribeClusters", {"clusters": [backend.cluster]})
+        except Exception as e:
+            return [check(name, FAIL, f"API de ECS no accesible en {backend.region}: {e}")]
+        clusters = response.get("clusters", [])
+        if not clusters:
+            reason = (response.get("failures") or [{}])[0].get("reason", "no encontrado")
+            return [check(name, FAIL, f"Cluster {backend.cluster}: {reason}")]
+        status = clusters[0].get("status", "")
+        detail = f"Cluster {backend.cluster} en {backend.region} ({status})"
+        return [check(name, PASS if status == "ACTIVE" else FAIL, detail)]
+
+    def check_azure(self, backend: Any) -> List[Dict[str, str]]:
+        """Token de Azure y acceso de lectura a las VMs del resource group."""
+        try:
+            backend.client.credentials.get()
+        except Exception as e:
+            return [check("azure.credentials", FAIL, str(e))]
+        results = [check("azure.credentials", PASS, backend.client.credentials.method)]
+        try:
+            vms = backend.client.request("GET", "/virtualMachines").get("value", [])
+        except Exception as e:
+            return results + [check("azure.api", FAIL, f"ARM no accesible: {e}")]
+        return results + [check("azure.api", PASS, f"Resource group accesible en {backend.location} ({len(vms)} VMs)")]
+
+    def check_gce(self, backend: Any) -> List[Dict[str, str]]:
+        """Token de Google y acceso al proyecto de Compute Engine."""
+        try:
+            backend.client.credentials.get()
+        except Exception as e:
+            return [check("gce.credentials", FAIL, str(e))]
+        results = [check("gce.credentials", PASS, backend.client.credentials.method)]
+        try:
+            backend.client.request("GET", "")
+        except Exception as e:
+            return results + [check("gce.api", FAIL, f"Compute Engine no accesible: {e}")]
+        return results + [check("gce.api", PASS, f"Proyecto {backend.client.project} accesible")]
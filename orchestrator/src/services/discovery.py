@@ -0,0 +1,215 @@
+"""
+Registro del servicio en Consul o etcd para que el resto de la infraestructura lo
+descubra sin hostnames fijos. El TTL del registro lo renueva un latido que consulta
+/healthz del propio servicio, el mismo endpoint que usa el HEALTHCHECK de la imagen:
+si el servicio deja de estar sano, Consul marca el check como crítico y en etcd la
+clave desaparece al revocarse su lease.
+"""
+
+import base64
+import json
+import os
+import socket
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+import requests
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+from version import __version__
+
+logger = setup_logger(__name__)
+
+
+def _b64(value: str) -> str:
+    return base64.b64encode(value.encode()).decode()
+
+
+class ConsulRegistry:
+    """Agente de Consul: servicio con check TTL que se actualiza en cada latido."""
+
+    name = "consul"
+
+    def __init__(self, address: str, token: Optional[str] = None, deregister_after: str = "5m"):
+        self.address = address.rstrip("/")
+        self.headers = {"X-Consul-Token": token} if token else {}
+        self.deregister_after = deregister_after
+
+    def register(self, service: Dict[str, Any], ttl: int):
+        response = requests.put(f"{self.address}/v1/agent/service/register", headers=self.headers, timeout=5, json={
+            "ID": service["id"],
+            "Name": service["name"],
+            "Address": service["address"],
+            "Port": service["port"],
+            "Tags": service["tags"],
+            "Meta": {"version": service["version"]},
+            "Check": {
+                "CheckID": f"service:{service['id']}",
+                "TTL": f"{ttl}s",
+                "DeregisterCriticalServiceAfter": self.deregister_after,
+            },
+        })
+        response.raise_for_status()
+
+    def heartbeat(self, service: Dict[str, Any], ttl: int, healthy: bool, output: str) -> bool:
+        """Actualiza el check; retorna False si el agente ya no conoce el servicio."""
+        response = requests.put(
+            f"{self.address}/v1/agent/check/update/service:{service['id']}", headers=self.headers, timeout=5,
+            json={"Status": "passing" if healthy else "critical", "Output": output},
+        )
+        # El agente responde 404 (o 500 en versiones antiguas) si perdió el registro al reiniciarse
+        if response.status_code in (404, 500):
+            return False
+        response.raise_for_status()
+        return True
+
+    def deregister(self, service: Dict[str, Any]):
+        requests.put(f"{self.address}/v1/agent/service/deregister/{service['id']}", headers=self.headers, timeout=5)
+
+
+class EtcdRegistry:
+    """etcd v3 (gateway JSON): clave <prefix>/<servicio>/<id> ligada a un lease con el TTL."""
+
+    name = "etcd"
+
+    def __init__(self, endpoint: str, prefix: str = "/gha-runners/services", username: Optional[str] = None, password: Optional[str] = None):
+        self.endpoint = endpoint.rstrip("/")
+        self.prefix = prefix.rstrip("/")
+        self.username = username
+        self.password = password
+        self.lease: Optional[str] = None
+
+    def _post(self, path: str, body: Dict[str, Any]) -> Dict[str, Any]:
+        headers = {}
+        if self.username:
+            auth = requests.post(
+                f"{self.endpoint}/v3/auth/authenticate", timeout=5,
+                json={"name": self.username, "password": self.password or ""},
+            )
+            auth.raise_for_status()
+            headers["Authorization"] = auth.json()["token"]
+        response = requests.post(f"{self.endpoint}{path}", json=body, headers=headers, timeout=5)
+        response.raise_for_status()
+        return response.json()
+
+    def key(self, service: Dict[str, Any]) -> str:
+        return f"{self.prefix}/{service['name']}/{service['id']}"
+
+    def register(self, service: Dict[str, Any], ttl: int):
+        self.lease = self._post("/v3/lease/grant", {"TTL": ttl})["ID"]
+        self._post("/v3/kv/put", {
+            "key": _b64(self.key(service)),
+            "value": _b64(json.dumps(service)),
+            "lease": self.lease,
+        })
+
+    def heartbeat(self, service: Dict[str, Any], ttl: int, healthy: bool, output: str) -> bool:
+        if self.lease is None:
+            return False
+        if not healthy:
+            # Sin salud la clave se retira; se vuelve a registrar cuando se recupere
+            self.deregister(service)
+            return True
+        result = self._post("/v3/lease/keepalive", {"ID": self.lease}).get("result", {})
+        # Un lease expirado responde sin TTL: hay que registrar de nuevo
+        return int(result.get("TTL", 0)) > 0
+
+    def deregister(self, service: Dict[str, Any]):
+        if self.lease is not None:
+            lease, self.lease = self.lease, None
+            self._post("/v3/lease/revoke", {"ID": lease})
+
+
+class ServiceRegistration:
+    """Registra el servicio al iniciar, renueva el TTL según /healthz y lo retira al detenerse."""
+
+    def __init__(self, registry: Any, service: Dict[str, Any], ttl: int = 30):
+        self.registry = registry
+        self.service = service
+        self.ttl = ttl
+        self.registered = False
+        self.running = False
+        self.stop_event = threading.Event()
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.stop_event.clear()
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'CONFIG', 'Registro en descubrimiento de servicios',
+            f"{self.registry.name}: {self.service['id']} en {self.service['address']}:{self.service['port']} (TTL {self.ttl}s)"
+        ))
+
+    def stop(self):
+        self.running = False
+        self.stop_event.set()
+        if self.thread:
+            self.thread.join(timeout=5)
+        if self.registered:
+            try:
+                self.registry.deregister(self.service)
+                logger.info(format_log('SUCCESS', 'Servicio retirado del descubrimiento', self.service["id"]))
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo retirar el servicio del descubrimiento', str(e)))
+
+    def _check_health(self) -> Tuple[bool, str]:
+        """Mismo criterio que el HEALTHCHECK de la imagen: GET /healthz local con 200."""
+        try:
+            response = requests.get(f"http://127.0.0.1:{self.service['port']}/healthz", timeout=5)
+            return response.status_code == 200, f"/healthz {response.status_code}"
+        except requests.RequestException as e:
+            return False, f"/healthz inaccesible: {e}"
+
+    def _loop(self):
+        # Latido a un tercio del TTL para tolerar un latido perdido
+        interval = max(self.ttl / 3, 1)
+        while self.running:
+            healthy, output = self._check_health()
+            try:
+                if not self.registered or not self.registry.heartbeat(self.service, self.ttl, healthy, output):
+                    if healthy:
+                        self.registry.register(self.service, self.ttl)
+                        self.registry.heartbeat(self.service, self.ttl, healthy, output)
+                        if not self.registered:
+                            logger.info(format_log('SUCCESS', 'Servicio registrado', f"{self.registry.name} {self.service['id']}"))
+                        self.registered = True
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'Error en el registro de descubrimiento', f"{self.registry.name}: {e}"))
+            self.stop_event.wait(interval)
+
+
+def create_service_registration(name: str, port: int) -> Optional[ServiceRegistration]:
+    """Registro de SERVICE_DISCOVERY_BACKEND (consul o etcd), o None si está desactivado."""
+    backend = os.getenv("SERVICE_DISCOVERY_BACKEND", "").strip()
+    if not backend:
+        return None
+    if backend == "consul":
+        registry: Any = ConsulRegistry(
+            os.getenv("CONSUL_HTTP_ADDR", "http://localhost:8500"),
+            os.getenv("CONSUL_HTTP_TOKEN"),
+            os.getenv("CONSUL_DEREGISTER_AFTER", "5m"),
+        )
+    elif backend == "etcd":
+        registry = EtcdRegistry(
+            os.getenv("ETCD_ENDPOINT", "http://localhost:2379"),
+            os.getenv("SERVICE_DISCOVERY_PREFIX", "/gha-runners/services"),
+            os.getenv("ETCD_USERNAME"),
+            os.getenv("ETCD_PASSWORD"),
+        )
+    else:
+        raise ConfigurationError(f"SERVICE_DISCOVERY_BACKEND desconocido: {backend} (consul o etcd)")
+
+    hostname = socket.gethostname()
+    tags: List[str] = [tag.strip() for tag in os.getenv("SERVICE_DISCOVERY_TAGS", "").split(",") if tag.strip()]
+    service = {
+        "id": f"{name}-{hostname}",
+        "name": name,
+        "address": os.getenv("SERVICE_DISCOVERY_ADDRESS") or hostname,
+        "port": port,
+        "version": __version__,
+        "tags": tags,
+    }
+    return ServiceRegistration(registry, service, int(os.getenv("SERVICE_DISCOVERY_TTL", "30")))
@@ -0,0 +1,336 @@
+"""
+Presión de disco en los hosts que ejecutan runners.
+Cada DISK_PRESSURE_INTERVAL se mide el espacio y los inodos libres del Docker local y de
+los hosts de DOCKER_HOSTS_FILE (su DockerRootDir) y de los hosts SSH (su directorio de
+trabajo y el de Docker si lo tienen).
+Un host por encima de DISK_PRESSURE_THRESHOLD o DISK_PRESSURE_INODE_THRESHOLD:
+
+- deja de recibir runners nuevos hasta que baja del umbral
+- limpia contenedores parados, imágenes sin usar, caché de build y volúmenes anónimos
+  (como mucho una vez cada DISK_PRESSURE_GC_INTERVAL); se respetan los runners y las
+  imágenes fijadas por la pre-descarga
+- si tras la limpieza sigue por encima de DISK_PRESSURE_EVICT_THRESHOLD, destruye los
+  runners libres (sin job) más antiguos, DISK_PRESSURE_EVICT_MAX por revisión
+
+La ocupación de cada host se publica en las métricas disk.usage_ratio y disk.pressure.
+"""
+
+import os
+import shlex
+import threading
+import time
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from src.services.image_prepull import PIN_LABEL
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Nombre del Docker local entre los hosts medidos
+LOCAL_HOST = "docker"
+
+# Bloques totales, bloques disponibles, tamaño de bloque, inodos totales e inodos libres
+STAT_FORMAT = "%b %a %S %c %d"
+
+GC_SCRIPT = f"""
+command -v docker >/dev/null 2>&1 || exit 0
+docker container prune -f --filter label!={PIN_LABEL} --filter label!=gha-ephemeral >/dev/null 2>&1
+docker image prune -af >/dev/null 2>&1
+docker builder prune -af >/dev/null 2>&1
+docker volume prune -f >/dev/null 2>&1
+exit 0
+"""
+
+
+def parse_stat(output: str) -> Dict[str, Any]:
+    """Ocupación de disco e inodos a partir de stat -f (sistemas sin inodos fijos, como btrfs, dan None)."""
+    blocks, available, block_size, inodes, free_inodes = (int(value) for value in output.split()[:5])
+    return {
+        "disk": round(1 - available / blocks, 4) if blocks else 0.0,
+        "inodes": round(1 - free_inodes / inodes, 4) if inodes else None,
+        "free_gb": round(available * block_size / 1024 ** 3, 2),
+    }
+
+
+def worst(readings: List[Dict[str, Any]]) -> Dict[str, Any]:
+    """Lectura del sistema de archivos más lleno de un host (por disco y por inodos)."""
+    return {
+        "disk": max(reading["disk"] for reading in readings),
+        "inodes": max((reading["inodes"] for reading in readings if reading["inodes"] is not None), default=None),
+        "free_gb": min(reading["free_gb"] for reading in readings),
+    }
+
+
+class DiskPressureMonitor:
+    """Mide los hosts, bloquea la colocación en los que tienen presión, limpia y desaloja runners libres."""
+
+    def __init__(
+        self,
+        lifecycle_manager: Any,
+        interval: int = 60,
+        threshold: float = 0.85,
+        inode_threshold: float = 0.85,
+        evict_threshold: float = 0.95,
+        evict_max: int = 2,
+        gc_interval: int = 600,
+        helper_image: str = "alpine:3.20",
+        local_path: Optional[str] = None,
+    ):
+        self.lifecycle_manager = lifecycle_manager
+        self.interval = interval
+        self.threshold = threshold
+        self.inode_threshold = inode_threshold
+        self.evict_threshold = evict_threshold
+        self.evict_max = evict_max
+        self.gc_interval = gc_interval
+        self.helper_image = helper_image
+        # Ruta local con el disco de Docker montado (statvfs directo en lugar de un contenedor auxiliar)
+        self.local_path = local_path
+        # host -> DockerRootDir de su daemon
+        self.docker_roots: Dict[str, str] = {}
+        # host -> {"backend", "disk", "inodes", "free_gb", "pressure", "checked_at", "last_gc"}
+        self.hosts: Dict[str, Dict[str, Any]] = {}
+        self.counters = {"gc": 0, "evicted": 0, "refused": 0}
+        self.lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'SUCCESS', 'Monitor de presión de disco iniciado',
+            f"cada {self.interval}s, umbral {self.threshold:.0%}, desalojo {self.evict_threshold:.0%}",
+        ))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error en el monitor de presión de disco', str(e)))
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+
+    # ===== Hosts =====
+
+    def _ssh_backend(self) -> Any:
+        return self.lifecycle_manager.container_manager.backends.get("ssh")
+
+    def _docker_hosts(self) -> Any:
+        return self.lifecycle_manager.container_manager.docker_hosts
+
+    def _targets(self) -> List[Tuple[str, str, Callable[[], Dict[str, Any]], Callable[[], None]]]:
+        """(host, backend, medición, limpieza) de cada host con runners."""
+        client = self.lifecycle_manager.container_manager.client
+        targets = [(LOCAL_HOST, "docker", self._measure_local, lambda: self._gc_docker(client))]
+        docker_hosts = self._docker_hosts()
+        for host in (docker_hosts.hosts.values() if docker_hosts else []):
+            # Sin respuesta no se puede medir; tampoco recibe runners
+            if not host.healthy:
+                continue
+            host_client = docker_hosts.client(host)
+            targets.append((
+                host.name, "docker",
+                lambda host=host, host_client=host_client: self._measure_docker(host.name, host_client),
+                lambda host_client=host_client: self._gc_docker(host_client),
+            ))
+        backend = self._ssh_backend()
+        for host in (backend.hosts.values() if backend else []):
+            targets.append((
+                host.name, "ssh",
+                lambda host=host: self._measure_ssh(backend, host),
+                lambda host=host: backend._run(host, GC_SCRIPT, timeout=600),
+            ))
+        return targets
+
+    def _measure_local(self) -> Dict[str, Any]:
+        if self.local_path:
+            stat = os.statvfs(self.local_path)
+            return parse_stat(f"{stat.f_blocks} {stat.f_bavail} {stat.f_frsize} {stat.f_files} {stat.f_ffree}")
+        return self._measure_docker(LOCAL_HOST, self.lifecycle_manager.container_manager.client)
+
+    def _measure_docker(self, name: str, client: Any) -> Dict[str, Any]:
+        if name not in self.docker_roots:
+            self.docker_roots[name] = client.info().get("DockerRootDir", "/var/lib/docker")
+        # El orchestrator no ve el disco del host: un contenedor auxiliar lo monta en solo lectura
+        output = client.containers.run(
+            self.helper_image, ["stat", "-f", "-c", STAT_FORMAT, "/host"],
+            volumes={self.docker_roots[name]: {"bind": "/host", "mode": "ro"}},
+            network_mode="none", remove=True, labels={"gha-disk-pressure": "true"},
+        )
+        return parse_stat(output.decode() if isinstance(output, bytes) else str(output))
+
+    def _measure_ssh(self, backend: Any, host: Any) -> Dict[str, Any]:
+        output = backend._run(host, f"""
+for p in {shlex.quote(host.workdir)} $(docker info -f '{{{{.DockerRootDir}}}}' 2>/dev/null); do
+    [ -d "$p" ] && stat -f -c '{STAT_FORMAT}' "$p"
+done
+exit 0
+""", timeout=30)
+        readings = [parse_stat(line) for line in output.splitlines() if len(line.split()) >= 5]
+        if not readings:
+            raise RuntimeError(f"sin lectura de disco en {host.workdir}")
+        return worst(readings)
+
+    def _gc_docker(self, client: Any):
+        # Ni los runners parados pendientes de destruir ni los contenedores que fijan imágenes pre-descargadas
+        client.containers.prune(filters={"label!": [PIN_LABEL, "gha-ephemeral"]})
+        client.images.prune(filters={"dangling": False})
+        client.api.prune_builds()
+        # Solo volúmenes anónimos: el tool cache y los workspaces tienen nombre
+        client.volumes.prune()
+
+    # ===== Revisión =====
+
+    def _pressured(self, reading: Dict[str, Any], threshold: float, inode_threshold: float) -> bool:
+        return reading["disk"] >= threshold or (reading["inodes"] is not None and reading["inodes"] >= inode_threshold)
+
+    def check(self):
+        for name, backend, measure, gc in self._targets():
+            try:
+                reading = measure()
+            except Exception as e:
+                logger.debug(f"No se pudo medir el disco de {name}: {e}")
+                continue
+            with self.lock:
+                state = self.hosts.setdefault(name, {"backend": backend, "last_gc": 0.0})
+                last_gc = state["last_gc"]
+            pressure = self._pressured(reading, self.threshold, self.inode_threshold)
+            if pressure and time.time() - last_gc >= self.gc_interval:
+                reading = self._collect(name, reading, measure, gc)
+                pressure = self._pressured(reading, self.threshold, self.inode_threshold)
+            self._record(name, backend, reading, pressure)
+            if self._pressured(reading, self.evict_threshold, self.evict_threshold):
+                self._evict(name, backend)
+
+    def _collect(self, name: str, before: Dict[str, Any], measure: Callable[[], Dict[str, Any]], gc: Callable[[], None]) -> Dict[str, Any]:
+        """Limpia el host y devuelve la lectura posterior."""
+        with self.lock:
+            self.hosts[name]["last_gc"] = time.time()
+        try:
+            gc()
+            after = measure()
+        except Exception as e:
+            metrics.incr("disk.gc", tags={"host": name, "result": "failed"})
+            logger.warning(format_log('WARNING', f'Limpieza de disco fallida en {name}', str(e)))
+            return before
+        self.counters["gc"] += 1
+        metrics.incr("disk.gc", tags={"host": name, "result": "success"})
+        logger.info(format_log(
+            'INFO', f'Limpieza de disco en {name}',
+            f"{before['disk']:.0%} -> {after['disk']:.0%} ({after['free_gb']} GiB libres)",
+        ))
+        return after
+
+    def _record(self, name: str, backend: str, reading: Dict[str, Any], pressure: bool):
+        with self.lock:
+            state = self.hosts[name]
+            previous = state.get("pressure", False)
+            state.update(reading, pressure=pressure, checked_at=time.time())
+        metrics.gauge("disk.usage_ratio", reading["disk"], tags={"host": name, "kind": "disk"})
+        if reading["inodes"] is not None:
+            metrics.gauge("disk.usage_ratio", reading["inodes"], tags={"host": name, "kind": "inodes"})
+        metrics.gauge("disk.pressure", 1 if pressure else 0, tags={"host": name})
+        if backend == "ssh":
+            self._ssh_backend().hosts[name].disk_pressure = pressure
+        elif name != LOCAL_HOST:
+            self._docker_hosts().hosts[name].disk_pressure = pressure
+        if pressure and not previous:
+            inodes = f"{reading['inodes']:.0%}" if reading["inodes"] is not None else "-"
+            logger.warning(format_log(
+                'WARNING', f'Presión de disco en {name}: no se colocan runners nuevos',
+                f"disco {reading['disk']:.0%}, inodos {inodes}, {reading['free_gb']} GiB libres",
+            ))
+            lifecycle_events.emit("host.disk_pressure", key=name, host=name, backend=backend, **reading)
+        elif previous and not pressure:
+            logger.info(format_log('SUCCESS', f'Presión de disco resuelta en {name}', f"{reading['free_gb']} GiB libres"))
+            lifecycle_events.emit("host.disk_pressure_resolved", key=name, host=name, backend=backend, **reading)
+
+    # ===== Desalojo =====
+
+    def _runners_on(self, name: str, backend: str) -> List[Tuple[str, Any]]:
+        runners = []
+        for runner_id, container in list(self.lifecycle_manager.active_runners.items()):
+            labels = getattr(container, "labels", None) or {}
+            if backend == "docker" and not labels.get("runner-backend") and labels.get("docker-host", LOCAL_HOST) == name:
+                runners.append((runner_id, container))
+            elif backend == "ssh" and labels.get("runner-backend") == "ssh" and container.host.name == name:
+                runners.append((runner_id, container))
+        return runners
+
+    def _idle(self, runners: List[Tuple[str, Any]]) -> List[str]:
+        """Runners registrados en GitHub sin job en curso; si GitHub no responde se dan por ocupados."""
+        scopes: Dict[Tuple[str, str], List[str]] = {}
+        for runner_id, container in runners:
+            labels = getattr(container, "labels", None) or {}
+            if labels.get("scope") and labels.get("scope_name"):
+                scopes.setdefault((labels["scope"], labels["scope_name"]), []).append(runner_id)
+        idle = []
+        for scope, names in scopes.items():
+            registrations = self.lifecycle_manager.github_cleanup.list_runners(*scope)
+            if registrations is None:
+                continue
+            by_name = {runner["name"]: runner for runner in registrations}
+            idle += [name for name in names if name in by_name and not by_name[name].get("busy", False)]
+        return idle
+
+    def _evict(self, name: str, backend: str):
+        runners = self._runners_on(name, backend)
+        created = {runner_id: str((getattr(container, "attrs", None) or {}).get("Created", "")) for runner_id, container in runners}
+        # Los que llevan más tiempo sin job primero
+        for runner_id in sorted(self._idle(runners), key=lambda runner_id: created.get(runner_id, ""))[:self.evict_max]:
+            if not self.lifecycle_manager.destroy_runner(runner_id):
+                continue
+            self.counters["evicted"] += 1
+            metrics.incr("disk.evictions", tags={"host": name})
+            logger.warning(format_log('WARNING', f'Runner libre desalojado por presión de disco en {name}', runner_id))
+            lifecycle_events.emit("runner.evicted", key=runner_id, runner_id=runner_id, host=name, reason="disk_pressure")
+
+    # ===== Colocación =====
+
+    def allows(self, host: str = LOCAL_HOST) -> bool:
+        """False si el host tiene presión de disco (un host sin medir admite runners)."""
+        with self.lock:
+            pressure = self.hosts.get(host, {}).get("pressure", False)
+        if pressure:
+            self.counters["refused"] += 1
+            metrics.incr("disk.placement_refused", tags={"host": host})
+        return not pressure
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            hosts = {
+                name: {key: value for key, value in state.items() if key in ("backend", "disk", "inodes", "free_gb", "pressure")}
+                for name, state in self.hosts.items()
+            }
+        return {"hosts": hosts, **self.counters}
+
+
+def create_disk_pressure_monitor(lifecycle_manager: Any) -> Optional[DiskPressureMonitor]:
+    """Monitor de presión de disco salvo con DISK_PRESSURE_ENABLED=false."""
+    if os.getenv("DISK_PRESSURE_ENABLED", "true").lower() != "true":
+        return None
+    return DiskPressureMonitor(
+        lifecycle_manager,
+        interval=int(os.getenv("DISK_PRESSURE_INTERVAL", "60")),
+        threshold=float(os.getenv("DISK_PRESSURE_THRESHOLD", "0.85")),
+        inode_threshold=float(os.getenv("DISK_PRESSURE_INODE_THRESHOLD", "0.85")),
+        evict_threshold=float(os.getenv("DISK_PRESSURE_EVICT_THRESHOLD", "0.95")),
+        evict_max=int(os.getenv("DISK_PRESSURE_EVICT_MAX", "2")),
+        gc_interval=int(os.getenv("DISK_PRESSURE_GC_INTERVAL", "600")),
+        helper_image=os.getenv("DISK_PRESSURE_IMAGE", "alpine:3.20"),
+        local_path=os.getenv("DISK_PRESSURE_PATH") or None,
+    )
@@ -8,7 +8,7 @@ import time
 from typing import Any, Dict, List, Optional
 
 import docker
-from src.utils.helpers import DockerError, ErrorHandler, setup_logger
+from src.utils.helpers import DockerError, ErrorHandler, redactor, setup_logger
 
 logger = setup_logger(__name__)
 
@@ -70,6 +70,20 @@ class DockerUtils:
         except Exception:
             return False
 
+    @staticmethod
+    def container_health(container: Any) -> Optional[str]:
+        """
+        Estado del HEALTHCHECK de la imagen (starting, healthy o unhealthy).
+
+        Args:
+            container: Contenedor Docker (con attrs ya recargados)
+
+        Returns:
+            El estado, o None si la imagen no define HEALTHCHECK
+        """
+        state = (getattr(container, "attrs", None) or {}).get("State") or {}
+        return (state.get("Health") or {}).get("Status")
+
     @staticmethod
     def get_container_labels(container: Any) -> Dict[str, str]:
         """
@@ -97,11 +111,11 @@ class DockerUtils:
             container: Contenedor Docker
 
         Returns:
-            Diccionario con variables de entorno
+            Diccionario con variables de entorno (valores sensibles ocultos)
         """
         try:
             container.reload()
-            return container.attrs.get("Config", {}).get("Env", [])
+            return redactor.redact_env(container.attrs.get("Config", {}).get("Env", []))
         except Exception:
             return {}
 
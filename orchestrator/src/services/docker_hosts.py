@@ -0,0 +1,419 @@
+"""
+Varios hosts Docker para el backend docker.
+Con DOCKER_HOSTS_FILE los contenedores de runners no se crean en el Docker del
+orchestrator sino en un inventario de daemons remotos (tcp:// con TLS mutuo, ssh:// o
+unix:// para el local). Cada runner va al host del pool con más capacidad libre:
+slots del inventario o, sin ellos, CPUs del host entre DOCKER_HOSTS_CPUS_PER_SLOT.
+
+- Cada DOCKER_HOSTS_CHECK_INTERVAL se comprueba cada host (ping y runners en marcha);
+  tras DOCKER_HOSTS_FAILURE_THRESHOLD fallos seguidos deja de recibir runners hasta
+  que vuelve a responder
+- Un host vaciado (drain) no recibe runners nuevos; los que tiene terminan sus jobs y
+  los libres se destruyen. El vaciado se guarda en DOCKER_HOSTS_STATE_FILE para que
+  sobreviva a un reinicio
+- Los hosts con presión de disco (ver disk_pressure.py) tampoco reciben runners
+"""
+
+import datetime
+import json
+import os
+import threading
+import time
+from typing import Any, Dict, List, Optional
+
+import docker
+import yaml
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import CapacityError, ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+# Archivos de certificados en el directorio TLS de cada host (convención de DOCKER_CERT_PATH)
+TLS_FILES = {"ca": "ca.pem", "cert": "cert.pem", "key": "key.pem"}
+SCHEMES = ("tcp://", "ssh://", "unix://")
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+class DockerHost:
+    """Daemon Docker del inventario con su capacidad y su último estado conocido."""
+
+    def __init__(
+        self,
+        name: str,
+        url: str,
+        slots: Optional[int] = None,
+        labels: Optional[List[str]] = None,
+        tls_dir: Optional[str] = None,
+        tls_ca: Optional[str] = None,
+        tls_cert: Optional[str] = None,
+        tls_key: Optional[str] = None,
+    ):
+        if not url.startswith(SCHEMES):
+            raise ConfigurationError(f"Host Docker {name}: url debe empezar por {', '.join(SCHEMES)}")
+        if slots is not None and int(slots) < 1:
+            raise ConfigurationError(f"Host Docker {name}: slots debe ser al menos 1")
+        self.name = name
+        self.url = url
+        self.slots = int(slots) if slots is not None else None
+        self.labels = labels or []
+        self.tls: Optional[Dict[str, str]] = None
+        if url.startswith("tcp://"):
+            tls_dir = tls_dir or (os.path.join(os.getenv("DOCKER_HOSTS_CERT_DIR"), name) if os.getenv("DOCKER_HOSTS_CERT_DIR") else None)
+            self.tls = {
+                "ca": tls_ca or (os.path.join(tls_dir, TLS_FILES["ca"]) if tls_dir else None),
+                "cert": tls_cert or (os.path.join(tls_dir, TLS_FILES["cert"]) if tls_dir else None),
+                "key": tls_key or (os.path.join(tls_dir, TLS_FILES["key"]) if tls_dir else None),
+            }
+            # Un daemon expuesto por TCP sin TLS mutuo da root en el host a quien lo alcance
+            missing = [kind for kind, path in self.tls.items() if not path or not os.path.exists(path)]
+            if missing:
+                raise ConfigurationError(f"Host Docker {name}: faltan los certificados TLS ({', '.join(missing)}) para {url}")
+        self._client: Optional[Any] = None
+        # Último estado conocido (se actualiza en cada comprobación)
+        self.healthy: Optional[bool] = None
+        self.failures = 0
+        self.last_error: Optional[str] = None
+        self.checked_at: Optional[float] = None
+        self.running = 0
+        self.cpus: Optional[int] = None
+        self.memory: Optional[int] = None
+        self.version: Optional[str] = None
+        # Vaciado para mantenimiento: {"reason", "by", "at"}
+        self.drained: Optional[Dict[str, Any]] = None
+        # Disco o inodos por encima del umbral (ver disk_pressure.py)
+        self.disk_pressure = False
+
+    @classmethod
+    def from_dict(cls, spec: Dict[str, Any]) -> "DockerHost":
+        if not spec.get("name") or not spec.get("url"):
+            raise ConfigurationError("Cada host Docker requiere 'name' y 'url'")
+        return cls(
+            name=spec["name"],
+            url=spec["url"],
+            slots=spec.get("slots"),
+            labels=spec.get("labels"),
+            tls_dir=spec.get("tls_dir"),
+            tls_ca=spec.get("tls_ca"),
+            tls_cert=spec.get("tls_cert"),
+            tls_key=spec.get("tls_key"),
+        )
+
+    @property
+    def local(self) -> bool:
+        """Socket local: comparte volúmenes (tool cache) con el Docker del orchestrator."""
+        return self.url.startswith("unix://")
+
+    def client(self, timeout: int = 60, max_pool_size: int = 10) -> Any:
+        if self._client is None:
+            tls = None
+            if self.tls:
+                tls = docker.tls.TLSConfig(client_cert=(self.tls["cert"], self.tls["key"]), ca_cert=self.tls["ca"], verify=True)
+            self._client = docker.DockerClient(base_url=self.url, tls=tls, timeout=timeout, max_pool_size=max_pool_size)
+        return self._client
+
+    def capacity(self, cpus_per_slot: float) -> int:
+        """Slots del inventario o los que caben según las CPUs del host (0 si aún no se conocen)."""
+        if self.slots is not None:
+            return self.slots
+        if not self.cpus:
+            return 0
+        return max(1, int(self.cpus // cpus_per_slot))
+
+    def matches(self, selectors: Optional[List[str]]) -> bool:
+        """Un pool sin docker_hosts usa todos los hosts; si no, por nombre o label."""
+        return not selectors or self.name in selectors or any(label in selectors for label in self.labels)
+
+
+class DockerHostPool:
+    """Inventario de hosts Docker: colocación por capacidad libre, vaciado y comprobación de salud."""
+
+    def __init__(
+        self,
+        hosts: List[DockerHost],
+        state_file: Optional[str] = None,
+        check_interval: int = 30,
+        failure_threshold: int = 2,
+        cpus_per_slot: float = 2,
+        timeout: int = 60,
+        max_pool_size: int = 10,
+    ):
+        if not hosts:
+            raise ConfigurationError("El inventario de hosts Docker no tiene hosts")
+        self.hosts: Dict[str, DockerHost] = {}
+        for host in hosts:
+            if host.name in self.hosts:
+                raise ConfigurationError(f"Host Docker {host.name} repetido en el inventario")
+            if host.name == "docker":
+                # Nombre con el que disk_pressure.py mide el Docker del orchestrator
+                raise ConfigurationError("Host Docker docker: nombre reservado para el Docker local")
+            self.hosts[host.name] = host
+        self.state_file = state_file
+        self.check_interval = check_interval
+        self.failure_threshold = failure_threshold
+        self.cpus_per_slot = cpus_per_slot
+        self.timeout = timeout
+        self.max_pool_size = max_pool_size
+        # Runners en creación: ocupan capacidad antes de aparecer en la comprobación del host
+        self.reserved: Dict[str, int] = {name: 0 for name in self.hosts}
+        self.lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self._load_state()
+
+    def _load_state(self):
+        if not self.state_file or not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                drained = json.load(state).get("drained", {})
+        except (OSError, ValueError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de los hosts Docker', str(e)))
+            return
+        for name, drain in drained.items():
+            if name in self.hosts:
+                self.hosts[name].drained = drain
+        if drained:
+            logger.info(format_log('CONFIG', 'Hosts Docker vaciados', ", ".join(sorted(drained))))
+
+    def _save_state(self):
+        if not self.state_file:
+            return
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({"drained": {name: host.drained for name, host in self.hosts.items() if host.drained}}, state)
+        os.replace(tmp_file, self.state_file)
+
+    def client(self, host: DockerHost) -> Any:
+        return host.client(self.timeout, self.max_pool_size)
+
+    def get(self, name: str) -> DockerHost:
+        host = self.hosts.get(name)
+        if not host:
+            raise ValueError(f"Host Docker {name} no encontrado ({', '.join(self.hosts)})")
+        return host
+
+    # ===== Colocación =====
+
+    def acquire(self, pool: Any) -> DockerHost:
+        """
+        Elige el host del pool con más capacidad libre y reserva un slot.
+
+        Raises:
+            CapacityError: Si ningún host del pool está sano, sin vaciar y con capacidad libre
+        """
+        candidates = [host for host in self.hosts.values() if host.matches(pool.docker_hosts)]
+        if not candidates:
+            raise ValueError(f"Pool {pool.name}: ningún host Docker coincide con {', '.join(pool.docker_hosts)}")
+
+        skipped = {"vaciados": 0, "sin respuesta": 0, "con presión de disco": 0}
+        best: Optional[DockerHost] = None
+        best_free = 0
+        with self.lock:
+            for host in candidates:
+                if host.drained:
+                    skipped["vaciados"] += 1
+                elif not host.healthy:
+                    skipped["sin respuesta"] += 1
+                elif host.disk_pressure:
+                    skipped["con presión de disco"] += 1
+                else:
+                    free = host.capacity(self.cpus_per_slot) - host.running - self.reserved[host.name]
+                    if free > best_free:
+                        best, best_free = host, free
+            if best is None:
+                detail = ", ".join(f"{count} {reason}" for reason, count in skipped.items() if count)
+                metrics.incr("docker_hosts.placement_refused", tags={"pool": pool.name})
+                raise CapacityError(f"Pool {pool.name}: sin capacidad libre en los hosts Docker" + (f" ({detail})" if detail else ""))
+            self.reserved[best.name] += 1
+        return best
+
+    def release(self, host: DockerHost, created: bool):
+        """Libera la reserva; si el contenedor se creó pasa a contar como runner del host."""
+        with self.lock:
+            self.reserved[host.name] -= 1
+            if created:
+                host.running += 1
+
+    # ===== Vaciado =====
+
+    def drain(self, name: str, reason: str = "", by: str = "") -> DockerHost:
+        host = self.get(name)
+        with self.lock:
+            if not host.drained:
+                host.drained = {"reason": reason, "by": by, "at": _now()}
+                self._save_state()
+        logger.warning(format_log('WARNING', f'Host Docker {name} vaciado: no recibe runners nuevos', reason or "-"))
+        lifecycle_events.emit("host.drained", key=name, host=name, backend="docker", reason=reason, by=by)
+        return host
+
+    def undrain(self, name: str, by: str = "") -> DockerHost:
+        host = self.get(name)
+        with self.lock:
+            host.drained = None
+            self._save_state()
+        logger.info(format_log('SUCCESS', f'Host Docker {name} vuelve a recibir runners', by or "-"))
+        lifecycle_events.emit("host.undrained", key=name, host=name, backend="docker", by=by)
+        return host
+
+    # ===== Salud =====
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Comprobación de hosts Docker iniciada', f"{len(self.hosts)} hosts cada {self.check_interval}s"))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error comprobando los hosts Docker', str(e)))
+            for _ in range(self.check_interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+
+    def check(self):
+        for host in list(self.hosts.values()):
+            self.check_host(host)
+
+    def check_host(self, host: DockerHost) -> bool:
+        """Ping, runners en marcha y, la primera vez, CPUs y memoria del host."""
+        try:
+            client = self.client(host)
+            client.ping()
+            running = len(client.containers.list(filters={"label": "gha-ephemeral=true"}))
+            if host.cpus is None:
+                info = client.info()
+                host.cpus, host.memory, host.version = info.get("NCPU"), info.get("MemTotal"), info.get("ServerVersion")
+        except Exception as e:
+            host.failures += 1
+            host.last_error = redactor.redact(str(e))[-500:]
+            if host.failures >= self.failure_threshold and host.healthy is not False:
+                host.healthy = False
+                logger.error(format_log('ERROR', f'Host Docker {host.name} sin respuesta: no recibe runners nuevos', host.last_error))
+                lifecycle_events.emit("host.unhealthy", key=host.name, host=host.name, backend="docker", error=host.last_error)
+            self._gauges(host)
+            return False
+
+        recovered = host.healthy is False
+        with self.lock:
+            host.running = running
+        host.healthy, host.failures, host.last_error, host.checked_at = True, 0, None, time.time()
+        if recovered:
+            logger.info(format_log('SUCCESS', f'Host Docker {host.name} responde de nuevo', f"{running} runners"))
+            lifecycle_events.emit("host.recovered", key=host.name, host=host.name, backend="docker")
+        self._gauges(host)
+        return True
+
+    def _gauges(self, host: DockerHost):
+        metrics.gauge("docker_hosts.healthy", 1 if host.healthy else 0, tags={"host": host.name})
+        metrics.gauge("docker_hosts.runners", host.running, tags={"host": host.name})
+        metrics.gauge("docker_hosts.capacity", host.capacity(self.cpus_per_slot), tags={"host": host.name})
+
+    # ===== Runners =====
+
+    def _healthy(self) -> List[DockerHost]:
+        return [host for host in self.hosts.values() if host.healthy]
+
+    def list_runners(self, all: bool = False) -> List[Any]:
+        """Contenedores de runners en los hosts que responden (con all, también los parados)."""
+        containers = []
+        for host in self._healthy():
+            try:
+                containers += self.client(host).containers.list(all=all, filters={"label": "gha-ephemeral=true"})
+            except Exception as e:
+                logger.debug(f"No se pudieron listar los runners del host Docker {host.name}: {e}")
+        return containers
+
+    def require_healthy(self):
+        """
+        Raises:
+            RuntimeError: Si algún host no responde (su inventario de runners estaría incompleto)
+        """
+        down = [host.name for host in self.hosts.values() if not host.healthy]
+        if down:
+            raise RuntimeError(f"Hosts Docker sin respuesta: {', '.join(down)}")
+
+    def find(self, filters: Dict[str, Any], all: bool = False) -> Optional[Any]:
+        """Primer contenedor que cumple los filtros en los hosts que responden."""
+        for host in self._healthy():
+            try:
+                containers = self.client(host).containers.list(all=all, filters=filters)
+            except Exception as e:
+                logger.debug(f"No se pudo buscar en el host Docker {host.name}: {e}")
+                continue
+            if containers:
+                return containers[0]
+        return None
+
+    def host_of(self, container: Any) -> Optional[DockerHost]:
+        return self.hosts.get((getattr(container, "labels", None) or {}).get("docker-host", ""))
+
+    def to_dict(self, host: DockerHost) -> Dict[str, Any]:
+        return {
+            "name": host.name,
+            "url": host.url,
+            "tls": bool(host.tls),
+            "labels": host.labels,
+            "slots": host.capacity(self.cpus_per_slot),
+            "running": host.running,
+            "reserved": self.reserved[host.name],
+            "cpus": host.cpus,
+            "memory": host.memory,
+            "version": host.version,
+            "healthy": host.healthy,
+            "last_error": host.last_error,
+            "checked_at": datetime.datetime.fromtimestamp(host.checked_at, datetime.timezone.utc).isoformat() if host.checked_at else None,
+            "drained": host.drained,
+            "disk_pressure": host.disk_pressure,
+        }
+
+    def status(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return [self.to_dict(host) for host in self.hosts.values()]
+
+
+def create_docker_hosts(max_pool_size: int = 10) -> Optional[DockerHostPool]:
+    """Inventario desde DOCKER_HOSTS_FILE (YAML o JSON), o None si no está configurado."""
+    path = os.getenv("DOCKER_HOSTS_FILE")
+    if not path:
+        return None
+    try:
+        with open(path, "r") as inventory_file:
+            data = yaml.safe_load(inventory_file)
+    except (OSError, yaml.YAMLError) as e:
+        raise ConfigurationError(f"No se pudo leer DOCKER_HOSTS_FILE {path}: {e}")
+    specs = data.get("hosts", []) if isinstance(data, dict) else data
+    if not isinstance(specs, list):
+        raise ConfigurationError("DOCKER_HOSTS_FILE debe ser una lista de hosts o un objeto con 'hosts'")
+
+    hosts = DockerHostPool(
+        [DockerHost.from_dict(spec) for spec in specs],
+        state_file=os.getenv("DOCKER_HOSTS_STATE_FILE") or None,
+        check_interval=int(os.getenv("DOCKER_HOSTS_CHECK_INTERVAL", "30")),
+        failure_threshold=int(os.getenv("DOCKER_HOSTS_FAILURE_THRESHOLD", "2")),
+        cpus_per_slot=float(os.getenv("DOCKER_HOSTS_CPUS_PER_SLOT", "2")),
+        timeout=int(os.getenv("DOCKER_HOSTS_TIMEOUT", "60")),
+        max_pool_size=max_pool_size,
+    )
+    # Primera comprobación antes de aceptar runners: sin ella ningún host sería elegible
+    hosts.check()
+    logger.info(format_log(
+        'CONFIG', 'Hosts Docker cargados',
+        ", ".join(f"{host.name} ({'ok' if host.healthy else 'sin respuesta'})" for host in hosts.hosts.values()),
+    ))
+    return hosts
@@ -0,0 +1,422 @@
+"""
+Backend de AWS ECS/Fargate.
+Cada runner es una tarea de Fargate lanzada desde una task definition por pool
+(imagen, CPU y memoria del pool); las variables del runner viajan como overrides
+de la tarea. La tarea termina sola cuando el runner efímero completa su job, se
+detiene con StopTask al destruir el runner y las revisiones de task definition
+que dejan de usarse se desregistran. Con egress_cidrs las tareas del pool usan un
+security group propio que solo deja salir a esos CIDRs y a GitHub (ver network_rules.py).
+"""
+
+import hashlib
+import json
+import math
+import os
+import threading
+from types import SimpleNamespace
+from typing import Any, Dict, List, Optional
+
+from src.services.aws import AWSCredentials, AWSError, AWSJsonClient, AWSQueryClient, aws_region
+from src.services.network_rules import GitHubRanges, PoolEgressRules, github_ranges
+from src.services.workspaces import UNITS, quota_for
+from src.utils.helpers import ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+# startedBy de las tareas propias; permite listarlas tras reiniciar el orchestrator
+STARTED_BY = "gha-ephemeral-runners"
+CONTAINER_NAME = "runner"
+
+# Estados de ECS en los que la tarea todavía puede ejecutar el job
+ACTIVE_STATUSES = ("PROVISIONING", "PENDING", "ACTIVATING", "RUNNING")
+
+DEFAULT_CPU = "1024"
+DEFAULT_MEMORY = "2048"
+
+EC2_API_VERSION = "2016-11-15"
+
+
+class ECSEgressRules(PoolEgressRules):
+    """Security group gha-runner-egress-<pool> en la VPC de ECS_SUBNETS, con reglas de salida a los destinos del pool."""
+
+    # Alguna interfaz de una tarea detenida sigue usando el grupo
+    IN_USE_ERRORS = ("DependencyViolation",)
+
+    def __init__(self, backend: "ECSBackend", ec2: AWSQueryClient, github: GitHubRanges):
+        super().__init__("ecs", github)
+        self.ecs_backend = backend
+        self.ec2 = ec2
+        self.vpc_id: Optional[str] = None
+
+    @staticmethod
+    def group_name(pool_name: str) -> str:
+        return f"gha-runner-egress-{pool_name}"
+
+    def _vpc(self) -> str:
+        if not self.vpc_id:
+            self.vpc_id = self.ec2.call("DescribeSubnets", {"SubnetId.1": self.ecs_backend.subnets[0]}).findtext("subnetSet/item/vpcId")
+        return self.vpc_id
+
+    def _find(self, pool_name: str) -> Optional[Any]:
+        groups = self.ec2.call("DescribeSecurityGroups", {
+            "Filter.1.Name": "group-name", "Filter.1.Value.1": self.group_name(pool_name),
+            "Filter.2.Name": "vpc-id", "Filter.2.Value.1": self._vpc(),
+        }).findall("securityGroupInfo/item")
+        return groups[0] if groups else None
+
+    def _apply(self, pool: Any, ipv4: List[str], ipv6: List[str]) -> str:
+        group = self._find(pool.name)
+        if group is None:
+            group_id = self.ec2.call("CreateSecurityGroup", {
+                "GroupName": self.group_name(pool.name),
+                "GroupDescription": f"Salida de los runners del pool {pool.name}",
+                "VpcId": self._vpc(),
+                "TagSpecification.1.ResourceType": "security-group",
+                "TagSpecification.1.Tag.1.Key": "managed-by", "TagSpecification.1.Tag.1.Value": STARTED_BY,
+                "TagSpecification.1.Tag.2.Key": "runner-pool", "TagSpecification.1.Tag.2.Value": pool.name,
+            }).findtext("groupId")
+            # Un grupo nuevo deja salir a todo (0.0.0.0/0): se revoca en el diff
+            current = {"0.0.0.0/0"}
+        else:
+            group_id = group.findtext("groupId")
+            current = set()
+            for permission in group.findall("ipPermissionsEgress/item"):
+                if permission.findtext("ipProtocol") == "-1":
+                    current.update(item.text for item in permission.findall("ipRanges/item/cidrIp"))
+                    current.update(item.text for item in permission.findall("ipv6Ranges/item/cidrIpv6"))
+
+        desired = set(ipv4) | set(ipv6)
+        for action, cidrs in (("AuthorizeSecurityGroupEgress", desired - current), ("RevokeSecurityGroupEgress", current - desired)):
+            if cidrs:
+                self.ec2.call(action, {"GroupId": group_id, **_ip_permissions(sorted(cidrs))})
+        return group_id
+
+    def _delete(self, pool_name: str) -> bool:
+        group = self._find(pool_name)
+        if group is None:
+            return False
+        self.ec2.call("DeleteSecurityGroup", {"GroupId": group.findtext("groupId")})
+        return True
+
+    def _in_use(self, pool_name: str) -> bool:
+        with self.ecs_backend.lock:
+            return any(task.labels.get("runner-pool") == pool_name for task in self.ecs_backend.tasks.values())
+
+
+def _ip_permissions(cidrs: List[str]) -> Dict[str, str]:
+    """Una regla de todos los protocolos hacia los CIDRs, en el formato aplanado de la API Query."""
+    params = {"IpPermissions.1.IpProtocol": "-1"}
+    ipv4 = [cidr for cidr in cidrs if ":" not in cidr]
+    ipv6 = [cidr for cidr in cidrs if ":" in cidr]
+    for index, cidr in enumerate(ipv4, 1):
+        params[f"IpPermissions.1.IpRanges.{index}.CidrIp"] = cidr
+    for index, cidr in enumerate(ipv6, 1):
+        params[f"IpPermissions.1.Ipv6Ranges.{index}.CidrIpv6"] = cidr
+    return params
+
+
+class ECSTask:
+    """
+    Tarea de Fargate con la interfaz de contenedor que usa el ciclo de vida.
+
+    Expone id, name, labels, status, attrs, reload(), stop(), remove() y logs().
+    """
+
+    def __init__(self, backend: "ECSBackend", task: Dict[str, Any]):
+        self.backend = backend
+        self.arn = task["taskArn"]
+        self.id = self.arn.rsplit("/", 1)[-1]
+        self.labels = {tag["key"]: tag["value"] for tag in task.get("tags", [])}
+        self.name = f"gha-runner-{self.labels.get('runner-name', self.id)}"
+        self.image = SimpleNamespace(tags=[self.labels.get("runner-image", "")])
+        self.ports: Dict[str, Any] = {}
+        self.attrs: Dict[str, Any] = {}
+        self.status = "running"
+        self.update(task)
+
+    def update(self, task: Dict[str, Any]):
+        last_status = task.get("lastStatus", "PROVISIONING")
+        self.status = "running" if last_status in ACTIVE_STATUSES else "exited"
+        self.attrs = {
+            "Created": str(task.get("createdAt", "")),
+            "Config": {"Image": self.labels.get("runner-image")},
+            "State": {"Status": last_status, "StoppedReason": task.get("stoppedReason")},
+        }
+
+    def reload(self):
+        self.backend.refresh(self)
+
+    def stop(self, timeout: int = 30):
+        self.backend.stop_task(self)
+
+    def remove(self, force: bool = False):
+        # ECS elimina las tareas detenidas por su cuenta
+        pass
+
+    def logs(self, tail: int = 50) -> bytes:
+        return self.backend.task_logs(self, tail).encode("utf-8")
+
+
+class ECSBackend:
+    """Lanza runners como tareas de Fargate en ECS_CLUSTER."""
+
+    def __init__(
+        self,
+        cluster: str,
+        subnets: List[str],
+        region: str,
+        security_groups: Optional[List[str]] = None,
+        assign_public_ip: bool = False,
+        execution_role_arn: Optional[str] = None,
+        task_role_arn: Optional[str] = None,
+        log_group: Optional[str] = None,
+        capacity_provider: str = "FARGATE",
+        family_prefix: str = "gha-runner",
+        endpoint: Optional[str] = None,
+        logs_endpoint: Optional[str] = None,
+        ec2_endpoint: Optional[str] = None,
+    ):
+        if not subnets:
+            raise ConfigurationError("ECS_SUBNETS es obligatorio con ECS_CLUSTER (redes awsvpc de Fargate)")
+        if log_group and not execution_role_arn:
+            raise ConfigurationError("ECS_LOG_GROUP requiere ECS_EXECUTION_ROLE_ARN para enviar logs a CloudWatch")
+        self.cluster = cluster
+        self.subnets = subnets
+        self.region = region
+        self.security_groups = security_groups or []
+        self.assign_public_ip = assign_public_ip
+        self.execution_role_arn = execution_role_arn
+        self.task_role_arn = task_role_arn
+        self.log_group = log_group
+        self.capacity_provider = capacity_provider
+        self.family_prefix = family_prefix
+        credentials = AWSCredentials()
+        self.ecs = AWSJsonClient("ecs", "AmazonEC2ContainerServiceV20141113", region, credentials, endpoint)
+        self.logs = AWSJsonClient("logs", "Logs_20140328", region, credentials, logs_endpoint)
+        self.egress = ECSEgressRules(self, AWSQueryClient("ec2", EC2_API_VERSION, region, credentials, ec2_endpoint), github_ranges)
+        # Task definition registrada por pool: (hash de la spec, ARN)
+        self.task_definitions: Dict[str, tuple] = {}
+        self.tasks: Dict[str, ECSTask] = {}
+        self.lock = threading.Lock()
+
+    def _task_definition(self, pool: Any, image: str, command: Optional[str]) -> str:
+        """ARN de la task definition del pool; registra una revisión nueva si cambió la spec."""
+        # Una familia por pool y clase de recursos: alternar tamaños no registra revisiones nuevas
+        key = f"{pool.name}-{pool.resources.name}" if pool.resources else pool.name
+        container: Dict[str, Any] = {"name": CONTAINER_NAME, "image": image, "essential": True}
+        if command:
+            container["command"] = ["sh", "-c", command]
+        if self.log_group:
+            container["logConfiguration"] = {
+                "logDriver": "awslogs",
+                "options": {
+                    "awslogs-group": self.log_group,
+                    "awslogs-region": self.region,
+                    "awslogs-stream-prefix": pool.name,
+                },
+            }
+        spec: Dict[str, Any] = {
+            "family": f"{self.family_prefix}-{key}",
+            "requiresCompatibilities": ["FARGATE"],
+            "networkMode": "awsvpc",
+            "cpu": str(pool.task_cpu or DEFAULT_CPU),
+            "memory": str(pool.task_memory or DEFAULT_MEMORY),
+            "containerDefinitions": [container],
+            "tags": [{"key": "managed-by", "value": STARTED_BY}, {"key": "runner-pool", "value": pool.name}],
+        }
+        # Fargate no limita directorios: la cuota del workspace fija el almacenamiento efímero
+        # de la tarea (entre 21 y 200 GiB), que es todo el disco que puede llenar el job
+        quota = quota_for(pool)
+        if quota:
+            spec["ephemeralStorage"] = {"sizeInGiB": min(200, max(21, math.ceil(quota.size / UNITS["g"])))}
+        if pool.task_architecture:
+            spec["runtimePlatform"] = {"cpuArchitecture": pool.task_architecture, "operatingSystemFamily": "LINUX"}
+        if self.execution_role_arn:
+            spec["executionRoleArn"] = self.execution_role_arn
+        if self.task_role_arn:
+            spec["taskRoleArn"] = self.task_role_arn
+
+        digest = hashlib.sha256(json.dumps(spec, sort_keys=True).encode()).hexdigest()
+        with self.lock:
+            current = self.task_definitions.get(key)
+        if current and current[0] == digest:
+            return current[1]
+
+        arn = self.ecs.call("RegisterTaskDefinition", spec)["taskDefinition"]["taskDefinitionArn"]
+        with self.lock:
+            self.task_definitions[key] = (digest, arn)
+        logger.info(format_log('CONFIG', 'Task definition registrada', f"{arn.rsplit('/', 1)[-1]} (pool {pool.name})"))
+
+        # La revisión anterior no se usará más; las tareas en curso no se ven afectadas
+        if current:
+            try:
+                self.ecs.call("DeregisterTaskDefinition", {"taskDefinition": current[1]})
+            except AWSError as e:
+                logger.warning(format_log('WARNING', 'No se pudo desregistrar la task definition anterior', str(e)))
+        return arn
+
+    def create_runner(
+        self,
+        runner_name: str,
+        image: str,
+        command: Optional[str],
+        environment: Dict[str, str],
+        labels: Dict[str, str],
+        pool: Any,
+    ) -> ECSTask:
+        """Lanza la tarea de Fargate del runner; retorna sin esperar a que esté en RUNNING."""
+        task_definition = self._task_definition(pool, image, command)
+        tags = {**labels, "runner-image": image, "runner-backend": "ecs"}
+
+        # Con egress_cidrs la tarea solo lleva el grupo del pool: otro grupo sumaría sus reglas de salida
+        with self.egress.creation(pool) as security_group:
+            request: Dict[str, Any] = {
+                "cluster": self.cluster,
+                "taskDefinition": task_definition,
+                "count": 1,
+                "startedBy": STARTED_BY,
+                "capacityProviderStrategy": [{"capacityProvider": self.capacity_provider, "weight": 1}],
+                "networkConfiguration": {"awsvpcConfiguration": {
+                    "subnets": self.subnets,
+                    "securityGroups": [security_group] if security_group else self.security_groups,
+                    "assignPublicIp": "ENABLED" if self.assign_public_ip else "DISABLED",
+                }},
+                "overrides": {"containerOverrides": [{
+                    "name": CONTAINER_NAME,
+                    "environment": [{"name": key, "value": str(value)} for key, value in environment.items()],
+                }]},
+                "tags": [{"key": key, "value": str(value)[:256]} for key, value in tags.items()],
+                "enableECSManagedTags": True,
+            }
+
+            logger.info(f"☁️ Lanzando tarea Fargate para {runner_name} en {self.cluster} (pool {pool.name})")
+            response = self.ecs.call("RunTask", request)
+            if response.get("failures") or not response.get("tasks"):
+                reasons = ", ".join(f"{failure.get('reason')} {failure.get('detail') or ''}".strip() for failure in response.get("failures", []))
+                raise ValueError(f"ECS no lanzó la tarea de {runner_name}: {reasons or 'sin detalle'}")
+
+            task = ECSTask(self, response["tasks"][0])
+            with self.lock:
+                self.tasks[task.labels.get("runner-name", task.id)] = task
+        logger.info(f"✅ Tarea Fargate lanzada: {task.id}")
+        return task
+
+    def _describe(self, arns: List[str]) -> List[Dict[str, Any]]:
+        tasks = []
+        for start in range(0, len(arns), 100):
+            response = self.ecs.call("DescribeTasks", {"cluster": self.cluster, "tasks": arns[start:start + 100], "include": ["TAGS"]})
+            tasks.extend(response.get("tasks", []))
+        return tasks
+
+    def refresh(self, task: ECSTask):
+        found = self._describe([task.arn])
+        if found:
+            task.update(found[0])
+        else:
+            task.status = "exited"
+            task.attrs["State"] = {"Status": "STOPPED"}
+
+    def stop_task(self, task: ECSTask):
+        if task.status == "running":
+            self.ecs.call("StopTask", {"cluster": self.cluster, "task": task.arn, "reason": "Runner destruido por el orchestrator"})
+        with self.lock:
+            self.tasks.pop(task.labels.get("runner-name", task.id), None)
+        task.status = "exited"
+        self.egress.release(task.labels.get("runner-pool"))
+
+    def force_delete(self, task: ECSTask):
+        """StopTask aunque la tarea ya figure detenida (tarea atascada deteniéndose)."""
+        self.ecs.call("StopTask", {"cluster": self.cluster, "task": task.arn, "reason": "Runner atascado: detención forzada"})
+        with self.lock:
+            self.tasks.pop(task.labels.get("runner-name", task.id), None)
+        task.status = "exited"
+        self.egress.release(task.labels.get("runner-pool"))
+
+    def task_logs(self, task: ECSTask, tail: int = 50) -> str:
+        if not self.log_group:
+            return "Logs no disponibles: ECS_LOG_GROUP no configurado"
+        pool = task.labels.get("runner-pool", "default")
+        response = self.logs.call("GetLogEvents", {
+            "logGroupName": self.log_group,
+            "logStreamName": f"{pool}/{CONTAINER_NAME}/{task.id}",
+            "limit": tail,
+            "startFromHead": False,
+        })
+        return redactor.redact("\n".join(event.get("message", "") for event in response.get("events", [])))
+
+    def get(self, runner_name: str) -> Optional[ECSTask]:
+        with self.lock:
+            return self.tasks.get(runner_name)
+
+    def list_runners(self) -> List[ECSTask]:
+        """Tareas activas lanzadas por el orchestrator (también las de antes de un reinicio)."""
+        arns: List[str] = []
+        token = None
+        while True:
+            request = {"cluster": self.cluster, "startedBy": STARTED_BY, "desiredStatus": "RUNNING"}
+            if token:
+                request["nextToken"] = token
+            response = self.ecs.call("ListTasks", request)
+            arns.extend(response.get("taskArns", []))
+            token = response.get("nextToken")
+            if not token:
+                break
+
+        result = []
+        for data in self._describe(arns) if arns else []:
+            task = ECSTask(self, data)
+            with self.lock:
+                tracked = self.tasks.get(task.labels.get("runner-name", task.id))
+            if tracked:
+                tracked.update(data)
+                task = tracked
+            if task.status == "running":
+                result.append(task)
+        # Grupos que seguían asociados a interfaces de tareas ya detenidas
+        self.egress.sweep()
+        return result
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "cluster": self.cluster,
+                "capacity_provider": self.capacity_provider,
+                "tracked_tasks": len(self.tasks),
+                "task_definitions": {pool: arn.rsplit("/", 1)[-1] for pool, (_, arn) in self.task_definitions.items()},
+                "egress": self.egress.status(),
+            }
+
+
+def create_ecs_backend() -> Optional[ECSBackend]:
+    """Backend desde ECS_CLUSTER y ECS_*, o None si no está configurado."""
+    cluster = os.getenv("ECS_CLUSTER")
+    if not cluster:
+        return None
+    region = aws_region()
+    if not region:
+        raise ConfigurationError("AWS_REGION es obligatorio con ECS_CLUSTER")
+
+    def split(name: str) -> List[str]:
+        return [item.strip() for item in os.getenv(name, "").split(",") if item.strip()]
+
+    capacity_provider = os.getenv("ECS_CAPACITY_PROVIDER", "FARGATE")
+    if capacity_provider not in ("FARGATE", "FARGATE_SPOT"):
+        raise ConfigurationError(f"ECS_CAPACITY_PROVIDER inválido: {capacity_provider} (FARGATE o FARGATE_SPOT)")
+
+    backend = ECSBackend(
+        cluster=cluster,
+        subnets=split("ECS_SUBNETS"),
+        region=region,
+        security_groups=split("ECS_SECURITY_GROUPS"),
+        assign_public_ip=os.getenv("ECS_ASSIGN_PUBLIC_IP", "false").lower() == "true",
+        execution_role_arn=os.getenv("ECS_EXECUTION_ROLE_ARN"),
+        task_role_arn=os.getenv("ECS_TASK_ROLE_ARN"),
+        log_group=os.getenv("ECS_LOG_GROUP"),
+        capacity_provider=capacity_provider,
+        family_prefix=os.getenv("ECS_TASK_FAMILY_PREFIX", "gha-runner"),
+        endpoint=os.getenv("ECS_ENDPOINT_URL"),
+        logs_endpoint=os.getenv("CLOUDWATCH_LOGS_ENDPOINT_URL"),
+        ec2_endpoint=os.getenv("EC2_ENDPOINT_URL"),
+    )
+    logger.info(format_log('CONFIG', 'Backend ECS/Fargate', f"{cluster} en {region} ({capacity_provider})"))
+    return backend
@@ -0,0 +1,209 @@
+"""
+Proxy de salida para el tráfico de los runners.
+Proxy HTTP/HTTPS (CONNECT) que solo permite destinos de una allowlist de dominios
+y registra los destinos denegados por runner.
+"""
+
+import asyncio
+import base64
+import json
+import os
+import threading
+from typing import Dict, List, Optional, Tuple
+
+from src.services.github_server import github_hostname, is_enterprise_server
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# GitHub (API, registro del runner, logs, artifacts y cache), registries y mirrors habituales
+DEFAULT_ALLOWED_DOMAINS = (
+    "github.com,*.github.com,*.githubusercontent.com,*.githubapp.com,"
+    "*.blob.core.windows.net,ghcr.io,*.ghcr.io,"
+    "registry-1.docker.io,auth.docker.io,production.cloudflare.docker.com,"
+    "pypi.org,files.pythonhosted.org,registry.npmjs.org,proxy.golang.org,sum.golang.org"
+)
+
+MAX_HEADER_SIZE = 64 * 1024
+
+
+class DomainAllowlist:
+    """Allowlist de dominios exactos y comodines (*.example.com)."""
+
+    def __init__(self, domains: List[str], ports: List[int]):
+        self.exact = set()
+        self.suffixes = []
+        for domain in domains:
+            domain = domain.strip().lower().rstrip(".")
+            if not domain:
+                continue
+            if domain.startswith("*."):
+                self.suffixes.append(domain[1:])
+            else:
+                self.exact.add(domain)
+        self.ports = set(ports)
+
+    def allows(self, host: str, port: int) -> bool:
+        host = host.lower().rstrip(".")
+        if port not in self.ports:
+            return False
+        return host in self.exact or any(host.endswith(suffix) for suffix in self.suffixes)
+
+
+class EgressProxy:
+    """Proxy de salida con allowlist y registro de denegaciones por runner."""
+
+    def __init__(self, allowlist: DomainAllowlist, connect_timeout: float = 10.0):
+        self.allowlist = allowlist
+        self.connect_timeout = connect_timeout
+        self.denied: Dict[str, Dict[str, int]] = {}
+        self.lock = threading.Lock()
+
+    @staticmethod
+    def _client_identity(headers: Dict[str, str], peer: Tuple) -> str:
+        """Identifica al runner por el usuario del proxy (runner_name@proxy) o por IP."""
+        auth = headers.get("proxy-authorization", "")
+        scheme, _, value = auth.partition(" ")
+        if scheme.lower() == "basic" and value:
+            try:
+                user = base64.b64decode(value).decode("utf-8").split(":", 1)[0]
+                if user:
+                    return user
+            except ValueError:
+                pass
+        return peer[0] if peer else "unknown"
+
+    @staticmethod
+    def _split_host_port(authority: str, default_port: int) -> Tuple[str, int]:
+        host, _, port = authority.rpartition(":")
+        if host and port.isdigit():
+            return host.strip("[]"), int(port)
+        return authority.strip("[]"), default_port
+
+    def _record_denied(self, runner: str, host: str, port: int):
+        destination = f"{host}:{port}"
+        with self.lock:
+            runner_denied = self.denied.setdefault(runner, {})
+            runner_denied[destination] = runner_denied.get(destination, 0) + 1
+        metrics.incr("egress.denied")
+        logger.warning(format_log('WARNING', 'Destino de salida denegado', f'{runner} -> {destination}'))
+
+    def denied_summary(self) -> Dict[str, Dict[str, int]]:
+        with self.lock:
+            return {runner: dict(destinations) for runner, destinations in self.denied.items()}
+
+    async def _pipe(self, reader: asyncio.StreamReader, writer: asyncio.StreamWriter):
+        try:
+            while True:
+                data = await reader.read(65536)
+                if not data:
+                    break
+                writer.write(data)
+                await writer.drain()
+        except (ConnectionError, asyncio.CancelledError):
+            pass
+        finally:
+            writer.close()
+
+    async def _respond(self, writer: asyncio.StreamWriter, status: str, body: str = ""):
+        payload = body.encode("utf-8")
+        writer.write(
+            f"HTTP/1.1 {status}\r\nContent-Length: {len(payload)}\r\n"
+            f"Content-Type: application/json\r\nConnection: close\r\n\r\n".encode("utf-8") + payload
+        )
+        await writer.drain()
+        writer.close()
+
+    async def handle_client(self, reader: asyncio.StreamReader, writer: asyncio.StreamWriter):
+        peer = writer.get_extra_info("peername")
+        try:
+            head = await reader.readuntil(b"\r\n\r\n")
+        except (asyncio.IncompleteReadError, asyncio.LimitOverrunError, ConnectionError):
+            writer.close()
+            return
+
+        lines = head.decode("latin-1").split("\r\n")
+        try:
+            method, target, version = lines[0].split(" ", 2)
+        except ValueError:
+            await self._respond(writer, "400 Bad Request")
+            return
+
+        headers = {}
+        for line in lines[1:]:
+            name, _, value = line.partition(":")
+            if name:
+                headers[name.strip().lower()] = value.strip()
+
+        # Endpoints locales de diagnóstico
+        if target.startswith("/"):
+            if target == "/healthz":
+                await self._respond(writer, "200 OK", json.dumps({"status": "ok"}))
+            elif target == "/denied":
+                await self._respond(writer, "200 OK", json.dumps(self.denied_summary()))
+            else:
+                await self._respond(writer, "404 Not Found")
+            return
+
+        runner = self._client_identity(headers, peer)
+
+        if method.upper() == "CONNECT":
+            host, port = self._split_host_port(target, 443)
+            request_bytes = b""
+        else:
+            scheme, _, rest = target.partition("://")
+            authority, slash, path = rest.partition("/")
+            host, port = self._split_host_port(authority, 443 if scheme == "https" else 80)
+            # Reescribir a forma origin y eliminar headers del proxy
+            forwarded = [f"{method} {slash}{path} {version}"]
+            forwarded += [
+                line for line in lines[1:]
+                if line and not line.lower().startswith(("proxy-authorization:", "proxy-connection:"))
+            ]
+            request_bytes = ("\r\n".join(forwarded) + "\r\n\r\n").encode("latin-1")
+
+        if not self.allowlist.allows(host, port):
+            self._record_denied(runner, host, port)
+            await self._respond(writer, "403 Forbidden", json.dumps({"error": f"destino {host} no permitido"}))
+            return
+
+        try:
+            upstream_reader, upstream_writer = await asyncio.wait_for(
+                asyncio.open_connection(host, port), timeout=self.connect_timeout
+            )
+        except (OSError, asyncio.TimeoutError) as e:
+            logger.debug(f"No se pudo conectar a {host}:{port} para {runner}: {e}")
+            await self._respond(writer, "502 Bad Gateway")
+            return
+
+        metrics.incr("egress.allowed")
+        if request_bytes:
+            upstream_writer.write(request_bytes)
+            await upstream_writer.drain()
+        else:
+            writer.write(b"HTTP/1.1 200 Connection Established\r\n\r\n")
+            await writer.drain()
+
+        await asyncio.gather(
+            self._pipe(reader, upstream_writer), self._pipe(upstream_reader, writer)
+        )
+
+    async def serve(self, host: str, port: int):
+        server = await asyncio.start_server(self.handle_client, host, port, limit=MAX_HEADER_SIZE)
+        logger.info(format_log('START', 'Proxy de salida escuchando', f'{host}:{port}'))
+        async with server:
+            await server.serve_forever()
+
+
+def create_egress_proxy() -> EgressProxy:
+    """Crea el proxy desde EGRESS_ALLOWED_DOMAINS, EGRESS_EXTRA_DOMAINS y EGRESS_ALLOWED_PORTS."""
+    domains = os.getenv("EGRESS_ALLOWED_DOMAINS", DEFAULT_ALLOWED_DOMAINS).split(",")
+    domains += os.getenv("EGRESS_EXTRA_DOMAINS", "").split(",")
+    if is_enterprise_server():
+        # Registro del runner y API del GitHub Enterprise Server configurado
+        domains.append(github_hostname())
+    ports = [int(port) for port in os.getenv("EGRESS_ALLOWED_PORTS", "80,443").split(",") if port.strip()]
+    allowlist = DomainAllowlist(domains, ports)
+    logger.info(format_log('CONFIG', 'Dominios permitidos', f'{len(allowlist.exact) + len(allowlist.suffixes)}'))
+    return EgressProxy(allowlist)
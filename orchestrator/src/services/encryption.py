@@ -0,0 +1,290 @@
+"""
+Cifrado en reposo del estado del orchestrator (cifrado de sobre).
+Cada valor se cifra con AES-256-GCM y una clave de datos (DEK) que el proceso genera al
+arrancar; la DEK se guarda junto al valor envuelta por la clave maestra (KEK), que vive
+en AWS KMS, en Vault Transit o en STATE_ENCRYPTION_KEYS y nunca toca el disco. Se
+cifran los secretos de firma de OUTBOUND_WEBHOOKS_FILE, el TENANTS_FILE, los payloads
+del outbox (EVENTS_OUTBOX_PATH) y los repositorios, workflows y ámbitos del registro de
+uso (USAGE_DB_PATH). Los tokens de registro y las credenciales de nube no se guardan en
+ningún almacén del orchestrator: viven en memoria hasta entregarse al runner. Los
+valores escritos antes de activar el cifrado se siguen leyendo en claro hasta la rotación:
+
+    python -m src.services.encryption rotate
+"""
+
+import base64
+import os
+import sys
+import threading
+from typing import Dict, Optional
+
+import requests
+from cryptography.exceptions import InvalidTag
+from cryptography.hazmat.primitives.ciphers.aead import AESGCM
+from src.services.aws import AWSCredentials, AWSError, AWSJsonClient, aws_region
+from src.services.secrets import VaultSecretsProvider, get_secrets_provider
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# enc:v1:<DEK envuelta en base64>:<nonce y texto cifrado en base64>
+PREFIX = "enc:v1:"
+NONCE_SIZE = 12
+
+
+def _b64(data: bytes) -> str:
+    return base64.b64encode(data).decode("ascii")
+
+
+class KeyProvider:
+    """Interfaz común de las claves maestras: envuelven y desenvuelven DEKs."""
+
+    name = "base"
+
+    def wrap(self, key: bytes) -> str:
+        raise NotImplementedError
+
+    def unwrap(self, wrapped: str) -> bytes:
+        raise NotImplementedError
+
+
+class LocalKeyProvider(KeyProvider):
+    """
+    Claves maestras en STATE_ENCRYPTION_KEYS ("id=clave en base64", separadas por coma).
+
+    La primera es la activa; las demás solo desenvuelven DEKs anteriores, así que una
+    clave retirada se quita de la lista después de la rotación.
+    """
+
+    name = "local"
+
+    def __init__(self, spec: str):
+        self.keys: Dict[str, bytes] = {}
+        for item in [item.strip() for item in spec.split(",") if item.strip()]:
+            key_id, _, value = item.partition("=")
+            try:
+                key = base64.b64decode(value, validate=True)
+            except ValueError:
+                key = b""
+            if not key_id.strip() or len(key) != 32:
+                raise ConfigurationError(f"STATE_ENCRYPTION_KEYS inválido: {key_id.strip() or item} (id=clave AES-256 en base64)")
+            self.keys[key_id.strip()] = key
+        if not self.keys:
+            raise ConfigurationError("STATE_ENCRYPTION=local requiere STATE_ENCRYPTION_KEYS")
+        self.active = next(iter(self.keys))
+
+    def wrap(self, key: bytes) -> str:
+        nonce = os.urandom(NONCE_SIZE)
+        return f"local:{self.active}:{_b64(nonce + AESGCM(self.keys[self.active]).encrypt(nonce, key, None))}"
+
+    def unwrap(self, wrapped: str) -> bytes:
+        _, key_id, data = wrapped.split(":", 2)
+        if key_id not in self.keys:
+            raise ConfigurationError(f"La clave maestra {key_id} ya no está en STATE_ENCRYPTION_KEYS")
+        raw = base64.b64decode(data)
+        return AESGCM(self.keys[key_id]).decrypt(raw[:NONCE_SIZE], raw[NONCE_SIZE:], None)
+
+
+class KMSKeyProvider(KeyProvider):
+    """Clave maestra en AWS KMS: el blob cifrado ya identifica la clave y su versión."""
+
+    name = "kms"
+
+    def __init__(self, key_id: str, region: str):
+        self.key_id = key_id
+        self.client = AWSJsonClient("kms", "TrentService", region, AWSCredentials())
+
+    def wrap(self, key: bytes) -> str:
+        try:
+            return self.client.call("Encrypt", {"KeyId": self.key_id, "Plaintext": _b64(key)})["CiphertextBlob"]
+        except AWSError as e:
+            raise ConfigurationError(f"KMS no pudo cifrar la clave de datos con {self.key_id}: {e}")
+
+    def unwrap(self, wrapped: str) -> bytes:
+        try:
+            return base64.b64decode(self.client.call("Decrypt", {"CiphertextBlob": wrapped})["Plaintext"])
+        except AWSError as e:
+            raise ConfigurationError(f"KMS no pudo descifrar la clave de datos: {e}")
+
+
+class VaultTransitKeyProvider(KeyProvider):
+    """
+    Clave maestra en el motor Transit de Vault, con la autenticación de SECRETS_PROVIDER=vault.
+
+    Rotar la clave en Vault (transit/keys/<clave>/rotate) no invalida las DEKs ya
+    envueltas mientras su versión siga por encima de min_decryption_version.
+    """
+
+    name = "vault"
+
+    def __init__(self, vault: VaultSecretsProvider, key_name: str, mount: str = "transit"):
+        self.vault = vault
+        self.key_name = key_name
+        self.mount = mount.strip("/")
+
+    def _call(self, operation: str, payload: Dict[str, str]) -> Dict[str, str]:
+        response = requests.post(
+            f"{self.vault.address}/v1/{self.mount}/{operation}/{self.key_name}",
+            json=payload,
+            headers=self.vault._headers(),
+            timeout=self.vault.timeout,
+        )
+        if response.status_code != 200:
+            raise ConfigurationError(f"Vault Transit falló en {operation} con {self.key_name}: {response.status_code}")
+        return response.json()["data"]
+
+    def wrap(self, key: bytes) -> str:
+        return self._call("encrypt", {"plaintext": _b64(key)})["ciphertext"]
+
+    def unwrap(self, wrapped: str) -> bytes:
+        return base64.b64decode(self._call("decrypt", {"ciphertext": wrapped})["plaintext"])
+
+
+class StateCipher:
+    """
+    Cifra valores de texto con la DEK activa del proceso.
+
+    Las DEKs desenvueltas se guardan en memoria por su forma envuelta, así que la KEK
+    solo se consulta una vez por DEK y no por cada valor.
+    """
+
+    def __init__(self, provider: KeyProvider):
+        self.provider = provider
+        self.key: Optional[bytes] = None
+        self.wrapped = ""
+        self.keys: Dict[str, bytes] = {}
+        self.lock = threading.Lock()
+
+    def _data_key(self):
+        with self.lock:
+            if self.key is None:
+                self.key = AESGCM.generate_key(bit_length=256)
+                self.wrapped = _b64(self.provider.wrap(self.key).encode("utf-8"))
+                self.keys[self.wrapped] = self.key
+            return self.key, self.wrapped
+
+    def rotate(self):
+        """Descarta la DEK activa: el próximo valor usa una nueva envuelta con la KEK actual."""
+        with self.lock:
+            self.key = None
+
+    def encrypt(self, value: str) -> str:
+        key, wrapped = self._data_key()
+        nonce = os.urandom(NONCE_SIZE)
+        return f"{PREFIX}{wrapped}:{_b64(nonce + AESGCM(key).encrypt(nonce, value.encode('utf-8'), None))}"
+
+    def decrypt(self, value: str) -> str:
+        wrapped, _, data = value[len(PREFIX):].partition(":")
+        with self.lock:
+            key = self.keys.get(wrapped)
+        try:
+            if key is None:
+                key = self.provider.unwrap(base64.b64decode(wrapped).decode("utf-8"))
+                with self.lock:
+                    self.keys[wrapped] = key
+            raw = base64.b64decode(data)
+            return AESGCM(key).decrypt(raw[:NONCE_SIZE], raw[NONCE_SIZE:], None).decode("utf-8")
+        except (InvalidTag, ValueError) as e:
+            raise ConfigurationError(f"No se pudo descifrar un valor del estado: {e or 'clave incorrecta'}")
+
+
+def create_state_cipher() -> Optional[StateCipher]:
+    """Crea el cifrado según STATE_ENCRYPTION (none/local/kms/vault)."""
+    mode = os.getenv("STATE_ENCRYPTION", "none").lower()
+    key_id = os.getenv("STATE_ENCRYPTION_KEY_ID", "gha-ephemeral-runners")
+
+    if mode == "none":
+        return None
+    if mode == "local":
+        provider: KeyProvider = LocalKeyProvider(get_secrets_provider().get("STATE_ENCRYPTION_KEYS") or "")
+    elif mode == "kms":
+        region = aws_region()
+        if not os.getenv("STATE_ENCRYPTION_KEY_ID") or not region:
+            raise ConfigurationError("STATE_ENCRYPTION=kms requiere STATE_ENCRYPTION_KEY_ID (id, ARN o alias) y AWS_REGION")
+        provider = KMSKeyProvider(key_id, region)
+    elif mode == "vault":
+        vault = get_secrets_provider()
+        if not isinstance(vault, VaultSecretsProvider):
+            raise ConfigurationError("STATE_ENCRYPTION=vault requiere SECRETS_PROVIDER=vault")
+        provider = VaultTransitKeyProvider(vault, key_id, os.getenv("VAULT_TRANSIT_MOUNT", "transit"))
+    else:
+        raise ConfigurationError(f"STATE_ENCRYPTION no soportado: {mode}")
+
+    logger.info(format_log('CONFIG', 'Cifrado del estado en reposo', provider.name))
+    return StateCipher(provider)
+
+
+_cipher: Optional[StateCipher] = None
+_cipher_loaded = False
+
+
+def get_state_cipher() -> Optional[StateCipher]:
+    """Retorna el cifrado compartido (creado en el primer uso), o None sin STATE_ENCRYPTION."""
+    global _cipher, _cipher_loaded
+    if not _cipher_loaded:
+        _cipher = create_state_cipher()
+        _cipher_loaded = True
+    return _cipher
+
+
+def encrypt_value(value: Optional[str]) -> Optional[str]:
+    """Cifra un valor si STATE_ENCRYPTION está activo (None y vacíos se guardan tal cual)."""
+    cipher = get_state_cipher()
+    if cipher is None or not value:
+        return value
+    return cipher.encrypt(value)
+
+
+def decrypt_value(value: Optional[str]) -> Optional[str]:
+    """Descifra un valor; los escritos antes de activar el cifrado se devuelven en claro."""
+    if not value or not value.startswith(PREFIX):
+        return value
+    cipher = get_state_cipher()
+    if cipher is None:
+        raise ConfigurationError("El estado está cifrado pero STATE_ENCRYPTION no está configurado")
+    return cipher.decrypt(value)
+
+
+def rotate_state() -> Dict[str, int]:
+    """
+    Vuelve a cifrar todo el estado con una DEK nueva envuelta por la KEK actual.
+
+    Los valores en claro quedan cifrados, así que también sirve para activar el cifrado
+    sobre un estado existente. Retorna los valores reescritos por almacén.
+    """
+    # Importación diferida: los almacenes importan este módulo
+    from src.services.outbound_webhooks import OutboundWebhooks
+    from src.services.outbox import EventOutbox
+    from src.services.tenants import TenantRegistry
+    from src.services.usage import UsageLedger
+
+    cipher = get_state_cipher()
+    if cipher is None:
+        raise ConfigurationError("La rotación requiere STATE_ENCRYPTION")
+    cipher.rotate()
+
+    rotated = {}
+    if os.getenv("OUTBOUND_WEBHOOKS_FILE"):
+        rotated["outbound_webhooks"] = OutboundWebhooks(os.environ["OUTBOUND_WEBHOOKS_FILE"]).reencrypt()
+    if os.getenv("TENANTS_FILE"):
+        rotated["tenants"] = TenantRegistry(os.environ["TENANTS_FILE"]).reencrypt()
+    if os.getenv("EVENTS_OUTBOX_PATH"):
+        rotated["outbox"] = EventOutbox(os.environ["EVENTS_OUTBOX_PATH"]).reencrypt()
+    if os.getenv("USAGE_DB_PATH"):
+        rotated["usage"] = UsageLedger(os.environ["USAGE_DB_PATH"], {}).reencrypt()
+    for store, count in rotated.items():
+        logger.info(format_log('SUCCESS', 'Estado cifrado con la nueva clave de datos', f"{store}: {count} valores"))
+    return rotated
+
+
+if __name__ == "__main__":
+    from src.utils.config_file import load_config_file, profile_from_args
+
+    if sys.argv[1:2] != ["rotate"]:
+        sys.exit("Uso: python -m src.services.encryption rotate [--profile <perfil>]")
+    load_config_file(profile=profile_from_args(sys.argv[2:]))
+    try:
+        rotate_state()
+    except ConfigurationError as e:
+        logger.error(format_log('ERROR', 'Rotación de la clave del estado fallida', str(e)))
+        sys.exit(1)
@@ -2,6 +2,7 @@ import logging
 import os
 from typing import Any, Dict, List, Optional
 
+from src.services.github_server import github_web_url
 from src.utils.helpers import PlaceholderResolver, setup_logger
 
 logger = setup_logger(__name__)
@@ -98,7 +99,7 @@ class EnvironmentManager:
                 # Log específico para REPO_URL
                 if key == "REPO_URL":
                     logger.info(f"REPO_URL resuelto: '{resolved_value}'")
-                    if not resolved_value or resolved_value == "https://github.com/":
+                    if not resolved_value or resolved_value == f"{github_web_url()}/":
                         logger.error(f"REPO_URL inválido: '{resolved_value}'")
 
                 # Log de todas las variables procesadas para debugging
@@ -135,7 +136,7 @@ class EnvironmentManager:
             # No usar hardcodeo, lanzar error
             raise ValueError(f"scope_name inválido: '{scope_name}'. Debe ser 'owner/repo'")
 
-        repo_url = f"https://github.com/{scope_name}"
+        repo_url = f"{github_web_url()}/{scope_name}"
         logger.info(f"Configuración por defecto - REPO_URL: {repo_url}")
 
         # SOLO las variables que no pueden venir del .env
@@ -0,0 +1,230 @@
+"""
+Feature flags para comportamientos riesgosos.
+Las flags se definen en FEATURE_FLAGS_FILE (YAML) o en orchestrator.feature_flags de
+CONFIG_FILE, se recargan junto con los pools y se evalúan por entorno
+(DEPLOY_ENVIRONMENT) y por owner o repositorio para activarlas gradualmente.
+"""
+
+import difflib
+import hashlib
+import os
+import threading
+from typing import Any, Dict, List, Optional
+
+import yaml
+
+from src.utils import config_file
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Flags conocidas; un nombre fuera de esta lista es un error de configuración
+KNOWN_FLAGS = {
+    "preemption": "Desalojar runners de baja prioridad cuando no hay capacidad",
+    "spot_instances": "Aprovisionar runners en instancias spot/preemptibles",
+    "jit_config": "Registrar runners con JIT config en lugar de token de registro",
+    "routing_v2": "Motor de ruteo de jobs a pools v2",
+}
+
+FLAG_FIELDS = ("enabled", "environments", "scopes", "percentage")
+
+
+class FeatureFlag:
+    """
+    Definición de una flag.
+
+    Se activa si `enabled` es true, si el owner/repositorio está en `scopes`, o para
+    un `percentage` estable de owners/repositorios. `environments` limita los entornos
+    donde puede activarse.
+    """
+
+    def __init__(
+        self,
+        name: str,
+        enabled: bool = False,
+        environments: Optional[List[str]] = None,
+        scopes: Optional[List[str]] = None,
+        percentage: int = 0,
+    ):
+        self.name = name
+        self.enabled = enabled
+        self.environments = environments or []
+        self.scopes = scopes or []
+        self.percentage = percentage
+
+    @classmethod
+    def from_spec(cls, name: str, spec: Any) -> "FeatureFlag":
+        if isinstance(spec, bool):
+            return cls(name, enabled=spec)
+        if not isinstance(spec, dict):
+            raise ConfigurationError(f"Flag {name}: se esperaba true/false o un mapa")
+
+        unknown = [key for key in spec if key not in FLAG_FIELDS]
+        if unknown:
+            raise ConfigurationError(f"Flag {name}: campos desconocidos: {', '.join(unknown)}")
+
+        percentage = spec.get("percentage", 0)
+        if not isinstance(percentage, int) or isinstance(percentage, bool) or not 0 <= percentage <= 100:
+            raise ConfigurationError(f"Flag {name}: percentage debe ser un entero entre 0 y 100")
+
+        for key in ("environments", "scopes"):
+            if not isinstance(spec.get(key, []), list):
+                raise ConfigurationError(f"Flag {name}: {key} debe ser una lista")
+
+        return cls(
+            name,
+            enabled=bool(spec.get("enabled", False)),
+            environments=[str(item) for item in spec.get("environments", [])],
+            scopes=[str(item) for item in spec.get("scopes", [])],
+            percentage=percentage,
+        )
+
+    def _in_rollout(self, scope: str) -> bool:
+        # Hash estable: el mismo owner/repositorio queda siempre del mismo lado
+        bucket = int(hashlib.sha256(f"{self.name}:{scope}".encode()).hexdigest(), 16) % 100
+        return bucket < self.percentage
+
+    def evaluate(self, environment: Optional[str], scope_name: Optional[str]) -> bool:
+        if self.environments and environment not in self.environments:
+            return False
+        if self.enabled:
+            return True
+        if not scope_name:
+            return False
+
+        owner = scope_name.split("/")[0]
+        if scope_name in self.scopes or owner in self.scopes:
+            return True
+        return self.percentage > 0 and self._in_rollout(scope_name)
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "description": KNOWN_FLAGS.get(self.name),
+            "enabled": self.enabled,
+            "environments": self.environments,
+            "scopes": self.scopes,
+            "percentage": self.percentage,
+        }
+
+
+def parse_overrides(raw: str) -> Dict[str, bool]:
+    """Parsea FEATURE_FLAG_OVERRIDES ("jit_config=on,spot_instances=off")."""
+    overrides = {}
+    for item in raw.split(","):
+        if not item.strip():
+            continue
+        name, _, value = item.partition("=")
+        value = value.strip().lower()
+        if value not in ("on", "off", "true", "false"):
+            raise ConfigurationError(f"FEATURE_FLAG_OVERRIDES: valor inválido para {name.strip()}: '{value}'")
+        overrides[name.strip()] = value in ("on", "true")
+    return overrides
+
+
+def _validate_names(names: List[str], source: str):
+    for name in names:
+        if name not in KNOWN_FLAGS:
+            suggestion = difflib.get_close_matches(name, list(KNOWN_FLAGS), n=1)
+            hint = f"; ¿quisiste decir '{suggestion[0]}'?" if suggestion else ""
+            raise ConfigurationError(f"{source}: flag desconocida '{name}'{hint}")
+
+
+class FeatureFlags:
+    """Registro de flags con recarga en caliente."""
+
+    def __init__(self, path: Optional[str] = None):
+        self.path = path
+        self.environment = os.getenv("DEPLOY_ENVIRONMENT")
+        self.lock = threading.Lock()
+        self.flags: Dict[str, FeatureFlag] = {}
+        self.overrides: Dict[str, bool] = {}
+        self.flags, self.overrides = self._load()
+
+    def _read_specs(self) -> Dict[str, Any]:
+        if not self.path:
+            return config_file.FILE_FEATURE_FLAGS or {}
+        try:
+            with open(self.path, "r") as flags_file:
+                data = yaml.safe_load(flags_file) or {}
+        except (OSError, yaml.YAMLError) as e:
+            raise ConfigurationError(f"No se pudo leer FEATURE_FLAGS_FILE {self.path}: {e}")
+        data = data.get("feature_flags", data) if isinstance(data, dict) else data
+        if not isinstance(data, dict):
+            raise ConfigurationError(f"FEATURE_FLAGS_FILE {self.path}: se esperaba un mapa flag: definición")
+        return data
+
+    def _load(self):
+        specs = self._read_specs()
+        _validate_names(list(specs), self.path or "orchestrator.feature_flags")
+        overrides = parse_overrides(os.getenv("FEATURE_FLAG_OVERRIDES", ""))
+        _validate_names(list(overrides), "FEATURE_FLAG_OVERRIDES")
+
+        flags = {name: FeatureFlag(name) for name in KNOWN_FLAGS}
+        for name, spec in specs.items():
+            flags[name] = FeatureFlag.from_spec(name, spec)
+        return flags, overrides
+
+    def reload(self) -> List[str]:
+        """
+        Vuelve a leer las flags; si la nueva definición es inválida se conserva la actual.
+
+        Returns:
+            Nombres de las flags cuya definición cambió
+        """
+        if not self.path and os.getenv("CONFIG_FILE"):
+            try:
+                config_file.load_config_file()
+            except config_file.ConfigFileError as e:
+                raise ConfigurationError(str(e))
+
+        flags, overrides = self._load()
+        with self.lock:
+            changed = sorted(
+                name for name in flags
+                if flags[name].to_dict() != self.flags[name].to_dict()
+                or overrides.get(name) != self.overrides.get(name)
+            )
+            self.flags, self.overrides = flags, overrides
+
+        if changed:
+            logger.info(format_log('CONFIG', 'Feature flags recargadas', ", ".join(changed)))
+        return changed
+
+    def is_enabled(self, name: str, scope_name: Optional[str] = None) -> bool:
+        """
+        Evalúa una flag para el owner/repositorio indicado.
+
+        Args:
+            name: Nombre de la flag (ver KNOWN_FLAGS)
+            scope_name: Owner u owner/repo al que aplica la decisión
+        """
+        with self.lock:
+            if name in self.overrides:
+                return self.overrides[name]
+            flag = self.flags.get(name)
+        if not flag:
+            raise ValueError(f"Flag desconocida: {name}")
+        return flag.evaluate(self.environment, scope_name)
+
+    def describe(self, scope_name: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Definición de cada flag y su evaluación (global o para scope_name)."""
+        with self.lock:
+            flags = list(self.flags.values())
+            overrides = dict(self.overrides)
+        result = []
+        for flag in flags:
+            result.append({
+                **flag.to_dict(),
+                "override": overrides.get(flag.name),
+                "active": self.is_enabled(flag.name, scope_name),
+            })
+        return result
+
+
+def create_feature_flags() -> FeatureFlags:
+    """Crea el registro de flags desde FEATURE_FLAGS_FILE o CONFIG_FILE."""
+    return FeatureFlags(os.getenv("FEATURE_FLAGS_FILE"))
+
+
+feature_flags = create_feature_flags()
@@ -0,0 +1,416 @@
+"""
+Cambios de flota blue/green.
+Un cambio toma un conjunto de pools (azul) y crea para cada uno un pool paralelo (verde)
+con los cambios pedidos (imagen, clase de recursos, seguridad...): se clona desde un
+snapshot del azul como <pool>-<sufijo>, con las mismas labels. Los runners que piden un
+pool azul van a su verde en la proporción del paso actual (FLEET_CUTOVER_STEPS): cada
+paso dura al menos FLEET_CUTOVER_STEP_INTERVAL y necesita FLEET_CUTOVER_MIN_RUNNERS
+runners verdes. Si la proporción de verdes que no se aprovisionan o no se registran en
+GitHub supera la de los azules en más de FLEET_CUTOVER_MAX_FAILURE_MARGIN, el cambio se
+revierte solo y los verdes se retiran. Al terminar el último paso se retiran los azules,
+y sus labels llevan desde entonces a los verdes. Un cambio completado también se puede
+revertir: los azules se restauran y los verdes se retiran.
+
+Los pools verdes y los retirados viven en el archivo de pools (POOL_ARCHIVE_FILE) y el
+estado de los cambios en FLEET_CUTOVER_STATE_FILE, así que sobreviven a recargas de la
+configuración y a reinicios.
+"""
+
+import collections
+import copy
+import datetime
+import json
+import os
+import random
+import threading
+import time
+import uuid
+from typing import Any, Dict, List, Optional
+
+from src.services.image_builder import parse_steps
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.pool_archive import pool_archive, pool_spec
+from src.services.pools import DEFAULT_POOL, RunnerPool
+from src.utils.helpers import ConfigurationError, ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+CUTOVER_FINISHED = ("completed", "rolled_back")
+
+# El enrutado por labels pasa a los verdes porque tienen las mismas que los azules
+FIXED_KEYS = ("name", "labels")
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+def _counters() -> Dict[str, Dict[str, int]]:
+    return {"blue": {"runners": 0, "failed": 0}, "green": {"runners": 0, "failed": 0}}
+
+
+def _rate(counters: Dict[str, int]) -> float:
+    return counters["failed"] / counters["runners"] if counters["runners"] else 0.0
+
+
+def cutover_policy(overrides: Optional[Dict[str, Any]] = None) -> Dict[str, Any]:
+    """Política por defecto (FLEET_CUTOVER_*) con los valores pedidos para el cambio."""
+    overrides = overrides or {}
+    policy = {
+        "steps": parse_steps(overrides.get("steps", os.getenv("FLEET_CUTOVER_STEPS", "10,25,50,100")), "FLEET_CUTOVER_STEPS"),
+        "step_interval": int(overrides.get("step_interval", os.getenv("FLEET_CUTOVER_STEP_INTERVAL", "900"))),
+        "min_runners": int(overrides.get("min_runners", os.getenv("FLEET_CUTOVER_MIN_RUNNERS", "10"))),
+        "max_failure_margin": float(overrides.get("max_failure_margin", os.getenv("FLEET_CUTOVER_MAX_FAILURE_MARGIN", "0.1"))),
+    }
+    if not 0 <= policy["max_failure_margin"] <= 1:
+        raise ConfigurationError("FLEET_CUTOVER_MAX_FAILURE_MARGIN debe estar entre 0 y 1")
+    return policy
+
+
+class FleetCutovers:
+    """Cambios blue/green en curso y recientes, enrutado de runners y comparación de fallos."""
+
+    def __init__(self, state_file: str, history: int = 50):
+        self.state_file = state_file
+        self.history = history
+        self.cutovers: "collections.OrderedDict[str, Dict[str, Any]]" = collections.OrderedDict()
+        # runner -> (cambio, lado), para atribuir los fallos de registro
+        self.runners: Dict[str, tuple] = {}
+        self.lock = threading.Lock()
+        self._load_state()
+
+    def _load_state(self):
+        if not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                data = json.load(state)
+            self.cutovers = collections.OrderedDict((item["id"], item) for item in data.get("cutovers", []))
+            logger.info(format_log('CONFIG', 'Cambios blue/green cargados', f"{len(self.active())} en curso"))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de los cambios blue/green', str(e)))
+
+    def _save_state(self):
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({"cutovers": list(self.cutovers.values())}, state)
+        os.replace(tmp_file, self.state_file)
+
+    def _trim(self):
+        while len(self.cutovers) > self.history:
+            oldest = next((key for key, item in self.cutovers.items() if item["status"] in CUTOVER_FINISHED), None)
+            if oldest is None:
+                break
+            self.cutovers.pop(oldest)
+
+    def active(self) -> List[Dict[str, Any]]:
+        return [cutover for cutover in self.cutovers.values() if cutover["status"] == "running"]
+
+    # ===== Inicio =====
+
+    def start(
+        self,
+        manager: Any,
+        pools: List[str],
+        changes: Dict[str, Any],
+        suffix: str = "green",
+        policy: Optional[Dict[str, Any]] = None,
+        started_by: str = "",
+    ) -> Dict[str, Any]:
+        """
+        Crea los pools verdes y empieza a enviarles runners al primer paso.
+
+        Raises:
+            ValidationError: Si los pools o los cambios no son válidos (no se crea ningún pool)
+        """
+        if not pools or len(set(pools)) != len(pools):
+            raise ValidationError("Indica los pools del cambio, sin repetir")
+        if not isinstance(changes, dict) or not changes:
+            raise ValidationError("Indica los cambios de los pools verdes (image u otras opciones del pool)")
+        fixed = [key for key in FIXED_KEYS if key in changes]
+        if fixed:
+            raise ValidationError(f"Los pools verdes conservan {', '.join(fixed)} de los azules")
+        if not suffix or not suffix.replace("-", "").isalnum():
+            raise ValidationError(f"Sufijo inválido: {suffix}")
+        try:
+            policy = cutover_policy(policy)
+        except (ConfigurationError, TypeError, ValueError) as e:
+            raise ValidationError(str(e))
+
+        registry = manager.pools
+        with self.lock:
+            busy = {name for cutover in self.active() for pair in cutover["pools"] for name in (pair["blue"], pair["green"])}
+        greens = []
+        for name in pools:
+            if name == DEFAULT_POOL:
+                raise ValidationError("El pool default no se puede retirar: no admite cambios blue/green")
+            if name in busy:
+                raise ValidationError(f"El pool {name} ya está en un cambio blue/green en curso")
+            blue = registry.get(name)
+            green = f"{name}-{suffix}"
+            if green in registry.pools or green in registry.retired:
+                raise ValidationError(f"El pool {green} ya existe; usa otro sufijo")
+            # Validar todos los verdes antes de crear ninguno
+            try:
+                RunnerPool.from_dict({**pool_spec(blue), **changes, "name": green})
+            except ConfigurationError as e:
+                raise ValidationError(str(e))
+            greens.append((blue, green))
+
+        cutover_id = str(uuid.uuid4())
+        pairs = []
+        with manager.runner_lock:
+            for blue, green in greens:
+                snapshot = pool_archive.snapshot(blue, note=f"Cambio blue/green {cutover_id}", created_by=started_by)
+                pool_archive.restore(snapshot["id"], registry, name=green, created_by=started_by, changes=changes)
+                pairs.append({"blue": blue.name, "green": green, "snapshot": snapshot["id"]})
+        cutover = {
+            "id": cutover_id,
+            "pools": pairs,
+            "changes": changes,
+            "policy": policy,
+            "status": "running",
+            "step": 0,
+            "weight": policy["steps"][0],
+            "started_by": started_by,
+            "started_at": _now(),
+            "step_started": time.time(),
+            "finished_at": None,
+            "reason": None,
+            "runners": _counters(),
+            "step_runners": _counters(),
+        }
+        with self.lock:
+            self.cutovers[cutover_id] = cutover
+            self._trim()
+            self._save_state()
+        detail = ", ".join(f"{pair['blue']} -> {pair['green']}" for pair in pairs)
+        logger.info(format_log('INFO', 'Cambio blue/green iniciado', f"{detail} al {cutover['weight']}%"))
+        lifecycle_events.emit("fleet.cutover_started", key=cutover_id, **self._public(cutover))
+        return self._public(cutover)
+
+    # ===== Enrutado y resultados =====
+
+    def route(self, pool: str) -> Optional[Dict[str, str]]:
+        """
+        Lado de un runner nuevo del pool en un cambio en curso: el verde según el peso del
+        paso para los pools azules. None si el pool no está en ningún cambio.
+        """
+        with self.lock:
+            for cutover in self.active():
+                for pair in cutover["pools"]:
+                    if pool == pair["green"]:
+                        return {"cutover": cutover["id"], "side": "green", "pool": pair["green"]}
+                    if pool == pair["blue"]:
+                        side = "green" if random.uniform(0, 100) < cutover["weight"] else "blue"
+                        return {"cutover": cutover["id"], "side": side, "pool": pair[side]}
+        return None
+
+    def record(self, cutover_id: str, side: str, runner_id: Optional[str] = None, failed: bool = False):
+        """Resultado del aprovisionamiento; los fallos de registro llegan después por runner."""
+        with self.lock:
+            cutover = self.cutovers.get(cutover_id)
+            if not cutover or cutover["status"] != "running":
+                return
+            for counters in (cutover["runners"][side], cutover["step_runners"][side]):
+                counters["runners"] += 1
+                counters["failed"] += int(failed)
+            if runner_id and not failed:
+                self.runners[runner_id] = (cutover_id, side)
+        metrics.incr("cutovers.runners", tags={"side": side, "result": "failed" if failed else "ok"})
+
+    def record_registration(self, runner_id: str, result: str):
+        """Un runner del cambio que no se registró en GitHub (recreado o fallido) cuenta como fallo."""
+        with self.lock:
+            cutover_id, side = self.runners.pop(runner_id, (None, None))
+            cutover = self.cutovers.get(cutover_id or "")
+            if not cutover or cutover["status"] != "running" or result == "verified":
+                return
+            cutover["runners"][side]["failed"] += 1
+            cutover["step_runners"][side]["failed"] += 1
+        metrics.incr("cutovers.runners", tags={"side": side, "result": "unregistered"})
+
+    # ===== Avance y reversión =====
+
+    def advance(self, manager: Any) -> List[Dict[str, Any]]:
+        """
+        Una pasada sobre los cambios en curso: revierte los que fallan más que los azules,
+        avanza de paso los que cumplieron su tiempo con suficientes runners verdes y
+        retira los azules de los que terminaron el último paso.
+        """
+        changes = []
+        with self.lock:
+            for cutover in self.active():
+                policy = cutover["policy"]
+                green = cutover["step_runners"]["green"]
+                if green["runners"] < policy["min_runners"]:
+                    continue
+                # Referencia: los azules de todo el cambio (en el último paso ya no reciben runners)
+                green_rate, blue_rate = _rate(green), _rate(cutover["runners"]["blue"])
+                if green_rate > blue_rate + policy["max_failure_margin"]:
+                    self._finish(cutover, "rolled_back", f"Fallos verdes {green_rate:.0%} frente a {blue_rate:.0%} azules en el paso {cutover['weight']}%")
+                elif time.time() - cutover["step_started"] >= policy["step_interval"]:
+                    if cutover["step"] + 1 < len(policy["steps"]):
+                        cutover["step"] += 1
+                        cutover["weight"] = policy["steps"][cutover["step"]]
+                        cutover["step_started"] = time.time()
+                        cutover["step_runners"] = _counters()
+                    else:
+                        self._finish(cutover, "completed")
+                else:
+                    continue
+                changes.append(cutover)
+            if changes:
+                self._save_state()
+        for cutover in changes:
+            if cutover["status"] == "completed":
+                self._retire(manager, [pair["blue"] for pair in cutover["pools"]], cutover)
+            elif cutover["status"] == "rolled_back":
+                self._retire(manager, [pair["green"] for pair in cutover["pools"]], cutover)
+            self._announce(cutover)
+        return [self._public(cutover) for cutover in changes]
+
+    def rollback(self, cutover_id: str, manager: Any, reason: str = "", requested_by: str = "") -> Dict[str, Any]:
+        """Revierte un cambio en curso (retira los verdes) o completado (restaura los azules y retira los verdes)."""
+        reason = reason or f"Revertido por {requested_by or 'un administrador'}"
+        with self.lock:
+            cutover = self.cutovers.get(cutover_id)
+            if not cutover:
+                raise ValueError(f"Cambio blue/green no encontrado: {cutover_id}")
+            if cutover["status"] == "rolled_back":
+                raise ValidationError(f"El cambio {cutover_id} ya está revertido")
+            completed = cutover["status"] == "completed"
+            self._finish(cutover, "rolled_back", reason)
+            self._save_state()
+        if completed:
+            self._unretire(manager, [pair["blue"] for pair in cutover["pools"]], requested_by)
+        self._retire(manager, [pair["green"] for pair in cutover["pools"]], cutover, requested_by)
+        self._announce(cutover)
+        return self._public(cutover)
+
+    def _finish(self, cutover: Dict[str, Any], status: str, reason: Optional[str] = None):
+        cutover.update(status=status, finished_at=_now(), reason=reason)
+        self.runners = {runner: entry for runner, entry in self.runners.items() if entry[0] != cutover["id"]}
+
+    @staticmethod
+    def _retire(manager: Any, names: List[str], cutover: Dict[str, Any], retired_by: str = ""):
+        """Retira pools del registro y del archivo; sus runners en marcha terminan sus jobs."""
+        registry = manager.pools
+        with manager.runner_lock:
+            for name in names:
+                pool = registry.pools.get(name)
+                if pool is None:
+                    continue
+                try:
+                    pool_archive.retire(pool, f"Cambio blue/green {cutover['id']}: {cutover['status']}", retired_by or cutover["started_by"])
+                except ValidationError as e:
+                    logger.warning(format_log('WARNING', f'No se pudo retirar el pool {name}', str(e)))
+                    continue
+                registry.retired[name] = registry.pools.pop(name)
+
+    @staticmethod
+    def _unretire(manager: Any, names: List[str], restored_by: str = ""):
+        registry = manager.pools
+        with manager.runner_lock:
+            for name in names:
+                if name not in registry.retired:
+                    continue
+                pool_archive.unretire(name, restored_by, retained=name in registry.retained)
+                registry.pools[name] = registry.retired.pop(name)
+                registry.retained.discard(name)
+
+    def _announce(self, cutover: Dict[str, Any]):
+        detail = ", ".join(f"{pair['blue']} -> {pair['green']}" for pair in cutover["pools"])
+        public = self._public(cutover)
+        if cutover["status"] == "rolled_back":
+            logger.warning(format_log('WARNING', 'Cambio blue/green revertido', f"{detail} ({cutover['reason']})"))
+            lifecycle_events.emit("fleet.cutover_rolled_back", key=cutover["id"], **public)
+        elif cutover["status"] == "completed":
+            logger.info(format_log('SUCCESS', 'Cambio blue/green completado, pools azules retirados', detail))
+            lifecycle_events.emit("fleet.cutover_completed", key=cutover["id"], **public)
+        else:
+            logger.info(format_log('INFO', 'Cambio blue/green avanza', f"{detail} al {cutover['weight']}%"))
+            lifecycle_events.emit("fleet.cutover_advanced", key=cutover["id"], **public)
+        metrics.incr("cutovers.transitions", tags={"status": cutover["status"]})
+
+    @staticmethod
+    def _public(cutover: Dict[str, Any]) -> Dict[str, Any]:
+        public = copy.deepcopy({key: value for key, value in cutover.items() if key != "step_started"})
+        public["failure_rates"] = {side: round(_rate(counters), 4) for side, counters in cutover["runners"].items()}
+        return public
+
+    def get(self, cutover_id: str) -> Dict[str, Any]:
+        with self.lock:
+            cutover = self.cutovers.get(cutover_id)
+            if not cutover:
+                raise ValueError(f"Cambio blue/green no encontrado: {cutover_id}")
+            return self._public(cutover)
+
+    def list(self, status: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            cutovers = [self._public(item) for item in self.cutovers.values() if status is None or item["status"] == status]
+        return list(reversed(cutovers))
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                cutover["id"]: {"weight": cutover["weight"], "pools": [pair["blue"] for pair in cutover["pools"]]}
+                for cutover in self.active()
+            }
+
+
+class CutoverMonitor:
+    """Avanza los cambios blue/green cada check_interval segundos."""
+
+    def __init__(self, lifecycle_manager: Any, cutovers: FleetCutovers, check_interval: int = 30):
+        self.lifecycle_manager = lifecycle_manager
+        self.cutovers = cutovers
+        self.check_interval = check_interval
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Cambios blue/green iniciados', f'cada {self.check_interval}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.check_interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.cutovers.advance(self.lifecycle_manager)
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error avanzando cambios blue/green', str(e)))
+
+
+def create_fleet_cutovers() -> Optional[FleetCutovers]:
+    """Cambios blue/green si FLEET_CUTOVER_STATE_FILE está definido (requiere POOL_ARCHIVE_FILE)."""
+    state_file = os.getenv("FLEET_CUTOVER_STATE_FILE")
+    if not state_file:
+        return None
+    if not pool_archive:
+        raise ConfigurationError("FLEET_CUTOVER_STATE_FILE requiere POOL_ARCHIVE_FILE (pools verdes y retirados)")
+    cutover_policy()
+    directory = os.path.dirname(state_file)
+    if directory:
+        os.makedirs(directory, exist_ok=True)
+    return FleetCutovers(state_file, history=int(os.getenv("FLEET_CUTOVER_HISTORY", "50")))
+
+
+def create_cutover_monitor(lifecycle_manager: Any) -> Optional[CutoverMonitor]:
+    if not fleet_cutovers:
+        return None
+    return CutoverMonitor(lifecycle_manager, fleet_cutovers, int(os.getenv("FLEET_CUTOVER_CHECK_INTERVAL", "30")))
+
+
+fleet_cutovers = create_fleet_cutovers()
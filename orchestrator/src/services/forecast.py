@@ -0,0 +1,211 @@
+"""
+Previsión de capacidad.
+A partir del historial de jobs del registro de uso (USAGE_DB_PATH) estima la demanda
+de cada pool por hora de la semana: runners ocupados de media en esa hora durante las
+últimas FORECAST_WEEKS semanas, y el pico de la peor semana. Los pools con "prewarm"
+se escalan por adelantado hasta la demanda prevista para los próximos
+FORECAST_LEAD_MINUTES (p. ej. antes del pico de las 9), con un máximo por pool.
+"""
+
+import math
+import os
+import threading
+import time
+from datetime import datetime
+from typing import Any, Dict, List, Optional
+from zoneinfo import ZoneInfo, ZoneInfoNotFoundError
+
+from src.services.github_outage import github_outage
+from src.services.metrics import metrics
+from src.services.pools import DEFAULT_POOL
+from src.services.provisioning import provisioner
+from src.services.usage import usage_ledger
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+HOUR = 3600
+WEEK = 7 * 24 * HOUR
+DAYS = ("mon", "tue", "wed", "thu", "fri", "sat", "sun")
+
+
+class DemandForecast:
+    """Demanda esperada por pool y hora de la semana, recalculada cada `refresh` segundos."""
+
+    def __init__(self, ledger: Any, weeks: int = 4, headroom: float = 1.2, timezone: str = "UTC", refresh: int = 3600):
+        if weeks < 1:
+            raise ConfigurationError("FORECAST_WEEKS debe ser al menos 1")
+        try:
+            self.tz = ZoneInfo(timezone)
+        except (ZoneInfoNotFoundError, ValueError):
+            raise ConfigurationError(f"FORECAST_TIMEZONE desconocida: {timezone}")
+        self.ledger = ledger
+        self.weeks = weeks
+        self.headroom = headroom
+        self.timezone = timezone
+        self.refresh = refresh
+        # pool -> {"weeks": semanas con historial, "hours": {hora de la semana: estimación}}
+        self.forecasts: Dict[str, Dict[str, Any]] = {}
+        self.computed_at = 0.0
+        self.lock = threading.Lock()
+
+    def hour_of_week(self, at: float) -> int:
+        local = datetime.fromtimestamp(at, self.tz)
+        return local.weekday() * 24 + local.hour
+
+    def compute(self, now: Optional[float] = None):
+        """Recalcula la previsión con los jobs de las últimas `weeks` semanas."""
+        now = now or time.time()
+        since = now - self.weeks * WEEK
+        history = self.ledger.job_history(since)
+        busy: Dict[str, Dict[int, float]] = {}
+        weekly: Dict[str, Dict[tuple, float]] = {}
+        started: Dict[str, Dict[int, int]] = {}
+        for pool, start, end in history:
+            start = max(start, since)
+            hour = self.hour_of_week(start)
+            started.setdefault(pool, {})[hour] = started.get(pool, {}).get(hour, 0) + 1
+            # El tiempo ocupado del job se reparte entre las horas que abarca
+            at = start
+            while at < end:
+                boundary = min(end, (math.floor(at / HOUR) + 1) * HOUR)
+                hour = self.hour_of_week(at)
+                week = int((at - since) // WEEK)
+                busy.setdefault(pool, {})[hour] = busy.get(pool, {}).get(hour, 0.0) + boundary - at
+                weekly.setdefault(pool, {})[(week, hour)] = weekly.get(pool, {}).get((week, hour), 0.0) + boundary - at
+                at = boundary
+
+        forecasts: Dict[str, Dict[str, Any]] = {}
+        for pool in set(busy) | set(started):
+            first = min(start for entry_pool, start, _ in history if entry_pool == pool)
+            # Un pool con dos semanas de historial no se divide entre FORECAST_WEEKS
+            observed = min(self.weeks, max(1, math.ceil((now - max(first, since)) / WEEK)))
+            hours = {}
+            for hour in set(busy.get(pool, {})) | set(started.get(pool, {})):
+                peak = max((seconds for (_, entry_hour), seconds in weekly.get(pool, {}).items() if entry_hour == hour), default=0.0)
+                hours[hour] = {
+                    "expected": round(busy.get(pool, {}).get(hour, 0.0) / HOUR / observed, 2),
+                    "peak": round(peak / HOUR, 2),
+                    "jobs": round(started.get(pool, {}).get(hour, 0) / observed, 2),
+                }
+            forecasts[pool] = {"weeks": observed, "hours": hours}
+        with self.lock:
+            self.forecasts = forecasts
+            self.computed_at = now
+        logger.info(format_log('MONITOR', 'Previsión de demanda recalculada', f"{len(history)} jobs, {len(forecasts)} pools"))
+
+    def refresh_if_stale(self):
+        if time.time() - self.computed_at >= self.refresh:
+            self.compute()
+
+    def expected(self, pool: str, at: float) -> float:
+        with self.lock:
+            entry = self.forecasts.get(pool, {}).get("hours", {}).get(self.hour_of_week(at))
+        return entry["expected"] if entry else 0.0
+
+    def target(self, pool: str, now: float, lead: int) -> int:
+        """Runners que el pool debería tener: la mayor demanda prevista entre ahora y ahora + lead."""
+        points = [now + offset for offset in range(0, lead, HOUR)] + [now + lead]
+        return math.ceil(max(self.expected(pool, at) for at in points) * self.headroom)
+
+    def describe(self, pool: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            forecasts = dict(self.forecasts)
+        return [
+            {
+                "pool": name,
+                "weeks": forecast["weeks"],
+                "hours": [
+                    {"day": DAYS[hour // 24], "hour": hour % 24, **entry}
+                    for hour, entry in sorted(forecast["hours"].items())
+                ],
+            }
+            for name, forecast in sorted(forecasts.items())
+            if pool is None or name == pool
+        ]
+
+
+class PrewarmScaler:
+    """Escala cada `interval` segundos los pools con "prewarm" hasta la demanda prevista."""
+
+    def __init__(self, lifecycle_manager: Any, forecast: DemandForecast, interval: int = 300, lead: int = 1800):
+        self.lifecycle_manager = lifecycle_manager
+        self.forecast = forecast
+        self.interval = interval
+        self.lead = lead
+        # Última decisión por pool (previsión, runners activos y creados)
+        self.summary: Dict[str, Dict[str, Any]] = {}
+        self.stop_event = threading.Event()
+
+    def start(self):
+        threading.Thread(target=self._loop, daemon=True).start()
+        logger.info(format_log('CONFIG', 'Precalentado por previsión activado', f"cada {self.interval}s, {self.lead // 60} min de antelación"))
+
+    def stop(self):
+        self.stop_event.set()
+
+    def _loop(self):
+        while not self.stop_event.is_set():
+            try:
+                self.forecast.refresh_if_stale()
+                self.scale()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error en el precalentado por previsión', str(e)))
+            self.stop_event.wait(self.interval)
+
+    def _active(self, pool: str) -> int:
+        return sum(
+            1 for container in list(self.lifecycle_manager.active_runners.values())
+            if (getattr(container, "labels", None) or {}).get("runner-pool", DEFAULT_POOL) == pool
+        )
+
+    def scale(self):
+        if github_outage.degraded:
+            # Sin GitHub los runners no podrían registrarse
+            return
+        now = time.time()
+        for pool in list(self.lifecycle_manager.pools.pools.values()):
+            if not pool.prewarm:
+                continue
+            target = min(self.forecast.target(pool.name, now, self.lead), pool.prewarm.get("max", 5))
+            active = self._active(pool.name)
+            metrics.gauge("forecast.target", target, tags={"pool": pool.name})
+            created = 0
+            if active < target:
+                logger.info(format_log(
+                    'INFO', 'Precalentando pool según la previsión',
+                    f"{pool.name}: {active} runners, previstos {target}",
+                ))
+                results = provisioner.run(pool.name, pool.backend, [
+                    {"scope": pool.prewarm["scope"], "scope_name": pool.prewarm["scope_name"], "pool": pool.name}
+                    for _ in range(target - active)
+                ], self.lifecycle_manager.create_runner)
+                for result in results:
+                    if isinstance(result, Exception):
+                        logger.error(format_log('ERROR', f'Error precalentando el pool {pool.name}', str(result)))
+                    else:
+                        created += 1
+                if created:
+                    metrics.incr("forecast.prewarmed", created, tags={"pool": pool.name})
+            self.summary[pool.name] = {"target": target, "active": active, "created": created, "at": now}
+
+    def status(self) -> Dict[str, Dict[str, Any]]:
+        return dict(self.summary)
+
+
+def create_demand_forecast() -> Optional[DemandForecast]:
+    """Previsión si FORECAST_ENABLED=true (requiere USAGE_DB_PATH)."""
+    if os.getenv("FORECAST_ENABLED", "false").lower() != "true":
+        return None
+    if not usage_ledger:
+        raise ConfigurationError("FORECAST_ENABLED requiere USAGE_DB_PATH (la previsión sale del historial de jobs)")
+    return DemandForecast(
+        usage_ledger,
+        weeks=int(os.getenv("FORECAST_WEEKS", "4")),
+        headroom=float(os.getenv("FORECAST_HEADROOM", "1.2")),
+        timezone=os.getenv("FORECAST_TIMEZONE", "UTC"),
+        refresh=int(os.getenv("FORECAST_REFRESH_INTERVAL", "3600")),
+    )
+
+
+demand_forecast = create_demand_forecast()
@@ -0,0 +1,922 @@
+"""
+Backend de Google Compute Engine.
+Cada runner es una instancia creada desde la instance template del pool (spot o
+preemptible opcional) en la primera zona de su lista con capacidad: si una zona
+se queda sin recursos o sin cuota se prueba la siguiente, aunque sea de otra
+región. El startup script registra el runner con --ephemeral y apaga la instancia
+al terminar el job; las instancias llevan el label managed-by, así que las
+detenidas o abandonadas se eliminan aunque el orchestrator se haya reiniciado.
+
+Con "warm" en el pool se mantienen instancias ya arrancadas y suspendidas: el
+runner se crea reanudando una (segundos) en lugar de arrancar una nueva (minutos).
+El refresco de pools precalentados las repone y recicla las que superan warm_max_age.
+
+Con "selection" el machine type se elige por precio entre candidatos (ver
+instance_types.py), probando el siguiente si una zona no tiene capacidad para uno.
+
+Las instancias llevan el network tag gha-egress-<pool>; con egress_cidrs el pool tiene
+reglas de firewall para ese tag que solo dejan salir a esos CIDRs y a GitHub (ver
+network_rules.py).
+"""
+
+import hashlib
+import json
+import os
+import re
+import shlex
+import threading
+import time
+import uuid
+from datetime import datetime, timezone
+from types import SimpleNamespace
+from typing import Any, Dict, List, Optional
+
+import jwt
+import requests
+from src.services.capabilities import CAPABILITY_SCRIPT, capabilities
+from src.services.github_server import github_web_url
+from src.services.instance_types import InstanceCatalog, MachineSpec, create_instance_selector, validate_selection
+from src.services.network_rules import GitHubRanges, PoolEgressRules, github_ranges
+from src.services.retries import http_retry_after, http_transient, retry_budgets
+from src.services.vm_scripts import startup_templates
+from src.services.workspaces import format_size, quota_for, xfs_quota_script
+from src.utils.helpers import ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+COMPUTE_ENDPOINT = "https://compute.googleapis.com/compute/v1"
+METADATA_ENDPOINT = "http://metadata.google.internal/computeMetadata/v1"
+SCOPE = "https://www.googleapis.com/auth/compute"
+BILLING_ENDPOINT = "https://cloudbilling.googleapis.com/v1"
+# Catálogo de Cloud Billing: servicio de Compute Engine
+COMPUTE_BILLING_SERVICE = "6F81-5844-456A"
+MANAGED_BY = "gha-ephemeral-runners"
+
+# Opciones del pool bajo "gce"
+POOL_KEYS = (
+    "template", "zones", "machine_type", "spot", "preemptible", "os", "runner_dir", "runner_user", "warm", "warm_max_age",
+    "startup_template", "harden", "block_metadata", "selection",
+)
+
+# SKUs de CPU y memoria por familia: "N2D AMD Instance Core running in Americas", "Spot Preemptible E2 Instance Ram running in..."
+BILLING_SKU = re.compile(r"^(?:Spot Preemptible |Preemptible )?(?P<family>[A-Z][A-Z0-9]*)(?: AMD| Arm| Intel)?(?: Predefined)? Instance (?P<kind>Core|Ram) running in")
+
+# Errores de capacidad o cuota de una zona: se prueba el siguiente tipo o la siguiente zona
+ZONE_FALLBACK_ERRORS = (
+    "ZONE_RESOURCE_POOL_EXHAUSTED",
+    "ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS",
+    "QUOTA_EXCEEDED",
+    "RESOURCE_NOT_READY",
+    "UNSUPPORTED_OPERATION",
+)
+
+ACTIVE_STATUSES = ("PROVISIONING", "STAGING", "RUNNING")
+
+# Metadata con el token de registro; se retira cuando el runner confirma el registro
+TOKEN_KEY = "gha-runner-token"
+
+# Argumentos de config.sh de una instancia precalentada: se escriben al reclamarla
+ARGS_KEY = "gha-runner-args"
+
+# Cuota del workspace (cuota de proyecto XFS); se escribe junto al token, también al reclamar
+QUOTA_KEY = "gha-workspace-quota"
+
+# Labels del runner cuando se agregan los de capacidades: el startup script los calcula en la VM
+LABELS_KEY = "gha-runner-base-labels"
+
+# Label de las instancias precalentadas aún sin reclamar
+WARM_LABEL = "gha-warm"
+
+
+class GCEError(Exception):
+    """Error de la API de Compute Engine (motivo del primer error y mensaje)."""
+
+    def __init__(self, code: str, message: str, status: int = 0):
+        super().__init__(f"{code}: {message}")
+        self.code = code
+        self.status = status
+
+
+class GCECredentials:
+    """
+    Token OAuth con renovación automática.
+
+    Con GOOGLE_APPLICATION_CREDENTIALS firma un JWT con la clave de la cuenta de
+    servicio; si no, pide el token de la cuenta de servicio de la instancia al
+    servidor de metadata.
+    """
+
+    def __init__(self, key_file: Optional[str] = None):
+        self.key: Optional[Dict[str, Any]] = None
+        if key_file:
+            with open(key_file) as f:
+                self.key = json.load(f)
+        self.token: Optional[str] = None
+        self.expires_at = 0.0
+        self.lock = threading.Lock()
+
+    @property
+    def method(self) -> str:
+        return f"cuenta de servicio {self.key['client_email']}" if self.key else "metadata de la instancia"
+
+    def get(self) -> str:
+        with self.lock:
+            if not self.token or self.expires_at - time.time() < 300:
+                self._refresh()
+            return self.token
+
+    def _refresh(self):
+        try:
+            if self.key:
+                now = int(time.time())
+                assertion = jwt.encode({
+                    "iss": self.key["client_email"],
+                    # El catálogo de precios (selection) pide además el scope de facturación
+                    "scope": f"{SCOPE} https://www.googleapis.com/auth/cloud-billing.readonly",
+                    "aud": self.key.get("token_uri", "https://oauth2.googleapis.com/token"),
+                    "iat": now,
+                    "exp": now + 3600,
+                }, self.key["private_key"], algorithm="RS256")
+                response = requests.post(self.key.get("token_uri", "https://oauth2.googleapis.com/token"), timeout=10, data={
+                    "grant_type": "urn:ietf:params:oauth:grant-type:jwt-bearer",
+                    "assertion": assertion,
+                })
+            else:
+                response = requests.get(
+                    f"{METADATA_ENDPOINT}/instance/service-accounts/default/token",
+                    params={"scopes": SCOPE}, headers={"Metadata-Flavor": "Google"}, timeout=5,
+                )
+            response.raise_for_status()
+        except requests.RequestException as e:
+            raise GCEError("AUTH", f"No se pudo obtener token de Google ({self.method}): {e}")
+        data = response.json()
+        self.token = data["access_token"]
+        self.expires_at = time.time() + int(data.get("expires_in", 3600))
+
+
+class GCEClient:
+    """Llamadas a la API de Compute Engine de un proyecto con espera de operaciones."""
+
+    def __init__(self, project: str, credentials: GCECredentials):
+        self.project = project
+        self.credentials = credentials
+        self.base = f"{COMPUTE_ENDPOINT}/projects/{project}"
+
+    def request(self, method: str, path: str, body: Optional[Dict[str, Any]] = None, params: Optional[Dict[str, Any]] = None) -> Dict[str, Any]:
+        # Rutas relativas al proyecto o completas (projects/...) para recursos de otro proyecto
+        url = f"{COMPUTE_ENDPOINT}/{path}" if path.startswith("projects/") else f"{self.base}{path}"
+        response = retry_budgets.get("gce").call(
+            lambda: requests.request(
+                method, url, params=params, json=body, timeout=60,
+                headers={"Authorization": f"Bearer {self.credentials.get()}"},
+            ),
+            retry_error=lambda e: isinstance(e, requests.RequestException),
+            retry_result=http_transient,
+            retry_after=http_retry_after,
+        )
+        if response.status_code >= 400:
+            try:
+                error = response.json().get("error", {})
+            except ValueError:
+                error = {}
+            reason = (error.get("errors") or [{}])[0].get("reason") or error.get("status") or f"HTTP{response.status_code}"
+            raise GCEError(reason, error.get("message", response.text[:200]), response.status_code)
+        return response.json() if response.content else {}
+
+    def wait(self, operation: Dict[str, Any], timeout: int) -> Dict[str, Any]:
+        """Espera una operación de zona o global; los errores de la operación se elevan como GCEError."""
+        zone = operation.get("zone", "").rsplit("/", 1)[-1]
+        path = f"/zones/{zone}/operations/{operation.get('name')}" if zone else f"/global/operations/{operation.get('name')}"
+        deadline = time.time() + timeout
+        while operation.get("status") != "DONE":
+            if time.time() > deadline:
+                raise GCEError("TIMEOUT", f"Operación {operation.get('name')} sin terminar tras {timeout}s")
+            operation = self.request("POST", f"{path}/wait")
+        errors = operation.get("error", {}).get("errors", [])
+        if errors:
+            raise GCEError(errors[0].get("code", "OPERATION_FAILED"), errors[0].get("message", ""))
+        return operation
+
+
+class GCEPoolSpec:
+    """Opciones "gce" de un pool."""
+
+    def __init__(self, spec: Dict[str, Any]):
+        self.template: str = spec.get("template", "")
+        self.zones: List[str] = list(spec.get("zones") or [])
+        self.machine_type: Optional[str] = spec.get("machine_type")
+        self.spot: bool = bool(spec.get("spot", False))
+        self.preemptible: bool = bool(spec.get("preemptible", False))
+        self.os: str = spec.get("os", "linux")
+        windows = self.os == "windows"
+        self.runner_dir: str = spec.get("runner_dir", "C:\\actions-runner" if windows else "/opt/actions-runner")
+        self.runner_user: str = spec.get("runner_user", "runner")
+        self.warm: int = int(spec.get("warm", 0))
+        self.warm_max_age: int = int(spec.get("warm_max_age", 86400))
+        # Startup script: plantilla propia (vm_scripts) y endurecimiento del host
+        self.startup_template: Optional[str] = spec.get("startup_template")
+        self.harden: bool = bool(spec.get("harden", True))
+        self.block_metadata: bool = bool(spec.get("block_metadata", False))
+        # Candidatos de machine type por precio (ver instance_types.py); excluye machine_type
+        self.selection: Optional[Dict[str, Any]] = spec.get("selection")
+
+
+class GCECatalog(InstanceCatalog):
+    """Machine types de cada zona y precios del catálogo de Cloud Billing (CPU y memoria de la familia)."""
+
+    def __init__(self, client: GCEClient, api_key: Optional[str] = None):
+        self.client = client
+        self.api_key = api_key
+
+    def price_location(self, location: str) -> str:
+        return location.rsplit("-", 1)[0]
+
+    def specs(self, location: str, names: List[str]) -> Dict[str, MachineSpec]:
+        found = {}
+        for name in names:
+            try:
+                data = self.client.request("GET", f"/zones/{location}/machineTypes/{name}")
+            except GCEError as e:
+                if e.status != 404:
+                    raise
+                continue
+            # Los tipos sin architecture son x86 (las familias Arm la publican)
+            arch = "arm64" if data.get("architecture") == "ARM64" else "x86_64"
+            found[name] = MachineSpec(int(data["guestCpus"]), data["memoryMb"] / 1024, arch)
+        return found
+
+    def prices(self, location: str, specs: Dict[str, MachineSpec], spot: bool, os_name: str) -> Dict[str, float]:
+        """Precio Linux por hora: CPUs por el precio del core más GiB por el de la memoria de la familia."""
+        region = self.price_location(location)
+        usage = "Preemptible" if spot else "OnDemand"
+        families = {name.split("-")[0].upper() for name in specs}
+        rates: Dict[tuple, float] = {}
+        page_token = None
+        while True:
+            params = {"pageSize": 5000, **({"pageToken": page_token} if page_token else {})}
+            if self.api_key:
+                params["key"] = self.api_key
+                headers = {}
+            else:
+                headers = {"Authorization": f"Bearer {self.client.credentials.get()}"}
+            response = requests.get(f"{BILLING_ENDPOINT}/services/{COMPUTE_BILLING_SERVICE}/skus", params=params, headers=headers, timeout=30)
+            response.raise_for_status()
+            data = response.json()
+            for sku in data.get("skus", []):
+                match = BILLING_SKU.match(sku.get("description", ""))
+                if not match or match["family"] not in families or sku.get("category", {}).get("usageType") != usage:
+                    continue
+                if region not in sku.get("serviceRegions", []):
+                    continue
+                unit = sku["pricingInfo"][0]["pricingExpression"]["tieredRates"][-1]["unitPrice"]
+                rates[(match["family"], match["kind"])] = int(unit.get("units") or 0) + unit.get("nanos", 0) / 1e9
+            page_token = data.get("nextPageToken")
+            if not page_token:
+                break
+        prices = {}
+        for name, spec in specs.items():
+            family = name.split("-")[0].upper()
+            # Los de núcleo compartido (e2-micro...) tienen SKUs propios: se quedan sin precio
+            if (family, "Core") in rates and (family, "Ram") in rates and not name.endswith(("-micro", "-small", "-medium")):
+                prices[name] = spec.cpu * rates[(family, "Core")] + spec.memory_gb * rates[(family, "Ram")]
+        return prices
+
+
+def _label(value: str) -> str:
+    """Valor válido de label de GCE: minúsculas, dígitos, - y _, 63 caracteres."""
+    return re.sub(r"[^a-z0-9_-]", "-", str(value).lower())[:63]
+
+
+def instance_name(runner_name: str) -> str:
+    name = re.sub(r"[^a-z0-9-]", "-", runner_name.lower()).strip("-")
+    name = f"gha-{name}"
+    if name != f"gha-{runner_name}" or len(name) > 63:
+        # Nombre alterado: sufijo para que dos runners no acaben con la misma instancia
+        name = f"{name[:54].rstrip('-')}-{hashlib.sha256(runner_name.encode()).hexdigest()[:8]}"
+    return name
+
+
+def egress_tag(pool_name: str) -> str:
+    """Network tag de las instancias del pool (minúsculas, dígitos y -), con sitio para el sufijo de las reglas."""
+    tag = re.sub(r"[^a-z0-9-]", "-", f"gha-egress-{pool_name}".lower()).strip("-")
+    if tag != f"gha-egress-{pool_name}" or len(tag) > 56:
+        tag = f"{tag[:47].rstrip('-')}-{hashlib.sha256(pool_name.encode()).hexdigest()[:8]}"
+    return tag
+
+
+class GCEEgressRules(PoolEgressRules):
+    """
+    Reglas de firewall de salida para el network tag del pool, en la red de su instance
+    template: las de permitir (prioridad 900) se crean antes que las de denegar (1000).
+    """
+
+    def __init__(self, backend: "GCEBackend", github: GitHubRanges):
+        super().__init__("gce", github)
+        self.gce_backend = backend
+
+    def _apply(self, pool: Any, ipv4: List[str], ipv6: List[str]) -> str:
+        spec = GCEPoolSpec(pool.gce)
+        interfaces = self.gce_backend._template(spec.template).get("properties", {}).get("networkInterfaces") or [{}]
+        network = interfaces[0].get("network", "global/networks/default")
+        tag = egress_tag(pool.name)
+        # IPv4 e IPv6 no se mezclan en una regla
+        rules = {"allow4": (900, "allowed", ipv4), "allow6": (900, "allowed", ipv6), "deny4": (1000, "denied", ["0.0.0.0/0"]), "deny6": (1000, "denied", ["::/0"])}
+        for suffix, (priority, action, ranges) in rules.items():
+            name = f"{tag}-{suffix}"
+            if not ranges:
+                self._remove(name)
+                continue
+            body = {
+                "name": name,
+                "description": f"Salida de los runners del pool {pool.name} ({MANAGED_BY})",
+                "network": network,
+                "direction": "EGRESS",
+                "priority": priority,
+                "targetTags": [tag],
+                "destinationRanges": ranges,
+                action: [{"IPProtocol": "all"}],
+            }
+            try:
+                self.gce_backend.client.request("GET", f"/global/firewalls/{name}")
+                operation = self.gce_backend.client.request("PUT", f"/global/firewalls/{name}", body)
+            except GCEError as e:
+                if e.status != 404:
+                    raise
+                operation = self.gce_backend.client.request("POST", "/global/firewalls", body)
+            self.gce_backend.client.wait(operation, 120)
+        return tag
+
+    def _remove(self, name: str) -> bool:
+        try:
+            operation = self.gce_backend.client.request("DELETE", f"/global/firewalls/{name}")
+        except GCEError as e:
+            if e.status != 404:
+                raise
+            return False
+        self.gce_backend.client.wait(operation, 120)
+        return True
+
+    def _delete(self, pool_name: str) -> bool:
+        # Primero las de permitir: nunca queda una de permitir sin su denegación
+        removed = [self._remove(f"{egress_tag(pool_name)}-{suffix}") for suffix in ("allow4", "allow6", "deny4", "deny6")]
+        return any(removed)
+
+    def _in_use(self, pool_name: str) -> bool:
+        # Incluye las precalentadas y las que se están eliminando
+        return bool(self.gce_backend._aggregated(f"labels.runner-pool={_label(pool_name)}"))
+
+
+def _powershell_quote(value: str) -> str:
+    return "'" + value.replace("'", "''") + "'"
+
+
+def startup_script(spec: GCEPoolSpec, pool_name: str, config_args: Optional[List[str]]) -> Dict[str, str]:
+    """
+    Startup script (plantilla del pool, ver vm_scripts) que registra el runner con el token
+    de la metadata, avisa por guest attribute, espera a que se retire el token, ejecuta el
+    job y apaga la instancia.
+
+    Sin config_args es el de una instancia precalentada: avisa con gha/warm y espera
+    (suspendida) a que el orchestrator escriba los argumentos y el token al reclamarla.
+    En Linux, si la metadata trae QUOTA_KEY, el workspace queda limitado por una cuota de
+    proyecto XFS y se borra al terminar el job, y si trae LABELS_KEY el runner se registra
+    con esos labels más los de capacidades (publicados en gha/capabilities).
+    """
+    if spec.os == "windows":
+        if config_args is None:
+            wait_args = [
+                "Invoke-RestMethod -Method Put -Headers $h -Body 1 \"$md/guest-attributes/gha/warm\"",
+                f"while ($true) {{ try {{ $cfg = (Invoke-WebRequest -UseBasicParsing -Headers $h \"$md/attributes/{ARGS_KEY}\").Content | ConvertFrom-Json; break }} catch {{ Start-Sleep 2 }} }}",
+            ]
+        else:
+            wait_args = [f"$cfg = @({', '.join(_powershell_quote(arg) for arg in config_args)})"]
+        return {"key": "windows-startup-script-ps1", "value": startup_templates.render(pool_name, "gce", spec, prelude=[
+            "$md = 'http://metadata.google.internal/computeMetadata/v1/instance'",
+            "$h = @{'Metadata-Flavor' = 'Google'}",
+        ], configure=[
+            f"Set-Location {_powershell_quote(spec.runner_dir)}",
+            *wait_args,
+            f"$token = Invoke-RestMethod -Headers $h \"$md/attributes/{TOKEN_KEY}\"",
+            "& .\\config.cmd @cfg --token $token *> config.log",
+            "if ($LASTEXITCODE -ne 0) {",
+            "  Invoke-RestMethod -Method Put -Headers $h -Body ((Get-Content config.log -Tail 20) -join \"`n\") \"$md/guest-attributes/gha/error\"",
+            "  Stop-Computer -Force; exit 1",
+            "}",
+            "Invoke-RestMethod -Method Put -Headers $h -Body 1 \"$md/guest-attributes/gha/configured\"",
+            f"for ($i = 0; $i -lt 60; $i++) {{ try {{ Invoke-RestMethod -Headers $h \"$md/attributes/{TOKEN_KEY}\" | Out-Null; Start-Sleep 2 }} catch {{ break }} }}",
+        ], run=[
+            "& .\\run.cmd",
+            "Stop-Computer -Force",
+        ])}
+
+    user = shlex.quote(spec.runner_user)
+    workspace = f"{spec.runner_dir}/_work"
+    if config_args is None:
+        # El bucle sigue tras reanudar la instancia: el job arranca en cuanto aparecen los argumentos
+        wait_args = ["attr warm 1", f"until args=$(get attributes/{ARGS_KEY}); do sleep 2; done"]
+    else:
+        wait_args = [f"args={shlex.quote(config_shell_args(config_args))}"]
+    return {"key": "startup-script", "value": startup_templates.render(pool_name, "gce", spec, prelude=[
+        "md=http://metadata.google.internal/computeMetadata/v1/instance",
+        "get() { curl -sf -H 'Metadata-Flavor: Google' \"$md/$1\"; }",
+        "attr() { curl -sf -X PUT -H 'Metadata-Flavor: Google' --data-binary \"$2\" \"$md/guest-attributes/gha/$1\"; }",
+    ], configure=[
+        f"cd {shlex.quote(spec.runner_dir)} || exit 1",
+        *wait_args,
+        f"token=$(get attributes/{TOKEN_KEY}) || exit 1",
+        f"if quota=$(get attributes/{QUOTA_KEY}); then",
+        *("  " + line for line in xfs_quota_script(workspace, "$quota", on_failure="attr error \"cuota XFS no aplicable\"; shutdown -h now; ")),
+        f"  chown {user} {shlex.quote(workspace)}",
+        "fi",
+        f"if labels=$(get attributes/{LABELS_KEY}); then",
+        *("  " + line for line in CAPABILITY_SCRIPT),
+        '  labels="${labels:+$labels,}$caps"',
+        '  attr capabilities "$caps"',
+        "  args=\"$args --labels '$labels'\"",
+        "fi",
+        f"if ! su -s /bin/sh {user} -c \"./config.sh $args --token $token\" > config.log 2>&1; then",
+        "  attr error \"$(tail -c 500 config.log)\"; shutdown -h now; exit 1",
+        "fi",
+        "attr configured 1",
+        f"for i in $(seq 60); do get attributes/{TOKEN_KEY} > /dev/null || break; sleep 2; done",
+    ], run=[
+        # La salida del runner llega al puerto serie y a Cloud Logging a través del agente
+        f"su -s /bin/sh {user} -c ./run.sh",
+        f"rm -rf {shlex.quote(workspace)}",
+        "shutdown -h now",
+    ])}
+
+
+def config_shell_args(config_args: List[str]) -> str:
+    """Argumentos de config.sh ya escapados para el sh -c del startup script."""
+    return " ".join(shlex.quote(arg) for arg in config_args)
+
+
+class GCEInstance:
+    """Instancia de Compute Engine con la interfaz de contenedor que usa el ciclo de vida."""
+
+    def __init__(self, backend: "GCEBackend", instance: Dict[str, Any]):
+        self.backend = backend
+        self.zone = instance["zone"].rsplit("/", 1)[-1]
+        self.id = instance["name"]
+        metadata = {item["key"]: item.get("value") for item in instance.get("metadata", {}).get("items", [])}
+        self.labels: Dict[str, str] = json.loads(metadata.get("gha-runner-labels") or "{}")
+        self.name = f"gha-runner-{self.labels.get('runner-name', self.id)}"
+        self.image = SimpleNamespace(tags=[instance.get("labels", {}).get("gha-template", "")])
+        self.ports: Dict[str, Any] = {}
+        self.attrs: Dict[str, Any] = {}
+        self.status = "running"
+        self.update(instance)
+
+    def update(self, instance: Dict[str, Any]):
+        status = instance.get("status", "PROVISIONING")
+        self.status = "running" if status in ACTIVE_STATUSES else "exited"
+        self.attrs = {
+            "Created": instance.get("creationTimestamp", ""),
+            "Config": {"Image": self.image.tags[0]},
+            "State": {"Status": status, "Zone": self.zone, "Scheduling": instance.get("scheduling", {}).get("provisioningModel")},
+        }
+
+    def reload(self):
+        self.backend.refresh(self)
+
+    def stop(self, timeout: int = 30):
+        self.backend.delete(self)
+
+    def remove(self, force: bool = False):
+        pass
+
+    def logs(self, tail: int = 50) -> bytes:
+        return self.backend.instance_logs(self, tail).encode("utf-8")
+
+
+class GCEBackend:
+    """Lanza runners en instancias de Compute Engine de GCE_PROJECT."""
+
+    def __init__(self, client: GCEClient, provision_timeout: int = 600, max_instance_age: int = 86400, pricing_api_key: Optional[str] = None):
+        self.client = client
+        self.provision_timeout = provision_timeout
+        self.max_instance_age = max_instance_age
+        self.instances: Dict[str, GCEInstance] = {}
+        self.templates: Dict[str, Dict[str, Any]] = {}
+        self.zone_failures: Dict[str, str] = {}
+        # Instancias precalentadas que se están reclamando (el refresco no las toca)
+        self.claiming: set = set()
+        self.warm_status: Dict[str, Dict[str, int]] = {}
+        self.warm_claims = 0
+        self.warm_misses = 0
+        self.egress = GCEEgressRules(self, github_ranges)
+        self.selector = create_instance_selector("gce", GCECatalog(client, pricing_api_key))
+        self.lock = threading.Lock()
+
+    def _template(self, name: str) -> Dict[str, Any]:
+        """Propiedades de la instance template (en caché: la metadata y labels se combinan con las del runner)."""
+        if name not in self.templates:
+            path = name if name.startswith("projects/") else f"/global/instanceTemplates/{name}"
+            self.templates[name] = self.client.request("GET", path)
+        return self.templates[name]
+
+    def create_runner(
+        self,
+        registration_token: str,
+        scope_name: str,
+        runner_name: str,
+        runner_group: Optional[str],
+        labels: List[str],
+        container_labels: Dict[str, str],
+        pool: Any,
+    ) -> GCEInstance:
+        spec = GCEPoolSpec(pool.gce)
+        container_labels = {**container_labels, "runner-backend": "gce"}
+
+        config_args = [
+            "--unattended", "--ephemeral", "--replace", "--disableupdate",
+            "--url", f"{github_web_url()}/{scope_name}",
+            "--name", runner_name,
+            "--work", "_work",
+        ]
+        # Labels de capacidades: los calcula el startup script en la VM (solo Linux)
+        introspect = capabilities.applies(pool) and spec.os != "windows"
+        if labels and not introspect:
+            config_args += ["--labels", ",".join(labels)]
+        if runner_group:
+            config_args += ["--runnergroup", runner_group]
+
+        runner_metadata = [
+            {"key": TOKEN_KEY, "value": registration_token},
+            {"key": "gha-runner-labels", "value": json.dumps(container_labels)},
+        ]
+        if introspect:
+            runner_metadata.append({"key": LABELS_KEY, "value": ",".join(labels)})
+        quota = quota_for(pool)
+        if quota:
+            runner_metadata.append({"key": QUOTA_KEY, "value": format_size(quota.size)})
+        instance = None
+        # Las reglas existen antes de que el job arranque, también en una instancia precalentada
+        with self.egress.creation(pool):
+            if spec.warm:
+                args = json.dumps(config_args) if spec.os == "windows" else config_shell_args(config_args)
+                instance = self._claim_warm(spec, pool.name, runner_name, runner_metadata + [{"key": ARGS_KEY, "value": args}])
+            if not instance:
+                body = self._body(spec, pool.name, instance_name(runner_name), [
+                    startup_script(spec, pool.name, config_args),
+                    *runner_metadata,
+                    {"key": "enable-guest-attributes", "value": "TRUE"},
+                ], {"runner-name": _label(runner_name)})
+                instance = self._insert(body, spec, pool.name)
+        try:
+            attributes = self._wait_configured(instance)
+            self._remove_token(instance)
+        except GCEError:
+            self.delete(instance)
+            raise
+
+        with self.lock:
+            self.instances[runner_name] = instance
+        if attributes.get("capabilities"):
+            capabilities.record(pool.name, attributes["capabilities"].split(","))
+        logger.info(f"✅ Runner {runner_name} en ejecución en {instance.zone}/{instance.id}")
+        return instance
+
+    def _body(self, spec: GCEPoolSpec, pool_name: str, name: str, metadata: List[Dict[str, str]], labels: Dict[str, str]) -> Dict[str, Any]:
+        """Cuerpo de la instancia: metadata y labels de la template combinadas con las propias."""
+        properties = self._template(spec.template).get("properties", {})
+        own_keys = {item["key"] for item in metadata}
+        items = [item for item in properties.get("metadata", {}).get("items", []) if item["key"] not in own_keys]
+        body: Dict[str, Any] = {
+            "name": name,
+            "labels": {
+                **properties.get("labels", {}),
+                "managed-by": MANAGED_BY,
+                "runner-pool": _label(pool_name),
+                "gha-template": _label(spec.template.rsplit("/", 1)[-1]),
+                **labels,
+            },
+            "metadata": {"items": items + metadata},
+            # Tag de las reglas de salida del pool (sin egress_cidrs no hay reglas para él)
+            "tags": {"items": sorted(set(properties.get("tags", {}).get("items", [])) | {egress_tag(pool_name)})},
+        }
+        if spec.spot:
+            body["scheduling"] = {**properties.get("scheduling", {}), "provisioningModel": "SPOT", "instanceTerminationAction": "DELETE"}
+        elif spec.preemptible:
+            body["scheduling"] = {**properties.get("scheduling", {}), "preemptible": True, "automaticRestart": False, "onHostMaintenance": "TERMINATE"}
+        return body
+
+    def _claim_warm(self, spec: GCEPoolSpec, pool_name: str, runner_name: str, metadata: List[Dict[str, str]]) -> Optional[GCEInstance]:
+        """
+        Reanuda una instancia suspendida del pool con los datos del runner.
+
+        Retorna None si no hay ninguna lista o si falla al reclamarla; en ese caso el
+        runner se crea en una instancia nueva.
+        """
+        pool_label = _label(pool_name)
+        candidates = sorted(
+            (data for data in self._aggregated(f"labels.{WARM_LABEL}=true")
+             if data.get("labels", {}).get("runner-pool") == pool_label and data.get("status") == "SUSPENDED"),
+            key=lambda data: data["creationTimestamp"],
+        )
+        with self.lock:
+            data = next((data for data in candidates if data["name"] not in self.claiming), None)
+            if not data:
+                self.warm_misses += 1
+                logger.info(f"🧊 Sin instancias precalentadas en el pool {pool_name}, creando una nueva")
+                return None
+            self.claiming.add(data["name"])
+
+        instance = GCEInstance(self, data)
+        path = f"/zones/{instance.zone}/instances/{instance.id}"
+        try:
+            logger.info(f"⚡ Reanudando instancia precalentada {instance.zone}/{instance.id} para {runner_name}")
+            own_keys = {item["key"] for item in metadata}
+            current = data.get("metadata", {})
+            self.client.wait(self.client.request("POST", f"{path}/setMetadata", {
+                "fingerprint": current.get("fingerprint"),
+                "items": [item for item in current.get("items", []) if item["key"] not in own_keys] + metadata,
+            }), 120)
+            self.client.wait(self.client.request("POST", f"{path}/resume"), self.provision_timeout)
+            # Sin el label de precalentada deja de contar para el refresco y pasa a ser un runner más
+            current = self.client.request("GET", path)
+            runner_labels = {key: value for key, value in current.get("labels", {}).items() if key != WARM_LABEL}
+            self.client.wait(self.client.request("POST", f"{path}/setLabels", {
+                "labelFingerprint": current.get("labelFingerprint"),
+                "labels": {**runner_labels, "runner-name": _label(runner_name)},
+            }), 120)
+            instance = GCEInstance(self, self.client.request("GET", path))
+            with self.lock:
+                self.warm_claims += 1
+            return instance
+        except GCEError as e:
+            logger.warning(f"⚠️ No se pudo reclamar {instance.zone}/{instance.id} ({e}), creando una instancia nueva")
+            try:
+                self.delete(instance)
+            except GCEError:
+                pass
+            return None
+        finally:
+            with self.lock:
+                self.claiming.discard(data["name"])
+
+    def refresh_warm(self, pools: Dict[str, Dict[str, Any]]) -> Dict[str, Dict[str, int]]:
+        """
+        Mantiene las instancias precalentadas de los pools con "warm".
+
+        Suspende las que terminaron de arrancar, crea las que faltan y elimina las que
+        superan warm_max_age (así las nuevas toman la template o imagen actual), las
+        detenidas y las de pools que ya no tienen "warm".
+        """
+        by_pool: Dict[str, List[Dict[str, Any]]] = {}
+        for data in self._aggregated(f"labels.{WARM_LABEL}=true"):
+            by_pool.setdefault(data.get("labels", {}).get("runner-pool", ""), []).append(data)
+        with self.lock:
+            claiming = set(self.claiming)
+        now = datetime.now(timezone.utc)
+        specs = {_label(name): (name, GCEPoolSpec(spec)) for name, spec in pools.items()}
+
+        summary = {}
+        for pool_label, instances in by_pool.items():
+            if pool_label not in specs:
+                for data in instances:
+                    if data["name"] not in claiming:
+                        self.delete(GCEInstance(self, data))
+        for pool_label, (pool_name, spec) in specs.items():
+            ready = booting = 0
+            for data in by_pool.get(pool_label, []):
+                if data["name"] in claiming:
+                    continue
+                instance = GCEInstance(self, data)
+                age = (now - datetime.fromisoformat(data["creationTimestamp"])).total_seconds()
+                status = data.get("status")
+                if age > spec.warm_max_age or status not in ACTIVE_STATUSES + ("SUSPENDING", "SUSPENDED"):
+                    logger.info(f"♻️ Reciclando instancia precalentada {instance.zone}/{instance.id} ({status}, {int(age)}s)")
+                    self.delete(instance)
+                elif status in ("SUSPENDING", "SUSPENDED"):
+                    ready += 1
+                elif status == "RUNNING" and "warm" in self._guest_attributes(instance):
+                    logger.info(f"💤 Suspendiendo instancia precalentada {instance.zone}/{instance.id}")
+                    self.client.request("POST", f"/zones/{instance.zone}/instances/{instance.id}/suspend")
+                    ready += 1
+                elif age > self.provision_timeout:
+                    logger.warning(f"⚠️ La instancia precalentada {instance.zone}/{instance.id} no arrancó en {self.provision_timeout}s")
+                    self.delete(instance)
+                else:
+                    booting += 1
+            for _ in range(spec.warm - ready - booting):
+                body = self._body(spec, pool_name, instance_name(f"warm-{pool_name}-{uuid.uuid4().hex[:8]}"), [
+                    startup_script(spec, pool_name, None),
+                    {"key": "enable-guest-attributes", "value": "TRUE"},
+                ], {WARM_LABEL: "true"})
+                try:
+                    self._insert(body, spec, pool_name)
+                    booting += 1
+                except GCEError as e:
+                    logger.warning(f"⚠️ No se pudo crear instancia precalentada para {pool_name}: {e}")
+                    break
+            summary[pool_name] = {"ready": ready, "booting": booting, "target": spec.warm}
+        with self.lock:
+            self.warm_status = summary
+        return summary
+
+    def _insert(self, body: Dict[str, Any], spec: GCEPoolSpec, pool_name: str) -> GCEInstance:
+        """Crea la instancia en la primera zona del pool con capacidad."""
+        template = spec.template if spec.template.startswith("projects/") else f"global/instanceTemplates/{spec.template}"
+        errors = []
+        for zone in spec.zones:
+            # Con selection, los candidatos de la zona del más barato al más caro
+            machine_types = self.selector.rank(spec.selection, zone, spot=spec.spot or spec.preemptible, os_name=spec.os) if spec.selection else [spec.machine_type]
+            if not machine_types:
+                errors.append(f"{zone}: ningún candidato de selection cumple los requisitos")
+                continue
+            for machine_type in machine_types:
+                zone_body = dict(body)
+                if machine_type:
+                    zone_body["machineType"] = f"zones/{zone}/machineTypes/{machine_type}"
+                try:
+                    logger.info(f"☁️ Creando instancia {body['name']}{' ' + machine_type if machine_type else ''} en {zone} (pool {pool_name})")
+                    operation = self.client.request("POST", f"/zones/{zone}/instances", zone_body, params={"sourceInstanceTemplate": template})
+                    self.client.wait(operation, self.provision_timeout)
+                    self.zone_failures.pop(zone, None)
+                    if spec.selection:
+                        self.selector.record(pool_name, zone, machine_type)
+                    return GCEInstance(self, self.client.request("GET", f"/zones/{zone}/instances/{body['name']}"))
+                except GCEError as e:
+                    if e.code not in ZONE_FALLBACK_ERRORS:
+                        raise
+                    self.zone_failures[zone] = e.code
+                    errors.append(f"{zone}{'/' + machine_type if machine_type else ''}: {e.code}")
+                    logger.warning(f"⚠️ Sin capacidad en {zone}{' para ' + machine_type if machine_type else ''} ({e.code}), probando la siguiente opción")
+        raise GCEError("NO_CAPACITY", f"Pool {pool_name}: ninguna zona con capacidad ({'; '.join(errors)})")
+
+    def _guest_attributes(self, instance: GCEInstance) -> Dict[str, str]:
+        """Guest attributes gha/* que escribe el startup script."""
+        path = f"/zones/{instance.zone}/instances/{instance.id}/getGuestAttributes"
+        try:
+            items = self.client.request("GET", path, params={"queryPath": "gha/"}).get("queryValue", {}).get("items", [])
+        except GCEError as e:
+            # 404 mientras el script aún no escribió ningún atributo
+            if e.status != 404:
+                raise
+            items = []
+        return {item["key"]: item.get("value", "") for item in items}
+
+    def _wait_configured(self, instance: GCEInstance) -> Dict[str, str]:
+        """Espera el guest attribute gha/configured (o gha/error) que escribe el startup script."""
+        deadline = time.time() + self.provision_timeout
+        while time.time() < deadline:
+            attributes = self._guest_attributes(instance)
+            if "error" in attributes:
+                raise GCEError("RUNNER_CONFIG", f"Falló la configuración del runner: {redactor.redact(attributes['error'])}")
+            if "configured" in attributes:
+                return attributes
+            self.refresh(instance)
+            if instance.status != "running":
+                raise GCEError("INSTANCE_STOPPED", f"La instancia {instance.id} se detuvo antes de registrar el runner")
+            time.sleep(5)
+        raise GCEError("TIMEOUT", f"El runner de {instance.id} no se registró en {self.provision_timeout}s")
+
+    def _remove_token(self, instance: GCEInstance):
+        """Retira el token de registro de la metadata para que el job no pueda leerlo."""
+        current = self.client.request("GET", f"/zones/{instance.zone}/instances/{instance.id}")
+        metadata = current.get("metadata", {})
+        operation = self.client.request("POST", f"/zones/{instance.zone}/instances/{instance.id}/setMetadata", {
+            "fingerprint": metadata.get("fingerprint"),
+            "items": [item for item in metadata.get("items", []) if item["key"] != TOKEN_KEY],
+        })
+        self.client.wait(operation, 120)
+
+    def refresh(self, instance: GCEInstance):
+        try:
+            instance.update(self.client.request("GET", f"/zones/{instance.zone}/instances/{instance.id}"))
+        except GCEError as e:
+            if e.status == 404:
+                # Eliminada (spot con instanceTerminationAction DELETE o limpieza)
+                instance.status = "exited"
+                instance.attrs["State"]["Status"] = "DELETED"
+            else:
+                logger.warning(f"⚠️ No se pudo consultar la instancia {instance.id}: {e}")
+
+    def delete(self, instance: GCEInstance):
+        logger.info(f"🗑️ Eliminando instancia {instance.zone}/{instance.id}")
+        try:
+            self.client.request("DELETE", f"/zones/{instance.zone}/instances/{instance.id}")
+        except GCEError as e:
+            if e.status != 404:
+                raise
+        with self.lock:
+            self.instances.pop(instance.labels.get("runner-name", ""), None)
+        instance.status = "exited"
+        self.egress.release(instance.labels.get("runner-pool"))
+
+    def force_delete(self, instance: GCEInstance):
+        """Detiene y elimina de nuevo una instancia atascada deteniéndose o suspendiéndose."""
+        try:
+            self.client.request("POST", f"/zones/{instance.zone}/instances/{instance.id}/stop", params={"discardLocalSsd": "true"})
+        except GCEError as e:
+            if e.status != 404:
+                logger.warning(f"⚠️ No se pudo detener la instancia {instance.id}: {e}")
+        self.delete(instance)
+
+    def instance_logs(self, instance: GCEInstance, tail: int = 50) -> str:
+        """Últimas líneas del puerto serie 1, donde el agente escribe la salida del startup script."""
+        output = self.client.request("GET", f"/zones/{instance.zone}/instances/{instance.id}/serialPort", params={"port": 1})
+        return redactor.redact("\n".join(output.get("contents", "").splitlines()[-tail:]))
+
+    def get(self, runner_name: str) -> Optional[GCEInstance]:
+        with self.lock:
+            return self.instances.get(runner_name)
+
+    def list_runners(self) -> List[GCEInstance]:
+        """
+        Instancias activas con el label managed-by en todas las zonas.
+
+        Elimina de paso las detenidas que no sigue el orchestrator y las que superan
+        GCE_MAX_INSTANCE_AGE, que quedaron huérfanas tras un reinicio o un fallo.
+        """
+        result = []
+        now = datetime.now(timezone.utc)
+        with self.lock:
+            tracked = {instance.id for instance in self.instances.values()}
+        for data in self._aggregated(f"labels.managed-by={MANAGED_BY}"):
+            # Las precalentadas las gestiona refresh_warm
+            if data.get("labels", {}).get(WARM_LABEL):
+                continue
+            instance = GCEInstance(self, data)
+            created = datetime.fromisoformat(data["creationTimestamp"])
+            age = (now - created).total_seconds()
+            if (instance.status == "exited" and instance.id not in tracked) or age > self.max_instance_age:
+                logger.info(f"🧹 Instancia huérfana {instance.zone}/{instance.id} ({data.get('status')}, {int(age)}s)")
+                self.delete(instance)
+            elif instance.status == "running":
+                result.append(instance)
+        # Reglas de pools cuyas últimas instancias aún se estaban eliminando
+        self.egress.sweep()
+        return result
+
+    def _aggregated(self, label_filter: str) -> List[Dict[str, Any]]:
+        """Instancias de todas las zonas que cumplen el filtro de label."""
+        found = []
+        page_token = None
+        while True:
+            params = {"filter": label_filter, "returnPartialSuccess": "true"}
+            if page_token:
+                params["pageToken"] = page_token
+            response = self.client.request("GET", "/aggregated/instances", params=params)
+            for scoped in response.get("items", {}).values():
+                found += scoped.get("instances", [])
+            page_token = response.get("nextPageToken")
+            if not page_token:
+                return found
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "project": self.client.project,
+                "auth": self.client.credentials.method,
+                "tracked_instances": len(self.instances),
+                "zone_failures": dict(self.zone_failures),
+                "warm": dict(self.warm_status),
+                "warm_claims": self.warm_claims,
+                "warm_misses": self.warm_misses,
+                "egress": self.egress.status(),
+                "instance_selection": self.selector.status(),
+            }
+
+
+def validate_pool_spec(pool_name: str, spec: Dict[str, Any]):
+    """Valida las opciones "gce" de un pool al cargarlo."""
+    unknown = set(spec) - set(POOL_KEYS)
+    if unknown:
+        raise ConfigurationError(f"Pool {pool_name}: opciones gce desconocidas: {', '.join(sorted(unknown))}")
+    if not spec.get("template"):
+        raise ConfigurationError(f"Pool {pool_name}: gce.template es obligatorio")
+    if not spec.get("zones"):
+        raise ConfigurationError(f"Pool {pool_name}: gce.zones requiere al menos una zona")
+    if spec.get("spot") and spec.get("preemptible"):
+        raise ConfigurationError(f"Pool {pool_name}: gce.spot y gce.preemptible son excluyentes")
+    if spec.get("os", "linux") not in ("linux", "windows"):
+        raise ConfigurationError(f"Pool {pool_name}: gce.os debe ser linux o windows")
+    if int(spec.get("warm", 0)) < 0:
+        raise ConfigurationError(f"Pool {pool_name}: gce.warm no puede ser negativo")
+    if spec.get("selection") is not None:
+        validate_selection(pool_name, "gce", spec["selection"])
+        if spec.get("machine_type"):
+            raise ConfigurationError(f"Pool {pool_name}: gce.selection y gce.machine_type son excluyentes")
+    # Compute Engine no suspende instancias spot ni preemptibles
+    if spec.get("warm") and (spec.get("spot") or spec.get("preemptible")):
+        raise ConfigurationError(f"Pool {pool_name}: gce.warm no admite spot ni preemptible")
+    startup_templates.validate(pool_name, spec)
+
+
+def create_gce_backend() -> Optional[GCEBackend]:
+    """Backend desde GCE_PROJECT y GCE_*, o None si no está configurado."""
+    project = os.getenv("GCE_PROJECT")
+    if not project:
+        return None
+    credentials = GCECredentials(os.getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+    backend = GCEBackend(
+        GCEClient(project, credentials),
+        provision_timeout=int(os.getenv("GCE_PROVISION_TIMEOUT", "600")),
+        max_instance_age=int(os.getenv("GCE_MAX_INSTANCE_AGE", "86400")),
+        pricing_api_key=os.getenv("GCE_PRICING_API_KEY"),
+    )
+    logger.info(format_log('CONFIG', 'Backend GCE', f"{project} ({credentials.method})"))
+    return backend
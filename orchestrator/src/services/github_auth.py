@@ -0,0 +1,341 @@
+"""
+Credenciales para GitHub API.
+Soporta tokens estáticos (PAT) y GitHub Apps con tokens de instalación cacheados por owner.
+"""
+
+import calendar
+import os
+import threading
+import time
+from typing import Callable, Dict, List, Optional, Tuple, Union
+
+import jwt
+import requests
+from src.services.github_server import github_api_url
+from src.services.retries import http_transient, retry_budgets
+from src.services.secrets import get_secrets_provider
+from src.utils.helpers import ConfigurationError, GitHubError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Permisos mínimos para gestionar runners de repositorio y detectar workflows
+DEFAULT_APP_PERMISSIONS = "administration:write,actions:read,contents:read,metadata:read"
+
+
+# Permisos requeridos: gestionar runners de repositorio y leer la cola de Actions
+REQUIRED_APP_PERMISSIONS = {"administration": "write", "actions": "read"}
+REQUIRED_APP_ORG_PERMISSIONS = {"organization_self_hosted_runners": "write"}
+
+# Scopes de PAT clásico; cada requisito se cumple con cualquiera de sus alternativas
+REQUIRED_TOKEN_SCOPES = [("repo",)]
+REQUIRED_TOKEN_ORG_SCOPES = [("admin:org", "manage_runners:org")]
+
+PERMISSION_LEVELS = {"read": 1, "write": 2, "admin": 3}
+
+
+class GitHubCredentials:
+    """Interfaz común de credenciales para GitHubClient."""
+
+    def headers_for(self, owner: Optional[str] = None) -> Dict[str, str]:
+        """Retorna headers de autenticación para el owner indicado."""
+        raise NotImplementedError
+
+    def identity_for(self, owner: Optional[str] = None) -> str:
+        """Identidad usada para contabilizar el rate limit."""
+        raise NotImplementedError
+
+    def missing_permissions(self, organization: bool = False) -> List[str]:
+        """Retorna los permisos requeridos que la credencial no tiene."""
+        raise NotImplementedError
+
+
+def resolve_secret(source: Union[str, Callable[[], str]]) -> str:
+    """Resuelve un secreto fijo o leído en cada uso (permite rotación sin reinicio)."""
+    return source() if callable(source) else source
+
+
+class TokenCredentials(GitHubCredentials):
+    """Token personal (PAT) o token de integración estático."""
+
+    def __init__(self, token: Union[str, Callable[[], str]], api_base: Optional[str] = None):
+        self.token = token
+        self.api_base = (api_base or github_api_url()).rstrip("/")
+
+    def headers_for(self, owner: Optional[str] = None) -> Dict[str, str]:
+        return {"Authorization": f"token {resolve_secret(self.token)}"}
+
+    def identity_for(self, owner: Optional[str] = None) -> str:
+        return "token"
+
+    def missing_permissions(self, organization: bool = False) -> List[str]:
+        """Compara los scopes del header X-OAuth-Scopes con los requeridos."""
+        response = requests.get(
+            f"{self.api_base}/user",
+            headers={**self.headers_for(), "Accept": "application/vnd.github.v3+json"},
+            timeout=30.0,
+        )
+        if response.status_code == 401:
+            return ["token inválido o expirado (401)"]
+
+        # Fine-grained PATs y tokens de instalación no exponen scopes
+        if "X-OAuth-Scopes" not in response.headers:
+            logger.warning(format_log('WARNING', 'Scopes del token no verificables', 'token sin X-OAuth-Scopes (fine-grained)'))
+            return []
+
+        granted = {scope.strip() for scope in response.headers["X-OAuth-Scopes"].split(",") if scope.strip()}
+        required = REQUIRED_TOKEN_SCOPES + (REQUIRED_TOKEN_ORG_SCOPES if organization else [])
+        return [
+            f"scope {' o '.join(alternatives)}"
+            for alternatives in required
+            if not granted.intersection(alternatives)
+        ]
+
+
+class GitHubAppCredentials(GitHubCredentials):
+    """
+    Autenticación como GitHub App.
+
+    Firma JWTs con la clave privada de la App, obtiene tokens de instalación por
+    owner (organización o usuario) y los renueva antes de que expiren.
+    """
+
+    def __init__(
+        self,
+        app_id: str,
+        private_key: Union[str, Callable[[], str]],
+        api_base: Optional[str] = None,
+        permissions: Optional[Dict[str, str]] = None,
+        installation_id: Optional[str] = None,
+    ):
+        self.app_id = app_id
+        self.private_key = private_key
+        self.api_base = (api_base or github_api_url()).rstrip("/")
+        self.permissions = permissions or {}
+        self.default_installation_id = installation_id
+        self.refresh_margin = int(os.getenv("GITHUB_APP_TOKEN_REFRESH_MARGIN", "300"))
+        self.timeout = 30.0
+        self.installation_ids: Dict[str, str] = {}
+        self.tokens: Dict[str, Tuple[str, float]] = {}
+        self.lock = threading.Lock()
+
+    def create_jwt(self) -> str:
+        """Genera un JWT de la App válido por 9 minutos."""
+        now = int(time.time())
+        payload = {"iat": now - 60, "exp": now + 540, "iss": str(self.app_id)}
+        private_key = resolve_secret(self.private_key).replace("\\n", "\n")
+        return jwt.encode(payload, private_key, algorithm="RS256")
+
+    def _app_headers(self) -> Dict[str, str]:
+        return {
+            "Authorization": f"Bearer {self.create_jwt()}",
+            "Accept": "application/vnd.github.v3+json",
+        }
+
+    def get_installation_id(self, owner: Optional[str]) -> str:
+        """Resuelve la instalación de la App para un owner (cacheada)."""
+        if self.default_installation_id:
+            return self.default_installation_id
+
+        if not owner:
+            raise GitHubError("Se requiere owner para resolver la instalación de la GitHub App")
+
+        if owner in self.installation_ids:
+            return self.installation_ids[owner]
+
+        for endpoint in (f"orgs/{owner}/installation", f"users/{owner}/installation"):
+            response = retry_budgets.get("github").call(
+                lambda: requests.get(f"{self.api_base}/{endpoint}", headers=self._app_headers(), timeout=self.timeout),
+                retry_error=lambda e: isinstance(e, requests.RequestException),
+                retry_result=http_transient,
+            )
+            if response.status_code == 200:
+                installation_id = str(response.json()["id"])
+                self.installation_ids[owner] = installation_id
+                logger.info(format_log('CONFIG', 'Instalación de GitHub App resuelta', f'{owner} -> {installation_id}'))
+                return installation_id
+
+        raise GitHubError(f"La GitHub App no está instalada para {owner}")
+
+    def get_installation_token(self, owner: Optional[str] = None) -> str:
+        """Retorna un token de instalación vigente, renovándolo si está por expirar."""
+        installation_id = self.get_installation_id(owner)
+
+        with self.lock:
+            cached = self.tokens.get(installation_id)
+            if cached and cached[1] - time.time() > self.refresh_margin:
+                return cached[0]
+
+            body = {"permissions": self.permissions} if self.permissions else {}
+            response = retry_budgets.get("github").call(
+                lambda: requests.post(
+                    f"{self.api_base}/app/installations/{installation_id}/access_tokens",
+                    headers=self._app_headers(),
+                    json=body,
+                    timeout=self.timeout,
+                ),
+                retry_error=lambda e: isinstance(e, requests.RequestException),
+                retry_result=http_transient,
+            )
+            if response.status_code != 201:
+                raise GitHubError(
+                    f"No se pudo obtener token de instalación {installation_id}: {response.status_code}"
+                )
+
+            data = response.json()
+            expires_at = self._parse_expiration(data.get("expires_at"))
+            self.tokens[installation_id] = (data["token"], expires_at)
+            logger.info(format_log('SUCCESS', 'Token de instalación renovado', f'instalación {installation_id}'))
+            return data["token"]
+
+    def _parse_expiration(self, expires_at: Optional[str]) -> float:
+        """Convierte expires_at (ISO 8601) a timestamp; por defecto 1 hora."""
+        if not expires_at:
+            return time.time() + 3600
+        return calendar.timegm(time.strptime(expires_at, "%Y-%m-%dT%H:%M:%SZ"))
+
+    def headers_for(self, owner: Optional[str] = None) -> Dict[str, str]:
+        return {"Authorization": f"token {self.get_installation_token(owner)}"}
+
+    def identity_for(self, owner: Optional[str] = None) -> str:
+        try:
+            return f"installation-{self.get_installation_id(owner)}"
+        except GitHubError:
+            return "app"
+
+    def missing_permissions(self, organization: bool = False) -> List[str]:
+        """Revisa los permisos concedidos a cada instalación de la App."""
+        response = requests.get(
+            f"{self.api_base}/app/installations", headers=self._app_headers(), timeout=self.timeout
+        )
+        if response.status_code == 401:
+            return ["JWT de la App rechazado (GITHUB_APP_ID o clave privada incorrectos)"]
+        if response.status_code != 200:
+            return [f"no se pudieron listar instalaciones ({response.status_code})"]
+
+        installations = response.json()
+        if self.default_installation_id:
+            installations = [i for i in installations if str(i["id"]) == self.default_installation_id]
+        if not installations:
+            return ["la App no tiene instalaciones"]
+
+        required = {**REQUIRED_APP_PERMISSIONS, **(REQUIRED_APP_ORG_PERMISSIONS if organization else {})}
+        missing = []
+        for installation in installations:
+            granted = installation.get("permissions", {})
+            account = installation.get("account", {}).get("login", installation["id"])
+            for permission, level in required.items():
+                if PERMISSION_LEVELS.get(granted.get(permission), 0) < PERMISSION_LEVELS[level]:
+                    missing.append(f"{permission}:{level} en la instalación de {account}")
+        return missing
+
+    def list_installations(self) -> List[Dict]:
+        """Lista todas las instalaciones de la App."""
+        response = requests.get(
+            f"{self.api_base}/app/installations", headers=self._app_headers(), timeout=self.timeout
+        )
+        return response.json() if response.status_code == 200 else []
+
+    def list_installation_repositories(self) -> List[str]:
+        """Lista los repositorios accesibles por todas las instalaciones de la App."""
+        repos = []
+        installations = self.list_installations()
+        if self.default_installation_id:
+            installations = [i for i in installations if str(i["id"]) == self.default_installation_id]
+
+        for installation in installations:
+            owner = installation["account"]["login"]
+            self.installation_ids.setdefault(owner, str(installation["id"]))
+            page = 1
+            while True:
+                response = requests.get(
+                    f"{self.api_base}/installation/repositories",
+                    headers={**self.headers_for(owner), "Accept": "application/vnd.github.v3+json"},
+                    params={"page": page, "per_page": 100},
+                    timeout=self.timeout,
+                )
+                if response.status_code != 200:
+                    break
+                page_repos = response.json().get("repositories", [])
+                if not page_repos:
+                    break
+                repos.extend(repo["full_name"] for repo in page_repos)
+                page += 1
+
+        return repos
+
+
+def parse_permissions(raw_permissions: str) -> Dict[str, str]:
+    """Convierte 'administration:write,actions:read' en diccionario de permisos."""
+    permissions = {}
+    for item in raw_permissions.split(","):
+        name, _, level = item.strip().partition(":")
+        if name:
+            permissions[name] = level or "read"
+    return permissions
+
+
+def load_app_private_key() -> Optional[Union[str, Callable[[], str]]]:
+    """Carga la clave privada de la App desde archivo o desde el proveedor de secretos."""
+    key_path = os.getenv("GITHUB_APP_PRIVATE_KEY_PATH")
+    if key_path:
+        with open(key_path, "r") as key_file:
+            return key_file.read()
+
+    secrets = get_secrets_provider()
+    if secrets.get("GITHUB_APP_PRIVATE_KEY"):
+        # Se lee en cada firma: una rotación en el proveedor aplica sin reinicio.
+        # Permite claves en una sola línea con \n escapados en el .env
+        return lambda: secrets.get("GITHUB_APP_PRIVATE_KEY")
+
+    return None
+
+
+def is_github_app_configured() -> bool:
+    """Indica si se configuró autenticación por GitHub App."""
+    return bool(os.getenv("GITHUB_APP_ID"))
+
+
+def validate_credentials_permissions(credentials: GitHubCredentials):
+    """
+    Verifica al iniciar que la credencial tenga los permisos requeridos.
+
+    Raises:
+        ConfigurationError: Con la lista precisa de permisos faltantes
+    """
+    if os.getenv("GITHUB_SKIP_PERMISSION_CHECK", "false").lower() == "true":
+        logger.warning(format_log('WARNING', 'Verificación de permisos de GitHub omitida'))
+        return
+
+    organization = os.getenv("DISCOVERY_MODE", "all") == "organization"
+    try:
+        missing = credentials.missing_permissions(organization=organization)
+    except requests.RequestException as e:
+        # Sin conectividad no se puede concluir nada: no bloquear el arranque
+        logger.warning(format_log('WARNING', 'No se pudieron verificar permisos de GitHub', str(e)))
+        return
+
+    if missing:
+        raise ConfigurationError("Permisos de GitHub faltantes: " + "; ".join(missing))
+
+    logger.info(format_log('SUCCESS', 'Permisos de GitHub verificados'))
+
+
+def create_github_credentials() -> GitHubCredentials:
+    """Crea las credenciales según la configuración: GitHub App tiene prioridad sobre PAT."""
+    if is_github_app_configured():
+        private_key = load_app_private_key()
+        if not private_key:
+            raise ConfigurationError(
+                "GITHUB_APP_ID requiere GITHUB_APP_PRIVATE_KEY o GITHUB_APP_PRIVATE_KEY_PATH"
+            )
+        return GitHubAppCredentials(
+            app_id=os.environ["GITHUB_APP_ID"],
+            private_key=private_key,
+            permissions=parse_permissions(os.getenv("GITHUB_APP_PERMISSIONS", DEFAULT_APP_PERMISSIONS)),
+            installation_id=os.getenv("GITHUB_APP_INSTALLATION_ID"),
+        )
+
+    secrets = get_secrets_provider()
+    if not secrets.get("GITHUB_RUNNER_TOKEN"):
+        raise RuntimeError("GITHUB_RUNNER_TOKEN es obligatorio si no se configura GITHUB_APP_ID")
+    return TokenCredentials(lambda: secrets.get("GITHUB_RUNNER_TOKEN"))
@@ -0,0 +1,268 @@
+"""
+Cliente compartido para GitHub API.
+Registra el presupuesto de rate limit por credencial y difiere las llamadas no críticas
+cuando el presupuesto baja, para que las llamadas críticas nunca reciban 403. Los
+listados que se consultan en bucle usan peticiones condicionales (ETag): un 304 no
+consume rate limit y reutiliza la respuesta anterior.
+"""
+
+import os
+import threading
+import time
+from collections import OrderedDict
+from typing import Any, Dict, Optional, Tuple
+
+import requests
+from src.services.chaos import chaos
+from src.services.github_auth import GitHubCredentials, TokenCredentials
+from src.services.github_outage import github_outage
+from src.services.github_server import github_api_url
+from src.services.metrics import metrics
+from src.services.retries import retry_budgets
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class RateLimitTracker:
+    """Estado de rate limit por identidad (token o instalación)."""
+
+    def __init__(self):
+        self.limits: Dict[str, Dict[str, int]] = {}
+        self.lock = threading.Lock()
+
+    def update(self, identity: str, headers: Dict[str, str]):
+        """Actualiza el estado a partir de los headers X-RateLimit-* de una respuesta."""
+        if "X-RateLimit-Remaining" not in headers:
+            return
+
+        try:
+            state = {
+                "limit": int(headers.get("X-RateLimit-Limit", 0)),
+                "remaining": int(headers["X-RateLimit-Remaining"]),
+                "reset": int(headers.get("X-RateLimit-Reset", 0)),
+            }
+        except ValueError:
+            return
+
+        with self.lock:
+            self.limits[identity] = state
+
+        metrics.gauge("github.rate_limit_remaining", state["remaining"], tags={"identity": identity})
+
+    def remaining(self, identity: str) -> Optional[int]:
+        """Retorna las llamadas restantes o None si aún no se conoce."""
+        with self.lock:
+            state = self.limits.get(identity)
+        if not state:
+            return None
+        # Pasado el reset, el presupuesto se considera restaurado
+        if state["reset"] and time.time() >= state["reset"]:
+            return None
+        return state["remaining"]
+
+    def seconds_until_reset(self, identity: str) -> int:
+        """Segundos hasta que GitHub restaure el presupuesto."""
+        with self.lock:
+            state = self.limits.get(identity)
+        if not state or not state["reset"]:
+            return 0
+        return max(0, int(state["reset"] - time.time()))
+
+    def summary(self) -> Dict[str, Dict[str, int]]:
+        """Retorna copia del estado de todas las identidades."""
+        with self.lock:
+            return {identity: dict(state) for identity, state in self.limits.items()}
+
+
+# Estado compartido por todos los clientes del proceso
+rate_limits = RateLimitTracker()
+
+
+class ConditionalCache:
+    """Últimas respuestas 200 con ETag o Last-Modified por identidad y URL (LRU acotada)."""
+
+    def __init__(self, max_entries: int = 1000):
+        self.max_entries = max_entries
+        self.entries: "OrderedDict[Tuple[str, str], requests.Response]" = OrderedDict()
+        self.hits = 0
+        self.misses = 0
+        self.lock = threading.Lock()
+
+    @staticmethod
+    def key(identity: str, url: str, params: Optional[Dict[str, Any]]) -> Tuple[str, str]:
+        query = "&".join(f"{name}={value}" for name, value in sorted((params or {}).items()))
+        return identity, f"{url}?{query}"
+
+    def validators(self, key: Tuple[str, str]) -> Dict[str, str]:
+        """Cabeceras If-None-Match / If-Modified-Since de la respuesta guardada."""
+        with self.lock:
+            cached = self.entries.get(key)
+        if cached is None:
+            return {}
+        headers = {}
+        if cached.headers.get("ETag"):
+            headers["If-None-Match"] = cached.headers["ETag"]
+        if cached.headers.get("Last-Modified"):
+            headers["If-Modified-Since"] = cached.headers["Last-Modified"]
+        return headers
+
+    def resolve(self, key: Tuple[str, str], response: requests.Response) -> requests.Response:
+        """Respuesta guardada si GitHub contestó 304; guarda las 200 con validadores."""
+        with self.lock:
+            if response.status_code == 304 and key in self.entries:
+                self.entries.move_to_end(key)
+                self.hits += 1
+                return self.entries[key]
+            self.misses += 1
+            if response.status_code == 200 and (response.headers.get("ETag") or response.headers.get("Last-Modified")):
+                self.entries[key] = response
+                self.entries.move_to_end(key)
+                while len(self.entries) > self.max_entries:
+                    self.entries.popitem(last=False)
+            return response
+
+    def summary(self) -> Dict[str, int]:
+        with self.lock:
+            return {"entries": len(self.entries), "hits": self.hits, "misses": self.misses}
+
+
+# Caché condicional compartida; GITHUB_ETAG_CACHE_SIZE=0 la desactiva
+conditional_cache = ConditionalCache(int(os.getenv("GITHUB_ETAG_CACHE_SIZE", "1000")))
+
+
+class GitHubClient:
+    """
+    Wrapper de requests para GitHub API con control de presupuesto.
+
+    Las llamadas marcadas como no críticas (listados, reconciliación) se difieren
+    cuando quedan menos de GITHUB_RATE_LIMIT_RESERVE llamadas, reservando el resto
+    para las críticas (registration tokens).
+    """
+
+    def __init__(self, credentials: GitHubCredentials, api_base: Optional[str] = None):
+        if isinstance(credentials, str):
+            credentials = TokenCredentials(credentials)
+        self.credentials = credentials
+        self.api_base = (api_base or github_api_url()).rstrip("/")
+        self.timeout = 30.0
+        self.reserve = int(os.getenv("GITHUB_RATE_LIMIT_RESERVE", "500"))
+
+    def auth_headers(self, owner: Optional[str] = None) -> Dict[str, str]:
+        """Headers de autenticación para llamadas sobre recursos del owner."""
+        return {**self.credentials.headers_for(owner), "Accept": "application/vnd.github.v3+json"}
+
+    def should_defer(self, identity: str) -> bool:
+        """Indica si las llamadas no críticas deben diferirse."""
+        remaining = rate_limits.remaining(identity)
+        return remaining is not None and remaining < self.reserve
+
+    @staticmethod
+    def owner_from_path(url: str) -> Optional[str]:
+        """Extrae el owner de paths repos/{owner}/... u orgs/{owner}/..."""
+        parts = url.split("?", 1)[0].split("/")
+        for marker in ("repos", "orgs", "users"):
+            if marker in parts:
+                index = parts.index(marker)
+                if index + 1 < len(parts):
+                    return parts[index + 1]
+        return None
+
+    def request(self, method: str, url: str, critical: bool = False, **kwargs: Any) -> Optional[requests.Response]:
+        """
+        Ejecuta una llamada a GitHub API.
+
+        Args:
+            method: Método HTTP
+            url: URL absoluta o path relativo a la API
+            critical: True si la llamada no puede diferirse
+            owner: (kwarg opcional) owner para elegir credenciales si no se deduce del path
+            conditional: (kwarg opcional) GET con ETag; un 304 devuelve la respuesta guardada
+            probe: (kwarg opcional) comprobación del modo degradado; no cuenta como éxito ni error
+
+        Returns:
+            Respuesta de GitHub, o None si la llamada fue diferida
+        """
+        if not url.startswith("http"):
+            url = f"{self.api_base}/{url.lstrip('/')}"
+
+        owner = kwargs.pop("owner", None) or self.owner_from_path(url)
+        identity = self.credentials.identity_for(owner)
+        conditional = kwargs.pop("conditional", False) and method == "GET" and conditional_cache.max_entries > 0
+        probe = kwargs.pop("probe", False)
+
+        if not critical and github_outage.degraded:
+            # Modo degradado: solo las llamadas críticas; el resto esperan a la recuperación
+            metrics.incr("github.calls_deferred", tags={"identity": identity, "reason": "degraded"})
+            return None
+
+        if not critical and self.should_defer(identity):
+            metrics.incr("github.calls_deferred", tags={"identity": identity})
+            logger.debug(
+                f"Llamada diferida por rate limit ({rate_limits.remaining(identity)} restantes, "
+                f"reset en {rate_limits.seconds_until_reset(identity)}s): {method} {url}"
+            )
+            return None
+
+        kwargs.setdefault("timeout", self.timeout)
+        headers = {**self.auth_headers(owner), **kwargs.pop("headers", {})}
+        cache_key = conditional_cache.key(identity, url, kwargs.get("params")) if conditional else None
+        if cache_key:
+            headers.update(conditional_cache.validators(cache_key))
+
+        def send() -> requests.Response:
+            if chaos:
+                chaos.github_call(method, url, kwargs["timeout"])
+            return requests.request(method, url, headers=headers, **kwargs)
+
+        try:
+            # Errores de red y 5xx se reintentan; la comprobación del modo degradado no
+            response = retry_budgets.get("github").call(
+                send,
+                retry_error=lambda e: isinstance(e, requests.RequestException),
+                retry_result=lambda response: response.status_code >= 500,
+                max_attempts=1 if probe else None,
+            )
+        except requests.RequestException as e:
+            if not probe:
+                github_outage.record_failure(f"{method} {url}: {e}")
+            raise
+
+        # GraphQL y búsqueda tienen su propio presupuesto: no deben pisar el de la API REST
+        resource = response.headers.get("X-RateLimit-Resource", "core")
+        rate_limits.update(identity if resource == "core" else f"{identity}:{resource}", response.headers)
+        if cache_key:
+            not_modified = response.status_code == 304
+            response = conditional_cache.resolve(cache_key, response)
+            if not_modified:
+                # Un 304 no cuenta para el rate limit de GitHub
+                metrics.incr("github.calls_not_modified", tags={"identity": identity})
+                github_outage.record_success()
+                return response
+        metrics.incr("github.calls", tags={"identity": identity, "critical": str(critical).lower()})
+
+        rate_limited = response.status_code in (403, 429) and rate_limits.remaining(identity) == 0
+        if rate_limited:
+            metrics.incr("github.rate_limited", tags={"identity": identity})
+            logger.warning(format_log('WARNING', 'Rate limit de GitHub agotado', f'{method} {url}'))
+
+        if not probe:
+            if rate_limited:
+                github_outage.record_failure(f"rate limit agotado ({identity}), reset en {rate_limits.seconds_until_reset(identity)}s", immediate=True)
+            elif response.status_code >= 500:
+                github_outage.record_failure(f"HTTP {response.status_code} en {method} {url}")
+            else:
+                github_outage.record_success()
+        return response
+
+    def get(self, url: str, critical: bool = False, **kwargs: Any) -> Optional[requests.Response]:
+        """GET a GitHub API."""
+        return self.request("GET", url, critical=critical, **kwargs)
+
+    def post(self, url: str, critical: bool = False, **kwargs: Any) -> Optional[requests.Response]:
+        """POST a GitHub API."""
+        return self.request("POST", url, critical=critical, **kwargs)
+
+    def delete(self, url: str, critical: bool = False, **kwargs: Any) -> Optional[requests.Response]:
+        """DELETE a GitHub API."""
+        return self.request("DELETE", url, critical=critical, **kwargs)
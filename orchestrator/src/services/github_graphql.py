@@ -0,0 +1,158 @@
+"""
+Consulta por lotes de workflow runs en cola con GraphQL.
+El modo automático necesita saber cuántos runs hay en cola en cada repositorio; por
+REST es una llamada por repositorio y ciclo. Con GraphQL se consultan hasta
+GITHUB_GRAPHQL_BATCH_SIZE repositorios del mismo owner en una sola petición, a través
+de los check suites de Actions de las ramas y pull requests más recientes.
+
+Si el servidor no tiene los campos necesarios (versiones antiguas de GHES) la consulta
+se desactiva y se vuelve a REST; los repositorios que fallen sueltos también se
+consultan por REST.
+"""
+
+import json
+import os
+from typing import Any, Dict, List, Optional, Set
+
+from src.services.github_server import github_graphql_url
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Ramas y pull requests revisados por repositorio: los runs en cola están en los commits recientes
+REF_LIMIT = 20
+PULL_REQUEST_LIMIT = 20
+CHECK_SUITE_LIMIT = 20
+
+# Códigos de error de GraphQL que indican un esquema sin los campos de la consulta
+SCHEMA_ERRORS = ("undefinedField", "argumentNotAccepted", "undefinedType")
+
+QUEUED_SUITES_FRAGMENT = (
+    f"fragment QueuedSuites on Commit {{ checkSuites(first: {CHECK_SUITE_LIMIT}) "
+    "{ nodes { status workflowRun { databaseId } } } }"
+)
+
+
+def repository_query(alias: str, repo: str) -> str:
+    """Campo de la consulta para un repositorio: sus ramas y pull requests abiertos más recientes."""
+    owner, name = repo.split("/", 1)
+    return (
+        f"{alias}: repository(owner: {json.dumps(owner)}, name: {json.dumps(name)}) {{ "
+        f"refs(refPrefix: \"refs/heads/\", first: {REF_LIMIT}, orderBy: {{field: TAG_COMMIT_DATE, direction: DESC}}) "
+        "{ nodes { target { ...QueuedSuites } } } "
+        f"pullRequests(states: OPEN, first: {PULL_REQUEST_LIMIT}, orderBy: {{field: UPDATED_AT, direction: DESC}}) "
+        "{ nodes { commits(last: 1) { nodes { commit { ...QueuedSuites } } } } } }"
+    )
+
+
+def queued_runs(repository: Dict[str, Any]) -> int:
+    """Workflow runs distintos con el check suite en cola (un run puede estar en una rama y en un PR)."""
+    commits = [ref.get("target") or {} for ref in (repository.get("refs") or {}).get("nodes", [])]
+    for pull_request in (repository.get("pullRequests") or {}).get("nodes", []):
+        commits += [node.get("commit") or {} for node in (pull_request.get("commits") or {}).get("nodes", [])]
+
+    runs: Set[int] = set()
+    for commit in commits:
+        for suite in (commit.get("checkSuites") or {}).get("nodes", []):
+            run = suite.get("workflowRun")
+            if run and suite.get("status") == "QUEUED":
+                runs.add(run["databaseId"])
+    return len(runs)
+
+
+class QueuedRunsQuery:
+    """Cuenta runs en cola de muchos repositorios con una petición GraphQL por lote y owner."""
+
+    def __init__(self, client: Any, batch_size: int = 50):
+        self.client = client
+        self.batch_size = batch_size
+        self.url = github_graphql_url(client.api_base)
+        self.available = True
+        self.unavailable_reason: Optional[str] = None
+        self.batches = 0
+        self.fallbacks = 0
+
+    def counts(self, repos: List[str]) -> Dict[str, int]:
+        """
+        Runs en cola por repositorio.
+
+        Los repositorios que no aparecen en el resultado deben consultarse por REST.
+        """
+        if not self.available:
+            return {}
+
+        by_owner: Dict[str, List[str]] = {}
+        for repo in repos:
+            by_owner.setdefault(repo.split("/", 1)[0], []).append(repo)
+
+        result: Dict[str, int] = {}
+        for owner, owner_repos in by_owner.items():
+            for start in range(0, len(owner_repos), self.batch_size):
+                result.update(self._batch(owner, owner_repos[start:start + self.batch_size]))
+                if not self.available:
+                    return result
+
+        missing = len(repos) - len(result)
+        if missing:
+            self.fallbacks += missing
+            metrics.incr("github.graphql_fallbacks", missing)
+        return result
+
+    def _batch(self, owner: str, repos: List[str]) -> Dict[str, int]:
+        aliases = {f"r{index}": repo for index, repo in enumerate(repos)}
+        query = "query { " + " ".join(repository_query(alias, repo) for alias, repo in aliases.items()) + " } " + QUEUED_SUITES_FRAGMENT
+
+        response = self.client.post(self.url, owner=owner, json={"query": query})
+        if response is None:
+            return {}
+        self.batches += 1
+        metrics.incr("github.graphql_batches")
+        if response.status_code == 404:
+            self._disable(f"{self.url} no existe")
+            return {}
+        if response.status_code != 200:
+            logger.warning(format_log('WARNING', 'Consulta GraphQL fallida, se usa REST', f"{owner}: HTTP {response.status_code}"))
+            return {}
+
+        body = response.json()
+        failed: Set[str] = set()
+        for error in body.get("errors") or []:
+            code = (error.get("extensions") or {}).get("code") or error.get("type")
+            if code in SCHEMA_ERRORS:
+                self._disable(error.get("message", code))
+                return {}
+            # Errores de un repositorio concreto (NOT_FOUND, FORBIDDEN): solo ese se consulta por REST
+            path = error.get("path") or []
+            if path:
+                failed.add(str(path[0]))
+            else:
+                logger.warning(format_log('WARNING', 'Consulta GraphQL fallida, se usa REST', f"{owner}: {error.get('message')}"))
+                return {}
+
+        data = body.get("data") or {}
+        return {
+            repo: queued_runs(data[alias])
+            for alias, repo in aliases.items()
+            if alias not in failed and data.get(alias) is not None
+        }
+
+    def _disable(self, reason: str):
+        self.available = False
+        self.unavailable_reason = reason
+        logger.warning(format_log('WARNING', 'GraphQL no disponible para los runs en cola, se usa REST', reason))
+
+    def status(self) -> Dict[str, Any]:
+        return {
+            "available": self.available,
+            "reason": self.unavailable_reason,
+            "batches": self.batches,
+            "fallbacks": self.fallbacks,
+        }
+
+
+def create_queued_runs_query(client: Any) -> Optional[QueuedRunsQuery]:
+    """Consulta por lotes salvo con GITHUB_GRAPHQL_ENABLED=false."""
+    if os.getenv("GITHUB_GRAPHQL_ENABLED", "true").lower() != "true":
+        return None
+    return QueuedRunsQuery(client, max(1, int(os.getenv("GITHUB_GRAPHQL_BATCH_SIZE", "50"))))
@@ -0,0 +1,179 @@
+"""
+Modo degradado ante caídas de GitHub API.
+Tras GITHUB_DEGRADED_THRESHOLD errores seguidos (5xx, timeouts, conexión) o con el rate
+limit agotado, el orchestrator entra en modo degradado en lugar de encadenar fallos:
+los runners existentes se conservan (sin GitHub no se sabe si tienen trabajo), se pausan
+las llamadas y tareas no esenciales (listados, reconciliación, modo automático) y las
+peticiones de runners se guardan como intenciones que se crean al recuperarse. Una
+consulta a /rate_limit, que no consume presupuesto, comprueba la recuperación.
+"""
+
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, List, Optional
+
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class GitHubOutage:
+    """Estado de disponibilidad de GitHub API compartido por todos los clientes del proceso."""
+
+    def __init__(self, threshold: int = 5, max_intents: int = 1000):
+        self.threshold = threshold
+        self.max_intents = max_intents
+        self.failures = 0
+        self.since: Optional[float] = None
+        self.reason: Optional[str] = None
+        self.episodes = 0
+        # Peticiones de runners pendientes por clave (job, entrega o petición): se crean al recuperarse
+        self.intents: Dict[str, Any] = {}
+        self.dropped_intents = 0
+        self.recovery_listeners: List[Callable[[], None]] = []
+        self.lock = threading.Lock()
+
+    @property
+    def enabled(self) -> bool:
+        return self.threshold > 0
+
+    @property
+    def degraded(self) -> bool:
+        return self.since is not None
+
+    def record_success(self):
+        """Respuesta válida de GitHub: reinicia el contador y sale del modo degradado."""
+        with self.lock:
+            self.failures = 0
+            recovered = self.since is not None
+        if recovered:
+            self.recover()
+
+    def record_failure(self, reason: str, immediate: bool = False):
+        """Error de GitHub; con `immediate` (rate limit agotado) no se espera al umbral."""
+        if not self.enabled:
+            return
+        with self.lock:
+            self.failures += 1
+            enter = self.since is None and (immediate or self.failures >= self.threshold)
+            if enter:
+                self.since = time.time()
+                self.reason = reason
+                self.episodes += 1
+        if enter:
+            metrics.gauge("github.degraded", 1)
+            metrics.incr("github.degraded_episodes")
+            logger.warning(format_log('WARNING', 'GitHub API no disponible: modo degradado', reason))
+
+    def recover(self):
+        """Sale del modo degradado y avisa para crear los runners pendientes."""
+        with self.lock:
+            if self.since is None:
+                return
+            duration = int(time.time() - self.since)
+            self.since = None
+            self.reason = None
+            self.failures = 0
+            pending = len(self.intents)
+        metrics.gauge("github.degraded", 0)
+        logger.info(format_log('SUCCESS', 'GitHub API recuperada', f'{duration}s en modo degradado, {pending} peticiones pendientes'))
+        for listener in self.recovery_listeners:
+            threading.Thread(target=listener, daemon=True).start()
+
+    def on_recovery(self, listener: Callable[[], None]):
+        self.recovery_listeners.append(listener)
+
+    def queue_intent(self, key: str, intent: Any) -> bool:
+        """Guarda una petición de runner para crearla al recuperarse; False si no hay sitio."""
+        with self.lock:
+            if key not in self.intents and len(self.intents) >= self.max_intents:
+                self.dropped_intents += 1
+                return False
+            self.intents[key] = intent
+            count = len(self.intents)
+        metrics.gauge("github.degraded_intents", count)
+        return True
+
+    def take_intents(self) -> List[Any]:
+        """Retira las peticiones pendientes (en orden de llegada)."""
+        with self.lock:
+            intents = list(self.intents.values())
+            self.intents.clear()
+        metrics.gauge("github.degraded_intents", 0)
+        return intents
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "degraded": self.since is not None,
+                "since": datetime.fromtimestamp(self.since, timezone.utc).isoformat() if self.since else None,
+                "reason": self.reason,
+                "consecutive_failures": self.failures,
+                "episodes": self.episodes,
+                "pending_intents": len(self.intents),
+                "dropped_intents": self.dropped_intents,
+            }
+
+
+class OutageProbe:
+    """Comprueba cada `interval` segundos, mientras dure el modo degradado, si GitHub volvió."""
+
+    def __init__(self, outage: GitHubOutage, client: Any, interval: int = 30):
+        self.outage = outage
+        self.client = client
+        self.interval = interval
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            if self.outage.degraded:
+                self.probe()
+
+    def probe(self) -> bool:
+        """GET /rate_limit: no consume presupuesto y dice si queda margen para la API REST."""
+        try:
+            response = self.client.get("rate_limit", critical=True, probe=True)
+        except Exception as e:
+            logger.info(format_log('INFO', 'GitHub API sigue sin responder', str(e)))
+            return False
+        if response.status_code != 200:
+            logger.info(format_log('INFO', 'GitHub API sigue sin responder', f'HTTP {response.status_code}'))
+            return False
+        core = (response.json().get("resources") or {}).get("core") or {}
+        if core.get("remaining", 1) == 0:
+            logger.info(format_log('INFO', 'Rate limit de GitHub aún agotado', f"reset {core.get('reset')}"))
+            return False
+        self.outage.recover()
+        return True
+
+
+def create_github_outage() -> GitHubOutage:
+    """Modo degradado salvo con GITHUB_DEGRADED_THRESHOLD=0."""
+    return GitHubOutage(
+        threshold=int(os.getenv("GITHUB_DEGRADED_THRESHOLD", "5")),
+        max_intents=int(os.getenv("GITHUB_DEGRADED_MAX_INTENTS", "1000")),
+    )
+
+
+# Compartido por todos los clientes de GitHub del proceso
+github_outage = create_github_outage()
@@ -0,0 +1,149 @@
+"""
+GitHub.com o GitHub Enterprise Server (GHES).
+GITHUB_API_URL apunta la API a un GHES (https://ghe.example.com/api/v3) y GITHUB_URL
+es la URL web con la que se registran los runners; si no se indica, se deduce de la
+API. La versión de GHES se obtiene de /meta para saber qué funcionalidades ofrece.
+"""
+
+import os
+import re
+from typing import Any, Dict, Optional, Tuple
+from urllib.parse import urlsplit
+
+import requests
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+GITHUB_COM_API = "https://api.github.com"
+GITHUB_COM_URL = "https://github.com"
+
+# Versión mínima de GHES con runners efímeros (--ephemeral)
+MIN_GHES_VERSION = "3.3"
+
+# Funcionalidades que dependen de la versión de GHES (en GitHub.com están todas)
+GHES_CAPABILITIES = {
+    "ephemeral_runners": "3.3",
+    "jit_config": "3.10",
+}
+
+
+def github_api_url() -> str:
+    """URL base de la API (GITHUB_API_URL o api.github.com)."""
+    return os.getenv("GITHUB_API_URL", GITHUB_COM_API).rstrip("/")
+
+
+def github_graphql_url(api_base: Optional[str] = None) -> str:
+    """Endpoint GraphQL: api.github.com/graphql o, en GHES, /api/graphql junto a /api/v3."""
+    api_base = (api_base or github_api_url()).rstrip("/")
+    if api_base.endswith("/api/v3"):
+        return api_base[: -len("/v3")] + "/graphql"
+    return f"{api_base}/graphql"
+
+
+def is_enterprise_server(api_base: Optional[str] = None) -> bool:
+    return (api_base or github_api_url()).rstrip("/") != GITHUB_COM_API
+
+
+def github_web_url(api_base: Optional[str] = None) -> str:
+    """URL web de GitHub (GITHUB_URL, o deducida de la API: https://ghe.example.com/api/v3 -> https://ghe.example.com)."""
+    configured = os.getenv("GITHUB_URL")
+    if configured:
+        return configured.rstrip("/")
+    api_base = (api_base or github_api_url()).rstrip("/")
+    if not is_enterprise_server(api_base):
+        return GITHUB_COM_URL
+    if api_base.endswith("/api/v3"):
+        return api_base[: -len("/api/v3")]
+    parts = urlsplit(api_base)
+    return f"{parts.scheme}://{parts.netloc}"
+
+
+def github_hostname(api_base: Optional[str] = None) -> str:
+    return urlsplit(github_web_url(api_base)).hostname or ""
+
+
+def parse_version(version: str) -> Tuple[int, ...]:
+    """'3.10.4' -> (3, 10, 4); ignora sufijos como '-rc1'."""
+    numbers = []
+    for part in version.split("."):
+        match = re.match(r"\d+", part)
+        if not match:
+            break
+        numbers.append(int(match.group()))
+        if match.end() < len(part):
+            break
+    return tuple(numbers)
+
+
+def capabilities_for(version: Optional[str]) -> Dict[str, bool]:
+    """Funcionalidades disponibles para una versión de GHES (None = GitHub.com)."""
+    if version is None:
+        return {name: True for name in GHES_CAPABILITIES}
+    current = parse_version(version)
+    return {name: current >= parse_version(minimum) for name, minimum in GHES_CAPABILITIES.items()}
+
+
+def server_info(api_base: Optional[str] = None, credentials: Any = None) -> Dict[str, Any]:
+    """
+    Tipo de servidor, versión y funcionalidades disponibles.
+
+    En GHES consulta /meta (installed_version); en modo privado /meta requiere
+    autenticación, por lo que se reintenta con las credenciales indicadas.
+
+    Raises:
+        requests.RequestException: Si el servidor no es accesible
+    """
+    api_base = (api_base or github_api_url()).rstrip("/")
+    if not is_enterprise_server(api_base):
+        return {"enterprise": False, "url": GITHUB_COM_URL, "version": None, "capabilities": capabilities_for(None)}
+
+    response = requests.get(f"{api_base}/meta", timeout=10.0)
+    if response.status_code == 401 and credentials is not None:
+        try:
+            headers = credentials.headers_for()
+        except Exception:
+            # Una GitHub App sin GITHUB_APP_INSTALLATION_ID necesita un owner para autenticarse
+            headers = None
+        if headers:
+            response = requests.get(f"{api_base}/meta", headers=headers, timeout=10.0)
+    response.raise_for_status()
+
+    version = response.json().get("installed_version") or response.headers.get("X-GitHub-Enterprise-Version")
+    return {
+        "enterprise": True,
+        "url": github_web_url(api_base),
+        "version": version,
+        "supported": bool(version) and parse_version(version) >= parse_version(MIN_GHES_VERSION),
+        "capabilities": capabilities_for(version) if version else {},
+    }
+
+
+def validate_github_server(credentials: Any = None):
+    """
+    Verifica al iniciar que el GHES configurado sea accesible y soporte runners efímeros.
+
+    Raises:
+        ConfigurationError: Si la versión de GHES es anterior a MIN_GHES_VERSION
+    """
+    if not is_enterprise_server():
+        return
+    try:
+        info = server_info(credentials=credentials)
+    except requests.RequestException as e:
+        # Sin conectividad no se puede concluir nada: no bloquear el arranque
+        logger.warning(format_log('WARNING', 'No se pudo consultar GitHub Enterprise Server', str(e)))
+        return
+
+    if not info["version"]:
+        logger.warning(format_log('WARNING', 'Versión de GitHub Enterprise Server desconocida', info["url"]))
+        return
+    if not info["supported"]:
+        raise ConfigurationError(
+            f"GitHub Enterprise Server {info['version']} no soportado: se requiere {MIN_GHES_VERSION} o superior"
+        )
+    unavailable = [name for name, available in info["capabilities"].items() if not available]
+    logger.info(format_log(
+        'CONFIG', 'GitHub Enterprise Server',
+        f"{info['url']} {info['version']}" + (f" (sin {', '.join(unavailable)})" if unavailable else "")
+    ))
@@ -0,0 +1,648 @@
+"""
+Construcción de imágenes de runners y despliegue por canario.
+Cada construcción de IMAGE_BUILDS_FILE parte de una imagen base y un manifiesto de
+herramientas (paquetes apt y comandos de instalación); el orchestrator genera el
+Dockerfile y lo construye con BuildKit (docker buildx) para cada arquitectura en un
+contenedor IMAGE_BUILDER_IMAGE con el socket de Docker, publica la imagen y registra
+el digest del índice y el de cada plataforma.
+
+La imagen nueva llega a los pools de la construcción por pasos (IMAGE_ROLLOUT_STEPS,
+porcentaje de runners nuevos que la usan): cada paso dura al menos
+IMAGE_ROLLOUT_STEP_INTERVAL y necesita IMAGE_ROLLOUT_MIN_RUNNERS runners canario. Si
+la proporción de canarios que no se aprovisionan o no se registran en GitHub supera
+IMAGE_ROLLOUT_MAX_FAILURE_RATE, el despliegue se revierte solo. Al completarse, el pool
+queda fijado al digest (repositorio@sha256:...) entre recargas de la configuración.
+Construcciones, despliegues y fijaciones se persisten en IMAGE_BUILDER_STATE_FILE.
+"""
+
+import collections
+import copy
+import datetime
+import json
+import os
+import random
+import threading
+import time
+import uuid
+from typing import Any, Dict, List, Optional
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.pools import PoolRegistry, RunnerPool
+from src.utils.helpers import ConfigurationError, ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+BUILD_FINISHED = ("succeeded", "failed")
+ROLLOUT_FINISHED = ("completed", "rolled_back", "superseded")
+
+# Fin del heredoc de cada herramienta en el Dockerfile
+HEREDOC = "GHA_TOOL_EOF"
+
+# Dentro del contenedor de construcción: Dockerfile desde el entorno, build multi-arquitectura
+# con push y, en stdout, los metadatos de buildx y el índice publicado
+BUILD_SCRIPT = """set -e
+mkdir -p /tmp/build
+printf '%s' "$DOCKERFILE" > /tmp/build/Dockerfile
+docker buildx inspect gha-image-builder >/dev/null 2>&1 \\
+  || docker buildx create --name gha-image-builder --driver docker-container >/dev/null
+docker buildx build --builder gha-image-builder --progress plain \\
+  --platform "$PLATFORMS" --tag "$IMAGE" --push \\
+  --metadata-file /tmp/build/metadata.json /tmp/build >&2
+echo "=== metadata"
+cat /tmp/build/metadata.json
+echo
+echo "=== manifest"
+docker buildx imagetools inspect --raw "$IMAGE"
+"""
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+def parse_steps(value: Any, name: str) -> List[int]:
+    try:
+        steps = [int(step) for step in (value.split(",") if isinstance(value, str) else value)]
+    except (TypeError, ValueError):
+        raise ConfigurationError(f"{name}: pasos de despliegue inválidos: {value}")
+    if not steps or steps[-1] != 100 or any(step <= 0 for step in steps) or steps != sorted(set(steps)):
+        raise ConfigurationError(f"{name}: los pasos deben ser porcentajes crecientes que terminan en 100: {value}")
+    return steps
+
+
+def rollout_policy(overrides: Optional[Dict[str, Any]] = None, name: str = "IMAGE_ROLLOUT_STEPS") -> Dict[str, Any]:
+    """Política de despliegue por defecto (IMAGE_ROLLOUT_*) con los valores de la construcción."""
+    overrides = overrides or {}
+    policy = {
+        "steps": parse_steps(overrides.get("steps", os.getenv("IMAGE_ROLLOUT_STEPS", "10,50,100")), name),
+        "step_interval": int(overrides.get("step_interval", os.getenv("IMAGE_ROLLOUT_STEP_INTERVAL", "900"))),
+        "min_runners": int(overrides.get("min_runners", os.getenv("IMAGE_ROLLOUT_MIN_RUNNERS", "5"))),
+        "max_failure_rate": float(overrides.get("max_failure_rate", os.getenv("IMAGE_ROLLOUT_MAX_FAILURE_RATE", "0.2"))),
+    }
+    if not 0 <= policy["max_failure_rate"] <= 1:
+        raise ConfigurationError(f"{name}: max_failure_rate debe estar entre 0 y 1")
+    return policy
+
+
+def load_build_specs(path: str) -> Dict[str, Dict[str, Any]]:
+    """
+    Lee IMAGE_BUILDS_FILE (JSON con lista de construcciones o {"builds": [...]}).
+
+    Raises:
+        ConfigurationError: Si el archivo no se puede leer o una construcción es inválida
+    """
+    try:
+        with open(path, "r") as source:
+            data = json.load(source)
+    except (OSError, ValueError) as e:
+        raise ConfigurationError(f"No se pudo leer IMAGE_BUILDS_FILE {path}: {e}")
+    specs = {}
+    for spec in data.get("builds", []) if isinstance(data, dict) else data:
+        name = spec.get("name")
+        if not name or not spec.get("base") or not spec.get("repository"):
+            raise ConfigurationError(f"Construcción de imagen inválida (name, base y repository son obligatorios): {spec}")
+        tools = spec.get("tools") or []
+        for tool in tools:
+            if not tool.get("name") or not tool.get("install"):
+                raise ConfigurationError(f"Construcción {name}: cada herramienta necesita name e install")
+            if any(line.strip() == HEREDOC for line in tool["install"].splitlines()):
+                raise ConfigurationError(f"Construcción {name}: la instalación de {tool['name']} no puede contener {HEREDOC}")
+        specs[name] = {
+            "name": name,
+            "base": spec["base"],
+            "repository": spec["repository"],
+            "platforms": spec.get("platforms") or ["linux/amd64"],
+            "packages": spec.get("packages") or [],
+            "tools": tools,
+            "user": spec.get("user", "runner"),
+            "pools": spec.get("pools") or [],
+            "rollout": rollout_policy(spec.get("rollout"), f"Construcción {name}"),
+        }
+    return specs
+
+
+def render_dockerfile(spec: Dict[str, Any]) -> str:
+    """Dockerfile de la construcción: base, paquetes apt, una capa por herramienta y labels OCI."""
+    lines = ["# syntax=docker/dockerfile:1", f"FROM {spec['base']}", "USER root"]
+    if spec["packages"]:
+        lines.append(
+            "RUN apt-get update && apt-get install -y --no-install-recommends "
+            f"{' '.join(spec['packages'])} && rm -rf /var/lib/apt/lists/*"
+        )
+    for tool in spec["tools"]:
+        version = tool.get("version", "")
+        lines += [
+            f"# {tool['name']} {version}".rstrip(),
+            f'RUN <<"{HEREDOC}"',
+            "set -e",
+            f"export TOOL_VERSION={json.dumps(str(version))}",
+            tool["install"].rstrip("\n"),
+            HEREDOC,
+        ]
+    tools = ",".join(f"{tool['name']}={tool.get('version', '')}".rstrip("=") for tool in spec["tools"])
+    lines += [
+        f"USER {spec['user']}",
+        f"LABEL org.opencontainers.image.base.name={json.dumps(spec['base'])} "
+        f"io.gha-ephemeral.build={json.dumps(spec['name'])} io.gha-ephemeral.tools={json.dumps(tools)}",
+    ]
+    return "\n".join(lines) + "\n"
+
+
+def parse_build_output(output: str) -> Dict[str, Any]:
+    """Digest del índice publicado y de cada plataforma (sin los manifiestos de attestations)."""
+    sections: Dict[str, List[str]] = {}
+    current = None
+    for line in output.splitlines():
+        if line.startswith("=== "):
+            current = line[4:].strip()
+            sections[current] = []
+        elif current:
+            sections[current].append(line)
+    try:
+        metadata = json.loads("\n".join(sections.get("metadata", [])))
+        manifest = json.loads("\n".join(sections.get("manifest", [])))
+    except ValueError as e:
+        raise ValueError(f"Salida de buildx inesperada: {e}")
+    platforms = {}
+    for entry in manifest.get("manifests", []):
+        platform = entry.get("platform") or {}
+        if platform.get("os") in (None, "unknown"):
+            continue
+        name = f"{platform['os']}/{platform.get('architecture')}"
+        if platform.get("variant"):
+            name += f"/{platform['variant']}"
+        platforms[name] = entry["digest"]
+    digest = metadata.get("containerimage.digest")
+    if not digest:
+        raise ValueError("buildx no informó el digest de la imagen")
+    return {"digest": digest, "platform_digests": platforms}
+
+
+class ImageRollouts:
+    """Construcciones registradas, despliegues por canario y pools fijados a un digest."""
+
+    def __init__(self, state_file: str, history: int = 50):
+        self.state_file = state_file
+        self.history = history
+        self.builds: "collections.OrderedDict[str, Dict[str, Any]]" = collections.OrderedDict()
+        self.rollouts: "collections.OrderedDict[str, Dict[str, Any]]" = collections.OrderedDict()
+        # pool -> {"image", "build", "rollout", "pinned_at"}: sobrevive a las recargas de la configuración
+        self.pins: Dict[str, Dict[str, Any]] = {}
+        # runner -> despliegue, para atribuir los fallos de registro a su canario
+        self.canaries: Dict[str, str] = {}
+        self.lock = threading.Lock()
+        self._load_state()
+
+    def _load_state(self):
+        if not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                data = json.load(state)
+            self.builds = collections.OrderedDict((item["id"], item) for item in data.get("builds", []))
+            self.rollouts = collections.OrderedDict((item["id"], item) for item in data.get("rollouts", []))
+            self.pins = data.get("pins", {})
+            # Una construcción que corría al reiniciar ya no tiene contenedor que esperar
+            for build in self.builds.values():
+                if build["status"] not in BUILD_FINISHED:
+                    build.update(status="failed", error="Orchestrator reiniciado durante la construcción", finished_at=_now())
+            logger.info(format_log(
+                'CONFIG', 'Estado de imágenes cargado',
+                f"{len(self.builds)} construcciones, {len(self.active())} despliegues en curso, {len(self.pins)} pools fijados",
+            ))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de imágenes', str(e)))
+
+    def _save_state(self):
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({
+                "builds": list(self.builds.values()),
+                "rollouts": list(self.rollouts.values()),
+                "pins": self.pins,
+            }, state)
+        os.replace(tmp_file, self.state_file)
+
+    @staticmethod
+    def _trim(entries: "collections.OrderedDict[str, Dict[str, Any]]", finished: tuple, history: int):
+        while len(entries) > history:
+            oldest = next((key for key, entry in entries.items() if entry["status"] in finished), None)
+            if oldest is None:
+                break
+            entries.pop(oldest)
+
+    def apply(self, registry: PoolRegistry) -> PoolRegistry:
+        """Fija la imagen de los pools con un despliegue completado."""
+        with self.lock:
+            pins = dict(self.pins)
+        for name, pin in pins.items():
+            pool = registry.pools.get(name) or registry.retired.get(name)
+            if pool:
+                pool.image = pin["image"]
+        return registry
+
+    # ===== Construcciones =====
+
+    def save_build(self, build: Dict[str, Any]):
+        with self.lock:
+            self.builds[build["id"]] = build
+            self._trim(self.builds, BUILD_FINISHED, self.history)
+            self._save_state()
+
+    def get_build(self, build_id: str) -> Dict[str, Any]:
+        with self.lock:
+            build = self.builds.get(build_id)
+            if not build:
+                raise ValueError(f"Construcción de imagen no encontrada: {build_id}")
+            return copy.deepcopy(build)
+
+    def list_builds(self, name: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            builds = [
+                {key: value for key, value in build.items() if key not in ("dockerfile", "log")}
+                for build in self.builds.values() if name is None or build["name"] == name
+            ]
+        return list(reversed(builds))
+
+    # ===== Despliegues =====
+
+    def active(self, pool: Optional[str] = None) -> List[Dict[str, Any]]:
+        return [
+            rollout for rollout in self.rollouts.values()
+            if rollout["status"] == "running" and (pool is None or rollout["pool"] == pool)
+        ]
+
+    def start(self, pool: str, image: str, previous: str, build: Optional[Dict[str, Any]], policy: Dict[str, Any], started_by: str = "") -> Dict[str, Any]:
+        """Empieza a desplegar la imagen en el pool; un despliegue en curso del pool queda reemplazado."""
+        if image == previous:
+            raise ValidationError(f"El pool {pool} ya usa {image}")
+        rollout = {
+            "id": str(uuid.uuid4()),
+            "pool": pool,
+            "image": image,
+            "previous": previous,
+            "build": build["id"] if build else None,
+            "policy": policy,
+            "status": "running",
+            "step": 0,
+            "weight": policy["steps"][0],
+            "started_by": started_by,
+            "started_at": _now(),
+            "step_started": time.time(),
+            "finished_at": None,
+            "reason": None,
+            "canaries": {"runners": 0, "failed": 0},
+            "step_canaries": {"runners": 0, "failed": 0},
+        }
+        with self.lock:
+            for current in self.active(pool):
+                current.update(status="superseded", finished_at=_now(), reason=f"Reemplazado por {rollout['id']}")
+            self.rollouts[rollout["id"]] = rollout
+            self._trim(self.rollouts, ROLLOUT_FINISHED, self.history)
+            self._save_state()
+        logger.info(format_log('INFO', 'Despliegue de imagen iniciado', f"{pool}: {image} al {rollout['weight']}%"))
+        lifecycle_events.emit("image.rollout_started", key=pool, **self._public(rollout))
+        return self._public(rollout)
+
+    def pick(self, pool: str) -> Optional[Dict[str, str]]:
+        """Imagen canario para un runner nuevo del pool según el peso del paso actual (None: la del pool)."""
+        with self.lock:
+            rollouts = self.active(pool)
+            if not rollouts or random.uniform(0, 100) >= rollouts[0]["weight"]:
+                return None
+            return {"rollout": rollouts[0]["id"], "image": rollouts[0]["image"]}
+
+    def record(self, rollout_id: str, runner_id: Optional[str] = None, failed: bool = False):
+        """Resultado del aprovisionamiento de un canario; los fallos de registro llegan después por runner."""
+        with self.lock:
+            rollout = self.rollouts.get(rollout_id)
+            if not rollout or rollout["status"] != "running":
+                return
+            for counters in (rollout["canaries"], rollout["step_canaries"]):
+                counters["runners"] += 1
+                counters["failed"] += int(failed)
+            if runner_id and not failed:
+                self.canaries[runner_id] = rollout_id
+        metrics.incr("images.canary_runners", tags={"pool": rollout["pool"], "result": "failed" if failed else "ok"})
+
+    def record_registration(self, runner_id: str, result: str):
+        """Un canario que no se registró en GitHub (recreado o fallido) cuenta como fallo."""
+        with self.lock:
+            rollout = self.rollouts.get(self.canaries.pop(runner_id, ""))
+            if not rollout or rollout["status"] != "running" or result == "verified":
+                return
+            rollout["canaries"]["failed"] += 1
+            rollout["step_canaries"]["failed"] += 1
+        metrics.incr("images.canary_runners", tags={"pool": rollout["pool"], "result": "unregistered"})
+
+    def advance(self, registry: PoolRegistry) -> List[Dict[str, Any]]:
+        """
+        Una pasada sobre los despliegues en curso: revierte los que superan la tasa de
+        fallos, avanza de paso los que cumplieron su tiempo con suficientes canarios y
+        fija la imagen de los que terminaron el último paso.
+        """
+        changes = []
+        with self.lock:
+            for rollout in self.active():
+                policy, stats = rollout["policy"], rollout["step_canaries"]
+                if stats["runners"] < policy["min_runners"]:
+                    continue
+                failure_rate = stats["failed"] / stats["runners"]
+                if failure_rate > policy["max_failure_rate"]:
+                    self._finish(rollout, "rolled_back", f"Tasa de fallos {failure_rate:.0%} en el paso {rollout['weight']}%")
+                elif time.time() - rollout["step_started"] >= policy["step_interval"]:
+                    if rollout["step"] + 1 < len(policy["steps"]):
+                        rollout["step"] += 1
+                        rollout["weight"] = policy["steps"][rollout["step"]]
+                        rollout["step_started"] = time.time()
+                        rollout["step_canaries"] = {"runners": 0, "failed": 0}
+                    else:
+                        self._finish(rollout, "completed")
+                        self.pins[rollout["pool"]] = {
+                            "image": rollout["image"], "build": rollout["build"], "rollout": rollout["id"], "pinned_at": _now(),
+                        }
+                        pool = registry.pools.get(rollout["pool"])
+                        if pool:
+                            pool.image = rollout["image"]
+                else:
+                    continue
+                changes.append(self._public(rollout))
+            if changes:
+                self._save_state()
+        for rollout in changes:
+            self._announce(rollout)
+        return changes
+
+    def rollback(self, pool: str, registry: PoolRegistry, reason: str = "", requested_by: str = "") -> Dict[str, Any]:
+        """Revierte el despliegue en curso del pool o, si ya se completó, vuelve a la imagen anterior."""
+        reason = reason or f"Revertido por {requested_by or 'un administrador'}"
+        with self.lock:
+            rollouts = self.active(pool)
+            if rollouts:
+                rollout = rollouts[0]
+            else:
+                pin = self.pins.pop(pool, None)
+                rollout = self.rollouts.get(pin["rollout"]) if pin else None
+                if not rollout:
+                    raise ValueError(f"El pool {pool} no tiene un despliegue de imagen que revertir")
+                if pool in registry.pools:
+                    registry.pools[pool].image = rollout["previous"]
+            self._finish(rollout, "rolled_back", reason)
+            self._save_state()
+            result = self._public(rollout)
+        self._announce(result)
+        return result
+
+    def _finish(self, rollout: Dict[str, Any], status: str, reason: Optional[str] = None):
+        rollout.update(status=status, finished_at=_now(), reason=reason)
+        self.canaries = {runner: rollout_id for runner, rollout_id in self.canaries.items() if rollout_id != rollout["id"]}
+
+    def _announce(self, rollout: Dict[str, Any]):
+        detail = f"{rollout['pool']}: {rollout['image']}"
+        if rollout["status"] == "rolled_back":
+            logger.warning(format_log('WARNING', 'Despliegue de imagen revertido', f"{detail} ({rollout['reason']})"))
+            lifecycle_events.emit("image.rollout_rolled_back", key=rollout["pool"], **rollout)
+        elif rollout["status"] == "completed":
+            logger.info(format_log('SUCCESS', 'Despliegue de imagen completado', detail))
+            lifecycle_events.emit("image.rollout_completed", key=rollout["pool"], **rollout)
+        else:
+            logger.info(format_log('INFO', 'Despliegue de imagen avanza', f"{detail} al {rollout['weight']}%"))
+            lifecycle_events.emit("image.rollout_advanced", key=rollout["pool"], **rollout)
+        metrics.incr("images.rollouts", tags={"pool": rollout["pool"], "status": rollout["status"]})
+
+    @staticmethod
+    def _public(rollout: Dict[str, Any]) -> Dict[str, Any]:
+        return copy.deepcopy({key: value for key, value in rollout.items() if key != "step_started"})
+
+    def list_rollouts(self, pool: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            rollouts = [self._public(rollout) for rollout in self.rollouts.values() if pool is None or rollout["pool"] == pool]
+        return list(reversed(rollouts))
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "builds_running": sum(1 for build in self.builds.values() if build["status"] not in BUILD_FINISHED),
+                "rollouts": {rollout["pool"]: rollout["weight"] for rollout in self.active()},
+                "pinned": {pool: pin["image"] for pool, pin in self.pins.items()},
+            }
+
+
+class ImageBuilder:
+    """Ejecuta las construcciones en segundo plano y avanza los despliegues cada check_interval."""
+
+    def __init__(
+        self,
+        lifecycle_manager: Any,
+        rollouts: ImageRollouts,
+        specs_file: Optional[str],
+        builder_image: str = "docker:27-cli",
+        docker_config: Optional[str] = None,
+        timeout: int = 3600,
+        check_interval: int = 30,
+    ):
+        self.lifecycle_manager = lifecycle_manager
+        self.rollouts = rollouts
+        self.specs_file = specs_file
+        self.builder_image = builder_image
+        self.docker_config = docker_config
+        self.timeout = timeout
+        self.check_interval = check_interval
+        # Las construcciones comparten el builder de BuildKit: una a la vez
+        self.build_lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def specs(self) -> Dict[str, Dict[str, Any]]:
+        """Construcciones de IMAGE_BUILDS_FILE; se lee en cada uso para no exigir recarga."""
+        if not self.specs_file:
+            return {}
+        return load_build_specs(self.specs_file)
+
+    def start(self):
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Despliegues de imágenes iniciados', f'cada {self.check_interval}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.check_interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.rollouts.advance(self.lifecycle_manager.pools)
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error avanzando despliegues de imágenes', str(e)))
+
+    # ===== Construcción =====
+
+    def submit(self, name: str, requested_by: str = "", rollout: bool = True, pools: Optional[List[str]] = None, build_id: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Lanza una construcción de IMAGE_BUILDS_FILE en segundo plano.
+
+        Raises:
+            ValidationError: Si la construcción no existe o un pool no está configurado
+        """
+        spec = self.specs().get(name)
+        if not spec:
+            raise ValidationError(f"Construcción de imagen desconocida: {name} ({', '.join(self.specs()) or 'ninguna'})")
+        pools = spec["pools"] if pools is None else pools
+        for pool in pools:
+            self.lifecycle_manager.pools.get(pool)
+        tag = f"{name}-{datetime.datetime.now(datetime.timezone.utc).strftime('%Y%m%d%H%M%S')}"
+        build = {
+            "id": build_id or str(uuid.uuid4()),
+            "name": name,
+            "base": spec["base"],
+            "repository": spec["repository"],
+            "image": f"{spec['repository']}:{tag}",
+            "platforms": spec["platforms"],
+            "tools": {tool["name"]: tool.get("version") for tool in spec["tools"]},
+            "pools": pools if rollout else [],
+            "rollout_policy": spec["rollout"],
+            "status": "queued",
+            "requested_by": requested_by,
+            "requested_at": _now(),
+            "started_at": None,
+            "finished_at": None,
+            "digest": None,
+            "platform_digests": {},
+            "error": None,
+            "dockerfile": render_dockerfile(spec),
+            "log": [],
+        }
+        self.rollouts.save_build(build)
+        logger.info(format_log('INFO', 'Construcción de imagen enviada', f"{name} ({build['id']}) por {requested_by or '-'}"))
+        threading.Thread(target=self._run, args=(build,), daemon=True).start()
+        return {key: value for key, value in build.items() if key not in ("dockerfile", "log")}
+
+    def _run(self, build: Dict[str, Any]):
+        with self.build_lock:
+            build.update(status="running", started_at=_now())
+            self.rollouts.save_build(build)
+            started = time.monotonic()
+            log: List[str] = []
+            try:
+                output, log = self._buildx(build)
+                build.update(parse_build_output(output))
+                build["status"] = "succeeded"
+            except Exception as e:
+                build.update(status="failed", error=str(e))
+                log = getattr(e, "log", log)
+            build.update(finished_at=_now(), log=log[-200:])
+            self.rollouts.save_build(build)
+        metrics.timing("images.build_duration", (time.monotonic() - started) * 1000, tags={"build": build["name"]})
+        metrics.incr("images.builds", tags={"build": build["name"], "result": build["status"]})
+        summary = {key: value for key, value in build.items() if key not in ("dockerfile", "log")}
+        lifecycle_events.emit("image.build_finished", key=build["name"], **summary)
+        if build["status"] == "failed":
+            logger.error(format_log('ERROR', f"Construcción de imagen {build['name']} fallida", build["error"]))
+            return
+
+        logger.info(format_log('SUCCESS', 'Imagen construida', f"{build['repository']}@{build['digest']} ({', '.join(build['platform_digests'])})"))
+        for pool in build["pools"]:
+            try:
+                self.start_rollout(pool, build["id"], build["requested_by"])
+            except Exception as e:
+                logger.error(format_log('ERROR', f'No se pudo desplegar la imagen en el pool {pool}', str(e)))
+
+    def _buildx(self, build: Dict[str, Any]):
+        """Ejecuta BUILD_SCRIPT en un contenedor con el socket de Docker; devuelve stdout y el log de buildx."""
+        client = self.lifecycle_manager.container_manager.client
+        volumes = {"/var/run/docker.sock": {"bind": "/var/run/docker.sock", "mode": "rw"}}
+        if self.docker_config:
+            # Credenciales para publicar en el registro de la construcción
+            volumes[self.docker_config] = {"bind": "/root/.docker/config.json", "mode": "ro"}
+        container = client.containers.run(
+            self.builder_image,
+            entrypoint=["sh", "-c", BUILD_SCRIPT],
+            environment={"DOCKERFILE": build["dockerfile"], "PLATFORMS": ",".join(build["platforms"]), "IMAGE": build["image"]},
+            volumes=volumes,
+            labels={"gha-image-build": build["id"]},
+            name=f"gha-image-build-{build['id'][:8]}",
+            detach=True,
+        )
+        try:
+            try:
+                result = container.wait(timeout=self.timeout)
+            except Exception:
+                container.kill()
+                raise TimeoutError(f"La construcción superó IMAGE_BUILD_TIMEOUT ({self.timeout}s)")
+            output = container.logs(stdout=True, stderr=False).decode(errors="replace")
+            log = container.logs(stdout=False, stderr=True).decode(errors="replace").splitlines()
+        finally:
+            try:
+                container.remove(force=True)
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo eliminar el contenedor de construcción', str(e)))
+        if result.get("StatusCode") != 0:
+            error = RuntimeError(f"buildx terminó con código {result.get('StatusCode')}: {log[-1] if log else 'sin salida'}")
+            error.log = log
+            raise error
+        return output, log
+
+    # ===== Despliegue =====
+
+    def start_rollout(self, pool: str, build_id: str, started_by: str = "") -> Dict[str, Any]:
+        """Despliega por pasos en el pool la imagen (por digest) de una construcción terminada."""
+        build = self.rollouts.get_build(build_id)
+        if build["status"] != "succeeded":
+            raise ValidationError(f"La construcción {build_id} no terminó correctamente ({build['status']})")
+        runner_pool = self.lifecycle_manager.pools.get(pool)
+        if runner_pool.backend in ("ssh", "azure", "gce"):
+            raise ValidationError(f"El pool {pool} usa el backend {runner_pool.backend}, sin imagen de contenedor")
+        previous = runner_pool.image or self.lifecycle_manager.container_manager.runner_image
+        image = f"{build['repository']}@{build['digest']}"
+        return self.rollouts.start(runner_pool.name, image, previous, build, build["rollout_policy"], started_by)
+
+    def status(self) -> Dict[str, Any]:
+        return {"builder_image": self.builder_image, **self.rollouts.status()}
+
+
+def canary_pool(pool: RunnerPool) -> Optional[Dict[str, Any]]:
+    """Copia del pool con la imagen canario si el runner nuevo entra en el despliegue en curso."""
+    if not image_rollouts:
+        return None
+    canary = image_rollouts.pick(pool.name)
+    if not canary:
+        return None
+    clone = copy.copy(pool)
+    clone.image = canary["image"]
+    return {"rollout": canary["rollout"], "pool": clone}
+
+
+def create_image_rollouts() -> Optional[ImageRollouts]:
+    """Estado de construcciones y despliegues si IMAGE_BUILDER_STATE_FILE está definido."""
+    state_file = os.getenv("IMAGE_BUILDER_STATE_FILE")
+    if not state_file:
+        return None
+    directory = os.path.dirname(state_file)
+    if directory:
+        os.makedirs(directory, exist_ok=True)
+    return ImageRollouts(state_file, history=int(os.getenv("IMAGE_BUILD_HISTORY", "50")))
+
+
+def create_image_builder(lifecycle_manager: Any) -> Optional[ImageBuilder]:
+    if not image_rollouts:
+        return None
+    rollout_policy()
+    return ImageBuilder(
+        lifecycle_manager,
+        image_rollouts,
+        os.getenv("IMAGE_BUILDS_FILE"),
+        builder_image=os.getenv("IMAGE_BUILDER_IMAGE", "docker:27-cli"),
+        docker_config=os.getenv("IMAGE_BUILDER_DOCKER_CONFIG"),
+        timeout=int(os.getenv("IMAGE_BUILD_TIMEOUT", "3600")),
+        check_interval=int(os.getenv("IMAGE_ROLLOUT_CHECK_INTERVAL", "30")),
+    )
+
+
+image_rollouts = create_image_rollouts()
@@ -0,0 +1,383 @@
+"""
+Pre-descarga de imágenes de runners.
+Con IMAGE_PREPULL_ENABLED, el orchestrator descarga las imágenes de los pools Docker
+en el Docker local, en los hosts del inventario SSH (IMAGE_PREPULL_SSH_HOSTS) y en los
+nodos de Kubernetes mediante un DaemonSet (IMAGE_PREPULL_K8S_NAMESPACE) cada vez que
+cambian las referencias de imagen de los pools, y las vuelve a descargar cada
+IMAGE_PREPULL_REFRESH_INTERVAL para seguir a los tags que se mueven. Así el arranque de
+un job no queda dominado por la descarga de la imagen.
+
+Con IMAGE_PREPULL_PIN, cada imagen queda fijada por un contenedor creado y nunca
+iniciado (label gha-prepull=true), para que `docker image prune -a` no la elimine.
+"""
+
+import hashlib
+import os
+import shlex
+import threading
+import time
+from typing import Any, Callable, Dict, List, Optional
+
+import requests
+from src.services.metrics import metrics
+from src.services.preemption import SERVICE_ACCOUNT_DIR
+from src.utils.helpers import ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+PIN_LABEL = "gha-prepull"
+
+
+def pin_name(image: str) -> str:
+    """Nombre del contenedor que fija la imagen: estable por referencia."""
+    return f"{PIN_LABEL}-{hashlib.sha256(image.encode()).hexdigest()[:12]}"
+
+
+def images_hash(images: List[str]) -> str:
+    return hashlib.sha256("\n".join(sorted(images)).encode()).hexdigest()[:12]
+
+
+class LocalDockerTarget:
+    """Docker del propio orchestrator o un host de DOCKER_HOSTS_FILE; usa la referencia del mirror si el pool lo tiene."""
+
+    def __init__(self, client: Any, pin: bool = True, name: str = "docker"):
+        self.client = client
+        self.pin = pin
+        self.name = name
+
+    def sync(self, images: List[str]) -> Dict[str, Any]:
+        failed = {}
+        for image in images:
+            try:
+                pulled = self.client.images.pull(image)
+                if self.pin:
+                    self._pin(image, pulled)
+            except Exception as e:
+                failed[image] = str(e)
+        if self.pin:
+            self._unpin(images)
+        return failed
+
+    def _pin(self, image: str, pulled: Any):
+        name = pin_name(image)
+        try:
+            container = self.client.containers.get(name)
+            # Tag movido: el contenedor fija la imagen anterior, recrearlo con la nueva
+            if container.image.id == pulled.id:
+                return
+            container.remove(force=True)
+        except Exception:
+            pass
+        self.client.containers.create(image, command="true", name=name, labels={PIN_LABEL: "true", f"{PIN_LABEL}.image": image})
+
+    def _unpin(self, images: List[str]):
+        keep = {pin_name(image) for image in images}
+        for container in self.client.containers.list(all=True, filters={"label": f"{PIN_LABEL}=true"}):
+            if container.name not in keep:
+                try:
+                    container.remove(force=True)
+                except Exception as e:
+                    logger.warning(format_log('WARNING', 'No se pudo liberar imagen fijada', f"{container.name}: {e}"))
+
+
+class SSHDockerTarget:
+    """Hosts Docker del inventario SSH; `docker pull` por la misma conexión que usa el backend ssh."""
+
+    name = "ssh"
+
+    def __init__(self, backend: Any, selectors: List[str], pin: bool = True):
+        self.backend = backend
+        # "all" selecciona todos los hosts del inventario
+        self.selectors = None if "all" in selectors else selectors
+        self.pin = pin
+
+    def script(self, images: List[str]) -> str:
+        lines = ["status=0"]
+        for image in images:
+            quoted = shlex.quote(image)
+            pin = "    :\n"
+            if self.pin:
+                name = pin_name(image)
+                pin = (
+                    f"    docker rm -f {name} >/dev/null 2>&1\n"
+                    f"    docker create --name {name} --label {PIN_LABEL}=true {quoted} true >/dev/null || status=1\n"
+                )
+            lines.append(
+                f"if docker pull -q {quoted} >/dev/null; then\n{pin}"
+                f"else\n    echo {shlex.quote('pull ' + image)} >&2; status=1\nfi"
+            )
+        if self.pin:
+            keep = " ".join(pin_name(image) for image in images)
+            lines.append(
+                f"for n in $(docker ps -a --filter label={PIN_LABEL}=true --format '{{{{.Names}}}}'); do\n"
+                f"    case \" {keep} \" in *\" $n \"*) ;; *) docker rm -f \"$n\" >/dev/null ;; esac\n"
+                f"done"
+            )
+        lines.append("exit $status")
+        return "\n".join(lines)
+
+    def sync(self, images: List[str]) -> Dict[str, Any]:
+        failed = {}
+        script = self.script(images)
+        for host in self.backend.hosts.values():
+            if self.selectors is not None and not host.matches(self.selectors):
+                continue
+            try:
+                self.backend._run(host, script, timeout=1800)
+            except Exception as e:
+                failed[host.name] = str(e)
+        return failed
+
+
+class KubernetesDaemonSetTarget:
+    """
+    DaemonSet con un init container por imagen (ejecuta `true`) y un contenedor pause.
+
+    El kubelet descarga las imágenes al programar el pod en cada nodo y, al ser
+    contenedores de un pod vivo, su recolector de imágenes no las elimina.
+    """
+
+    name = "kubernetes"
+
+    def __init__(
+        self,
+        namespace: str,
+        name: str = "gha-runner-prepull",
+        node_selector: Optional[Dict[str, str]] = None,
+        pause_image: str = "registry.k8s.io/pause:3.9",
+        api: str = "https://kubernetes.default.svc",
+    ):
+        self.namespace = namespace
+        self.daemonset = name
+        self.node_selector = node_selector or {}
+        self.pause_image = pause_image
+        self.api = api.rstrip("/")
+
+    def manifest(self, images: List[str], refreshed: int) -> Dict[str, Any]:
+        labels = {"app.kubernetes.io/name": self.daemonset, "app.kubernetes.io/managed-by": "gha-ephemeral-runners"}
+        init_containers = [
+            {
+                "name": f"image-{index}",
+                "image": image,
+                "command": ["sh", "-c", "true"],
+                # Always: cada rollout vuelve a resolver los tags que se mueven
+                "imagePullPolicy": "Always",
+                "resources": {"requests": {"cpu": "1m", "memory": "8Mi"}},
+            }
+            for index, image in enumerate(images)
+        ]
+        return {
+            "apiVersion": "apps/v1",
+            "kind": "DaemonSet",
+            "metadata": {"name": self.daemonset, "namespace": self.namespace, "labels": labels},
+            "spec": {
+                "selector": {"matchLabels": {"app.kubernetes.io/name": self.daemonset}},
+                "updateStrategy": {"type": "RollingUpdate", "rollingUpdate": {"maxUnavailable": "100%"}},
+                "template": {
+                    "metadata": {
+                        "labels": labels,
+                        "annotations": {
+                            "gha-runners/images": images_hash(images),
+                            "gha-runners/refreshed": str(refreshed),
+                        },
+                    },
+                    "spec": {
+                        "nodeSelector": self.node_selector,
+                        "tolerations": [{"operator": "Exists"}],
+                        "terminationGracePeriodSeconds": 0,
+                        "automountServiceAccountToken": False,
+                        "initContainers": init_containers,
+                        "containers": [{
+                            "name": "pause",
+                            "image": self.pause_image,
+                            "resources": {"requests": {"cpu": "1m", "memory": "8Mi"}},
+                        }],
+                    },
+                },
+            },
+        }
+
+    def _request(self, method: str, path: str, body: Optional[Dict[str, Any]] = None) -> requests.Response:
+        with open(os.path.join(SERVICE_ACCOUNT_DIR, "token")) as f:
+            token = f.read().strip()
+        return requests.request(
+            method,
+            f"{self.api}/apis/apps/v1/namespaces/{self.namespace}/daemonsets{path}",
+            json=body,
+            headers={"Authorization": f"Bearer {token}"},
+            verify=os.path.join(SERVICE_ACCOUNT_DIR, "ca.crt"),
+            timeout=15,
+        )
+
+    def sync(self, images: List[str]) -> Dict[str, Any]:
+        manifest = self.manifest(images, int(time.time()))
+        current = self._request("GET", f"/{self.daemonset}")
+        if current.status_code == 404:
+            response = self._request("POST", "", manifest)
+        else:
+            current.raise_for_status()
+            manifest["metadata"]["resourceVersion"] = current.json()["metadata"]["resourceVersion"]
+            response = self._request("PUT", f"/{self.daemonset}", manifest)
+        if response.status_code >= 400:
+            return {self.daemonset: f"HTTP {response.status_code}: {redactor.redact(response.text)[:300]}"}
+        return {}
+
+
+class ImagePrePuller:
+    """Sincroniza las imágenes de los pools en todos los destinos cuando cambian o caduca el refresco."""
+
+    def __init__(
+        self,
+        images: Callable[[], Dict[str, List[str]]],
+        targets: List[Any],
+        check_interval: int = 30,
+        refresh_interval: int = 3600,
+    ):
+        # images() -> {destino: [imágenes]}; el Docker local puede usar referencias del mirror
+        self.images = images
+        self.targets = targets
+        self.check_interval = check_interval
+        self.refresh_interval = refresh_interval
+        self.synced: Dict[str, str] = {}
+        self.last_sync: Dict[str, float] = {}
+        self.failed: Dict[str, Dict[str, Any]] = {}
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'SUCCESS', 'Pre-descarga de imágenes iniciada',
+            f"{', '.join(target.name for target in self.targets)} cada {self.refresh_interval}s"
+        ))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error en la pre-descarga de imágenes', str(e)))
+            # Dormir en tramos cortos para que stop() no espere todo el intervalo
+            deadline = time.time() + self.check_interval
+            while self.running and time.time() < deadline:
+                time.sleep(1)
+
+    def check(self):
+        """Sincroniza los destinos cuyas imágenes cambiaron o cuyo refresco venció."""
+        images = self.images()
+        for target in self.targets:
+            wanted = sorted(set(images[target.name] if target.name in images else images.get("*") or []))
+            digest = images_hash(wanted)
+            changed = self.synced.get(target.name) != digest
+            if not changed and time.time() - self.last_sync.get(target.name, 0) < self.refresh_interval:
+                continue
+            started = time.time()
+            try:
+                failed = target.sync(wanted)
+            except Exception as e:
+                failed = {"error": str(e)}
+            self.last_sync[target.name] = time.time()
+            self.failed[target.name] = failed
+            metrics.timing(f"image_prepull.{target.name}.duration", (time.time() - started) * 1000)
+            if failed:
+                # Sin marcar como sincronizado: se reintenta en la siguiente comprobación
+                self.synced.pop(target.name, None)
+                metrics.incr(f"image_prepull.{target.name}.failures")
+                logger.warning(format_log(
+                    'WARNING', f'Pre-descarga incompleta en {target.name}',
+                    "; ".join(f"{key}: {value}" for key, value in failed.items())
+                ))
+            else:
+                self.synced[target.name] = digest
+                logger.info(format_log(
+                    'DOCKER', f'Imágenes pre-descargadas en {target.name}',
+                    f"{len(wanted)} imágenes" + (" (cambio en los pools)" if changed else "")
+                ))
+
+    def status(self) -> Dict[str, Any]:
+        return {
+            target.name: {
+                "images_hash": self.synced.get(target.name),
+                "last_sync": int(self.last_sync[target.name]) if target.name in self.last_sync else None,
+                "failed": self.failed.get(target.name) or {},
+            }
+            for target in self.targets
+        }
+
+
+def pool_images(pools: Any, container_manager: Any) -> Dict[str, List[str]]:
+    """
+    Imágenes de los pools con backend docker; el Docker local y los hosts de
+    DOCKER_HOSTS_FILE usan la del mirror si aplica (cada host, solo las de sus pools).
+    """
+    local, remote = [], []
+    hosts = container_manager.docker_hosts
+    by_host: Dict[str, List[str]] = {name: [] for name in (hosts.hosts if hosts else {})}
+    mirror = container_manager.registry_mirror
+    for pool in pools.pools.values():
+        if pool.backend != "docker":
+            continue
+        image = pool.image or container_manager.runner_image
+        remote.append(image)
+        local.append(mirror.mirrored(image) if pool.registry_mirror else image)
+        for host in (hosts.hosts.values() if hosts else []):
+            if host.matches(pool.docker_hosts):
+                by_host[host.name].append(local[-1])
+    return {"docker": local, "*": remote, **by_host}
+
+
+def parse_node_selector(value: str) -> Dict[str, str]:
+    """IMAGE_PREPULL_K8S_NODE_SELECTOR: clave=valor,clave=valor."""
+    selector = {}
+    for item in value.split(","):
+        if not item.strip():
+            continue
+        key, sep, val = item.partition("=")
+        if not sep or not key.strip():
+            raise ConfigurationError(f"IMAGE_PREPULL_K8S_NODE_SELECTOR inválido: '{item.strip()}' (clave=valor)")
+        selector[key.strip()] = val.strip()
+    return selector
+
+
+def create_image_prepuller(lifecycle_manager: Any) -> Optional[ImagePrePuller]:
+    """Pre-descarga desde IMAGE_PREPULL_ENABLED, o None si no está activada."""
+    if os.getenv("IMAGE_PREPULL_ENABLED", "false").lower() != "true":
+        return None
+    container_manager = lifecycle_manager.container_manager
+    pin = os.getenv("IMAGE_PREPULL_PIN", "true").lower() == "true"
+    targets: List[Any] = [LocalDockerTarget(container_manager.client, pin=pin)]
+    if container_manager.docker_hosts:
+        hosts = container_manager.docker_hosts
+        targets += [LocalDockerTarget(hosts.client(host), pin=pin, name=host.name) for host in hosts.hosts.values()]
+
+    ssh_hosts = [host.strip() for host in os.getenv("IMAGE_PREPULL_SSH_HOSTS", "").split(",") if host.strip()]
+    if ssh_hosts:
+        backend = container_manager.backends.get("ssh")
+        if not backend:
+            raise ConfigurationError("IMAGE_PREPULL_SSH_HOSTS requiere SSH_HOSTS_FILE")
+        targets.append(SSHDockerTarget(backend, ssh_hosts, pin=pin))
+
+    namespace = os.getenv("IMAGE_PREPULL_K8S_NAMESPACE")
+    if namespace:
+        targets.append(KubernetesDaemonSetTarget(
+            namespace,
+            name=os.getenv("IMAGE_PREPULL_K8S_DAEMONSET", "gha-runner-prepull"),
+            node_selector=parse_node_selector(os.getenv("IMAGE_PREPULL_K8S_NODE_SELECTOR", "")),
+            pause_image=os.getenv("IMAGE_PREPULL_K8S_PAUSE_IMAGE", "registry.k8s.io/pause:3.9"),
+        ))
+
+    return ImagePrePuller(
+        lambda: pool_images(lifecycle_manager.pools, container_manager),
+        targets,
+        check_interval=int(os.getenv("IMAGE_PREPULL_CHECK_INTERVAL", "30")),
+        refresh_interval=int(os.getenv("IMAGE_PREPULL_REFRESH_INTERVAL", "3600")),
+    )
@@ -0,0 +1,274 @@
+"""
+Incidentes en PagerDuty (Events API v2) u Opsgenie para condiciones críticas:
+backend de aprovisionamiento (Docker) inaccesible o ningún runner sano para un label
+requerido. Cada condición usa una clave de deduplicación estable, de modo que se
+abre un único incidente mientras dure y se resuelve al desaparecer.
+"""
+
+import os
+import queue
+import socket
+import threading
+import time
+from typing import Any, Dict, List, Optional
+from urllib.parse import quote
+
+import requests
+from src.services.metrics import metrics
+from src.services.retries import retry_budgets
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+DEDUP_PREFIX = "gha-runners"
+
+# Severidades de PagerDuty y su prioridad equivalente en Opsgenie
+OPSGENIE_PRIORITIES = {"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}
+
+
+def dedup_key(condition: str, subject: str = "") -> str:
+    """Clave de deduplicación: gha-runners:<condición>[:<sujeto>]."""
+    return ":".join(part for part in (DEDUP_PREFIX, condition, subject) if part)
+
+
+class PagerDutyBackend:
+    """PagerDuty Events API v2: dedup_key agrupa trigger y resolve del mismo incidente."""
+
+    name = "pagerduty"
+
+    def __init__(self, routing_key: str, url: str = "https://events.pagerduty.com/v2/enqueue"):
+        self.routing_key = routing_key
+        self.url = url
+
+    def send(self, action: str, incident: Dict[str, Any]):
+        body: Dict[str, Any] = {"routing_key": self.routing_key, "event_action": action, "dedup_key": incident["key"]}
+        if action == "trigger":
+            body["payload"] = {
+                "summary": incident["summary"],
+                "source": incident["source"],
+                "severity": incident["severity"],
+                "component": incident["condition"],
+                "custom_details": incident["details"],
+            }
+        requests.post(self.url, json=body, timeout=10).raise_for_status()
+
+
+class OpsgenieBackend:
+    """Opsgenie Alert API: el alias de la alerta es la clave de deduplicación."""
+
+    name = "opsgenie"
+
+    def __init__(self, api_key: str, url: str = "https://api.opsgenie.com"):
+        self.api_key = api_key
+        self.url = url.rstrip("/")
+
+    def send(self, action: str, incident: Dict[str, Any]):
+        headers = {"Authorization": f"GenieKey {self.api_key}"}
+        if action == "trigger":
+            response = requests.post(f"{self.url}/v2/alerts", headers=headers, timeout=10, json={
+                "message": incident["summary"][:130],
+                "alias": incident["key"],
+                "source": incident["source"],
+                "priority": OPSGENIE_PRIORITIES.get(incident["severity"], "P3"),
+                "tags": ["gha-ephemeral-runners", incident["condition"]],
+                "details": {key: str(value) for key, value in incident["details"].items()},
+            })
+        else:
+            response = requests.post(
+                f"{self.url}/v2/alerts/{quote(incident['key'], safe='')}/close",
+                params={"identifierType": "alias"}, headers=headers, timeout=10,
+                json={"source": incident["source"]},
+            )
+        response.raise_for_status()
+
+
+class IncidentNotifier:
+    """
+    Incidentes abiertos y su envío en segundo plano.
+
+    trigger() y resolve() solo notifican en los cambios de estado, así que pueden
+    llamarse en cada comprobación; el envío nunca bloquea a quien las invoca.
+    """
+
+    def __init__(self, backend: Optional[Any], source: str):
+        self.backend = backend
+        self.source = source
+        self.open: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self.queue: "queue.Queue[tuple]" = queue.Queue(maxsize=1000)
+
+        if self.backend:
+            threading.Thread(target=self._delivery_loop, daemon=True).start()
+            logger.info(format_log('CONFIG', 'Incidentes activados', f"{self.backend.name} ({self.source})"))
+
+    def trigger(self, condition: str, subject: str, summary: str, severity: str = "critical", **details: Any):
+        key = dedup_key(condition, subject)
+        with self.lock:
+            if key in self.open:
+                return
+            incident = {
+                "key": key, "condition": condition, "summary": summary, "severity": severity,
+                "source": self.source, "details": details, "opened_at": time.time(),
+            }
+            self.open[key] = incident
+        logger.error(format_log('ERROR', 'Incidente abierto', f"{key}: {summary}"))
+        metrics.incr("incidents.triggered", tags={"condition": condition})
+        self._enqueue("trigger", incident)
+
+    def resolve(self, condition: str, subject: str = ""):
+        key = dedup_key(condition, subject)
+        with self.lock:
+            incident = self.open.pop(key, None)
+        if incident is None:
+            return
+        logger.info(format_log('SUCCESS', 'Incidente resuelto', key))
+        metrics.incr("incidents.resolved", tags={"condition": condition})
+        self._enqueue("resolve", incident)
+
+    def list_open(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return [dict(incident) for incident in self.open.values()]
+
+    def _enqueue(self, action: str, incident: Dict[str, Any]):
+        if not self.backend:
+            return
+        try:
+            self.queue.put_nowait((action, incident))
+        except queue.Full:
+            metrics.incr("incidents.dropped")
+
+    def _delivery_loop(self):
+        while True:
+            action, incident = self.queue.get()
+            try:
+                retry_budgets.get("incidents").call(
+                    lambda: self.backend.send(action, incident),
+                    retry_error=lambda e: isinstance(e, requests.RequestException),
+                )
+            except requests.RequestException as e:
+                metrics.incr("incidents.failed")
+                logger.warning(format_log(
+                    'WARNING', 'No se pudo notificar incidente', f"{action} {incident['key']} en {self.backend.name}: {e}"
+                ))
+
+
+class IncidentMonitor:
+    """
+    Evalúa periódicamente las condiciones críticas del orchestrator:
+
+    - backend-unreachable: Docker no responde en `backend_failures` comprobaciones seguidas
+    - no-healthy-runners:<label>: ningún runner en ejecución lleva un label de `required_labels`
+      durante más de `grace` segundos
+    """
+
+    def __init__(
+        self,
+        notifier: IncidentNotifier,
+        lifecycle_manager: Any,
+        required_labels: List[str],
+        interval: int = 30,
+        grace: int = 300,
+        backend_failures: int = 3,
+    ):
+        self.notifier = notifier
+        self.lifecycle_manager = lifecycle_manager
+        self.required_labels = required_labels
+        self.interval = interval
+        self.grace = grace
+        self.backend_failures = backend_failures
+        self.failures = 0
+        # Desde cuándo no hay runners sanos para cada label
+        self.missing_since: Dict[str, float] = {}
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'SUCCESS', 'Monitor de incidentes iniciado',
+            f"cada {self.interval}s, labels requeridos: {', '.join(self.required_labels) or 'ninguno'}"
+        ))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error evaluando incidentes', str(e)))
+            time.sleep(self.interval)
+
+    def check(self):
+        container_manager = self.lifecycle_manager.container_manager
+        try:
+            container_manager.client.ping()
+        except Exception as e:
+            self.failures += 1
+            if self.failures >= self.backend_failures:
+                self.notifier.trigger(
+                    "backend-unreachable", socket.gethostname(),
+                    f"Docker inaccesible en {socket.gethostname()}: no se pueden aprovisionar runners",
+                    error=str(e), consecutive_failures=self.failures,
+                )
+            # Sin Docker no se puede saber qué runners hay: no se evalúan los labels
+            return
+        self.failures = 0
+        self.notifier.resolve("backend-unreachable", socket.gethostname())
+
+        if self.required_labels:
+            self._check_labels(container_manager.get_runner_containers())
+
+    def _check_labels(self, containers: List[Any]):
+        healthy: Dict[str, int] = {}
+        for container in containers:
+            try:
+                pool = self.lifecycle_manager.pools.get((container.labels or {}).get("runner-pool"))
+            except ValueError:
+                # Pool eliminado tras recargar la configuración
+                continue
+            for label in {pool.name, *pool.labels}:
+                healthy[label] = healthy.get(label, 0) + 1
+
+        now = time.time()
+        for label in self.required_labels:
+            if healthy.get(label):
+                self.missing_since.pop(label, None)
+                self.notifier.resolve("no-healthy-runners", label)
+                continue
+            since = self.missing_since.setdefault(label, now)
+            if now - since >= self.grace:
+                self.notifier.trigger(
+                    "no-healthy-runners", label,
+                    f"Sin runners sanos para el label '{label}' desde hace {int(now - since)}s",
+                    label=label, missing_seconds=int(now - since),
+                )
+
+
+def create_incident_backend() -> Optional[Any]:
+    """Backend de INCIDENTS_BACKEND (pagerduty u opsgenie), o None si está desactivado."""
+    backend = os.getenv("INCIDENTS_BACKEND", "").strip()
+    if not backend:
+        return None
+    if backend == "pagerduty":
+        routing_key = os.getenv("PAGERDUTY_ROUTING_KEY")
+        if not routing_key:
+            raise ConfigurationError("PAGERDUTY_ROUTING_KEY es obligatorio con INCIDENTS_BACKEND=pagerduty")
+        return PagerDutyBackend(routing_key)
+    if backend == "opsgenie":
+        api_key = os.getenv("OPSGENIE_API_KEY")
+        if not api_key:
+            raise ConfigurationError("OPSGENIE_API_KEY es obligatorio con INCIDENTS_BACKEND=opsgenie")
+        return OpsgenieBackend(api_key, os.getenv("OPSGENIE_API_URL", "https://api.opsgenie.com"))
+    raise ConfigurationError(f"INCIDENTS_BACKEND desconocido: {backend} (pagerduty u opsgenie)")
+
+
+# Notificador compartido por los módulos del orchestrator
+incidents = IncidentNotifier(create_incident_backend(), source="orchestrator")
@@ -0,0 +1,167 @@
+"""
+Selección del tipo de máquina por precio para los pools gce y azure.
+Con "selection" en las opciones gce o azure, el machine type (o vm_size) de cada VM
+se elige entre una lista de candidatos: se descartan los que no existen en la zona o
+región o no cumplen la CPU, memoria y arquitectura mínimas, y el resto se prueba del
+más barato al más caro ("order": "list" mantiene el orden de la lista). Si no hay
+capacidad para uno, el backend prueba el siguiente antes de cambiar de zona.
+
+Los precios por hora salen de las APIs públicas de cada proveedor (Azure Retail Prices
+y Cloud Billing Catalog), con el precio spot en los pools spot, y se reutilizan
+INSTANCE_PRICING_TTL segundos. INSTANCE_PRICES_FILE fija precios propios (descuentos
+negociados) por encima de los de la API. Sin precios se usa el orden de la lista.
+"""
+
+import json
+import os
+import threading
+import time
+from typing import Any, Dict, List, NamedTuple, Optional, Tuple
+
+import requests
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SELECTION_KEYS = ("candidates", "min_cpu", "min_memory_gb", "arch", "order")
+
+ARCHITECTURES = ("x86_64", "arm64")
+
+ORDERS = ("price", "list")
+
+DEFAULT_PRICING_TTL = 3600
+
+
+class MachineSpec(NamedTuple):
+    cpu: int
+    memory_gb: float
+    arch: str
+
+
+def validate_selection(pool_name: str, option: str, selection: Any):
+    """Valida el bloque "selection" de las opciones gce o azure de un pool."""
+    if not isinstance(selection, dict):
+        raise ConfigurationError(f"Pool {pool_name}: {option}.selection debe ser un objeto")
+    unknown = sorted(set(selection) - set(SELECTION_KEYS))
+    if unknown:
+        raise ConfigurationError(f"Pool {pool_name}: campos desconocidos en {option}.selection: {', '.join(unknown)}")
+    candidates = selection.get("candidates")
+    if not isinstance(candidates, list) or not candidates or not all(isinstance(name, str) and name for name in candidates):
+        raise ConfigurationError(f"Pool {pool_name}: {option}.selection.candidates requiere al menos un tipo de máquina")
+    for key in ("min_cpu", "min_memory_gb"):
+        if not isinstance(selection.get(key, 0), (int, float)) or selection.get(key, 0) < 0:
+            raise ConfigurationError(f"Pool {pool_name}: {option}.selection.{key} debe ser un número positivo")
+    if selection.get("arch") not in (None,) + ARCHITECTURES:
+        raise ConfigurationError(f"Pool {pool_name}: {option}.selection.arch debe ser {' o '.join(ARCHITECTURES)}")
+    if selection.get("order", "price") not in ORDERS:
+        raise ConfigurationError(f"Pool {pool_name}: {option}.selection.order debe ser {' o '.join(ORDERS)}")
+
+
+class InstanceCatalog:
+    """Características y precios de los tipos de máquina de un proveedor."""
+
+    def price_location(self, location: str) -> str:
+        """Ubicación a la que se aplican los precios (la región de una zona)."""
+        return location
+
+    def specs(self, location: str, names: List[str]) -> Dict[str, MachineSpec]:
+        """Tipos disponibles en la ubicación; los que no existen allí no aparecen."""
+        raise NotImplementedError
+
+    def prices(self, location: str, specs: Dict[str, MachineSpec], spot: bool, os_name: str) -> Dict[str, float]:
+        """Precio por hora de cada tipo; los que no tienen precio publicado no aparecen."""
+        raise NotImplementedError
+
+
+class InstanceSelector:
+    """Candidatos de un pool ordenados por precio, con las características y precios en caché."""
+
+    def __init__(self, backend: str, catalog: InstanceCatalog, ttl: int = DEFAULT_PRICING_TTL, overrides: Optional[Dict[str, Dict[str, float]]] = None):
+        self.backend = backend
+        self.catalog = catalog
+        self.ttl = ttl
+        # Precios de INSTANCE_PRICES_FILE por ubicación ("<región>" o "<región>:spot")
+        self.overrides = overrides or {}
+        self.specs: Dict[str, Dict[str, Optional[MachineSpec]]] = {}
+        # (ubicación, spot, sistema) -> (consulta, precios, tipos consultados)
+        self.prices: Dict[Tuple[str, bool, str], Tuple[float, Dict[str, float], frozenset]] = {}
+        # Último tipo elegido por pool y ubicación, para /health
+        self.selected: Dict[str, Dict[str, str]] = {}
+        self.lock = threading.Lock()
+
+    def _specs(self, location: str, names: List[str]) -> Dict[str, MachineSpec]:
+        with self.lock:
+            known = self.specs.setdefault(location, {})
+            missing = [name for name in names if name not in known]
+        if missing:
+            found = self.catalog.specs(location, missing)
+            with self.lock:
+                for name in missing:
+                    known[name] = found.get(name)
+        return {name: known[name] for name in names if known.get(name)}
+
+    def _prices(self, location: str, specs: Dict[str, MachineSpec], spot: bool, os_name: str) -> Dict[str, float]:
+        price_location = self.catalog.price_location(location)
+        key = (price_location, spot, os_name)
+        with self.lock:
+            fetched_at, prices, queried = self.prices.get(key, (0.0, {}, frozenset()))
+        if time.time() - fetched_at > self.ttl or set(specs) - queried:
+            try:
+                prices = {**prices, **self.catalog.prices(location, specs, spot, os_name)}
+                with self.lock:
+                    self.prices[key] = (time.time(), prices, queried | set(specs))
+            except (requests.RequestException, ValueError, KeyError) as e:
+                # Con los últimos conocidos, o sin precios (orden de la lista)
+                logger.warning(format_log('WARNING', f'Precios de {self.backend} no actualizados en {price_location}', str(e)))
+        override = self.overrides.get(f"{price_location}:spot" if spot else price_location, {})
+        return {**prices, **override}
+
+    def rank(self, selection: Dict[str, Any], location: str, spot: bool = False, os_name: str = "linux") -> List[str]:
+        """Candidatos que cumplen los requisitos en la ubicación, en el orden en que se prueban."""
+        candidates = list(selection["candidates"])
+        arch = selection.get("arch")
+        matching = {
+            name: spec for name, spec in self._specs(location, candidates).items()
+            if spec.cpu >= selection.get("min_cpu", 0) and spec.memory_gb >= selection.get("min_memory_gb", 0) and (not arch or spec.arch == arch)
+        }
+        if selection.get("order", "price") == "list":
+            return [name for name in candidates if name in matching]
+        prices = self._prices(location, matching, spot, os_name)
+        # Los tipos sin precio van al final, en el orden de la lista
+        return sorted(matching, key=lambda name: (name not in prices, prices.get(name, 0.0), candidates.index(name)))
+
+    def record(self, pool_name: str, location: str, name: str):
+        with self.lock:
+            previous = self.selected.setdefault(pool_name, {}).get(location)
+            self.selected[pool_name][location] = name
+        if previous != name:
+            logger.info(format_log('CONFIG', f'Tipo de máquina del pool {pool_name}', f"{name} en {location}"))
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "selected": {pool: dict(locations) for pool, locations in self.selected.items()},
+                "priced_locations": sorted({f"{location}:spot" if spot else location for location, spot, _ in self.prices}),
+            }
+
+
+def load_price_overrides(path: Optional[str], backend: str) -> Dict[str, Dict[str, float]]:
+    """Precios de INSTANCE_PRICES_FILE del backend: {"gce": {"us-central1": {"e2-standard-4": 0.13}}}."""
+    if not path:
+        return {}
+    try:
+        with open(path, "r") as prices_file:
+            data = json.load(prices_file)
+    except (OSError, ValueError) as e:
+        raise ConfigurationError(f"No se pudo leer INSTANCE_PRICES_FILE {path}: {e}")
+    return {location: {name: float(price) for name, price in prices.items()} for location, prices in (data.get(backend) or {}).items()}
+
+
+def create_instance_selector(backend: str, catalog: InstanceCatalog) -> InstanceSelector:
+    """Selector desde INSTANCE_PRICING_TTL e INSTANCE_PRICES_FILE."""
+    return InstanceSelector(
+        backend,
+        catalog,
+        ttl=int(os.getenv("INSTANCE_PRICING_TTL", str(DEFAULT_PRICING_TTL))),
+        overrides=load_price_overrides(os.getenv("INSTANCE_PRICES_FILE"), backend),
+    )
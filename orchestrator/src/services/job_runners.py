@@ -0,0 +1,196 @@
+"""
+Un runner por job encolado.
+Cada workflow_job.id que llega por webhook queda asociado al runner creado para él:
+una reentrega, un reintento del gateway o la consulta periódica del modo automático
+no crean un segundo runner mientras el primero siga vivo, y al completarse o
+cancelarse el job se destruye exactamente su runner. Con WORK_QUEUE_URL la relación
+está en Redis y la comparten todas las réplicas; sin él, en memoria.
+"""
+
+import os
+import threading
+import time
+from typing import Any, Dict, Optional, Tuple
+
+from src.services.metrics import metrics
+from src.services.work_queue import RedisClient
+from src.utils.helpers import setup_logger
+
+logger = setup_logger(__name__)
+
+# Valor de un job reservado cuyo runner aún se está creando
+PENDING = "-"
+
+
+class JobRunnerMap:
+    """
+    Relación job -> runner y runner -> job con caducidad.
+
+    Una reserva pendiente caduca a los `pending_ttl` segundos (creación colgada o réplica
+    caída) y una asignación a los `ttl` segundos (job que nunca llegó a completarse).
+    """
+
+    def __init__(self, client: Optional[RedisClient] = None, prefix: str = "gha:jobs", ttl: int = 86400, pending_ttl: int = 900):
+        self.client = client
+        self.prefix = prefix
+        self.ttl = ttl
+        self.pending_ttl = pending_ttl
+        # Sin Redis: clave -> (valor, vencimiento)
+        self.entries: Dict[str, Tuple[str, float]] = {}
+        # Reservas de esta réplica por repositorio, para que el modo automático las descuente
+        self.in_flight: Dict[str, int] = {}
+        self.lock = threading.Lock()
+        self.counters = {"assigned": 0, "duplicates": 0, "reassigned": 0, "torn_down": 0}
+
+    def _get(self, key: str) -> Optional[str]:
+        if self.client:
+            return self.client.execute("GET", f"{self.prefix}:{key}")
+        with self.lock:
+            entry = self.entries.get(key)
+            if entry and entry[1] < time.time():
+                del self.entries[key]
+                return None
+            return entry[0] if entry else None
+
+    def _set(self, key: str, value: str, ttl: int, only_new: bool = False) -> bool:
+        if self.client:
+            args = ["SET", f"{self.prefix}:{key}", value, "EX", ttl] + (["NX"] if only_new else [])
+            return self.client.execute(*args) is not None
+        with self.lock:
+            entry = self.entries.get(key)
+            if only_new and entry and entry[1] >= time.time():
+                return False
+            if len(self.entries) >= 100000:
+                now = time.time()
+                self.entries = {name: item for name, item in self.entries.items() if item[1] >= now}
+            self.entries[key] = (value, time.time() + ttl)
+            return True
+
+    def _delete(self, key: str):
+        if self.client:
+            self.client.execute("DEL", f"{self.prefix}:{key}")
+            return
+        with self.lock:
+            self.entries.pop(key, None)
+
+    def reserve(self, job_id: str, repo: str) -> Optional[str]:
+        """
+        Reserva el job para un runner nuevo; settle(repo) cierra la reserva en curso.
+
+        Returns:
+            None si la reserva es nueva; si no, el runner ya asociado (PENDING si se está creando)
+        """
+        for _ in range(2):
+            if self._set(f"job:{job_id}", PENDING, self.pending_ttl, only_new=True):
+                with self.lock:
+                    self.in_flight[repo] = self.in_flight.get(repo, 0) + 1
+                return None
+            existing = self._get(f"job:{job_id}")
+            if existing is not None:
+                self.counters["duplicates"] += 1
+                metrics.incr("jobs.duplicate_requests")
+                return existing
+            # La reserva caducó entre las dos llamadas: se vuelve a intentar
+        return PENDING
+
+    def assign(self, job_id: str, runner_id: str):
+        """Asocia el job con el runner creado para él."""
+        self._set(f"job:{job_id}", runner_id, self.ttl)
+        self._set(f"runner:{runner_id}", job_id, self.ttl)
+        self.counters["assigned"] += 1
+
+    def release(self, job_id: str):
+        """Anula una reserva cuyo runner no se pudo crear, para que otra petición lo reintente."""
+        self._delete(f"job:{job_id}")
+
+    def settle(self, repo: str):
+        """La petición que reservó un job del repositorio terminó (creado, encolado o fallido)."""
+        with self.lock:
+            if self.in_flight.get(repo, 0) > 1:
+                self.in_flight[repo] -= 1
+            else:
+                self.in_flight.pop(repo, None)
+
+    def pending_for(self, repo: str) -> int:
+        """Runners de esta réplica en creación para jobs del repositorio."""
+        with self.lock:
+            return self.in_flight.get(repo, 0)
+
+    def runner_for(self, job_id: str) -> Optional[str]:
+        return self._get(f"job:{job_id}")
+
+    def job_for(self, runner_id: str) -> Optional[str]:
+        return self._get(f"runner:{runner_id}")
+
+    def complete(self, job_id: str) -> Optional[str]:
+        """Quita el job y devuelve su runner (None si no estaba asociado)."""
+        runner_id = self._get(f"job:{job_id}")
+        self._delete(f"job:{job_id}")
+        if runner_id and runner_id != PENDING:
+            self._delete(f"runner:{runner_id}")
+            return runner_id
+        return None
+
+    def reassign(self, runner_id: str, replacement: str) -> Optional[str]:
+        """
+        GitHub entregó a `runner_id` un job que no era el suyo: su job pasa a `replacement`,
+        el runner que quedó libre. Devuelve ese job, o None si `runner_id` no tenía job.
+        """
+        job_id = self.job_for(runner_id)
+        if not job_id:
+            return None
+        self._delete(f"runner:{runner_id}")
+        self._set(f"job:{job_id}", replacement, self.ttl)
+        self._set(f"runner:{replacement}", job_id, self.ttl)
+        self.counters["reassigned"] += 1
+        return job_id
+
+    def assignments(self) -> Dict[str, str]:
+        """Jobs con su runner (PENDING si se está creando), de todas las réplicas."""
+        if not self.client:
+            now = time.time()
+            with self.lock:
+                return {
+                    key[len("job:"):]: value for key, (value, expires) in self.entries.items()
+                    if key.startswith("job:") and expires >= now
+                }
+
+        keys, cursor = [], "0"
+        while True:
+            cursor, batch = self.client.execute("SCAN", cursor, "MATCH", f"{self.prefix}:job:*", "COUNT", 500)
+            keys += batch
+            if cursor == "0":
+                break
+        result = {}
+        for key in keys:
+            runner_id = self.client.execute("GET", key)
+            if runner_id is not None:
+                result[key[len(f"{self.prefix}:job:"):]] = runner_id
+        return result
+
+    def torn_down(self):
+        self.counters["torn_down"] += 1
+        metrics.incr("jobs.runners_torn_down")
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            in_flight = sum(self.in_flight.values())
+        return {
+            "backend": self.client.description if self.client else "memory",
+            "in_flight": in_flight,
+            **self.counters,
+        }
+
+
+def create_job_runner_map() -> JobRunnerMap:
+    """Relación en el Redis de WORK_QUEUE_URL si está configurado; si no, en memoria."""
+    url = os.getenv("WORK_QUEUE_URL")
+    return JobRunnerMap(
+        client=RedisClient(url) if url else None,
+        prefix=f"{os.getenv('WORK_QUEUE_NAME', 'gha:work')}:jobs",
+        ttl=int(os.getenv("JOB_RUNNER_TTL", "86400")),
+    )
+
+
+# Compartido por la API, los workers de la cola y el modo automático
+job_runners = create_job_runner_map()
@@ -0,0 +1,157 @@
+"""
+Métricas de flota y latencia del orchestrator.
+Mantiene contadores, gauges y tiempos en memoria y los emite opcionalmente a StatsD/DogStatsD.
+"""
+
+import os
+import socket
+import threading
+import time
+from contextlib import contextmanager
+from typing import Dict, List, Optional
+
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class StatsDSink:
+    """Emisor UDP de métricas en formato StatsD con soporte de tags DogStatsD."""
+
+    def __init__(
+        self,
+        host: str,
+        port: int,
+        prefix: str = "",
+        tags: Optional[Dict[str, str]] = None,
+        dogstatsd: bool = True,
+    ):
+        self.address = (host, port)
+        self.prefix = prefix.rstrip(".")
+        self.tags = tags or {}
+        self.dogstatsd = dogstatsd
+        self.socket = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+
+    def send(self, name: str, value: float, metric_type: str, tags: Optional[Dict[str, str]] = None):
+        """Envía una métrica. Los errores de red nunca se propagan."""
+        metric_name = f"{self.prefix}.{name}" if self.prefix else name
+        payload = f"{metric_name}:{value:g}|{metric_type}"
+
+        # StatsD clásico no soporta tags, solo DogStatsD
+        if self.dogstatsd:
+            all_tags = {**self.tags, **(tags or {})}
+            if all_tags:
+                payload += "|#" + ",".join(f"{k}:{v}" for k, v in sorted(all_tags.items()))
+
+        try:
+            self.socket.sendto(payload.encode("utf-8"), self.address)
+        except OSError as e:
+            logger.debug(f"Error enviando métrica {metric_name} a StatsD: {e}")
+
+
+class MetricsRegistry:
+    """Registro central de métricas con sinks intercambiables."""
+
+    def __init__(self):
+        self.sinks: List[StatsDSink] = []
+        self.counters: Dict[str, float] = {}
+        self.gauges: Dict[str, float] = {}
+        self.timings: Dict[str, Dict[str, float]] = {}
+        self.histograms: Dict[str, Dict[str, float]] = {}
+        self.lock = threading.Lock()
+
+    def add_sink(self, sink: StatsDSink):
+        """Registra un sink adicional."""
+        self.sinks.append(sink)
+
+    def incr(self, name: str, value: float = 1, tags: Optional[Dict[str, str]] = None):
+        """Incrementa un contador."""
+        with self.lock:
+            self.counters[name] = self.counters.get(name, 0) + value
+        for sink in self.sinks:
+            sink.send(name, value, "c", tags)
+
+    def gauge(self, name: str, value: float, tags: Optional[Dict[str, str]] = None):
+        """Fija el valor actual de un gauge."""
+        with self.lock:
+            self.gauges[name] = value
+        for sink in self.sinks:
+            sink.send(name, value, "g", tags)
+
+    def timing(self, name: str, milliseconds: float, tags: Optional[Dict[str, str]] = None):
+        """Registra una duración en milisegundos."""
+        with self.lock:
+            stats = self.timings.setdefault(name, {"count": 0, "total_ms": 0.0, "max_ms": 0.0})
+            stats["count"] += 1
+            stats["total_ms"] += milliseconds
+            stats["max_ms"] = max(stats["max_ms"], milliseconds)
+        for sink in self.sinks:
+            sink.send(name, milliseconds, "ms", tags)
+
+    def histogram(self, name: str, value: float, tags: Optional[Dict[str, str]] = None):
+        """Registra una muestra de una distribución (el sink calcula percentiles)."""
+        with self.lock:
+            stats = self.histograms.setdefault(name, {"count": 0, "total": 0.0, "max": 0.0})
+            stats["count"] += 1
+            stats["total"] += value
+            stats["max"] = max(stats["max"], value)
+        for sink in self.sinks:
+            sink.send(name, value, "h", tags)
+
+    @contextmanager
+    def timer(self, name: str, tags: Optional[Dict[str, str]] = None):
+        """Mide la duración del bloque y la registra como timing."""
+        start = time.monotonic()
+        try:
+            yield
+        finally:
+            self.timing(name, (time.monotonic() - start) * 1000, tags)
+
+    def snapshot(self) -> Dict[str, Dict]:
+        """Retorna una copia de los valores acumulados en memoria."""
+        with self.lock:
+            return {
+                "counters": dict(self.counters),
+                "gauges": dict(self.gauges),
+                "timings": {name: dict(stats) for name, stats in self.timings.items()},
+                "histograms": {name: dict(stats) for name, stats in self.histograms.items()},
+            }
+
+
+def parse_tags(raw_tags: str) -> Dict[str, str]:
+    """Convierte 'env:prod,team:ci' en diccionario de tags."""
+    tags = {}
+    for item in raw_tags.split(","):
+        item = item.strip()
+        if not item:
+            continue
+        key, _, value = item.partition(":")
+        tags[key.strip()] = value.strip()
+    return tags
+
+
+def create_metrics_registry() -> MetricsRegistry:
+    """Crea el registro de métricas configurando StatsD desde variables de entorno."""
+    registry = MetricsRegistry()
+
+    if os.getenv("STATSD_ENABLED", "false").lower() == "true":
+        host = os.getenv("STATSD_HOST", "localhost")
+        port = int(os.getenv("STATSD_PORT", "8125"))
+        tags = parse_tags(os.getenv("STATSD_TAGS", ""))
+        tags.setdefault("service", "orchestrator")
+        registry.add_sink(
+            StatsDSink(
+                host=host,
+                port=port,
+                prefix=os.getenv("STATSD_PREFIX", "gha_runners"),
+                tags=tags,
+                dogstatsd=os.getenv("STATSD_DOGSTATSD", "true").lower() == "true",
+            )
+        )
+        logger.info(format_log('CONFIG', 'StatsD activado', f'{host}:{port}'))
+
+    return registry
+
+
+# Registro compartido por todos los módulos del orchestrator
+metrics = create_metrics_registry()
@@ -0,0 +1,164 @@
+"""
+Plantillas de nombres y labels de runners.
+RUNNER_NAME_TEMPLATE y RUNNER_LABEL_TEMPLATES (o name_template y label_templates de
+cada pool) usan la sintaxis {{.Campo}}, p. ej. "{{.Pool}}-{{.Arch}}-{{.ShortID}}",
+para que los runners tengan nombres y labels con significado en la UI de GitHub.
+"""
+
+import difflib
+import os
+import re
+import time
+import uuid
+from typing import Any, Dict, List, Optional
+
+from src.utils.helpers import ConfigurationError, setup_logger
+
+logger = setup_logger(__name__)
+
+TEMPLATE_FIELD = re.compile(r"\{\{\s*\.(\w+)\s*\}\}")
+
+FIELDS = {
+    "Pool": "Nombre del pool",
+    "Scope": "repo u org",
+    "ScopeName": "owner/repo u organización",
+    "Owner": "Owner del repositorio u organización",
+    "Repo": "Repositorio (vacío para scope org)",
+    "Arch": "Arquitectura del Docker Engine (x64, arm64)",
+    "OS": "Sistema operativo del Docker Engine",
+    "Region": "RUNNER_REGION",
+    "Image": "Imagen sin tag ni registro",
+    "ImageTag": "Tag de la imagen",
+    "ImageDigest": "Primeros 12 caracteres del digest de la imagen",
+    "ShortID": "8 caracteres aleatorios",
+    "Timestamp": "Segundos Unix",
+}
+
+# GitHub limita los nombres de runner a 64 caracteres
+MAX_NAME_LENGTH = 64
+
+# Nombres de arquitectura de Docker a los usados por GitHub en sus labels
+ARCH_ALIASES = {"x86_64": "x64", "amd64": "x64", "aarch64": "arm64", "arm64": "arm64", "armv7l": "arm"}
+
+
+def validate_template(template: str, source: str, require_unique: bool = False) -> str:
+    """
+    Verifica que la plantilla solo use campos conocidos.
+
+    Raises:
+        ConfigurationError: Si hay campos desconocidos o, con require_unique, falta {{.ShortID}}
+    """
+    for field in TEMPLATE_FIELD.findall(template):
+        if field not in FIELDS:
+            suggestion = difflib.get_close_matches(field, list(FIELDS), n=1)
+            hint = f"; ¿quisiste decir '{{{{.{suggestion[0]}}}}}'?" if suggestion else ""
+            raise ConfigurationError(f"{source}: campo desconocido '{{{{.{field}}}}}'{hint}")
+    # Sin parte aleatoria dos runners del mismo pool chocarían en el nombre del contenedor
+    if require_unique and "ShortID" not in TEMPLATE_FIELD.findall(template):
+        raise ConfigurationError(f"{source}: la plantilla de nombre debe incluir {{{{.ShortID}}}}")
+    return template
+
+
+def render(template: str, context: Dict[str, str]) -> str:
+    return TEMPLATE_FIELD.sub(lambda match: context.get(match.group(1), ""), template)
+
+
+def _split_image(image: str) -> Dict[str, str]:
+    reference = image.split("@")[0]
+    name, tag = reference, "latest"
+    # Un ':' después de la última '/' es el tag; antes, el puerto del registro
+    if ":" in reference.rsplit("/", 1)[-1]:
+        name, tag = reference.rsplit(":", 1)
+    return {"Image": name.rsplit("/", 1)[-1], "ImageTag": tag}
+
+
+class RunnerNaming:
+    """Genera nombres y labels de runners a partir de plantillas."""
+
+    def __init__(
+        self,
+        name_template: Optional[str] = None,
+        label_templates: Optional[List[str]] = None,
+        region: Optional[str] = None,
+    ):
+        self.name_template = validate_template(name_template, "RUNNER_NAME_TEMPLATE", True) if name_template else None
+        self.label_templates = [validate_template(item, "RUNNER_LABEL_TEMPLATES") for item in label_templates or []]
+        self.region = region or ""
+        self.engine: Optional[Dict[str, str]] = None
+
+    def _engine(self, client: Any) -> Dict[str, str]:
+        # La arquitectura del Docker Engine no cambia: se consulta una sola vez
+        if self.engine is None:
+            try:
+                info = client.info()
+                arch = info.get("Architecture", "")
+                self.engine = {"Arch": ARCH_ALIASES.get(arch, arch), "OS": info.get("OSType", "")}
+            except Exception as e:
+                logger.warning(f"⚠️ No se pudo consultar el Docker Engine para las plantillas: {e}")
+                return {"Arch": "", "OS": ""}
+        return self.engine
+
+    def _image_digest(self, client: Any, image: str) -> str:
+        try:
+            digests = client.images.get(image).attrs.get("RepoDigests") or []
+        except Exception:
+            # La imagen se descarga al crear el contenedor si aún no está local
+            return ""
+        return digests[0].split("@sha256:")[-1][:12] if digests else ""
+
+    def uses_field(self, pool: Any, field: str) -> bool:
+        templates = [self.name_template_for(pool) or ""] + self.label_templates + list(pool.label_templates)
+        return any(field in TEMPLATE_FIELD.findall(template) for template in templates)
+
+    def name_template_for(self, pool: Any) -> Optional[str]:
+        return pool.name_template or self.name_template
+
+    def context(self, client: Any, pool: Any, scope: str, scope_name: str, image: str) -> Dict[str, str]:
+        """Valores disponibles para las plantillas de un runner."""
+        owner, _, repo = scope_name.partition("/")
+        context = {
+            "Pool": pool.name,
+            "Scope": scope,
+            "ScopeName": scope_name,
+            "Owner": owner,
+            "Repo": repo,
+            "Region": self.region,
+            "ShortID": uuid.uuid4().hex[:8],
+            "Timestamp": str(int(time.time())),
+            **_split_image(image),
+        }
+        if self.uses_field(pool, "Arch") or self.uses_field(pool, "OS"):
+            context.update(self._engine(client))
+        if self.uses_field(pool, "ImageDigest"):
+            context["ImageDigest"] = self._image_digest(client, image)
+        return context
+
+    def name(self, pool: Any, context: Dict[str, str]) -> Optional[str]:
+        """Nombre del runner, o None si no hay plantilla para el pool."""
+        template = self.name_template_for(pool)
+        if not template:
+            return None
+        # Los campos vacíos dejarían separadores duplicados ("linux--abc123")
+        name = re.sub(r"[^a-zA-Z0-9_-]", "-", render(template, context))
+        name = re.sub(r"-{2,}", "-", name).strip("-_")
+        return name[:MAX_NAME_LENGTH].rstrip("-_")
+
+    def labels(self, pool: Any, context: Dict[str, str]) -> List[str]:
+        """Labels derivados de las plantillas global y del pool; se omiten los que tienen campos vacíos."""
+        labels = []
+        for template in self.label_templates + list(pool.label_templates):
+            # "region-{{.Region}}" sin RUNNER_REGION no debe producir el label "region-"
+            if any(not context.get(field) for field in TEMPLATE_FIELD.findall(template)):
+                continue
+            labels.append(re.sub(r"[^a-zA-Z0-9._:-]", "-", render(template, context)))
+        return labels
+
+
+def create_runner_naming() -> RunnerNaming:
+    """Crea el generador de nombres desde RUNNER_NAME_TEMPLATE, RUNNER_LABEL_TEMPLATES y RUNNER_REGION."""
+    label_templates = [item.strip() for item in os.getenv("RUNNER_LABEL_TEMPLATES", "").split(",") if item.strip()]
+    return RunnerNaming(
+        name_template=os.getenv("RUNNER_NAME_TEMPLATE") or None,
+        label_templates=label_templates,
+        region=os.getenv("RUNNER_REGION"),
+    )
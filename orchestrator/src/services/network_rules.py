@@ -0,0 +1,229 @@
+"""
+Reglas de salida por pool para los runners en la nube.
+Con egress_cidrs en un pool ecs, azure o gce, el backend crea un security group (ECS),
+un NSG (Azure) o reglas de firewall por network tag (Compute Engine) que solo dejan
+salir a esos CIDRs y a los rangos de GitHub publicados en /meta (en GHES, las IPs del
+servidor). Las reglas se crean con el primer runner del pool, se actualizan si cambian
+los CIDRs o los rangos de GitHub y se borran cuando el pool se queda sin runners; si el
+proveedor aún las ve en uso (interfaces de red que tardan en liberarse) se reintenta en
+el siguiente listado de runners.
+"""
+
+import hashlib
+import ipaddress
+import os
+import socket
+import threading
+import time
+from contextlib import contextmanager
+from typing import Any, Dict, Iterator, List, Optional, Set, Tuple
+
+import requests
+from src.services.github_server import github_api_url, github_hostname, is_enterprise_server
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Claves de /meta con los rangos que usa un runner: web, API, git y GitHub Packages (ghcr.io)
+DEFAULT_META_KEYS = "web,api,git,packages"
+
+DEFAULT_META_TTL = 3600
+
+# Backends donde el orchestrator controla la red del runner
+EGRESS_BACKENDS = ("ecs", "azure", "gce")
+
+
+def validate_egress(pool_name: str, backend: str, cidrs: Any):
+    """Valida egress_cidrs de un pool al cargarlo."""
+    if backend not in EGRESS_BACKENDS:
+        raise ConfigurationError(f"Pool {pool_name}: egress_cidrs solo se aplica a los backends {', '.join(EGRESS_BACKENDS)}")
+    if not isinstance(cidrs, list):
+        raise ConfigurationError(f"Pool {pool_name}: egress_cidrs debe ser una lista de CIDRs")
+    for cidr in cidrs:
+        try:
+            ipaddress.ip_network(str(cidr), strict=False)
+        except ValueError:
+            raise ConfigurationError(f"Pool {pool_name}: CIDR inválido en egress_cidrs: {cidr}")
+
+
+class GitHubRanges:
+    """Rangos de GitHub de /meta, en caché durante EGRESS_GITHUB_META_TTL segundos."""
+
+    def __init__(self, keys: List[str], ttl: int = DEFAULT_META_TTL):
+        self.keys = keys
+        self.ttl = ttl
+        self.ranges: List[str] = []
+        self.fetched_at = 0.0
+        self.lock = threading.Lock()
+
+    def get(self) -> List[str]:
+        """
+        Rangos actuales; si /meta no responde se usan los últimos conocidos.
+
+        Raises:
+            ConfigurationError: Si no se pudieron obtener nunca
+        """
+        with self.lock:
+            if not self.ranges or time.time() - self.fetched_at > self.ttl:
+                try:
+                    self.ranges = self._fetch()
+                    self.fetched_at = time.time()
+                except (requests.RequestException, OSError, ValueError) as e:
+                    if not self.ranges:
+                        raise ConfigurationError(f"No se pudieron obtener los rangos de GitHub para egress_cidrs: {e}")
+                    logger.warning(format_log('WARNING', 'Rangos de GitHub no actualizados, se usan los anteriores', str(e)))
+            return list(self.ranges)
+
+    def _fetch(self) -> List[str]:
+        api_base = github_api_url()
+        ranges: Set[str] = set()
+        if not is_enterprise_server(api_base):
+            response = requests.get(f"{api_base}/meta", timeout=10.0)
+            response.raise_for_status()
+            meta = response.json()
+            for key in self.keys:
+                ranges.update(meta.get(key) or [])
+        if not ranges:
+            # GHES no publica rangos: se permiten las direcciones del servidor
+            for *_, sockaddr in socket.getaddrinfo(github_hostname(api_base), 443, proto=socket.IPPROTO_TCP):
+                address = ipaddress.ip_address(sockaddr[0])
+                ranges.add(f"{address}/{address.max_prefixlen}")
+        return sorted(ranges)
+
+
+def split_versions(cidrs: List[str]) -> Tuple[List[str], List[str]]:
+    """CIDRs IPv4 e IPv6 agrupados en los mínimos bloques (menos reglas en el proveedor)."""
+    networks = [ipaddress.ip_network(cidr, strict=False) for cidr in cidrs]
+    ipv4 = [str(net) for net in ipaddress.collapse_addresses(net for net in networks if net.version == 4)]
+    ipv6 = [str(net) for net in ipaddress.collapse_addresses(net for net in networks if net.version == 6)]
+    return ipv4, ipv6
+
+
+class PoolEgressRules:
+    """
+    Ciclo de vida de las reglas de salida de cada pool; cada backend implementa
+    _apply (crear o actualizar), _delete e _in_use.
+
+    La creación de un runner va dentro de creation() y release se llama tras eliminarlo.
+    Las reglas no se borran con creaciones en curso, para que un runner nuevo no arranque
+    sin ellas.
+    """
+
+    # Errores del proveedor que indican que las reglas aún están asociadas a alguna interfaz
+    IN_USE_ERRORS: Tuple[str, ...] = ()
+
+    def __init__(self, backend: str, github: GitHubRanges):
+        self.backend = backend
+        self.github = github
+        # Referencia aplicada (id del security group, NSG o network tag) y huella de las reglas
+        self.applied: Dict[str, Tuple[str, str]] = {}
+        self.creating: Dict[str, int] = {}
+        self.pending: Set[str] = set()
+        # Pools cuyas reglas se buscaron al menos una vez (las de antes de un reinicio)
+        self.checked: Set[str] = set()
+        self.locks: Dict[str, threading.Lock] = {}
+        self.lock = threading.Lock()
+
+    def _pool_lock(self, pool_name: str) -> threading.Lock:
+        with self.lock:
+            return self.locks.setdefault(pool_name, threading.Lock())
+
+    def destinations(self, pool: Any) -> Tuple[List[str], List[str]]:
+        return split_versions([str(cidr) for cidr in pool.egress_cidrs] + self.github.get())
+
+    def acquire(self, pool: Any) -> Optional[str]:
+        """Referencia de las reglas del pool (creadas o actualizadas), o None si el pool no restringe la salida."""
+        if pool.egress_cidrs is None:
+            return None
+        with self._pool_lock(pool.name):
+            ipv4, ipv6 = self.destinations(pool)
+            fingerprint = hashlib.sha256(f"{ipv4}{ipv6}".encode()).hexdigest()
+            current = self.applied.get(pool.name)
+            if not current or current[1] != fingerprint:
+                reference = self._apply(pool, ipv4, ipv6)
+                self.applied[pool.name] = (reference, fingerprint)
+                logger.info(format_log('CONFIG', f'Reglas de salida del pool {pool.name}', f"{self.backend} {reference}: {len(ipv4) + len(ipv6)} destinos"))
+            self.pending.discard(pool.name)
+            self.creating[pool.name] = self.creating.get(pool.name, 0) + 1
+            return self.applied[pool.name][0]
+
+    def finish(self, pool: Any):
+        if pool.egress_cidrs is None:
+            return
+        with self._pool_lock(pool.name):
+            self.creating[pool.name] = max(0, self.creating.get(pool.name, 0) - 1)
+
+    @contextmanager
+    def creation(self, pool: Any) -> Iterator[Optional[str]]:
+        """acquire y finish alrededor de la creación; si falla, las reglas se liberan como tras eliminar un runner."""
+        reference = self.acquire(pool)
+        try:
+            yield reference
+        except BaseException:
+            self.finish(pool)
+            self.release(pool.name)
+            raise
+        self.finish(pool)
+
+    def release(self, pool_name: Optional[str]):
+        """Borra las reglas del pool si ya no tiene runners ni creaciones en curso."""
+        if not pool_name:
+            return
+        with self._pool_lock(pool_name):
+            if self.creating.get(pool_name) or not self._managed(pool_name):
+                return
+            self.checked.add(pool_name)
+            try:
+                if self._in_use(pool_name):
+                    self.pending.add(pool_name)
+                    return
+                deleted = self._delete(pool_name)
+            except Exception as e:
+                if not any(code in str(e) for code in self.IN_USE_ERRORS):
+                    logger.warning(format_log('WARNING', f'No se pudieron borrar las reglas de salida del pool {pool_name}', str(e)))
+                self.pending.add(pool_name)
+                return
+            self.applied.pop(pool_name, None)
+            self.pending.discard(pool_name)
+            if deleted:
+                logger.info(format_log('INFO', 'Reglas de salida borradas', f"pool {pool_name} ({self.backend})"))
+
+    def sweep(self):
+        """Reintenta el borrado de las reglas que seguían en uso."""
+        with self.lock:
+            pending = list(self.pending)
+        for pool_name in pending:
+            self.release(pool_name)
+
+    def _managed(self, pool_name: str) -> bool:
+        """
+        Las reglas del pool pueden existir: aplicadas en este proceso, pendientes de borrar
+        o aún no buscadas (creadas antes de un reinicio del orchestrator).
+        """
+        return pool_name in self.applied or pool_name in self.pending or pool_name not in self.checked
+
+    def _apply(self, pool: Any, ipv4: List[str], ipv6: List[str]) -> str:
+        raise NotImplementedError
+
+    def _delete(self, pool_name: str) -> bool:
+        """Borra las reglas del pool; False si no existían."""
+        raise NotImplementedError
+
+    def _in_use(self, pool_name: str) -> bool:
+        return False
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {
+                "pools": {name: reference for name, (reference, _) in self.applied.items()},
+                "pending_delete": sorted(self.pending),
+            }
+
+
+def create_github_ranges() -> GitHubRanges:
+    """Rangos desde EGRESS_GITHUB_META_KEYS y EGRESS_GITHUB_META_TTL."""
+    keys = [key.strip() for key in os.getenv("EGRESS_GITHUB_META_KEYS", DEFAULT_META_KEYS).split(",") if key.strip()]
+    return GitHubRanges(keys, int(os.getenv("EGRESS_GITHUB_META_TTL", str(DEFAULT_META_TTL))))
+
+
+github_ranges = create_github_ranges()
@@ -0,0 +1,324 @@
+"""
+Webhooks salientes de eventos del ciclo de vida (runner aprovisionado, job completado,
+fallo de escalado...): lo inverso a la recepción de webhooks de GitHub.
+Cada entrega va firmada con HMAC-SHA256 del secreto del webhook, se reintenta con
+backoff exponencial y queda en un historial de entregas por webhook. Con
+EVENTS_OUTBOX_PATH las entregas pendientes se guardan en el outbox y se reanudan al
+reiniciar el proceso.
+"""
+
+import collections
+import fnmatch
+import hashlib
+import heapq
+import hmac
+import json
+import os
+import secrets
+import threading
+import time
+import uuid
+from datetime import datetime, timezone
+from typing import Any, Deque, Dict, List, Optional
+
+import requests
+from src.services.encryption import decrypt_value, encrypt_value
+from src.services.metrics import metrics
+from src.services.lifecycle_events import build_event, lifecycle_events
+from src.services.outbox import event_outbox
+from src.utils.helpers import ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SIGNATURE_HEADER = "X-GHA-Runners-Signature-256"
+
+# Canal del outbox con las entregas pendientes
+OUTBOX_CHANNEL = "webhooks"
+
+# Respuestas 4xx que sí se reintentan (el resto indica un error del receptor que no se resuelve solo)
+RETRYABLE_CLIENT_ERRORS = (408, 409, 425, 429)
+
+
+def sign(secret: str, body: bytes) -> str:
+    """Valor de X-GHA-Runners-Signature-256 (mismo esquema que X-Hub-Signature-256 de GitHub)."""
+    return "sha256=" + hmac.new(secret.encode("utf-8"), body, hashlib.sha256).hexdigest()
+
+
+def _now() -> str:
+    return datetime.now(timezone.utc).isoformat()
+
+
+class OutboundWebhooks:
+    """
+    Webhooks registrados y entrega de eventos.
+
+    Se registra como backend de lifecycle_events: publish() nunca falla, solo programa
+    entregas que un hilo propio envía y reintenta (10s, 20s, 40s... hasta max_attempts).
+    """
+
+    name = "webhooks"
+
+    def __init__(
+        self,
+        state_file: Optional[str] = None,
+        max_attempts: int = 6,
+        retry_base: int = 10,
+        log_size: int = 100,
+        timeout: float = 10.0,
+        outbox: Any = None,
+    ):
+        self.state_file = state_file
+        self.outbox = outbox
+        self.max_attempts = max_attempts
+        self.retry_base = retry_base
+        self.log_size = log_size
+        self.timeout = timeout
+        self.webhooks: Dict[str, Dict[str, Any]] = {}
+        self.deliveries: Dict[str, Deque[Dict[str, Any]]] = {}
+        # Entregas pendientes ordenadas por instante de envío: (due, seq, delivery, event)
+        self.pending: List[Any] = []
+        self.sequence = 0
+        self.lock = threading.Lock()
+        self.wakeup = threading.Event()
+        self._load_state()
+        self._resume_pending()
+        threading.Thread(target=self._delivery_loop, daemon=True).start()
+
+    @property
+    def description(self) -> str:
+        return f"{len(self.webhooks)} webhooks salientes"
+
+    # ===== Registro =====
+
+    def _load_state(self):
+        """Carga los webhooks persistidos en OUTBOUND_WEBHOOKS_FILE."""
+        if not self.state_file or not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                for webhook in json.load(state).get("webhooks", []):
+                    webhook["secret"] = decrypt_value(webhook.get("secret"))
+                    self.webhooks[webhook["id"]] = webhook
+                    self.deliveries[webhook["id"]] = collections.deque(maxlen=self.log_size)
+            logger.info(format_log('CONFIG', 'Webhooks salientes cargados', f"{len(self.webhooks)} en {self.state_file}"))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de webhooks salientes', str(e)))
+
+    def _resume_pending(self):
+        """Reprograma las entregas que quedaron pendientes en el outbox antes del reinicio."""
+        if not self.outbox:
+            return
+        resumed = 0
+        for delivery_id, item, attempts in self.outbox.pending(OUTBOX_CHANNEL, limit=100000):
+            delivery, event = item["delivery"], item["event"]
+            delivery["attempts"] = attempts
+            if delivery["webhook_id"] not in self.webhooks:
+                self.outbox.done(OUTBOX_CHANNEL, delivery_id)
+                continue
+            self.deliveries[delivery["webhook_id"]].append(delivery)
+            self._push(time.time(), delivery, event)
+            resumed += 1
+        if resumed:
+            logger.info(format_log('CONFIG', 'Entregas de webhooks salientes reanudadas', str(resumed)))
+
+    def _save_state(self):
+        if not self.state_file:
+            return
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            # Con STATE_ENCRYPTION los secretos de firma se guardan cifrados
+            webhooks = [{**webhook, "secret": encrypt_value(webhook.get("secret"))} for webhook in self.webhooks.values()]
+            json.dump({"webhooks": webhooks}, state)
+        # Contiene los secretos de firma
+        os.chmod(tmp_file, 0o600)
+        os.replace(tmp_file, self.state_file)
+
+    def reencrypt(self) -> int:
+        """Reescribe los secretos de firma con la clave de datos actual (rotación de STATE_ENCRYPTION)."""
+        with self.lock:
+            self._save_state()
+            return len(self.webhooks)
+
+    @staticmethod
+    def _public(webhook: Dict[str, Any]) -> Dict[str, Any]:
+        return {key: value for key, value in webhook.items() if key != "secret"}
+
+    def list_webhooks(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return [self._public(webhook) for webhook in self.webhooks.values()]
+
+    def register(self, url: str, events: List[str], description: str = "", secret: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Registra un webhook; el secreto (generado si no se indica) solo se devuelve aquí.
+
+        Raises:
+            ValidationError: Si la URL o los eventos no son válidos
+        """
+        if not url.startswith(("http://", "https://")):
+            raise ValidationError("La URL del webhook debe ser http:// o https://")
+        if not events:
+            raise ValidationError("Se requiere al menos un evento (p. ej. runner.provisioned o runner.*)")
+        webhook = {
+            "id": f"wh_{uuid.uuid4().hex[:12]}",
+            "url": url,
+            "events": events,
+            "description": description,
+            "active": True,
+            "created_at": _now(),
+            "secret": secret or secrets.token_hex(32),
+        }
+        with self.lock:
+            self.webhooks[webhook["id"]] = webhook
+            self.deliveries[webhook["id"]] = collections.deque(maxlen=self.log_size)
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Webhook saliente registrado', f"{webhook['id']} {url} ({', '.join(events)})"))
+        return webhook
+
+    def remove(self, webhook_id: str) -> bool:
+        with self.lock:
+            if self.webhooks.pop(webhook_id, None) is None:
+                return False
+            self.deliveries.pop(webhook_id, None)
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Webhook saliente eliminado', webhook_id))
+        return True
+
+    def delivery_log(self, webhook_id: str) -> Optional[List[Dict[str, Any]]]:
+        """Últimas entregas del webhook, la más reciente primero (None si no existe)."""
+        with self.lock:
+            if webhook_id not in self.webhooks:
+                return None
+            return [dict(delivery) for delivery in reversed(self.deliveries[webhook_id])]
+
+    # ===== Entrega =====
+
+    def publish(self, event: Dict[str, Any]):
+        """Programa una entrega por cada webhook activo suscrito al tipo del evento."""
+        with self.lock:
+            for webhook in self.webhooks.values():
+                if webhook["active"] and any(fnmatch.fnmatchcase(event["type"], pattern) for pattern in webhook["events"]):
+                    self._schedule(webhook["id"], event)
+
+    def ping(self, webhook_id: str) -> Optional[Dict[str, Any]]:
+        """Envía un evento webhook.ping al webhook indicado."""
+        event = build_event("webhook.ping", "orchestrator", webhook_id, {"webhook_id": webhook_id})
+        with self.lock:
+            if webhook_id not in self.webhooks:
+                return None
+            return dict(self._schedule(webhook_id, event))
+
+    def close(self):
+        pass
+
+    def _schedule(self, webhook_id: str, event: Dict[str, Any]) -> Dict[str, Any]:
+        delivery = {
+            "id": str(uuid.uuid4()),
+            "webhook_id": webhook_id,
+            "event_id": event["id"],
+            "event_type": event["type"],
+            "status": "pending",
+            "attempts": 0,
+            "response_status": None,
+            "error": None,
+            "duration_ms": None,
+            "created_at": _now(),
+            "last_attempt_at": None,
+            "next_attempt_at": None,
+        }
+        self.deliveries[webhook_id].append(delivery)
+        if self.outbox:
+            self.outbox.add([(OUTBOX_CHANNEL, delivery["id"], {"delivery": delivery, "event": event})])
+        self._push(time.time(), delivery, event)
+        return delivery
+
+    def _push(self, due: float, delivery: Dict[str, Any], event: Dict[str, Any]):
+        self.sequence += 1
+        heapq.heappush(self.pending, (due, self.sequence, delivery, event))
+        self.wakeup.set()
+
+    def _delivery_loop(self):
+        while True:
+            with self.lock:
+                due = self.pending[0][0] if self.pending else None
+                ready = due is not None and due <= time.time()
+                item = heapq.heappop(self.pending) if ready else None
+            if item is None:
+                self.wakeup.clear()
+                self.wakeup.wait(timeout=None if due is None else max(due - time.time(), 0))
+                continue
+            self._attempt(item[2], item[3])
+
+    def _attempt(self, delivery: Dict[str, Any], event: Dict[str, Any]):
+        with self.lock:
+            webhook = self.webhooks.get(delivery["webhook_id"])
+        if webhook is None:
+            if self.outbox:
+                self.outbox.done(OUTBOX_CHANNEL, delivery["id"])
+            return
+
+        body = json.dumps(event).encode()
+        headers = {
+            "Content-Type": "application/json",
+            "User-Agent": "gha-ephemeral-runners",
+            "X-GHA-Runners-Event": event["type"],
+            "X-GHA-Runners-Delivery": delivery["id"],
+            SIGNATURE_HEADER: sign(webhook["secret"], body),
+        }
+        start = time.monotonic()
+        status, error = None, None
+        try:
+            response = requests.post(webhook["url"], data=body, headers=headers, timeout=self.timeout)
+            status = response.status_code
+            if status >= 300:
+                error = f"HTTP {status}"
+        except requests.RequestException as e:
+            error = str(e)
+
+        with self.lock:
+            delivery["attempts"] += 1
+            delivery["last_attempt_at"] = _now()
+            delivery["duration_ms"] = int((time.monotonic() - start) * 1000)
+            delivery["response_status"] = status
+            delivery["error"] = error
+            retryable = status is None or status >= 500 or status in RETRYABLE_CLIENT_ERRORS
+            if error is None:
+                delivery["status"] = "delivered"
+                delivery["next_attempt_at"] = None
+            elif retryable and delivery["attempts"] < self.max_attempts:
+                delay = self.retry_base * 2 ** (delivery["attempts"] - 1)
+                delivery["next_attempt_at"] = datetime.fromtimestamp(time.time() + delay, timezone.utc).isoformat()
+                self._push(time.time() + delay, delivery, event)
+            else:
+                delivery["status"] = "failed"
+                delivery["next_attempt_at"] = None
+
+        if self.outbox:
+            if delivery["status"] == "pending":
+                self.outbox.failed(OUTBOX_CHANNEL, delivery["id"], error)
+            else:
+                self.outbox.done(OUTBOX_CHANNEL, delivery["id"])
+
+        if error is None:
+            metrics.incr("webhooks.outbound.delivered", tags={"type": event["type"]})
+        elif delivery["status"] == "failed":
+            metrics.incr("webhooks.outbound.failed", tags={"type": event["type"]})
+            logger.warning(format_log(
+                'WARNING', 'Entrega de webhook saliente fallida',
+                f"{webhook['id']} {event['type']} tras {delivery['attempts']} intentos: {error}"
+            ))
+
+
+def create_outbound_webhooks() -> OutboundWebhooks:
+    """Crea el registro de webhooks salientes desde OUTBOUND_WEBHOOKS_FILE y OUTBOUND_WEBHOOK_*."""
+    return OutboundWebhooks(
+        state_file=os.getenv("OUTBOUND_WEBHOOKS_FILE") or None,
+        max_attempts=int(os.getenv("OUTBOUND_WEBHOOK_MAX_ATTEMPTS", "6")),
+        retry_base=int(os.getenv("OUTBOUND_WEBHOOK_RETRY_BASE", "10")),
+        log_size=int(os.getenv("OUTBOUND_WEBHOOK_LOG_SIZE", "100")),
+        outbox=event_outbox,
+    )
+
+
+# Registro compartido; recibe los eventos de lifecycle_events como un backend más
+outbound_webhooks = create_outbound_webhooks()
+lifecycle_events.add_publisher(outbound_webhooks)
@@ -0,0 +1,144 @@
+"""
+Outbox transaccional de eventos y webhooks salientes.
+Con EVENTS_OUTBOX_PATH cada evento se escribe en una tabla SQLite (una fila por destino)
+antes de que emit() devuelva el control, y un despachador la vacía entregando en orden y
+borrando cada fila solo cuando el destino la confirma. Un reinicio o una caída del
+proceso entre el cambio de estado y la publicación ya no pierde eventos: al arrancar se
+entregan los pendientes. La entrega es al menos una vez; los consumidores deduplican por
+el id del evento (o X-GHA-Runners-Delivery en los webhooks).
+"""
+
+import json
+import os
+import sqlite3
+import threading
+import time
+from typing import Any, Dict, Iterable, List, Optional, Tuple
+
+from src.services.encryption import decrypt_value, encrypt_value
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SCHEMA = """
+CREATE TABLE IF NOT EXISTS outbox (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel TEXT NOT NULL,
+    item_id TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at REAL NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    UNIQUE (channel, item_id)
+)
+"""
+
+
+class EventOutbox:
+    """
+    Tabla outbox en SQLite compartida por los hilos del proceso.
+
+    Cada fila es una entrega pendiente a un canal (events:nats, events:kafka, webhooks...);
+    `add` inserta todas las filas de un evento en una sola transacción.
+    """
+
+    def __init__(self, path: str):
+        self.path = path
+        directory = os.path.dirname(path)
+        if directory:
+            os.makedirs(directory, exist_ok=True)
+        self.conn = sqlite3.connect(path, check_same_thread=False, isolation_level=None)
+        # WAL: las escrituras de emit() no esperan a las lecturas del despachador
+        self.conn.execute("PRAGMA journal_mode=WAL")
+        self.conn.execute("PRAGMA synchronous=FULL")
+        self.conn.execute(SCHEMA)
+        self.lock = threading.Lock()
+        self.counters = {"written": 0, "delivered": 0, "failed_attempts": 0}
+        pending = self.pending_count()
+        logger.info(format_log('CONFIG', 'Outbox de eventos', f"{path} ({pending} entregas pendientes)"))
+
+    def add(self, rows: Iterable[Tuple[str, str, Dict[str, Any]]]):
+        """Registra (canal, id, payload) de forma atómica; un id repetido en el canal se ignora."""
+        now = time.time()
+        values = [(channel, item_id, encrypt_value(json.dumps(payload)), now) for channel, item_id, payload in rows]
+        with self.lock:
+            self.conn.execute("BEGIN IMMEDIATE")
+            try:
+                self.conn.executemany(
+                    "INSERT OR IGNORE INTO outbox (channel, item_id, payload, created_at) VALUES (?, ?, ?, ?)", values
+                )
+                self.conn.execute("COMMIT")
+            except Exception:
+                self.conn.execute("ROLLBACK")
+                raise
+        self.counters["written"] += len(values)
+        metrics.incr("events.outbox_written", len(values))
+
+    def pending(self, channel: str, limit: int = 100) -> List[Tuple[str, Dict[str, Any], int]]:
+        """Entregas pendientes del canal en orden de escritura: (id, payload, intentos)."""
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT item_id, payload, attempts FROM outbox WHERE channel = ? ORDER BY seq LIMIT ?", (channel, limit)
+            ).fetchall()
+        return [(item_id, json.loads(decrypt_value(payload)), attempts) for item_id, payload, attempts in rows]
+
+    def done(self, channel: str, item_id: str):
+        """El destino confirmó la entrega (o la descartó definitivamente): se borra la fila."""
+        with self.lock:
+            self.conn.execute("DELETE FROM outbox WHERE channel = ? AND item_id = ?", (channel, item_id))
+        self.counters["delivered"] += 1
+
+    def failed(self, channel: str, item_id: str, error: str):
+        with self.lock:
+            self.conn.execute(
+                "UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE channel = ? AND item_id = ?",
+                (error[:500], channel, item_id),
+            )
+        self.counters["failed_attempts"] += 1
+        metrics.incr("events.outbox_failed", tags={"channel": channel})
+
+    def reencrypt(self) -> int:
+        """Vuelve a cifrar los payloads pendientes con la clave de datos actual."""
+        with self.lock:
+            rows = self.conn.execute("SELECT seq, payload FROM outbox").fetchall()
+            self.conn.execute("BEGIN IMMEDIATE")
+            try:
+                self.conn.executemany(
+                    "UPDATE outbox SET payload = ? WHERE seq = ?",
+                    [(encrypt_value(decrypt_value(payload)), seq) for seq, payload in rows],
+                )
+                self.conn.execute("COMMIT")
+            except Exception:
+                self.conn.execute("ROLLBACK")
+                raise
+        return len(rows)
+
+    def pending_count(self) -> int:
+        with self.lock:
+            return self.conn.execute("SELECT COUNT(*) FROM outbox").fetchone()[0]
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT channel, COUNT(*), MIN(created_at) FROM outbox GROUP BY channel"
+            ).fetchall()
+        channels = {
+            channel: {"pending": count, "oldest_seconds": int(time.time() - oldest)}
+            for channel, count, oldest in rows
+        }
+        for channel, info in channels.items():
+            metrics.gauge("events.outbox_pending", info["pending"], tags={"channel": channel})
+        return {"path": self.path, "channels": channels, **self.counters}
+
+
+def create_event_outbox() -> Optional[EventOutbox]:
+    """Outbox en EVENTS_OUTBOX_PATH, o None si no está configurado (cola en memoria)."""
+    path = os.getenv("EVENTS_OUTBOX_PATH")
+    if not path:
+        return None
+    return EventOutbox(path)
+
+
+# Compartido por lifecycle_events y los webhooks salientes
+event_outbox = create_event_outbox()
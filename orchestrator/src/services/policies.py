@@ -0,0 +1,249 @@
+"""
+Políticas de rechazo de jobs.
+Las reglas de JOB_POLICIES_FILE (YAML o JSON) describen jobs para los que no se
+aprovisiona runner: repositorios bloqueados, labels no permitidas, workflows o ramas,
+y jobs de pull requests desde forks que piden pools privilegiados. Un rechazo emite
+job.rejected y la métrica policies.rejected con la regla que lo causó, en lugar de
+escalar en silencio. Las reglas se recargan junto con los pools.
+"""
+
+import fnmatch
+import os
+import threading
+from typing import Any, Dict, List, Optional
+
+import yaml
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, PolicyRejectedError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+ACTIONS = ("reject", "audit")
+
+# Condiciones con lista de patrones glob (basta con que coincida uno)
+PATTERN_FIELDS = ("repos", "workflows", "branches", "labels", "pools", "events")
+RULE_FIELDS = ("name", "action", "reason", "fork", "privileged") + PATTERN_FIELDS
+
+# Eventos de un run cuyo código viene de la rama de la pull request
+PULL_REQUEST_EVENTS = ("pull_request", "pull_request_review", "pull_request_review_comment")
+
+# Runs consultados en GitHub que se recuerdan (origen y evento no cambian)
+RUN_CACHE_SIZE = 1000
+
+
+class PolicyRule:
+    """
+    Regla de rechazo: coincide si se cumplen todas las condiciones que define.
+
+    Las listas admiten comodines (acme/legacy-*, macos-*) y en `labels` basta con que una
+    label del job coincida. `fork` y `events` consultan el run en GitHub; `privileged`
+    coincide con pools de perfil de seguridad elevado o Docker-in-Docker. Con
+    action=audit la regla solo se registra y el runner se crea.
+    """
+
+    def __init__(self, spec: Dict[str, Any], source: str):
+        unknown = sorted(set(spec) - set(RULE_FIELDS))
+        if unknown:
+            raise ConfigurationError(f"{source}: campos desconocidos en la regla {spec.get('name', '?')}: {', '.join(unknown)}")
+        if not spec.get("name"):
+            raise ConfigurationError(f"{source}: cada regla requiere 'name'")
+        self.name: str = spec["name"]
+        self.action: str = spec.get("action", "reject")
+        if self.action not in ACTIONS:
+            raise ConfigurationError(f"{source}: regla {self.name}: action debe ser {' o '.join(ACTIONS)}")
+        self.reason: str = spec.get("reason") or "Job no permitido por las políticas de runners"
+        self.patterns: Dict[str, List[str]] = {}
+        for field in PATTERN_FIELDS:
+            value = spec.get(field)
+            if value is None:
+                continue
+            if not isinstance(value, list) or not all(isinstance(item, str) for item in value):
+                raise ConfigurationError(f"{source}: regla {self.name}: '{field}' debe ser una lista de patrones")
+            self.patterns[field] = value
+        self.fork: Optional[bool] = spec.get("fork")
+        self.privileged: Optional[bool] = spec.get("privileged")
+        if not self.patterns and self.fork is None and self.privileged is None:
+            raise ConfigurationError(f"{source}: la regla {self.name} no tiene condiciones")
+
+    @property
+    def needs_run(self) -> bool:
+        return self.fork is not None or "events" in self.patterns
+
+    @staticmethod
+    def _any(patterns: List[str], values: List[str]) -> bool:
+        return any(fnmatch.fnmatchcase(value.lower(), pattern.lower()) for pattern in patterns for value in values)
+
+    def matches(self, job: Dict[str, Any]) -> bool:
+        """
+        Evalúa la regla contra el job. Una condición sobre un dato que el job no trae
+        (p. ej. labels en el autoscaler, que solo conoce el repositorio) no coincide.
+        """
+        values = {
+            "repos": [job.get("repo")],
+            "workflows": [job.get("workflow")],
+            "branches": [job.get("branch")],
+            "labels": job.get("labels") or [],
+            "pools": [job["pool"].name] if job.get("pool") else [],
+            "events": [(job.get("run") or {}).get("event")],
+        }
+        for field, patterns in self.patterns.items():
+            present = [value for value in values[field] if value]
+            if not present or not self._any(patterns, present):
+                return False
+        if self.fork is not None:
+            run = job.get("run")
+            if run is None or run.get("fork") != self.fork:
+                return False
+        if self.privileged is not None:
+            pool = job.get("pool")
+            if pool is None or (pool.security.elevated or pool.enable_dind) != self.privileged:
+                return False
+        return True
+
+    def to_dict(self) -> Dict[str, Any]:
+        rule = {"name": self.name, "action": self.action, "reason": self.reason, **self.patterns}
+        if self.fork is not None:
+            rule["fork"] = self.fork
+        if self.privileged is not None:
+            rule["privileged"] = self.privileged
+        return rule
+
+
+class JobPolicies:
+    """Reglas de JOB_POLICIES_FILE evaluadas antes de aprovisionar cada runner."""
+
+    def __init__(self, path: str, fail_closed: bool = True):
+        self.path = path
+        # Sin poder consultar el run, las reglas de forks lo tratan como fork
+        self.fail_closed = fail_closed
+        self.rules: List[PolicyRule] = self._load()
+        self.runs: Dict[str, Dict[str, Any]] = {}
+        self.counters: Dict[str, int] = {}
+        self.lock = threading.Lock()
+        logger.info(format_log('CONFIG', 'Políticas de jobs cargadas', f"{len(self.rules)} reglas en {path}"))
+
+    def _load(self) -> List[PolicyRule]:
+        try:
+            with open(self.path, "r") as policies_file:
+                data = yaml.safe_load(policies_file) or {}
+        except (OSError, yaml.YAMLError) as e:
+            raise ConfigurationError(f"No se pudo leer JOB_POLICIES_FILE {self.path}: {e}")
+        specs = data.get("rules", []) if isinstance(data, dict) else data
+        if not isinstance(specs, list):
+            raise ConfigurationError(f"JOB_POLICIES_FILE {self.path}: se esperaba una lista de reglas")
+        rules = [PolicyRule(spec, self.path) for spec in specs]
+        names = [rule.name for rule in rules]
+        duplicated = sorted({name for name in names if names.count(name) > 1})
+        if duplicated:
+            raise ConfigurationError(f"JOB_POLICIES_FILE {self.path}: reglas duplicadas: {', '.join(duplicated)}")
+        return rules
+
+    def reload(self) -> List[str]:
+        """Vuelve a leer las reglas; si son inválidas se conservan las actuales. Devuelve las cambiadas."""
+        rules = self._load()
+        with self.lock:
+            previous = {rule.name: rule.to_dict() for rule in self.rules}
+            current = {rule.name: rule.to_dict() for rule in rules}
+            changed = sorted(name for name in set(previous) | set(current) if previous.get(name) != current.get(name))
+            self.rules = rules
+        if changed:
+            logger.info(format_log('CONFIG', 'Políticas de jobs recargadas', ", ".join(changed)))
+        return changed
+
+    def _run(self, github: Any, repo: str, run_id: Optional[str]) -> Optional[Dict[str, Any]]:
+        """Evento del run y si viene de un fork; None si no se pudo consultar."""
+        if not run_id:
+            # Sin run (peticiones manuales, autoscaler): las reglas sobre forks y eventos no aplican
+            return None
+        with self.lock:
+            cached = self.runs.get(str(run_id))
+        if cached:
+            return cached
+        try:
+            if not github:
+                raise RuntimeError("sin cliente de GitHub")
+            response = github.get(f"repos/{repo}/actions/runs/{run_id}")
+            if response is None or response.status_code != 200:
+                raise RuntimeError(f"HTTP {response.status_code if response is not None else 'sin respuesta'}")
+            data = response.json()
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudo consultar el run para las políticas', f"{repo} run {run_id}: {e}"))
+            return {"event": None, "fork": True} if self.fail_closed else None
+        head = (data.get("head_repository") or {}).get("full_name")
+        base = (data.get("repository") or {}).get("full_name") or repo
+        run = {
+            "event": data.get("event"),
+            "fork": data.get("event") in PULL_REQUEST_EVENTS and bool(head) and head.lower() != base.lower(),
+        }
+        with self.lock:
+            if len(self.runs) >= RUN_CACHE_SIZE:
+                self.runs.pop(next(iter(self.runs)))
+            self.runs[str(run_id)] = run
+        return run
+
+    def evaluate(self, job: Dict[str, Any], github: Any = None) -> Optional[PolicyRule]:
+        """
+        Primera regla de rechazo que coincide con el job (las de auditoría solo se registran).
+
+        Args:
+            job: repo, pool (RunnerPool) y, si se conocen, labels, workflow, branch, run_id, job_id
+            github: Cliente de GitHub para las reglas sobre forks y eventos del run
+        """
+        with self.lock:
+            rules = list(self.rules)
+        if any(rule.needs_run for rule in rules) and job.get("repo"):
+            job = {**job, "run": self._run(github, job["repo"], job.get("run_id"))}
+        for rule in rules:
+            if not rule.matches(job):
+                continue
+            self._record(rule, job)
+            if rule.action == "reject":
+                return rule
+        return None
+
+    def check(self, job: Dict[str, Any], github: Any = None):
+        """
+        Raises:
+            PolicyRejectedError: Si una regla de rechazo coincide con el job
+        """
+        rule = self.evaluate(job, github)
+        if rule:
+            raise PolicyRejectedError(f"{rule.reason} (política {rule.name})")
+
+    def _record(self, rule: PolicyRule, job: Dict[str, Any]):
+        pool = job["pool"].name if job.get("pool") else None
+        with self.lock:
+            self.counters[rule.name] = self.counters.get(rule.name, 0) + 1
+        if rule.action == "audit":
+            metrics.incr("policies.audited", tags={"rule": rule.name})
+            logger.info(format_log('INFO', 'Job coincide con política de auditoría', f"{rule.name}: {job.get('repo')} job {job.get('job_id') or '-'}"))
+            return
+        metrics.incr("policies.rejected", tags={"rule": rule.name, "pool": pool or "-"})
+        logger.warning(format_log(
+            'WARNING', 'Job rechazado por política',
+            f"{rule.name}: {job.get('repo')} job {job.get('job_id') or '-'} (pool {pool or '-'}, "
+            f"labels {', '.join(job.get('labels') or []) or '-'}): {rule.reason}"
+        ))
+        lifecycle_events.emit(
+            "job.rejected", key=job.get("repo") or "",
+            repository=job.get("repo"), job_id=job.get("job_id"), run_id=job.get("run_id"),
+            workflow=job.get("workflow"), branch=job.get("branch"), labels=job.get("labels") or [],
+            pool=pool, fork=(job.get("run") or {}).get("fork"), rule=rule.name, reason=rule.reason,
+        )
+
+    def describe(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return [{**rule.to_dict(), "matches": self.counters.get(rule.name, 0)} for rule in self.rules]
+
+
+def create_job_policies() -> Optional[JobPolicies]:
+    """Políticas de JOB_POLICIES_FILE; None si no está definido."""
+    path = os.getenv("JOB_POLICIES_FILE")
+    if not path:
+        return None
+    return JobPolicies(path, fail_closed=os.getenv("JOB_POLICY_FAIL_CLOSED", "true").lower() == "true")
+
+
+job_policies = create_job_policies()
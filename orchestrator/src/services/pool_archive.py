@@ -0,0 +1,227 @@
+"""
+Archivo de pools: retirada, snapshots y restauración.
+Un pool retirado conserva su configuración y su historial (registro de uso, métricas)
+pero no acepta runners nuevos; los que ya corren terminan sus jobs. Los snapshots
+guardan la definición de un pool en un momento dado y se pueden restaurar con el
+mismo nombre (si la configuración ya no lo define) o clonar con otro para
+experimentar. El estado se persiste en POOL_ARCHIVE_FILE y se aplica sobre los pools
+de la configuración en cada carga y recarga.
+"""
+
+import datetime
+import json
+import os
+import threading
+import uuid
+from typing import Any, Dict, List, Optional
+
+from src.services.lifecycle_events import lifecycle_events
+from src.services.pools import DEFAULT_POOL, PoolRegistry, RunnerPool
+from src.utils.helpers import ConfigurationError, ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+def _now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).isoformat()
+
+
+def pool_spec(pool: RunnerPool) -> Dict[str, Any]:
+    """Definición del pool sin el último escaneo de imagen."""
+    return {key: value for key, value in pool.to_dict().items() if key != "image_scan"}
+
+
+class PoolArchive:
+    """Pools retirados, snapshots y pools restaurados o clonados desde un snapshot."""
+
+    def __init__(self, state_file: str):
+        self.state_file = state_file
+        # nombre -> {"spec", "reason", "retired_by", "retired_at", "snapshot"}
+        self.retired: Dict[str, Dict[str, Any]] = {}
+        # id -> {"id", "pool", "spec", "note", "created_by", "created_at"}
+        self.snapshots: Dict[str, Dict[str, Any]] = {}
+        # nombre -> {"spec", "snapshot", "created_by", "created_at"}: pools que no están en la configuración
+        self.pools: Dict[str, Dict[str, Any]] = {}
+        # nombre -> labels que reemplazan las de la configuración (operaciones masivas de retag)
+        self.labels: Dict[str, List[str]] = {}
+        self.lock = threading.Lock()
+        self._load_state()
+
+    def _load_state(self):
+        if not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                data = json.load(state)
+            self.retired = data.get("retired", {})
+            self.snapshots = {item["id"]: item for item in data.get("snapshots", [])}
+            self.pools = data.get("pools", {})
+            self.labels = data.get("labels", {})
+            logger.info(format_log(
+                'CONFIG', 'Archivo de pools cargado',
+                f"{len(self.retired)} retirados, {len(self.snapshots)} snapshots, {len(self.pools)} restaurados",
+            ))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el archivo de pools', str(e)))
+
+    def _save_state(self):
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            json.dump({
+                "retired": self.retired,
+                "snapshots": list(self.snapshots.values()),
+                "pools": self.pools,
+                "labels": self.labels,
+            }, state)
+        os.replace(tmp_file, self.state_file)
+
+    def apply(self, registry: PoolRegistry) -> PoolRegistry:
+        """
+        Aplica el archivo a un registro recién cargado: agrega los pools restaurados o
+        clonados, reemplaza las labels cambiadas y aparta los retirados. Un pool retirado
+        que la configuración ya no define se reconstruye con la definición conservada.
+        """
+        with self.lock:
+            pools = dict(self.pools)
+            retired = dict(self.retired)
+            labels = dict(self.labels)
+        for name, entry in pools.items():
+            if name in registry.pools:
+                logger.warning(format_log('WARNING', 'Pool restaurado ignorado: ya existe en la configuración', name))
+                continue
+            try:
+                registry.pools[name] = RunnerPool.from_dict(entry["spec"])
+            except ConfigurationError as e:
+                logger.error(format_log('ERROR', f'Pool restaurado {name} inválido', str(e)))
+        for name, pool_labels in labels.items():
+            if name in registry.pools:
+                registry.pools[name].labels = list(pool_labels)
+        for name, entry in retired.items():
+            pool = registry.pools.pop(name, None)
+            if pool is None:
+                try:
+                    pool = RunnerPool.from_dict(entry["spec"])
+                except ConfigurationError as e:
+                    logger.error(format_log('ERROR', f'Pool retirado {name} inválido', str(e)))
+                    continue
+                registry.retained.add(name)
+            if name in labels:
+                pool.labels = list(labels[name])
+            registry.retired[name] = pool
+        return registry
+
+    # ===== Retirada =====
+
+    def retire(self, pool: RunnerPool, reason: str = "", retired_by: str = "", snapshot_id: Optional[str] = None) -> Dict[str, Any]:
+        """Retira un pool guardando antes un snapshot de su definición."""
+        if pool.name == DEFAULT_POOL:
+            raise ValidationError("El pool default no se puede retirar")
+        with self.lock:
+            if pool.name in self.retired:
+                raise ValidationError(f"El pool {pool.name} ya está retirado")
+        snapshot = self.snapshot(pool, note=f"Retirada: {reason}" if reason else "Retirada", created_by=retired_by, snapshot_id=snapshot_id)
+        entry = {
+            "spec": snapshot["spec"], "reason": reason, "retired_by": retired_by,
+            "retired_at": _now(), "snapshot": snapshot["id"],
+        }
+        with self.lock:
+            self.retired[pool.name] = entry
+            self._save_state()
+        logger.warning(format_log('WARNING', 'Pool retirado', f"{pool.name} por {retired_by or '-'}: {reason or '-'}"))
+        lifecycle_events.emit("pool.retired", key=pool.name, pool=pool.name, reason=reason, retired_by=retired_by, snapshot=snapshot["id"])
+        return {"name": pool.name, **entry}
+
+    def unretire(self, name: str, restored_by: str = "", retained: bool = False) -> Dict[str, Any]:
+        """
+        Vuelve a aceptar runners en un pool retirado. Con `retained` (la configuración ya
+        no lo define) el pool se conserva como restaurado con su definición archivada.
+        """
+        with self.lock:
+            entry = self.retired.pop(name, None)
+            if entry is None:
+                raise ValueError(f"El pool {name} no está retirado")
+            if retained:
+                self.pools[name] = {"spec": entry["spec"], "snapshot": entry["snapshot"], "created_by": restored_by, "created_at": _now()}
+            self._save_state()
+        logger.info(format_log('SUCCESS', 'Pool restaurado', f"{name} por {restored_by or '-'}"))
+        lifecycle_events.emit("pool.restored", key=name, pool=name, restored_by=restored_by, snapshot=entry["snapshot"])
+        return {"name": name, **entry}
+
+    # ===== Labels =====
+
+    def set_labels(self, name: str, labels: List[str]):
+        """Conserva las labels de un pool entre recargas de la configuración."""
+        with self.lock:
+            self.labels[name] = list(labels)
+            self._save_state()
+
+    # ===== Snapshots =====
+
+    def snapshot(self, pool: RunnerPool, note: str = "", created_by: str = "", snapshot_id: Optional[str] = None) -> Dict[str, Any]:
+        snapshot = {
+            "id": snapshot_id or str(uuid.uuid4()), "pool": pool.name, "spec": pool_spec(pool),
+            "note": note, "created_by": created_by, "created_at": _now(),
+        }
+        with self.lock:
+            if snapshot["id"] in self.snapshots:
+                raise ValidationError(f"El snapshot {snapshot['id']} ya existe")
+            self.snapshots[snapshot["id"]] = snapshot
+            self._save_state()
+        logger.info(format_log('SUCCESS', 'Snapshot de pool guardado', f"{pool.name} ({snapshot['id']})"))
+        return dict(snapshot)
+
+    def list_snapshots(self, pool: Optional[str] = None) -> List[Dict[str, Any]]:
+        with self.lock:
+            snapshots = [dict(item) for item in self.snapshots.values() if pool is None or item["pool"] == pool]
+        return sorted(snapshots, key=lambda item: item["created_at"], reverse=True)
+
+    def restore(
+        self,
+        snapshot_id: str,
+        registry: PoolRegistry,
+        name: Optional[str] = None,
+        created_by: str = "",
+        changes: Optional[Dict[str, Any]] = None,
+    ) -> RunnerPool:
+        """
+        Crea un pool a partir de un snapshot: con su nombre original si ya no existe, o
+        clonado con `name` y, opcionalmente, opciones cambiadas (`changes`). El pool se
+        guarda en el archivo y se agrega al registro.
+
+        Raises:
+            ValidationError: Si el nombre ya lo usa un pool activo o retirado
+        """
+        with self.lock:
+            snapshot = self.snapshots.get(snapshot_id)
+        if not snapshot:
+            raise ValueError(f"Snapshot {snapshot_id} no encontrado")
+        name = name or snapshot["pool"]
+        if name in registry.pools:
+            raise ValidationError(f"El pool {name} ya existe; restaura el snapshot con otro nombre")
+        if name in registry.retired:
+            raise ValidationError(f"El pool {name} está retirado; restáuralo o usa otro nombre")
+        pool = RunnerPool.from_dict({**snapshot["spec"], **(changes or {}), "name": name})
+        with self.lock:
+            self.pools[name] = {"spec": pool_spec(pool), "snapshot": snapshot_id, "created_by": created_by, "created_at": _now()}
+            self._save_state()
+        registry.pools[name] = pool
+        action = "clonado" if name != snapshot["pool"] else "restaurado"
+        logger.info(format_log('SUCCESS', f'Pool {action} desde snapshot', f"{snapshot['pool']} -> {name} ({snapshot_id})"))
+        lifecycle_events.emit(
+            "pool.restored", key=name, pool=name, source_pool=snapshot["pool"], snapshot=snapshot_id, restored_by=created_by,
+        )
+        return pool
+
+
+def create_pool_archive() -> Optional[PoolArchive]:
+    """Archivo de pools si POOL_ARCHIVE_FILE está definido."""
+    state_file = os.getenv("POOL_ARCHIVE_FILE")
+    if not state_file:
+        return None
+    directory = os.path.dirname(state_file)
+    if directory:
+        os.makedirs(directory, exist_ok=True)
+    return PoolArchive(state_file)
+
+
+pool_archive = create_pool_archive()
@@ -0,0 +1,463 @@
+"""
+Pools de runners.
+Un pool agrupa la configuración con la que se lanzan runners (labels, imagen,
+Docker-in-Docker y perfil de seguridad del contenedor) y el backend donde corren:
+contenedores en el Docker local, procesos en hosts estáticos por SSH, tareas de
+ECS/Fargate o VMs de Azure y Compute Engine.
+"""
+
+import json
+import os
+from typing import Any, Dict, List, Optional
+
+from src.services.azure import validate_pool_spec as validate_azure_spec
+from src.services.capabilities import capabilities
+from src.services.gce import validate_pool_spec as validate_gce_spec
+from src.services.gitops import create_pool_spec_source
+from src.services.naming import validate_template
+from src.services.network_rules import validate_egress
+from src.services.regions import validate_regions
+from src.services.resource_classes import resource_classes as known_classes
+from src.services.runner_networks import validate_network
+from src.services.security_events import security_events
+from src.services.sidecars import validate_sidecars
+from src.services.workspaces import validate_workspace
+from src.utils import config_file
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+DEFAULT_POOL = "default"
+
+BACKENDS = ("docker", "ssh", "ecs", "azure", "gce")
+
+# Fuente GitOps (POOLS_SPEC_DIR o POOLS_GIT_REPO); tiene prioridad sobre los archivos de pools
+spec_source = create_pool_spec_source()
+
+# Perfil endurecido aplicado salvo que el pool indique lo contrario: seccomp y
+# AppArmor por defecto de Docker forzados explícitamente, sin escalada de
+# privilegios (setuid) y sin capacidades que un job de CI no necesita.
+HARDENED_SECURITY = {
+    "seccomp": "default",
+    "apparmor": "docker-default",
+    "no_new_privileges": True,
+    "cap_drop": ["NET_RAW", "MKNOD", "AUDIT_WRITE"],
+    "cap_add": [],
+    "privileged": False,
+}
+
+# Escape para pools que realmente necesitan más privilegios
+UNCONFINED_SECURITY = {
+    "seccomp": "unconfined",
+    "apparmor": "unconfined",
+    "no_new_privileges": False,
+    "cap_drop": [],
+    "cap_add": [],
+    "privileged": False,
+}
+
+SECURITY_PRESETS = {"hardened": HARDENED_SECURITY, "unconfined": UNCONFINED_SECURITY}
+
+
+class SecurityProfile:
+    """Opciones de seguridad del contenedor de un runner."""
+
+    def __init__(self, spec: Optional[Dict[str, Any]] = None):
+        spec = dict(spec or {})
+        preset = spec.pop("preset", "hardened")
+        if preset not in SECURITY_PRESETS:
+            raise ConfigurationError(f"Preset de seguridad desconocido: {preset}")
+
+        values = {**SECURITY_PRESETS[preset], **spec}
+        self.preset = preset
+        self.seccomp: str = values["seccomp"]
+        self.apparmor: str = values["apparmor"]
+        self.no_new_privileges: bool = bool(values["no_new_privileges"])
+        self.cap_drop: List[str] = list(values["cap_drop"])
+        self.cap_add: List[str] = list(values["cap_add"])
+        self.privileged: bool = bool(values["privileged"])
+
+    def _seccomp_option(self) -> Optional[str]:
+        """Traduce el perfil seccomp a opción de Docker (los archivos se envían inline)."""
+        if self.seccomp in ("default", ""):
+            return None
+        if self.seccomp == "unconfined":
+            return "seccomp=unconfined"
+        try:
+            with open(self.seccomp, "r") as profile_file:
+                return f"seccomp={json.dumps(json.load(profile_file))}"
+        except (OSError, ValueError) as e:
+            raise ConfigurationError(f"No se pudo cargar el perfil seccomp {self.seccomp}: {e}")
+
+    def docker_options(self) -> Dict[str, Any]:
+        """Retorna security_opt, cap_add, cap_drop y privileged para containers.run."""
+        security_opt = []
+        seccomp = self._seccomp_option()
+        if seccomp:
+            security_opt.append(seccomp)
+        if self.apparmor:
+            security_opt.append(f"apparmor={self.apparmor}")
+        if self.no_new_privileges:
+            security_opt.append("no-new-privileges:true")
+
+        return {
+            "security_opt": security_opt,
+            "cap_add": self.cap_add or None,
+            "cap_drop": self.cap_drop or None,
+            "privileged": self.privileged,
+        }
+
+    @property
+    def elevated(self) -> bool:
+        """Indica si el perfil otorga más privilegios que el endurecido por defecto."""
+        return (
+            self.privileged
+            or self.seccomp == "unconfined"
+            or self.apparmor == "unconfined"
+            or not self.no_new_privileges
+            or bool(self.cap_add)
+        )
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "preset": self.preset,
+            "seccomp": self.seccomp,
+            "apparmor": self.apparmor,
+            "no_new_privileges": self.no_new_privileges,
+            "cap_drop": self.cap_drop,
+            "cap_add": self.cap_add,
+            "privileged": self.privileged,
+        }
+
+
+def validate_prewarm(name: str, prewarm: Any):
+    """Valida el bloque "prewarm" de un pool (scope, scope_name y max)."""
+    if not isinstance(prewarm, dict):
+        raise ConfigurationError(f"Pool {name}: prewarm debe ser un objeto")
+    unknown = sorted(set(prewarm) - {"scope", "scope_name", "max"})
+    if unknown:
+        raise ConfigurationError(f"Pool {name}: campos desconocidos en prewarm: {', '.join(unknown)}")
+    if prewarm.get("scope") not in ("repo", "org") or not prewarm.get("scope_name"):
+        raise ConfigurationError(f"Pool {name}: prewarm requiere scope (repo u org) y scope_name")
+    if not isinstance(prewarm.get("max", 5), int) or prewarm.get("max", 5) < 1:
+        raise ConfigurationError(f"Pool {name}: prewarm.max debe ser un entero positivo")
+
+
+class RunnerPool:
+    """Configuración con nombre para lanzar runners."""
+
+    def __init__(
+        self,
+        name: str,
+        labels: Optional[List[str]] = None,
+        image: Optional[str] = None,
+        runner_group: Optional[str] = None,
+        enable_dind: bool = False,
+        security: Optional[Dict[str, Any]] = None,
+        verify_signature: bool = True,
+        egress_proxy: bool = False,
+        scan_vulnerabilities: bool = True,
+        name_template: Optional[str] = None,
+        label_templates: Optional[List[str]] = None,
+        registry_mirror: bool = True,
+        tool_cache: bool = False,
+        backend: str = "docker",
+        ssh_hosts: Optional[List[str]] = None,
+        docker_hosts: Optional[List[str]] = None,
+        task_cpu: Optional[str] = None,
+        task_memory: Optional[str] = None,
+        task_architecture: Optional[str] = None,
+        azure: Optional[Dict[str, Any]] = None,
+        gce: Optional[Dict[str, Any]] = None,
+        tenant: Optional[str] = None,
+        priority: bool = False,
+        prewarm: Optional[Dict[str, Any]] = None,
+        workspace: Optional[Dict[str, Any]] = None,
+        resource_class: Optional[str] = None,
+        resource_classes: Optional[List[str]] = None,
+        network: Optional[Dict[str, Any]] = None,
+        sidecars: Optional[List[Dict[str, Any]]] = None,
+        capability_labels: Optional[bool] = None,
+        regions: Optional[List[Dict[str, Any]]] = None,
+        egress_cidrs: Optional[List[str]] = None,
+    ):
+        if backend not in BACKENDS:
+            raise ConfigurationError(f"Pool {name}: backend desconocido {backend} ({', '.join(BACKENDS)})")
+        if backend == "ecs" and (enable_dind or egress_proxy):
+            raise ConfigurationError(f"Pool {name}: Fargate no admite Docker-in-Docker ni el proxy de salida local")
+        if task_architecture not in (None, "X86_64", "ARM64"):
+            raise ConfigurationError(f"Pool {name}: task_architecture debe ser X86_64 o ARM64")
+        if backend in ("azure", "gce") and (enable_dind or egress_proxy):
+            raise ConfigurationError(f"Pool {name}: los pools de VMs no admiten Docker-in-Docker ni el proxy de salida local")
+        if backend == "azure":
+            validate_azure_spec(name, azure or {})
+        if backend == "gce":
+            validate_gce_spec(name, gce or {})
+        if prewarm is not None:
+            validate_prewarm(name, prewarm)
+        if workspace is not None:
+            validate_workspace(name, workspace)
+        if docker_hosts and backend != "docker":
+            raise ConfigurationError(f"Pool {name}: docker_hosts solo se aplica al backend docker")
+        if network is not None:
+            if backend != "docker":
+                raise ConfigurationError(f"Pool {name}: network solo se aplica a los contenedores del backend docker")
+            validate_network(name, network)
+        if sidecars:
+            if backend != "docker":
+                raise ConfigurationError(f"Pool {name}: sidecars solo se aplica a los contenedores del backend docker")
+            # Los sidecars se alcanzan por nombre en la red propia del runner
+            if (network or {}).get("isolated") is False:
+                raise ConfigurationError(f"Pool {name}: sidecars requiere la red propia del runner (network.isolated)")
+            validate_sidecars(name, sidecars)
+        if regions:
+            validate_regions(name, backend, regions)
+            # Las opciones de VM de cada región, combinadas con las del pool, deben ser válidas
+            for region in regions:
+                if backend == "azure":
+                    validate_azure_spec(f"{name} ({region['name']})", {**(azure or {}), **region["azure"]})
+                elif backend == "gce":
+                    validate_gce_spec(f"{name} ({region['name']})", {**(gce or {}), **region["gce"]})
+        if egress_cidrs is not None:
+            validate_egress(name, backend, egress_cidrs)
+            # Las reglas son por pool en una sola red y se asocian al crear cada VM (no a las precalentadas ni a las de un scale set)
+            if regions:
+                raise ConfigurationError(f"Pool {name}: egress_cidrs no se combina con regions")
+            if backend == "azure" and ((azure or {}).get("vmss") or (azure or {}).get("warm")):
+                raise ConfigurationError(f"Pool {name}: egress_cidrs requiere VMs de imagen sin warm (no vmss)")
+        if capability_labels not in (None, True, False):
+            raise ConfigurationError(f"Pool {name}: capability_labels debe ser true o false")
+        for class_name in ([resource_class] if resource_class else []) + list(resource_classes or []):
+            if class_name not in known_classes.classes:
+                raise ConfigurationError(f"Pool {name}: clase de recursos desconocida {class_name} ({', '.join(known_classes.classes)})")
+        self.name = name
+        self.labels = labels or []
+        self.image = image
+        self.runner_group = runner_group
+        self.enable_dind = enable_dind
+        self.security = SecurityProfile(security)
+        self.verify_signature = verify_signature
+        self.egress_proxy = egress_proxy
+        self.scan_vulnerabilities = scan_vulnerabilities
+        self.name_template = validate_template(name_template, f"Pool {name}: name_template", True) if name_template else None
+        self.label_templates = [validate_template(item, f"Pool {name}: label_templates") for item in label_templates or []]
+        self.registry_mirror = registry_mirror
+        self.tool_cache = tool_cache
+        self.backend = backend
+        # Hosts SSH del pool por nombre, label o grupo del inventario (vacío = todos)
+        self.ssh_hosts = ssh_hosts or []
+        # Hosts Docker del pool por nombre o label de DOCKER_HOSTS_FILE (vacío = todos)
+        self.docker_hosts = docker_hosts or []
+        # Tamaño de la tarea de Fargate (unidades de CPU y MiB, como en la task definition)
+        self.task_cpu = str(task_cpu) if task_cpu else None
+        self.task_memory = str(task_memory) if task_memory else None
+        self.task_architecture = task_architecture
+        # VM de Azure: scale set o imagen de galería, tamaño, spot y sistema operativo
+        self.azure = dict(azure or {})
+        # Instancia de Compute Engine: instance template, zonas por preferencia y spot/preemptible
+        self.gce = dict(gce or {})
+        # Tenant dueño del pool (ver tenants.py); sin tenant el pool es compartido
+        self.tenant = tenant
+        # Pool prioritario: sigue escalando con el tope de gasto congelado (ver budgets.py)
+        self.priority = priority
+        # Precalentado según la previsión de demanda: scope donde se registran los runners y máximo
+        self.prewarm = dict(prewarm) if prewarm else None
+        # Cuota de disco del workspace (ver workspaces.py); None usa WORKSPACE_QUOTA
+        self.workspace = dict(workspace) if workspace is not None else None
+        # Clase de recursos sin label size-* en el job y clases admitidas (vacío = todas)
+        self.resource_class = resource_class
+        self.resource_classes = list(resource_classes or [])
+        # Clase aplicada a la copia del pool con la que se crea un runner (ver resource_classes.py)
+        self.resources: Optional[Any] = None
+        # Red propia por runner y contenedores de servicio (ver runner_networks.py); None usa RUNNER_NETWORK_ISOLATION
+        self.network = dict(network) if network is not None else None
+        # Contenedores de servicio que acompañan a cada runner (ver sidecars.py)
+        self.sidecars = [dict(spec) for spec in sidecars or []]
+        # Labels de capacidades de la máquina (ver capabilities.py); None usa RUNNER_CAPABILITY_LABELS
+        self.capability_labels = capability_labels
+        # Regiones por preferencia con failover (ver regions.py); vacío = solo las opciones del pool
+        self.regions = [dict(region) for region in regions or []]
+        # Región aplicada a la copia del pool con la que se crea un runner
+        self.region: Optional[str] = None
+        # Destinos de salida permitidos además de GitHub (ver network_rules.py); None no restringe
+        self.egress_cidrs = [str(cidr) for cidr in egress_cidrs] if egress_cidrs is not None else None
+        # Último escaneo de la imagen (SBOM y vulnerabilidades), si está activado
+        self.image_scan: Optional[Dict[str, Any]] = None
+
+        if self.egress_proxy and self.enable_dind:
+            # Con el socket de Docker el job puede lanzar contenedores fuera de la red filtrada
+            logger.warning(format_log('WARNING', 'Pool con proxy de salida y Docker-in-Docker', name))
+
+        if self.security.privileged:
+            logger.warning(format_log('WARNING', 'Pool con contenedores privilegiados', name))
+        if self.security.elevated:
+            security_events.emit("pool.elevated_privileges_configured", pool=name, security=self.security.to_dict())
+
+    @classmethod
+    def from_dict(cls, spec: Dict[str, Any]) -> "RunnerPool":
+        if not spec.get("name"):
+            raise ConfigurationError("Cada pool requiere 'name'")
+        return cls(
+            name=spec["name"],
+            labels=spec.get("labels"),
+            image=spec.get("image"),
+            runner_group=spec.get("runner_group"),
+            enable_dind=spec.get("enable_dind", False),
+            security=spec.get("security"),
+            verify_signature=spec.get("verify_signature", True),
+            egress_proxy=spec.get("egress_proxy", False),
+            scan_vulnerabilities=spec.get("scan_vulnerabilities", True),
+            name_template=spec.get("name_template"),
+            label_templates=spec.get("label_templates"),
+            registry_mirror=spec.get("registry_mirror", True),
+            tool_cache=spec.get("tool_cache", False),
+            backend=spec.get("backend", "docker"),
+            ssh_hosts=spec.get("ssh_hosts"),
+            docker_hosts=spec.get("docker_hosts"),
+            task_cpu=spec.get("task_cpu"),
+            task_memory=spec.get("task_memory"),
+            task_architecture=spec.get("task_architecture"),
+            azure=spec.get("azure"),
+            gce=spec.get("gce"),
+            tenant=spec.get("tenant"),
+            priority=spec.get("priority", False),
+            prewarm=spec.get("prewarm"),
+            workspace=spec.get("workspace"),
+            resource_class=spec.get("resource_class"),
+            resource_classes=spec.get("resource_classes"),
+            network=spec.get("network"),
+            sidecars=spec.get("sidecars"),
+            capability_labels=spec.get("capability_labels"),
+            regions=spec.get("regions"),
+            egress_cidrs=spec.get("egress_cidrs"),
+        )
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "labels": self.labels,
+            "image": self.image,
+            "runner_group": self.runner_group,
+            "enable_dind": self.enable_dind,
+            "security": self.security.to_dict(),
+            "verify_signature": self.verify_signature,
+            "egress_proxy": self.egress_proxy,
+            "scan_vulnerabilities": self.scan_vulnerabilities,
+            "name_template": self.name_template,
+            "label_templates": self.label_templates,
+            "registry_mirror": self.registry_mirror,
+            "tool_cache": self.tool_cache,
+            "backend": self.backend,
+            "ssh_hosts": self.ssh_hosts,
+            "docker_hosts": self.docker_hosts,
+            "task_cpu": self.task_cpu,
+            "task_memory": self.task_memory,
+            "task_architecture": self.task_architecture,
+            "azure": self.azure,
+            "gce": self.gce,
+            "tenant": self.tenant,
+            "priority": self.priority,
+            "prewarm": self.prewarm,
+            "workspace": self.workspace,
+            "resource_class": self.resource_class,
+            "resource_classes": self.resource_classes,
+            "network": self.network,
+            "sidecars": self.sidecars,
+            "capability_labels": self.capability_labels,
+            "capabilities": capabilities.get(self.name),
+            "regions": self.regions,
+            "egress_cidrs": self.egress_cidrs,
+            "image_scan": self.image_scan,
+        }
+
+
+class PoolRegistry:
+    """Pools disponibles; siempre incluye el pool 'default'."""
+
+    def __init__(self, pools: Optional[List[RunnerPool]] = None):
+        self.pools: Dict[str, RunnerPool] = {DEFAULT_POOL: RunnerPool(DEFAULT_POOL)}
+        for pool in pools or []:
+            self.pools[pool.name] = pool
+        # Pools retirados (ver pool_archive.py): conservan su definición pero no aceptan runners
+        self.retired: Dict[str, RunnerPool] = {}
+        # Retirados que la configuración ya no define (reconstruidos desde el archivo)
+        self.retained: set = set()
+
+    def get(self, name: Optional[str] = None) -> RunnerPool:
+        """Retorna el pool indicado (o el default)."""
+        pool = self.pools.get(name or DEFAULT_POOL)
+        if not pool:
+            if name in self.retired:
+                raise ValueError(f"Pool {name} retirado: no acepta runners nuevos")
+            raise ValueError(f"Pool no encontrado: {name}")
+        return pool
+
+    def list(self) -> List[Dict[str, Any]]:
+        return [pool.to_dict() for pool in self.pools.values()] + [
+            {**pool.to_dict(), "retired": True} for pool in self.retired.values()
+        ]
+
+
+def load_pools(path: Optional[str] = None) -> PoolRegistry:
+    """
+    Carga pools desde la fuente GitOps (POOLS_SPEC_DIR o POOLS_GIT_REPO), desde
+    RUNNER_POOLS_FILE (JSON con lista de pools o {"pools": [...]}) o, si no está
+    definido, desde la sección orchestrator.pools de CONFIG_FILE.
+
+    Returns:
+        Registro de pools; sin archivo solo existe el pool 'default'
+    """
+    if spec_source and not path:
+        registry = PoolRegistry([RunnerPool.from_dict(spec) for spec in spec_source.load()])
+        revision = f" ({spec_source.revision[:12]})" if spec_source.revision else ""
+        logger.info(format_log('CONFIG', f'Pools cargados desde {spec_source.description}{revision}', ", ".join(registry.pools)))
+        return registry
+
+    path = path or os.getenv("RUNNER_POOLS_FILE")
+    if not path:
+        if not config_file.FILE_POOLS:
+            return PoolRegistry()
+        registry = PoolRegistry([RunnerPool.from_dict(spec) for spec in config_file.FILE_POOLS])
+        logger.info(format_log('CONFIG', 'Pools cargados desde CONFIG_FILE', ", ".join(registry.pools)))
+        return registry
+
+    try:
+        with open(path, "r") as pools_file:
+            data = json.load(pools_file)
+    except (OSError, ValueError) as e:
+        raise ConfigurationError(f"No se pudo leer RUNNER_POOLS_FILE {path}: {e}")
+
+    specs = data.get("pools", []) if isinstance(data, dict) else data
+    registry = PoolRegistry([RunnerPool.from_dict(spec) for spec in specs])
+    logger.info(format_log('CONFIG', 'Pools cargados', ", ".join(registry.pools)))
+    return registry
+
+
+def reload_pools() -> PoolRegistry:
+    """
+    Vuelve a leer la definición de pools (fuente GitOps, RUNNER_POOLS_FILE o CONFIG_FILE).
+
+    Raises:
+        ConfigurationError: Si la nueva definición es inválida; el llamador conserva la anterior
+    """
+    if not os.getenv("RUNNER_POOLS_FILE") and os.getenv("CONFIG_FILE"):
+        try:
+            config_file.load_config_file()
+        except config_file.ConfigFileError as e:
+            raise ConfigurationError(str(e))
+    return load_pools()
+
+
+def diff_pools(current: PoolRegistry, new: PoolRegistry) -> Dict[str, List[str]]:
+    """Pools agregados, eliminados y modificados entre dos registros."""
+    def spec(pool: RunnerPool) -> Dict[str, Any]:
+        return {key: value for key, value in pool.to_dict().items() if key != "image_scan"}
+
+    return {
+        "added": sorted(set(new.pools) - set(current.pools)),
+        "removed": sorted(set(current.pools) - set(new.pools)),
+        "changed": sorted(
+            name for name in set(current.pools) & set(new.pools)
+            if spec(current.pools[name]) != spec(new.pools[name])
+        ),
+    }
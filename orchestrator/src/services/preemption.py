@@ -0,0 +1,237 @@
+"""
+Manejo de interrupciones de instancias spot/preemptibles.
+Con PREEMPTION_SOURCES configurado, el orchestrator consulta el aviso de interrupción
+del host (IMDS de EC2, metadata de GCE o el drain del nodo de Kubernetes) y, al
+recibirlo, deja de aceptar runners, detiene los del host y, con cola de trabajo,
+encola su reemplazo para que otra réplica recupere la capacidad.
+"""
+
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, List, Optional
+
+import requests
+from src.services.datadog import datadog
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Taints que el cluster autoscaler y kubectl drain aplican antes de retirar el nodo
+DRAIN_TAINTS = ("ToBeDeletedByClusterAutoscaler", "node.kubernetes.io/unschedulable")
+
+SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+
+class Ec2SpotSource:
+    """Aviso de interrupción spot de EC2 (IMDSv2: /latest/meta-data/spot/instance-action)."""
+
+    name = "ec2"
+    description = "EC2 spot instance-action"
+
+    def __init__(self, endpoint: str = "http://169.254.169.254"):
+        self.endpoint = endpoint.rstrip("/")
+
+    def check(self) -> Optional[str]:
+        token = requests.put(
+            f"{self.endpoint}/latest/api/token",
+            headers={"X-aws-ec2-metadata-token-ttl-seconds": "300"}, timeout=2,
+        )
+        token.raise_for_status()
+        response = requests.get(
+            f"{self.endpoint}/latest/meta-data/spot/instance-action",
+            headers={"X-aws-ec2-metadata-token": token.text}, timeout=2,
+        )
+        # 404 mientras no haya interrupción programada
+        if response.status_code == 404:
+            return None
+        response.raise_for_status()
+        notice = response.json()
+        return f"{notice.get('action', 'terminate')} a las {notice.get('time', '?')}"
+
+
+class GcePreemptionSource:
+    """Flag de preemption de GCE (computeMetadata/v1/instance/preempted)."""
+
+    name = "gce"
+    description = "GCE instance/preempted"
+
+    def __init__(self, endpoint: str = "http://metadata.google.internal"):
+        self.endpoint = endpoint.rstrip("/")
+
+    def check(self) -> Optional[str]:
+        response = requests.get(
+            f"{self.endpoint}/computeMetadata/v1/instance/preempted",
+            headers={"Metadata-Flavor": "Google"}, timeout=2,
+        )
+        response.raise_for_status()
+        return "instancia preemptada" if response.text.strip().upper() == "TRUE" else None
+
+
+class KubernetesDrainSource:
+    """Nodo de Kubernetes acordonado o marcado para eliminación (cuenta de servicio del pod)."""
+
+    name = "k8s"
+
+    def __init__(self, node: str, api: str = "https://kubernetes.default.svc"):
+        if not node:
+            raise ConfigurationError("PREEMPTION_K8S_NODE (o NODE_NAME vía downward API) es obligatorio con k8s")
+        self.node = node
+        self.api = api.rstrip("/")
+
+    @property
+    def description(self) -> str:
+        return f"drain del nodo {self.node}"
+
+    def check(self) -> Optional[str]:
+        with open(os.path.join(SERVICE_ACCOUNT_DIR, "token")) as f:
+            token = f.read().strip()
+        response = requests.get(
+            f"{self.api}/api/v1/nodes/{self.node}",
+            headers={"Authorization": f"Bearer {token}"},
+            verify=os.path.join(SERVICE_ACCOUNT_DIR, "ca.crt"),
+            timeout=5,
+        )
+        response.raise_for_status()
+        spec = response.json().get("spec", {})
+        for taint in spec.get("taints") or []:
+            if taint.get("key") in DRAIN_TAINTS:
+                return f"taint {taint['key']}"
+        return "nodo acordonado" if spec.get("unschedulable") else None
+
+
+class PreemptionWatcher:
+    """
+    Consulta los avisos cada `interval` segundos y evacúa el host al recibir uno.
+
+    on_pause/on_resume permiten al orchestrator detener y reanudar lo que toma trabajo
+    nuevo (worker de la cola); requeue(runner) encola el reemplazo de un runner y
+    retorna True si lo hizo.
+    """
+
+    def __init__(
+        self,
+        sources: List[Any],
+        lifecycle_manager: Any,
+        interval: int = 5,
+        on_pause: Optional[Callable[[], None]] = None,
+        on_resume: Optional[Callable[[], None]] = None,
+        requeue: Optional[Callable[[Dict[str, str]], bool]] = None,
+    ):
+        self.sources = sources
+        self.lifecycle_manager = lifecycle_manager
+        self.interval = interval
+        self.on_pause = on_pause
+        self.on_resume = on_resume
+        self.requeue = requeue
+        self.notice: Optional[Dict[str, Any]] = None
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'SUCCESS', 'Vigilancia de interrupciones iniciada',
+            f"{', '.join(source.description for source in self.sources)} cada {self.interval}s"
+        ))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def status(self) -> Dict[str, Any]:
+        return {"sources": [source.name for source in self.sources], "interrupted": self.notice is not None, "notice": self.notice}
+
+    def _loop(self):
+        while self.running:
+            self.poll()
+            time.sleep(self.interval)
+
+    def poll(self):
+        """Consulta las fuentes; evacúa ante un aviso nuevo y reanuda si el aviso se retira."""
+        unknown = False
+        for source in self.sources:
+            try:
+                reason = source.check()
+            except Exception as e:
+                # Sin metadata no se puede saber: se mantiene el estado actual
+                logger.debug(f"Fuente de interrupción {source.name} no disponible: {e}")
+                unknown = True
+                continue
+            if reason:
+                if self.notice is None:
+                    self._evacuate(source.name, reason)
+                return
+
+        if self.notice is not None and not unknown:
+            # Solo ocurre con fuentes reversibles (un nodo de Kubernetes que se vuelve a habilitar)
+            logger.info(format_log('SUCCESS', 'Aviso de interrupción retirado, se reanuda el host', self.notice["reason"]))
+            self.notice = None
+            self.lifecycle_manager.interrupted = False
+            if self.on_resume:
+                self.on_resume()
+
+    def _evacuate(self, source: str, reason: str):
+        logger.warning(format_log('WARNING', 'Aviso de interrupción recibido', f"{source}: {reason}"))
+        metrics.incr("preemption.notices", tags={"source": source})
+        self.notice = {"source": source, "reason": reason, "detected_at": datetime.now(timezone.utc).isoformat(), "runners": []}
+
+        # Primero dejar de aceptar trabajo, para no crear runners en un host que se va
+        self.lifecycle_manager.interrupted = True
+        if self.on_pause:
+            self.on_pause()
+
+        for container in self.lifecycle_manager.container_manager.get_runner_containers():
+            labels = container.labels or {}
+            runner_id = labels.get("runner-name", container.id[:12])
+            pool = labels.get("runner-pool", "default")
+            metrics.incr("runners.interrupted", tags={"pool": pool, "source": source})
+            lifecycle_events.emit(
+                "runner.interrupted", key=runner_id,
+                runner_id=runner_id, pool=pool, scope_name=labels.get("scope_name"), source=source, reason=reason,
+            )
+            try:
+                # SIGTERM: el runner cancela el job en curso y GitHub lo marca como fallido
+                self.lifecycle_manager.destroy_runner(runner_id)
+            except Exception as e:
+                logger.error(format_log('ERROR', 'No se pudo detener runner interrumpido', f"{runner_id}: {e}"))
+            requeued = False
+            if self.requeue:
+                try:
+                    requeued = self.requeue(labels)
+                except Exception as e:
+                    logger.error(format_log('ERROR', 'No se pudo encolar el reemplazo', f"{runner_id}: {e}"))
+            self.notice["runners"].append({"runner_id": runner_id, "pool": pool, "requeued": requeued})
+
+        summary = (
+            f"{len(self.notice['runners'])} runners detenidos, "
+            f"{sum(1 for runner in self.notice['runners'] if runner['requeued'])} reemplazos encolados"
+        )
+        logger.warning(format_log('WARNING', 'Host evacuado', summary))
+        datadog.event(
+            f"Host evacuado por {source}", f"{reason}: {summary}", alert_type="warning",
+            aggregation_key="preemption", tags={"source": source, "decision": "evacuate"},
+        )
+
+
+def create_preemption_sources() -> List[Any]:
+    """Fuentes de PREEMPTION_SOURCES (ec2, gce, k8s separadas por coma)."""
+    sources = []
+    for name in [item.strip() for item in os.getenv("PREEMPTION_SOURCES", "").split(",") if item.strip()]:
+        if name == "ec2":
+            sources.append(Ec2SpotSource())
+        elif name == "gce":
+            sources.append(GcePreemptionSource())
+        elif name == "k8s":
+            sources.append(KubernetesDrainSource(os.getenv("PREEMPTION_K8S_NODE") or os.getenv("NODE_NAME", "")))
+        else:
+            raise ConfigurationError(f"PREEMPTION_SOURCES desconocida: {name} (ec2, gce o k8s)")
+    return sources
@@ -0,0 +1,138 @@
+"""
+Aprovisionamiento en paralelo.
+Los runners se crean en un pool acotado de hilos (PROVISION_CONCURRENCY) en lugar de
+uno tras otro. Cada backend tiene su propio límite de creaciones simultáneas
+(PROVISION_BACKEND_LIMITS) y los pools se atienden por turnos, así una matriz grande
+en un pool no deja sin hueco a los runners pedidos para otro.
+"""
+
+import os
+import threading
+from collections import OrderedDict, deque
+from concurrent.futures import Future
+from typing import Any, Callable, Deque, Dict, List, Optional, Tuple
+
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Límites por defecto: las APIs de nube aguantan más creaciones simultáneas que un host SSH
+DEFAULT_BACKEND_LIMITS = {"docker": 8, "ssh": 4, "ecs": 10, "azure": 10, "gce": 10}
+
+
+class Provisioner:
+    """Cola por pool con reparto por turnos y límite de creaciones por backend."""
+
+    def __init__(self, concurrency: int = 8, backend_limits: Optional[Dict[str, int]] = None):
+        self.concurrency = concurrency
+        self.backend_limits = {**DEFAULT_BACKEND_LIMITS, **(backend_limits or {})}
+        self.queues: "OrderedDict[str, Deque[Tuple[str, Callable[[], Any], Future]]]" = OrderedDict()
+        self.running: Dict[str, int] = {}
+        self.condition = threading.Condition()
+        self.threads: List[threading.Thread] = []
+
+    def _start(self):
+        # Hilos creados con la primera tarea: sin demanda no hay hilos ociosos
+        for index in range(self.concurrency):
+            thread = threading.Thread(target=self._loop, name=f"provision-{index}", daemon=True)
+            thread.start()
+            self.threads.append(thread)
+        logger.info(format_log(
+            'CONFIG', 'Aprovisionamiento en paralelo',
+            f"{self.concurrency} hilos, límites {', '.join(f'{name}={limit}' for name, limit in sorted(self.backend_limits.items()))}"
+        ))
+
+    def submit(self, pool: str, backend: str, fn: Callable[..., Any], *args: Any, **kwargs: Any) -> Future:
+        """Encola la creación de un runner del pool; el Future recibe el resultado o la excepción."""
+        future: Future = Future()
+        with self.condition:
+            if not self.threads:
+                self._start()
+            self.queues.setdefault(pool, deque()).append((backend, lambda: fn(*args, **kwargs), future))
+            self._update_metrics()
+            self.condition.notify()
+        return future
+
+    def run(self, pool: str, backend: str, calls: List[Dict[str, Any]], fn: Callable[..., Any]) -> List[Any]:
+        """Ejecuta fn(**kwargs) para cada elemento y espera; devuelve resultados o excepciones en orden."""
+        futures = [self.submit(pool, backend, fn, **kwargs) for kwargs in calls]
+        results = []
+        for future in futures:
+            try:
+                results.append(future.result())
+            except Exception as e:
+                results.append(e)
+        return results
+
+    def _next(self) -> Optional[Tuple[str, Callable[[], Any], Future]]:
+        """Siguiente tarea por turnos entre pools, saltando los de backends sin hueco."""
+        for _ in range(len(self.queues)):
+            pool, queue = next(iter(self.queues.items()))
+            self.queues.move_to_end(pool)
+            backend = queue[0][0]
+            if self.running.get(backend, 0) < self.backend_limits.get(backend, self.concurrency):
+                task = queue.popleft()
+                if not queue:
+                    del self.queues[pool]
+                return task
+        return None
+
+    def _loop(self):
+        while True:
+            with self.condition:
+                task = self._next()
+                while task is None:
+                    self.condition.wait()
+                    task = self._next()
+                backend, call, future = task
+                self.running[backend] = self.running.get(backend, 0) + 1
+                self._update_metrics()
+
+            if future.set_running_or_notify_cancel():
+                try:
+                    future.set_result(call())
+                except Exception as e:
+                    future.set_exception(e)
+
+            with self.condition:
+                self.running[backend] -= 1
+                self._update_metrics()
+                # Un hueco de backend puede desbloquear tareas que otros hilos saltaron
+                self.condition.notify_all()
+
+    def _update_metrics(self):
+        metrics.gauge("provisioning.queued", sum(len(queue) for queue in self.queues.values()))
+        metrics.gauge("provisioning.running", sum(self.running.values()))
+
+    def status(self) -> Dict[str, Any]:
+        with self.condition:
+            return {
+                "concurrency": self.concurrency,
+                "backend_limits": dict(self.backend_limits),
+                "running": {backend: count for backend, count in self.running.items() if count},
+                "queued": {pool: len(queue) for pool, queue in self.queues.items()},
+            }
+
+
+def parse_backend_limits(value: str) -> Dict[str, int]:
+    """PROVISION_BACKEND_LIMITS: docker=8,ecs=20."""
+    limits = {}
+    for item in value.split(","):
+        if not item.strip():
+            continue
+        name, _, limit = item.partition("=")
+        try:
+            limits[name.strip()] = int(limit)
+        except ValueError:
+            raise ConfigurationError(f"PROVISION_BACKEND_LIMITS inválido: '{item.strip()}' (backend=número)")
+        if limits[name.strip()] < 1:
+            raise ConfigurationError(f"PROVISION_BACKEND_LIMITS: el límite de {name.strip()} debe ser al menos 1")
+    return limits
+
+
+# Compartido por la API y el modo automático
+provisioner = Provisioner(
+    concurrency=max(1, int(os.getenv("PROVISION_CONCURRENCY", "8"))),
+    backend_limits=parse_backend_limits(os.getenv("PROVISION_BACKEND_LIMITS", "")),
+)
@@ -0,0 +1,268 @@
+"""
+Jobs encolados que nadie atiende.
+Cada workflow_job encolado que llega por webhook se registra hasta que GitHub lo
+asigna a un runner (in_progress) o termina. Los que siguen en cola pasados
+ORPHANED_JOB_THRESHOLD segundos se diagnostican (labels sin pool, aprovisionamiento
+fallido, runner perdido...), se exponen en GET /jobs/orphaned, abren un incidente y,
+con ORPHANED_JOB_REMEDIATE=true, reciben un runner de mejor esfuerzo con sus labels.
+Con WORK_QUEUE_URL el registro está en Redis y lo comparten todas las réplicas.
+"""
+
+import json
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, List, Optional
+
+from src.services.capabilities import capabilities
+from src.services.github_outage import github_outage
+from src.services.incidents import incidents
+from src.services.job_runners import PENDING, job_runners
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.resource_classes import resource_classes
+from src.services.work_queue import RedisClient
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Labels que el runner agrega solo (GitHub los asigna según sistema y arquitectura)
+IMPLICIT_LABELS = {"self-hosted", "linux", "x64", "arm64", "arm"}
+
+
+def custom_labels(labels: List[str]) -> List[str]:
+    """
+    Labels del job que debe declarar un pool (sin self-hosted, sistema, arquitectura ni
+    clase de recursos, que el runner recibe de su clase).
+    """
+    return [
+        label for label in labels
+        if label.lower() not in IMPLICIT_LABELS and not resource_classes.is_class_label(label)
+    ]
+
+
+def matching_pool(pools: Any, labels: List[str]) -> Optional[Any]:
+    """
+    Pool cuyos labels cubren los del job (el de menos labels sobrantes), o None si ninguno.
+    Cuentan también los labels de capacidades con que se registraron sus últimos runners.
+    """
+    wanted = {label.lower() for label in custom_labels(labels)}
+    candidates = [
+        pool for pool in pools.pools.values()
+        if wanted <= {label.lower() for label in pool.labels + capabilities.get(pool.name)}
+    ]
+    return min(candidates, key=lambda pool: len(pool.labels), default=None)
+
+
+class QueuedJobTracker:
+    """Jobs encolados pendientes de runner, en Redis (hash) o en memoria."""
+
+    def __init__(self, client: Optional[RedisClient] = None, prefix: str = "gha:queued", ttl: int = 86400):
+        self.client = client
+        self.prefix = prefix
+        # GitHub cancela un job que lleva 24 h en cola
+        self.ttl = ttl
+        self.entries: Dict[str, Dict[str, Any]] = {}
+        self.remediated: Dict[str, float] = {}
+        self.lock = threading.Lock()
+
+    def record(self, job_id: str, repo: str, labels: List[str]):
+        """Registra un job encolado; una reentrega conserva la hora de la primera."""
+        entry = json.dumps({"repo": repo, "labels": labels, "queued_at": time.time()})
+        if self.client:
+            self.client.execute("HSETNX", self.prefix, job_id, entry)
+            return
+        with self.lock:
+            self.entries.setdefault(job_id, json.loads(entry))
+
+    def note_error(self, job_id: str, error: str):
+        """Último error al crear el runner del job (motivo del diagnóstico)."""
+        entry = self.get(job_id)
+        if entry is None:
+            return
+        entry["last_error"] = error[:500]
+        if self.client:
+            self.client.execute("HSET", self.prefix, job_id, json.dumps(entry))
+            return
+        with self.lock:
+            self.entries[job_id] = entry
+
+    def get(self, job_id: str) -> Optional[Dict[str, Any]]:
+        if self.client:
+            raw = self.client.execute("HGET", self.prefix, job_id)
+            return json.loads(raw) if raw else None
+        with self.lock:
+            entry = self.entries.get(job_id)
+            return dict(entry) if entry else None
+
+    def finished(self, job_id: str):
+        """El job se asignó a un runner o terminó: deja de estar en cola."""
+        if self.client:
+            self.client.execute("HDEL", self.prefix, job_id)
+            self.client.execute("HDEL", f"{self.prefix}:remediated", job_id)
+        else:
+            with self.lock:
+                self.entries.pop(job_id, None)
+                self.remediated.pop(job_id, None)
+        incidents.resolve("orphaned-job", job_id)
+
+    def queued(self) -> Dict[str, Dict[str, Any]]:
+        """Jobs en cola; descarta los que superan el TTL (GitHub ya los canceló)."""
+        if self.client:
+            raw = self.client.execute("HGETALL", self.prefix) or []
+            entries = {raw[index]: json.loads(raw[index + 1]) for index in range(0, len(raw), 2)}
+        else:
+            with self.lock:
+                entries = {job_id: dict(entry) for job_id, entry in self.entries.items()}
+
+        expired = [job_id for job_id, entry in entries.items() if time.time() - entry["queued_at"] > self.ttl]
+        for job_id in expired:
+            self.finished(job_id)
+            del entries[job_id]
+        return entries
+
+    def claim_remediation(self, job_id: str) -> bool:
+        """Solo una réplica y una vez por job crea el runner de mejor esfuerzo."""
+        if self.client:
+            return self.client.execute("HSETNX", f"{self.prefix}:remediated", job_id, int(time.time())) == 1
+        with self.lock:
+            if job_id in self.remediated:
+                return False
+            self.remediated[job_id] = time.time()
+            return True
+
+    def was_remediated(self, job_id: str) -> bool:
+        if self.client:
+            return self.client.execute("HEXISTS", f"{self.prefix}:remediated", job_id) == 1
+        with self.lock:
+            return job_id in self.remediated
+
+
+def create_queued_job_tracker() -> QueuedJobTracker:
+    """Registro en el Redis de WORK_QUEUE_URL si está configurado; si no, en memoria."""
+    url = os.getenv("WORK_QUEUE_URL")
+    return QueuedJobTracker(
+        client=RedisClient(url) if url else None,
+        prefix=f"{os.getenv('WORK_QUEUE_NAME', 'gha:work')}:queued",
+    )
+
+
+# Compartido por la API y el detector
+queued_jobs = create_queued_job_tracker()
+
+
+class OrphanedJobDetector:
+    """Revisa cada `interval` segundos los jobs que llevan más de `threshold` en cola."""
+
+    def __init__(
+        self,
+        tracker: QueuedJobTracker,
+        lifecycle_manager: Any,
+        runner_alive: Callable[[str], bool],
+        remediate: Optional[Callable[[str, Dict[str, Any], Any], None]] = None,
+        threshold: int = 600,
+        interval: int = 60,
+    ):
+        self.tracker = tracker
+        self.lifecycle_manager = lifecycle_manager
+        self.runner_alive = runner_alive
+        self.remediate = remediate
+        self.threshold = threshold
+        self.interval = interval
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.remediations = 0
+        # Jobs ya notificados por esta réplica (evento y log una sola vez)
+        self.reported: set = set()
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Detector de jobs huérfanos iniciado', f'umbral {self.threshold}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error revisando jobs en cola', str(e)))
+
+    def diagnose(self, job_id: str, entry: Dict[str, Any]) -> Dict[str, str]:
+        """Motivo más probable por el que el job no tiene runner."""
+        if not matching_pool(self.lifecycle_manager.pools, entry.get("labels") or []):
+            return {"reason": "label_mismatch", "detail": f"ningún pool declara {', '.join(custom_labels(entry['labels']))}"}
+        if entry.get("last_error"):
+            return {"reason": "provisioning_failed", "detail": entry["last_error"]}
+        runner_id = job_runners.runner_for(job_id)
+        if runner_id == PENDING:
+            return {"reason": "provisioning_pending", "detail": "el runner se está creando"}
+        if runner_id and self.runner_alive(runner_id):
+            return {"reason": "runner_idle", "detail": f"runner {runner_id} en ejecución sin tomar el job"}
+        if runner_id:
+            return {"reason": "runner_lost", "detail": f"runner {runner_id} terminó sin tomar el job"}
+        return {"reason": "no_runner", "detail": "no se pidió runner (modo degradado, shard o límite)"}
+
+    def orphaned(self) -> List[Dict[str, Any]]:
+        """Jobs en cola más allá del umbral, con su diagnóstico."""
+        now = time.time()
+        result = []
+        for job_id, entry in self.tracker.queued().items():
+            waiting = now - entry["queued_at"]
+            if waiting < self.threshold:
+                continue
+            result.append({
+                "job_id": job_id,
+                "repo": entry["repo"],
+                "labels": entry.get("labels") or [],
+                "queued_at": datetime.fromtimestamp(entry["queued_at"], timezone.utc).isoformat(),
+                "waiting_seconds": int(waiting),
+                "remediated": self.tracker.was_remediated(job_id),
+                **self.diagnose(job_id, entry),
+            })
+        return result
+
+    def check(self) -> List[Dict[str, Any]]:
+        orphaned = self.orphaned()
+        metrics.gauge("jobs.orphaned", len(orphaned))
+        self.reported &= {job["job_id"] for job in orphaned}
+        for job in orphaned:
+            summary = f"Job {job['job_id']} de {job['repo']} en cola hace {job['waiting_seconds'] // 60} min: {job['detail']}"
+            incidents.trigger(
+                "orphaned-job", job["job_id"], summary, severity="warning",
+                repo=job["repo"], labels=",".join(job["labels"]), reason=job["reason"],
+            )
+            if job["job_id"] not in self.reported:
+                self.reported.add(job["job_id"])
+                lifecycle_events.emit("job.orphaned", key=job["repo"], **job)
+                logger.warning(format_log('WARNING', 'Job huérfano', summary))
+            # Un job cuyo runner todavía se está creando no necesita otro; en modo
+            # degradado la petición ya queda guardada para la recuperación
+            if (
+                self.remediate and job["reason"] != "provisioning_pending" and not github_outage.degraded
+                and self.tracker.claim_remediation(job["job_id"])
+            ):
+                self.remediations += 1
+                metrics.incr("jobs.orphaned_remediations", tags={"reason": job["reason"]})
+                pool = matching_pool(self.lifecycle_manager.pools, job["labels"])
+                self.remediate(job["job_id"], job, pool)
+        return orphaned
+
+    def status(self) -> Dict[str, Any]:
+        return {
+            "threshold": self.threshold,
+            "remediate": self.remediate is not None,
+            "remediations": self.remediations,
+        }
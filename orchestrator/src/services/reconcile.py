@@ -0,0 +1,304 @@
+"""
+Reconciliación continua de runners.
+Cada RECONCILE_INTERVAL segundos se compara el estado deseado (pools declarados y jobs
+encolados con su runner) con el real (inventario de Docker y de los backends, runners
+registrados en GitHub y el estado en memoria o en Redis) y se corrigen las diferencias.
+Cada recurso con drift aparece en GET /reconcile con su motivo y la acción tomada.
+"""
+
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Dict, List, Optional, Tuple
+
+from src.services.github_outage import github_outage
+from src.services.gitops import spec_drift
+from src.services.job_runners import PENDING, job_runners
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Motivo de drift -> acción que lo corrige
+ACTIONS = {
+    "untracked": "adopt",          # runner en el inventario que el orchestrator no sigue
+    "missing": "forget",           # runner en seguimiento que ya no existe
+    "spec": "destroy",             # runner libre que no coincide con su pool
+    "unregistered": "destroy",     # runner que nunca apareció en GitHub
+    "orphaned": "unregister",      # registro offline en GitHub sin runner
+    "job_without_runner": "release",  # job asociado a un runner que ya no existe
+}
+
+# Ausencias que pueden ser momentáneas (runner arrancando, backend que no respondió):
+# solo se corrigen si persisten durante el periodo de gracia
+GRACE_REASONS = ("missing", "unregistered", "orphaned", "job_without_runner")
+
+
+class DriftReconciler:
+    """Detecta y corrige diferencias entre el estado deseado y el real de los runners."""
+
+    def __init__(
+        self,
+        lifecycle_manager: Any,
+        work_queue: Any = None,
+        worker_id: Optional[str] = None,
+        interval: int = 300,
+        grace: int = 300,
+        dry_run: bool = False,
+    ):
+        self.lifecycle_manager = lifecycle_manager
+        self.work_queue = work_queue
+        self.worker_id = worker_id
+        self.interval = interval
+        self.grace = grace
+        self.dry_run = dry_run
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.lock = threading.Lock()
+        # (motivo, recurso) -> primera vez que se detectó
+        self.first_seen: Dict[Tuple[str, str], float] = {}
+        # Runners vistos en el inventario: sus registros en GitHub son nuestros
+        self.known: set = set()
+        self.last_run: Optional[str] = None
+        self.last_error: Optional[str] = None
+        self.drift: List[Dict[str, Any]] = []
+        self.paused = False
+        self.corrected: Dict[str, int] = {reason: 0 for reason in ACTIONS}
+
+    def start(self):
+        """Inicia el bucle de reconciliación en segundo plano."""
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Reconciliación de runners iniciada', f'cada {self.interval}s, gracia {self.grace}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            self.reconcile()
+
+    def reconcile(self, dry_run: Optional[bool] = None) -> Dict[str, Any]:
+        """Pasada completa: detecta el drift y lo corrige (salvo en simulación)."""
+        manager = self.lifecycle_manager
+        dry_run = (self.dry_run if dry_run is None else dry_run) or manager.dry_run
+        # Sin GitHub, los registros y jobs parecerían drift: se espera a la recuperación
+        self.paused = github_outage.degraded
+        if self.paused:
+            logger.info(format_log('INFO', 'Modo degradado: reconciliación de runners pausada'))
+            return self.status()
+        with self.lock:
+            try:
+                # Sin Docker el inventario vendría vacío y todo parecería drift
+                manager.container_manager.client.ping()
+                # Igual con un host Docker remoto sin respuesta: sus runners parecerían huérfanos
+                if manager.container_manager.docker_hosts:
+                    manager.container_manager.docker_hosts.require_healthy()
+                with manager.runner_lock:
+                    drift = self._detect_runners()
+                    drift += self._detect_jobs(drift)
+                    self._forget_resolved(drift)
+                    for item in drift:
+                        self._apply(item, dry_run)
+                self.drift = drift
+                self.last_error = None
+            except Exception as e:
+                self.last_error = str(e)
+                logger.error(format_log('ERROR', 'Reconciliación de runners fallida', str(e)))
+            self.last_run = datetime.now(timezone.utc).isoformat()
+
+        for reason in ACTIONS:
+            metrics.gauge("reconcile.drift", sum(1 for item in self.drift if item["reason"] == reason), tags={"reason": reason})
+        if self.drift:
+            logger.warning(format_log('WARNING', 'Drift de runners', ", ".join(
+                f"{item['name']}: {item['reason']} ({item['result']})" for item in self.drift
+            )))
+        return self.status()
+
+    def _item(self, resource: str, name: str, reason: str, detail: str, **extra: Any) -> Dict[str, Any]:
+        key = (reason, name)
+        since = self.first_seen.setdefault(key, time.time())
+        return {
+            "resource": resource,
+            "name": name,
+            "reason": reason,
+            "detail": detail,
+            "action": ACTIONS[reason],
+            "since": datetime.fromtimestamp(since, timezone.utc).isoformat(),
+            **extra,
+        }
+
+    def _owned_elsewhere(self, runner_name: str) -> bool:
+        """Con cola de trabajo, el runner lo creó y lo sigue otra réplica."""
+        if not self.work_queue:
+            return False
+        owner = self.work_queue.owner(runner_name)
+        return bool(owner and owner != self.worker_id)
+
+    def _detect_runners(self) -> List[Dict[str, Any]]:
+        manager = self.lifecycle_manager
+        inventory: Dict[str, Any] = {}
+        for container in manager.container_manager.get_runner_containers():
+            labels = container.labels or {}
+            inventory[labels.get("runner-name", container.name)] = container
+        self.known.update(inventory)
+
+        # Runners registrados por ámbito; None si GitHub no respondió para ese ámbito
+        scopes = set()
+        for container in list(inventory.values()) + list(manager.active_runners.values()):
+            labels = container.labels or {}
+            if labels.get("scope") and labels.get("scope_name"):
+                scopes.add((labels["scope"], labels["scope_name"]))
+        registered: Dict[Tuple[str, str], Optional[Dict[str, Dict]]] = {}
+        for scope in scopes:
+            runners = manager.github_cleanup.list_runners(*scope)
+            registered[scope] = {runner["name"]: runner for runner in runners} if runners is not None else None
+
+        drift = []
+        default_image = manager.container_manager.runner_image
+        for name, container in inventory.items():
+            labels = container.labels or {}
+            scope = (labels.get("scope"), labels.get("scope_name"))
+            if name not in manager.active_runners and not self._owned_elsewhere(name):
+                drift.append(self._item("runner", name, "untracked", "en el inventario sin seguimiento", container=container))
+
+            registrations = registered.get(scope)
+            registration = registrations.get(name) if registrations is not None else None
+            if registrations is not None and registration is None:
+                drift.append(self._item("runner", name, "unregistered", f"sin registro en GitHub ({scope[1]})"))
+                continue
+
+            reason = spec_drift(container, manager.pools, default_image)
+            if reason:
+                busy = registration is None or registration.get("busy", False)
+                drift.append(self._item("runner", name, "spec", reason, busy=busy))
+
+        for name in manager.active_runners:
+            if name not in inventory:
+                drift.append(self._item("runner", name, "missing", "en seguimiento pero no existe en Docker ni en los backends"))
+
+        for scope, registrations in registered.items():
+            for name, registration in (registrations or {}).items():
+                if name in inventory or registration.get("status") == "online":
+                    continue
+                if name not in self.known and not (self.work_queue and self.work_queue.owner(name) == self.worker_id):
+                    # Registro de otra instalación: no se toca
+                    continue
+                drift.append(self._item(
+                    "registration", name, "orphaned", f"offline en GitHub ({scope[1]}) sin runner",
+                    scope=scope, runner_id=registration["id"],
+                ))
+        return drift
+
+    def _detect_jobs(self, runner_drift: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+        manager = self.lifecycle_manager
+        gone = {item["name"] for item in runner_drift if item["reason"] == "missing"}
+        try:
+            assignments = job_runners.assignments()
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron leer los jobs encolados', str(e)))
+            return []
+
+        drift = []
+        for job_id, runner_id in assignments.items():
+            if runner_id == PENDING:
+                continue
+            if runner_id in gone or (
+                runner_id not in manager.active_runners
+                and not manager.container_manager.get_container_by_name(runner_id)
+                and not self._owned_elsewhere(runner_id)
+            ):
+                drift.append(self._item("job", job_id, "job_without_runner", f"runner {runner_id} ya no existe"))
+        return drift
+
+    def _apply(self, item: Dict[str, Any], dry_run: bool):
+        """Ejecuta la acción del drift y deja el resultado en item["result"]."""
+        reason, name = item["reason"], item["name"]
+        container = item.pop("container", None)
+        scope = item.pop("scope", None)
+        runner_id = item.pop("runner_id", None)
+        busy = item.pop("busy", False)
+
+        since = self.first_seen[(reason, name)]
+        if reason in GRACE_REASONS and time.time() - since < self.grace:
+            item["result"] = "waiting"
+            return
+        if reason == "spec" and busy:
+            # Efímero: converge al terminar su job
+            item["result"] = "waiting"
+            return
+        if dry_run:
+            item["result"] = "dry_run"
+            return
+
+        manager = self.lifecycle_manager
+        try:
+            if reason == "untracked":
+                manager.active_runners[name] = container
+                done = True
+            elif reason == "missing":
+                done = manager.active_runners.pop(name, None) is not None
+            elif reason in ("spec", "unregistered"):
+                done = manager.destroy_runner(name)
+            elif reason == "orphaned":
+                done = manager.github_cleanup.unregister_runner_from_github(scope[0], scope[1], runner_id)
+                if done:
+                    self.known.discard(name)
+            else:
+                job_runners.complete(name)
+                done = True
+        except Exception as e:
+            logger.error(format_log('ERROR', f'No se pudo corregir el drift de {name}', str(e)))
+            done = False
+
+        item["result"] = "applied" if done else "failed"
+        metrics.incr("reconcile.actions", tags={"reason": reason, "result": item["result"]})
+        if done:
+            self.corrected[reason] += 1
+            self.first_seen.pop((reason, name), None)
+            logger.info(format_log('INFO', 'Drift corregido', f"{name}: {reason} -> {item['action']}"))
+
+    def _forget_resolved(self, drift: List[Dict[str, Any]]):
+        """Descarta las detecciones que ya no están en drift (el recurso convergió solo)."""
+        current = {(item["reason"], item["name"]) for item in drift}
+        for key in list(self.first_seen):
+            if key not in current:
+                del self.first_seen[key]
+
+    def status(self) -> Dict[str, Any]:
+        """Última pasada: drift por recurso con su motivo, acción y resultado."""
+        return {
+            "interval": self.interval,
+            "grace": self.grace,
+            "dry_run": self.dry_run or self.lifecycle_manager.dry_run,
+            "last_run": self.last_run,
+            "last_error": self.last_error,
+            "paused": self.paused,
+            "in_sync": self.last_error is None and not self.drift,
+            "drift": self.drift,
+            "corrected": self.corrected,
+        }
+
+
+def create_drift_reconciler(lifecycle_manager: Any, work_queue: Any = None, worker_id: Optional[str] = None) -> Optional[DriftReconciler]:
+    """Reconciliador configurado desde variables de entorno, o None sin RECONCILE_ENABLED=true."""
+    if os.getenv("RECONCILE_ENABLED", "false").lower() != "true":
+        return None
+    return DriftReconciler(
+        lifecycle_manager,
+        work_queue=work_queue,
+        worker_id=worker_id,
+        interval=max(10, int(os.getenv("RECONCILE_INTERVAL", "300"))),
+        grace=int(os.getenv("RECONCILE_GRACE", "300")),
+        dry_run=os.getenv("RECONCILE_DRY_RUN", "false").lower() == "true",
+    )
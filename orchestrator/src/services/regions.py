@@ -0,0 +1,207 @@
+"""
+Pools multi-región con failover.
+Un pool con "regions" lista por orden de preferencia las regiones (o zonas) donde puede
+crear runners. Cada región tiene un nombre y las opciones del pool que cambian en ella:
+
+- docker: docker_hosts (hosts de DOCKER_HOSTS_FILE de la región, por nombre o label) e
+  image (por ejemplo la del registry de la región)
+- ssh: ssh_hosts
+- azure: azure (location, subnet_id, image, vm_size...: se combinan con las del pool)
+- gce: gce (zones, template...: se combinan con las del pool)
+
+El runner se crea en la primera región disponible. Un error de capacidad o del proveedor
+(hosts llenos o caídos, AllocationFailed o SkuNotAvailable de Azure, zonas sin capacidad
+de Compute Engine, timeouts y errores 5xx) deja la región en enfriamiento durante
+REGION_FAILOVER_COOLDOWN segundos y se prueba la siguiente. Con todas en enfriamiento se
+prueban igualmente por orden de preferencia. Los demás errores no cambian de región.
+"""
+
+import copy
+import os
+import threading
+import time
+from typing import Any, Callable, Dict, List, Tuple
+
+import docker
+import requests
+from src.services.azure import AzureError
+from src.services.gce import ZONE_FALLBACK_ERRORS, GCEError
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import CapacityError, ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Opciones que una región puede cambiar, por backend del pool
+REGION_OPTIONS = {"docker": "docker_hosts", "ssh": "ssh_hosts", "azure": "azure", "gce": "gce"}
+
+# Códigos de ARM por falta de capacidad o cuota en la región
+AZURE_CAPACITY_ERRORS = (
+    "AllocationFailed",
+    "ZonalAllocationFailed",
+    "OverconstrainedAllocationRequest",
+    "OverconstrainedZonalAllocationRequest",
+    "SkuNotAvailable",
+    "OperationNotAllowed",
+    "QuotaExceeded",
+)
+
+
+def validate_regions(pool_name: str, backend: str, regions: Any):
+    if backend not in REGION_OPTIONS:
+        raise ConfigurationError(f"Pool {pool_name}: regions no se aplica al backend {backend}")
+    if not isinstance(regions, list) or not regions:
+        raise ConfigurationError(f"Pool {pool_name}: regions debe ser una lista de regiones")
+    option = REGION_OPTIONS[backend]
+    # La imagen del pool solo la usan los contenedores; las VMs la toman de sus opciones
+    keys = ("name", option, "image") if backend == "docker" else ("name", option)
+    names = set()
+    for region in regions:
+        if not isinstance(region, dict) or set(region) - set(keys):
+            raise ConfigurationError(f"Pool {pool_name}: cada región admite {', '.join(keys)}")
+        name = region.get("name")
+        if not isinstance(name, str) or not name:
+            raise ConfigurationError(f"Pool {pool_name}: cada región requiere name")
+        if name in names:
+            raise ConfigurationError(f"Pool {pool_name}: región {name} repetida")
+        names.add(name)
+        if option not in region:
+            raise ConfigurationError(f"Pool {pool_name}: la región {name} requiere {option}")
+        expected = list if option in ("docker_hosts", "ssh_hosts") else dict
+        if not isinstance(region[option], expected):
+            raise ConfigurationError(f"Pool {pool_name}: {option} de la región {name} debe ser {'una lista' if expected is list else 'un objeto'}")
+
+
+def region_error(error: Exception) -> bool:
+    """Errores de capacidad o del proveedor que justifican probar la siguiente región."""
+    if isinstance(error, CapacityError):
+        return True
+    if isinstance(error, GCEError):
+        return error.code in ZONE_FALLBACK_ERRORS + ("NO_CAPACITY", "TIMEOUT") or error.status >= 500
+    if isinstance(error, AzureError):
+        # Los mensajes empiezan por el código de ARM o el estado HTTP
+        code = str(error).split(":")[0].strip()
+        return code in AZURE_CAPACITY_ERRORS or (code.isdigit() and int(code) >= 500) or code.startswith("Timeout")
+    if isinstance(error, docker.errors.APIError):
+        return error.is_server_error()
+    return isinstance(error, (requests.exceptions.ConnectionError, requests.exceptions.Timeout))
+
+
+class RegionFailover:
+    """Orden de preferencia, enfriamiento y métricas de las regiones de cada pool."""
+
+    def __init__(self, cooldown: int = 300):
+        self.cooldown = cooldown
+        # (pool, región) -> fin del enfriamiento, último error y contadores
+        self.state: Dict[Tuple[str, str], Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+
+    def _entry(self, pool_name: str, region: str) -> Dict[str, Any]:
+        return self.state.setdefault((pool_name, region), {"until": 0.0, "last_error": None, "provisioned": 0, "failures": 0})
+
+    def available(self, pool_name: str, region: str) -> bool:
+        with self.lock:
+            return self._entry(pool_name, region)["until"] <= time.time()
+
+    def order(self, pool: Any) -> List[Dict[str, Any]]:
+        """Regiones por preferencia: primero las disponibles, después las que están en enfriamiento."""
+        available = [region for region in pool.regions if self.available(pool.name, region["name"])]
+        return available + [region for region in pool.regions if region not in available]
+
+    def apply(self, pool: Any, region: Dict[str, Any]) -> Any:
+        """Copia del pool con las opciones de la región."""
+        clone = copy.copy(pool)
+        clone.region = region["name"]
+        if region.get("image"):
+            clone.image = region["image"]
+        option = REGION_OPTIONS[pool.backend]
+        if option in ("azure", "gce"):
+            # Las VMs precalentadas son de las opciones base del pool, no de la región
+            merged = {**getattr(pool, option), **region[option]}
+            if region[option]:
+                merged["warm"] = 0
+            setattr(clone, option, merged)
+        else:
+            setattr(clone, option, list(region[option]))
+        return clone
+
+    def create(self, pool: Any, create: Callable[[Any], Any]) -> Any:
+        """
+        Crea el runner en la primera región que lo admita.
+
+        Raises:
+            CapacityError: Si ninguna región tiene capacidad
+        """
+        errors = []
+        for region in self.order(pool):
+            name = region["name"]
+            try:
+                result = create(self.apply(pool, region))
+            except Exception as e:
+                if not region_error(e):
+                    raise
+                self._failed(pool.name, name, e)
+                errors.append(f"{name}: {e}")
+                continue
+            self._succeeded(pool, name, fallback=name != pool.regions[0]["name"])
+            return result
+        raise CapacityError(f"Pool {pool.name}: ninguna región con capacidad ({'; '.join(errors)})")
+
+    def _failed(self, pool_name: str, region: str, error: Exception):
+        with self.lock:
+            entry = self._entry(pool_name, region)
+            first = entry["until"] <= time.time()
+            entry["until"] = time.time() + self.cooldown
+            entry["last_error"] = str(error)[:500]
+            entry["failures"] += 1
+        metrics.incr("regions.failures", tags={"pool": pool_name, "region": region})
+        if first:
+            logger.warning(format_log('WARNING', f'Región {region} sin capacidad, en enfriamiento {self.cooldown}s', f"pool {pool_name}: {error}"))
+            lifecycle_events.emit("region.unavailable", key=pool_name, pool=pool_name, region=region, error=str(error)[:500], cooldown=self.cooldown)
+        self._gauge(pool_name)
+
+    def _succeeded(self, pool: Any, region: str, fallback: bool):
+        with self.lock:
+            entry = self._entry(pool.name, region)
+            recovered = entry["until"] > 0
+            entry.update(until=0.0, last_error=None)
+            entry["provisioned"] += 1
+        metrics.incr("regions.provisioned", tags={"pool": pool.name, "region": region})
+        if fallback:
+            metrics.incr("regions.failovers", tags={"pool": pool.name, "region": region})
+            logger.info(format_log('INFO', 'Runner creado en región secundaria', f"pool {pool.name}: {region}"))
+        if recovered:
+            lifecycle_events.emit("region.recovered", key=pool.name, pool=pool.name, region=region)
+        self._gauge(pool.name)
+
+    def _gauge(self, pool_name: str):
+        with self.lock:
+            entries = [(region, entry) for (name, region), entry in self.state.items() if name == pool_name]
+        now = time.time()
+        metrics.gauge("regions.available", sum(1 for _, entry in entries if entry["until"] <= now), tags={"pool": pool_name})
+
+    def status(self, pools: List[Any]) -> List[Dict[str, Any]]:
+        now = time.time()
+        result = []
+        for pool in pools:
+            for preference, region in enumerate(pool.regions or []):
+                with self.lock:
+                    entry = dict(self._entry(pool.name, region["name"]))
+                result.append({
+                    "pool": pool.name,
+                    "region": region["name"],
+                    "preference": preference,
+                    "available": entry["until"] <= now,
+                    "cooldown_remaining": max(0, int(entry["until"] - now)),
+                    "last_error": entry["last_error"],
+                    "provisioned": entry["provisioned"],
+                    "failures": entry["failures"],
+                })
+        return result
+
+
+def create_region_failover() -> RegionFailover:
+    return RegionFailover(int(os.getenv("REGION_FAILOVER_COOLDOWN", "300")))
+
+
+region_failover = create_region_failover()
@@ -0,0 +1,214 @@
+"""
+Registro ordenado de runners.
+Cuando muchos runners se registran a la vez GitHub puede repartir los jobs de forma que
+parte de la capacidad queda sin usar o un runner nunca llega a aparecer online. Con
+REGISTRATION_PACING_MS los registros de un mismo repositorio u organización se espacian (con
+WORK_QUEUE_URL, entre todas las réplicas) y con REGISTRATION_VERIFY_TIMEOUT cada runner
+nuevo debe aparecer online en GitHub en ese plazo; si no, se destruye y se crea otro.
+"""
+
+import os
+import threading
+import time
+from typing import Any, Dict, Optional
+
+from src.services.fleet_cutovers import fleet_cutovers
+from src.services.github_outage import github_outage
+from src.services.image_builder import image_rollouts
+from src.services.job_runners import job_runners
+from src.services.metrics import metrics
+from src.services.work_queue import RedisClient
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class RegistrationPacer:
+    """Separa al menos `spacing_ms` los registros de runners de un mismo ámbito."""
+
+    def __init__(self, spacing_ms: int = 0, client: Optional[RedisClient] = None, prefix: str = "gha:registration"):
+        self.spacing = spacing_ms / 1000
+        self.client = client
+        self.prefix = prefix
+        # Sin Redis: ámbito -> momento a partir del cual puede registrarse el siguiente runner
+        self.next_slot: Dict[str, float] = {}
+        self.lock = threading.Lock()
+        self.paced = 0
+
+    @property
+    def enabled(self) -> bool:
+        return self.spacing > 0
+
+    def wait(self, scope_name: str) -> float:
+        """Espera el turno de registro del ámbito; devuelve los segundos esperados."""
+        if not self.enabled:
+            return 0.0
+        started = time.time()
+        if self.client:
+            # El primero que toma la clave registra; los demás esperan a que caduque
+            key = f"{self.prefix}:{scope_name}"
+            while self.client.execute("SET", key, "1", "PX", int(self.spacing * 1000), "NX") is None:
+                remaining = self.client.execute("PTTL", key)
+                time.sleep(max(remaining or 0, 10) / 1000)
+        else:
+            with self.lock:
+                now = time.time()
+                slot = max(now, self.next_slot.get(scope_name, 0))
+                self.next_slot[scope_name] = slot + self.spacing
+            if slot > now:
+                time.sleep(slot - now)
+
+        waited = time.time() - started
+        if waited > 0.01:
+            self.paced += 1
+            metrics.timing("runners.registration_pacing", waited * 1000)
+        return waited
+
+    def status(self) -> Dict[str, Any]:
+        return {"pacing_ms": int(self.spacing * 1000), "paced": self.paced}
+
+
+class RegistrationVerifier:
+    """
+    Comprueba que cada runner creado aparezca online en GitHub antes de `timeout` segundos.
+
+    Un runner que no lo hace se destruye y se crea otro con los mismos parámetros (hasta
+    `retries` veces); si tenía un job asociado, el job pasa al runner nuevo.
+    """
+
+    def __init__(self, lifecycle_manager: Any, timeout: int = 120, retries: int = 1, interval: int = 10):
+        self.lifecycle_manager = lifecycle_manager
+        self.timeout = timeout
+        self.retries = retries
+        self.interval = interval
+        # runner -> parámetros de creación, momento de creación e intento
+        self.pending: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.counters = {"verified": 0, "recreated": 0, "failed": 0}
+
+    def track(self, runner_id: str, params: Dict[str, Any], attempt: int = 0):
+        """Empieza a vigilar el registro de un runner recién creado."""
+        with self.lock:
+            self.pending[runner_id] = {"params": params, "created": time.time(), "attempt": attempt}
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Verificación de registro de runners iniciada', f'plazo {self.timeout}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.verify()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error verificando registros de runners', str(e)))
+
+    def verify(self):
+        """Una pasada: confirma los runners online y recrea los que agotaron el plazo."""
+        # Sin GitHub no se puede saber si se registraron: se espera a la recuperación
+        if github_outage.degraded:
+            return
+        with self.lock:
+            pending = dict(self.pending)
+        if not pending:
+            return
+
+        manager = self.lifecycle_manager
+        registered: Dict[tuple, Optional[Dict[str, Dict]]] = {}
+        for runner_id, entry in pending.items():
+            params = entry["params"]
+            scope = (params["scope"], params["scope_name"])
+            if scope not in registered:
+                runners = manager.github_cleanup.list_runners(*scope)
+                registered[scope] = {runner["name"]: runner for runner in runners} if runners is not None else None
+            registrations = registered[scope]
+            if registrations is None:
+                continue
+
+            registration = registrations.get(runner_id)
+            if registration and (registration.get("status") == "online" or registration.get("busy")):
+                self._done(runner_id, "verified")
+                metrics.timing("runners.registration_duration", (time.time() - entry["created"]) * 1000)
+                continue
+            if runner_id not in manager.active_runners and not manager.container_manager.get_container_by_name(runner_id):
+                # Terminó (job corto o destruido): ya no hay nada que verificar
+                with self.lock:
+                    self.pending.pop(runner_id, None)
+                continue
+            if time.time() - entry["created"] >= self.timeout:
+                self._recreate(runner_id, entry)
+
+    def _recreate(self, runner_id: str, entry: Dict[str, Any]):
+        manager = self.lifecycle_manager
+        if entry["attempt"] >= self.retries:
+            logger.error(format_log('ERROR', 'Runner sin registrarse en GitHub', f'{runner_id}: {self.timeout}s, sin más reintentos'))
+            manager.destroy_runner(runner_id)
+            self._done(runner_id, "failed")
+            return
+
+        logger.warning(format_log('WARNING', 'Runner sin registrarse en GitHub, se recrea', f'{runner_id}: {self.timeout}s'))
+        self._done(runner_id, "recreated")
+        manager.destroy_runner(runner_id)
+        try:
+            replacement = manager.create_runner(**entry["params"])
+        except Exception as e:
+            logger.error(format_log('ERROR', f'No se pudo recrear el runner {runner_id}', str(e)))
+            return
+        self.track(replacement, entry["params"], attempt=entry["attempt"] + 1)
+        job_id = job_runners.reassign(runner_id, replacement)
+        if job_id:
+            logger.info(format_log('INFO', 'Job asociado al runner recreado', f'job {job_id}: {replacement}'))
+
+    def _done(self, runner_id: str, result: str):
+        with self.lock:
+            self.pending.pop(runner_id, None)
+        self.counters[result] += 1
+        if image_rollouts:
+            # Los canarios que no se registran cuentan para revertir su despliegue de imagen
+            image_rollouts.record_registration(runner_id, result)
+        if fleet_cutovers:
+            # Y los de un cambio blue/green, para comparar los verdes con los azules
+            fleet_cutovers.record_registration(runner_id, result)
+        metrics.incr("runners.registration", tags={"result": result})
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            pending = len(self.pending)
+        return {"timeout": self.timeout, "retries": self.retries, "pending": pending, **self.counters}
+
+
+def create_registration_pacer() -> RegistrationPacer:
+    """Espaciado de REGISTRATION_PACING_MS (0 lo desactiva), compartido en Redis con WORK_QUEUE_URL."""
+    url = os.getenv("WORK_QUEUE_URL")
+    return RegistrationPacer(
+        spacing_ms=int(os.getenv("REGISTRATION_PACING_MS", "0")),
+        client=RedisClient(url) if url else None,
+        prefix=f"{os.getenv('WORK_QUEUE_NAME', 'gha:work')}:registration",
+    )
+
+
+def create_registration_verifier(lifecycle_manager: Any) -> Optional[RegistrationVerifier]:
+    """Verificador configurado desde variables de entorno, o None con REGISTRATION_VERIFY_TIMEOUT=0."""
+    timeout = int(os.getenv("REGISTRATION_VERIFY_TIMEOUT", "0"))
+    if timeout <= 0:
+        return None
+    return RegistrationVerifier(
+        lifecycle_manager,
+        timeout=timeout,
+        retries=int(os.getenv("REGISTRATION_VERIFY_RETRIES", "1")),
+        interval=max(1, int(os.getenv("REGISTRATION_VERIFY_INTERVAL", "10"))),
+    )
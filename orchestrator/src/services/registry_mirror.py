@@ -0,0 +1,79 @@
+"""
+Caché pull-through de imágenes (docker compose --profile mirror).
+Con REGISTRY_MIRROR configurado, las imágenes de Docker Hub de los runners se
+descargan a través del mirror (localhost:5000/library/ubuntu en lugar de ubuntu),
+evitando los límites de descarga de Docker Hub en runners que arrancan en frío.
+Si el mirror no responde se usa la imagen original.
+"""
+
+import os
+import time
+from typing import Any, Dict, Optional
+
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+DOCKER_HUB_HOSTS = {"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+# Segundos sin reintentar el mirror para una imagen tras un fallo
+RETRY_AFTER = 300
+
+
+def split_registry(image: str) -> tuple:
+    """'ghcr.io/org/img:tag' -> ('ghcr.io', 'org/img:tag'); 'ubuntu' -> ('docker.io', 'library/ubuntu')."""
+    first, _, rest = image.partition("/")
+    # El primer componente es un registro si tiene '.' o ':' o es localhost
+    if rest and ("." in first or ":" in first or first == "localhost"):
+        return first, rest
+    if not rest:
+        return "docker.io", f"library/{image}"
+    return "docker.io", image
+
+
+class RegistryMirror:
+    """Reescribe las imágenes de Docker Hub hacia el mirror pull-through."""
+
+    def __init__(self, mirror: Optional[str] = None):
+        self.mirror = mirror.rstrip("/") if mirror else None
+        # Imágenes que fallaron en el mirror: no reintentar en cada runner del mismo pool
+        self.failed: Dict[str, float] = {}
+
+    def mirrored(self, image: str) -> str:
+        """Referencia de la imagen en el mirror, o la original si no es de Docker Hub."""
+        if not self.mirror:
+            return image
+        registry, path = split_registry(image)
+        if registry not in DOCKER_HUB_HOSTS:
+            return image
+        return f"{self.mirror}/{path}"
+
+    def resolve(self, client: Any, image: str) -> str:
+        """
+        Imagen a usar para el contenedor: la del mirror si se pudo descargar.
+
+        La descarga se hace aquí (y no en containers.run) para poder volver a la
+        imagen original si el mirror no está disponible.
+        """
+        mirrored = self.mirrored(image)
+        if mirrored == image or time.time() - self.failed.get(mirrored, 0) < RETRY_AFTER:
+            return image
+        try:
+            client.images.get(mirrored)
+            return mirrored
+        except Exception:
+            pass
+        try:
+            logger.info(format_log('DOCKER', 'Descargando imagen vía mirror', mirrored))
+            client.images.pull(mirrored)
+            self.failed.pop(mirrored, None)
+            return mirrored
+        except Exception as e:
+            self.failed[mirrored] = time.time()
+            logger.warning(format_log('WARNING', 'Mirror de imágenes no disponible, usando la imagen original', f"{image}: {e}"))
+            return image
+
+
+def create_registry_mirror() -> RegistryMirror:
+    """Crea el mirror desde REGISTRY_MIRROR (p. ej. localhost:5000)."""
+    return RegistryMirror(os.getenv("REGISTRY_MIRROR") or None)
@@ -0,0 +1,164 @@
+"""
+Clases de recursos de los runners.
+Una clase (small, medium, large, xl o las de RESOURCE_CLASSES_FILE) fija CPU y memoria y
+su equivalente en cada backend: límites del contenedor en Docker, tamaño de la tarea en
+Fargate, vm_size en Azure y machine_type en Compute Engine. El job la elige con un label
+como size-xl en runs-on; sin él se usa la clase por defecto del pool. El runner se
+registra con ese label para que GitHub le asigne el job, y el coste de sus minutos se
+multiplica por el cost_factor de la clase.
+"""
+
+import copy
+import json
+import os
+from typing import Any, Dict, List, Optional
+
+from src.services.workspaces import UNITS, format_size, parse_size
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+DEFAULT_CLASSES: Dict[str, Dict[str, Any]] = {
+    "small": {"cpus": 1, "memory": "2g", "cost_factor": 0.5, "azure": {"vm_size": "Standard_B1ms"}, "gce": {"machine_type": "e2-small"}},
+    "medium": {"cpus": 2, "memory": "8g", "cost_factor": 1, "azure": {"vm_size": "Standard_D2s_v5"}, "gce": {"machine_type": "e2-standard-2"}},
+    "large": {"cpus": 4, "memory": "16g", "cost_factor": 2, "azure": {"vm_size": "Standard_D4s_v5"}, "gce": {"machine_type": "e2-standard-4"}},
+    "xl": {"cpus": 8, "memory": "32g", "cost_factor": 4, "azure": {"vm_size": "Standard_D8s_v5"}, "gce": {"machine_type": "e2-standard-8"}},
+}
+
+
+class ResourceClass:
+    """CPU, memoria y tamaño en cada backend de una clase de recursos."""
+
+    def __init__(self, name: str, spec: Dict[str, Any]):
+        try:
+            self.cpus = float(spec["cpus"])
+        except (KeyError, TypeError, ValueError):
+            raise ConfigurationError(f"Clase de recursos {name}: cpus es obligatorio y numérico")
+        if self.cpus <= 0:
+            raise ConfigurationError(f"Clase de recursos {name}: cpus debe ser mayor que 0")
+        self.name = name
+        self.memory = parse_size(spec.get("memory"), f"Clase de recursos {name}: memory")
+        self.cost_factor = float(spec.get("cost_factor", 1))
+        # Fargate: unidades de CPU y MiB salvo que la clase indique otros valores
+        ecs = spec.get("ecs") or {}
+        self.task_cpu = str(ecs.get("cpu") or int(self.cpus * 1024))
+        self.task_memory = str(ecs.get("memory") or self.memory // UNITS["m"])
+        self.vm_size: Optional[str] = (spec.get("azure") or {}).get("vm_size")
+        self.machine_type: Optional[str] = (spec.get("gce") or {}).get("machine_type")
+
+    @property
+    def docker_options(self) -> Dict[str, Any]:
+        return {"nano_cpus": int(self.cpus * 1e9), "mem_limit": format_size(self.memory)}
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "cpus": self.cpus,
+            "memory": format_size(self.memory),
+            "cost_factor": self.cost_factor,
+            "ecs": {"cpu": self.task_cpu, "memory": self.task_memory},
+            "azure": {"vm_size": self.vm_size},
+            "gce": {"machine_type": self.machine_type},
+        }
+
+
+class ResourceClasses:
+    """Clases disponibles y su selección por labels del job."""
+
+    def __init__(self, classes: Dict[str, ResourceClass], label_prefix: str = "size-"):
+        self.classes = classes
+        self.label_prefix = label_prefix
+
+    def label(self, name: str) -> str:
+        return f"{self.label_prefix}{name}"
+
+    def get(self, name: str) -> ResourceClass:
+        resource_class = self.classes.get(name)
+        if not resource_class:
+            raise ValueError(f"Clase de recursos desconocida: {name} ({', '.join(self.classes)})")
+        return resource_class
+
+    def is_class_label(self, label: str) -> bool:
+        return label.lower().startswith(self.label_prefix)
+
+    def select(self, pool: Any, labels: Optional[List[str]], requested: Optional[str] = None) -> Optional[str]:
+        """
+        Clase del runner: la pedida, la del label size-* del job o la por defecto del pool.
+
+        Raises:
+            ValueError: Si la clase no existe, el job pide dos o el pool no la admite
+        """
+        if not requested:
+            named = {label[len(self.label_prefix):].lower() for label in labels or [] if self.is_class_label(label)}
+            if len(named) > 1:
+                raise ValueError(f"El job pide varias clases de recursos: {', '.join(sorted(named))}")
+            requested = named.pop() if named else pool.resource_class
+        if not requested:
+            return None
+        self.get(requested)
+        if pool.resource_classes and requested not in pool.resource_classes:
+            raise ValueError(f"Pool {pool.name} no admite la clase de recursos {requested} ({', '.join(pool.resource_classes)})")
+        return requested
+
+    def apply(self, pool: Any, name: Optional[str]) -> Any:
+        """Copia del pool con el tamaño de la clase en su backend y el label de la clase."""
+        if not name:
+            return pool
+        resource_class = self.get(name)
+        clone = copy.copy(pool)
+        clone.labels = list(dict.fromkeys(pool.labels + [self.label(name)]))
+        clone.resources = resource_class
+        if pool.backend == "ecs":
+            clone.task_cpu, clone.task_memory = resource_class.task_cpu, resource_class.task_memory
+        elif pool.backend == "azure":
+            if pool.azure.get("vmss"):
+                # El tamaño lo fija el scale set: solo se acepta si la clase no pide otro
+                if resource_class.vm_size and resource_class.vm_size != pool.azure.get("vm_size"):
+                    raise ValueError(f"Pool {pool.name}: el scale set tiene tamaño fijo, usa un pool por clase de recursos")
+            elif resource_class.vm_size:
+                # Las VMs precalentadas tienen el tamaño del pool: con otra clase se crea una nueva
+                # El tamaño de la clase sustituye a la selección por precio del pool
+                warm = pool.azure.get("warm", 0) if resource_class.vm_size == pool.azure.get("vm_size") else 0
+                azure = {key: value for key, value in pool.azure.items() if key != "selection"}
+                clone.azure = {**azure, "vm_size": resource_class.vm_size, "warm": warm}
+        elif pool.backend == "gce" and resource_class.machine_type:
+            warm = pool.gce.get("warm", 0) if resource_class.machine_type == pool.gce.get("machine_type") else 0
+            gce = {key: value for key, value in pool.gce.items() if key != "selection"}
+            clone.gce = {**gce, "machine_type": resource_class.machine_type, "warm": warm}
+        elif pool.backend == "ssh":
+            logger.warning(format_log('WARNING', 'Clase de recursos sin efecto en hosts SSH', f"{name} (pool {pool.name})"))
+        return clone
+
+    def cost_factor(self, name: Optional[str]) -> float:
+        resource_class = self.classes.get(name) if name else None
+        return resource_class.cost_factor if resource_class else 1.0
+
+    def list(self) -> List[Dict[str, Any]]:
+        return [{**resource_class.to_dict(), "label": self.label(name)} for name, resource_class in self.classes.items()]
+
+
+def load_resource_classes(path: Optional[str]) -> Dict[str, ResourceClass]:
+    """Clases por defecto más las de RESOURCE_CLASSES_FILE (JSON {"classes": {nombre: spec}}), que las reemplazan por nombre."""
+    specs = dict(DEFAULT_CLASSES)
+    if path:
+        try:
+            with open(path, "r") as source:
+                data = json.load(source)
+        except (OSError, ValueError) as e:
+            raise ConfigurationError(f"No se pudo leer RESOURCE_CLASSES_FILE {path}: {e}")
+        classes = data.get("classes", data) if isinstance(data, dict) else None
+        if not isinstance(classes, dict):
+            raise ConfigurationError(f"RESOURCE_CLASSES_FILE {path}: se esperaba un objeto de clases por nombre")
+        specs.update(classes)
+    return {name.lower(): ResourceClass(name.lower(), spec) for name, spec in specs.items()}
+
+
+def create_resource_classes() -> ResourceClasses:
+    path = os.getenv("RESOURCE_CLASSES_FILE")
+    classes = ResourceClasses(load_resource_classes(path), os.getenv("RESOURCE_CLASS_LABEL_PREFIX", "size-").lower())
+    if path:
+        logger.info(format_log('CONFIG', 'Clases de recursos', ", ".join(classes.classes)))
+    return classes
+
+
+resource_classes = create_resource_classes()
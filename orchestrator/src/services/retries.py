@@ -0,0 +1,181 @@
+"""
+Reintentos con presupuesto por dependencia.
+Todas las llamadas salientes (GitHub, AWS, GCE, Azure, Docker y los destinos de eventos e
+incidentes) reintentan con backoff exponencial y jitter completo: la espera es un valor
+aleatorio entre 0 y min(RETRY_MAX_DELAY, RETRY_BASE_DELAY * 2^intento), para que las
+réplicas no reintenten a la vez. Cada dependencia tiene un presupuesto: en la última
+ventana de 60 s los reintentos no pueden superar RETRY_BUDGET_RATIO de las llamadas (con
+un mínimo de RETRY_BUDGET_MIN), así una dependencia caída no multiplica su propia carga.
+"""
+
+import os
+import random
+import threading
+import time
+from collections import deque
+from typing import Any, Callable, Deque, Dict, Optional, Tuple
+
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Estados HTTP que indican un fallo transitorio del servidor o una limitación
+RETRYABLE_STATUSES = (429, 500, 502, 503, 504)
+
+
+class RetryBudget:
+    """Política de reintentos de una dependencia con su presupuesto en ventana deslizante."""
+
+    def __init__(
+        self,
+        name: str,
+        max_attempts: int = 3,
+        base_delay: float = 0.5,
+        max_delay: float = 10.0,
+        ratio: float = 0.2,
+        min_retries: int = 10,
+        window: int = 60,
+    ):
+        self.name = name
+        self.max_attempts = max(1, max_attempts)
+        self.base_delay = base_delay
+        self.max_delay = max_delay
+        self.ratio = ratio
+        self.min_retries = min_retries
+        self.window = window
+        # (momento, es_reintento) de cada intento dentro de la ventana
+        self.attempts: Deque[Tuple[float, bool]] = deque()
+        self.lock = threading.Lock()
+        self.counters = {"calls": 0, "retries": 0, "exhausted": 0, "budget_denied": 0}
+
+    def _record(self, retry: bool):
+        now = time.time()
+        with self.lock:
+            self.attempts.append((now, retry))
+            while self.attempts and self.attempts[0][0] < now - self.window:
+                self.attempts.popleft()
+
+    def _allow_retry(self) -> bool:
+        """Queda presupuesto si los reintentos de la ventana no superan la proporción permitida."""
+        now = time.time()
+        with self.lock:
+            while self.attempts and self.attempts[0][0] < now - self.window:
+                self.attempts.popleft()
+            calls = sum(1 for _, retry in self.attempts if not retry)
+            retries = len(self.attempts) - calls
+        return retries < max(self.min_retries, self.ratio * calls)
+
+    def delay(self, attempt: int, retry_after: Optional[float] = None) -> float:
+        """Jitter completo sobre el backoff exponencial; un Retry-After del servidor es el mínimo."""
+        delay = random.uniform(0, min(self.max_delay, self.base_delay * 2 ** attempt))
+        if retry_after is not None:
+            delay = max(delay, min(retry_after, self.max_delay))
+        return delay
+
+    def call(
+        self,
+        fn: Callable[[], Any],
+        retry_error: Callable[[Exception], bool] = lambda e: True,
+        retry_result: Optional[Callable[[Any], bool]] = None,
+        retry_after: Optional[Callable[[Any], Optional[float]]] = None,
+        max_attempts: Optional[int] = None,
+    ) -> Any:
+        """
+        Ejecuta fn() con reintentos.
+
+        Args:
+            fn: Llamada a la dependencia
+            retry_error: True si la excepción es transitoria (por defecto, todas)
+            retry_result: True si el resultado es un fallo transitorio (p. ej. un 503)
+            retry_after: Segundos que pide esperar el servidor según el resultado
+            max_attempts: Intentos de esta llamada si difiere de la política
+
+        Returns:
+            El resultado del último intento; la excepción del último intento se propaga
+        """
+        attempts = max_attempts or self.max_attempts
+        self.counters["calls"] += 1
+        for attempt in range(attempts):
+            self._record(retry=attempt > 0)
+            try:
+                result = fn()
+            except Exception as e:
+                if not retry_error(e) or not self._next(attempt, attempts, str(e)):
+                    raise
+                time.sleep(self.delay(attempt))
+                continue
+            if retry_result is None or not retry_result(result) or not self._next(attempt, attempts, "respuesta transitoria"):
+                return result
+            time.sleep(self.delay(attempt, retry_after(result) if retry_after else None))
+        return result
+
+    def _next(self, attempt: int, attempts: int, reason: str) -> bool:
+        """Decide si hay otro intento; registra el motivo si se agotan intentos o presupuesto."""
+        if attempt + 1 >= attempts:
+            if attempts > 1:
+                self.counters["exhausted"] += 1
+                metrics.incr("retries.exhausted", tags={"dependency": self.name})
+            return False
+        if not self._allow_retry():
+            self.counters["budget_denied"] += 1
+            metrics.incr("retries.budget_denied", tags={"dependency": self.name})
+            logger.warning(format_log('WARNING', f'Presupuesto de reintentos agotado ({self.name})', reason))
+            return False
+        self.counters["retries"] += 1
+        metrics.incr("retries.attempts", tags={"dependency": self.name})
+        return True
+
+    def status(self) -> Dict[str, Any]:
+        return {"max_attempts": self.max_attempts, "ratio": self.ratio, **self.counters}
+
+
+class RetryBudgets:
+    """Presupuestos por dependencia, creados con la configuración de entorno al primer uso."""
+
+    def __init__(self):
+        self.budgets: Dict[str, RetryBudget] = {}
+        self.lock = threading.Lock()
+
+    def get(self, name: str) -> RetryBudget:
+        with self.lock:
+            if name not in self.budgets:
+                self.budgets[name] = create_retry_budget(name)
+            return self.budgets[name]
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            return {name: budget.status() for name, budget in self.budgets.items()}
+
+
+def _setting(name: str, dependency: str, default: str) -> str:
+    """RETRY_MAX_ATTEMPTS_GITHUB tiene prioridad sobre RETRY_MAX_ATTEMPTS."""
+    return os.getenv(f"{name}_{dependency.upper()}") or os.getenv(name, default)
+
+
+def create_retry_budget(dependency: str) -> RetryBudget:
+    return RetryBudget(
+        dependency,
+        max_attempts=int(_setting("RETRY_MAX_ATTEMPTS", dependency, "3")),
+        base_delay=float(_setting("RETRY_BASE_DELAY", dependency, "0.5")),
+        max_delay=float(_setting("RETRY_MAX_DELAY", dependency, "10")),
+        ratio=float(_setting("RETRY_BUDGET_RATIO", dependency, "0.2")),
+        min_retries=int(_setting("RETRY_BUDGET_MIN", dependency, "10")),
+    )
+
+
+def http_retry_after(response: Any) -> Optional[float]:
+    """Segundos del header Retry-After de una respuesta HTTP, si los indica."""
+    value = response.headers.get("Retry-After") if response is not None else None
+    try:
+        return float(value) if value else None
+    except ValueError:
+        return None
+
+
+def http_transient(response: Any) -> bool:
+    return response.status_code in RETRYABLE_STATUSES
+
+
+# Compartido por todos los clientes del proceso
+retry_budgets = RetryBudgets()
@@ -0,0 +1,164 @@
+"""
+Redes aisladas por runner.
+Con RUNNER_NETWORK_ISOLATION (activado por defecto) cada contenedor de runner tiene su propia
+red bridge en lugar de compartir la red por defecto de Docker. Docker no enruta entre redes
+bridge distintas, así que un job no alcanza los servicios que otro job levantó en el mismo
+host. La red se elimina con el runner.
+
+- Pools con proxy de salida: la red es interna (sin ruta a internet) y se conectan a ella el
+  proxy de egress y el de caché, con el nombre de host con que los usa el runner
+- "network": {"services": true}: la red admite tráfico entre sus contenedores y su nombre
+  llega al job en RUNNER_NETWORK, para conectar contenedores de servicio con
+  docker run --network "$RUNNER_NETWORK"; sin ello el tráfico entre contenedores de la red
+  está bloqueado
+- Pools con "sidecars": la red siempre existe y admite tráfico entre sus contenedores, que
+  es por donde el runner alcanza sus sidecars (ver sidecars.py)
+- "network": {"isolated": false}: el pool vuelve a la red compartida
+"""
+
+import os
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import urlsplit
+
+import docker
+from src.services.cache_proxy import cache_proxy_hostname
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, DockerError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+NETWORK_PREFIX = "gha-runner-net"
+NETWORK_LABEL = "gha-runner-network"
+NETWORK_KEYS = ("isolated", "services")
+
+
+def network_name(runner_name: str) -> str:
+    return f"{NETWORK_PREFIX}-{runner_name}"
+
+
+def validate_network(pool_name: str, spec: Any):
+    if not isinstance(spec, dict) or set(spec) - set(NETWORK_KEYS):
+        raise ConfigurationError(f"Pool {pool_name}: network debe ser un objeto con {' y '.join(NETWORK_KEYS)}")
+    for key, value in spec.items():
+        if not isinstance(value, bool):
+            raise ConfigurationError(f"Pool {pool_name}: network.{key} debe ser true o false")
+
+
+class RunnerNetworks:
+    """Creación y eliminación de la red propia de cada contenedor de runner."""
+
+    def __init__(self, client: Any, enabled: bool = True, proxies: Optional[List[Tuple[str, str, bool]]] = None):
+        self.client = client
+        self.enabled = enabled
+        # (contenedor, alias en la red del runner, obligatorio): proxies de los pools con egress
+        self.proxies = proxies or []
+
+    def isolated(self, pool: Any) -> bool:
+        return bool((pool.network or {}).get("isolated", self.enabled or bool(pool.sidecars)))
+
+    def create(self, runner_name: str, pool: Any, environment: Dict[str, str], client: Any = None) -> Optional[str]:
+        """
+        Crea la red del runner y conecta los proxies si el pool usa el de salida.
+        client es el Docker donde se creará el contenedor (un host de DOCKER_HOSTS_FILE o el local).
+
+        Returns:
+            Nombre de la red, o None si el pool comparte red
+
+        Raises:
+            DockerError: Si el proxy de egress no está en marcha
+        """
+        if not self.isolated(pool):
+            return None
+        services = bool((pool.network or {}).get("services"))
+        name = network_name(runner_name)
+        client = client or self.client
+        network = client.networks.create(
+            name,
+            driver="bridge",
+            internal=pool.egress_proxy,
+            check_duplicate=True,
+            labels={NETWORK_LABEL: "true", "runner-name": runner_name, "runner-pool": pool.name},
+            # El runner tiene que alcanzar los proxies y sidecars; sin ellos ni servicios nadie más debería hablarle
+            options={"com.docker.network.bridge.enable_icc": "true" if services or pool.egress_proxy or pool.sidecars else "false"},
+        )
+        try:
+            if pool.egress_proxy:
+                self._connect_proxies(network, runner_name)
+        except Exception:
+            self.remove(name, client)
+            raise
+        if services:
+            environment["RUNNER_NETWORK"] = name
+        metrics.incr("networks.created", tags={"pool": pool.name, "services": str(services).lower()})
+        return name
+
+    def _connect_proxies(self, network: Any, runner_name: str):
+        for container_name, alias, required in self.proxies:
+            try:
+                network.connect(container_name, aliases=[alias])
+            except docker.errors.NotFound:
+                if required:
+                    raise DockerError(f"El proxy {container_name} no está en marcha: {runner_name} no tendría salida")
+                logger.warning(format_log('WARNING', 'Proxy no disponible en la red del runner', f"{container_name} ({runner_name})"))
+
+    def remove(self, name: str, client: Any = None) -> bool:
+        """
+        Elimina la red de un runner: desconecta los proxies y elimina los contenedores que el
+        job dejó conectados a ella (contenedores de servicio).
+
+        Returns:
+            False si la red sigue existiendo
+        """
+        client = client or self.client
+        try:
+            network = client.networks.get(name)
+            proxy_names = {container_name for container_name, _, _ in self.proxies}
+            for container_id, attached in list((network.attrs.get("Containers") or {}).items()):
+                if attached.get("Name") in proxy_names:
+                    network.disconnect(container_id, force=True)
+                else:
+                    client.containers.get(container_id).remove(force=True)
+            network.remove()
+        except docker.errors.NotFound:
+            return True
+        except Exception as e:
+            logger.warning(format_log('WARNING', f'No se pudo eliminar la red {name}', str(e)))
+            metrics.incr("networks.remove_failed")
+            return False
+        return True
+
+    def prune(self) -> int:
+        """Elimina las redes de runners cuyo contenedor ya no existe (reinicios o eliminaciones forzadas)."""
+        removed = 0
+        try:
+            networks = self.client.networks.list(filters={"label": f"{NETWORK_LABEL}=true"})
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron listar las redes de runners', str(e)))
+            return 0
+        for network in networks:
+            runner_name = (network.attrs.get("Labels") or {}).get("runner-name")
+            if runner_name and self.client.containers.list(all=True, filters={"label": [f"runner-name={runner_name}", "gha-ephemeral=true"]}):
+                continue
+            if self.remove(network.name):
+                removed += 1
+        if removed:
+            logger.info(format_log('INFO', 'Redes de runners huérfanas eliminadas', str(removed)))
+        return removed
+
+
+def create_runner_networks(client: Any) -> RunnerNetworks:
+    """Redes por runner según RUNNER_NETWORK_ISOLATION (los pools pueden cambiarlo con "network")."""
+    enabled = os.getenv("RUNNER_NETWORK_ISOLATION", "true").lower() == "true"
+    proxies = [(
+        os.getenv("EGRESS_PROXY_CONTAINER", "gha-egress-proxy"),
+        urlsplit(os.getenv("EGRESS_PROXY_URL", "http://egress-proxy:3128")).hostname,
+        True,
+    )]
+    cache_host = cache_proxy_hostname()
+    if cache_host:
+        proxies.append((os.getenv("CACHE_PROXY_CONTAINER", "gha-cache-proxy"), cache_host, False))
+    networks = RunnerNetworks(client, enabled, proxies)
+    if enabled:
+        logger.info(format_log('CONFIG', 'Red aislada por runner', "activada"))
+    networks.prune()
+    return networks
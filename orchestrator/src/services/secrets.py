@@ -0,0 +1,238 @@
+"""
+Proveedores de secretos del orchestrator.
+Abstrae el origen de los secretos (variables de entorno o HashiCorp Vault) para que
+puedan rotarse sin reiniciar el servicio.
+"""
+
+import os
+import threading
+import time
+from typing import Dict, Optional
+
+import requests
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+class SecretsProvider:
+    """Interfaz común de proveedores de secretos."""
+
+    name = "base"
+
+    def get(self, key: str) -> Optional[str]:
+        """Retorna el valor actual de un secreto o None si no existe."""
+        raise NotImplementedError
+
+    def close(self):
+        """Libera recursos (threads de renovación, conexiones)."""
+
+
+class EnvSecretsProvider(SecretsProvider):
+    """Secretos desde variables de entorno (comportamiento histórico)."""
+
+    name = "env"
+
+    def get(self, key: str) -> Optional[str]:
+        return os.getenv(key)
+
+
+class VaultSecretsProvider(SecretsProvider):
+    """
+    Secretos desde HashiCorp Vault (KV v2).
+
+    Se autentica por AppRole o Kubernetes, renueva el token antes de que expire su
+    lease y vuelve a leer los secretos cada VAULT_REFRESH_INTERVAL segundos para
+    recoger rotaciones sin reinicio.
+    """
+
+    name = "vault"
+
+    def __init__(
+        self,
+        address: str,
+        auth_method: str,
+        mount: str = "secret",
+        path: str = "gha-ephemeral-runners",
+        namespace: Optional[str] = None,
+        refresh_interval: int = 300,
+    ):
+        self.address = address.rstrip("/")
+        self.auth_method = auth_method
+        self.mount = mount.strip("/")
+        self.path = path.strip("/")
+        self.namespace = namespace
+        self.refresh_interval = refresh_interval
+        self.timeout = 10.0
+
+        self.token: Optional[str] = None
+        self.token_expires_at = 0.0
+        self.token_ttl = 0
+        self.token_renewable = False
+        self.secrets: Dict[str, str] = {}
+        self.secrets_loaded_at = 0.0
+        self.lock = threading.Lock()
+        self.running = True
+
+        self.login()
+        self.refresh_secrets()
+
+        self.renewal_thread = threading.Thread(target=self._renewal_loop, daemon=True)
+        self.renewal_thread.start()
+
+    def _headers(self, authenticated: bool = True) -> Dict[str, str]:
+        headers = {}
+        if self.namespace:
+            headers["X-Vault-Namespace"] = self.namespace
+        if authenticated and self.token:
+            headers["X-Vault-Token"] = self.token
+        return headers
+
+    def _login_payload(self) -> Dict[str, str]:
+        """Construye el payload de login según el método de autenticación."""
+        if self.auth_method == "approle":
+            role_id = os.getenv("VAULT_ROLE_ID")
+            secret_id = os.getenv("VAULT_SECRET_ID")
+            secret_id_path = os.getenv("VAULT_SECRET_ID_PATH")
+            if secret_id_path:
+                with open(secret_id_path, "r") as secret_file:
+                    secret_id = secret_file.read().strip()
+            if not role_id or not secret_id:
+                raise ConfigurationError("AppRole requiere VAULT_ROLE_ID y VAULT_SECRET_ID")
+            return {"role_id": role_id, "secret_id": secret_id}
+
+        if self.auth_method == "kubernetes":
+            role = os.getenv("VAULT_K8S_ROLE")
+            jwt_path = os.getenv(
+                "VAULT_K8S_JWT_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token"
+            )
+            if not role:
+                raise ConfigurationError("Kubernetes auth requiere VAULT_K8S_ROLE")
+            with open(jwt_path, "r") as jwt_file:
+                return {"role": role, "jwt": jwt_file.read().strip()}
+
+        raise ConfigurationError(f"VAULT_AUTH_METHOD no soportado: {self.auth_method}")
+
+    def login(self):
+        """Obtiene un token de Vault con el método configurado."""
+        if self.auth_method == "token":
+            self.token = os.getenv("VAULT_TOKEN")
+            if not self.token:
+                raise ConfigurationError("VAULT_AUTH_METHOD=token requiere VAULT_TOKEN")
+            self.token_expires_at = float("inf")
+            return
+
+        mount = os.getenv("VAULT_AUTH_MOUNT", self.auth_method)
+        response = requests.post(
+            f"{self.address}/v1/auth/{mount}/login",
+            json=self._login_payload(),
+            headers=self._headers(authenticated=False),
+            timeout=self.timeout,
+        )
+        if response.status_code != 200:
+            raise ConfigurationError(f"Login en Vault falló ({self.auth_method}): {response.status_code}")
+
+        auth = response.json()["auth"]
+        self.token = auth["client_token"]
+        self.token_renewable = auth.get("renewable", False)
+        self.token_ttl = auth.get("lease_duration", 3600)
+        self.token_expires_at = time.time() + self.token_ttl
+        logger.info(format_log('SUCCESS', 'Autenticado en Vault', f'método {self.auth_method}'))
+
+    def renew_token(self):
+        """Renueva el token actual o vuelve a autenticarse si no es renovable."""
+        if self.auth_method == "token":
+            return
+
+        if self.token_renewable:
+            response = requests.post(
+                f"{self.address}/v1/auth/token/renew-self",
+                headers=self._headers(),
+                timeout=self.timeout,
+            )
+            if response.status_code == 200:
+                auth = response.json()["auth"]
+                self.token_ttl = auth.get("lease_duration", 3600)
+                self.token_expires_at = time.time() + self.token_ttl
+                logger.debug("Token de Vault renovado")
+                return
+            logger.warning(format_log('WARNING', 'Renovación de token de Vault falló', str(response.status_code)))
+
+        self.login()
+
+    def refresh_secrets(self):
+        """Lee los secretos del path KV v2 configurado."""
+        response = requests.get(
+            f"{self.address}/v1/{self.mount}/data/{self.path}",
+            headers=self._headers(),
+            timeout=self.timeout,
+        )
+        if response.status_code != 200:
+            raise ConfigurationError(f"No se pudieron leer secretos de Vault: {response.status_code}")
+
+        data = response.json()["data"]["data"]
+        with self.lock:
+            initial_load = not self.secrets_loaded_at
+            changed = [key for key, value in data.items() if self.secrets.get(key) != value]
+            self.secrets = data
+            self.secrets_loaded_at = time.time()
+
+        if changed and not initial_load:
+            logger.info(format_log('CONFIG', 'Secretos de Vault actualizados', ", ".join(sorted(changed))))
+
+    def _renewal_loop(self):
+        """Renueva el token a 2/3 de su lease y refresca los secretos periódicamente."""
+        while self.running:
+            time.sleep(15)
+            try:
+                remaining = self.token_expires_at - time.time()
+                if remaining < self.token_ttl / 3:
+                    self.renew_token()
+
+                if time.time() - self.secrets_loaded_at >= self.refresh_interval:
+                    self.refresh_secrets()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error renovando secretos de Vault', str(e)))
+
+    def get(self, key: str) -> Optional[str]:
+        with self.lock:
+            value = self.secrets.get(key)
+        # Los secretos no presentes en Vault pueden seguir viniendo del entorno
+        return value if value is not None else os.getenv(key)
+
+    def close(self):
+        self.running = False
+
+
+def create_secrets_provider() -> SecretsProvider:
+    """Crea el proveedor de secretos según SECRETS_PROVIDER (env/vault)."""
+    provider = os.getenv("SECRETS_PROVIDER", "env").lower()
+
+    if provider == "vault":
+        address = os.getenv("VAULT_ADDR")
+        if not address:
+            raise ConfigurationError("SECRETS_PROVIDER=vault requiere VAULT_ADDR")
+        return VaultSecretsProvider(
+            address=address,
+            auth_method=os.getenv("VAULT_AUTH_METHOD", "approle").lower(),
+            mount=os.getenv("VAULT_KV_MOUNT", "secret"),
+            path=os.getenv("VAULT_SECRET_PATH", "gha-ephemeral-runners"),
+            namespace=os.getenv("VAULT_NAMESPACE"),
+            refresh_interval=int(os.getenv("VAULT_REFRESH_INTERVAL", "300")),
+        )
+
+    if provider != "env":
+        raise ConfigurationError(f"SECRETS_PROVIDER no soportado: {provider}")
+
+    return EnvSecretsProvider()
+
+
+_provider: Optional[SecretsProvider] = None
+
+
+def get_secrets_provider() -> SecretsProvider:
+    """Retorna el proveedor de secretos compartido (creado en el primer uso)."""
+    global _provider
+    if _provider is None:
+        _provider = create_secrets_provider()
+        logger.info(format_log('CONFIG', 'Proveedor de secretos', _provider.name))
+    return _provider
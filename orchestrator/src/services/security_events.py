@@ -0,0 +1,89 @@
+"""
+Eventos de seguridad del orchestrator.
+Envía eventos estructurados (imágenes rechazadas, pools privilegiados) a un webhook
+SIEM, separado de los logs operativos.
+"""
+
+import datetime
+import os
+import queue
+import threading
+from typing import Any, Dict, Optional
+
+import requests
+from src.services.metrics import metrics
+from src.services.retries import http_transient, retry_budgets
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class SecurityEventEmitter:
+    """
+    Cola de eventos de seguridad con entrega en segundo plano.
+
+    La entrega nunca bloquea ni hace fallar la operación que generó el evento;
+    si la cola se llena los eventos se descartan y se cuentan en métricas.
+    """
+
+    def __init__(self, url: Optional[str], token: Optional[str] = None, service: str = "orchestrator"):
+        self.url = url
+        self.token = token
+        self.service = service
+        self.queue: "queue.Queue[Dict[str, Any]]" = queue.Queue(maxsize=1000)
+        self.timeout = 10.0
+
+        if self.url:
+            threading.Thread(target=self._delivery_loop, daemon=True).start()
+            logger.info(format_log('CONFIG', 'Webhook de eventos de seguridad activado'))
+
+    def emit(self, event_type: str, severity: str = "warning", **details: Any):
+        """
+        Registra un evento de seguridad.
+
+        Args:
+            event_type: Tipo de evento (ej: image.unsigned_rejected)
+            severity: info, warning o critical
+            details: Campos específicos del evento
+        """
+        metrics.incr("security.events", tags={"type": event_type})
+        if not self.url:
+            return
+
+        event = {
+            "event_type": event_type,
+            "severity": severity,
+            "service": self.service,
+            "timestamp": datetime.datetime.utcnow().isoformat() + "Z",
+            "details": details,
+        }
+        try:
+            self.queue.put_nowait(event)
+        except queue.Full:
+            metrics.incr("security.events_dropped")
+
+    def _delivery_loop(self):
+        headers = {"Content-Type": "application/json"}
+        if self.token:
+            headers["Authorization"] = f"Bearer {self.token}"
+
+        while True:
+            event = self.queue.get()
+            try:
+                response = retry_budgets.get("siem").call(
+                    lambda: requests.post(self.url, json=event, headers=headers, timeout=self.timeout),
+                    retry_error=lambda e: isinstance(e, requests.RequestException),
+                    retry_result=http_transient,
+                )
+                delivered = response.status_code < 300
+            except requests.RequestException:
+                delivered = False
+            if not delivered:
+                metrics.incr("security.events_failed")
+                logger.warning(format_log('WARNING', 'No se pudo entregar evento de seguridad', event["event_type"]))
+
+
+# Emisor compartido por todos los módulos del orchestrator
+security_events = SecurityEventEmitter(
+    os.getenv("SECURITY_EVENTS_WEBHOOK_URL"), os.getenv("SECURITY_EVENTS_WEBHOOK_TOKEN")
+)
@@ -0,0 +1,95 @@
+"""
+Reparto de organizaciones entre orchestrators.
+Con SHARD_ID y SHARDS, cada orchestrator atiende solo a los owners (organizaciones
+o usuarios) que le asigna un anillo de hash consistente: el modo automático
+descubre y escala únicamente sus repos, y el gateway (ORCHESTRATOR_SHARDS) le envía
+los webhooks de esos owners. El anillo debe coincidir con el del gateway: mismos
+nombres, mismo hash y mismos nodos virtuales.
+"""
+
+import bisect
+import hashlib
+import os
+from typing import Any, Dict, List, Optional
+
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Nodos virtuales por shard: reparten los owners de forma pareja con pocos shards
+RING_REPLICAS = 128
+
+
+def _hash(value: str) -> int:
+    return int.from_bytes(hashlib.sha256(value.encode("utf-8")).digest()[:8], "big")
+
+
+def shard_key(scope_name: str) -> str:
+    """Owner del scope ('Org/repo' u 'Org' -> 'org'): todos los repos de un owner van al mismo shard."""
+    return scope_name.split("/", 1)[0].strip().lower()
+
+
+class HashRing:
+    """Anillo de hash consistente sobre los nombres de shard."""
+
+    def __init__(self, shards: List[str], replicas: int = RING_REPLICAS):
+        if not shards:
+            raise ConfigurationError("El anillo de shards necesita al menos un shard")
+        self.shards = list(shards)
+        self.ring = sorted((_hash(f"{shard}#{index}"), shard) for shard in shards for index in range(replicas))
+        self.points = [point for point, _ in self.ring]
+
+    def owner(self, key: str) -> str:
+        """Shard dueño de la clave: el primer punto del anillo a partir de su hash."""
+        index = bisect.bisect(self.points, _hash(key)) % len(self.points)
+        return self.ring[index][1]
+
+
+class ShardAssignment:
+    """Owners que atiende este orchestrator; sin shards los atiende todos."""
+
+    def __init__(self, shard_id: Optional[str] = None, shards: Optional[List[str]] = None):
+        self.shard_id = shard_id
+        self.ring = HashRing(shards) if shard_id and shards else None
+        if self.ring and shard_id not in self.ring.shards:
+            raise ConfigurationError(f"SHARD_ID {shard_id} no está en SHARDS ({', '.join(self.ring.shards)})")
+
+    def owner(self, scope_name: str) -> Optional[str]:
+        return self.ring.owner(shard_key(scope_name)) if self.ring else None
+
+    def owns(self, scope_name: str) -> bool:
+        return not self.ring or self.owner(scope_name) == self.shard_id
+
+    def filter(self, scope_names: List[str]) -> List[str]:
+        """Scopes propios de una lista (repos descubiertos por el modo automático)."""
+        owned = [name for name in scope_names if self.owns(name)]
+        if self.ring:
+            metrics.gauge("sharding.owned_repos", len(owned))
+        return owned
+
+    def check_request(self, scope_name: str):
+        """Avisa de un request para un owner de otro shard (el gateway lo enruta mal o cambió el anillo)."""
+        if not self.owns(scope_name):
+            metrics.incr("sharding.misrouted")
+            logger.warning(format_log('WARNING', 'Request para otro shard', f"{scope_name} pertenece a {self.owner(scope_name)}"))
+
+    def status(self) -> Optional[Dict[str, Any]]:
+        if not self.ring:
+            return None
+        return {"shard_id": self.shard_id, "shards": self.ring.shards}
+
+
+def create_sharding() -> ShardAssignment:
+    """Asignación desde SHARD_ID y SHARDS (nombres separados por comas)."""
+    shard_id = os.getenv("SHARD_ID") or None
+    shards = [name.strip() for name in os.getenv("SHARDS", "").split(",") if name.strip()]
+    if bool(shard_id) != bool(shards):
+        raise ConfigurationError("SHARD_ID y SHARDS deben configurarse juntos")
+    assignment = ShardAssignment(shard_id, shards)
+    if assignment.ring:
+        logger.info(format_log('CONFIG', 'Shard de organizaciones', f"{shard_id} de {', '.join(shards)}"))
+    return assignment
+
+
+sharding = create_sharding()
@@ -0,0 +1,190 @@
+"""
+Contenedores de servicio (sidecars) por runner.
+Un pool con "sidecars" lanza junto a cada runner sus contenedores de servicio (bases de
+datos, cachés, un registry local...) en la red propia del runner, donde se alcanzan por
+su nombre. Se crean antes que el runner, se espera a que estén listos si definen "ready"
+y se eliminan con él, con sus volúmenes anónimos. Cada sidecar llega al job como
+SIDECAR_<NOMBRE>_HOST y, si declara puertos, SIDECAR_<NOMBRE>_PORT.
+
+Spec de cada sidecar: name, image, env, ports, entrypoint, command, cpus, memory, tmpfs
+y ready ({"cmd": comando de comprobación, "timeout": segundos}).
+"""
+
+import re
+import time
+from typing import Any, Dict, List
+
+import docker
+from src.services.metrics import metrics
+from src.services.workspaces import format_size, parse_size
+from src.utils.helpers import ConfigurationError, DockerError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SIDECAR_LABEL = "gha-sidecar-of"
+SIDECAR_KEYS = ("name", "image", "env", "ports", "entrypoint", "command", "cpus", "memory", "tmpfs", "ready")
+NAME_PATTERN = re.compile(r"[a-z][a-z0-9-]{0,30}")
+
+
+def sidecar_container_name(runner_name: str, name: str) -> str:
+    return f"gha-sidecar-{runner_name}-{name}"
+
+
+def env_prefix(name: str) -> str:
+    return f"SIDECAR_{name.upper().replace('-', '_')}"
+
+
+def validate_sidecars(pool_name: str, specs: Any):
+    if not isinstance(specs, list):
+        raise ConfigurationError(f"Pool {pool_name}: sidecars debe ser una lista")
+    names = set()
+    for spec in specs:
+        if not isinstance(spec, dict) or set(spec) - set(SIDECAR_KEYS):
+            raise ConfigurationError(f"Pool {pool_name}: cada sidecar admite {', '.join(SIDECAR_KEYS)}")
+        name = spec.get("name")
+        # El nombre es el hostname del sidecar en la red del runner
+        if not isinstance(name, str) or not NAME_PATTERN.fullmatch(name):
+            raise ConfigurationError(f"Pool {pool_name}: nombre de sidecar inválido {name} (minúsculas, dígitos y guiones)")
+        if name in names:
+            raise ConfigurationError(f"Pool {pool_name}: sidecar {name} repetido")
+        names.add(name)
+        if not spec.get("image"):
+            raise ConfigurationError(f"Pool {pool_name}: el sidecar {name} requiere image")
+        if not isinstance(spec.get("env", {}), dict):
+            raise ConfigurationError(f"Pool {pool_name}: env del sidecar {name} debe ser un objeto")
+        if not all(isinstance(port, int) for port in spec.get("ports", [])):
+            raise ConfigurationError(f"Pool {pool_name}: ports del sidecar {name} debe ser una lista de números")
+        if "memory" in spec:
+            parse_size(spec["memory"], f"Pool {pool_name}: memory del sidecar {name}")
+        ready = spec.get("ready")
+        if ready is not None and (not isinstance(ready, dict) or not ready.get("cmd")):
+            raise ConfigurationError(f"Pool {pool_name}: ready del sidecar {name} requiere cmd")
+
+
+class RunnerSidecars:
+    """Creación, espera y eliminación de los sidecars de un runner."""
+
+    def __init__(self, registry_mirror: Any = None, ready_timeout: int = 60):
+        self.registry_mirror = registry_mirror
+        self.ready_timeout = ready_timeout
+
+    def _options(self, spec: Dict[str, Any]) -> Dict[str, Any]:
+        options: Dict[str, Any] = {}
+        if spec.get("entrypoint"):
+            options["entrypoint"] = spec["entrypoint"]
+        if spec.get("command"):
+            options["command"] = spec["command"]
+        if spec.get("cpus"):
+            options["nano_cpus"] = int(float(spec["cpus"]) * 1e9)
+        if spec.get("memory"):
+            options["mem_limit"] = format_size(parse_size(spec["memory"], f"sidecar {spec['name']}"))
+        if spec.get("tmpfs"):
+            options["tmpfs"] = {path: "" for path in spec["tmpfs"]}
+        ready = spec.get("ready")
+        if ready:
+            cmd = ready["cmd"]
+            timeout = int(ready.get("timeout", self.ready_timeout))
+            options["healthcheck"] = {
+                "test": ["CMD-SHELL", cmd] if isinstance(cmd, str) else ["CMD", *cmd],
+                "interval": 2 * 10 ** 9,
+                "timeout": 5 * 10 ** 9,
+                "retries": max(1, timeout // 2),
+            }
+        return options
+
+    def start(self, client: Any, runner_name: str, pool: Any, network: str, environment: Dict[str, str]) -> List[Any]:
+        """
+        Lanza los sidecars del pool en la red del runner y espera a los que definen ready.
+
+        Raises:
+            DockerError: Si un sidecar no arranca o no está listo a tiempo (los ya creados se eliminan)
+        """
+        containers: List[Any] = []
+        try:
+            for spec in pool.sidecars:
+                image = self.registry_mirror.resolve(client, spec["image"]) if self.registry_mirror and pool.registry_mirror else spec["image"]
+                # containers.create no descarga la imagen, a diferencia de containers.run
+                try:
+                    client.images.get(image)
+                except docker.errors.ImageNotFound:
+                    client.images.pull(image)
+                container = client.containers.create(
+                    image,
+                    name=sidecar_container_name(runner_name, spec["name"]),
+                    environment={str(key): str(value) for key, value in (spec.get("env") or {}).items()},
+                    labels={SIDECAR_LABEL: runner_name, "runner-pool": pool.name, "gha-sidecar": spec["name"]},
+                    hostname=spec["name"],
+                    network=network,
+                    # El alias es el nombre con el que el job alcanza el sidecar
+                    networking_config={network: client.api.create_endpoint_config(aliases=[spec["name"]])},
+                    security_opt=["no-new-privileges"],
+                    **self._options(spec),
+                )
+                containers.append(container)
+                container.start()
+                prefix = env_prefix(spec["name"])
+                environment[f"{prefix}_HOST"] = spec["name"]
+                if spec.get("ports"):
+                    environment[f"{prefix}_PORT"] = str(spec["ports"][0])
+            for spec, container in zip(pool.sidecars, containers):
+                if spec.get("ready"):
+                    self._wait_ready(container, spec, runner_name)
+        except Exception as e:
+            self._remove(containers)
+            metrics.incr("sidecars.failed", tags={"pool": pool.name})
+            if isinstance(e, DockerError):
+                raise
+            raise DockerError(f"Sidecars de {runner_name}: {e}")
+        if containers:
+            metrics.incr("sidecars.started", len(containers), tags={"pool": pool.name})
+            logger.info(format_log('DOCKER', f'Sidecars de {runner_name}', ", ".join(spec["name"] for spec in pool.sidecars)))
+        return containers
+
+    def _wait_ready(self, container: Any, spec: Dict[str, Any], runner_name: str):
+        deadline = time.time() + int(spec["ready"].get("timeout", self.ready_timeout))
+        while time.time() < deadline:
+            container.reload()
+            state = container.attrs.get("State") or {}
+            health = (state.get("Health") or {}).get("Status")
+            if health == "healthy":
+                return
+            if state.get("Status") in ("exited", "dead") or health == "unhealthy":
+                break
+            time.sleep(1)
+        raise DockerError(f"El sidecar {spec['name']} de {runner_name} no está listo: {container.logs(tail=5).decode('utf-8', errors='replace').strip()}")
+
+    def _remove(self, containers: List[Any]):
+        for container in containers:
+            try:
+                container.remove(force=True, v=True)
+            except docker.errors.NotFound:
+                pass
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo eliminar el sidecar', f"{container.name}: {e}"))
+
+    def remove(self, client: Any, runner_name: str) -> int:
+        """Elimina los sidecars de un runner con sus volúmenes anónimos."""
+        try:
+            containers = client.containers.list(all=True, filters={"label": f"{SIDECAR_LABEL}={runner_name}"})
+        except Exception as e:
+            logger.warning(format_log('WARNING', f'No se pudieron listar los sidecars de {runner_name}', str(e)))
+            return 0
+        self._remove(containers)
+        return len(containers)
+
+    def prune(self, client: Any) -> int:
+        """Elimina los sidecars cuyo runner ya no existe (reinicios o eliminaciones forzadas)."""
+        try:
+            sidecars = client.containers.list(all=True, filters={"label": SIDECAR_LABEL})
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron listar los sidecars', str(e)))
+            return 0
+        orphans = []
+        for container in sidecars:
+            runner_name = (container.labels or {}).get(SIDECAR_LABEL)
+            if not client.containers.list(all=True, filters={"label": [f"runner-name={runner_name}", "gha-ephemeral=true"]}):
+                orphans.append(container)
+        self._remove(orphans)
+        if orphans:
+            logger.info(format_log('INFO', 'Sidecars huérfanos eliminados', str(len(orphans))))
+        return len(orphans)
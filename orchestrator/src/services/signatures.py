@@ -0,0 +1,147 @@
+"""
+Verificación de firmas de imágenes de runners con cosign.
+Antes de lanzar un runner comprueba que la imagen esté firmada por una clave
+pública o identidad keyless configurada.
+"""
+
+import os
+import subprocess
+import threading
+import time
+from typing import Dict, List, Optional, Tuple
+
+from src.services.metrics import metrics
+from src.services.security_events import security_events
+from src.utils.helpers import ImageVerificationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+VERIFICATION_MODES = ("off", "warn", "enforce")
+
+
+class ImageVerifier:
+    """
+    Verifica imágenes con `cosign verify`.
+
+    Modos:
+        off:     no se verifica
+        warn:    se verifica y se registra el fallo, pero la imagen se usa
+        enforce: las imágenes sin firma válida se rechazan
+    """
+
+    def __init__(
+        self,
+        mode: str = "off",
+        public_keys: Optional[List[str]] = None,
+        identities: Optional[List[Tuple[str, str]]] = None,
+        cache_ttl: int = 3600,
+        cosign_path: str = "cosign",
+    ):
+        if mode not in VERIFICATION_MODES:
+            raise ValueError(f"IMAGE_SIGNATURE_VERIFICATION debe ser uno de {VERIFICATION_MODES}")
+
+        self.mode = mode
+        self.public_keys = public_keys or []
+        self.identities = identities or []
+        self.cache_ttl = cache_ttl
+        self.cosign_path = cosign_path
+        self.verified: Dict[str, float] = {}
+        self.lock = threading.Lock()
+
+        if mode != "off" and not self.public_keys and not self.identities:
+            raise ValueError("La verificación de firmas requiere COSIGN_PUBLIC_KEYS o COSIGN_IDENTITIES")
+
+    @property
+    def enabled(self) -> bool:
+        return self.mode != "off"
+
+    def _verification_commands(self, image: str) -> List[List[str]]:
+        """Un comando cosign por cada clave o identidad aceptada."""
+        commands = []
+        for key in self.public_keys:
+            commands.append([self.cosign_path, "verify", "--key", key, image])
+        for issuer, identity in self.identities:
+            commands.append([
+                self.cosign_path, "verify",
+                "--certificate-oidc-issuer", issuer,
+                "--certificate-identity-regexp", identity,
+                image,
+            ])
+        return commands
+
+    def _run_cosign(self, image: str) -> Optional[str]:
+        """Retorna la clave/identidad que valida la firma o None si ninguna lo hace."""
+        for command in self._verification_commands(image):
+            try:
+                result = subprocess.run(command, capture_output=True, text=True, timeout=120)
+            except (OSError, subprocess.TimeoutExpired) as e:
+                logger.error(format_log('ERROR', 'No se pudo ejecutar cosign', str(e)))
+                return None
+            if result.returncode == 0:
+                return command[3]
+            logger.debug(f"cosign rechazó {image} con {command[3]}: {result.stderr.strip()}")
+        return None
+
+    def verify(self, image: str, required: bool = True):
+        """
+        Verifica la firma de una imagen.
+
+        Args:
+            image: Referencia de la imagen
+            required: False si el pool optó por no exigir firma
+
+        Raises:
+            ImageVerificationError: Si la imagen no está firmada y el modo es enforce
+        """
+        if not self.enabled or not required:
+            return
+
+        with self.lock:
+            verified_at = self.verified.get(image)
+        if verified_at and time.time() - verified_at < self.cache_ttl:
+            return
+
+        signer = self._run_cosign(image)
+        if signer:
+            with self.lock:
+                self.verified[image] = time.time()
+            metrics.incr("images.verified")
+            logger.info(format_log('SUCCESS', 'Firma de imagen verificada', f'{image} ({signer})'))
+            return
+
+        metrics.incr("images.verification_failed", tags={"mode": self.mode})
+        security_events.emit(
+            "image.unsigned_rejected" if self.mode == "enforce" else "image.unsigned_allowed",
+            severity="critical" if self.mode == "enforce" else "warning",
+            image=image,
+            mode=self.mode,
+        )
+        if self.mode == "enforce":
+            logger.error(format_log('ERROR', 'Imagen sin firma válida rechazada', image))
+            raise ImageVerificationError(f"La imagen {image} no tiene una firma cosign válida")
+
+        logger.warning(format_log('WARNING', 'Imagen sin firma válida', image))
+
+
+def parse_identities(raw_identities: str) -> List[Tuple[str, str]]:
+    """Convierte 'issuer|identity_regexp;issuer|identity_regexp' en pares (issuer, identidad)."""
+    identities = []
+    for item in raw_identities.split(";"):
+        issuer, _, identity = item.strip().partition("|")
+        if issuer and identity:
+            identities.append((issuer.strip(), identity.strip()))
+    return identities
+
+
+def create_image_verifier() -> ImageVerifier:
+    """Crea el verificador de imágenes desde variables de entorno."""
+    verifier = ImageVerifier(
+        mode=os.getenv("IMAGE_SIGNATURE_VERIFICATION", "off").lower(),
+        public_keys=[key.strip() for key in os.getenv("COSIGN_PUBLIC_KEYS", "").split(",") if key.strip()],
+        identities=parse_identities(os.getenv("COSIGN_IDENTITIES", "")),
+        cache_ttl=int(os.getenv("COSIGN_CACHE_TTL", "3600")),
+        cosign_path=os.getenv("COSIGN_PATH", "cosign"),
+    )
+    if verifier.enabled:
+        logger.info(format_log('CONFIG', 'Verificación de firmas de imágenes', verifier.mode))
+    return verifier
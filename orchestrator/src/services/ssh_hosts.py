@@ -0,0 +1,459 @@
+"""
+Backend de hosts estáticos por SSH.
+Lanza runners efímeros como procesos en un inventario fijo de máquinas alcanzables
+por SSH (placas ARM, equipos de laboratorio): crea un directorio de trabajo por runner
+a partir de una instalación del agente en el host, lo registra con --ephemeral, lo
+ejecuta en segundo plano y lo elimina al destruirse. Cada host tiene un número de
+slots que limita cuántos runners ejecuta a la vez.
+
+El inventario (SSH_HOSTS_FILE) es una lista de hosts o un inventario YAML de Ansible.
+"""
+
+import json
+import os
+import shlex
+import subprocess
+import threading
+from datetime import datetime, timezone
+from types import SimpleNamespace
+from typing import Any, Dict, List, Optional
+
+import yaml
+
+from src.services.capabilities import capabilities, labels_script
+from src.services.github_server import github_web_url
+from src.services.workspaces import quota_for, xfs_release_script
+from src.utils.helpers import CapacityError, ConfigurationError, format_log, redactor, setup_logger
+
+logger = setup_logger(__name__)
+
+# Metadatos del runner en su directorio; permiten reconocerlo tras reiniciar el orchestrator
+META_FILE = "gha-runner.json"
+
+
+class SSHHost:
+    """Host del inventario con sus slots de concurrencia."""
+
+    def __init__(
+        self,
+        name: str,
+        address: Optional[str] = None,
+        user: Optional[str] = None,
+        port: int = 22,
+        slots: int = 1,
+        labels: Optional[List[str]] = None,
+        runner_dir: Optional[str] = None,
+        workdir: Optional[str] = None,
+        key_path: Optional[str] = None,
+    ):
+        if slots < 1:
+            raise ConfigurationError(f"Host SSH {name}: slots debe ser al menos 1")
+        self.name = name
+        self.address = address or name
+        self.user = user or os.getenv("SSH_USER", "runner")
+        self.port = int(port)
+        self.slots = int(slots)
+        self.labels = labels or []
+        self.runner_dir = runner_dir or os.getenv("SSH_RUNNER_DIR", "/opt/actions-runner")
+        self.workdir = (workdir or os.getenv("SSH_WORKDIR", "/var/lib/gha-runners")).rstrip("/")
+        self.key_path = key_path or os.getenv("SSH_KEY_PATH")
+        # Último estado conocido (se actualiza en cada escaneo del host)
+        self.running = 0
+        self.reachable: Optional[bool] = None
+        self.last_error: Optional[str] = None
+        # Disco o inodos por encima del umbral (ver disk_pressure.py): no recibe runners nuevos
+        self.disk_pressure = False
+
+    @classmethod
+    def from_dict(cls, spec: Dict[str, Any]) -> "SSHHost":
+        if not spec.get("name"):
+            raise ConfigurationError("Cada host SSH requiere 'name'")
+        return cls(
+            name=spec["name"],
+            address=spec.get("address"),
+            user=spec.get("user"),
+            port=spec.get("port", 22),
+            slots=spec.get("slots", 1),
+            labels=spec.get("labels"),
+            runner_dir=spec.get("runner_dir"),
+            workdir=spec.get("workdir"),
+            key_path=spec.get("key_path"),
+        )
+
+    def matches(self, selectors: Optional[List[str]]) -> bool:
+        """Un pool sin ssh_hosts usa todos los hosts; si no, por nombre, label o grupo de Ansible."""
+        return not selectors or self.name in selectors or any(label in selectors for label in self.labels)
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "address": self.address,
+            "slots": self.slots,
+            "running": self.running,
+            "labels": self.labels,
+            "reachable": self.reachable,
+            "last_error": self.last_error,
+            "disk_pressure": self.disk_pressure,
+        }
+
+
+def _ansible_hosts(group: Dict[str, Any], inherited: Dict[str, Any], groups: List[str], hosts: Dict[str, Dict[str, Any]]):
+    """Recorre un grupo del inventario YAML de Ansible acumulando variables y grupos."""
+    group = group or {}
+    variables = {**inherited, **(group.get("vars") or {})}
+    for name, host_vars in (group.get("hosts") or {}).items():
+        entry = hosts.setdefault(name, {"vars": {}, "groups": []})
+        entry["vars"] = {**variables, **entry["vars"], **(host_vars or {})}
+        entry["groups"].extend(g for g in groups if g not in entry["groups"])
+    for child_name, child in (group.get("children") or {}).items():
+        _ansible_hosts(child, variables, groups + [child_name], hosts)
+
+
+def parse_inventory(data: Any) -> List[SSHHost]:
+    """
+    Hosts desde una lista ({"hosts": [...]} o [...]) o desde un inventario YAML de Ansible.
+
+    En el formato de Ansible se usan ansible_host, ansible_user, ansible_port y
+    ansible_ssh_private_key_file, más runner_slots, runner_labels, runner_dir y
+    runner_workdir; los grupos del host se agregan como labels.
+    """
+    if isinstance(data, dict) and "all" in data:
+        found: Dict[str, Dict[str, Any]] = {}
+        _ansible_hosts(data["all"], {}, [], found)
+        hosts = []
+        for name, entry in found.items():
+            host_vars = entry["vars"]
+            hosts.append(SSHHost(
+                name=name,
+                address=host_vars.get("ansible_host"),
+                user=host_vars.get("ansible_user"),
+                port=host_vars.get("ansible_port", 22),
+                slots=host_vars.get("runner_slots", 1),
+                labels=list(dict.fromkeys(list(host_vars.get("runner_labels") or []) + entry["groups"])),
+                runner_dir=host_vars.get("runner_dir"),
+                workdir=host_vars.get("runner_workdir"),
+                key_path=host_vars.get("ansible_ssh_private_key_file"),
+            ))
+        return hosts
+
+    specs = data.get("hosts", []) if isinstance(data, dict) else data
+    if not isinstance(specs, list):
+        raise ConfigurationError("El inventario SSH debe ser una lista de hosts o un inventario de Ansible")
+    return [SSHHost.from_dict(spec) for spec in specs]
+
+
+class SSHRunner:
+    """
+    Runner en un host SSH con la interfaz de contenedor que usa el ciclo de vida.
+
+    Expone id, name, labels, status, attrs, reload(), stop(), remove() y logs()
+    para que la purga, la destrucción y los logs funcionen igual que con Docker.
+    """
+
+    def __init__(self, backend: "SSHHostBackend", host: SSHHost, runner_name: str, labels: Dict[str, str], created: str):
+        self.backend = backend
+        self.host = host
+        self.runner_name = runner_name
+        self.id = f"ssh-{host.name}-{runner_name}"
+        self.name = f"gha-runner-{runner_name}"
+        self.labels = labels
+        self.status = "running"
+        self.image = SimpleNamespace(tags=[f"ssh://{host.name}"])
+        self.ports: Dict[str, Any] = {}
+        self.attrs: Dict[str, Any] = {"Created": created, "Config": {"Image": None}, "State": {}}
+
+    @property
+    def directory(self) -> str:
+        return f"{self.host.workdir}/{self.runner_name}"
+
+    def reload(self):
+        self.status = self.backend.runner_status(self)
+
+    def stop(self, timeout: int = 30):
+        self.backend.teardown(self, timeout)
+
+    def remove(self, force: bool = False):
+        # stop() ya elimina el directorio de trabajo del runner
+        pass
+
+    def logs(self, tail: int = 50) -> bytes:
+        return self.backend.runner_logs(self, tail).encode("utf-8")
+
+
+class SSHHostBackend:
+    """Ejecuta runners en los hosts del inventario repartiéndolos según sus slots libres."""
+
+    def __init__(self, hosts: List[SSHHost], ssh_path: str = "ssh", known_hosts_file: Optional[str] = None, connect_timeout: int = 10):
+        if not hosts:
+            raise ConfigurationError("El inventario SSH no tiene hosts")
+        self.hosts: Dict[str, SSHHost] = {host.name: host for host in hosts}
+        self.ssh = ssh_path
+        self.known_hosts_file = known_hosts_file
+        self.connect_timeout = connect_timeout
+        self.runners: Dict[str, SSHRunner] = {}
+        # Runners en creación: ocupan slot antes de aparecer en el escaneo del host
+        self.reserved: Dict[str, int] = {name: 0 for name in self.hosts}
+        self.lock = threading.Lock()
+
+    def _run(self, host: SSHHost, script: str, timeout: int = 120) -> str:
+        """Ejecuta un script con sh en el host; el script va por stdin para no exponer tokens en argv."""
+        command = [
+            self.ssh, "-p", str(host.port),
+            "-o", "BatchMode=yes",
+            "-o", f"ConnectTimeout={self.connect_timeout}",
+            "-o", "ServerAliveInterval=15",
+        ]
+        if self.known_hosts_file:
+            command += ["-o", "StrictHostKeyChecking=yes", "-o", f"UserKnownHostsFile={self.known_hosts_file}"]
+        else:
+            command += ["-o", "StrictHostKeyChecking=accept-new"]
+        if host.key_path:
+            command += ["-i", host.key_path]
+        command += [f"{host.user}@{host.address}", "sh -s"]
+
+        try:
+            result = subprocess.run(command, input=script, capture_output=True, text=True, timeout=timeout)
+        except FileNotFoundError:
+            raise ConfigurationError(f"ssh no encontrado: {self.ssh}")
+        except subprocess.TimeoutExpired:
+            host.reachable, host.last_error = False, "timeout"
+            raise RuntimeError(f"Timeout ejecutando comando en el host SSH {host.name}")
+
+        # ssh usa 255 para errores de conexión; el resto es el código del script
+        host.reachable = result.returncode != 255
+        if result.returncode != 0:
+            host.last_error = redactor.redact(result.stderr.strip())[-500:]
+            raise RuntimeError(f"Host SSH {host.name}: {host.last_error or f'código {result.returncode}'}")
+        host.last_error = None
+        return result.stdout
+
+    def scan(self, host: SSHHost) -> List[Dict[str, Any]]:
+        """Runners presentes en el host con su estado (running o exited)."""
+        workdir = shlex.quote(host.workdir)
+        output = self._run(host, f"""
+cd {workdir} 2>/dev/null || exit 0
+for d in */; do
+    d=${{d%/}}
+    [ -f "$d/{META_FILE}" ] || continue
+    state=exited
+    pid=$(cat "$d/runner.pid" 2>/dev/null) && kill -0 "$pid" 2>/dev/null && state=running
+    printf '%s\\t%s\\n' "$state" "$(cat "$d/{META_FILE}")"
+done
+""", timeout=30)
+        found = []
+        for line in output.splitlines():
+            state, _, meta = line.partition("\t")
+            try:
+                found.append({"state": state, **json.loads(meta)})
+            except ValueError:
+                continue
+        host.running = sum(1 for runner in found if runner["state"] == "running")
+        return found
+
+    def _acquire(self, pool: Any) -> SSHHost:
+        """Elige el host del pool con más slots libres y reserva uno."""
+        candidates = [host for host in self.hosts.values() if host.matches(pool.ssh_hosts)]
+        if not candidates:
+            raise ValueError(f"Pool {pool.name}: ningún host SSH coincide con {', '.join(pool.ssh_hosts)}")
+
+        best: Optional[SSHHost] = None
+        best_free = 0
+        pressured = 0
+        for host in candidates:
+            if host.disk_pressure:
+                pressured += 1
+                continue
+            try:
+                self.scan(host)
+            except (RuntimeError, ConfigurationError) as e:
+                logger.warning(format_log('WARNING', 'Host SSH no disponible', f"{host.name}: {e}"))
+                continue
+            with self.lock:
+                free = host.slots - host.running - self.reserved[host.name]
+            if free > best_free:
+                best, best_free = host, free
+
+        if best is None:
+            if pressured:
+                raise CapacityError(f"Pool {pool.name}: sin slots libres en los hosts SSH ({pressured} con presión de disco)")
+            raise CapacityError(f"Pool {pool.name}: sin slots libres en los hosts SSH")
+        with self.lock:
+            self.reserved[best.name] += 1
+        return best
+
+    def create_runner(
+        self,
+        registration_token: str,
+        scope: str,
+        scope_name: str,
+        runner_name: str,
+        runner_group: Optional[str],
+        labels: List[str],
+        pool: Any,
+    ) -> SSHRunner:
+        """Registra y arranca el agente en un directorio propio del host elegido."""
+        host = self._acquire(pool)
+        try:
+            runner_labels = list(dict.fromkeys(labels + host.labels))
+            container_labels = {
+                "gha-ephemeral": "true",
+                "runner-name": runner_name,
+                "scope": scope,
+                "scope_name": scope_name,
+                "repo": scope_name,
+                "runner-pool": pool.name,
+                "runner-backend": "ssh",
+                "ssh-host": host.name,
+                **({"runner-region": pool.region} if pool.region else {}),
+            }
+            created = datetime.now(timezone.utc).isoformat()
+            runner = SSHRunner(self, host, runner_name, container_labels, created)
+
+            config_args = [
+                "--unattended", "--ephemeral", "--replace", "--disableupdate",
+                "--url", f"{github_web_url()}/{scope_name}",
+                "--token", registration_token,
+                "--name", runner_name,
+                "--work", "_work",
+            ]
+            # Con labels de capacidades el script los calcula en el host y los agrega a los del pool
+            introspect = capabilities.applies(pool)
+            label_lines = "\n".join(labels_script(runner_labels)) if introspect else ""
+            if runner_labels and not introspect:
+                config_args += ["--labels", ",".join(runner_labels)]
+            if runner_group:
+                config_args += ["--runnergroup", runner_group]
+            meta = json.dumps({"labels": container_labels, "created": created})
+            # Cuota de proyecto XFS sobre _work (workspace del pool o WORKSPACE_QUOTA)
+            quota = quota_for(pool)
+            quota_lines = "\n".join(
+                quota.xfs_script(f"{runner.directory}/_work", runner_name, on_failure='rm -rf "$dir"; ')
+            ) if quota else ""
+
+            logger.info(f"🖥️ Creando runner {runner_name} en host SSH {host.name} (pool {pool.name})")
+            # setsid deja el agente en su propio grupo de procesos para detenerlo completo
+            output = self._run(host, f"""
+set -e
+dir={shlex.quote(runner.directory)}
+rm -rf "$dir"
+mkdir -p "$dir"
+cp -a {shlex.quote(host.runner_dir)}/. "$dir/"
+cd "$dir"
+{quota_lines}
+{label_lines}
+printf '%s\\n' {shlex.quote(meta)} > {META_FILE}
+./config.sh {" ".join(shlex.quote(arg) for arg in config_args)}{' --labels "$labels"' if introspect else ''} > config.log 2>&1 || {{ cat config.log >&2; rm -rf "$dir"; exit 1; }}
+setsid nohup ./run.sh > runner.log 2>&1 < /dev/null &
+echo $! > runner.pid
+""")
+            with self.lock:
+                self.runners[runner_name] = runner
+            host.running += 1
+            if introspect:
+                capabilities.record_output(pool.name, output)
+            logger.info(f"✅ Runner {runner_name} en ejecución en {host.name}")
+            return runner
+        finally:
+            with self.lock:
+                self.reserved[host.name] -= 1
+
+    def runner_status(self, runner: SSHRunner) -> str:
+        directory = shlex.quote(runner.directory)
+        try:
+            output = self._run(runner.host, f"""
+pid=$(cat {directory}/runner.pid 2>/dev/null) && kill -0 "$pid" 2>/dev/null && echo running || echo exited
+""", timeout=30)
+        except RuntimeError:
+            # Host inalcanzable: se mantiene el último estado para no purgar por un corte de red
+            return runner.status
+        return output.strip() or "exited"
+
+    def teardown(self, runner: SSHRunner, timeout: int = 30):
+        """Detiene el agente (grupo de procesos completo) y elimina su directorio."""
+        directory = shlex.quote(runner.directory)
+        # Sin límite en el proyecto XFS del runner por si el id se reutiliza
+        release_quota = "\n".join(xfs_release_script(f"{runner.directory}/_work", runner.runner_name))
+        self._run(runner.host, f"""
+pid=$(cat {directory}/runner.pid 2>/dev/null) || pid=
+if [ -n "$pid" ] && kill -0 "$pid" 2>/dev/null; then
+    kill -TERM "-$pid" 2>/dev/null || kill -TERM "$pid"
+    i=0
+    while kill -0 "$pid" 2>/dev/null && [ "$i" -lt {int(timeout)} ]; do sleep 1; i=$((i + 1)); done
+    kill -KILL "-$pid" 2>/dev/null || true
+fi
+{release_quota}
+rm -rf {directory}
+""", timeout=timeout + 60)
+        with self.lock:
+            self.runners.pop(runner.runner_name, None)
+        runner.status = "exited"
+
+    def runner_logs(self, runner: SSHRunner, tail: int = 50) -> str:
+        return self._run(runner.host, f"tail -n {int(tail)} {shlex.quote(runner.directory)}/runner.log 2>/dev/null || true", timeout=30)
+
+    def get(self, runner_name: str) -> Optional[SSHRunner]:
+        with self.lock:
+            return self.runners.get(runner_name)
+
+    def list_runners(self) -> List[SSHRunner]:
+        """
+        Runners en ejecución en todos los hosts.
+
+        Incluye los que siguen corriendo tras un reinicio del orchestrator y elimina los
+        directorios de runners terminados que ya nadie sigue.
+        """
+        result = []
+        for host in self.hosts.values():
+            try:
+                found = self.scan(host)
+            except (RuntimeError, ConfigurationError) as e:
+                logger.debug(f"No se pudo escanear el host SSH {host.name}: {e}")
+                continue
+            for entry in found:
+                labels = entry.get("labels") or {}
+                runner_name = labels.get("runner-name")
+                if not runner_name:
+                    continue
+                with self.lock:
+                    tracked = runner_name in self.runners
+                    runner = self.runners.get(runner_name) or SSHRunner(self, host, runner_name, labels, entry.get("created", ""))
+                runner.status = entry["state"]
+                if entry["state"] == "running":
+                    result.append(runner)
+                elif not tracked:
+                    try:
+                        self.teardown(runner)
+                        logger.info(format_log('INFO', 'Directorio de runner huérfano eliminado', f"{host.name}: {runner_name}"))
+                    except RuntimeError as e:
+                        logger.debug(f"No se pudo limpiar {runner_name} en {host.name}: {e}")
+        return result
+
+    def status(self) -> List[Dict[str, Any]]:
+        """Hosts con slots y runners según el último escaneo."""
+        return [host.to_dict() for host in self.hosts.values()]
+
+
+def create_ssh_backend() -> Optional[SSHHostBackend]:
+    """Backend desde SSH_HOSTS_FILE (YAML o JSON), o None si no está configurado."""
+    path = os.getenv("SSH_HOSTS_FILE")
+    if not path:
+        return None
+    try:
+        with open(path, "r") as inventory_file:
+            data = yaml.safe_load(inventory_file)
+    except (OSError, yaml.YAMLError) as e:
+        raise ConfigurationError(f"No se pudo leer SSH_HOSTS_FILE {path}: {e}")
+
+    backend = SSHHostBackend(
+        parse_inventory(data or {}),
+        ssh_path=os.getenv("SSH_PATH", "ssh"),
+        known_hosts_file=os.getenv("SSH_KNOWN_HOSTS_FILE"),
+        connect_timeout=int(os.getenv("SSH_CONNECT_TIMEOUT", "10")),
+    )
+    if not backend.known_hosts_file:
+        logger.warning(format_log('WARNING', 'Hosts SSH sin SSH_KNOWN_HOSTS_FILE', 'se aceptan claves de host nuevas'))
+    logger.info(format_log(
+        'CONFIG', 'Hosts SSH cargados',
+        ", ".join(f"{host.name} ({host.slots} slots)" for host in backend.hosts.values())
+    ))
+    return backend
@@ -0,0 +1,133 @@
+"""
+Export e import del estado del orchestrator.
+Un snapshot versionado contiene la definición de pools y los runners en seguimiento,
+para recuperación ante desastres o para mover la orquestación a otra instancia que
+comparta el mismo Docker Engine.
+"""
+
+from datetime import datetime, timezone
+from typing import Any, Dict, List
+
+from src.services.docker import DockerUtils
+from src.services.pools import PoolRegistry, RunnerPool, diff_pools
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+STATE_FORMAT = "gha-ephemeral-runners/state"
+STATE_VERSION = 1
+
+
+def _pool_spec(pool: RunnerPool) -> Dict[str, Any]:
+    # image_scan es un resultado de ejecución, no parte de la definición
+    return {key: value for key, value in pool.to_dict().items() if key != "image_scan"}
+
+
+def export_state(lifecycle_manager: Any, service_version: str) -> Dict[str, Any]:
+    """Snapshot con los pools y los runners en seguimiento."""
+    with lifecycle_manager.runner_lock:
+        tracked = dict(lifecycle_manager.active_runners)
+        pools = [_pool_spec(pool) for pool in lifecycle_manager.pools.pools.values()]
+
+    runners = []
+    for runner_id, container in tracked.items():
+        labels = DockerUtils.get_container_labels(container) or {}
+        runners.append({
+            "runner_id": runner_id,
+            "container_id": container.id,
+            "container_name": container.name,
+            "pool": labels.get("runner-pool", "default"),
+            "scope": labels.get("scope"),
+            "scope_name": labels.get("scope_name"),
+        })
+
+    logger.info(format_log('INFO', 'Estado exportado', f'{len(pools)} pools, {len(runners)} runners'))
+    return {
+        "format": STATE_FORMAT,
+        "version": STATE_VERSION,
+        "exported_at": datetime.now(timezone.utc).isoformat(),
+        "orchestrator_version": service_version,
+        "pools": pools,
+        "runners": runners,
+    }
+
+
+def validate_snapshot(snapshot: Dict[str, Any]) -> List[str]:
+    """Errores de formato del snapshot (lista vacía si es válido)."""
+    errors = []
+    if snapshot.get("format") != STATE_FORMAT:
+        errors.append(f"Formato desconocido: se esperaba '{STATE_FORMAT}'")
+    version = snapshot.get("version")
+    if not isinstance(version, int) or version > STATE_VERSION:
+        errors.append(f"Versión de snapshot no soportada: {version} (máxima {STATE_VERSION})")
+    for key in ("pools", "runners"):
+        if not isinstance(snapshot.get(key, []), list):
+            errors.append(f"'{key}' debe ser una lista")
+    return errors
+
+
+def import_state(
+    lifecycle_manager: Any,
+    snapshot: Dict[str, Any],
+    dry_run: bool = False,
+    apply_pools: bool = False,
+) -> Dict[str, Any]:
+    """
+    Importa un snapshot: adopta los runners cuyos contenedores existen en este Docker
+    Engine y, con apply_pools, reemplaza los pools en memoria.
+
+    Los pools aplicados así duran hasta la próxima recarga de configuración; para que
+    persistan deben quedar también en RUNNER_POOLS_FILE, CONFIG_FILE o la fuente GitOps.
+
+    Raises:
+        ValueError: Si el snapshot es inválido
+    """
+    errors = validate_snapshot(snapshot)
+    if errors:
+        raise ValueError("; ".join(errors))
+
+    try:
+        registry = PoolRegistry([RunnerPool.from_dict(spec) for spec in snapshot.get("pools", [])])
+    except ConfigurationError as e:
+        raise ValueError(f"Pools inválidos en el snapshot: {e}")
+    pool_changes = diff_pools(lifecycle_manager.pools, registry)
+
+    adopted, already_tracked, missing = [], [], []
+    client = lifecycle_manager.container_manager.client
+    for runner in snapshot.get("runners", []):
+        runner_id = runner.get("runner_id")
+        if runner_id in lifecycle_manager.active_runners:
+            already_tracked.append(runner_id)
+            continue
+        try:
+            container = client.containers.get(runner.get("container_id"))
+        except Exception:
+            missing.append(runner_id)
+            continue
+        labels = DockerUtils.get_container_labels(container) or {}
+        if labels.get("gha-ephemeral") != "true" or not DockerUtils.is_container_running(container):
+            missing.append(runner_id)
+            continue
+        adopted.append((runner_id, container))
+
+    if not dry_run:
+        with lifecycle_manager.runner_lock:
+            for runner_id, container in adopted:
+                lifecycle_manager.active_runners[runner_id] = container
+            if apply_pools:
+                lifecycle_manager.pools = lifecycle_manager._with_managed_pools(registry)
+
+    result = {
+        "dry_run": dry_run,
+        "adopted": [runner_id for runner_id, _ in adopted],
+        "already_tracked": already_tracked,
+        "missing": missing,
+        "pools": pool_changes,
+        "pools_applied": apply_pools and not dry_run,
+    }
+    logger.info(format_log(
+        'DRY_RUN' if dry_run else 'INFO', 'Estado importado',
+        f"{len(adopted)} runners adoptados, {len(missing)} no encontrados, "
+        f"pools {'aplicados' if result['pools_applied'] else 'sin aplicar'}"
+    ))
+    return result
@@ -0,0 +1,222 @@
+"""
+Runners atascados.
+Un runner cuyo cómputo queda en un estado terminal que no termina de desaparecer
+(contenedor en Created durante minutos o colgado en Removing/Dead, tarea de ECS que no
+termina de detenerse, VM atascada deteniéndose o desasignándose) ocupa cuota y capacidad
+sin poder ejecutar jobs. Pasados STUCK_RUNNER_TIMEOUT segundos se escala su eliminación
+paso a paso: parada con gracia, SIGKILL y borrado forzado en el proveedor. Un runner
+destruido que sigue existiendo pasado el plazo recibe el mismo trato.
+"""
+
+import os
+import threading
+import time
+from datetime import datetime, timezone
+from typing import Any, Dict, Optional
+
+from src.services.metrics import metrics
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Estado del cómputo -> tipo de atasco
+STUCK_STATES = {
+    "created": "created",                    # Docker: creado y nunca arrancado
+    "removing": "removing",                  # Docker: eliminación que no termina
+    "dead": "dead",                          # Docker: no se pudo detener ni eliminar
+    "DEACTIVATING": "stopping",              # ECS
+    "STOPPING": "stopping",                  # ECS y GCE
+    "DEPROVISIONING": "stopping",            # ECS
+    "SUSPENDING": "stopping",                # GCE
+    "PowerState/stopping": "stopping",       # Azure
+    "PowerState/deallocating": "stopping",   # Azure
+}
+
+# Estados de un cómputo que ya no existe en el proveedor (o, en un scale set, desasignado)
+GONE_STATES = ("STOPPED", "DELETED", "NotFound", "PowerState/deallocated")
+
+# Escalado de la eliminación, un paso por revisión
+STEPS = ("grace", "kill", "force")
+
+
+def stuck_state(container: Any) -> Optional[str]:
+    """Tipo de atasco según el último estado conocido del cómputo, o None si no lo está."""
+    raw = str((container.attrs.get("State") or {}).get("Status") or container.status or "")
+    # Azure informa varios códigos separados por comas
+    for code in raw.split(", "):
+        if code in STUCK_STATES:
+            return STUCK_STATES[code]
+    return None
+
+
+class StuckRunnerReaper:
+    """Detecta runners atascados y escala su eliminación hasta que desaparecen."""
+
+    def __init__(self, lifecycle_manager: Any, timeout: int = 300, grace: int = 30, interval: int = 30):
+        self.lifecycle_manager = lifecycle_manager
+        self.timeout = timeout
+        self.grace = grace
+        self.interval = interval
+        # runner -> contenedor, tipo de atasco, desde cuándo y pasos aplicados
+        self.watched: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.counters = {"resolved": 0, "unresolved": 0}
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Detección de runners atascados iniciada', f'plazo {self.timeout}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            for _ in range(self.interval):
+                if not self.running:
+                    return
+                time.sleep(1)
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error revisando runners atascados', str(e)))
+
+    def watch(self, runner_id: str, container: Any, destroyed: bool = False):
+        """Vigila un runner; uno ya destruido que no desaparece cuenta como atascado."""
+        with self.lock:
+            if runner_id not in self.watched:
+                self.watched[runner_id] = {"container": container, "since": time.time(), "steps": [], "destroyed": destroyed}
+            elif destroyed:
+                self.watched[runner_id]["destroyed"] = True
+
+    def _discover(self):
+        """Contenedores Docker en estados terminales y runners de backends con último estado atascado."""
+        manager = self.lifecycle_manager
+        try:
+            containers = manager.container_manager.client.containers.list(all=True, filters={"label": "gha-ephemeral=true"})
+            if manager.container_manager.docker_hosts:
+                containers += manager.container_manager.docker_hosts.list_runners(all=True)
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron listar los contenedores', str(e)))
+            containers = []
+        for container in containers:
+            if stuck_state(container):
+                self.watch((container.labels or {}).get("runner-name", container.name), container)
+        for runner_id, container in list(manager.active_runners.items()):
+            if stuck_state(container):
+                self.watch(runner_id, container)
+
+    def _refresh(self, entry: Dict[str, Any]) -> Optional[str]:
+        """Recarga el cómputo; devuelve su tipo de atasco, "gone" o None si está sano."""
+        container = entry["container"]
+        try:
+            container.reload()
+        except Exception as e:
+            if "404" in str(e) or "NotFound" in type(e).__name__ or "No such" in str(e):
+                return "gone"
+            raise
+        raw = str((container.attrs.get("State") or {}).get("Status") or "")
+        if any(code in GONE_STATES for code in raw.split(", ")):
+            return "gone"
+        state = stuck_state(container)
+        if state is None and entry["destroyed"]:
+            # Se pidió destruirlo: si sigue en ejecución, no llegó a desaparecer
+            return "not_gone" if container.status == "running" else "gone"
+        return state
+
+    def check(self) -> Dict[str, Any]:
+        """Una pasada: descubre atascos nuevos y aplica el siguiente paso a los que vencieron."""
+        self._discover()
+        with self.lock:
+            watched = dict(self.watched)
+
+        for runner_id, entry in watched.items():
+            try:
+                state = self._refresh(entry)
+            except Exception as e:
+                logger.warning(format_log('WARNING', f'No se pudo consultar el runner {runner_id}', str(e)))
+                continue
+
+            if state in ("gone", None):
+                with self.lock:
+                    self.watched.pop(runner_id, None)
+                if entry["steps"]:
+                    self.counters["resolved"] += 1
+                    metrics.incr("runners.stuck_resolved", tags={"state": entry.get("state", "unknown"), "step": entry["steps"][-1]})
+                    logger.info(format_log('SUCCESS', 'Runner atascado eliminado', f"{runner_id} tras {', '.join(entry['steps'])}"))
+                continue
+
+            entry["state"] = state
+            # Primer paso al vencer el plazo; cada siguiente, pasada la gracia del anterior
+            if time.time() - entry["since"] < self.timeout + self.grace * len(entry["steps"]):
+                continue
+            if len(entry["steps"]) == len(STEPS):
+                if not entry.get("unresolved"):
+                    entry["unresolved"] = True
+                    self.counters["unresolved"] += 1
+                    metrics.incr("runners.stuck_unresolved", tags={"state": state})
+                    logger.error(format_log('ERROR', 'Runner atascado sin resolver', f"{runner_id} ({state}): requiere intervención manual"))
+                continue
+            self._escalate(runner_id, entry, STEPS[len(entry["steps"])])
+
+        for state in set(STUCK_STATES.values()) | {"not_gone"}:
+            metrics.gauge("runners.stuck", sum(1 for entry in self.watched.values() if entry.get("state") == state), tags={"state": state})
+        return self.status()
+
+    def _escalate(self, runner_id: str, entry: Dict[str, Any], step: str):
+        container = entry["container"]
+        entry["steps"].append(step)
+        logger.warning(format_log('WARNING', f'Runner atascado: {step}', f"{runner_id} ({entry['state']})"))
+        try:
+            if step == "grace":
+                container.stop(timeout=self.grace)
+            elif step == "kill":
+                if hasattr(container, "kill"):
+                    container.kill()
+                else:
+                    container.stop(timeout=0)
+            else:
+                backend = getattr(container, "backend", None)
+                if backend is not None and hasattr(backend, "force_delete"):
+                    backend.force_delete(container)
+                else:
+                    container.remove(force=True)
+            result = "ok"
+        except Exception as e:
+            logger.warning(format_log('WARNING', f'Paso {step} fallido para {runner_id}', str(e)))
+            result = "failed"
+        self.lifecycle_manager.active_runners.pop(runner_id, None)
+        metrics.incr("runners.stuck_escalations", tags={"state": entry["state"], "step": step, "result": result})
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            stuck = [
+                {
+                    "runner_id": runner_id,
+                    "state": entry.get("state"),
+                    "since": datetime.fromtimestamp(entry["since"], timezone.utc).isoformat(),
+                    "steps": list(entry["steps"]),
+                }
+                for runner_id, entry in self.watched.items() if entry.get("state")
+            ]
+        return {"timeout": self.timeout, "stuck": stuck, **self.counters}
+
+
+def create_stuck_runner_reaper(lifecycle_manager: Any) -> Optional[StuckRunnerReaper]:
+    """Detector configurado desde variables de entorno, o None con STUCK_RUNNER_TIMEOUT=0."""
+    timeout = int(os.getenv("STUCK_RUNNER_TIMEOUT", "300"))
+    if timeout <= 0:
+        return None
+    return StuckRunnerReaper(
+        lifecycle_manager,
+        timeout=timeout,
+        grace=int(os.getenv("STUCK_RUNNER_GRACE", "30")),
+        interval=max(1, int(os.getenv("STUCK_RUNNER_CHECK_INTERVAL", "30"))),
+    )
@@ -0,0 +1,104 @@
+"""
+Integración con systemd (unidades Type=notify) para instalaciones sin contenedores.
+systemd define NOTIFY_SOCKET y, con WatchdogSec= en la unidad, WATCHDOG_USEC. El servicio
+envía READY=1 la primera vez que su /healthz local responde 200, el mismo criterio que el
+HEALTHCHECK de la imagen y el registro de descubrimiento, así systemctl start y las
+unidades con After= esperan a que el orquestador esté sano de verdad. Después envía
+WATCHDOG=1 a la mitad del plazo mientras /healthz siga sano: si deja de estarlo, o el
+proceso se cuelga, systemd lo reinicia según Restart=. STATUS= muestra el último
+resultado en systemctl status y STOPPING=1 se envía al detenerse.
+"""
+
+import os
+import socket
+import threading
+from typing import Optional, Tuple
+
+import requests
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class SystemdNotifier:
+    """Notificaciones sd_notify de disponibilidad, watchdog y estado según /healthz."""
+
+    def __init__(self, address: str, port: int, watchdog_usec: int = 0, interval: float = 10):
+        # Un nombre que empieza por @ es un socket del espacio abstracto de Linux
+        self.address = "\0" + address[1:] if address.startswith("@") else address
+        self.port = port
+        self.watchdog = watchdog_usec / 1_000_000
+        # Mitad del plazo del watchdog, como recomienda sd_watchdog_enabled(3)
+        self.interval = self.watchdog / 2 if self.watchdog else interval
+        self.ready = False
+        self.healthy: Optional[bool] = None
+        self.running = False
+        self.stop_event = threading.Event()
+        self.thread: Optional[threading.Thread] = None
+
+    def notify(self, *fields: str) -> bool:
+        try:
+            with socket.socket(socket.AF_UNIX, socket.SOCK_DGRAM | socket.SOCK_CLOEXEC) as sock:
+                sock.sendto("\n".join(fields).encode(), self.address)
+            return True
+        except OSError as e:
+            logger.warning(format_log('WARNING', 'No se pudo notificar a systemd', str(e)))
+            return False
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.stop_event.clear()
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        watchdog = f"watchdog {self.watchdog:g}s" if self.watchdog else "sin watchdog"
+        logger.info(format_log('CONFIG', 'Notificaciones a systemd', f"READY al pasar /healthz, {watchdog}"))
+
+    def stop(self):
+        self.running = False
+        self.stop_event.set()
+        if self.thread:
+            self.thread.join(timeout=5)
+        self.notify("STOPPING=1", "STATUS=Deteniendo")
+
+    def _check_health(self) -> Tuple[bool, str]:
+        """Mismo criterio que el HEALTHCHECK de la imagen: GET /healthz local con 200."""
+        try:
+            response = requests.get(f"http://127.0.0.1:{self.port}/healthz", timeout=min(5, self.interval))
+            return response.status_code == 200, f"/healthz {response.status_code}"
+        except requests.RequestException as e:
+            return False, f"/healthz inaccesible: {e}"
+
+    def _loop(self):
+        while self.running:
+            healthy, output = self._check_health()
+            fields = [f"STATUS={'Sano' if healthy else 'No sano'}: {output}"[:200]]
+            if healthy and not self.ready:
+                fields.append("READY=1")
+            # Sin latido, systemd reinicia el servicio al vencer WatchdogSec
+            if healthy and self.watchdog:
+                fields.append("WATCHDOG=1")
+            if self.notify(*fields) and healthy and not self.ready:
+                self.ready = True
+                logger.info(format_log('SUCCESS', 'Servicio listo notificado a systemd'))
+            if self.ready and healthy != self.healthy:
+                if not healthy:
+                    logger.warning(format_log('WARNING', 'Servicio no sano, sin latido al watchdog de systemd', output))
+                elif self.healthy is False:
+                    logger.info(format_log('SUCCESS', 'Servicio sano de nuevo', "latido al watchdog de systemd reanudado"))
+            self.healthy = healthy
+            self.stop_event.wait(self.interval)
+
+
+def create_systemd_notifier(port: int) -> Optional[SystemdNotifier]:
+    """Notificador si el proceso corre en una unidad Type=notify (NOTIFY_SOCKET), o None."""
+    address = os.getenv("NOTIFY_SOCKET", "")
+    if not address:
+        return None
+    watchdog_usec = int(os.getenv("WATCHDOG_USEC", "0") or 0)
+    # WATCHDOG_PID indica a qué proceso va dirigido el watchdog (no a los hijos)
+    watchdog_pid = os.getenv("WATCHDOG_PID")
+    if watchdog_pid and watchdog_pid != str(os.getpid()):
+        watchdog_usec = 0
+    return SystemdNotifier(address, port, watchdog_usec, float(os.getenv("SYSTEMD_HEALTH_INTERVAL", "10")))
@@ -0,0 +1,340 @@
+"""
+Tenants de la plataforma compartida: una organización de GitHub (o varias de una
+enterprise) dada de alta con su instalación de la GitHub App, sus pools, su cuota de
+runners y el webhook workflow_job de cada organización.
+El tenant se resuelve por el owner del ámbito de cada runner: sus runners llevan el
+label "tenant", solo usan sus pools (o los compartidos) y cuentan para su cuota.
+Sin TENANTS_FILE no hay tenants y todo funciona como un único espacio.
+"""
+
+import json
+import os
+import re
+import threading
+from datetime import datetime, timezone
+from typing import Any, Dict, List, Optional
+
+from src.services.encryption import decrypt_value, encrypt_value
+from src.services.github_auth import GitHubAppCredentials
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.pools import DEFAULT_POOL, PoolRegistry, RunnerPool
+from src.utils.helpers import ConfigurationError, GitHubError, QuotaExceededError, ValidationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+TENANT_NAME = re.compile(r"^[a-z0-9][a-z0-9-]{1,38}$")
+KINDS = ("org", "enterprise")
+
+
+def _now() -> str:
+    return datetime.now(timezone.utc).isoformat()
+
+
+def scope_owner(scope: str, scope_name: str) -> str:
+    """Owner de un ámbito: la organización de owner/repo o el propio nombre de org/enterprise."""
+    return scope_name if scope != "repo" else scope_name.split("/", 1)[0]
+
+
+class TenantRegistry:
+    """Tenants dados de alta, persistidos en TENANTS_FILE."""
+
+    def __init__(self, state_file: str, default_max_runners: int = 0, default_pool: Optional[Dict[str, Any]] = None):
+        self.state_file = state_file
+        self.default_max_runners = default_max_runners
+        self.default_pool = dict(default_pool or {})
+        self.tenants: Dict[str, Dict[str, Any]] = {}
+        # Runners en creación por tenant: todavía no figuran como activos pero ya cuentan para la cuota
+        self.provisioning: Dict[str, int] = {}
+        self.lock = threading.Lock()
+        self._load_state()
+
+    def _load_state(self):
+        if not os.path.exists(self.state_file):
+            return
+        try:
+            with open(self.state_file, "r") as state:
+                # Con STATE_ENCRYPTION el archivo entero es un valor cifrado
+                for tenant in json.loads(decrypt_value(state.read())).get("tenants", []):
+                    self.tenants[tenant["name"]] = tenant
+            logger.info(format_log('CONFIG', 'Tenants cargados', f"{', '.join(self.tenants) or '-'} en {self.state_file}"))
+        except (OSError, ValueError, KeyError) as e:
+            logger.error(format_log('ERROR', 'No se pudo leer el estado de tenants', str(e)))
+
+    def _save_state(self):
+        tmp_file = f"{self.state_file}.tmp"
+        with open(tmp_file, "w") as state:
+            state.write(encrypt_value(json.dumps({"tenants": list(self.tenants.values())})))
+        os.replace(tmp_file, self.state_file)
+
+    def reencrypt(self) -> int:
+        """Reescribe el archivo con la clave de datos actual (rotación de STATE_ENCRYPTION)."""
+        with self.lock:
+            self._save_state()
+            return len(self.tenants)
+
+    # ===== Resolución =====
+
+    def get(self, name: str) -> Optional[Dict[str, Any]]:
+        with self.lock:
+            return self.tenants.get(name)
+
+    def list(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            return list(self.tenants.values())
+
+    def for_scope(self, scope: str, scope_name: str) -> Optional[Dict[str, Any]]:
+        """Tenant dueño de un ámbito (por organización o, para ámbitos enterprise, por enterprise)."""
+        owner = scope_owner(scope, scope_name).lower()
+        with self.lock:
+            for tenant in self.tenants.values():
+                if scope == "enterprise":
+                    if (tenant.get("enterprise") or "").lower() == owner:
+                        return tenant
+                elif owner in (item.lower() for item in tenant["owners"]):
+                    return tenant
+        return None
+
+    def pools(self) -> List[RunnerPool]:
+        """Pools de todos los tenants, para agregarlos al registro de pools."""
+        with self.lock:
+            specs = [spec for tenant in self.tenants.values() for spec in tenant["pools"]]
+        return [RunnerPool.from_dict(spec) for spec in specs]
+
+    def merge_pools(self, registry: PoolRegistry) -> PoolRegistry:
+        """Agrega los pools de los tenants a un registro recién cargado (arranque, recarga e importación)."""
+        for pool in self.pools():
+            existing = registry.pools.get(pool.name)
+            if existing and existing.tenant == pool.tenant:
+                # Importado de un snapshot que ya incluía los pools de los tenants
+                continue
+            if existing:
+                logger.warning(format_log('WARNING', 'Pool de tenant ignorado: ya existe en la configuración', pool.name))
+                continue
+            registry.pools[pool.name] = pool
+        return registry
+
+    def resolve_pool(self, tenant: Optional[Dict[str, Any]], registry: PoolRegistry, pool: Optional[str]) -> RunnerPool:
+        """
+        Pool de un runner: sin pool indicado, el por defecto del tenant; nunca el de otro tenant.
+
+        Raises:
+            ValueError: Si el pool no existe o pertenece a otro tenant
+        """
+        if not pool and tenant:
+            pool = tenant["default_pool"]
+        runner_pool = registry.get(pool)
+        if runner_pool.tenant and runner_pool.tenant != (tenant or {}).get("name"):
+            raise ValueError(f"El pool {runner_pool.name} pertenece a otro tenant")
+        return runner_pool
+
+    # ===== Cuotas =====
+
+    def reserve(self, tenant: Dict[str, Any], active: int, count: int = 1):
+        """
+        Cuenta count runners en creación contra la cuota del tenant.
+
+        Raises:
+            QuotaExceededError: Si los runners activos y en creación superarían max_runners
+        """
+        name = tenant["name"]
+        max_runners = tenant["quotas"].get("max_runners", 0)
+        with self.lock:
+            in_flight = self.provisioning.get(name, 0)
+            if max_runners and active + in_flight + count > max_runners:
+                metrics.incr("tenants.quota_rejected", tags={"tenant": name})
+                raise QuotaExceededError(
+                    f"Tenant {name}: cuota de {max_runners} runners alcanzada ({active} activos, {in_flight} en creación)"
+                )
+            self.provisioning[name] = in_flight + count
+
+    def release(self, tenant: Dict[str, Any], count: int = 1):
+        name = tenant["name"]
+        with self.lock:
+            remaining = self.provisioning.get(name, 0) - count
+            if remaining > 0:
+                self.provisioning[name] = remaining
+            else:
+                self.provisioning.pop(name, None)
+
+    # ===== Alta y baja =====
+
+    def _build_pools(self, name: str, specs: Optional[List[Dict[str, Any]]]) -> List[Dict[str, Any]]:
+        """Pools del tenant con el prefijo <tenant>-; el primero (o el llamado default) es su pool por defecto."""
+        specs = [dict(spec) for spec in specs or []] or [dict(self.default_pool, name=DEFAULT_POOL)]
+        prefix = f"{name}-"
+        pools = []
+        for spec in specs:
+            pool_name = spec.get("name") or DEFAULT_POOL
+            spec["name"] = pool_name if pool_name.startswith(prefix) else f"{prefix}{pool_name}"
+            spec["tenant"] = name
+            try:
+                pools.append(RunnerPool.from_dict(spec).to_dict())
+            except ConfigurationError as e:
+                raise ValidationError(str(e))
+        for pool in pools:
+            pool.pop("image_scan", None)
+        return pools
+
+    def _resolve_installations(self, credentials: Any, owners: List[str]) -> Dict[str, Optional[str]]:
+        """Instalación de la GitHub App en cada organización (con token personal no aplica)."""
+        if not isinstance(credentials, GitHubAppCredentials):
+            logger.warning(format_log('WARNING', 'Tenant sin GitHub App: se usa el token configurado', ", ".join(owners)))
+            return {owner: None for owner in owners}
+        installations = {}
+        for owner in owners:
+            try:
+                installations[owner] = credentials.get_installation_id(owner)
+            except GitHubError:
+                raise ValidationError(f"La GitHub App no está instalada en {owner}: instálala antes del alta")
+        return installations
+
+    @staticmethod
+    def _provision_webhook(github: Any, owner: str, url: str, secret: str) -> Dict[str, Any]:
+        """Crea (o actualiza, si ya apunta a la misma URL) el webhook workflow_job de la organización."""
+        config = {"url": url, "content_type": "json", "secret": secret, "insecure_ssl": "0"}
+        response = github.get(f"orgs/{owner}/hooks", critical=True, params={"per_page": 100})
+        if response is None or response.status_code != 200:
+            status = response.status_code if response is not None else "sin respuesta"
+            raise GitHubError(f"No se pudieron listar los webhooks de {owner} ({status}); la App necesita organization_hooks:write")
+
+        existing = next((hook for hook in response.json() if hook.get("config", {}).get("url") == url), None)
+        body = {"active": True, "events": ["workflow_job"], "config": config}
+        if existing:
+            response = github.request("PATCH", f"orgs/{owner}/hooks/{existing['id']}", critical=True, json=body)
+        else:
+            response = github.post(f"orgs/{owner}/hooks", critical=True, json={"name": "web", **body})
+        if response is None or response.status_code not in (200, 201):
+            status = response.status_code if response is not None else "sin respuesta"
+            raise GitHubError(f"No se pudo configurar el webhook de {owner} ({status})")
+        return {"id": response.json()["id"], "url": url, "updated": bool(existing)}
+
+    def onboard(
+        self,
+        name: str,
+        owners: List[str],
+        credentials: Any,
+        github: Any,
+        kind: str = "org",
+        enterprise: Optional[str] = None,
+        pools: Optional[List[Dict[str, Any]]] = None,
+        max_runners: Optional[int] = None,
+        webhook: Optional[Dict[str, str]] = None,
+        created_by: str = "",
+    ) -> Dict[str, Any]:
+        """
+        Da de alta un tenant: instalación de la App, pools y webhook de cada organización.
+
+        Si falla un webhook se eliminan los creados hasta entonces y el tenant no se registra.
+
+        Raises:
+            ValidationError: Si los datos del tenant no son válidos o la App no está instalada
+            GitHubError: Si no se pudo configurar el webhook de alguna organización
+        """
+        if not TENANT_NAME.match(name or ""):
+            raise ValidationError("El nombre del tenant debe ser minúsculas, dígitos y guiones (2-39 caracteres)")
+        if kind not in KINDS:
+            raise ValidationError(f"Tipo de tenant desconocido: {kind} ({', '.join(KINDS)})")
+        if kind == "enterprise" and not enterprise:
+            raise ValidationError("Un tenant enterprise requiere 'enterprise' (slug de la enterprise)")
+        owners = list(dict.fromkeys(owner.strip() for owner in owners if owner.strip()))
+        if not owners:
+            raise ValidationError("Se requiere al menos una organización en 'owners'")
+        if max_runners is not None and max_runners < 0:
+            raise ValidationError("max_runners no puede ser negativo")
+
+        with self.lock:
+            if name in self.tenants:
+                raise ValidationError(f"El tenant {name} ya existe")
+            claimed = {owner.lower(): tenant["name"] for tenant in self.tenants.values() for owner in tenant["owners"]}
+        taken = [f"{owner} ({claimed[owner.lower()]})" for owner in owners if owner.lower() in claimed]
+        if taken:
+            raise ValidationError(f"Organizaciones ya asignadas a otro tenant: {', '.join(taken)}")
+
+        tenant_pools = self._build_pools(name, pools)
+        installations = self._resolve_installations(credentials, owners)
+
+        webhooks: Dict[str, Dict[str, Any]] = {}
+        if webhook and webhook.get("url"):
+            try:
+                for owner in owners:
+                    webhooks[owner] = self._provision_webhook(github, owner, webhook["url"], webhook.get("secret", ""))
+            except Exception:
+                for owner, hook in webhooks.items():
+                    if not hook["updated"]:
+                        github.delete(f"orgs/{owner}/hooks/{hook['id']}", critical=True)
+                raise
+
+        tenant = {
+            "name": name,
+            "kind": kind,
+            "enterprise": enterprise,
+            "owners": owners,
+            "installations": installations,
+            "pools": tenant_pools,
+            "default_pool": next(
+                (pool["name"] for pool in tenant_pools if pool["name"] == f"{name}-{DEFAULT_POOL}"), tenant_pools[0]["name"]
+            ),
+            "quotas": {"max_runners": self.default_max_runners if max_runners is None else max_runners},
+            "webhooks": {owner: {"id": hook["id"], "url": hook["url"]} for owner, hook in webhooks.items()},
+            "created_at": _now(),
+            "created_by": created_by,
+        }
+        with self.lock:
+            self.tenants[name] = tenant
+            self._save_state()
+        logger.info(format_log(
+            'CONFIG', 'Tenant dado de alta',
+            f"{name}: {', '.join(owners)}, pools {', '.join(pool['name'] for pool in tenant_pools)}, "
+            f"{len(webhooks)} webhooks, cuota {tenant['quotas']['max_runners'] or 'sin límite'}"
+        ))
+        lifecycle_events.emit(
+            "tenant.onboarded", key=name,
+            tenant=name, kind=kind, owners=owners, pools=[pool["name"] for pool in tenant_pools], created_by=created_by,
+        )
+        return tenant
+
+    def offboard(self, name: str, github: Any) -> Dict[str, Any]:
+        """Da de baja un tenant y elimina sus webhooks de GitHub (los que fallen se informan)."""
+        with self.lock:
+            tenant = self.tenants.get(name)
+        if not tenant:
+            raise ValueError(f"Tenant {name} no encontrado")
+
+        failed = []
+        for owner, hook in tenant["webhooks"].items():
+            try:
+                response = github.delete(f"orgs/{owner}/hooks/{hook['id']}", critical=True)
+                if response is None or response.status_code not in (204, 404):
+                    failed.append(owner)
+            except Exception as e:
+                logger.warning(format_log('WARNING', 'No se pudo eliminar el webhook del tenant', f"{owner}: {e}"))
+                failed.append(owner)
+
+        with self.lock:
+            self.tenants.pop(name, None)
+            self.provisioning.pop(name, None)
+            self._save_state()
+        logger.info(format_log('CONFIG', 'Tenant dado de baja', name))
+        lifecycle_events.emit("tenant.offboarded", key=name, tenant=name, webhooks_not_removed=failed)
+        return {"name": name, "pools_removed": [pool["name"] for pool in tenant["pools"]], "webhooks_not_removed": failed}
+
+
+def create_tenant_registry() -> Optional[TenantRegistry]:
+    """Crea el registro de tenants si TENANTS_FILE está definido."""
+    state_file = os.getenv("TENANTS_FILE")
+    if not state_file:
+        return None
+    default_pool = os.getenv("TENANT_DEFAULT_POOL", "")
+    try:
+        default_pool_spec = json.loads(default_pool) if default_pool else {}
+    except ValueError as e:
+        raise ConfigurationError(f"TENANT_DEFAULT_POOL debe ser JSON: {e}")
+    return TenantRegistry(
+        state_file,
+        default_max_runners=int(os.getenv("TENANT_DEFAULT_MAX_RUNNERS", "0")),
+        default_pool=default_pool_spec,
+    )
+
+
+tenants = create_tenant_registry()
@@ -1,28 +1,29 @@
 import logging
 from typing import Optional
 
-import requests
-from src.utils.helpers import setup_logger
+from src.services.github_auth import GitHubCredentials
+from src.services.github_client import GitHubClient
+from src.utils.helpers import redactor, setup_logger
 
 logger = setup_logger(__name__)
 
 
 class TokenGenerator:
-    def __init__(self, github_runner_token: str):
-        self.github_runner_token = github_runner_token
-        self.api_base = "https://api.github.com"
-        self.timeout = 30.0
-        self.headers = {
-            "Authorization": f"token {github_runner_token}",
-            "Accept": "application/vnd.github.v3+json",
-        }
+    def __init__(self, credentials: GitHubCredentials):
+        self.credentials = credentials
+        self.client = GitHubClient(credentials)
+        self.api_base = self.client.api_base
+        self.timeout = self.client.timeout
 
     def generate_registration_token(self, scope: str, scope_name: str) -> str:
         """Genera un registration token para GitHub Actions runner."""
         endpoint = f"{self._get_endpoint(scope, scope_name)}/actions/runners/registration-token"
-        url = f"{self.api_base}/{endpoint}"
-        response = requests.post(url, headers=self.headers, timeout=self.timeout)
-        return response.json().get("token", "")
+        # Llamada crítica: nunca se difiere por rate limit
+        response = self.client.post(endpoint, critical=True)
+        token = response.json().get("token", "")
+        # El token se inyecta en el contenedor: ocultarlo si aparece en logs o diagnósticos
+        redactor.register(token)
+        return token
 
     def _get_endpoint(self, scope: str, scope_name: str) -> str:
         """Obtiene endpoint según scope."""
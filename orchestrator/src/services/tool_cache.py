@@ -0,0 +1,223 @@
+"""
+Tool cache compartido (RUNNER_TOOL_CACHE) para runners efímeros.
+TOOL_CACHE_MANIFEST lista las herramientas (Node, Go, Python...) que se descargan
+en un volumen Docker con la estructura de actions/tool-cache; los pools con
+"tool_cache": true lo montan en solo lectura. Cada versión del manifiesto genera un
+volumen nuevo (gha-tool-cache-<hash>) que reutiliza lo ya descargado en el anterior,
+y los volúmenes que ya no usa ningún runner se eliminan.
+"""
+
+import hashlib
+import json
+import os
+import shlex
+import threading
+import time
+from typing import Any, Dict, List, Optional
+
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+# Label de los volúmenes gestionados (para encontrarlos al limpiar)
+VOLUME_LABEL = "gha-tool-cache"
+
+# Marca de volumen completo: los runners solo montan volúmenes terminados
+COMPLETE_MARKER = ".complete"
+
+
+def load_manifest(path: str) -> List[Dict[str, Any]]:
+    """
+    Lee y valida el manifiesto: {"tools": [{"name", "version", "url", "arch", "sha256", "strip_components"}]}.
+
+    Raises:
+        ConfigurationError: Si el archivo no es válido
+    """
+    try:
+        with open(path) as f:
+            data = json.load(f)
+    except (OSError, ValueError) as e:
+        raise ConfigurationError(f"No se pudo leer TOOL_CACHE_MANIFEST {path}: {e}")
+
+    tools = []
+    for index, tool in enumerate(data.get("tools", [])):
+        missing = [field for field in ("name", "version", "url") if not tool.get(field)]
+        if missing:
+            raise ConfigurationError(f"TOOL_CACHE_MANIFEST: la herramienta #{index + 1} requiere {', '.join(missing)}")
+        for field in ("name", "version"):
+            # Forman parte de la ruta dentro del volumen
+            if "/" in tool[field] or tool[field] in (".", ".."):
+                raise ConfigurationError(f"TOOL_CACHE_MANIFEST: {field} inválido '{tool[field]}'")
+        tools.append({
+            "name": tool["name"],
+            "version": tool["version"],
+            "arch": tool.get("arch", "x64"),
+            "url": tool["url"],
+            "sha256": tool.get("sha256"),
+            "strip_components": int(tool.get("strip_components", 1)),
+        })
+    return tools
+
+
+def manifest_hash(tools: List[Dict[str, Any]]) -> str:
+    return hashlib.sha256(json.dumps(tools, sort_keys=True).encode()).hexdigest()[:12]
+
+
+def seed_script(tools: List[Dict[str, Any]], has_previous: bool) -> str:
+    """Script sh que puebla /cache; copia desde /previous lo que ya estaba descargado."""
+    lines = ["set -e"]
+    for tool in tools:
+        target = f"/cache/{tool['name']}/{tool['version']}/{tool['arch']}"
+        previous = f"/previous/{tool['name']}/{tool['version']}/{tool['arch']}"
+        q_target = shlex.quote(target)
+        q_parent = shlex.quote(os.path.dirname(target))
+        description = f"{tool['name']} {tool['version']} ({tool['arch']})"
+        steps = [f"mkdir -p {q_target}"]
+        if has_previous:
+            steps = [
+                f"if [ -f {shlex.quote(previous + '.complete')} ]; then "
+                f"mkdir -p {q_parent} && cp -a {shlex.quote(previous)} {q_parent}/; else",
+                f"mkdir -p {q_target}",
+            ]
+        steps.append(f"wget -q -O /tmp/tool {shlex.quote(tool['url'])}")
+        if tool["sha256"]:
+            steps.append(f"echo {shlex.quote(tool['sha256'] + '  /tmp/tool')} | sha256sum -c -")
+        steps.append(f"tar -xf /tmp/tool -C {q_target} --strip-components={tool['strip_components']}")
+        steps.append("rm -f /tmp/tool")
+        if has_previous:
+            steps.append("fi")
+        # actions/tool-cache solo usa versiones con <arch>.complete
+        steps.append(f"touch {shlex.quote(target + '.complete')}")
+        lines.append(f"echo {shlex.quote(description)}")
+        lines.append("\n".join(steps))
+    lines.append(f"touch /cache/{COMPLETE_MARKER}")
+    return "\n".join(lines)
+
+
+class ToolCacheManager:
+    """Mantiene el volumen de tool cache al día con el manifiesto y lo monta en los runners."""
+
+    def __init__(
+        self,
+        client: Any,
+        manifest_path: str,
+        mount_path: str = "/opt/hostedtoolcache",
+        seed_image: str = "alpine:3.20",
+        volume_prefix: str = VOLUME_LABEL,
+        interval: int = 3600,
+    ):
+        self.client = client
+        self.manifest_path = manifest_path
+        self.mount_path = mount_path
+        self.seed_image = seed_image
+        self.volume_prefix = volume_prefix
+        self.interval = interval
+        # Volumen completo que se monta en los runners nuevos
+        self.current_volume: Optional[str] = None
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.lock = threading.Lock()
+
+    def start(self):
+        """Pobla el volumen en segundo plano y lo refresca cada `interval` segundos."""
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Tool cache iniciado', f'{self.manifest_path} cada {self.interval}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            self.refresh()
+            # Dormir en tramos cortos para que stop() no espere todo el intervalo
+            deadline = time.time() + self.interval
+            while self.running and time.time() < deadline:
+                time.sleep(1)
+
+    def _is_complete(self, volume: str) -> bool:
+        try:
+            # Sin get previo, montar un volumen inexistente lo crearía sin label
+            self.client.volumes.get(volume)
+            self.client.containers.run(
+                self.seed_image, ["test", "-f", f"/cache/{COMPLETE_MARKER}"],
+                volumes={volume: {"bind": "/cache", "mode": "ro"}}, remove=True,
+            )
+            return True
+        except Exception:
+            return False
+
+    def refresh(self) -> Optional[str]:
+        """Construye el volumen del manifiesto actual si no existe y retorna su nombre."""
+        with self.lock:
+            try:
+                tools = load_manifest(self.manifest_path)
+                volume = f"{self.volume_prefix}-{manifest_hash(tools)}"
+                if volume != self.current_volume and not self._is_complete(volume):
+                    self._seed(volume, tools)
+                if volume != self.current_volume:
+                    logger.info(format_log('SUCCESS', 'Tool cache actualizado', f'{volume} ({len(tools)} herramientas)'))
+                self.current_volume = volume
+                metrics.incr("tool_cache.refreshes", tags={"result": "success"})
+            except Exception as e:
+                # Se sigue montando el volumen anterior
+                metrics.incr("tool_cache.refreshes", tags={"result": "failed"})
+                logger.error(format_log('ERROR', 'Error actualizando tool cache', str(e)))
+            self._prune()
+            return self.current_volume
+
+    def _seed(self, volume: str, tools: List[Dict[str, Any]]):
+        self.client.volumes.create(name=volume, labels={VOLUME_LABEL: "true"})
+        volumes = {volume: {"bind": "/cache", "mode": "rw"}}
+        if self.current_volume:
+            volumes[self.current_volume] = {"bind": "/previous", "mode": "ro"}
+        logger.info(format_log('DOCKER', 'Poblando tool cache', volume))
+        self.client.containers.run(
+            self.seed_image, ["sh", "-c", seed_script(tools, bool(self.current_volume))],
+            volumes=volumes, remove=True,
+        )
+
+    def _prune(self):
+        """Elimina los volúmenes anteriores que ya no monta ningún runner."""
+        try:
+            for volume in self.client.volumes.list(filters={"label": f"{VOLUME_LABEL}=true"}):
+                if volume.name == self.current_volume:
+                    continue
+                try:
+                    # Docker rechaza borrar un volumen en uso
+                    volume.remove()
+                    logger.info(format_log('CLEANUP', 'Volumen de tool cache eliminado', volume.name))
+                except Exception:
+                    pass
+        except Exception as e:
+            logger.warning(format_log('WARNING', 'No se pudieron listar los volúmenes de tool cache', str(e)))
+
+    def mount(self, volumes: Dict[str, Dict[str, str]], environment: Dict[str, str]) -> bool:
+        """Agrega el volumen actual (solo lectura) y RUNNER_TOOL_CACHE; False si aún no está listo."""
+        volume = self.current_volume
+        if not volume:
+            return False
+        volumes[volume] = {"bind": self.mount_path, "mode": "ro"}
+        environment["RUNNER_TOOL_CACHE"] = environment["AGENT_TOOLSDIRECTORY"] = self.mount_path
+        return True
+
+
+def create_tool_cache(client: Any) -> Optional[ToolCacheManager]:
+    """Crea el tool cache desde TOOL_CACHE_MANIFEST (None si no está configurado)."""
+    manifest_path = os.getenv("TOOL_CACHE_MANIFEST")
+    if not manifest_path:
+        return None
+    return ToolCacheManager(
+        client,
+        manifest_path,
+        mount_path=os.getenv("TOOL_CACHE_MOUNT_PATH", "/opt/hostedtoolcache"),
+        seed_image=os.getenv("TOOL_CACHE_SEED_IMAGE", "alpine:3.20"),
+        volume_prefix=os.getenv("TOOL_CACHE_VOLUME_PREFIX", VOLUME_LABEL),
+        interval=int(os.getenv("TOOL_CACHE_REFRESH_INTERVAL", "3600")),
+    )
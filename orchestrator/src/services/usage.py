@@ -0,0 +1,576 @@
+"""
+Informes de uso por tenant para chargeback.
+Con USAGE_DB_PATH cada runner aprovisionado y destruido y cada job completado queda en
+una base SQLite; el informe mensual suma los minutos de runner por tenant y pool, cuenta
+los jobs y estima el coste con las tarifas de USAGE_COST_RATES (multiplicadas por el
+cost_factor de la clase de recursos de cada runner). Se exporta en JSON o CSV
+por la API y, con USAGE_REPORT_S3_BUCKET o USAGE_REPORT_EMAIL_TO, el informe de cada mes
+cerrado se entrega automáticamente una sola vez.
+"""
+
+import calendar
+import csv
+import datetime
+import hashlib
+import io
+import json
+import os
+import smtplib
+import sqlite3
+import threading
+import time
+from email.message import EmailMessage
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import quote
+
+import requests
+from src.services.aws import AWSCredentials, aws_region, sign_request
+from src.services.encryption import decrypt_value, encrypt_value
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.services.retries import retry_budgets
+from src.services.tenants import tenants
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SCHEMA = """
+CREATE TABLE IF NOT EXISTS runners (
+    event_id TEXT PRIMARY KEY,
+    runner_id TEXT NOT NULL,
+    tenant TEXT,
+    scope_name TEXT,
+    pool TEXT,
+    started_at REAL NOT NULL,
+    ended_at REAL
+);
+CREATE INDEX IF NOT EXISTS runners_open ON runners (runner_id, ended_at);
+CREATE TABLE IF NOT EXISTS jobs (
+    job_id TEXT PRIMARY KEY,
+    tenant TEXT,
+    repository TEXT,
+    pool TEXT,
+    conclusion TEXT,
+    completed_at REAL NOT NULL,
+    duration REAL,
+    workflow TEXT
+);
+CREATE TABLE IF NOT EXISTS deliveries (
+    month TEXT PRIMARY KEY,
+    delivered_at REAL NOT NULL,
+    targets TEXT NOT NULL
+);
+"""
+
+# Runners y jobs sin tenant (scopes fuera de TENANTS_FILE)
+NO_TENANT = "-"
+
+CSV_COLUMNS = ["month", "tenant", "pool", "resource_class", "runners", "runner_minutes", "jobs", "jobs_failed", "cost", "currency"]
+
+
+def parse_time(value: Any) -> Optional[float]:
+    """Epoch de un instante ISO 8601 ('...Z' o con zona); None si falta o no es válido."""
+    if not value:
+        return None
+    try:
+        parsed = datetime.datetime.fromisoformat(str(value).replace("Z", "+00:00"))
+    except ValueError:
+        return None
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=datetime.timezone.utc)
+    return parsed.timestamp()
+
+
+def month_bounds(month: str) -> Tuple[float, float]:
+    """Inicio y fin (exclusivo) en UTC de un mes 'YYYY-MM'."""
+    try:
+        year, number = (int(part) for part in month.split("-"))
+        start = datetime.datetime(year, number, 1, tzinfo=datetime.timezone.utc)
+    except ValueError:
+        raise ValueError(f"Mes inválido: {month} (formato YYYY-MM)")
+    days = calendar.monthrange(year, number)[1]
+    return start.timestamp(), (start + datetime.timedelta(days=days)).timestamp()
+
+
+def previous_month(now: Optional[float] = None) -> str:
+    today = datetime.datetime.fromtimestamp(now or time.time(), tz=datetime.timezone.utc)
+    last_day = today.replace(day=1) - datetime.timedelta(days=1)
+    return last_day.strftime("%Y-%m")
+
+
+def parse_rates(spec: str) -> Dict[str, float]:
+    """Tarifas por minuto 'pool=tarifa' separadas por coma; '*' es la tarifa por defecto."""
+    rates = {}
+    for item in [item.strip() for item in spec.split(",") if item.strip()]:
+        pool, _, rate = item.partition("=")
+        try:
+            rates[pool.strip()] = float(rate)
+        except ValueError:
+            raise ConfigurationError(f"USAGE_COST_RATES inválido: {item} (pool=tarifa)")
+    return rates
+
+
+class UsageLedger:
+    """
+    Registro de uso en SQLite alimentado por los eventos del ciclo de vida.
+
+    Es un backend más de lifecycle_events (runner.provisioned y runner.destroyed) y recibe
+    los job.completed que reenvía el API Gateway. Con el outbox la entrega es al menos una
+    vez: los runners se deduplican por el id del evento y los jobs por job_id.
+    """
+
+    name = "usage"
+
+    def __init__(self, path: str, rates: Dict[str, float], currency: str = "USD"):
+        self.path = path
+        self.rates = rates
+        self.currency = currency
+        directory = os.path.dirname(path)
+        if directory:
+            os.makedirs(directory, exist_ok=True)
+        self.conn = sqlite3.connect(path, check_same_thread=False, isolation_level=None)
+        self.conn.execute("PRAGMA journal_mode=WAL")
+        self.conn.executescript(SCHEMA)
+        # Registros creados antes de guardar el workflow de cada job
+        if "workflow" not in [column[1] for column in self.conn.execute("PRAGMA table_info(jobs)")]:
+            self.conn.execute("ALTER TABLE jobs ADD COLUMN workflow TEXT")
+        # Registros creados antes de las clases de recursos
+        if "resource_class" not in [column[1] for column in self.conn.execute("PRAGMA table_info(runners)")]:
+            self.conn.execute("ALTER TABLE runners ADD COLUMN resource_class TEXT")
+            self.conn.execute("ALTER TABLE runners ADD COLUMN cost_factor REAL")
+        self.lock = threading.Lock()
+        logger.info(format_log('CONFIG', 'Registro de uso activado', path))
+
+    @property
+    def description(self) -> str:
+        return f"usage {self.path}"
+
+    def publish(self, event: Dict[str, Any]):
+        data = event.get("data") or {}
+        at = parse_time(event.get("time")) or time.time()
+        with self.lock:
+            if event["type"] == "runner.provisioned":
+                # El factor se guarda con el runner: cambiar la clase después no altera el coste ya incurrido
+                self.conn.execute(
+                    "INSERT OR IGNORE INTO runners "
+                    "(event_id, runner_id, tenant, scope_name, pool, started_at, resource_class, cost_factor) "
+                    "VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+                    (
+                        event["id"], data.get("runner_id"), data.get("tenant"), encrypt_value(data.get("scope_name")), data.get("pool"), at,
+                        data.get("resource_class"), data.get("cost_factor"),
+                    ),
+                )
+            elif event["type"] == "runner.destroyed":
+                self.conn.execute(
+                    "UPDATE runners SET ended_at = ? WHERE runner_id = ? AND ended_at IS NULL AND started_at <= ?",
+                    (at, data.get("runner_id"), at),
+                )
+            elif event["type"] == "job.completed" and data.get("job_id"):
+                self._record_job(data, at)
+
+    def _record_job(self, data: Dict[str, Any], at: float):
+        repository = data.get("repository") or ""
+        tenant = tenants.for_scope("repo", repository) if tenants and repository else None
+        # El pool es el del runner que ejecutó el job, si lo aprovisionó este orchestrator
+        row = self.conn.execute(
+            "SELECT pool, tenant FROM runners WHERE runner_id = ? ORDER BY started_at DESC LIMIT 1",
+            (data.get("runner_name"),),
+        ).fetchone()
+        completed_at = parse_time(data.get("completed_at")) or at
+        started_at = parse_time(data.get("started_at"))
+        self.conn.execute(
+            "INSERT OR IGNORE INTO jobs (job_id, tenant, repository, pool, conclusion, completed_at, duration, workflow) "
+            "VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+            (
+                str(data["job_id"]),
+                tenant["name"] if tenant else (row[1] if row else None),
+                encrypt_value(repository),
+                row[0] if row else None,
+                data.get("conclusion"),
+                completed_at,
+                completed_at - started_at if started_at else None,
+                encrypt_value(data.get("workflow")),
+            ),
+        )
+
+    def job_history(self, since: float) -> List[Tuple[str, float, float]]:
+        """(pool, inicio, fin) de los jobs completados desde `since` con pool y duración conocidos."""
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT pool, completed_at - duration, completed_at FROM jobs "
+                "WHERE completed_at >= ? AND pool IS NOT NULL AND duration IS NOT NULL",
+                (since,),
+            ).fetchall()
+        return [(pool, started, completed) for pool, started, completed in rows]
+
+    def first_seen(self) -> Optional[float]:
+        """Inicio del runner más antiguo del registro (None si está vacío)."""
+        with self.lock:
+            return self.conn.execute("SELECT MIN(started_at) FROM runners").fetchone()[0]
+
+    def runner_seconds(self, start: float, end: float) -> List[Tuple[str, str, str, float, float]]:
+        """(tenant, pool, scope, segundos, factor de coste) de cada runner dentro de [start, end)."""
+        now = time.time()
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT tenant, pool, scope_name, started_at, ended_at, cost_factor FROM runners "
+                "WHERE started_at < ? AND (ended_at IS NULL OR ended_at > ?)",
+                (end, start),
+            ).fetchall()
+        return [
+            (
+                tenant or NO_TENANT, pool or NO_TENANT, decrypt_value(scope_name) or "",
+                max(0.0, min(end, ended_at or now) - max(start, started_at)), cost_factor or 1.0,
+            )
+            for tenant, pool, scope_name, started_at, ended_at, cost_factor in rows
+        ]
+
+    def jobs_between(self, start: float, end: float) -> List[Tuple[str, str, str, str, str, float]]:
+        """(tenant, pool, repositorio, workflow, conclusión, duración) de los jobs completados en [start, end)."""
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT tenant, pool, repository, workflow, conclusion, duration FROM jobs "
+                "WHERE completed_at >= ? AND completed_at < ?",
+                (start, end),
+            ).fetchall()
+        return [
+            (
+                tenant or NO_TENANT, pool or NO_TENANT, decrypt_value(repository) or "", decrypt_value(workflow) or "",
+                conclusion or "", duration or 0.0,
+            )
+            for tenant, pool, repository, workflow, conclusion, duration in rows
+        ]
+
+    def close_missing(self, active: List[str], grace: int = 300):
+        """
+        Cierra los runners que siguen abiertos en el registro pero ya no están activos
+        (destrucciones sin evento, p. ej. tras una caída sin outbox) para que no sigan
+        sumando minutos; `grace` evita cerrar los recién aprovisionados.
+        """
+        now = time.time()
+        with self.lock:
+            rows = self.conn.execute(
+                "SELECT event_id, runner_id FROM runners WHERE ended_at IS NULL AND started_at < ?", (now - grace,)
+            ).fetchall()
+            missing = [event_id for event_id, runner_id in rows if runner_id not in active]
+            self.conn.executemany("UPDATE runners SET ended_at = ? WHERE event_id = ?", [(now, event_id) for event_id in missing])
+        if missing:
+            logger.warning(format_log('WARNING', 'Runners sin evento de destrucción cerrados en el registro de uso', str(len(missing))))
+
+    def reencrypt(self) -> int:
+        """Vuelve a cifrar ámbitos, repositorios y workflows con la clave de datos actual."""
+        rewritten = 0
+        with self.lock:
+            self.conn.execute("BEGIN IMMEDIATE")
+            try:
+                for table, key, columns in (("runners", "event_id", ("scope_name",)), ("jobs", "job_id", ("repository", "workflow"))):
+                    rows = self.conn.execute(f"SELECT {key}, {', '.join(columns)} FROM {table}").fetchall()
+                    self.conn.executemany(
+                        f"UPDATE {table} SET {', '.join(f'{column} = ?' for column in columns)} WHERE {key} = ?",
+                        [(*(encrypt_value(decrypt_value(value)) for value in row[1:]), row[0]) for row in rows],
+                    )
+                    rewritten += len(rows) * len(columns)
+                self.conn.execute("COMMIT")
+            except Exception:
+                self.conn.execute("ROLLBACK")
+                raise
+        return rewritten
+
+    def close(self):
+        pass
+
+    def rate(self, pool: str) -> float:
+        return self.rates.get(pool, self.rates.get("*", 0.0))
+
+    def report(self, month: str, tenant: Optional[str] = None) -> Dict[str, Any]:
+        """
+        Informe del mes: minutos de runner, runners y jobs por tenant, pool y clase de recursos
+        con su coste.
+
+        Los runners que cruzan el límite del mes solo cuentan los minutos dentro de él; los
+        que siguen activos cuentan hasta ahora (el informe de un mes en curso es parcial).
+        """
+        start, end = month_bounds(month)
+        now = time.time()
+        if start > now:
+            raise ValueError(f"El mes {month} todavía no ha empezado")
+        with self.lock:
+            runners = self.conn.execute(
+                "SELECT tenant, pool, resource_class, cost_factor, started_at, ended_at FROM runners "
+                "WHERE started_at < ? AND (ended_at IS NULL OR ended_at > ?)",
+                (end, start),
+            ).fetchall()
+            jobs = self.conn.execute(
+                "SELECT tenant, pool, conclusion FROM jobs WHERE completed_at >= ? AND completed_at < ?",
+                (start, end),
+            ).fetchall()
+
+        rows: Dict[Tuple[str, str, str], Dict[str, Any]] = {}
+
+        def row_for(row_tenant: Optional[str], pool: Optional[str], resource_class: Optional[str] = None) -> Dict[str, Any]:
+            key = (row_tenant or NO_TENANT, pool or NO_TENANT, resource_class or "")
+            if key not in rows:
+                rows[key] = {
+                    "pool": key[1], "resource_class": resource_class, "runners": 0, "seconds": 0.0,
+                    "weighted_seconds": 0.0, "jobs": 0, "jobs_failed": 0,
+                }
+            return rows[key]
+
+        for row_tenant, pool, resource_class, cost_factor, started_at, ended_at in runners:
+            entry = row_for(row_tenant, pool, resource_class)
+            seconds = max(0.0, min(end, ended_at or now) - max(start, started_at))
+            entry["runners"] += 1
+            entry["seconds"] += seconds
+            entry["weighted_seconds"] += seconds * (cost_factor or 1.0)
+        # Los jobs se cuentan por pool, en la fila sin clase
+        for row_tenant, pool, conclusion in jobs:
+            entry = row_for(row_tenant, pool)
+            entry["jobs"] += 1
+            if conclusion not in ("success", "skipped", "neutral"):
+                entry["jobs_failed"] += 1
+
+        tenants_report: Dict[str, Dict[str, Any]] = {}
+        for (row_tenant, _, _), entry in sorted(rows.items()):
+            if tenant and row_tenant != tenant:
+                continue
+            minutes = round(entry.pop("seconds") / 60, 2)
+            entry["runner_minutes"] = minutes
+            entry["cost"] = round(entry.pop("weighted_seconds") / 60 * self.rate(entry["pool"]), 4)
+            summary = tenants_report.setdefault(row_tenant, {
+                "tenant": row_tenant, "runners": 0, "runner_minutes": 0.0, "jobs": 0, "jobs_failed": 0, "cost": 0.0, "pools": [],
+            })
+            summary["pools"].append(entry)
+            for field in ("runners", "runner_minutes", "jobs", "jobs_failed", "cost"):
+                summary[field] = round(summary[field] + entry[field], 4)
+
+        totals = {field: round(sum(item[field] for item in tenants_report.values()), 4)
+                  for field in ("runners", "runner_minutes", "jobs", "jobs_failed", "cost")}
+        return {
+            "month": month,
+            "generated_at": datetime.datetime.utcnow().isoformat() + "Z",
+            "partial": end > now,
+            "currency": self.currency,
+            "rates": self.rates,
+            "tenants": list(tenants_report.values()),
+            "totals": totals,
+        }
+
+    @staticmethod
+    def to_csv(report: Dict[str, Any]) -> str:
+        """Una fila por tenant, pool y clase de recursos, lista para importar en la hoja de chargeback."""
+        buffer = io.StringIO()
+        writer = csv.DictWriter(buffer, fieldnames=CSV_COLUMNS, lineterminator="\n")
+        writer.writeheader()
+        for summary in report["tenants"]:
+            for entry in summary["pools"]:
+                writer.writerow({
+                    "month": report["month"], "tenant": summary["tenant"], "currency": report["currency"],
+                    **{column: entry[column] for column in CSV_COLUMNS if column in entry},
+                })
+        return buffer.getvalue()
+
+    def delivered(self, month: str) -> bool:
+        with self.lock:
+            return self.conn.execute("SELECT 1 FROM deliveries WHERE month = ?", (month,)).fetchone() is not None
+
+    def mark_delivered(self, month: str, targets: List[str]):
+        with self.lock:
+            self.conn.execute(
+                "INSERT OR REPLACE INTO deliveries (month, delivered_at, targets) VALUES (?, ?, ?)",
+                (month, time.time(), json.dumps(targets)),
+            )
+
+    def deliveries(self) -> List[Dict[str, Any]]:
+        with self.lock:
+            rows = self.conn.execute("SELECT month, delivered_at, targets FROM deliveries ORDER BY month DESC").fetchall()
+        return [{"month": month, "delivered_at": delivered_at, "targets": json.loads(targets)} for month, delivered_at, targets in rows]
+
+
+class S3ReportTarget:
+    """Sube los informes a un bucket compatible con S3 (PUT con SigV4, direccionamiento por ruta)."""
+
+    name = "s3"
+
+    def __init__(self, bucket: str, region: str, endpoint: Optional[str] = None, prefix: str = "usage"):
+        self.bucket = bucket
+        self.region = region
+        self.endpoint = (endpoint or f"https://s3.{region}.amazonaws.com").rstrip("/")
+        self.prefix = prefix.strip("/")
+        self.credentials = AWSCredentials()
+
+    def _put(self, key: str, body: bytes, content_type: str):
+        url = f"{self.endpoint}/{self.bucket}/{quote(key)}"
+        headers = sign_request("PUT", url, self.region, "s3", {
+            "Content-Type": content_type,
+            "x-amz-content-sha256": hashlib.sha256(body).hexdigest(),
+        }, body, self.credentials.get())
+        headers.pop("host", None)
+        response = retry_budgets.get("aws").call(
+            lambda: requests.put(url, data=body, headers=headers, timeout=60),
+            retry_error=lambda e: isinstance(e, requests.RequestException),
+            retry_result=lambda response: response.status_code >= 500,
+        )
+        if response.status_code >= 300:
+            raise RuntimeError(f"HTTP {response.status_code} subiendo {key}: {response.text[:200]}")
+
+    def deliver(self, report: Dict[str, Any], csv_body: str):
+        base = f"{self.prefix}/{report['month']}" if self.prefix else report["month"]
+        self._put(f"{base}/usage.json", json.dumps(report, indent=2).encode(), "application/json")
+        self._put(f"{base}/usage.csv", csv_body.encode(), "text/csv")
+        # Un CSV por tenant para repartirlo sin exponer el uso de los demás
+        for summary in report["tenants"]:
+            single = {**report, "tenants": [summary]}
+            self._put(f"{base}/tenants/{summary['tenant']}.csv", UsageLedger.to_csv(single).encode(), "text/csv")
+
+
+class EmailReportTarget:
+    """Envía el informe por SMTP con el CSV y el JSON adjuntos."""
+
+    name = "email"
+
+    def __init__(self, recipients: List[str], host: str, port: int, sender: str,
+                 user: Optional[str] = None, password: Optional[str] = None, starttls: bool = True):
+        self.recipients = recipients
+        self.host = host
+        self.port = port
+        self.sender = sender
+        self.user = user
+        self.password = password
+        self.starttls = starttls
+
+    def deliver(self, report: Dict[str, Any], csv_body: str):
+        message = EmailMessage()
+        message["Subject"] = f"Uso de runners {report['month']}"
+        message["From"] = self.sender
+        message["To"] = ", ".join(self.recipients)
+        lines = [
+            f"{summary['tenant']}: {summary['runner_minutes']} min, {summary['jobs']} jobs, "
+            f"{summary['cost']} {report['currency']}"
+            for summary in report["tenants"]
+        ]
+        message.set_content(
+            f"Informe de uso de {report['month']}.\n\n" + ("\n".join(lines) or "Sin uso registrado.") + "\n"
+        )
+        message.add_attachment(csv_body.encode(), maintype="text", subtype="csv", filename=f"usage-{report['month']}.csv")
+        message.add_attachment(
+            json.dumps(report, indent=2).encode(), maintype="application", subtype="json",
+            filename=f"usage-{report['month']}.json",
+        )
+        with smtplib.SMTP(self.host, self.port, timeout=30) as smtp:
+            if self.starttls:
+                smtp.starttls()
+            if self.user:
+                smtp.login(self.user, self.password or "")
+            smtp.send_message(message)
+
+
+class UsageReportDelivery:
+    """
+    Entrega el informe del mes anterior a los destinos configurados.
+
+    Espera `delay` segundos tras el cierre del mes para que lleguen los últimos eventos y
+    registra la entrega en el ledger: cada mes se entrega una vez aunque el proceso se
+    reinicie. Si un destino falla se reintenta en la siguiente comprobación.
+    """
+
+    def __init__(self, ledger: UsageLedger, targets: List[Any], delay: int = 6 * 3600, interval: int = 3600):
+        self.ledger = ledger
+        self.targets = targets
+        self.delay = delay
+        self.interval = interval
+        self.stop_event = threading.Event()
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log(
+            'CONFIG', 'Entrega de informes de uso activada', ", ".join(target.name for target in self.targets)
+        ))
+
+    def stop(self):
+        self.stop_event.set()
+
+    def _loop(self):
+        while not self.stop_event.is_set():
+            try:
+                self.check()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error en la entrega de informes de uso', str(e)))
+            self.stop_event.wait(self.interval)
+
+    def check(self):
+        now = time.time()
+        month = previous_month(now)
+        if self.ledger.delivered(month) or now < month_bounds(month)[1] + self.delay:
+            return
+        self.deliver(month)
+
+    def deliver(self, month: str):
+        report = self.ledger.report(month)
+        csv_body = UsageLedger.to_csv(report)
+        for target in self.targets:
+            try:
+                target.deliver(report, csv_body)
+            except Exception as e:
+                metrics.incr("usage.report_delivery_failed", tags={"target": target.name})
+                logger.error(format_log('ERROR', 'No se pudo entregar el informe de uso', f"{month} vía {target.name}: {e}"))
+                return
+        self.ledger.mark_delivered(month, [target.name for target in self.targets])
+        metrics.incr("usage.reports_delivered")
+        logger.info(format_log('SUCCESS', 'Informe de uso entregado', f"{month} ({len(report['tenants'])} tenants)"))
+
+
+def create_report_targets() -> List[Any]:
+    """Destinos de USAGE_REPORT_S3_BUCKET y USAGE_REPORT_EMAIL_TO (pueden combinarse)."""
+    targets: List[Any] = []
+    bucket = os.getenv("USAGE_REPORT_S3_BUCKET")
+    if bucket:
+        region = os.getenv("USAGE_REPORT_S3_REGION") or aws_region() or "us-east-1"
+        targets.append(S3ReportTarget(
+            bucket, region, os.getenv("USAGE_REPORT_S3_ENDPOINT") or None, os.getenv("USAGE_REPORT_S3_PREFIX", "usage"),
+        ))
+    recipients = [item.strip() for item in os.getenv("USAGE_REPORT_EMAIL_TO", "").split(",") if item.strip()]
+    if recipients:
+        host = os.getenv("USAGE_REPORT_SMTP_HOST")
+        if not host:
+            raise ConfigurationError("USAGE_REPORT_SMTP_HOST es obligatorio con USAGE_REPORT_EMAIL_TO")
+        targets.append(EmailReportTarget(
+            recipients,
+            host,
+            int(os.getenv("USAGE_REPORT_SMTP_PORT", "587")),
+            os.getenv("USAGE_REPORT_EMAIL_FROM", "gha-runners@localhost"),
+            os.getenv("USAGE_REPORT_SMTP_USER") or None,
+            os.getenv("USAGE_REPORT_SMTP_PASSWORD") or None,
+            os.getenv("USAGE_REPORT_SMTP_STARTTLS", "true").lower() == "true",
+        ))
+    return targets
+
+
+def create_usage_ledger() -> Optional[UsageLedger]:
+    """Registro de uso en USAGE_DB_PATH; None si no está configurado."""
+    path = os.getenv("USAGE_DB_PATH")
+    if not path:
+        return None
+    return UsageLedger(path, parse_rates(os.getenv("USAGE_COST_RATES", "")), os.getenv("USAGE_CURRENCY", "USD"))
+
+
+def create_usage_delivery(ledger: Optional[UsageLedger]) -> Optional[UsageReportDelivery]:
+    """Entrega automática de los informes mensuales; None sin registro de uso o sin destinos."""
+    if not ledger:
+        return None
+    targets = create_report_targets()
+    if not targets:
+        return None
+    return UsageReportDelivery(
+        ledger,
+        targets,
+        delay=int(os.getenv("USAGE_REPORT_DELAY_HOURS", "6")) * 3600,
+        interval=int(os.getenv("USAGE_REPORT_CHECK_INTERVAL", "3600")),
+    )
+
+
+# Registro compartido; recibe los eventos de runners como un backend más de lifecycle_events
+usage_ledger = create_usage_ledger()
+if usage_ledger:
+    lifecycle_events.add_publisher(usage_ledger)
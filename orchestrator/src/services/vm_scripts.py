@@ -0,0 +1,209 @@
+"""
+Startup scripts de las VMs de los backends gce y azure a partir de plantillas.
+El script se arma con cinco secciones: Prelude (funciones y opciones del backend),
+Install (descarga el Actions runner si la imagen no lo trae), Harden (endurece el
+host), Configure (registra el runner con los argumentos y el token que inyecta el
+backend) y Run (ejecuta el job y apaga la VM). La plantilla por defecto las concatena
+en ese orden; con startup_template un pool usa su propio archivo (relativo a
+VM_TEMPLATES_DIR) con la sintaxis {{.Campo}} de las plantillas de nombres, para agregar
+pasos propios (agentes, certificados, montajes) sin hornear scripts en la imagen.
+"""
+
+import difflib
+import os
+import shlex
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+from src.services.naming import TEMPLATE_FIELD, render
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SECTIONS = ("Prelude", "Install", "Harden", "Configure", "Run")
+
+FIELDS = {
+    **{section: "Sección del script" for section in SECTIONS},
+    "Pool": "Nombre del pool",
+    "Backend": "gce o azure",
+    "OS": "linux o windows",
+    "RunnerDir": "Directorio del Actions runner",
+    "RunnerUser": "Usuario Linux que ejecuta el runner",
+    "RunnerVersion": "VM_RUNNER_VERSION",
+}
+
+# Sin ellas el runner no se registra o la VM no se apaga al terminar el job
+REQUIRED_SECTIONS = ("Configure", "Run")
+
+DEFAULT_TEMPLATES = {
+    "linux": "#!/bin/sh\n{{.Prelude}}\n{{.Install}}\n{{.Harden}}\n{{.Configure}}\n{{.Run}}\n",
+    "windows": "{{.Prelude}}\n{{.Install}}\n{{.Harden}}\n{{.Configure}}\n{{.Run}}\n",
+}
+
+DEFAULT_RUNNER_VERSION = "2.321.0"
+DEFAULT_DOWNLOAD_URL = "https://github.com/actions/runner/releases/download"
+
+# Servidor de metadata de GCE y Azure (IMDS)
+METADATA_ADDRESS = "169.254.169.254"
+
+
+def _powershell_quote(value: str) -> str:
+    return "'" + value.replace("'", "''") + "'"
+
+
+def validate_template(template: str, source: str) -> str:
+    """
+    Verifica los campos de la plantilla y que tenga las secciones obligatorias una sola vez.
+
+    Raises:
+        ConfigurationError: Si hay campos desconocidos o falta o se repite Configure o Run
+    """
+    fields = TEMPLATE_FIELD.findall(template)
+    for field in fields:
+        if field not in FIELDS:
+            suggestion = difflib.get_close_matches(field, list(FIELDS), n=1)
+            hint = f"; ¿quisiste decir '{{{{.{suggestion[0]}}}}}'?" if suggestion else ""
+            raise ConfigurationError(f"{source}: campo desconocido '{{{{.{field}}}}}'{hint}")
+    for section in REQUIRED_SECTIONS:
+        if fields.count(section) != 1:
+            raise ConfigurationError(f"{source}: la plantilla debe incluir {{{{.{section}}}}} exactamente una vez")
+    return template
+
+
+class StartupTemplates:
+    """Plantillas de startup script: la de cada pool se relee si cambia el archivo."""
+
+    def __init__(self, directory: Optional[str] = None, runner_version: str = DEFAULT_RUNNER_VERSION, download_url: str = DEFAULT_DOWNLOAD_URL):
+        self.directory = directory
+        self.runner_version = runner_version
+        self.download_url = download_url.rstrip("/")
+        self.cache: Dict[str, Tuple[float, str]] = {}
+        self.lock = threading.Lock()
+
+    def path(self, name: str) -> str:
+        if os.path.isabs(name):
+            return name
+        if not self.directory:
+            raise ConfigurationError(f"startup_template {name} relativo requiere VM_TEMPLATES_DIR")
+        return os.path.join(self.directory, name)
+
+    def template(self, name: Optional[str], os_name: str) -> str:
+        """Plantilla del pool (startup_template) o la por defecto del sistema operativo."""
+        if not name:
+            return DEFAULT_TEMPLATES[os_name]
+        path = self.path(name)
+        try:
+            mtime = os.path.getmtime(path)
+            with self.lock:
+                cached = self.cache.get(path)
+            if cached and cached[0] == mtime:
+                return cached[1]
+            with open(path, "r") as template_file:
+                template = validate_template(template_file.read(), f"startup_template {path}")
+        except OSError as e:
+            raise ConfigurationError(f"No se pudo leer startup_template {path}: {e}")
+        with self.lock:
+            self.cache[path] = (mtime, template)
+        logger.debug(format_log('CONFIG', 'Plantilla de startup script cargada', path))
+        return template
+
+    def validate(self, pool_name: str, spec: Dict[str, Any]):
+        """Valida startup_template de las opciones gce o azure de un pool al cargarlo."""
+        name = spec.get("startup_template")
+        if name:
+            try:
+                self.template(name, spec.get("os", "linux"))
+            except ConfigurationError as e:
+                raise ConfigurationError(f"Pool {pool_name}: {e}")
+
+    def install(self, spec: Any) -> List[str]:
+        """Descarga el runner en runner_dir si la imagen no lo trae (sin VM_RUNNER_VERSION no se instala)."""
+        if not self.runner_version:
+            return []
+        version = self.runner_version
+        if spec.os == "windows":
+            runner_dir = _powershell_quote(spec.runner_dir)
+            url = _powershell_quote(f"{self.download_url}/v{version}/actions-runner-win-x64-{version}.zip")
+            return [
+                f"if (-not (Test-Path (Join-Path {runner_dir} 'config.cmd'))) {{",
+                f"  New-Item -ItemType Directory -Force {runner_dir} | Out-Null",
+                "  $zip = Join-Path $env:TEMP 'actions-runner.zip'",
+                f"  Invoke-WebRequest -UseBasicParsing {url} -OutFile $zip",
+                f"  Expand-Archive -Force $zip {runner_dir}",
+                "  Remove-Item $zip",
+                "}",
+            ]
+        runner_dir = shlex.quote(spec.runner_dir)
+        user = shlex.quote(spec.runner_user)
+        url = shlex.quote(f"{self.download_url}/v{version}/actions-runner-linux-") + "$arch" + shlex.quote(f"-{version}.tar.gz")
+        return [
+            f"if [ ! -x {runner_dir}/config.sh ]; then",
+            f"  id -u {user} > /dev/null 2>&1 || useradd -m -s /bin/bash {user}",
+            "  case $(uname -m) in aarch64|arm64) arch=arm64 ;; armv7l) arch=arm ;; *) arch=x64 ;; esac",
+            f"  mkdir -p {runner_dir}",
+            f"  curl -fsSL {url} | tar -xz -C {runner_dir}",
+            f"  {runner_dir}/bin/installdependencies.sh > /dev/null 2>&1 || true",
+            f"  chown -R {user} {runner_dir}",
+            "fi",
+        ]
+
+    @staticmethod
+    def harden(spec: Any) -> List[str]:
+        """
+        Endurece el host: root y el acceso remoto sin contraseña, y con block_metadata el
+        job sin acceso al servidor de metadata (las credenciales de la VM). Es idempotente,
+        porque las instancias de scale set se reutilizan.
+        """
+        if not spec.harden:
+            return []
+        if spec.os == "windows":
+            return [
+                "Set-ItemProperty 'HKLM:\\System\\CurrentControlSet\\Control\\Terminal Server' -Name fDenyTSConnections -Value 1 -ErrorAction SilentlyContinue",
+                "Set-SmbServerConfiguration -EnableSMB1Protocol $false -Force -ErrorAction SilentlyContinue",
+                "Disable-LocalUser -Name Guest -ErrorAction SilentlyContinue",
+            ]
+        user = shlex.quote(spec.runner_user)
+        lines = [
+            "passwd -l root > /dev/null 2>&1 || true",
+            "if [ -f /etc/ssh/sshd_config ]; then",
+            "  sed -i -E 's/^#?(PasswordAuthentication|PermitRootLogin) .*/\\1 no/' /etc/ssh/sshd_config",
+            "  systemctl reload ssh > /dev/null 2>&1 || systemctl reload sshd > /dev/null 2>&1 || true",
+            "fi",
+            "sysctl -q -w kernel.dmesg_restrict=1 kernel.kptr_restrict=2 net.ipv4.conf.all.accept_redirects=0 net.ipv4.conf.all.send_redirects=0 || true",
+        ]
+        if spec.block_metadata:
+            rule = f"OUTPUT -d {METADATA_ADDRESS} -m owner --uid-owner {user} -j REJECT"
+            lines.append(f"iptables -C {rule} 2> /dev/null || iptables -I {rule}")
+        return lines
+
+    def render(self, pool_name: str, backend: str, spec: Any, prelude: List[str], configure: List[str], run: List[str]) -> str:
+        """Script del pool con las secciones propias del backend (prelude, configure, run)."""
+        sections = {
+            "Prelude": prelude,
+            "Install": self.install(spec),
+            "Harden": self.harden(spec),
+            "Configure": configure,
+            "Run": run,
+        }
+        context = {section: "\n".join(lines) for section, lines in sections.items()}
+        context.update(
+            Pool=pool_name,
+            Backend=backend,
+            OS=spec.os,
+            RunnerDir=spec.runner_dir,
+            RunnerUser=spec.runner_user,
+            RunnerVersion=self.runner_version,
+        )
+        return render(self.template(spec.startup_template, spec.os), context)
+
+
+def create_startup_templates() -> StartupTemplates:
+    """Plantillas desde VM_TEMPLATES_DIR, VM_RUNNER_VERSION y VM_RUNNER_DOWNLOAD_URL."""
+    return StartupTemplates(
+        os.getenv("VM_TEMPLATES_DIR"),
+        runner_version=os.getenv("VM_RUNNER_VERSION", DEFAULT_RUNNER_VERSION),
+        download_url=os.getenv("VM_RUNNER_DOWNLOAD_URL", DEFAULT_DOWNLOAD_URL),
+    )
+
+
+startup_templates = create_startup_templates()
@@ -0,0 +1,184 @@
+"""
+SBOM y escaneo de vulnerabilidades de imágenes de runners con syft y grype.
+Antes de lanzar un runner genera el SBOM de la imagen, lo escanea y rechaza
+imágenes con vulnerabilidades por encima del umbral configurado.
+"""
+
+import datetime
+import json
+import os
+import re
+import subprocess
+import threading
+import time
+from typing import Any, Dict, Optional
+
+from src.services.metrics import metrics
+from src.services.security_events import security_events
+from src.utils.helpers import ImageVulnerabilityError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+SCAN_MODES = ("off", "warn", "enforce")
+
+# Severidades de grype en orden creciente
+SEVERITIES = ("negligible", "low", "medium", "high", "critical")
+
+
+class ImageScanner:
+    """
+    Genera SBOMs con `syft` y los escanea con `grype`.
+
+    Modos:
+        off:     no se escanea
+        warn:    se escanea y se registran las vulnerabilidades, pero la imagen se usa
+        enforce: las imágenes que superan el umbral se rechazan
+    """
+
+    def __init__(
+        self,
+        mode: str = "off",
+        fail_on: str = "critical",
+        max_findings: int = 0,
+        sbom_dir: str = "/tmp/gha-sbom",
+        cache_ttl: int = 86400,
+        syft_path: str = "syft",
+        grype_path: str = "grype",
+    ):
+        if mode not in SCAN_MODES:
+            raise ValueError(f"IMAGE_VULNERABILITY_SCAN debe ser uno de {SCAN_MODES}")
+        if fail_on not in SEVERITIES:
+            raise ValueError(f"VULN_FAIL_ON debe ser uno de {SEVERITIES}")
+
+        self.mode = mode
+        self.fail_on = fail_on
+        self.max_findings = max_findings
+        self.sbom_dir = sbom_dir
+        self.cache_ttl = cache_ttl
+        self.syft_path = syft_path
+        self.grype_path = grype_path
+        self.reports: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+
+    @property
+    def enabled(self) -> bool:
+        return self.mode != "off"
+
+    def _sbom_path(self, image: str) -> str:
+        return os.path.join(self.sbom_dir, re.sub(r"[^A-Za-z0-9_.-]", "_", image) + ".spdx.json")
+
+    def _generate_sbom(self, image: str) -> str:
+        """Genera el SBOM SPDX de la imagen y retorna su ruta."""
+        os.makedirs(self.sbom_dir, exist_ok=True)
+        sbom_path = self._sbom_path(image)
+        result = subprocess.run(
+            [self.syft_path, "scan", f"registry:{image}", "-o", f"spdx-json={sbom_path}"],
+            capture_output=True, text=True, timeout=600,
+        )
+        if result.returncode != 0:
+            raise RuntimeError(f"syft falló para {image}: {result.stderr.strip()}")
+        return sbom_path
+
+    def _scan_sbom(self, sbom_path: str) -> Dict[str, int]:
+        """Escanea un SBOM y retorna el número de vulnerabilidades por severidad."""
+        result = subprocess.run(
+            [self.grype_path, f"sbom:{sbom_path}", "-o", "json"],
+            capture_output=True, text=True, timeout=600,
+        )
+        if result.returncode != 0:
+            raise RuntimeError(f"grype falló: {result.stderr.strip()}")
+
+        findings = {severity: 0 for severity in SEVERITIES}
+        for match in json.loads(result.stdout).get("matches", []):
+            severity = match.get("vulnerability", {}).get("severity", "").lower()
+            if severity in findings:
+                findings[severity] += 1
+        return findings
+
+    def _blocking(self, findings: Dict[str, int]) -> int:
+        """Vulnerabilidades con severidad igual o superior a fail_on."""
+        threshold = SEVERITIES.index(self.fail_on)
+        return sum(count for severity, count in findings.items() if SEVERITIES.index(severity) >= threshold)
+
+    def scan(self, image: str, required: bool = True) -> Optional[Dict[str, Any]]:
+        """
+        Genera el SBOM y escanea una imagen.
+
+        Args:
+            image: Referencia de la imagen
+            required: False si el pool optó por no escanear
+
+        Returns:
+            Reporte con la ruta del SBOM y las vulnerabilidades por severidad
+
+        Raises:
+            ImageVulnerabilityError: Si la imagen supera el umbral y el modo es enforce
+        """
+        if not self.enabled or not required:
+            return None
+
+        with self.lock:
+            report = self.reports.get(image)
+        if not report or time.time() - report["scanned_epoch"] >= self.cache_ttl:
+            try:
+                sbom_path = self._generate_sbom(image)
+                findings = self._scan_sbom(sbom_path)
+            except (OSError, ValueError, RuntimeError, subprocess.TimeoutExpired) as e:
+                metrics.incr("images.scan_errors")
+                logger.error(format_log('ERROR', 'No se pudo escanear la imagen', f'{image}: {e}'))
+                if self.mode == "enforce":
+                    raise ImageVulnerabilityError(f"No se pudo escanear la imagen {image}: {e}")
+                return None
+
+            report = {
+                "image": image,
+                "sbom": sbom_path,
+                "findings": findings,
+                "blocking": self._blocking(findings),
+                "fail_on": self.fail_on,
+                "scanned_at": datetime.datetime.utcnow().isoformat() + "Z",
+                "scanned_epoch": time.time(),
+            }
+            with self.lock:
+                self.reports[image] = report
+            metrics.incr("images.scanned")
+            logger.info(format_log(
+                'INFO', 'Imagen escaneada',
+                f"{image}: " + ", ".join(f"{severity}={count}" for severity, count in findings.items() if count)
+            ))
+
+        if report["blocking"] <= self.max_findings:
+            return report
+
+        metrics.incr("images.vulnerable", tags={"mode": self.mode})
+        security_events.emit(
+            "image.vulnerable_rejected" if self.mode == "enforce" else "image.vulnerable_allowed",
+            severity="critical" if self.mode == "enforce" else "warning",
+            image=image,
+            findings=report["findings"],
+            fail_on=self.fail_on,
+            sbom=report["sbom"],
+        )
+        detail = f"{image} ({report['blocking']} vulnerabilidades {self.fail_on} o superiores)"
+        if self.mode == "enforce":
+            logger.error(format_log('ERROR', 'Imagen con vulnerabilidades rechazada', detail))
+            raise ImageVulnerabilityError(f"La imagen {image} supera el umbral de vulnerabilidades: {detail}")
+
+        logger.warning(format_log('WARNING', 'Imagen con vulnerabilidades', detail))
+        return report
+
+
+def create_image_scanner() -> ImageScanner:
+    """Crea el escáner de imágenes desde variables de entorno."""
+    scanner = ImageScanner(
+        mode=os.getenv("IMAGE_VULNERABILITY_SCAN", "off").lower(),
+        fail_on=os.getenv("VULN_FAIL_ON", "critical").lower(),
+        max_findings=int(os.getenv("VULN_MAX_FINDINGS", "0")),
+        sbom_dir=os.getenv("SBOM_DIR", "/tmp/gha-sbom"),
+        cache_ttl=int(os.getenv("VULN_CACHE_TTL", "86400")),
+        syft_path=os.getenv("SYFT_PATH", "syft"),
+        grype_path=os.getenv("GRYPE_PATH", "grype"),
+    )
+    if scanner.enabled:
+        logger.info(format_log('CONFIG', 'Escaneo de vulnerabilidades de imágenes', f'{scanner.mode} (fail_on={scanner.fail_on})'))
+    return scanner
@@ -0,0 +1,79 @@
+"""
+Refresco de pools precalentados.
+Los pools de VMs con "warm" mantienen instancias ya arrancadas y suspendidas
+(Compute Engine) o hibernadas (Azure) que se reanudan al crear un runner. Este
+hilo llama periódicamente a refresh_warm de cada backend para reponer las
+reclamadas, suspender las que terminaron de arrancar y reciclar las antiguas.
+"""
+
+import os
+import threading
+import time
+from typing import Any, Dict, Optional, Set
+
+from src.utils.helpers import format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+
+class WarmPoolRefresher:
+    """Mantiene las instancias precalentadas de los pools cada `interval` segundos."""
+
+    def __init__(self, lifecycle_manager: Any, interval: int = 60):
+        self.lifecycle_manager = lifecycle_manager
+        self.interval = interval
+        self.summary: Dict[str, Dict[str, Any]] = {}
+        # Backends con pools precalentados en la última pasada: se refrescan una vez más
+        # tras quitar "warm" para eliminar las instancias sobrantes
+        self.active: Set[str] = set()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Refresco de pools precalentados iniciado', f'cada {self.interval}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        while self.running:
+            self.refresh()
+            # Dormir en tramos cortos para que stop() no espere todo el intervalo
+            deadline = time.time() + self.interval
+            while self.running and time.time() < deadline:
+                time.sleep(1)
+
+    def refresh(self):
+        backends = self.lifecycle_manager.container_manager.backends
+        warm: Dict[str, Dict[str, Dict[str, Any]]] = {}
+        for pool in self.lifecycle_manager.pools.pools.values():
+            spec = getattr(pool, pool.backend, None)
+            if isinstance(spec, dict) and spec.get("warm"):
+                warm.setdefault(pool.backend, {})[pool.name] = spec
+
+        for name, backend in backends.items():
+            if not hasattr(backend, "refresh_warm") or (name not in warm and name not in self.active):
+                continue
+            try:
+                self.summary[name] = backend.refresh_warm(warm.get(name, {}))
+            except Exception as e:
+                logger.error(format_log('ERROR', f'Error refrescando pools precalentados de {name}', str(e)))
+        self.active = set(warm)
+
+    def status(self) -> Dict[str, Dict[str, Any]]:
+        return dict(self.summary)
+
+
+def create_warm_pool_refresher(lifecycle_manager: Any) -> Optional[WarmPoolRefresher]:
+    """Refresco si hay algún backend con pools precalentados (Azure o Compute Engine)."""
+    backends = lifecycle_manager.container_manager.backends
+    if not any(hasattr(backend, "refresh_warm") for backend in backends.values()):
+        return None
+    return WarmPoolRefresher(lifecycle_manager, int(os.getenv("WARM_POOL_REFRESH_INTERVAL", "60")))
@@ -0,0 +1,355 @@
+"""
+Cuotas de disco de los workspaces de los runners y verificación de su limpieza.
+Un job desbocado puede llenar el disco del host y dejar sin espacio al resto de runners.
+La cuota de cada pool ("workspace" del pool o WORKSPACE_QUOTA) se aplica según el backend:
+
+- docker: tamaño máximo de la capa escribible del contenedor (storage), un tmpfs con
+  tamaño en el directorio de trabajo (tmpfs) o un volumen por runner con tamaño (volume)
+- ssh, azure y gce (Linux): cuota de proyecto XFS sobre el directorio de trabajo
+
+Mientras el runner corre se muestrea el uso del workspace (métrica workspace.usage_mb); al
+destruirlo se registra el pico (workspace.peak_mb) y, pasado WORKSPACE_VERIFY_DELAY, se
+comprueba que el workspace ya no exista: si sigue ahí se vuelve a eliminar y se publica
+runner.workspace_leaked.
+"""
+
+import os
+import re
+import shlex
+import threading
+import time
+import zlib
+from typing import Any, Dict, List, Optional
+
+import docker
+from src.services.lifecycle_events import lifecycle_events
+from src.services.metrics import metrics
+from src.utils.helpers import ConfigurationError, format_log, setup_logger
+
+logger = setup_logger(__name__)
+
+MODES = ("storage", "tmpfs", "volume")
+
+VOLUME_PREFIX = "gha-workspace"
+
+# Directorio de trabajo del agente en la imagen de runners (RUNNER_WORKDIR la cambia)
+DEFAULT_PATH = "/_work"
+
+UNITS = {"": 1, "k": 1024, "m": 1024 ** 2, "g": 1024 ** 3, "t": 1024 ** 4}
+
+
+def parse_size(value: Any, name: str) -> int:
+    """Tamaño en bytes desde un entero o '512m', '20g', '1t'."""
+    match = re.fullmatch(r"(\d+)\s*([kmgt]?)i?b?", str(value).strip().lower())
+    if not match or int(match.group(1)) == 0:
+        raise ConfigurationError(f"{name}: tamaño inválido {value} (ej: 512m, 20g)")
+    return int(match.group(1)) * UNITS[match.group(2)]
+
+
+def format_size(size: int) -> str:
+    for unit in ("t", "g", "m", "k"):
+        if size % UNITS[unit] == 0:
+            return f"{size // UNITS[unit]}{unit}"
+    return str(size)
+
+
+# xfs_quota necesita root: con sudo -n si el usuario de conexión no lo es
+XFS_QUOTA_FUNCTION = "xq() { if [ \"$(id -u)\" = 0 ]; then xfs_quota \"$@\"; else sudo -n xfs_quota \"$@\"; fi; }"
+
+
+def volume_name(runner_name: str) -> str:
+    return f"{VOLUME_PREFIX}-{runner_name}"
+
+
+def project_id(runner_name: str = "") -> int:
+    """Id de proyecto XFS estable por runner, por encima de WORKSPACE_XFS_PROJECT_BASE."""
+    return int(os.getenv("WORKSPACE_XFS_PROJECT_BASE", "100000")) + zlib.crc32(runner_name.encode()) % 1000000
+
+
+class WorkspaceQuota:
+    """Cuota de disco del workspace de un pool."""
+
+    def __init__(self, pool_name: str, spec: Dict[str, Any]):
+        name = f"Pool {pool_name}: workspace"
+        self.size = parse_size(spec.get("size"), name)
+        self.mode = spec.get("mode") or os.getenv("WORKSPACE_QUOTA_MODE", "storage")
+        if self.mode not in MODES:
+            raise ConfigurationError(f"{name}: mode debe ser uno de {', '.join(MODES)}")
+        # tmpfs: noexec es el default de Docker y los jobs necesitan ejecutar lo que compilan
+        self.tmpfs_options = spec.get("tmpfs_options", "exec,mode=1777")
+        self.path = spec.get("path")
+
+    def workdir(self, environment: Dict[str, str]) -> str:
+        return self.path or environment.get("RUNNER_WORKDIR") or DEFAULT_PATH
+
+    def docker_options(self, client: Any, runner_name: str, environment: Dict[str, str], volumes: Dict[str, Any]) -> Dict[str, Any]:
+        """
+        Argumentos de containers.run que limitan el workspace; en modo volume crea el
+        volumen del runner y lo agrega a volumes.
+        """
+        workdir = self.workdir(environment)
+        environment.setdefault("RUNNER_WORKDIR", workdir)
+        if self.mode == "storage":
+            # Requiere overlay2 sobre XFS con pquota (o btrfs/zfs) en el host Docker
+            return {"storage_opt": {"size": format_size(self.size)}}
+        if self.mode == "tmpfs":
+            return {"tmpfs": {workdir: f"size={format_size(self.size)},{self.tmpfs_options}".rstrip(",")}}
+        driver = os.getenv("WORKSPACE_VOLUME_DRIVER", "local")
+        # Opciones separadas por ';' porque el valor de o= del driver local lleva comas
+        options = os.getenv("WORKSPACE_VOLUME_OPTIONS") or (
+            "type=tmpfs;device=tmpfs;o=size={size}" if driver == "local" else "size={size}"
+        )
+        driver_opts = dict(
+            item.strip().split("=", 1) for item in options.replace("{size}", format_size(self.size)).split(";") if "=" in item
+        )
+        volume = client.volumes.create(
+            name=volume_name(runner_name), driver=driver, driver_opts=driver_opts,
+            labels={"gha-workspace": "true", "runner-name": runner_name},
+        )
+        volumes[volume.name] = {"bind": workdir, "mode": "rw"}
+        return {}
+
+    def xfs_script(self, directory: str, runner_name: str, on_failure: str = "") -> List[str]:
+        return xfs_quota_script(directory, format_size(self.size), runner_name, on_failure)
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {"size": format_size(self.size), "mode": self.mode, "tmpfs_options": self.tmpfs_options, "path": self.path}
+
+
+def xfs_quota_script(directory: str, size: str, runner_name: str = "", on_failure: str = "") -> List[str]:
+    """
+    Líneas de sh que crean el directorio y le ponen una cuota de proyecto XFS de size
+    (un tamaño o una variable de shell); fallan tras ejecutar on_failure si el sistema de
+    archivos no es XFS con prjquota, para no correr el job sin límite. En las VMs (un
+    runner por máquina) runner_name va vacío y se usa el id base.
+    """
+    quoted = shlex.quote(directory)
+    project = project_id(runner_name)
+    return [
+        f"mkdir -p {quoted}",
+        XFS_QUOTA_FUNCTION,
+        f"mnt=$(df --output=target {quoted} | tail -n 1)",
+        f"xq -x -c \"project -s -p {quoted} {project}\" \"$mnt\" > /dev/null"
+        f" && xq -x -c \"limit -p bhard={size} {project}\" \"$mnt\""
+        " || { echo \"cuota XFS no aplicable en $mnt (requiere XFS con prjquota y xfs_quota)\" >&2; "
+        f"{on_failure}exit 1; }}",
+    ]
+
+
+def xfs_release_script(directory: str, runner_name: str) -> List[str]:
+    """Líneas de sh que quitan el límite del proyecto XFS del runner antes de borrar su directorio (sin fallar)."""
+    quoted = shlex.quote(directory)
+    return [
+        XFS_QUOTA_FUNCTION,
+        f"if [ -d {quoted} ] && command -v xfs_quota > /dev/null; then",
+        f"    xq -x -c \"limit -p bhard=0 {project_id(runner_name)}\" \"$(df --output=target {quoted} | tail -n 1)\" > /dev/null 2>&1 || true",
+        "fi",
+    ]
+
+
+def quota_disabled(spec: Dict[str, Any]) -> bool:
+    return str(spec.get("size") or "0").strip() == "0"
+
+
+def validate_workspace(pool_name: str, spec: Any):
+    if not isinstance(spec, dict):
+        raise ConfigurationError(f"Pool {pool_name}: workspace debe ser un objeto con size y mode")
+    if not quota_disabled(spec):
+        WorkspaceQuota(pool_name, spec)
+
+
+def quota_for(pool: Any) -> Optional[WorkspaceQuota]:
+    """Cuota del pool, o la de WORKSPACE_QUOTA si el pool no define la suya ({"size": 0} la desactiva)."""
+    spec = pool.workspace if pool.workspace is not None else (
+        {"size": os.getenv("WORKSPACE_QUOTA")} if os.getenv("WORKSPACE_QUOTA") else None
+    )
+    if not spec or quota_disabled(spec):
+        return None
+    return WorkspaceQuota(pool.name, spec)
+
+
+class WorkspaceMonitor:
+    """Uso de disco de los workspaces en curso y verificación de que desaparecen al destruir el runner."""
+
+    def __init__(self, lifecycle_manager: Any, sample_interval: int = 60, verify_delay: int = 30, warn_ratio: float = 0.9):
+        self.lifecycle_manager = lifecycle_manager
+        self.sample_interval = sample_interval
+        self.verify_delay = verify_delay
+        self.warn_ratio = warn_ratio
+        # runner -> {"pool", "quota", "peak", "warned"}
+        self.usage: Dict[str, Dict[str, Any]] = {}
+        # runner -> {"container", "pool", "due"}: destruidos pendientes de verificar
+        self.pending: Dict[str, Dict[str, Any]] = {}
+        self.lock = threading.Lock()
+        self.running = False
+        self.thread: Optional[threading.Thread] = None
+        self.counters = {"verified": 0, "leaked": 0}
+
+    def start(self):
+        if self.running:
+            return
+        self.running = True
+        self.thread = threading.Thread(target=self._loop, daemon=True)
+        self.thread.start()
+        logger.info(format_log('SUCCESS', 'Monitor de workspaces iniciado', f'muestreo cada {self.sample_interval}s'))
+
+    def stop(self):
+        self.running = False
+        if self.thread:
+            self.thread.join(timeout=5)
+
+    def _loop(self):
+        last_sample = 0.0
+        while self.running:
+            time.sleep(1)
+            try:
+                self.verify()
+                if self.sample_interval and time.monotonic() - last_sample >= self.sample_interval:
+                    last_sample = time.monotonic()
+                    self.sample()
+            except Exception as e:
+                logger.error(format_log('ERROR', 'Error en el monitor de workspaces', str(e)))
+
+    # ===== Uso de disco =====
+
+    def _measure(self, container: Any) -> Optional[int]:
+        """Bytes usados por el workspace del runner (contenedor Docker o directorio en un host SSH)."""
+        labels = getattr(container, "labels", None) or {}
+        if labels.get("runner-backend") == "ssh":
+            output = container.backend._run(container.host, f"du -sk {shlex.quote(container.directory)}/_work 2>/dev/null || echo 0", timeout=60)
+            return int(output.split()[0]) * 1024
+        if not hasattr(container, "exec_run"):
+            # Tareas de ECS y VMs: sin acceso al sistema de archivos
+            return None
+        environment = dict(item.split("=", 1) for item in container.attrs.get("Config", {}).get("Env") or [] if "=" in item)
+        workdir = environment.get("RUNNER_WORKDIR", DEFAULT_PATH)
+        result = container.exec_run(["du", "-sk", workdir])
+        if result.exit_code != 0:
+            return None
+        return int(result.output.split()[0]) * 1024
+
+    def sample(self):
+        manager = self.lifecycle_manager
+        active = dict(manager.active_runners)
+        with self.lock:
+            # Runners que terminaron sin pasar por destroy_runner (purgas, reconciliación)
+            for runner_id in set(self.usage) - set(active):
+                del self.usage[runner_id]
+        for runner_id, container in active.items():
+            if getattr(container, "status", "running") != "running":
+                continue
+            pool_name = (getattr(container, "labels", None) or {}).get("runner-pool", "default")
+            try:
+                used = self._measure(container)
+            except Exception as e:
+                logger.debug(f"No se pudo medir el workspace de {runner_id}: {e}")
+                continue
+            if used is None:
+                continue
+            quota = None
+            try:
+                pool_quota = quota_for(manager.pools.get(pool_name))
+                quota = pool_quota.size if pool_quota else None
+            except ValueError:
+                pass
+            metrics.histogram("workspace.usage_mb", used / UNITS["m"], tags={"pool": pool_name})
+            with self.lock:
+                entry = self.usage.setdefault(runner_id, {"pool": pool_name, "quota": quota, "peak": 0, "warned": False})
+                entry["peak"] = max(entry["peak"], used)
+                warn = quota and used >= quota * self.warn_ratio and not entry["warned"]
+                if warn:
+                    entry["warned"] = True
+            if warn:
+                metrics.incr("workspace.near_quota", tags={"pool": pool_name})
+                logger.warning(format_log(
+                    'WARNING', 'Workspace cerca de su cuota',
+                    f"{runner_id}: {used / UNITS['m']:.0f} MiB de {format_size(quota)} (pool {pool_name})",
+                ))
+
+    # ===== Verificación de la limpieza =====
+
+    def released(self, runner_id: str, container: Any):
+        """El runner se destruyó: registra su pico de uso y agenda la verificación del workspace."""
+        labels = getattr(container, "labels", None) or {}
+        pool_name = labels.get("runner-pool", "default")
+        with self.lock:
+            entry = self.usage.pop(runner_id, None)
+            self.pending[runner_id] = {"container": container, "pool": pool_name, "due": time.time() + self.verify_delay}
+        if entry and entry["peak"]:
+            metrics.histogram("workspace.peak_mb", entry["peak"] / UNITS["m"], tags={"pool": pool_name})
+
+    def _leftovers(self, runner_id: str, container: Any) -> List[str]:
+        """Restos del workspace que siguen existiendo (y que se vuelven a eliminar)."""
+        labels = getattr(container, "labels", None) or {}
+        if labels.get("runner-backend") == "ssh":
+            directory = shlex.quote(container.directory)
+            output = container.backend._run(container.host, f"test -e {directory} && rm -rf {directory} && echo leaked || true", timeout=120)
+            return [container.directory] if "leaked" in output else []
+        if labels.get("runner-backend") in ("ecs", "azure", "gce"):
+            # El workspace desaparece con la tarea o la VM; el script de las VMs reutilizadas lo borra al terminar
+            return []
+
+        # Los contenedores de hosts Docker remotos llevan el cliente de su host
+        client = getattr(container, "client", None) or self.lifecycle_manager.container_manager.client
+        leftovers = []
+        try:
+            client.containers.get(container.id)
+            leftovers.append(f"contenedor {container.id[:12]}")
+            container.remove(force=True)
+        except docker.errors.NotFound:
+            pass
+        try:
+            volume = client.volumes.get(volume_name(runner_id))
+            leftovers.append(f"volumen {volume.name}")
+            volume.remove(force=True)
+        except docker.errors.NotFound:
+            pass
+        return leftovers
+
+    def verify(self):
+        now = time.time()
+        with self.lock:
+            due = {runner_id: entry for runner_id, entry in self.pending.items() if entry["due"] <= now}
+        for runner_id, entry in due.items():
+            try:
+                leftovers = self._leftovers(runner_id, entry["container"])
+            except Exception as e:
+                # Host o daemon inaccesibles: se vuelve a intentar en la siguiente vuelta
+                logger.debug(f"No se pudo verificar el workspace de {runner_id}: {e}")
+                with self.lock:
+                    entry["due"] = now + self.verify_delay
+                continue
+            with self.lock:
+                self.pending.pop(runner_id, None)
+            result = "leaked" if leftovers else "verified"
+            self.counters[result] += 1
+            metrics.incr("workspace.cleanup", tags={"pool": entry["pool"], "result": result})
+            if leftovers:
+                logger.error(format_log('ERROR', 'Workspace sin eliminar tras destruir el runner', f"{runner_id}: {', '.join(leftovers)}"))
+                lifecycle_events.emit("runner.workspace_leaked", key=runner_id, runner_id=runner_id, pool=entry["pool"], leftovers=leftovers)
+
+    def status(self) -> Dict[str, Any]:
+        with self.lock:
+            peaks = [entry["peak"] for entry in self.usage.values()]
+            pending = len(self.pending)
+        return {
+            "sampled_runners": len(peaks),
+            "max_usage_mb": round(max(peaks) / UNITS["m"]) if peaks else None,
+            "pending_verification": pending,
+            **self.counters,
+        }
+
+
+def create_workspace_monitor(lifecycle_manager: Any) -> Optional[WorkspaceMonitor]:
+    """Monitor de workspaces salvo con WORKSPACE_MONITOR_ENABLED=false."""
+    # Cuota global inválida: se detecta al arrancar y no al crear el primer runner
+    if os.getenv("WORKSPACE_QUOTA"):
+        validate_workspace("*", {"size": os.getenv("WORKSPACE_QUOTA")})
+    if os.getenv("WORKSPACE_MONITOR_ENABLED", "true").lower() != "true":
+        return None
+    return WorkspaceMonitor(
+        lifecycle_manager,
+        sample_interval=int(os.getenv("WORKSPACE_SAMPLE_INTERVAL", "60")),
+        verify_delay=int(os.getenv("WORKSPACE_VERIFY_DELAY", "30")),
+        warn_ratio=float(os.getenv("WORKSPACE_WARN_RATIO", "0.9")),
+    )
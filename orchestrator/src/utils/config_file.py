@@ -0,0 +1,483 @@
+"""
+Archivo de configuración YAML unificado.
+Carga CONFIG_FILE, valida tipos y valores, y exporta cada opción a su variable de
+entorno para que el resto de módulos la lea como siempre. Las variables de entorno
+ya definidas tienen prioridad sobre el archivo.
+
+Este módulo se ejecuta antes de configurar logging y no debe importar src.utils.helpers.
+"""
+
+import difflib
+import os
+from typing import Any, Dict, List, Optional, Sequence
+
+import yaml
+
+LOG_LEVELS = ("DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL")
+VERIFICATION_MODES = ("off", "warn", "enforce")
+INCIDENT_BACKENDS = ("pagerduty", "opsgenie")
+DISCOVERY_BACKENDS = ("consul", "etcd")
+
+
+class ConfigFileError(ValueError):
+    """Configuración inválida; el mensaje lista todos los problemas encontrados."""
+
+    def __init__(self, errors: List[str]):
+        self.errors = errors
+        super().__init__("Configuración inválida:\n" + "\n".join(f"  - {error}" for error in errors))
+
+
+class Option:
+    """Opción tipada que se exporta a una variable de entorno."""
+
+    def __init__(
+        self,
+        kind: str = "str",
+        choices: Optional[Sequence[str]] = None,
+        minimum: Optional[int] = None,
+        separator: str = ",",
+        env: Optional[str] = None,
+    ):
+        self.kind = kind
+        self.choices = choices
+        self.minimum = minimum
+        self.separator = separator
+        self.env = env
+
+    def normalize(self, value: Any) -> str:
+        """Convierte el valor a su forma canónica en texto o lanza ValueError con el motivo."""
+        if self.kind == "bool":
+            text = str(value).strip().lower()
+            if text in ("true", "1", "yes", "on"):
+                return "true"
+            if text in ("false", "0", "no", "off"):
+                return "false"
+            raise ValueError(f"se esperaba true/false, se recibió '{value}'")
+
+        if self.kind == "int":
+            if isinstance(value, bool):
+                raise ValueError(f"se esperaba un entero, se recibió '{value}'")
+            try:
+                number = int(str(value).strip())
+            except ValueError:
+                raise ValueError(f"se esperaba un entero, se recibió '{value}'")
+            if self.minimum is not None and number < self.minimum:
+                raise ValueError(f"debe ser >= {self.minimum}, se recibió {number}")
+            return str(number)
+
+        if self.kind == "list":
+            if isinstance(value, (list, tuple)):
+                return self.separator.join(str(item).strip() for item in value)
+            if isinstance(value, dict):
+                raise ValueError("se esperaba una lista o texto separado por comas")
+            return str(value)
+
+        if isinstance(value, (list, dict)):
+            raise ValueError(f"se esperaba un valor simple, se recibió {type(value).__name__}")
+
+        text = str(value).strip()
+        if self.choices:
+            for choice in self.choices:
+                if text.lower() == choice.lower():
+                    return choice
+            raise ValueError(f"debe ser uno de: {', '.join(self.choices)}; se recibió '{value}'")
+        return text
+
+
+# Opciones comunes a orchestrator y api-gateway (sección 'shared')
+SHARED_OPTIONS: Dict[str, Option] = {
+    "log_level": Option(choices=LOG_LEVELS),
+    "log_verbose": Option("bool"),
+    "log_redact_patterns": Option("list", separator=";"),
+    "orchestrator_port": Option("int", minimum=1),
+    "api_gateway_port": Option("int", minimum=1),
+    "statsd_enabled": Option("bool"),
+    "statsd_host": Option(),
+    "statsd_port": Option("int", minimum=1),
+    "statsd_prefix": Option(),
+    "statsd_tags": Option("list"),
+    "statsd_dogstatsd": Option("bool"),
+    "datadog_enabled": Option("bool"),
+    "datadog_agent_host": Option(),
+    "datadog_dogstatsd_port": Option("int", minimum=1),
+    "datadog_trace_port": Option("int", minimum=1),
+    "datadog_env": Option(),
+    "datadog_tags": Option("list"),
+    "datadog_tracing": Option("bool"),
+    "security_events_webhook_url": Option(),
+    "security_events_webhook_token": Option(),
+    "events_backend": Option("list"),
+    "events_nats_url": Option(),
+    "events_nats_subject_prefix": Option(),
+    "events_kafka_rest_url": Option(),
+    "events_kafka_topic": Option(),
+    "incidents_backend": Option(choices=INCIDENT_BACKENDS),
+    "opsgenie_api_url": Option(),
+    "service_discovery_backend": Option(choices=DISCOVERY_BACKENDS),
+    "service_discovery_tags": Option("list"),
+    "service_discovery_ttl": Option("int", minimum=5),
+    "service_discovery_prefix": Option(),
+    "consul_http_addr": Option(),
+    "consul_deregister_after": Option(),
+    "etcd_endpoint": Option(),
+}
+
+# Opciones propias del orchestrator (sección 'orchestrator')
+SERVICE_OPTIONS: Dict[str, Option] = {
+    "runner_image": Option(),
+    "orchestrator_keepalive_timeout": Option("int", minimum=1),
+    "provision_concurrency": Option("int", minimum=1),
+    "provision_backend_limits": Option("list"),
+    "registry": Option(),
+    "docker_network": Option(),
+    "runner_command": Option(),
+    "auto_create_runners": Option("bool"),
+    "dry_run": Option("bool"),
+    "runner_check_interval": Option("int", minimum=10),
+    "runner_purge_interval": Option("int", minimum=10),
+    "discovery_mode": Option(choices=("all", "organization")),
+    "github_organization": Option(),
+    "github_user_login": Option(),
+    "github_cleanup_enabled": Option("bool"),
+    "github_rate_limit_reserve": Option("int", minimum=0),
+    "github_etag_cache_size": Option("int", minimum=0),
+    "github_graphql_enabled": Option("bool"),
+    "github_graphql_batch_size": Option("int", minimum=1),
+    "github_degraded_threshold": Option("int", minimum=0),
+    "github_degraded_probe_interval": Option("int", minimum=5),
+    "github_degraded_max_intents": Option("int", minimum=0),
+    "github_skip_permission_check": Option("bool"),
+    "doctor_max_clock_skew": Option("int", minimum=1),
+    "github_api_url": Option(),
+    "github_url": Option(),
+    "github_app_id": Option(),
+    "github_app_installation_id": Option(),
+    "github_app_permissions": Option("list"),
+    "github_app_private_key_path": Option(),
+    "github_app_token_refresh_margin": Option("int", minimum=0),
+    "secrets_provider": Option(choices=("env", "vault")),
+    "vault_addr": Option(),
+    "vault_auth_method": Option(choices=("approle", "kubernetes", "token")),
+    "vault_auth_mount": Option(),
+    "vault_k8s_role": Option(),
+    "vault_kv_mount": Option(),
+    "vault_namespace": Option(),
+    "vault_refresh_interval": Option("int", minimum=10),
+    "vault_role_id": Option(),
+    "vault_secret_id_path": Option(),
+    "vault_secret_path": Option(),
+    "vault_transit_mount": Option(),
+    "state_encryption": Option(choices=("none", "local", "kms", "vault")),
+    "state_encryption_key_id": Option(),
+    "runner_name_template": Option(),
+    "runner_label_templates": Option("list"),
+    "runner_region": Option(),
+    "runner_pools_file": Option(),
+    "feature_flags_file": Option(),
+    "feature_flag_overrides": Option("list"),
+    "deploy_environment": Option(),
+    "pools_spec_dir": Option(),
+    "pools_git_repo": Option(),
+    "pools_git_ref": Option(),
+    "pools_git_path": Option(),
+    "pools_git_workdir": Option(),
+    "pools_reconcile_interval": Option("int", minimum=10),
+    "reconcile_enabled": Option("bool"),
+    "reconcile_interval": Option("int", minimum=10),
+    "reconcile_grace": Option("int", minimum=0),
+    "reconcile_dry_run": Option("bool"),
+    "git_path": Option(),
+    "ssh_hosts_file": Option(),
+    "ssh_user": Option(),
+    "ssh_key_path": Option(),
+    "ssh_known_hosts_file": Option(),
+    "ssh_runner_dir": Option(),
+    "ssh_workdir": Option(),
+    "ssh_connect_timeout": Option("int", minimum=1),
+    "ssh_path": Option(),
+    "docker_hosts_file": Option(),
+    "docker_hosts_state_file": Option(),
+    "docker_hosts_cert_dir": Option(),
+    "docker_hosts_check_interval": Option("int", minimum=5),
+    "docker_hosts_failure_threshold": Option("int", minimum=1),
+    "docker_hosts_timeout": Option("int", minimum=1),
+    "sidecar_ready_timeout": Option("int", minimum=1),
+    "region_failover_cooldown": Option("int", minimum=1),
+    "runner_capability_labels": Option("bool"),
+    "aws_region": Option(),
+    "ecs_cluster": Option(),
+    "ecs_subnets": Option("list"),
+    "ecs_security_groups": Option("list"),
+    "ecs_assign_public_ip": Option("bool"),
+    "ecs_capacity_provider": Option(choices=("FARGATE", "FARGATE_SPOT")),
+    "ecs_execution_role_arn": Option(),
+    "ecs_task_role_arn": Option(),
+    "ecs_log_group": Option(),
+    "ecs_task_family_prefix": Option(),
+    "ecs_endpoint_url": Option(),
+    "ec2_endpoint_url": Option(),
+    "azure_subscription_id": Option(),
+    "azure_resource_group": Option(),
+    "azure_location": Option(),
+    "azure_subnet_id": Option(),
+    "azure_tenant_id": Option(),
+    "azure_client_id": Option(),
+    "azure_provision_timeout": Option("int", minimum=60),
+    "gce_project": Option(),
+    "gce_provision_timeout": Option("int", minimum=60),
+    "gce_max_instance_age": Option("int", minimum=600),
+    "gce_pricing_api_key": Option(),
+    "warm_pool_refresh_interval": Option("int", minimum=10),
+    "egress_github_meta_keys": Option("list"),
+    "egress_github_meta_ttl": Option("int", minimum=60),
+    "instance_pricing_ttl": Option("int", minimum=60),
+    "instance_prices_file": Option(),
+    "image_signature_verification": Option(choices=VERIFICATION_MODES),
+    "cosign_public_keys": Option("list"),
+    "cosign_identities": Option("list", separator=";"),
+    "cosign_cache_ttl": Option("int", minimum=0),
+    "cosign_path": Option(),
+    "image_vulnerability_scan": Option(choices=VERIFICATION_MODES),
+    "vuln_fail_on": Option(choices=("negligible", "low", "medium", "high", "critical")),
+    "vuln_max_findings": Option("int", minimum=0),
+    "sbom_dir": Option(),
+    "vuln_cache_ttl": Option("int", minimum=0),
+    "syft_path": Option(),
+    "grype_path": Option(),
+    "egress_allowed_domains": Option("list"),
+    "egress_extra_domains": Option("list"),
+    "egress_allowed_ports": Option("list"),
+    "egress_proxy_url": Option(),
+    "egress_network": Option(),
+    "egress_proxy_port": Option("int", minimum=1),
+    "cache_proxy_url": Option(),
+    "cache_proxy_internal_url": Option(),
+    "registry_mirror": Option(),
+    "tool_cache_manifest": Option(),
+    "tool_cache_mount_path": Option(),
+    "tool_cache_seed_image": Option(),
+    "tool_cache_volume_prefix": Option(),
+    "tool_cache_refresh_interval": Option("int", minimum=60),
+    "image_prepull_enabled": Option("bool"),
+    "image_prepull_pin": Option("bool"),
+    "image_prepull_check_interval": Option("int", minimum=5),
+    "image_prepull_refresh_interval": Option("int", minimum=60),
+    "image_prepull_ssh_hosts": Option("list"),
+    "image_prepull_k8s_namespace": Option(),
+    "image_prepull_k8s_daemonset": Option(),
+    "image_prepull_k8s_node_selector": Option("list"),
+    "image_prepull_k8s_pause_image": Option(),
+    "work_queue_url": Option(),
+    "work_queue_name": Option(),
+    "work_queue_visibility_timeout": Option("int", minimum=10),
+    "work_queue_max_attempts": Option("int", minimum=1),
+    "work_queue_retry_base": Option("int", minimum=1),
+    "work_queue_concurrency": Option("int", minimum=1),
+    "work_queue_worker_id": Option(),
+    "webhook_dedup_ttl": Option("int", minimum=60),
+    "job_runner_ttl": Option("int", minimum=60),
+    "shard_id": Option(),
+    "shards": Option("list"),
+    "preemption_sources": Option("list"),
+    "preemption_check_interval": Option("int", minimum=1),
+    "preemption_k8s_node": Option(),
+    "outbound_webhooks_file": Option(),
+    "outbound_webhook_max_attempts": Option("int", minimum=1),
+    "outbound_webhook_retry_base": Option("int", minimum=1),
+    "outbound_webhook_log_size": Option("int", minimum=1),
+    "incident_required_labels": Option("list"),
+    "incident_check_interval": Option("int", minimum=1),
+    "incident_no_runners_grace": Option("int", minimum=0),
+    "incident_backend_failures": Option("int", minimum=1),
+}
+
+# Secretos: no se aceptan en el archivo, solo en variables de entorno o Vault
+SECRET_KEYS = ("github_runner_token", "github_app_private_key", "vault_secret_id", "vault_token", "state_encryption_keys")
+
+SECTION = "orchestrator"
+SECTIONS = ("shared", "orchestrator", "gateway")
+PROFILES_KEY = "profiles"
+
+# Secciones estructuradas del orchestrator que no son variables de entorno
+STRUCTURED_KEYS = ("pools", "runner_env", "feature_flags")
+
+# Pools definidos en el archivo (los usa load_pools si no hay RUNNER_POOLS_FILE)
+FILE_POOLS: Optional[List[Dict[str, Any]]] = None
+
+# Feature flags definidas en el archivo (las usa feature_flags si no hay FEATURE_FLAGS_FILE)
+FILE_FEATURE_FLAGS: Optional[Dict[str, Any]] = None
+
+
+def _env_name(key: str, option: Option) -> str:
+    return option.env or key.upper()
+
+
+def _unknown_key_error(section: str, key: str, known: Sequence[str]) -> str:
+    if key in SECRET_KEYS:
+        return (
+            f"{section}.{key}: es un secreto y no se admite en el archivo; "
+            f"usar la variable {key.upper()} o SECRETS_PROVIDER=vault"
+        )
+    suggestion = difflib.get_close_matches(key, known, n=1)
+    hint = f"; ¿quisiste decir '{suggestion[0]}'?" if suggestion else ""
+    return f"{section}.{key}: clave desconocida{hint}"
+
+
+def _read_file(path: str) -> Dict[str, Any]:
+    try:
+        with open(path, "r") as config_file:
+            data = yaml.safe_load(config_file) or {}
+    except OSError as e:
+        raise ConfigFileError([f"No se pudo leer CONFIG_FILE {path}: {e}"])
+    except yaml.YAMLError as e:
+        raise ConfigFileError([f"YAML inválido en {path}: {e}"])
+
+    if not isinstance(data, dict):
+        raise ConfigFileError([f"{path}: se esperaba un mapa con las secciones {', '.join(SECTIONS)}"])
+    return data
+
+
+def _merge(base: Dict[str, Any], override: Dict[str, Any]) -> Dict[str, Any]:
+    """Combina override sobre base: los mapas se fusionan, el resto se reemplaza."""
+    merged = dict(base)
+    for key, value in override.items():
+        if isinstance(value, dict) and isinstance(merged.get(key), dict):
+            merged[key] = _merge(merged[key], value)
+        else:
+            merged[key] = value
+    return merged
+
+
+def _apply_profile(data: Dict[str, Any], profile: str) -> Dict[str, Any]:
+    """
+    Aplica el perfil indicado (y los que hereda con 'extends') sobre las secciones base.
+
+    Raises:
+        ConfigFileError: Si el perfil no existe, la herencia es circular o tiene claves inválidas
+    """
+    profiles = data.get(PROFILES_KEY) or {}
+    if not isinstance(profiles, dict):
+        raise ConfigFileError([f"{PROFILES_KEY}: se esperaba un mapa nombre: perfil"])
+
+    chain: List[str] = []
+    name: Optional[str] = profile
+    while name:
+        if name in chain:
+            raise ConfigFileError([f"{PROFILES_KEY}: herencia circular: {' -> '.join(chain + [name])}"])
+        if name not in profiles:
+            suggestion = difflib.get_close_matches(name, list(profiles), n=1)
+            hint = f"; ¿quisiste decir '{suggestion[0]}'?" if suggestion else ""
+            raise ConfigFileError([f"Perfil desconocido '{name}'{hint}"])
+        spec = profiles[name] or {}
+        if not isinstance(spec, dict):
+            raise ConfigFileError([f"{PROFILES_KEY}.{name}: se esperaba un mapa con las secciones {', '.join(SECTIONS)}"])
+        errors = [
+            _unknown_key_error(f"{PROFILES_KEY}.{name}", str(key), SECTIONS + ("extends",))
+            for key in spec if key not in SECTIONS + ("extends",)
+        ]
+        if errors:
+            raise ConfigFileError(errors)
+        chain.append(name)
+        name = spec.get("extends")
+
+    merged = {section: data[section] for section in SECTIONS if section in data}
+    for name in reversed(chain):
+        overrides = {section: profiles[name][section] for section in SECTIONS if (profiles[name] or {}).get(section)}
+        merged = _merge(merged, overrides)
+    return merged
+
+
+def profile_from_args(argv: Sequence[str]) -> Optional[str]:
+    """Extrae --profile NOMBRE o --profile=NOMBRE de los argumentos de línea de comandos."""
+    for index, arg in enumerate(argv):
+        if arg == "--profile" and index + 1 < len(argv):
+            return argv[index + 1]
+        if arg.startswith("--profile="):
+            return arg.split("=", 1)[1]
+    return None
+
+
+def load_config_file(path: Optional[str] = None, profile: Optional[str] = None) -> Dict[str, str]:
+    """
+    Carga y valida la configuración del servicio.
+
+    Lee CONFIG_FILE (si existe), aplica el perfil CONFIG_PROFILE sobre las secciones
+    base, combina 'shared' y 'orchestrator', aplica las variables de entorno como
+    overrides y exporta el resultado a os.environ.
+    Las variables de entorno se validan igual que el archivo.
+
+    Returns:
+        Opciones efectivas como {VARIABLE: valor}
+
+    Raises:
+        ConfigFileError: Con todos los errores encontrados
+    """
+    global FILE_POOLS, FILE_FEATURE_FLAGS
+
+    path = path or os.getenv("CONFIG_FILE")
+    profile = profile or os.getenv("CONFIG_PROFILE")
+    data = _read_file(path) if path else {}
+    errors: List[str] = []
+
+    for section in data:
+        if section not in SECTIONS + (PROFILES_KEY,):
+            errors.append(_unknown_key_error("config", str(section), SECTIONS + (PROFILES_KEY,)))
+
+    if profile:
+        if not path:
+            raise ConfigFileError([f"CONFIG_PROFILE={profile} requiere CONFIG_FILE"])
+        data = _apply_profile(data, profile)
+        # Las recargas posteriores usan el mismo perfil
+        os.environ["CONFIG_PROFILE"] = profile
+
+    file_values: Dict[str, Any] = {}
+    for section, options in (("shared", SHARED_OPTIONS), (SECTION, {**SHARED_OPTIONS, **SERVICE_OPTIONS})):
+        values = data.get(section) or {}
+        if not isinstance(values, dict):
+            errors.append(f"{section}: se esperaba un mapa de opciones")
+            continue
+        known = list(options) + (list(STRUCTURED_KEYS) if section == SECTION else [])
+        for key, value in values.items():
+            if key in known:
+                file_values[key] = value
+            else:
+                errors.append(_unknown_key_error(section, str(key), known))
+
+    effective: Dict[str, str] = {}
+    for key, option in {**SHARED_OPTIONS, **SERVICE_OPTIONS}.items():
+        env_name = _env_name(key, option)
+        env_value = os.environ.get(env_name)
+        if env_value not in (None, ""):
+            source, value = f"variable {env_name}", env_value
+        elif file_values.get(key) is not None:
+            source, value = f"{SECTION if key in SERVICE_OPTIONS else 'shared'}.{key}", file_values[key]
+        else:
+            continue
+        try:
+            effective[env_name] = option.normalize(value)
+        except ValueError as e:
+            errors.append(f"{source}: {e}")
+
+    pools = file_values.get("pools")
+    if pools is not None and not isinstance(pools, list):
+        errors.append(f"{SECTION}.pools: se esperaba una lista de pools")
+
+    runner_env = file_values.get("runner_env") or {}
+    if not isinstance(runner_env, dict):
+        errors.append(f"{SECTION}.runner_env: se esperaba un mapa VARIABLE: valor")
+        runner_env = {}
+
+    feature_flags = file_values.get("feature_flags")
+    if feature_flags is not None and not isinstance(feature_flags, dict):
+        errors.append(f"{SECTION}.feature_flags: se esperaba un mapa flag: definición")
+
+    if errors:
+        raise ConfigFileError(errors)
+
+    os.environ.update(effective)
+    for name, value in runner_env.items():
+        # Equivalente a runnerenv_<NOMBRE>; la variable de entorno tiene prioridad
+        os.environ.setdefault(f"runnerenv_{name}", str(value))
+    FILE_POOLS = pools
+    FILE_FEATURE_FLAGS = feature_flags
+    return effective
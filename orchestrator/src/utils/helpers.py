@@ -11,6 +11,9 @@ import socket
 import time
 from typing import Any, Dict, Optional
 
+from src.utils.log_sinks import create_log_sinks
+from src.utils.redaction import SecretRedactor, install_log_redaction
+
 
 # ===== CONFIGURACIÓN Y LOGGING =====
 
@@ -22,7 +25,8 @@ LOG_CATEGORIES = {
     'SUCCESS': '✅ ÉXITO',
     'ERROR': '❌ ERROR',
     'WARNING': '⚠️ ADVERTENCIA',
-    'INFO': '📋 INFO'
+    'INFO': '📋 INFO',
+    'DRY_RUN': '🧪 SIMULACIÓN'
 }
 
 def format_log(category: str, action: str, detail: str = "") -> str:
@@ -37,8 +41,17 @@ def setup_logger(name: str) -> logging.Logger:
     return logging.getLogger(name)
 
 
-def setup_logging_config():
-    """Configura el logging básico para toda la aplicación."""
+# Redactor compartido por logs, salida de contenedores y endpoints de diagnóstico
+redactor = SecretRedactor(os.getenv("LOG_REDACT_PATTERNS"))
+
+
+def setup_logging_config(app_name: str = "gha-orchestrator"):
+    """
+    Configura el logging básico para toda la aplicación.
+
+    Args:
+        app_name: Identificador en syslog y journald (LOG_SYSLOG_APP_NAME lo reemplaza)
+    """
     import os
     
     # Obtener nivel de logging desde variable de entorno
@@ -67,12 +80,25 @@ def setup_logging_config():
     # Configurar handler para consola
     console_handler = logging.StreamHandler()
     console_handler.setFormatter(formatter)
-    
+
+    # Ocultar tokens y credenciales en cualquier salida de logging
+    install_log_redaction(redactor)
+
     # Configurar root logger
     root_logger = logging.getLogger()
     root_logger.setLevel(getattr(logging, log_level))
     root_logger.handlers.clear()  # Limpiar handlers existentes
-    root_logger.addHandler(console_handler)
+    # Consola por defecto; syslog y journald para hosts que agregan con rsyslog o el journal
+    sinks = create_log_sinks(
+        os.getenv("LOG_SINKS", "console"),
+        console_handler,
+        os.getenv("LOG_SYSLOG_APP_NAME", app_name),
+        LOG_CATEGORIES,
+        syslog_address=os.getenv("LOG_SYSLOG_ADDRESS", "/dev/log"),
+        facility=os.getenv("LOG_SYSLOG_FACILITY", "daemon"),
+    )
+    for handler in sinks:
+        root_logger.addHandler(handler)
     
     # Reducir verbosidad de librerías externas
     if not log_verbose:
@@ -154,6 +180,36 @@ class ConfigurationError(OrchestratorError):
     pass
 
 
+class ImageVerificationError(OrchestratorError):
+    """Imagen de runner sin firma válida."""
+    pass
+
+
+class ImageVulnerabilityError(ImageVerificationError):
+    """Imagen de runner con vulnerabilidades por encima del umbral."""
+    pass
+
+
+class QuotaExceededError(OrchestratorError):
+    """Cuota de runners de un tenant agotada."""
+    pass
+
+
+class BudgetExceededError(QuotaExceededError):
+    """Escalado congelado por el tope de gasto mensual de un tenant o pool."""
+    pass
+
+
+class PolicyRejectedError(OrchestratorError):
+    """Job rechazado por una política de JOB_POLICIES_FILE."""
+    pass
+
+
+class CapacityError(ValueError):
+    """Sin capacidad para colocar el runner (hosts llenos, drenados o caídos, o ninguna región disponible)."""
+    pass
+
+
 class ErrorHandler:
     """Manejador centralizado de errores."""
     
@@ -186,6 +242,12 @@ class ErrorHandler:
         elif isinstance(error, GitHubError):
             return HTTPException(status_code=502, detail=f"Error de GitHub API: {error}")
         
+        elif isinstance(error, (ImageVerificationError, PolicyRejectedError)):
+            return HTTPException(status_code=403, detail=str(error))
+        
+        elif isinstance(error, QuotaExceededError):
+            return HTTPException(status_code=429, detail=str(error))
+        
         elif isinstance(error, ConfigurationError):
             return HTTPException(status_code=500, detail=f"Error de configuración: {error}")
         
@@ -263,10 +325,17 @@ class PlaceholderResolver:
             "{repo_name}": self._extract_repo_name(scope_name),
             "{repo_full_name}": scope_name,
             "{user_login}": os.getenv("GITHUB_USER_LOGIN", "unknown"),
+            "{github_url}": self._github_url(),
         }
         
         return substitutions
     
+    def _github_url(self) -> str:
+        """URL web de GitHub o del GitHub Enterprise Server."""
+        # Import diferido: github_server depende de este módulo
+        from src.services.github_server import github_web_url
+        return github_web_url()
+
     def _extract_repo_owner(self, scope_name: str) -> str:
         """Extrae el owner del scope_name."""
         if "/" in scope_name:
@@ -305,6 +374,7 @@ class PlaceholderResolver:
             "{repo_name}": "Nombre del repo sin owner (ej: hello-ci)",
             "{repo_full_name}": "Nombre completo del repo (ej: eliaspizarro/hello-ci)",
             "{user_login}": "Username del token",
+            "{github_url}": "URL web de GitHub o GHES (ej: https://github.com)",
         }
     
     def validate_template(self, template: str) -> Dict[str, Any]:
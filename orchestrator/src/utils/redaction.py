@@ -0,0 +1 @@
+../../../shared/redaction.py
\ No newline at end of file
@@ -0,0 +1,115 @@
+"""Cifrado en reposo de cada almacén del orchestrator y rotación de la clave."""
+
+import base64
+import json
+import os
+import shutil
+import sqlite3
+import tempfile
+import unittest
+from unittest import mock
+
+from src.services import encryption
+from src.services.encryption import PREFIX, rotate_state
+from src.services.outbound_webhooks import OutboundWebhooks
+from src.services.outbox import EventOutbox
+from src.services.tenants import TenantRegistry
+from src.services.usage import UsageLedger
+from src.utils.helpers import ConfigurationError
+
+
+def _key() -> str:
+    return base64.b64encode(os.urandom(32)).decode("ascii")
+
+
+class EncryptedStoreTest(unittest.TestCase):
+    def setUp(self):
+        self.dir = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, self.dir)
+        self.key = _key()
+        self._use(f"k1={self.key}")
+
+    def _use(self, keys: str, mode: str = "local"):
+        """Cambia la configuración y fuerza a crear de nuevo el cifrado compartido."""
+        patcher = mock.patch.dict(os.environ, {"STATE_ENCRYPTION": mode, "STATE_ENCRYPTION_KEYS": keys})
+        patcher.start()
+        self.addCleanup(patcher.stop)
+        encryption._cipher_loaded = False
+        self.addCleanup(setattr, encryption, "_cipher_loaded", False)
+
+    def _path(self, name: str) -> str:
+        return os.path.join(self.dir, name)
+
+    def test_outbound_webhook_secret(self):
+        path = self._path("webhooks.json")
+        webhooks = OutboundWebhooks(path)
+        secret = webhooks.register("https://hooks.example.com", ["runner.*"])["secret"]
+
+        with open(path) as state:
+            stored = json.load(state)["webhooks"][0]
+        self.assertTrue(stored["secret"].startswith(PREFIX))
+        self.assertNotIn(secret, json.dumps(stored))
+        self.assertEqual(list(OutboundWebhooks(path).webhooks.values())[0]["secret"], secret)
+
+    def test_tenants_file(self):
+        path = self._path("tenants.json")
+        with open(path, "w") as state:
+            json.dump({"tenants": [{"name": "acme", "owners": ["acme"], "pools": [], "webhooks": {}}]}, state)
+
+        TenantRegistry(path).reencrypt()
+
+        with open(path) as state:
+            self.assertTrue(state.read().startswith(PREFIX))
+        self.assertEqual(list(TenantRegistry(path).tenants), ["acme"])
+
+    def test_outbox_payload(self):
+        path = self._path("outbox.db")
+        EventOutbox(path).add([("webhooks", "d1", {"repo": "acme/api"})])
+
+        payload = sqlite3.connect(path).execute("SELECT payload FROM outbox").fetchone()[0]
+        self.assertTrue(payload.startswith(PREFIX))
+        self.assertEqual(EventOutbox(path).pending("webhooks"), [("d1", {"repo": "acme/api"}, 0)])
+
+    def test_usage_ledger_columns(self):
+        path = self._path("usage.db")
+        ledger = UsageLedger(path, {})
+        ledger._record_job({"job_id": 5, "repository": "acme/api", "workflow": "ci", "runner_name": "r1"}, 1e9)
+
+        repository, workflow = sqlite3.connect(path).execute("SELECT repository, workflow FROM jobs").fetchone()
+        self.assertTrue(repository.startswith(PREFIX))
+        self.assertTrue(workflow.startswith(PREFIX))
+        self.assertEqual(UsageLedger(path, {}).jobs_between(0, 2e9)[0][2:4], ("acme/api", "ci"))
+
+    def test_missing_configuration(self):
+        path = self._path("outbox.db")
+        EventOutbox(path).add([("webhooks", "d1", {})])
+        self._use("", mode="none")
+
+        with self.assertRaises(ConfigurationError):
+            EventOutbox(path).pending("webhooks")
+
+    def test_rotation(self):
+        paths = {
+            "OUTBOUND_WEBHOOKS_FILE": self._path("webhooks.json"),
+            "TENANTS_FILE": self._path("tenants.json"),
+            "EVENTS_OUTBOX_PATH": self._path("outbox.db"),
+        }
+        secret = OutboundWebhooks(paths["OUTBOUND_WEBHOOKS_FILE"]).register("https://hooks.example.com", ["runner.*"])["secret"]
+        EventOutbox(paths["EVENTS_OUTBOX_PATH"]).add([("webhooks", "d1", {"repo": "acme/api"})])
+        with open(paths["TENANTS_FILE"], "w") as state:
+            json.dump({"tenants": [{"name": "acme"}]}, state)
+
+        self._use(f"k2={_key()},k1={self.key}")
+        with mock.patch.dict(os.environ, paths):
+            rotated = rotate_state()
+        self.assertEqual(rotated, {"outbound_webhooks": 1, "tenants": 1, "outbox": 1})
+
+        # Sin la clave anterior todo se sigue leyendo
+        self._use(os.environ["STATE_ENCRYPTION_KEYS"].split(",")[0])
+        self.assertEqual(list(OutboundWebhooks(paths["OUTBOUND_WEBHOOKS_FILE"]).webhooks.values())[0]["secret"], secret)
+        self.assertEqual(list(TenantRegistry(paths["TENANTS_FILE"]).tenants), ["acme"])
+        self.assertEqual(EventOutbox(paths["EVENTS_OUTBOX_PATH"]).pending("webhooks")[0][1], {"repo": "acme/api"})
+
+
+if __name__ == "__main__":
+    unittest.main()
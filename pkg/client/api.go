@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ===== Runners =====
+
+// Runners recorre los runners activos (solo los de sus tenants con credenciales de tenant).
+func (c *Client) Runners(ctx context.Context, filter RunnerFilter) *Iterator[Runner] {
+	query := url.Values{}
+	for key, value := range map[string]string{"state": filter.State, "health": filter.Health, "pool": filter.Pool, "repo": filter.Repo, "sort": filter.Sort} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	for _, label := range filter.Labels {
+		query.Add("label", label)
+	}
+	return List[Runner](ctx, c, c.path("/runners"), query)
+}
+
+// GetRunner devuelve el estado de un runner.
+func (c *Client) GetRunner(ctx context.Context, id string) (Runner, error) {
+	var runner Runner
+	err := c.Do(ctx, http.MethodGet, c.path("/runners/%s", url.PathEscape(id)), nil, &runner)
+	return runner, err
+}
+
+// CreateRunners crea request.Count runners efímeros.
+func (c *Client) CreateRunners(ctx context.Context, request RunnerRequest) ([]CreatedRunner, error) {
+	if request.Count == 0 {
+		request.Count = 1
+	}
+	var created []CreatedRunner
+	err := c.Do(ctx, http.MethodPost, c.path("/runners"), request, &created)
+	return created, err
+}
+
+// DestroyRunner destruye un runner (con dryRun el orchestrator solo registra la destrucción).
+func (c *Client) DestroyRunner(ctx context.Context, id string, dryRun bool) error {
+	path := c.path("/runners/%s", url.PathEscape(id))
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// ===== Pools =====
+
+// Pools recorre los pools configurados, incluidos los retirados.
+func (c *Client) Pools(ctx context.Context) *Iterator[Pool] {
+	return List[Pool](ctx, c, c.path("/pools"), nil)
+}
+
+// RetirePool retira un pool: deja de aceptar runners y conserva su definición.
+func (c *Client) RetirePool(ctx context.Context, name, reason string) (RetiredPool, error) {
+	var retired RetiredPool
+	err := c.Do(ctx, http.MethodPost, c.path("/pools/%s/retire", url.PathEscape(name)), map[string]string{"reason": reason}, &retired)
+	return retired, err
+}
+
+// RestorePool vuelve a aceptar runners en un pool retirado.
+func (c *Client) RestorePool(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodPost, c.path("/pools/%s/restore", url.PathEscape(name)), nil, nil)
+}
+
+// PoolSnapshots recorre los snapshots de pools (de uno solo si pool no está vacío).
+func (c *Client) PoolSnapshots(ctx context.Context, pool string) *Iterator[PoolSnapshot] {
+	query := url.Values{}
+	if pool != "" {
+		query.Set("pool", pool)
+	}
+	return List[PoolSnapshot](ctx, c, c.path("/pools/snapshots"), query)
+}
+
+// CreatePoolSnapshot guarda la definición actual de un pool.
+func (c *Client) CreatePoolSnapshot(ctx context.Context, pool, note string) (PoolSnapshot, error) {
+	var snapshot PoolSnapshot
+	err := c.Do(ctx, http.MethodPost, c.path("/pools/%s/snapshots", url.PathEscape(pool)), map[string]string{"note": note}, &snapshot)
+	return snapshot, err
+}
+
+// RestorePoolSnapshot crea un pool desde un snapshot, con su nombre original o clonado con name.
+func (c *Client) RestorePoolSnapshot(ctx context.Context, snapshotID, name string) (Pool, error) {
+	body := map[string]string{}
+	if name != "" {
+		body["name"] = name
+	}
+	var pool Pool
+	err := c.Do(ctx, http.MethodPost, c.path("/pools/snapshots/%s/restore", url.PathEscape(snapshotID)), body, &pool)
+	return pool, err
+}
+
+// ResourceClasses devuelve las clases de recursos que un job elige con un label size-*.
+func (c *Client) ResourceClasses(ctx context.Context) ([]ResourceClass, error) {
+	return List[ResourceClass](ctx, c, c.path("/resource-classes"), nil).All()
+}
+
+// Regions devuelve las regiones de los pools multi-región con su preferencia y enfriamiento.
+func (c *Client) Regions(ctx context.Context) ([]Region, error) {
+	return List[Region](ctx, c, c.path("/regions"), nil).All()
+}
+
+// ===== Operaciones masivas =====
+
+// SubmitBulkOperation envía una operación masiva; avanza en segundo plano.
+func (c *Client) SubmitBulkOperation(ctx context.Context, request BulkOperationRequest) (BulkOperation, error) {
+	var operation BulkOperation
+	err := c.Do(ctx, http.MethodPost, c.path("/bulk"), request, &operation)
+	return operation, err
+}
+
+// BulkOperations recorre las operaciones masivas en curso y recientes (de un estado si status no está vacío).
+func (c *Client) BulkOperations(ctx context.Context, status string) *Iterator[BulkOperation] {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	return List[BulkOperation](ctx, c, c.path("/bulk"), query)
+}
+
+// GetBulkOperation devuelve el progreso de una operación (con items, el resultado de cada ítem).
+func (c *Client) GetBulkOperation(ctx context.Context, id string, items bool) (BulkOperation, error) {
+	path := c.path("/bulk/%s", url.PathEscape(id))
+	if items {
+		path += "/items"
+	}
+	var operation BulkOperation
+	err := c.Do(ctx, http.MethodGet, path, nil, &operation)
+	return operation, err
+}
+
+// WaitBulkOperation consulta la operación cada interval hasta que termina y la devuelve con sus ítems.
+func (c *Client) WaitBulkOperation(ctx context.Context, id string, interval time.Duration) (BulkOperation, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		operation, err := c.GetBulkOperation(ctx, id, false)
+		if err != nil {
+			return operation, err
+		}
+		if operation.Finished() {
+			return c.GetBulkOperation(ctx, id, true)
+		}
+		select {
+		case <-ctx.Done():
+			return operation, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ===== Imágenes de runners =====
+
+// SubmitImageBuild lanza una construcción de IMAGE_BUILDS_FILE; avanza en segundo plano.
+func (c *Client) SubmitImageBuild(ctx context.Context, request ImageBuildRequest) (ImageBuild, error) {
+	var build ImageBuild
+	err := c.Do(ctx, http.MethodPost, c.path("/images/builds"), request, &build)
+	return build, err
+}
+
+// ImageBuilds recorre las construcciones de imagen (de una sola si name no está vacío).
+func (c *Client) ImageBuilds(ctx context.Context, name string) *Iterator[ImageBuild] {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	return List[ImageBuild](ctx, c, c.path("/images/builds"), query)
+}
+
+// GetImageBuild devuelve una construcción con sus digests, el Dockerfile y el log de buildx.
+func (c *Client) GetImageBuild(ctx context.Context, id string) (ImageBuild, error) {
+	var build ImageBuild
+	err := c.Do(ctx, http.MethodGet, c.path("/images/builds/%s", url.PathEscape(id)), nil, &build)
+	return build, err
+}
+
+// ImageRollouts recorre los despliegues de imagen (de un pool si pool no está vacío).
+func (c *Client) ImageRollouts(ctx context.Context, pool string) *Iterator[ImageRollout] {
+	query := url.Values{}
+	if pool != "" {
+		query.Set("pool", pool)
+	}
+	return List[ImageRollout](ctx, c, c.path("/images/rollouts"), query)
+}
+
+// StartImageRollout despliega por pasos en un pool la imagen de una construcción terminada.
+func (c *Client) StartImageRollout(ctx context.Context, pool, buildID string) (ImageRollout, error) {
+	var rollout ImageRollout
+	err := c.Do(ctx, http.MethodPost, c.path("/images/rollouts"), map[string]string{"pool": pool, "build": buildID}, &rollout)
+	return rollout, err
+}
+
+// RollbackImageRollout devuelve el pool a su imagen anterior (despliegue en curso o completado).
+func (c *Client) RollbackImageRollout(ctx context.Context, pool, reason string) (ImageRollout, error) {
+	var rollout ImageRollout
+	err := c.Do(ctx, http.MethodPost, c.path("/images/rollouts/%s/rollback", url.PathEscape(pool)), map[string]string{"reason": reason}, &rollout)
+	return rollout, err
+}
+
+// ===== Cambios blue/green =====
+
+// Cutovers recorre los cambios blue/green (en un estado si status no está vacío).
+func (c *Client) Cutovers(ctx context.Context, status string) *Iterator[Cutover] {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	return List[Cutover](ctx, c, c.path("/cutovers"), query)
+}
+
+// GetCutover devuelve un cambio blue/green con su paso y tasas de fallo.
+func (c *Client) GetCutover(ctx context.Context, id string) (Cutover, error) {
+	var cutover Cutover
+	err := c.Do(ctx, http.MethodGet, c.path("/cutovers/%s", url.PathEscape(id)), nil, &cutover)
+	return cutover, err
+}
+
+// StartCutover crea los pools verdes y empieza a desplazar hacia ellos los runners por pasos.
+func (c *Client) StartCutover(ctx context.Context, request CutoverRequest) (Cutover, error) {
+	var cutover Cutover
+	err := c.Do(ctx, http.MethodPost, c.path("/cutovers"), request, &cutover)
+	return cutover, err
+}
+
+// RollbackCutover retira los pools verdes y, si el cambio se había completado, restaura los azules.
+func (c *Client) RollbackCutover(ctx context.Context, id, reason string) (Cutover, error) {
+	var cutover Cutover
+	err := c.Do(ctx, http.MethodPost, c.path("/cutovers/%s/rollback", url.PathEscape(id)), map[string]string{"reason": reason}, &cutover)
+	return cutover, err
+}
+
+// ===== Hosts Docker =====
+
+// DockerHosts devuelve los hosts Docker del backend docker (DOCKER_HOSTS_FILE) con su capacidad y estado.
+func (c *Client) DockerHosts(ctx context.Context) ([]DockerHost, error) {
+	return List[DockerHost](ctx, c, c.path("/docker-hosts"), nil).All()
+}
+
+// DrainDockerHost deja un host sin runners nuevos para mantenimiento; con evictIdle destruye ya sus runners libres.
+func (c *Client) DrainDockerHost(ctx context.Context, name, reason string, evictIdle bool) (DockerHost, error) {
+	var host DockerHost
+	body := map[string]any{"reason": reason, "evict_idle": evictIdle}
+	err := c.Do(ctx, http.MethodPost, c.path("/docker-hosts/%s/drain", url.PathEscape(name)), body, &host)
+	return host, err
+}
+
+// UndrainDockerHost devuelve un host vaciado al servicio.
+func (c *Client) UndrainDockerHost(ctx context.Context, name string) (DockerHost, error) {
+	var host DockerHost
+	err := c.Do(ctx, http.MethodPost, c.path("/docker-hosts/%s/undrain", url.PathEscape(name)), nil, &host)
+	return host, err
+}
+
+// ===== Reconciliación y administración =====
+
+// ReconcileStatus devuelve el drift de la última reconciliación de runners.
+func (c *Client) ReconcileStatus(ctx context.Context) (map[string]any, error) {
+	var status map[string]any
+	err := c.Do(ctx, http.MethodGet, c.path("/reconcile"), nil, &status)
+	return status, err
+}
+
+// Reconcile ejecuta una reconciliación ahora (con dryRun solo detecta el drift).
+func (c *Client) Reconcile(ctx context.Context, dryRun bool) (map[string]any, error) {
+	var status map[string]any
+	err := c.Do(ctx, http.MethodPost, c.path("/reconcile?dry_run=%t", dryRun), nil, &status)
+	return status, err
+}
+
+// Reload recarga pools, feature flags y políticas en el orchestrator.
+func (c *Client) Reload(ctx context.Context) (map[string]any, error) {
+	var changes map[string]any
+	err := c.Do(ctx, http.MethodPost, c.path("/admin/reload"), nil, &changes)
+	return changes, err
+}
+
+// Whoami devuelve la identidad y el rol con que el gateway reconoce al cliente.
+func (c *Client) Whoami(ctx context.Context) (Identity, error) {
+	var identity Identity
+	err := c.Do(ctx, http.MethodGet, c.path("/auth/whoami"), nil, &identity)
+	return identity, err
+}
+
+// Versions devuelve las versiones del API que sirve el gateway.
+func (c *Client) Versions(ctx context.Context) ([]APIVersion, error) {
+	return List[APIVersion](ctx, c, c.path("/versions"), nil).All()
+}
@@ -0,0 +1,306 @@
+// Package client es el SDK en Go del API de administración del API Gateway: runners,
+// pools, operaciones masivas, reconciliación y administración, con tipos para cada
+// petición y respuesta, autenticación por API key o token OIDC, reintentos de las
+// peticiones idempotentes e iteradores que recorren los listados página a página:
+//
+//	c := client.New("https://gha.example.com", client.WithAPIKey(os.Getenv("GHA_API_KEY")))
+//	runners := c.Runners(ctx, client.RunnerFilter{Pool: "gpu"})
+//	for runners.Next() {
+//		fmt.Println(runners.Value().RunnerID)
+//	}
+//	if err := runners.Err(); err != nil { ... }
+//
+// Habla con /api/v2 (ver WithAPIVersion). Los endpoints sin método propio se llaman
+// con Do, que aplica la misma autenticación, reintentos y decodificación de errores.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIVersion es la versión del API que usan los métodos del SDK.
+const DefaultAPIVersion = "v2"
+
+// envelope es el envoltorio estándar de las respuestas del API Gateway.
+type envelope struct {
+	Status  string          `json:"status"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+	// FastAPI responde los errores de validación (422) con detail
+	Detail json.RawMessage `json:"detail"`
+}
+
+// APIError es una respuesta de error del gateway.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter es el tiempo indicado por el gateway en 429 y 503 (cero si no lo indica).
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("error %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound indica si err es un 404 del gateway.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Deprecation describe el aviso de versión obsoleta de una respuesta (cabeceras
+// Deprecation, Sunset y Link).
+type Deprecation struct {
+	Version   string
+	Sunset    string
+	Successor string
+}
+
+// Client es un cliente del API Gateway; es seguro usarlo desde varias goroutines.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	token      string
+	version    string
+	userAgent  string
+	http       *http.Client
+	maxRetries int
+	backoff    time.Duration
+	pageSize   int
+	// onDeprecation se llama con cada respuesta de una versión obsoleta
+	onDeprecation func(Deprecation)
+}
+
+// Option configura un Client.
+type Option func(*Client)
+
+// WithAPIKey autentica con una API key (cabecera X-API-Key).
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken autentica con un token OIDC (Authorization: Bearer).
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient reemplaza el http.Client (timeouts, proxy, TLS).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.http = httpClient }
+}
+
+// WithRetries fija los reintentos de las peticiones idempotentes ante errores de red,
+// 429, 502, 503 y 504, con espera exponencial desde backoff (o Retry-After).
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithPageSize fija los elementos por página de los iteradores (el gateway limita el
+// máximo con LIST_MAX_LIMIT); sin fijar se usa LIST_DEFAULT_LIMIT.
+func WithPageSize(size int) Option {
+	return func(c *Client) { c.pageSize = size }
+}
+
+// WithAPIVersion cambia la versión del API de los métodos del SDK (por defecto v2).
+func WithAPIVersion(version string) Option {
+	return func(c *Client) { c.version = version }
+}
+
+// WithUserAgent identifica a la herramienta; el gateway registra por User-Agent a los
+// clientes que usan versiones obsoletas.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithDeprecationHandler recibe los avisos de versión obsoleta del gateway.
+func WithDeprecationHandler(handler func(Deprecation)) Option {
+	return func(c *Client) { c.onDeprecation = handler }
+}
+
+// New crea un cliente para el gateway en baseURL (p. ej. https://gha.example.com).
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		version:    DefaultAPIVersion,
+		userAgent:  "gha-runners-go-client",
+		http:       &http.Client{Timeout: 60 * time.Second},
+		maxRetries: 3,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// path arma la ruta de un endpoint en la versión del cliente.
+func (c *Client) path(format string, args ...any) string {
+	return "/api/" + c.version + fmt.Sprintf(format, args...)
+}
+
+// RequestOption ajusta una petición hecha con Do.
+type RequestOption func(*http.Request)
+
+// WithHeader agrega una cabecera a la petición.
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) { req.Header.Set(key, value) }
+}
+
+// Do envía una petición a path (ruta completa, p. ej. /api/v2/forecast) y decodifica el
+// campo data de la respuesta en out si no es nil. body puede ser nil, []byte (se envía
+// tal cual) o cualquier valor serializable a JSON.
+func (c *Client) Do(ctx context.Context, method, path string, body, out any, options ...RequestOption) error {
+	var payload []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		payload = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		payload = encoded
+	}
+
+	retries := 0
+	if idempotent(method) {
+		retries = c.maxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, method, path, payload, body != nil, out, options)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+		wait := c.backoff << attempt
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		// Jitter para que varios clientes no reintenten a la vez
+		wait += time.Duration(rand.Int63n(int64(wait)/4 + 1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload []byte, hasBody bool, out any, options []RequestOption) error {
+	var reader io.Reader
+	if hasBody {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if hasBody {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	for _, option := range options {
+		option(req)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	c.notifyDeprecation(resp)
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var body envelope
+	if err := json.Unmarshal(raw, &body); err != nil {
+		if resp.StatusCode >= 300 {
+			return newAPIError(resp, strings.TrimSpace(string(raw)))
+		}
+		return fmt.Errorf("respuesta inválida del gateway: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		message := body.Message
+		if len(body.Detail) > 0 {
+			message = strings.Trim(string(body.Detail), `"`)
+		}
+		return newAPIError(resp, message)
+	}
+	if out != nil && len(body.Data) > 0 {
+		return json.Unmarshal(body.Data, out)
+	}
+	return nil
+}
+
+func newAPIError(resp *http.Response, message string) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: message}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func (c *Client) notifyDeprecation(resp *http.Response) {
+	if c.onDeprecation == nil || resp.Header.Get("Deprecation") == "" {
+		return
+	}
+	// Link puede traer también rel="next" en los listados paginados
+	var successor string
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		start, end := strings.Index(link, "<"), strings.Index(link, ">")
+		if start >= 0 && end > start && strings.Contains(link[end:], `rel="successor-version"`) {
+			successor = link[start+1 : end]
+		}
+	}
+	c.onDeprecation(Deprecation{
+		Version:   resp.Header.Get("API-Version"),
+		Sunset:    resp.Header.Get("Sunset"),
+		Successor: successor,
+	})
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// Errores de red (conexión rechazada, timeout); no los de contexto cancelado
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// page es una página de un listado en v2: {"items": [...], "count": n, "total": n, "next_cursor": "..."}.
+type page[T any] struct {
+	Items      []T    `json:"items"`
+	Count      int    `json:"count"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// Iterator recorre un listado pidiendo la página siguiente (next_cursor) cuando se
+// agota la actual. Se usa con Next, Value y Err, o se recoge entero con All.
+type Iterator[T any] struct {
+	ctx    context.Context
+	client *Client
+	path   string
+	query  url.Values
+
+	items   []T
+	index   int
+	cursor  string
+	started bool
+	done    bool
+	total   int
+	err     error
+	current T
+}
+
+// List recorre un listado sin método propio; path es la ruta completa (p. ej.
+// /api/v2/pools/snapshots) y query sus filtros (state, pool, repo, label) y orden (sort).
+func List[T any](ctx context.Context, c *Client, path string, query url.Values) *Iterator[T] {
+	if query == nil {
+		query = url.Values{}
+	}
+	return &Iterator[T]{ctx: ctx, client: c, path: path, query: query}
+}
+
+// Next avanza al siguiente elemento; devuelve false al terminar o ante un error (ver Err).
+func (it *Iterator[T]) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		if it.index < len(it.items) {
+			it.current = it.items[it.index]
+			it.index++
+			return true
+		}
+		if it.done || (it.started && it.cursor == "") {
+			return false
+		}
+		it.fetch()
+	}
+}
+
+func (it *Iterator[T]) fetch() {
+	query := url.Values{}
+	for key, values := range it.query {
+		query[key] = values
+	}
+	if it.cursor != "" {
+		query.Set("cursor", it.cursor)
+	}
+	if it.client.pageSize > 0 && query.Get("limit") == "" {
+		query.Set("limit", strconv.Itoa(it.client.pageSize))
+	}
+	path := it.path
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+
+	var raw json.RawMessage
+	it.started = true
+	if err := it.client.Do(it.ctx, http.MethodGet, path, nil, &raw); err != nil {
+		it.err = err
+		return
+	}
+	var current page[T]
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		// v1 devuelve los listados como un array (el cursor va en X-Next-Cursor y no se sigue)
+		it.err = json.Unmarshal(trimmed, &current.Items)
+		current.Total = len(current.Items)
+	} else if len(raw) > 0 {
+		it.err = json.Unmarshal(raw, &current)
+	}
+	it.items, it.index, it.cursor, it.total = current.Items, 0, current.NextCursor, current.Total
+	it.done = current.NextCursor == ""
+}
+
+// Total devuelve los elementos que cumplen los filtros en todas las páginas, según la
+// última página recibida (cero antes de la primera).
+func (it *Iterator[T]) Total() int {
+	return it.total
+}
+
+// Value devuelve el elemento actual (tras un Next que devolvió true).
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err devuelve el error que detuvo el recorrido, si lo hubo.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All recorre el listado completo y devuelve todos sus elementos.
+func (it *Iterator[T]) All() ([]T, error) {
+	var all []T
+	for it.Next() {
+		all = append(all, it.Value())
+	}
+	return all, it.Err()
+}
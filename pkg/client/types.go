@@ -0,0 +1,323 @@
+package client
+
+import "encoding/json"
+
+// Runner es el estado de un runner tal como lo reporta el orchestrator.
+type Runner struct {
+	Status      string            `json:"status"`
+	RunnerID    string            `json:"runner_id"`
+	ContainerID string            `json:"container_id"`
+	Image       string            `json:"image"`
+	Created     string            `json:"created"`
+	Labels      map[string]string `json:"labels"`
+	// Health es el estado del HEALTHCHECK de la imagen (starting, healthy, unhealthy), si lo define
+	Health string `json:"health,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Pool devuelve el pool del runner (label runner-pool del contenedor).
+func (r Runner) Pool() string {
+	if pool := r.Labels["runner-pool"]; pool != "" {
+		return pool
+	}
+	return "default"
+}
+
+// RunnerRequest es el cuerpo de POST /runners.
+type RunnerRequest struct {
+	Scope       string   `json:"scope"`
+	ScopeName   string   `json:"scope_name"`
+	RunnerName  string   `json:"runner_name,omitempty"`
+	RunnerGroup string   `json:"runner_group,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Pool        string   `json:"pool,omitempty"`
+	Count       int      `json:"count"`
+	DryRun      bool     `json:"dry_run,omitempty"`
+	// ResourceClass es la clase de recursos (small, medium, large, xl...); vacía usa el label size-* o la del pool
+	ResourceClass string `json:"resource_class,omitempty"`
+}
+
+// CreatedRunner es el resultado de cada runner pedido en POST /runners.
+type CreatedRunner struct {
+	RunnerID string `json:"runner_id"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+}
+
+// RunnerFilter limita y ordena el listado de runners; los campos vacíos no filtran.
+type RunnerFilter struct {
+	State string
+	// Health es el estado del HEALTHCHECK (starting, healthy, unhealthy)
+	Health string
+	Pool   string
+	Repo   string
+	// Labels del contenedor (key o key=value); deben cumplirse todas
+	Labels []string
+	// Sort es created, runner_id, status o pool; descendente con '-' delante
+	Sort string
+}
+
+// Pool es la definición de un pool de runners. Los campos de backends concretos
+// (ecs, azure, gce, ssh) quedan en la respuesta cruda de Do si se necesitan.
+type Pool struct {
+	Name         string          `json:"name"`
+	Labels       []string        `json:"labels"`
+	Image        string          `json:"image"`
+	RunnerGroup  string          `json:"runner_group"`
+	Backend      string          `json:"backend"`
+	EnableDind   bool            `json:"enable_dind"`
+	Tenant       string          `json:"tenant"`
+	Priority     bool            `json:"priority"`
+	Prewarm      json.RawMessage `json:"prewarm,omitempty"`
+	Retired      bool            `json:"retired,omitempty"`
+	Capabilities []string        `json:"capabilities,omitempty"`
+}
+
+// RetiredPool es un pool retirado con el snapshot automático de su definición.
+type RetiredPool struct {
+	Name          string          `json:"name"`
+	Reason        string          `json:"reason"`
+	RetiredBy     string          `json:"retired_by"`
+	RetiredAt     string          `json:"retired_at"`
+	Snapshot      string          `json:"snapshot"`
+	Spec          json.RawMessage `json:"spec"`
+	ActiveRunners int             `json:"active_runners"`
+}
+
+// PoolSnapshot es la definición guardada de un pool.
+type PoolSnapshot struct {
+	ID        string          `json:"id"`
+	Pool      string          `json:"pool"`
+	Spec      json.RawMessage `json:"spec"`
+	Note      string          `json:"note"`
+	CreatedBy string          `json:"created_by"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// Tipos de operación masiva.
+const (
+	BulkDrainPools     = "drain_pools"
+	BulkRecycleRunners = "recycle_runners"
+	BulkRetagPools     = "retag_pools"
+)
+
+// BulkOperationRequest es el cuerpo de POST /bulk.
+type BulkOperationRequest struct {
+	Kind         string   `json:"kind"`
+	Pools        []string `json:"pools,omitempty"`
+	OlderThan    int      `json:"older_than,omitempty"`
+	Retire       bool     `json:"retire,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+	AddLabels    []string `json:"add_labels,omitempty"`
+	RemoveLabels []string `json:"remove_labels,omitempty"`
+	DryRun       bool     `json:"dry_run,omitempty"`
+}
+
+// BulkProgress es el avance de una operación masiva.
+type BulkProgress struct {
+	Total     int `json:"total"`
+	Done      int `json:"done"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// BulkItem es el resultado de un ítem (pool o runner) de una operación masiva.
+type BulkItem struct {
+	Item   string          `json:"item"`
+	Status string          `json:"status"`
+	Detail json.RawMessage `json:"detail"`
+	Shard  string          `json:"shard,omitempty"`
+}
+
+// BulkOperation es una operación masiva; Items solo viene en GetBulkOperation con items.
+type BulkOperation struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Params      json.RawMessage `json:"params"`
+	Status      string          `json:"status"`
+	SubmittedBy string          `json:"submitted_by"`
+	SubmittedAt string          `json:"submitted_at"`
+	StartedAt   string          `json:"started_at"`
+	FinishedAt  string          `json:"finished_at"`
+	Progress    BulkProgress    `json:"progress"`
+	Items       []BulkItem      `json:"items,omitempty"`
+}
+
+// Finished indica si la operación ya no avanza.
+func (o BulkOperation) Finished() bool {
+	return o.Status != "pending" && o.Status != "running"
+}
+
+// ImageBuildRequest es el cuerpo de POST /images/builds.
+type ImageBuildRequest struct {
+	Name string `json:"name"`
+	// Rollout despliega la imagen en los pools al terminar (por defecto en el gateway)
+	Rollout *bool `json:"rollout,omitempty"`
+	// Pools reemplaza los pools de la construcción
+	Pools []string `json:"pools,omitempty"`
+}
+
+// ImageBuild es una construcción de imagen de runners; Dockerfile y Log solo vienen en GetImageBuild.
+type ImageBuild struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Base            string            `json:"base"`
+	Repository      string            `json:"repository"`
+	Image           string            `json:"image"`
+	Platforms       []string          `json:"platforms"`
+	Tools           map[string]string `json:"tools"`
+	Pools           []string          `json:"pools"`
+	Status          string            `json:"status"`
+	RequestedBy     string            `json:"requested_by"`
+	RequestedAt     string            `json:"requested_at"`
+	StartedAt       string            `json:"started_at"`
+	FinishedAt      string            `json:"finished_at"`
+	Digest          string            `json:"digest"`
+	PlatformDigests map[string]string `json:"platform_digests"`
+	Error           string            `json:"error"`
+	Dockerfile      string            `json:"dockerfile,omitempty"`
+	Log             []string          `json:"log,omitempty"`
+}
+
+// Finished indica si la construcción ya no avanza.
+func (b ImageBuild) Finished() bool {
+	return b.Status == "succeeded" || b.Status == "failed"
+}
+
+// CanaryCounters son los runners canario de un despliegue y cuántos fallaron.
+type CanaryCounters struct {
+	Runners int `json:"runners"`
+	Failed  int `json:"failed"`
+}
+
+// ImageRollout es el despliegue por pasos de una imagen en un pool.
+type ImageRollout struct {
+	ID           string          `json:"id"`
+	Pool         string          `json:"pool"`
+	Image        string          `json:"image"`
+	Previous     string          `json:"previous"`
+	Build        string          `json:"build"`
+	Policy       json.RawMessage `json:"policy"`
+	Status       string          `json:"status"`
+	Step         int             `json:"step"`
+	Weight       int             `json:"weight"`
+	StartedBy    string          `json:"started_by"`
+	StartedAt    string          `json:"started_at"`
+	FinishedAt   string          `json:"finished_at"`
+	Reason       string          `json:"reason"`
+	Canaries     CanaryCounters  `json:"canaries"`
+	StepCanaries CanaryCounters  `json:"step_canaries"`
+}
+
+// CutoverPools es un pool del conjunto actual (azul) y su pool paralelo (verde).
+type CutoverPools struct {
+	Blue     string `json:"blue"`
+	Green    string `json:"green"`
+	Snapshot string `json:"snapshot"`
+}
+
+// CutoverRequest es el cuerpo de POST /cutovers; Policy vacía usa FLEET_CUTOVER_*.
+type CutoverRequest struct {
+	Pools   []string       `json:"pools"`
+	Changes map[string]any `json:"changes"`
+	Suffix  string         `json:"suffix,omitempty"`
+	Policy  map[string]any `json:"policy,omitempty"`
+}
+
+// Cutover es un cambio blue/green de un conjunto de pools; los contadores van por lado (blue, green).
+type Cutover struct {
+	ID           string                    `json:"id"`
+	Pools        []CutoverPools            `json:"pools"`
+	Changes      map[string]any            `json:"changes"`
+	Policy       json.RawMessage           `json:"policy"`
+	Status       string                    `json:"status"`
+	Step         int                       `json:"step"`
+	Weight       int                       `json:"weight"`
+	StartedBy    string                    `json:"started_by"`
+	StartedAt    string                    `json:"started_at"`
+	FinishedAt   string                    `json:"finished_at"`
+	Reason       string                    `json:"reason"`
+	Runners      map[string]CanaryCounters `json:"runners"`
+	StepRunners  map[string]CanaryCounters `json:"step_runners"`
+	FailureRates map[string]float64        `json:"failure_rates"`
+}
+
+// ResourceClass es una clase de recursos con su tamaño en cada backend.
+type ResourceClass struct {
+	Name       string  `json:"name"`
+	Label      string  `json:"label"`
+	CPUs       float64 `json:"cpus"`
+	Memory     string  `json:"memory"`
+	CostFactor float64 `json:"cost_factor"`
+	ECS        struct {
+		CPU    string `json:"cpu"`
+		Memory string `json:"memory"`
+	} `json:"ecs"`
+	Azure struct {
+		VMSize string `json:"vm_size"`
+	} `json:"azure"`
+	GCE struct {
+		MachineType string `json:"machine_type"`
+	} `json:"gce"`
+}
+
+// Region es una región de un pool multi-región; tras un error de capacidad queda en enfriamiento.
+type Region struct {
+	Pool              string `json:"pool"`
+	Region            string `json:"region"`
+	Preference        int    `json:"preference"`
+	Available         bool   `json:"available"`
+	CooldownRemaining int    `json:"cooldown_remaining"`
+	LastError         string `json:"last_error"`
+	Provisioned       int    `json:"provisioned"`
+	Failures          int    `json:"failures"`
+}
+
+// DockerHostDrain es el vaciado de un host Docker para mantenimiento.
+type DockerHostDrain struct {
+	Reason string `json:"reason"`
+	By     string `json:"by"`
+	At     string `json:"at"`
+}
+
+// DockerHost es un host del backend docker con su capacidad y su último estado conocido.
+type DockerHost struct {
+	Name         string           `json:"name"`
+	URL          string           `json:"url"`
+	TLS          bool             `json:"tls"`
+	Labels       []string         `json:"labels"`
+	Slots        int              `json:"slots"`
+	Running      int              `json:"running"`
+	Reserved     int              `json:"reserved"`
+	CPUs         int              `json:"cpus"`
+	Memory       int64            `json:"memory"`
+	Version      string           `json:"version"`
+	Healthy      *bool            `json:"healthy"`
+	LastError    string           `json:"last_error"`
+	CheckedAt    string           `json:"checked_at"`
+	Drained      *DockerHostDrain `json:"drained"`
+	DiskPressure bool             `json:"disk_pressure"`
+	// Destroyed y Remaining solo vienen al vaciar: runners libres destruidos y los que siguen en el host
+	Destroyed []string `json:"destroyed,omitempty"`
+	Remaining []string `json:"remaining,omitempty"`
+}
+
+// Identity es el llamador autenticado (GET /auth/whoami).
+type Identity struct {
+	Name    string   `json:"name"`
+	Role    string   `json:"role"`
+	Method  string   `json:"method"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// APIVersion es una versión del API con su calendario de obsolescencia.
+type APIVersion struct {
+	Version      string `json:"version"`
+	Path         string `json:"path"`
+	Latest       bool   `json:"latest"`
+	Default      bool   `json:"default"`
+	Deprecated   bool   `json:"deprecated"`
+	DeprecatedAt string `json:"deprecated_at"`
+	SunsetAt     string `json:"sunset_at"`
+}
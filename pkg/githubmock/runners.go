@@ -0,0 +1,433 @@
+package githubmock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Label es una label de runner como la devuelve el API.
+type Label struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Runner es un runner self-hosted registrado en un scope.
+type Runner struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	OS        string  `json:"os"`
+	Status    string  `json:"status"`
+	Busy      bool    `json:"busy"`
+	Ephemeral bool    `json:"ephemeral"`
+	Labels    []Label `json:"labels"`
+}
+
+// WorkflowRun es una ejecución de workflow con el estado que consulta el autoscaler.
+type WorkflowRun struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Conclusion *string   `json:"conclusion"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// scope agrupa los runners de un repositorio ("repos/owner/repo") u organización ("orgs/org").
+type scope struct {
+	runners map[int64]*Runner
+}
+
+// scopeKey normaliza la ruta de la petición al scope de sus runners.
+func scopeKey(r *http.Request) string {
+	if org := r.PathValue("org"); org != "" {
+		return "orgs/" + org
+	}
+	if owner := r.PathValue("owner"); owner != "" {
+		return "repos/" + owner + "/" + r.PathValue("repo")
+	}
+	return "user"
+}
+
+// runnerScope devuelve (y crea si falta) el scope con s.mu tomado.
+func (s *Server) runnerScope(key string) *scope {
+	sc, ok := s.scopes[key]
+	if !ok {
+		sc = &scope{runners: map[int64]*Runner{}}
+		s.scopes[key] = sc
+	}
+	return sc
+}
+
+// register crea un runner en el scope (con s.mu tomado).
+func (s *Server) register(key, name string, labels []string, status string) *Runner {
+	s.nextID++
+	runner := &Runner{ID: s.nextID, Name: name, OS: "Linux", Status: status, Ephemeral: true}
+	for i, label := range labels {
+		kind := "custom"
+		if label == "self-hosted" || label == "linux" || label == "x64" {
+			kind = "read-only"
+		}
+		runner.Labels = append(runner.Labels, Label{ID: int64(i + 1), Name: label, Type: kind})
+	}
+	s.runnerScope(key).runners[runner.ID] = runner
+	return runner
+}
+
+// RegisterRunner simula que un runner termina config.sh en el scope ("repos/owner/repo",
+// "orgs/org") y queda online, como haría el contenedor real al arrancar.
+func (s *Server) RegisterRunner(scope, name string, labels ...string) Runner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.register(scope, name, labels, "online")
+}
+
+// SetRunnerStatus cambia el estado ("online", "offline") y si está ocupado un runner por
+// nombre; devuelve false si no existe en el scope.
+func (s *Server) SetRunnerStatus(scope, name, status string, busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, runner := range s.runnerScope(scope).runners {
+		if runner.Name == name {
+			runner.Status, runner.Busy = status, busy
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveRunner da de baja un runner por nombre, como GitHub con un efímero al terminar su job.
+func (s *Server) RemoveRunner(scope, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := s.runnerScope(scope)
+	for id, runner := range sc.runners {
+		if runner.Name == name {
+			delete(sc.runners, id)
+			return true
+		}
+	}
+	return false
+}
+
+// Runners devuelve una copia de los runners del scope ordenados por ID.
+func (s *Server) Runners(scope string) []Runner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedRunners(scope)
+}
+
+// sortedRunners copia los runners del scope ordenados por ID (con s.mu tomado).
+func (s *Server) sortedRunners(key string) []Runner {
+	runners := make([]Runner, 0, len(s.runnerScope(key).runners))
+	for _, runner := range s.runnerScope(key).runners {
+		runners = append(runners, *runner)
+	}
+	sort.Slice(runners, func(i, j int) bool { return runners[i].ID < runners[j].ID })
+	return runners
+}
+
+// AddRepo da de alta un repositorio ("owner/repo") en la organización y en la instalación
+// de la App del owner, que se crea si no existía.
+func (s *Server) AddRepo(fullName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, repo := range s.repos {
+		if repo == fullName {
+			return
+		}
+	}
+	s.repos = append(s.repos, fullName)
+	owner, _, _ := strings.Cut(fullName, "/")
+	if _, ok := s.installs[owner]; !ok {
+		s.nextID++
+		s.installs[owner] = s.nextID
+	}
+}
+
+// AddWorkflow publica un fichero de .github/workflows en el repositorio, para el
+// descubrimiento de repos que usan runners self-hosted.
+func (s *Server) AddWorkflow(repo, file, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workflows[repo] == nil {
+		s.workflows[repo] = map[string]string{}
+	}
+	s.workflows[repo][file] = content
+}
+
+// QueueRun añade una ejecución en el estado dado ("queued", "in_progress", "completed")
+// y devuelve su ID.
+func (s *Server) QueueRun(repo, status string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	s.runs[repo] = append(s.runs[repo], &WorkflowRun{ID: s.nextID, Name: "ci", Status: status, CreatedAt: time.Now().UTC()})
+	return s.nextID
+}
+
+// SetRunStatus cambia el estado de una ejecución; al pasar a completed le pone conclusion.
+func (s *Server) SetRunStatus(repo string, id int64, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs[repo] {
+		if run.ID == id {
+			run.Status = status
+			if status == "completed" {
+				conclusion := "success"
+				run.Conclusion = &conclusion
+			}
+			return true
+		}
+	}
+	return false
+}
+
+type jitConfigRequest struct {
+	Name          string   `json:"name"`
+	RunnerGroupID int64    `json:"runner_group_id"`
+	Labels        []string `json:"labels"`
+	WorkFolder    string   `json:"work_folder"`
+}
+
+// generateJITConfig registra el runner (offline hasta que arranque) y devuelve su
+// configuración codificada, como POST .../actions/runners/generate-jitconfig.
+func (s *Server) generateJITConfig(w http.ResponseWriter, r *http.Request) {
+	var req jitConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || len(req.Labels) == 0 {
+		s.writeError(w, http.StatusUnprocessableEntity, "Invalid request: name and labels are required")
+		return
+	}
+	key := scopeKey(r)
+
+	s.mu.Lock()
+	for _, runner := range s.runnerScope(key).runners {
+		if runner.Name == req.Name {
+			s.mu.Unlock()
+			s.writeError(w, http.StatusConflict, "Already exists - A runner with the name "+req.Name+" already exists.")
+			return
+		}
+	}
+	runner := *s.register(key, req.Name, req.Labels, "offline")
+	token := s.issueToken("AABF")
+	s.mu.Unlock()
+
+	config, _ := json.Marshal(map[string]any{
+		".runner":      map[string]any{"agentId": runner.ID, "agentName": runner.Name, "poolId": req.RunnerGroupID, "workFolder": req.WorkFolder},
+		".credentials": map[string]any{"scheme": "OAuthAccessToken", "token": token},
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"runner":             runner,
+		"encoded_jit_config": base64.StdEncoding.EncodeToString(config),
+	})
+}
+
+// listRunners pagina con per_page y page como el API (30 por defecto, 100 como máximo).
+func (s *Server) listRunners(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runners := s.sortedRunners(scopeKey(r))
+	s.mu.Unlock()
+
+	total := len(runners)
+	perPage, page := pagination(r)
+	start := min((page-1)*perPage, total)
+	end := min(start+perPage, total)
+	s.respond(w, r, map[string]any{"total_count": total, "runners": runners[start:end]})
+}
+
+func (s *Server) getRunner(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	runner, ok := s.runnerScope(scopeKey(r)).runners[id]
+	var copied Runner
+	if ok {
+		copied = *runner
+	}
+	s.mu.Unlock()
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.respond(w, r, copied)
+}
+
+// deleteRunner borra el runner; GitHub rechaza con 422 el de un runner ocupado con un job.
+func (s *Server) deleteRunner(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	sc := s.runnerScope(scopeKey(r))
+	runner, ok := sc.runners[id]
+	busy := ok && runner.Busy
+	if ok && !busy {
+		delete(sc.runners, id)
+	}
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		s.writeError(w, http.StatusNotFound, "Not Found")
+	case busy:
+		s.writeError(w, http.StatusUnprocessableEntity, "Bad request - Runner \""+runner.Name+"\" is still running a job")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	repo := r.PathValue("owner") + "/" + r.PathValue("repo")
+	status := r.URL.Query().Get("status")
+	s.mu.Lock()
+	runs := []WorkflowRun{}
+	for _, run := range s.runs[repo] {
+		if status == "" || run.Status == status {
+			runs = append(runs, *run)
+		}
+	}
+	s.mu.Unlock()
+	s.respond(w, r, map[string]any{"total_count": len(runs), "workflow_runs": runs})
+}
+
+// listWorkflows lista .github/workflows con download_url hacia el propio mock.
+func (s *Server) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	owner, name := r.PathValue("owner"), r.PathValue("repo")
+	base := "http://" + r.Host
+	if s.enterprise != "" {
+		base += "/api/v3"
+	}
+	s.mu.Lock()
+	files := make([]string, 0, len(s.workflows[owner+"/"+name]))
+	for file := range s.workflows[owner+"/"+name] {
+		files = append(files, file)
+	}
+	s.mu.Unlock()
+	if len(files) == 0 {
+		s.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	sort.Strings(files)
+	entries := make([]map[string]any, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, map[string]any{
+			"name":         file,
+			"path":         ".github/workflows/" + file,
+			"type":         "file",
+			"download_url": base + "/raw/" + owner + "/" + name + "/" + file,
+		})
+	}
+	s.respond(w, r, entries)
+}
+
+func (s *Server) rawWorkflow(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, ok := s.workflows[r.PathValue("owner")+"/"+r.PathValue("repo")][r.PathValue("file")]
+	s.mu.Unlock()
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(content))
+}
+
+// listOrgRepos devuelve los repositorios de la organización (o todos en /user/repos), paginados.
+func (s *Server) listOrgRepos(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	s.mu.Lock()
+	repos := []map[string]any{}
+	for _, fullName := range s.repos {
+		owner, name, _ := strings.Cut(fullName, "/")
+		if org == "" || owner == org {
+			repos = append(repos, repository(owner, name))
+		}
+	}
+	s.mu.Unlock()
+	perPage, page := pagination(r)
+	start := min((page-1)*perPage, len(repos))
+	s.respond(w, r, repos[start:min(start+perPage, len(repos))])
+}
+
+func repository(owner, name string) map[string]any {
+	return map[string]any{
+		"name":      name,
+		"full_name": owner + "/" + name,
+		"private":   true,
+		"owner":     map[string]any{"login": owner},
+	}
+}
+
+func (s *Server) installation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	id, ok := s.installs[r.PathValue("org")]
+	s.mu.Unlock()
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	s.respond(w, r, map[string]any{"id": id, "account": map[string]any{"login": r.PathValue("org")}})
+}
+
+func (s *Server) listInstallations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	installations := []map[string]any{}
+	for owner, id := range s.installs {
+		installations = append(installations, map[string]any{
+			"id":          id,
+			"account":     map[string]any{"login": owner},
+			"permissions": map[string]string{"administration": "write", "actions": "read", "organization_self_hosted_runners": "write"},
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(installations, func(i, j int) bool { return installations[i]["id"].(int64) < installations[j]["id"].(int64) })
+	s.respond(w, r, installations)
+}
+
+// accessToken emite un token de instalación que el mock acepta en adelante.
+func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	found := false
+	for _, installed := range s.installs {
+		found = found || installed == id
+	}
+	token := ""
+	if found {
+		token = s.issueToken("ghs_")
+		s.tokens[token] = true
+	}
+	s.mu.Unlock()
+	if !found {
+		s.writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token":      token,
+		"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) installationRepos(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	repos := []map[string]any{}
+	for _, fullName := range s.repos {
+		owner, name, _ := strings.Cut(fullName, "/")
+		repos = append(repos, repository(owner, name))
+	}
+	s.mu.Unlock()
+	perPage, page := pagination(r)
+	start := min((page-1)*perPage, len(repos))
+	s.respond(w, r, map[string]any{"total_count": len(repos), "repositories": repos[start:min(start+perPage, len(repos))]})
+}
+
+// pagination lee per_page (30 por defecto, máximo 100) y page (desde 1).
+func pagination(r *http.Request) (perPage, page int) {
+	perPage, _ = strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	perPage = min(perPage, 100)
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	return perPage, max(page, 1)
+}
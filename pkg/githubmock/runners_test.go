@@ -0,0 +1,172 @@
+package githubmock_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/githubmock"
+)
+
+type jitConfigResponse struct {
+	Runner           githubmock.Runner `json:"runner"`
+	EncodedJITConfig string            `json:"encoded_jit_config"`
+}
+
+type runnerList struct {
+	TotalCount int                 `json:"total_count"`
+	Runners    []githubmock.Runner `json:"runners"`
+}
+
+func TestGenerateJITConfig(t *testing.T) {
+	gh := newServer(t)
+	path := "/repos/acme/api/actions/runners/generate-jitconfig"
+	body := `{"name": "runner-1", "runner_group_id": 1, "labels": ["self-hosted", "linux", "gpu"], "work_folder": "_work"}`
+
+	var created jitConfigResponse
+	resp := call(t, gh, http.MethodPost, path, body, &created)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("estado %d, se esperaba 201", resp.StatusCode)
+	}
+	if created.Runner.Name != "runner-1" || created.Runner.Status != "offline" || !created.Runner.Ephemeral {
+		t.Errorf("runner inesperado: %+v", created.Runner)
+	}
+	if len(created.Runner.Labels) != 3 || created.Runner.Labels[0].Type != "read-only" || created.Runner.Labels[2].Type != "custom" {
+		t.Errorf("labels inesperadas: %+v", created.Runner.Labels)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(created.EncodedJITConfig)
+	if err != nil {
+		t.Fatalf("encoded_jit_config no es base64: %v", err)
+	}
+	var config struct {
+		Runner struct {
+			AgentID    int64  `json:"agentId"`
+			AgentName  string `json:"agentName"`
+			WorkFolder string `json:"workFolder"`
+		} `json:".runner"`
+		Credentials struct {
+			Token string `json:"token"`
+		} `json:".credentials"`
+	}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		t.Fatalf("JIT config no es JSON: %v", err)
+	}
+	if config.Runner.AgentID != created.Runner.ID || config.Runner.AgentName != "runner-1" || config.Runner.WorkFolder != "_work" || config.Credentials.Token == "" {
+		t.Errorf("JIT config inesperada: %s", raw)
+	}
+
+	// El runner queda registrado en el scope, y el nombre no se puede repetir
+	if runners := gh.Runners("repos/acme/api"); len(runners) != 1 || runners[0].ID != created.Runner.ID {
+		t.Errorf("Runners = %+v", runners)
+	}
+	if resp := call(t, gh, http.MethodPost, path, body, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("nombre repetido: estado %d, se esperaba 409", resp.StatusCode)
+	}
+	for _, invalid := range []string{`{"labels": ["linux"]}`, `{"name": "runner-2"}`, `no json`} {
+		if resp := call(t, gh, http.MethodPost, path, invalid, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: estado %d, se esperaba 422", invalid, resp.StatusCode)
+		}
+	}
+}
+
+func TestListRunners(t *testing.T) {
+	gh := newServer(t)
+	for i := 1; i <= 35; i++ {
+		gh.RegisterRunner("orgs/acme", fmt.Sprintf("runner-%d", i), "self-hosted", "linux")
+	}
+	gh.RegisterRunner("repos/acme/api", "repo-runner", "self-hosted")
+
+	var page runnerList
+	call(t, gh, http.MethodGet, "/orgs/acme/actions/runners", "", &page)
+	if page.TotalCount != 35 || len(page.Runners) != 30 {
+		t.Fatalf("primera página: total %d, %d runners; se esperaba 35 y 30", page.TotalCount, len(page.Runners))
+	}
+	call(t, gh, http.MethodGet, "/orgs/acme/actions/runners?per_page=30&page=2", "", &page)
+	if len(page.Runners) != 5 || page.Runners[0].Name != "runner-31" {
+		t.Errorf("segunda página: %+v", page.Runners)
+	}
+	call(t, gh, http.MethodGet, "/orgs/acme/actions/runners?per_page=500", "", &page)
+	if len(page.Runners) != 35 {
+		t.Errorf("per_page=500: %d runners, se esperaba 35 (máximo 100)", len(page.Runners))
+	}
+
+	// Los scopes están separados
+	call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", &page)
+	if page.TotalCount != 1 || page.Runners[0].Name != "repo-runner" || page.Runners[0].Status != "online" {
+		t.Errorf("runners del repositorio: %+v", page.Runners)
+	}
+
+	if !gh.SetRunnerStatus("repos/acme/api", "repo-runner", "online", true) {
+		t.Fatal("SetRunnerStatus no encontró el runner")
+	}
+	var runner githubmock.Runner
+	call(t, gh, http.MethodGet, fmt.Sprintf("/repos/acme/api/actions/runners/%d", page.Runners[0].ID), "", &runner)
+	if !runner.Busy {
+		t.Errorf("GET del runner: %+v, se esperaba busy", runner)
+	}
+	if resp := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners/999999", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("runner inexistente: estado %d, se esperaba 404", resp.StatusCode)
+	}
+}
+
+func TestDeleteRunner(t *testing.T) {
+	gh := newServer(t)
+	idle := gh.RegisterRunner("repos/acme/api", "idle", "self-hosted")
+	busy := gh.RegisterRunner("repos/acme/api", "busy", "self-hosted")
+	gh.SetRunnerStatus("repos/acme/api", "busy", "online", true)
+
+	path := func(id int64) string { return fmt.Sprintf("/repos/acme/api/actions/runners/%d", id) }
+	if resp := call(t, gh, http.MethodDelete, path(busy.ID), "", nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("runner ocupado: estado %d, se esperaba 422", resp.StatusCode)
+	}
+	if resp := call(t, gh, http.MethodDelete, path(idle.ID), "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("runner libre: estado %d, se esperaba 204", resp.StatusCode)
+	}
+	if resp := call(t, gh, http.MethodDelete, path(idle.ID), "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("runner ya borrado: estado %d, se esperaba 404", resp.StatusCode)
+	}
+	if runners := gh.Runners("repos/acme/api"); len(runners) != 1 || runners[0].Name != "busy" {
+		t.Errorf("Runners = %+v", runners)
+	}
+
+	// RemoveRunner simula la baja de un efímero al terminar su job
+	if !gh.RemoveRunner("repos/acme/api", "busy") || gh.RemoveRunner("repos/acme/api", "busy") {
+		t.Error("RemoveRunner debe dar de baja el runner una sola vez")
+	}
+}
+
+func TestInstallationToken(t *testing.T) {
+	gh := newServer(t)
+	gh.AddRepo("acme/api")
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	call(t, gh, http.MethodGet, "/orgs/acme/installation", "", &installation)
+	var token struct {
+		Token string `json:"token"`
+	}
+	resp := call(t, gh, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", installation.ID), "", &token)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("access_tokens: estado %d, se esperaba 201", resp.StatusCode)
+	}
+
+	// El token emitido se acepta aunque no sea el configurado con WithToken
+	req, _ := http.NewRequest(http.MethodGet, gh.URL+"/installation/repositories", nil)
+	req.Header.Set("Authorization", "token "+token.Token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var repos struct {
+		TotalCount int `json:"total_count"`
+	}
+	json.NewDecoder(res.Body).Decode(&repos)
+	if res.StatusCode != http.StatusOK || repos.TotalCount != 1 {
+		t.Errorf("/installation/repositories con el token de instalación: estado %d, %d repos", res.StatusCode, repos.TotalCount)
+	}
+}
@@ -0,0 +1,363 @@
+// Package githubmock es un servidor en memoria que imita el subconjunto del API REST de
+// GitHub que usa este proyecto: tokens de registro y JIT config, listado y borrado de
+// runners, ejecuciones en cola, instalaciones de la GitHub App, /meta y /rate_limit,
+// con las cabeceras X-RateLimit-* en cada respuesta, y entrega webhooks workflow_job
+// firmados. Sirve para probar los backends y el autoscaler de extremo a extremo sin
+// credenciales reales:
+//
+//	gh := githubmock.NewServer(githubmock.WithToken("ghp_test"))
+//	defer gh.Close()
+//	gh.AddRepo("acme/api")
+//	// GITHUB_API_URL=gh.URL GITHUB_RUNNER_TOKEN=ghp_test ...
+//	runners := gh.Runners("repos/acme/api")
+//
+// Los runners no se registran solos: el proceso real del runner habla con endpoints de
+// GitHub que no son del API REST. RegisterRunner y SetRunnerStatus simulan ese paso.
+package githubmock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request es una petición recibida, para comprobar qué llamó el código bajo prueba.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Time   time.Time
+}
+
+// fault es un fallo inyectado con Fail.
+type fault struct {
+	method string
+	prefix string
+	status int
+	times  int
+}
+
+// Server implementa http.Handler; NewServer además lo sirve en un puerto local.
+type Server struct {
+	// URL base del API (con /api/v3 si se simula un GHES); vacía hasta que se sirve
+	URL string
+
+	httpServer *httptest.Server
+	mux        *http.ServeMux
+	token      string
+	enterprise string
+
+	mu        sync.Mutex
+	nextID    int64
+	tokens    map[string]bool
+	scopes    map[string]*scope
+	repos     []string
+	installs  map[string]int64
+	runs      map[string][]*WorkflowRun
+	workflows map[string]map[string]string
+	requests  []Request
+	faults    []*fault
+
+	webhookURL    string
+	webhookSecret string
+	deliveries    []Delivery
+
+	rateLimit     int
+	rateRemaining int
+	rateReset     time.Time
+}
+
+// Option configura el servidor en New o NewServer.
+type Option func(*Server)
+
+// WithToken exige ese token (PAT o de instalación emitido por el propio mock) en las
+// llamadas que no son de la App. Sin esta opción se acepta cualquier token no vacío.
+func WithToken(token string) Option {
+	return func(s *Server) { s.token = token }
+}
+
+// WithEnterpriseVersion simula un GHES de esa versión: el API cuelga de /api/v3 y /meta
+// devuelve installed_version.
+func WithEnterpriseVersion(version string) Option {
+	return func(s *Server) { s.enterprise = version }
+}
+
+// WithRateLimit fija el presupuesto por hora del rate limit primario (5000 por defecto).
+func WithRateLimit(limit int) Option {
+	return func(s *Server) {
+		s.rateLimit = limit
+		s.rateRemaining = limit
+	}
+}
+
+// New crea el servidor sin escuchar, para montarlo en un listener propio.
+func New(opts ...Option) *Server {
+	s := &Server{
+		nextID:        1,
+		tokens:        map[string]bool{},
+		scopes:        map[string]*scope{},
+		installs:      map[string]int64{},
+		runs:          map[string][]*WorkflowRun{},
+		workflows:     map[string]map[string]string{},
+		rateLimit:     5000,
+		rateRemaining: 5000,
+		rateReset:     time.Now().Add(time.Hour),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.routes()
+	return s
+}
+
+// NewServer crea el servidor y lo sirve en 127.0.0.1 con un puerto libre.
+func NewServer(opts ...Option) *Server {
+	s := New(opts...)
+	s.httpServer = httptest.NewServer(s)
+	s.URL = s.httpServer.URL
+	if s.enterprise != "" {
+		s.URL += "/api/v3"
+	}
+	return s
+}
+
+// Close detiene el servidor iniciado con NewServer.
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /meta", s.meta)
+	s.mux.HandleFunc("GET /rate_limit", s.rateLimitStatus)
+	s.mux.HandleFunc("GET /user", s.user)
+	for _, prefix := range []string{"/repos/{owner}/{repo}", "/orgs/{org}"} {
+		s.mux.HandleFunc("POST "+prefix+"/actions/runners/registration-token", s.registrationToken)
+		s.mux.HandleFunc("POST "+prefix+"/actions/runners/remove-token", s.registrationToken)
+		s.mux.HandleFunc("POST "+prefix+"/actions/runners/generate-jitconfig", s.generateJITConfig)
+		s.mux.HandleFunc("GET "+prefix+"/actions/runners", s.listRunners)
+		s.mux.HandleFunc("GET "+prefix+"/actions/runners/{id}", s.getRunner)
+		s.mux.HandleFunc("DELETE "+prefix+"/actions/runners/{id}", s.deleteRunner)
+	}
+	s.mux.HandleFunc("GET /user/actions/runners", s.listRunners)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/actions/runs", s.listRuns)
+	s.mux.HandleFunc("GET /repos/{owner}/{repo}/contents/.github/workflows", s.listWorkflows)
+	s.mux.HandleFunc("GET /raw/{owner}/{repo}/{file}", s.rawWorkflow)
+	s.mux.HandleFunc("GET /orgs/{org}/repos", s.listOrgRepos)
+	s.mux.HandleFunc("GET /user/repos", s.listOrgRepos)
+	s.mux.HandleFunc("GET /orgs/{org}/installation", s.installation)
+	s.mux.HandleFunc("GET /users/{org}/installation", s.installation)
+	s.mux.HandleFunc("GET /app/installations", s.listInstallations)
+	s.mux.HandleFunc("POST /app/installations/{id}/access_tokens", s.accessToken)
+	s.mux.HandleFunc("GET /installation/repositories", s.installationRepos)
+}
+
+// ServeHTTP registra la petición, aplica autenticación, fallos inyectados y rate limit,
+// y la despacha.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.enterprise != "" {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api/v3")
+		w.Header().Set("X-GitHub-Enterprise-Version", s.enterprise)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Time: time.Now()})
+	status := s.injected(r)
+	s.mu.Unlock()
+
+	// /meta es público, como en GitHub
+	if r.URL.Path != "/meta" && !s.authorized(r) {
+		s.writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	if status != 0 {
+		s.writeError(w, status, http.StatusText(status))
+		return
+	}
+	if !s.consumeRateLimit(w, r) {
+		s.writeError(w, http.StatusForbidden, "API rate limit exceeded")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized acepta un JWT cualquiera en /app/* y el token configurado (o uno emitido) en el resto.
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	token := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(header, "Bearer "), "token "))
+	if token == "" || token == header {
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, "/app/") {
+		return strings.HasPrefix(header, "Bearer ")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token == "" || token == s.token || s.tokens[token]
+}
+
+// consumeRateLimit descuenta una llamada y pone las cabeceras X-RateLimit-*.
+func (s *Server) consumeRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().After(s.rateReset) {
+		s.rateRemaining = s.rateLimit
+		s.rateReset = time.Now().Add(time.Hour)
+	}
+	allowed := s.rateRemaining > 0
+	if allowed && r.URL.Path != "/rate_limit" {
+		s.rateRemaining--
+	}
+	s.rateHeaders(w)
+	return allowed
+}
+
+// rateHeaders pone las cabeceras X-RateLimit-* (con s.mu tomado).
+func (s *Server) rateHeaders(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(s.rateRemaining))
+	header.Set("X-RateLimit-Used", strconv.Itoa(s.rateLimit-s.rateRemaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(s.rateReset.Unix(), 10))
+	header.Set("X-RateLimit-Resource", "core")
+}
+
+// injected devuelve el estado de un fallo pendiente para la petición, o 0 (con s.mu tomado).
+func (s *Server) injected(r *http.Request) int {
+	for i, f := range s.faults {
+		if (f.method == "" || f.method == r.Method) && strings.HasPrefix(r.URL.Path, f.prefix) {
+			f.times--
+			if f.times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			return f.status
+		}
+	}
+	return 0
+}
+
+// Fail hace que las próximas times peticiones con ese método (vacío: cualquiera) y
+// prefijo de ruta respondan con status, para probar reintentos y degradación.
+func (s *Server) Fail(method, pathPrefix string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{method: method, prefix: pathPrefix, status: status, times: times})
+}
+
+// SetRateLimit fija las llamadas restantes y el momento del reinicio; 0 restantes hace
+// que el resto de peticiones respondan 403 hasta reset.
+func (s *Server) SetRateLimit(remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateRemaining = remaining
+	s.rateReset = reset
+}
+
+// Requests devuelve las peticiones recibidas hasta ahora.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Count cuenta las peticiones con ese método y ruta exacta (sin /api/v3).
+func (s *Server) Count(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, r := range s.requests {
+		if r.Method == method && r.Path == path {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) meta(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{"verifiable_password_authentication": false}
+	if s.enterprise != "" {
+		body["installed_version"] = s.enterprise
+	}
+	s.respond(w, r, body)
+}
+
+func (s *Server) rateLimitStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	core := map[string]any{
+		"limit":     s.rateLimit,
+		"remaining": s.rateRemaining,
+		"used":      s.rateLimit - s.rateRemaining,
+		"reset":     s.rateReset.Unix(),
+	}
+	s.mu.Unlock()
+	s.respond(w, r, map[string]any{"resources": map[string]any{"core": core}, "rate": core})
+}
+
+func (s *Server) user(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-OAuth-Scopes", "repo, admin:org")
+	s.respond(w, r, map[string]any{"login": "githubmock", "id": 1, "type": "User"})
+}
+
+// issueToken genera un token de prefijo dado (con s.mu tomado).
+func (s *Server) issueToken(prefix string) string {
+	s.nextID++
+	sum := sha256.Sum256([]byte(prefix + strconv.FormatInt(s.nextID, 10) + time.Now().String()))
+	return prefix + hex.EncodeToString(sum[:])[:36]
+}
+
+func (s *Server) registrationToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	token := s.issueToken("AABF")
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token":      token,
+		"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+// respond responde 200 con ETag; si coincide con If-None-Match responde 304 sin cuerpo y
+// devuelve la llamada al rate limit, como GitHub con las peticiones condicionales.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, value any) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		s.mu.Lock()
+		if s.rateRemaining < s.rateLimit {
+			s.rateRemaining++
+		}
+		s.rateHeaders(w)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
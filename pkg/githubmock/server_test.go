@@ -0,0 +1,178 @@
+package githubmock_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/githubmock"
+)
+
+const testToken = "ghp_test"
+
+// call hace una petición con el token de prueba y decodifica el cuerpo JSON en into (si no es nil).
+func call(t *testing.T, gh *githubmock.Server, method, path, body string, into any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, gh.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if into != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, into); err != nil {
+			t.Fatalf("%s %s: respuesta no JSON: %s", method, path, raw)
+		}
+	}
+	return resp
+}
+
+func newServer(t *testing.T, opts ...githubmock.Option) *githubmock.Server {
+	t.Helper()
+	gh := githubmock.NewServer(append([]githubmock.Option{githubmock.WithToken(testToken)}, opts...)...)
+	t.Cleanup(gh.Close)
+	return gh
+}
+
+func TestRegistrationToken(t *testing.T) {
+	gh := newServer(t)
+	for _, path := range []string{"/repos/acme/api/actions/runners/registration-token", "/orgs/acme/actions/runners/registration-token"} {
+		var body struct {
+			Token     string `json:"token"`
+			ExpiresAt string `json:"expires_at"`
+		}
+		resp := call(t, gh, http.MethodPost, path, "", &body)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("%s: estado %d, se esperaba 201", path, resp.StatusCode)
+		}
+		if !strings.HasPrefix(body.Token, "AABF") {
+			t.Errorf("%s: token %q sin el prefijo AABF", path, body.Token)
+		}
+		if expires, err := time.Parse(time.RFC3339, body.ExpiresAt); err != nil || expires.Before(time.Now()) {
+			t.Errorf("%s: expires_at inválido %q", path, body.ExpiresAt)
+		}
+		if gh.Count(http.MethodPost, path) != 1 {
+			t.Errorf("%s: Count = %d, se esperaba 1", path, gh.Count(http.MethodPost, path))
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	gh := newServer(t)
+	for _, header := range []string{"", "Bearer ", "Bearer otro-token"} {
+		req, _ := http.NewRequest(http.MethodGet, gh.URL+"/repos/acme/api/actions/runners", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: estado %d, se esperaba 401", header, resp.StatusCode)
+		}
+	}
+
+	// /meta es público
+	resp, err := http.Get(gh.URL + "/meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/meta sin token: estado %d, se esperaba 200", resp.StatusCode)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gh := newServer(t, githubmock.WithRateLimit(3))
+	for i := 1; i <= 3; i++ {
+		resp := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("llamada %d: estado %d", i, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != strconv.Itoa(3-i) {
+			t.Errorf("llamada %d: X-RateLimit-Remaining = %s, se esperaba %d", i, got, 3-i)
+		}
+		if resp.Header.Get("X-RateLimit-Limit") != "3" || resp.Header.Get("X-RateLimit-Reset") == "" {
+			t.Errorf("llamada %d: cabeceras de rate limit incompletas: %v", i, resp.Header)
+		}
+	}
+	if resp := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("sin presupuesto: estado %d, se esperaba 403", resp.StatusCode)
+	}
+
+	gh.SetRateLimit(1, time.Now().Add(time.Hour))
+	if resp := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("tras SetRateLimit: estado %d, se esperaba 200", resp.StatusCode)
+	}
+}
+
+func TestConditionalRequest(t *testing.T) {
+	gh := newServer(t)
+	first := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", nil)
+	etag := first.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("respuesta sin ETag")
+	}
+	remaining := first.Header.Get("X-RateLimit-Remaining")
+
+	req, _ := http.NewRequest(http.MethodGet, gh.URL+"/repos/acme/api/actions/runners", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("If-None-Match", etag)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-None-Match: estado %d, se esperaba 304", resp.StatusCode)
+	}
+	// Las respuestas 304 no consumen rate limit
+	if got := resp.Header.Get("X-RateLimit-Remaining"); got != remaining {
+		t.Errorf("X-RateLimit-Remaining = %s tras un 304, se esperaba %s", got, remaining)
+	}
+}
+
+func TestFail(t *testing.T) {
+	gh := newServer(t)
+	gh.Fail(http.MethodPost, "/repos/acme/api/actions/runners/registration-token", http.StatusBadGateway, 2)
+	path := "/repos/acme/api/actions/runners/registration-token"
+	for i, want := range []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusCreated} {
+		if resp := call(t, gh, http.MethodPost, path, "", nil); resp.StatusCode != want {
+			t.Errorf("llamada %d: estado %d, se esperaba %d", i+1, resp.StatusCode, want)
+		}
+	}
+	// El fallo solo afecta al método indicado
+	if resp := call(t, gh, http.MethodGet, "/repos/acme/api/actions/runners", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET: estado %d, se esperaba 200", resp.StatusCode)
+	}
+}
+
+func TestEnterpriseVersion(t *testing.T) {
+	gh := newServer(t, githubmock.WithEnterpriseVersion("3.14.0"))
+	if !strings.HasSuffix(gh.URL, "/api/v3") {
+		t.Fatalf("URL %s sin /api/v3", gh.URL)
+	}
+	var meta map[string]any
+	resp := call(t, gh, http.MethodGet, "/meta", "", &meta)
+	if meta["installed_version"] != "3.14.0" || resp.Header.Get("X-GitHub-Enterprise-Version") != "3.14.0" {
+		t.Errorf("/meta de GHES sin la versión: %v %v", meta, resp.Header)
+	}
+	if gh.Count(http.MethodGet, "/meta") != 1 {
+		t.Errorf("las peticiones se registran sin /api/v3: %v", gh.Requests())
+	}
+}
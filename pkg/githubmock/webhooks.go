@@ -0,0 +1,135 @@
+package githubmock
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WorkflowJob es un job para los eventos workflow_job que entrega el mock.
+type WorkflowJob struct {
+	ID    int64
+	RunID int64
+	// Repositorio "owner/repo"
+	Repo   string
+	Name   string
+	Labels []string
+	// Runner que tomó el job (in_progress y completed)
+	RunnerName string
+}
+
+// Delivery es una entrega de webhook hecha por el mock.
+type Delivery struct {
+	ID     string
+	Event  string
+	Action string
+	Status int
+	Time   time.Time
+}
+
+// WithWebhook entrega los eventos a url firmados con secret (X-Hub-Signature-256), como
+// el webhook de la App o del repositorio.
+func WithWebhook(url, secret string) Option {
+	return func(s *Server) { s.webhookURL, s.webhookSecret = url, secret }
+}
+
+// SetWebhook cambia el destino y el secreto de los webhooks, p. ej. cuando el receptor
+// arranca después que el mock.
+func (s *Server) SetWebhook(url, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookURL, s.webhookSecret = url, secret
+}
+
+// SendWorkflowJob entrega un workflow_job con la acción ("queued", "in_progress",
+// "completed"). Un delivery vacío genera uno nuevo; repetir uno simula una reentrega de
+// GitHub. Devuelve el estado y el cuerpo de la respuesta del receptor.
+func (s *Server) SendWorkflowJob(ctx context.Context, job WorkflowJob, action, delivery string) (int, []byte, error) {
+	body, err := json.Marshal(workflowJobPayload(job, action))
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.deliver(ctx, "workflow_job", action, delivery, body)
+}
+
+// Deliveries devuelve las entregas hechas hasta ahora.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// deliver hace el POST firmado con las cabeceras de GitHub y registra la entrega.
+func (s *Server) deliver(ctx context.Context, event, action, delivery string, body []byte) (int, []byte, error) {
+	s.mu.Lock()
+	url, secret := s.webhookURL, s.webhookSecret
+	if delivery == "" {
+		delivery = s.issueToken("")
+	}
+	s.mu.Unlock()
+	if url == "" {
+		return 0, nil, fmt.Errorf("githubmock: webhook sin configurar (WithWebhook)")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/githubmock")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, Delivery{ID: delivery, Event: event, Action: action, Status: resp.StatusCode, Time: time.Now()})
+	s.mu.Unlock()
+	return resp.StatusCode, raw, err
+}
+
+// workflowJobPayload arma el evento con los campos de cada acción, como GitHub.
+func workflowJobPayload(job WorkflowJob, action string) map[string]any {
+	now := time.Now().UTC().Format(time.RFC3339)
+	workflowJob := map[string]any{
+		"id":            job.ID,
+		"run_id":        job.RunID,
+		"run_attempt":   1,
+		"name":          job.Name,
+		"workflow_name": "ci",
+		"labels":        job.Labels,
+		"status":        action,
+		"created_at":    now,
+	}
+	if action != "queued" {
+		workflowJob["runner_name"] = job.RunnerName
+		workflowJob["started_at"] = now
+	}
+	if action == "completed" {
+		workflowJob["conclusion"] = "success"
+		workflowJob["completed_at"] = now
+	}
+	owner, _, _ := strings.Cut(job.Repo, "/")
+	return map[string]any{
+		"action":       action,
+		"workflow_job": workflowJob,
+		"repository":   map[string]any{"full_name": job.Repo, "owner": map[string]any{"login": owner}},
+	}
+}
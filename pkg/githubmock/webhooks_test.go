@@ -0,0 +1,128 @@
+package githubmock_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/eliaspizarro/gha-ephemeral-runners/pkg/githubmock"
+)
+
+// received es una entrega tal como la ve el receptor.
+type received struct {
+	header  http.Header
+	body    []byte
+	payload map[string]any
+}
+
+// receiver sirve un endpoint de webhooks que guarda cada entrega y responde con status.
+func receiver(t *testing.T, status int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var mu sync.Mutex
+	var deliveries []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		entry := received{header: r.Header.Clone(), body: body}
+		json.Unmarshal(body, &entry.payload)
+		mu.Lock()
+		deliveries = append(deliveries, entry)
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(`{"data": {"action": "ok"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), deliveries...)
+	}
+}
+
+func TestSendWorkflowJob(t *testing.T) {
+	hook, deliveries := receiver(t, http.StatusOK)
+	gh := newServer(t, githubmock.WithWebhook(hook.URL, "s3cret"))
+	job := githubmock.WorkflowJob{ID: 42, RunID: 7, Repo: "acme/api", Name: "build", Labels: []string{"self-hosted", "linux"}, RunnerName: "runner-1"}
+
+	for _, action := range []string{"queued", "in_progress", "completed"} {
+		status, body, err := gh.SendWorkflowJob(context.Background(), job, action, "")
+		if err != nil || status != http.StatusOK || string(body) != `{"data": {"action": "ok"}}` {
+			t.Fatalf("%s: estado %d, cuerpo %s, error %v", action, status, body, err)
+		}
+	}
+
+	got := deliveries()
+	if len(got) != 3 {
+		t.Fatalf("%d entregas, se esperaban 3", len(got))
+	}
+	ids := map[string]bool{}
+	for i, action := range []string{"queued", "in_progress", "completed"} {
+		entry := got[i]
+		if entry.header.Get("X-GitHub-Event") != "workflow_job" {
+			t.Errorf("%s: X-GitHub-Event = %q", action, entry.header.Get("X-GitHub-Event"))
+		}
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(entry.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); entry.header.Get("X-Hub-Signature-256") != want {
+			t.Errorf("%s: firma %q, se esperaba %q", action, entry.header.Get("X-Hub-Signature-256"), want)
+		}
+		ids[entry.header.Get("X-GitHub-Delivery")] = true
+
+		workflowJob, _ := entry.payload["workflow_job"].(map[string]any)
+		repository, _ := entry.payload["repository"].(map[string]any)
+		if entry.payload["action"] != action || workflowJob["status"] != action || workflowJob["id"] != float64(42) || workflowJob["run_id"] != float64(7) {
+			t.Errorf("%s: payload inesperado %v", action, entry.payload)
+		}
+		if repository["full_name"] != "acme/api" || repository["owner"].(map[string]any)["login"] != "acme" {
+			t.Errorf("%s: repository inesperado %v", action, repository)
+		}
+		if _, ok := workflowJob["runner_name"]; ok != (action != "queued") {
+			t.Errorf("%s: runner_name presente = %v", action, ok)
+		}
+		if _, ok := workflowJob["conclusion"]; ok != (action == "completed") {
+			t.Errorf("%s: conclusion presente = %v", action, ok)
+		}
+	}
+	if len(ids) != 3 || ids[""] {
+		t.Errorf("cada entrega necesita su propio X-GitHub-Delivery: %v", ids)
+	}
+
+	recorded := gh.Deliveries()
+	if len(recorded) != 3 || recorded[2].Action != "completed" || recorded[2].Status != http.StatusOK || recorded[2].Event != "workflow_job" {
+		t.Errorf("Deliveries = %+v", recorded)
+	}
+}
+
+func TestSendWorkflowJobRedelivery(t *testing.T) {
+	hook, deliveries := receiver(t, http.StatusAccepted)
+	gh := newServer(t)
+	job := githubmock.WorkflowJob{ID: 1, Repo: "acme/api", Labels: []string{"self-hosted"}}
+
+	if _, _, err := gh.SendWorkflowJob(context.Background(), job, "queued", ""); err == nil {
+		t.Fatal("sin WithWebhook la entrega debe fallar")
+	}
+
+	// SetWebhook sin secreto: sin firma; el mismo delivery simula una reentrega
+	gh.SetWebhook(hook.URL, "")
+	for range 2 {
+		if status, _, err := gh.SendWorkflowJob(context.Background(), job, "queued", "delivery-1"); err != nil || status != http.StatusAccepted {
+			t.Fatalf("estado %d, error %v", status, err)
+		}
+	}
+	got := deliveries()
+	if len(got) != 2 || got[0].header.Get("X-GitHub-Delivery") != "delivery-1" || got[1].header.Get("X-GitHub-Delivery") != "delivery-1" {
+		t.Fatalf("entregas: %+v", got)
+	}
+	if got[0].header.Get("X-Hub-Signature-256") != "" {
+		t.Error("sin secreto no debe haber firma")
+	}
+	if recorded := gh.Deliveries(); len(recorded) != 2 || recorded[0].Status != http.StatusAccepted {
+		t.Errorf("Deliveries = %+v", recorded)
+	}
+}
@@ -0,0 +1,370 @@
+// Package logfile es un io.WriteCloser para los logs en archivo de los servicios en Go
+// (logs de servicio, de acceso y de eventos) que rota por tamaño y por intervalo, conserva
+// un número o una antigüedad máxima de archivos rotados y los comprime con gzip, sin
+// depender de que el logrotate del host esté bien configurado:
+//
+//	opts, err := logfile.OptionsFromEnv()
+//	f, err := logfile.Open("/data/logs/access.log", opts)
+//	defer f.Close()
+//	log.SetOutput(io.MultiWriter(os.Stderr, f))
+//
+// Los archivos rotados se llaman <nombre>-<fecha UTC>[.<n>]<extensión>[.gz] junto al
+// original; .<n> solo aparece si dos rotaciones caen en el mismo milisegundo.
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const timeFormat = "20060102T150405.000"
+
+// Options define la rotación y la retención. Un cero desactiva cada criterio.
+type Options struct {
+	// MaxSize rota el archivo antes de que una escritura lo lleve por encima de estos bytes
+	MaxSize int64
+	// Interval rota al cambiar de intervalo alineado en UTC (24h: a medianoche)
+	Interval time.Duration
+	// MaxBackups es el número de archivos rotados que se conservan
+	MaxBackups int
+	// MaxAge borra los archivos rotados más antiguos que esto
+	MaxAge time.Duration
+	// Compress comprime con gzip los archivos rotados
+	Compress bool
+}
+
+// File es un archivo de log con rotación; es seguro usarlo desde varias goroutines.
+type File struct {
+	path    string
+	opts    Options
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	segment time.Time
+	mill    chan struct{}
+	done    chan struct{}
+}
+
+// Open abre (o crea) el archivo en modo append, con sus directorios.
+func Open(path string, opts Options) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &File{path: path, opts: opts, mill: make(chan struct{}, 1), done: make(chan struct{})}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	go f.millLoop()
+	// Rotados que vencieron mientras el proceso no corría
+	f.millRun()
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	// Un archivo existente pertenece al intervalo de su última escritura: el de ayer rota hoy
+	started := time.Now()
+	if info.Size() > 0 {
+		started = info.ModTime()
+	}
+	f.segment = f.truncate(started)
+	return nil
+}
+
+func (f *File) truncate(t time.Time) time.Time {
+	if f.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(f.opts.Interval)
+}
+
+// Write escribe p entero en el archivo actual, rotándolo antes si hace falta.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	full := f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize
+	if full || f.truncate(time.Now()) != f.segment {
+		// Sin rotar se sigue escribiendo en el archivo actual: perder logs es peor que un archivo grande
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ Rotación de %s: %v\n", f.path, err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate cierra el archivo actual, lo renombra y abre uno nuevo (por ejemplo con SIGHUP).
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	renameErr := os.Rename(f.path, f.backupName(time.Now()))
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil && !os.IsNotExist(renameErr) {
+		// El archivo reabierto es el mismo: se reintenta en el siguiente intervalo, no en cada escritura
+		f.size = 0
+		f.segment = f.truncate(time.Now())
+		return renameErr
+	}
+	f.millRun()
+	return nil
+}
+
+// backupName es el nombre del archivo rotado en t. os.Rename sobrescribe sin avisar:
+// si ya existe uno con ese milisegundo (comprimido o no) se añade .1, .2...
+func (f *File) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(f.path, ext), t.UTC().Format(timeFormat))
+	name := base + ext
+	for n := 1; exists(name) || exists(name+".gz"); n++ {
+		name = fmt.Sprintf("%s.%d%s", base, n, ext)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// Close cierra el archivo y espera a que termine la compresión en curso.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	close(f.mill)
+	<-f.done
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// millRun pide una pasada de compresión y retención sin bloquear la escritura.
+func (f *File) millRun() {
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+}
+
+func (f *File) millLoop() {
+	defer close(f.done)
+	for range f.mill {
+		if err := f.millOnce(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️ Rotación de %s: %v\n", f.path, err)
+		}
+	}
+}
+
+type backup struct {
+	path string
+	time time.Time
+	// Sufijo .<n> de las rotaciones en el mismo milisegundo (mayor: más reciente)
+	seq int
+}
+
+// parseStamp interpreta <fecha UTC>[.<n>] de un archivo rotado.
+func parseStamp(stamp string) (time.Time, int, error) {
+	if len(stamp) < len(timeFormat) {
+		return time.Time{}, 0, fmt.Errorf("fecha incompleta: %q", stamp)
+	}
+	t, err := time.Parse(timeFormat, stamp[:len(timeFormat)])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	seq := 0
+	if rest := stamp[len(timeFormat):]; rest != "" {
+		digits, ok := strings.CutPrefix(rest, ".")
+		if seq, err = strconv.Atoi(digits); !ok || err != nil || seq < 1 {
+			return time.Time{}, 0, fmt.Errorf("sufijo inválido: %q", rest)
+		}
+	}
+	return t, seq, nil
+}
+
+// backups lista los archivos rotados, del más reciente al más antiguo.
+func (f *File) backups() ([]backup, error) {
+	ext := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+	var result []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if entry.IsDir() || !strings.HasPrefix(stamp, prefix) {
+			continue
+		}
+		t, seq, err := parseStamp(strings.TrimPrefix(stamp, prefix))
+		if err != nil {
+			continue
+		}
+		result = append(result, backup{path: filepath.Join(filepath.Dir(f.path), name), time: t, seq: seq})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].time.Equal(result[j].time) {
+			return result[i].time.After(result[j].time)
+		}
+		return result[i].seq > result[j].seq
+	})
+	return result, nil
+}
+
+func (f *File) millOnce() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for i, b := range backups {
+		expired := f.opts.MaxAge > 0 && time.Since(b.time) > f.opts.MaxAge
+		if (f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups) || expired {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+		if f.opts.Compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compress(b.path); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// compress escribe path.gz y borra path; un .gz a medias no sustituye al original.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ParseSize interpreta tamaños como 500KB, 100MB o 1GB (múltiplos de 1024) o bytes.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("tamaño inválido: %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// ParseAge interpreta duraciones de Go (12h) o en días (30d).
+func ParseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("duración inválida: %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// OptionsFromEnv lee LOG_MAX_SIZE (100MB), LOG_ROTATE_INTERVAL (24h), LOG_MAX_BACKUPS (7),
+// LOG_MAX_AGE (30d) y LOG_COMPRESS (true); "0" desactiva cada criterio.
+func OptionsFromEnv() (Options, error) {
+	env := func(key, fallback string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return fallback
+	}
+	var opts Options
+	var err error
+	if opts.MaxSize, err = ParseSize(env("LOG_MAX_SIZE", "100MB")); err != nil {
+		return opts, fmt.Errorf("LOG_MAX_SIZE: %w", err)
+	}
+	if opts.Interval, err = ParseAge(env("LOG_ROTATE_INTERVAL", "24h")); err != nil {
+		return opts, fmt.Errorf("LOG_ROTATE_INTERVAL: %w", err)
+	}
+	if opts.MaxBackups, err = strconv.Atoi(env("LOG_MAX_BACKUPS", "7")); err != nil || opts.MaxBackups < 0 {
+		return opts, fmt.Errorf("LOG_MAX_BACKUPS inválido: %q", os.Getenv("LOG_MAX_BACKUPS"))
+	}
+	if opts.MaxAge, err = ParseAge(env("LOG_MAX_AGE", "30d")); err != nil {
+		return opts, fmt.Errorf("LOG_MAX_AGE: %w", err)
+	}
+	if opts.Compress, err = strconv.ParseBool(env("LOG_COMPRESS", "true")); err != nil {
+		return opts, fmt.Errorf("LOG_COMPRESS: %w", err)
+	}
+	return opts, nil
+}
@@ -0,0 +1,238 @@
+// Package watchdog vigila el propio proceso de los servicios en Go: goroutines, heap y
+// retraso del planificador (el equivalente al lag del event loop: cuánto tarda en
+// despertar un ticker). Con algún umbral superado el servicio deja de aceptar trabajo
+// nuevo (Admit devuelve false) hasta que se recupere y, si sigue superado durante
+// RestartAfter, el watchdog pide un reinicio controlado en lugar de esperar al OOM killer:
+//
+//	limits, err := watchdog.LimitsFromEnv("CACHE_PROXY", watchdog.DefaultLimits)
+//	wd := watchdog.New("cache_proxy", limits, metrics, func(reason string) { ... })
+//	go wd.Run(ctx)
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cada cuánto se miden goroutines y heap, y resolución de la medida del retraso del planificador.
+const (
+	Interval = 5 * time.Second
+	lagTick  = 100 * time.Millisecond
+)
+
+// Limits son los umbrales del watchdog; un umbral a cero no se comprueba.
+type Limits struct {
+	Goroutines int
+	HeapBytes  uint64
+	Lag        time.Duration
+	// RestartAfter es el tiempo con algún umbral superado antes del reinicio (0: nunca)
+	RestartAfter time.Duration
+}
+
+// DefaultLimits son los umbrales por defecto de los servicios.
+var DefaultLimits = Limits{
+	Goroutines:   10000,
+	HeapBytes:    1024 << 20,
+	Lag:          time.Second,
+	RestartAfter: 2 * time.Minute,
+}
+
+// LimitsFromEnv lee <prefijo>_MAX_GOROUTINES, <prefijo>_MAX_HEAP_MB, <prefijo>_MAX_LAG_MS
+// y <prefijo>_RESTART_AFTER (segundos), con defaults para las que no están definidas.
+func LimitsFromEnv(prefix string, defaults Limits) (Limits, error) {
+	limits := defaults
+	for _, item := range []struct {
+		key   string
+		apply func(int)
+	}{
+		{"_MAX_GOROUTINES", func(v int) { limits.Goroutines = v }},
+		{"_MAX_HEAP_MB", func(v int) { limits.HeapBytes = uint64(v) << 20 }},
+		{"_MAX_LAG_MS", func(v int) { limits.Lag = time.Duration(v) * time.Millisecond }},
+		{"_RESTART_AFTER", func(v int) { limits.RestartAfter = time.Duration(v) * time.Second }},
+	} {
+		raw := os.Getenv(prefix + item.key)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return limits, fmt.Errorf("%s%s inválido: %q", prefix, item.key, raw)
+		}
+		item.apply(value)
+	}
+	return limits, nil
+}
+
+// Metrics recibe las medidas; los servicios sin métricas pasan nil.
+type Metrics interface {
+	Gauge(name string, value float64)
+	Incr(name string)
+}
+
+// Watchdog mide el proceso cada Interval desde Run.
+type Watchdog struct {
+	name    string
+	limits  Limits
+	metrics Metrics
+	restart func(reason string)
+
+	shedding  atomic.Bool
+	maxLag    atomic.Int64
+	restarted atomic.Bool
+
+	mu         sync.Mutex
+	goroutines int
+	heap       uint64
+	lag        time.Duration
+	breaches   []string
+	since      time.Time
+	shed       int64
+}
+
+// New crea el watchdog; name es el prefijo de las métricas (cache_proxy.goroutines).
+// restart se llama una sola vez, cuando los umbrales siguen superados tras RestartAfter.
+func New(name string, limits Limits, metrics Metrics, restart func(reason string)) *Watchdog {
+	return &Watchdog{name: name, limits: limits, metrics: metrics, restart: restart}
+}
+
+// Run mide el retraso del planificador y comprueba los umbrales hasta que ctx termina.
+func (w *Watchdog) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(lagTick)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				if lag := now.Sub(last) - lagTick; lag > time.Duration(w.maxLag.Load()) {
+					w.maxLag.Store(int64(lag))
+				}
+				last = now
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			w.check(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+func (w *Watchdog) gauge(name string, value float64) {
+	if w.metrics != nil {
+		w.metrics.Gauge(w.name+"."+name, value)
+	}
+}
+
+func (w *Watchdog) incr(name string) {
+	if w.metrics != nil {
+		w.metrics.Incr(w.name + "." + name)
+	}
+}
+
+func (w *Watchdog) check(now time.Time) {
+	goroutines := runtime.NumGoroutine()
+	heap := heapBytes()
+	lag := time.Duration(w.maxLag.Swap(0))
+
+	// Antes de rechazar trabajo, devolver al sistema la memoria que ya no se usa
+	if w.limits.HeapBytes > 0 && heap > w.limits.HeapBytes {
+		debug.FreeOSMemory()
+		heap = heapBytes()
+	}
+
+	var breaches []string
+	if w.limits.Goroutines > 0 && goroutines > w.limits.Goroutines {
+		breaches = append(breaches, fmt.Sprintf("%d goroutines (máximo %d)", goroutines, w.limits.Goroutines))
+	}
+	if w.limits.HeapBytes > 0 && heap > w.limits.HeapBytes {
+		breaches = append(breaches, fmt.Sprintf("heap de %d MiB (máximo %d)", heap>>20, w.limits.HeapBytes>>20))
+	}
+	if w.limits.Lag > 0 && lag > w.limits.Lag {
+		breaches = append(breaches, fmt.Sprintf("retraso del planificador de %s (máximo %s)", lag.Round(time.Millisecond), w.limits.Lag))
+	}
+
+	w.gauge("goroutines", float64(goroutines))
+	w.gauge("heap_bytes", float64(heap))
+	w.gauge("scheduler_lag_ms", float64(lag.Milliseconds()))
+
+	w.mu.Lock()
+	w.goroutines, w.heap, w.lag, w.breaches = goroutines, heap, lag, breaches
+	switch {
+	case len(breaches) == 0 && !w.since.IsZero():
+		log.Printf("✅ Watchdog: recuperado, se vuelve a aceptar trabajo nuevo")
+		w.since = time.Time{}
+	case len(breaches) > 0 && w.since.IsZero():
+		log.Printf("⚠️ Watchdog: rechazando trabajo nuevo por %s", strings.Join(breaches, ", "))
+		w.since = now
+	}
+	since := w.since
+	w.mu.Unlock()
+
+	shedding := len(breaches) > 0
+	w.shedding.Store(shedding)
+	if shedding {
+		w.gauge("shedding", 1)
+	} else {
+		w.gauge("shedding", 0)
+	}
+	if shedding && w.limits.RestartAfter > 0 && now.Sub(since) >= w.limits.RestartAfter && w.restarted.CompareAndSwap(false, true) {
+		w.incr("watchdog_restarts")
+		w.restart(strings.Join(breaches, ", "))
+	}
+}
+
+// Admit indica si se acepta trabajo nuevo; cada rechazo se cuenta como trabajo descartado.
+func (w *Watchdog) Admit() bool {
+	if !w.shedding.Load() {
+		return true
+	}
+	w.mu.Lock()
+	w.shed++
+	w.mu.Unlock()
+	w.incr("shed_requests")
+	return false
+}
+
+// Shedding indica si hay algún umbral superado, sin contar un rechazo.
+func (w *Watchdog) Shedding() bool {
+	return w.shedding.Load()
+}
+
+// Status devuelve la última medida, para los endpoints de salud.
+func (w *Watchdog) Status() map[string]any {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return map[string]any{
+		"goroutines":       w.goroutines,
+		"heap_bytes":       w.heap,
+		"scheduler_lag_ms": w.lag.Milliseconds(),
+		"shedding":         len(w.breaches) > 0,
+		"breaches":         w.breaches,
+		"shed_requests":    w.shed,
+		"restart_pending":  w.restarted.Load(),
+	}
+}
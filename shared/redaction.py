@@ -0,0 +1,130 @@
+"""
+Redacción de secretos compartida por el orchestrator y el API Gateway.
+Cada servicio la importa desde src/utils/redaction.py, un enlace a este archivo; las
+imágenes lo reciben con el contexto de build "shared" (ver scripts/build.sh).
+"""
+
+import logging
+import re
+from typing import Any, Dict, Optional
+
+REDACTED = "[REDACTED]"
+
+# Variables de entorno cuyo valor entero es secreto
+SECRET_NAME = r"[A-Z0-9_]*(?:TOKEN|SECRET|PASSWORD|PRIVATE_KEY|JIT_CONFIG|JITCONFIG)"
+
+# Patrones de secretos conocidos. Los grupos con nombre "keep" se conservan
+# para que el log siga indicando qué se ocultó.
+DEFAULT_REDACTION_PATTERNS = [
+    # Tokens de GitHub (PAT clásico/fine-grained, OAuth, instalación, refresh)
+    r"\bgh[pousr]_[A-Za-z0-9]{20,}\b",
+    r"\bgithub_pat_[A-Za-z0-9_]{20,}\b",
+    # Headers de autorización
+    r"(?P<keep>(?i:authorization)[\"']?\s*[:=]\s*[\"']?(?i:token|bearer|basic)\s+)[^\s\"',]+",
+    r"(?P<keep>(?i:bearer)\s+)[A-Za-z0-9._~+/=-]{16,}",
+    # Variables y argumentos con tokens de registro o JIT config
+    # (el nombre termina en la palabra clave; un valor entre comillas se oculta hasta la de cierre)
+    r"(?P<keep>\b" + SECRET_NAME + r"[\"']?\s*[=:]\s*(?P<quote>[\"'])?)"
+    r"(?(quote)(?:(?!(?P=quote)).)+|[^\s\"',]+)",
+    r"(?P<keep>--(?:token|jitconfig|pat)[=\s]+)[^\s\"',]+",
+    r"(?P<keep>\"(?:token|encoded_jit_config|client_token|secret_id)\"\s*:\s*\")[^\"]+",
+    # Credenciales de nube y Vault
+    r"\b(?:AKIA|ASIA)[A-Z0-9]{16}\b",
+    r"(?P<keep>(?i:aws_secret_access_key|aws_session_token)[\"']?\s*[=:]\s*[\"']?)[A-Za-z0-9/+=]+",
+    r"\bhv[sbr]\.[A-Za-z0-9_-]{20,}\b",
+    # Claves privadas PEM
+    r"-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----",
+]
+
+
+class SecretRedactor:
+    """
+    Oculta secretos en texto de logs y diagnósticos.
+
+    Combina patrones conocidos, patrones extra de LOG_REDACT_PATTERNS (separados
+    por ';') y valores concretos registrados en tiempo de ejecución (por ejemplo
+    cada registration token generado).
+    """
+
+    def __init__(self, extra_patterns: Optional[str] = None):
+        patterns = list(DEFAULT_REDACTION_PATTERNS)
+        for pattern in (extra_patterns or "").split(";"):
+            if pattern.strip():
+                patterns.append(pattern.strip())
+
+        self.patterns = []
+        for pattern in patterns:
+            try:
+                self.patterns.append(re.compile(pattern))
+            except re.error as e:
+                logging.getLogger(__name__).warning(f"Patrón de redacción inválido '{pattern}': {e}")
+
+        self.known_values: Dict[str, None] = {}
+
+    def register(self, value: Optional[str]):
+        """Registra un valor secreto concreto para ocultarlo donde aparezca."""
+        if value and len(value) >= 8:
+            self.known_values[value] = None
+            # Acotar memoria: los tokens de registro expiran en 1 hora
+            if len(self.known_values) > 1000:
+                self.known_values.pop(next(iter(self.known_values)))
+
+    def redact(self, text: Any) -> Any:
+        """Retorna el texto con los secretos reemplazados por [REDACTED]."""
+        if not isinstance(text, str) or not text:
+            return text
+
+        for value in list(self.known_values):
+            if value in text:
+                text = text.replace(value, REDACTED)
+
+        for pattern in self.patterns:
+            if "keep" in pattern.groupindex:
+                text = pattern.sub(lambda m: (m.group("keep") or "") + REDACTED, text)
+            else:
+                text = pattern.sub(REDACTED, text)
+        return text
+
+    def redact_env(self, env: Any) -> Any:
+        """Oculta valores sensibles en listas KEY=VALUE o diccionarios de entorno."""
+        if isinstance(env, dict):
+            return {key: self._redact_variable(key, value) for key, value in env.items()}
+        if isinstance(env, list):
+            return [self._redact_item(item) for item in env]
+        return env
+
+    def _redact_variable(self, key: str, value: Any) -> Any:
+        # En el entorno el valor no lleva comillas: con nombre secreto se oculta completo
+        if value and re.fullmatch(SECRET_NAME, str(key)):
+            return REDACTED
+        return self.redact(f"{key}={value}").split("=", 1)[1]
+
+    def _redact_item(self, item: Any) -> Any:
+        if not isinstance(item, str) or "=" not in item:
+            return self.redact(item)
+        key, value = item.split("=", 1)
+        return f"{key}={self._redact_variable(key, value)}"
+
+
+def install_log_redaction(redactor: SecretRedactor):
+    """
+    Aplica la redacción a todos los registros de logging del proceso.
+
+    Se usa una record factory en lugar de un filtro de handler para cubrir también
+    los handlers que uvicorn configura por su cuenta.
+    """
+    base_factory = logging.getLogRecordFactory()
+    formatter = logging.Formatter()
+
+    def factory(*args: Any, **kwargs: Any) -> logging.LogRecord:
+        record = base_factory(*args, **kwargs)
+        message = record.getMessage()
+        redacted = redactor.redact(message)
+        if redacted != message:
+            record.msg = redacted
+            record.args = None
+        if record.exc_info:
+            record.exc_text = redactor.redact(formatter.formatException(record.exc_info))
+        return record
+
+    logging.setLogRecordFactory(factory)